@@ -2,6 +2,7 @@
 package api
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"net"
@@ -24,11 +25,17 @@ import (
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
 	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+	"github.com/bluenviron/mediamtx/internal/servers/dash"
+	"github.com/bluenviron/mediamtx/internal/servers/gb28181"
 	"github.com/bluenviron/mediamtx/internal/servers/hls"
+	"github.com/bluenviron/mediamtx/internal/servers/httpflv"
+	"github.com/bluenviron/mediamtx/internal/servers/moq"
+	"github.com/bluenviron/mediamtx/internal/servers/rist"
 	"github.com/bluenviron/mediamtx/internal/servers/rtmp"
 	"github.com/bluenviron/mediamtx/internal/servers/rtsp"
 	"github.com/bluenviron/mediamtx/internal/servers/srt"
 	"github.com/bluenviron/mediamtx/internal/servers/webrtc"
+	"github.com/bluenviron/mediamtx/internal/servers/wsfmp4"
 )
 
 func interfaceIsEmpty(i interface{}) bool {
@@ -56,7 +63,31 @@ func paramName(ctx *gin.Context) (string, bool) {
 	return name[1:], true
 }
 
+func segmentEnd(segments []*recordstore.Segment, i int) time.Time {
+	switch {
+	case segments[i].Duration != 0:
+		return segments[i].Start.Add(segments[i].Duration)
+	case i != (len(segments) - 1):
+		return segments[i+1].Start
+	default:
+		return time.Now()
+	}
+}
+
+func segmentLocked(
+	recordLocks *recordstore.Locks,
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	end time.Time,
+) bool {
+	return pathConf.RecordLockedRanges.Overlaps(start, end) ||
+		recordLocks.Overlaps(pathName, start, end)
+}
+
 func recordingsOfPath(
+	recordIndex *recordstore.Index,
+	recordLocks *recordstore.Locks,
 	pathConf *conf.Path,
 	pathName string,
 ) *defs.APIRecording {
@@ -64,13 +95,14 @@ func recordingsOfPath(
 		Name: pathName,
 	}
 
-	segments, _ := recordstore.FindSegments(pathConf, pathName, nil, nil)
+	segments, _ := recordIndex.FindSegments(pathConf, pathName, nil, nil)
 
 	ret.Segments = make([]*defs.APIRecordingSegment, len(segments))
 
 	for i, seg := range segments {
 		ret.Segments[i] = &defs.APIRecordingSegment{
-			Start: seg.Start,
+			Start:  seg.Start,
+			Locked: segmentLocked(recordLocks, pathConf, pathName, seg.Start, segmentEnd(segments, i)),
 		}
 	}
 
@@ -80,6 +112,9 @@ func recordingsOfPath(
 type apiAuthManager interface {
 	Authenticate(req *auth.Request) error
 	RefreshJWTJWKS()
+	LockoutState() *auth.LockoutState
+	ClearLockouts(typ auth.LockoutType, value string) int
+	FlushHTTPCache() int
 }
 
 type apiParent interface {
@@ -89,24 +124,34 @@ type apiParent interface {
 
 // API is an API server.
 type API struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.Duration
-	Conf           *conf.Conf
-	AuthManager    apiAuthManager
-	PathManager    defs.APIPathManager
-	RTSPServer     defs.APIRTSPServer
-	RTSPSServer    defs.APIRTSPServer
-	RTMPServer     defs.APIRTMPServer
-	RTMPSServer    defs.APIRTMPServer
-	HLSServer      defs.APIHLSServer
-	WebRTCServer   defs.APIWebRTCServer
-	SRTServer      defs.APISRTServer
-	Parent         apiParent
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	Conf               *conf.Conf
+	RecordIndex        *recordstore.Index
+	RecordLocks        *recordstore.Locks
+	AuthManager        apiAuthManager
+	PathManager        defs.APIPathManager
+	RTSPServer         defs.APIRTSPServer
+	RTSPSServer        defs.APIRTSPServer
+	RTMPServer         defs.APIRTMPServer
+	RTMPSServer        defs.APIRTMPServer
+	HLSServer          defs.APIHLSServer
+	WebRTCServer       defs.APIWebRTCServer
+	SRTServer          defs.APISRTServer
+	HTTPFLVServer      defs.APIHTTPFLVServer
+	DASHServer         defs.APIDASHServer
+	WSFMP4Server       defs.APIWSFMP4Server
+	GB28181Server      defs.APIGB28181Server
+	RISTServer         defs.APIRISTServer
+	MoQServer          defs.APIMoQServer
+	Parent             apiParent
 
 	httpServer *httpp.Server
 	mutex      sync.RWMutex
@@ -123,6 +168,9 @@ func (a *API) Initialize() error {
 	group := router.Group("/v3")
 
 	group.POST("/auth/jwks/refresh", a.onAuthJwksRefresh)
+	group.POST("/auth/httpcache/flush", a.onAuthHTTPCacheFlush)
+	group.GET("/auth/lockouts/list", a.onAuthLockoutsList)
+	group.POST("/auth/lockouts/clear", a.onAuthLockoutsClear)
 
 	group.GET("/config/global/get", a.onConfigGlobalGet)
 	group.PATCH("/config/global/patch", a.onConfigGlobalPatch)
@@ -185,21 +233,62 @@ func (a *API) Initialize() error {
 		group.POST("/srtconns/kick/:id", a.onSRTConnsKick)
 	}
 
+	if !interfaceIsEmpty(a.HTTPFLVServer) {
+		group.GET("/httpflvconns/list", a.onHTTPFLVConnsList)
+		group.GET("/httpflvconns/get/:id", a.onHTTPFLVConnsGet)
+		group.POST("/httpflvconns/kick/:id", a.onHTTPFLVConnsKick)
+	}
+
+	if !interfaceIsEmpty(a.DASHServer) {
+		group.GET("/dashmuxers/list", a.onDASHMuxersList)
+		group.GET("/dashmuxers/get/*name", a.onDASHMuxersGet)
+	}
+
+	if !interfaceIsEmpty(a.WSFMP4Server) {
+		group.GET("/wsfmp4sessions/list", a.onWSFMP4SessionsList)
+		group.GET("/wsfmp4sessions/get/:id", a.onWSFMP4SessionsGet)
+		group.POST("/wsfmp4sessions/kick/:id", a.onWSFMP4SessionsKick)
+	}
+
+	if !interfaceIsEmpty(a.GB28181Server) {
+		group.GET("/gb28181devices/list", a.onGB28181DevicesList)
+		group.GET("/gb28181devices/get/:id", a.onGB28181DevicesGet)
+	}
+
+	if !interfaceIsEmpty(a.RISTServer) {
+		group.GET("/ristconns/list", a.onRISTConnsList)
+		group.GET("/ristconns/get/:id", a.onRISTConnsGet)
+		group.POST("/ristconns/kick/:id", a.onRISTConnsKick)
+	}
+
+	if !interfaceIsEmpty(a.MoQServer) {
+		group.GET("/moqsessions/list", a.onMoQSessionsList)
+		group.GET("/moqsessions/get/:id", a.onMoQSessionsGet)
+		group.POST("/moqsessions/kick/:id", a.onMoQSessionsKick)
+	}
+
 	group.GET("/recordings/list", a.onRecordingsList)
 	group.GET("/recordings/get/*name", a.onRecordingsGet)
 	group.DELETE("/recordings/deletesegment", a.onRecordingDeleteSegment)
+	group.GET("/recordings/verify", a.onRecordingVerify)
+
+	group.GET("/recordings/locks/list", a.onRecordingLocksList)
+	group.POST("/recordings/locks/add", a.onRecordingLocksAdd)
+	group.DELETE("/recordings/locks/delete/:id", a.onRecordingLocksDelete)
 
 	network, address := restrictnetwork.Restrict("tcp", a.Address)
 
 	a.httpServer = &httpp.Server{
-		Network:     network,
-		Address:     address,
-		ReadTimeout: time.Duration(a.ReadTimeout),
-		Encryption:  a.Encryption,
-		ServerCert:  a.ServerCert,
-		ServerKey:   a.ServerKey,
-		Handler:     router,
-		Parent:      a,
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(a.ReadTimeout),
+		Encryption:         a.Encryption,
+		ServerCert:         a.ServerCert,
+		ServerKey:          a.ServerKey,
+		ClientCA:           a.ClientCA,
+		ClientCertRequired: a.ClientCertRequired,
+		Handler:            router,
+		Parent:             a,
 	}
 	err := a.httpServer.Initialize()
 	if err != nil {
@@ -545,6 +634,68 @@ func (a *API) onAuthJwksRefresh(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *API) onAuthHTTPCacheFlush(ctx *gin.Context) {
+	n := a.AuthManager.FlushHTTPCache()
+	if n != 0 {
+		a.Log(logger.Info, "%d cached authentication results flushed", n)
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onAuthLockoutsList(ctx *gin.Context) {
+	data := &defs.APIAuthLockoutList{
+		Items: []*defs.APIAuthLockout{},
+	}
+
+	if state := a.AuthManager.LockoutState(); state != nil {
+		for _, item := range state.Items {
+			data.Items = append(data.Items, &defs.APIAuthLockout{
+				Type:         string(item.Type),
+				Value:        item.Value,
+				Failures:     item.Failures,
+				LastFailure:  item.LastFailure,
+				LockedUntil:  item.LockedUntil,
+				LockoutCount: item.LockoutCount,
+			})
+		}
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onAuthLockoutsClear(ctx *gin.Context) {
+	typ := auth.LockoutType(ctx.Query("type"))
+
+	switch typ {
+	case "", auth.LockoutTypeIP, auth.LockoutTypeUser:
+	default:
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'type' parameter"))
+		return
+	}
+
+	value := ctx.Query("value")
+	if value != "" && typ == "" {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("'value' requires 'type'"))
+		return
+	}
+
+	n := a.AuthManager.ClearLockouts(typ, value)
+	if n != 0 {
+		a.Log(logger.Info, "%d lockouts cleared", n)
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *API) onPathsList(ctx *gin.Context) {
 	data, err := a.PathManager.APIPathsList()
 	if err != nil {
@@ -1045,12 +1196,314 @@ func (a *API) onSRTConnsKick(ctx *gin.Context) {
 	ctx.Status(http.StatusOK)
 }
 
+func (a *API) onHTTPFLVConnsList(ctx *gin.Context) {
+	data, err := a.HTTPFLVServer.APIConnsList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onHTTPFLVConnsGet(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := a.HTTPFLVServer.APIConnsGet(uuid)
+	if err != nil {
+		if errors.Is(err, httpflv.ErrConnNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onHTTPFLVConnsKick(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = a.HTTPFLVServer.APIConnsKick(uuid)
+	if err != nil {
+		if errors.Is(err, httpflv.ErrConnNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onDASHMuxersList(ctx *gin.Context) {
+	data, err := a.DASHServer.APIMuxersList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onDASHMuxersGet(ctx *gin.Context) {
+	pathName, ok := paramName(ctx)
+	if !ok {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid name"))
+		return
+	}
+
+	data, err := a.DASHServer.APIMuxersGet(pathName)
+	if err != nil {
+		if errors.Is(err, dash.ErrMuxerNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onWSFMP4SessionsList(ctx *gin.Context) {
+	data, err := a.WSFMP4Server.APISessionsList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onWSFMP4SessionsGet(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := a.WSFMP4Server.APISessionsGet(uuid)
+	if err != nil {
+		if errors.Is(err, wsfmp4.ErrSessionNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onWSFMP4SessionsKick(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = a.WSFMP4Server.APISessionsKick(uuid)
+	if err != nil {
+		if errors.Is(err, wsfmp4.ErrSessionNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onGB28181DevicesList(ctx *gin.Context) {
+	data, err := a.GB28181Server.APIDevicesList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onGB28181DevicesGet(ctx *gin.Context) {
+	data, err := a.GB28181Server.APIDevicesGet(ctx.Param("id"))
+	if err != nil {
+		if errors.Is(err, gb28181.ErrDeviceNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRISTConnsList(ctx *gin.Context) {
+	data, err := a.RISTServer.APIConnsList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRISTConnsGet(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := a.RISTServer.APIConnsGet(uuid)
+	if err != nil {
+		if errors.Is(err, rist.ErrConnNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRISTConnsKick(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = a.RISTServer.APIConnsKick(uuid)
+	if err != nil {
+		if errors.Is(err, rist.ErrConnNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onMoQSessionsList(ctx *gin.Context) {
+	data, err := a.MoQServer.APISessionsList()
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	data.ItemCount = len(data.Items)
+	pageCount, err := paginate(&data.Items, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onMoQSessionsGet(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := a.MoQServer.APISessionsGet(uuid)
+	if err != nil {
+		if errors.Is(err, moq.ErrSessionNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onMoQSessionsKick(ctx *gin.Context) {
+	uuid, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = a.MoQServer.APISessionsKick(uuid)
+	if err != nil {
+		if errors.Is(err, moq.ErrSessionNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusOK)
+}
+
 func (a *API) onRecordingsList(ctx *gin.Context) {
 	a.mutex.RLock()
 	c := a.Conf
 	a.mutex.RUnlock()
 
-	pathNames := recordstore.FindAllPathsWithSegments(c.Paths)
+	pathNames := a.RecordIndex.FindAllPathsWithSegments(c.Paths)
 
 	data := defs.APIRecordingList{}
 
@@ -1066,7 +1519,7 @@ func (a *API) onRecordingsList(ctx *gin.Context) {
 
 	for i, pathName := range pathNames {
 		pathConf, _, _ := conf.FindPathConf(c.Paths, pathName)
-		data.Items[i] = recordingsOfPath(pathConf, pathName)
+		data.Items[i] = recordingsOfPath(a.RecordIndex, a.RecordLocks, pathConf, pathName)
 	}
 
 	ctx.JSON(http.StatusOK, data)
@@ -1089,7 +1542,7 @@ func (a *API) onRecordingsGet(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, recordingsOfPath(pathConf, pathName))
+	ctx.JSON(http.StatusOK, recordingsOfPath(a.RecordIndex, a.RecordLocks, pathConf, pathName))
 }
 
 func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
@@ -1120,12 +1573,203 @@ func (a *API) onRecordingDeleteSegment(ctx *gin.Context) {
 		Start: start,
 	}.Encode(pathFormat)
 
+	// segments that are not in the index are checked with a zero-length range,
+	// in order to catch at least locks that contain their start.
+	end := start
+	segments, _ := a.RecordIndex.FindSegments(pathConf, pathName, nil, nil)
+	for i, seg := range segments {
+		if seg.Start.Equal(start) {
+			end = segmentEnd(segments, i)
+			break
+		}
+	}
+
+	if segmentLocked(a.RecordLocks, pathConf, pathName, start, end) {
+		a.writeError(ctx, http.StatusConflict, fmt.Errorf("segment is locked"))
+		return
+	}
+
 	err = os.Remove(segmentPath)
 	if err != nil {
 		a.writeError(ctx, http.StatusBadRequest, err)
 		return
 	}
 
+	a.RecordIndex.RemoveSegment(pathName, segmentPath)
+
+	ctx.Status(http.StatusOK)
+}
+
+func (a *API) onRecordingVerify(ctx *gin.Context) {
+	pathName := ctx.Query("path")
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'start' parameter: %w", err))
+		return
+	}
+
+	end, err := time.Parse(time.RFC3339, ctx.Query("end"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid 'end' parameter: %w", err))
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	pathConf, _, err := conf.FindPathConf(c.Paths, pathName)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if !pathConf.RecordManifest {
+		a.writeError(ctx, http.StatusBadRequest, fmt.Errorf("manifests are not enabled on path '%s'", pathName))
+		return
+	}
+
+	key, err := recordstore.LoadManifestKey(pathConf.RecordManifestKey)
+	if err != nil {
+		a.writeError(ctx, http.StatusInternalServerError, fmt.Errorf("unable to load manifest key: %w", err))
+		return
+	}
+
+	report := recordstore.VerifyManifests(a.RecordIndex, pathConf, pathName, start, end,
+		key.Public().(ed25519.PublicKey))
+
+	// recordings of track policies have their own manifests
+	for _, p := range pathConf.RecordTrackPolicies {
+		policyReport := recordstore.VerifyManifests(a.RecordIndex, p.PathConf(pathConf), pathName, start, end,
+			key.Public().(ed25519.PublicKey))
+		report.Merge(policyReport)
+	}
+
+	data := &defs.APIRecordingVerification{
+		Path:     pathName,
+		Start:    start,
+		End:      end,
+		Valid:    report.Valid,
+		Segments: make([]*defs.APIRecordingVerificationSegment, len(report.Segments)),
+		Errors:   report.Errors,
+	}
+
+	if data.Errors == nil {
+		data.Errors = []string{}
+	}
+
+	for i, seg := range report.Segments {
+		data.Segments[i] = &defs.APIRecordingVerificationSegment{
+			Start:  seg.Start,
+			Status: string(seg.Status),
+		}
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func recordLockToAPI(l *recordstore.Lock) *defs.APIRecordLock {
+	return &defs.APIRecordLock{
+		ID:      l.ID,
+		Path:    l.Path,
+		Start:   l.Start,
+		End:     l.End,
+		Reason:  l.Reason,
+		Author:  l.Author,
+		Created: l.Created,
+	}
+}
+
+func (a *API) onRecordingLocksList(ctx *gin.Context) {
+	locks := a.RecordLocks.List()
+
+	if pathName := ctx.Query("path"); pathName != "" {
+		filtered := []*recordstore.Lock{}
+		for _, l := range locks {
+			if l.Path == pathName {
+				filtered = append(filtered, l)
+			}
+		}
+		locks = filtered
+	}
+
+	data := defs.APIRecordLockList{}
+
+	data.ItemCount = len(locks)
+	pageCount, err := paginate(&locks, ctx.Query("itemsPerPage"), ctx.Query("page"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	data.PageCount = pageCount
+
+	data.Items = make([]*defs.APIRecordLock, len(locks))
+
+	for i, l := range locks {
+		data.Items[i] = recordLockToAPI(l)
+	}
+
+	ctx.JSON(http.StatusOK, data)
+}
+
+func (a *API) onRecordingLocksAdd(ctx *gin.Context) {
+	var req defs.APIRecordLockAdd
+	err := jsonwrapper.Decode(ctx.Request.Body, &req)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	a.mutex.RLock()
+	c := a.Conf
+	a.mutex.RUnlock()
+
+	_, _, err = conf.FindPathConf(c.Paths, req.Path)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	author := req.Author
+	if author == "" {
+		author = httpp.Credentials(ctx.Request).User
+	}
+
+	l := &recordstore.Lock{
+		Path:   req.Path,
+		Start:  req.Start,
+		End:    req.End,
+		Reason: req.Reason,
+		Author: author,
+	}
+
+	err = a.RecordLocks.Add(l)
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recordLockToAPI(l))
+}
+
+func (a *API) onRecordingLocksDelete(ctx *gin.Context) {
+	id, err := uuid.Parse(ctx.Param("id"))
+	if err != nil {
+		a.writeError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	err = a.RecordLocks.Remove(id)
+	if err != nil {
+		if errors.Is(err, recordstore.ErrLockNotFound) {
+			a.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			a.writeError(ctx, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
 	ctx.Status(http.StatusOK)
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/auth"
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -604,10 +605,12 @@ func TestRecordingsList(t *testing.T) {
 				"name": "mypath1",
 				"segments": []interface{}{
 					map[string]interface{}{
-						"start": time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local).Format(time.RFC3339Nano),
+						"start":  time.Date(2008, 11, 0o7, 11, 22, 0, 500000000, time.Local).Format(time.RFC3339Nano),
+						"locked": false,
 					},
 					map[string]interface{}{
-						"start": time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+						"start":  time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+						"locked": false,
 					},
 				},
 			},
@@ -615,7 +618,8 @@ func TestRecordingsList(t *testing.T) {
 				"name": "mypath2",
 				"segments": []interface{}{
 					map[string]interface{}{
-						"start": time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+						"start":  time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+						"locked": false,
 					},
 				},
 			},
@@ -663,15 +667,109 @@ func TestRecordingsGet(t *testing.T) {
 		"name": "mypath1",
 		"segments": []interface{}{
 			map[string]interface{}{
-				"start": time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local).Format(time.RFC3339Nano),
+				"start":  time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local).Format(time.RFC3339Nano),
+				"locked": false,
 			},
 			map[string]interface{}{
-				"start": time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+				"start":  time.Date(2009, 11, 0o7, 11, 22, 0, 900000000, time.Local).Format(time.RFC3339Nano),
+				"locked": false,
 			},
 		},
 	}, out)
 }
 
+func TestRecordingsLocks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cnf := tempConf(t, "pathDefaults:\n"+
+		"  recordPath: "+filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")+"\n"+
+		"paths:\n"+
+		"  all_others:\n")
+
+	locks := &recordstore.Locks{
+		FilePath: filepath.Join(dir, "locks.json"),
+		Parent:   test.NilLogger,
+	}
+	err = locks.Initialize()
+	require.NoError(t, err)
+	defer locks.Close()
+
+	api := API{
+		Address:     "localhost:9997",
+		ReadTimeout: conf.Duration(10 * time.Second),
+		Conf:        cnf,
+		RecordLocks: locks,
+		AuthManager: test.NilAuthManager,
+		Parent:      &testParent{},
+	}
+	err = api.Initialize()
+	require.NoError(t, err)
+	defer api.Close()
+
+	err = os.Mkdir(filepath.Join(dir, "mypath1"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2008-11-07_11-22-00-000000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2009-11-07_11-22-00-000000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	var lock map[string]interface{}
+	httpRequest(t, hc, http.MethodPost, "http://localhost:9997/v3/recordings/locks/add", map[string]interface{}{
+		"path":   "mypath1",
+		"start":  time.Date(2008, 11, 0o7, 12, 0, 0, 0, time.Local).Format(time.RFC3339),
+		"end":    time.Date(2008, 11, 0o7, 13, 0, 0, 0, time.Local).Format(time.RFC3339),
+		"reason": "incident",
+		"author": "myuser",
+	}, &lock)
+	require.Equal(t, "mypath1", lock["path"])
+	require.Equal(t, "incident", lock["reason"])
+	require.Equal(t, "myuser", lock["author"])
+
+	var out interface{}
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/get/mypath1", nil, &out)
+	require.Equal(t, map[string]interface{}{
+		"name": "mypath1",
+		"segments": []interface{}{
+			map[string]interface{}{
+				"start":  time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local).Format(time.RFC3339Nano),
+				"locked": true,
+			},
+			map[string]interface{}{
+				"start":  time.Date(2009, 11, 0o7, 11, 22, 0, 0, time.Local).Format(time.RFC3339Nano),
+				"locked": false,
+			},
+		},
+	}, out)
+
+	var list map[string]interface{}
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/locks/list", nil, &list)
+	require.Equal(t, float64(1), list["itemCount"])
+	require.Equal(t, lock["id"], list["items"].([]interface{})[0].(map[string]interface{})["id"])
+
+	httpRequest(t, hc, http.MethodDelete, "http://localhost:9997/v3/recordings/locks/delete/"+lock["id"].(string), nil, nil)
+
+	httpRequest(t, hc, http.MethodGet, "http://localhost:9997/v3/recordings/locks/list", nil, &list)
+	require.Equal(t, float64(0), list["itemCount"])
+
+	req, err := http.NewRequest(http.MethodDelete,
+		"http://localhost:9997/v3/recordings/locks/delete/"+lock["id"].(string), nil)
+	require.NoError(t, err)
+
+	res, err := hc.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
 func TestRecordingsDeleteSegment(t *testing.T) {
 	dir, err := os.MkdirTemp("", "mediamtx-playback")
 	require.NoError(t, err)
@@ -720,6 +818,88 @@ func TestRecordingsDeleteSegment(t *testing.T) {
 	require.Equal(t, http.StatusOK, res.StatusCode)
 }
 
+func TestRecordingsDeleteSegmentLocked(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-playback")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cnf := tempConf(t, "pathDefaults:\n"+
+		"  recordPath: "+filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")+"\n"+
+		"paths:\n"+
+		"  all_others:\n")
+
+	locks := &recordstore.Locks{
+		FilePath: filepath.Join(dir, "locks.json"),
+		Parent:   test.NilLogger,
+	}
+	err = locks.Initialize()
+	require.NoError(t, err)
+	defer locks.Close()
+
+	api := API{
+		Address:     "localhost:9997",
+		ReadTimeout: conf.Duration(10 * time.Second),
+		Conf:        cnf,
+		RecordLocks: locks,
+		AuthManager: test.NilAuthManager,
+		Parent:      &testParent{},
+	}
+	err = api.Initialize()
+	require.NoError(t, err)
+	defer api.Close()
+
+	err = os.Mkdir(filepath.Join(dir, "mypath1"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2008-11-07_11-22-00-000000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath1", "2009-11-07_11-22-00-000000.mp4"), []byte(""), 0o644)
+	require.NoError(t, err)
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	// the lock starts after the beginning of the first segment.
+	var lock map[string]interface{}
+	httpRequest(t, hc, http.MethodPost, "http://localhost:9997/v3/recordings/locks/add", map[string]interface{}{
+		"path":  "mypath1",
+		"start": time.Date(2008, 11, 0o7, 12, 0, 0, 0, time.Local).Format(time.RFC3339),
+		"end":   time.Date(2008, 11, 0o7, 13, 0, 0, 0, time.Local).Format(time.RFC3339),
+	}, &lock)
+
+	deleteSegment := func(start time.Time) int {
+		u, err2 := url.Parse("http://localhost:9997/v3/recordings/deletesegment")
+		require.NoError(t, err2)
+
+		v := url.Values{}
+		v.Set("path", "mypath1")
+		v.Set("start", start.Format(time.RFC3339Nano))
+		u.RawQuery = v.Encode()
+
+		req, err2 := http.NewRequest(http.MethodDelete, u.String(), nil)
+		require.NoError(t, err2)
+
+		res, err2 := hc.Do(req)
+		require.NoError(t, err2)
+		defer res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	require.Equal(t, http.StatusConflict, deleteSegment(time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local)))
+
+	_, err = os.Stat(filepath.Join(dir, "mypath1", "2008-11-07_11-22-00-000000.mp4"))
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, deleteSegment(time.Date(2009, 11, 0o7, 11, 22, 0, 0, time.Local)))
+
+	httpRequest(t, hc, http.MethodDelete, "http://localhost:9997/v3/recordings/locks/delete/"+lock["id"].(string), nil, nil)
+
+	require.Equal(t, http.StatusOK, deleteSegment(time.Date(2008, 11, 0o7, 11, 22, 0, 0, time.Local)))
+}
+
 func TestAuthJWKSRefresh(t *testing.T) {
 	ok := false
 
@@ -757,3 +937,42 @@ func TestAuthJWKSRefresh(t *testing.T) {
 
 	require.True(t, ok)
 }
+
+func TestAuthHTTPCacheFlush(t *testing.T) {
+	ok := false
+
+	api := API{
+		Address:     "localhost:9997",
+		ReadTimeout: conf.Duration(10 * time.Second),
+		AuthManager: &test.AuthManager{
+			AuthenticateImpl: func(_ *auth.Request) error {
+				return nil
+			},
+			FlushHTTPCacheImpl: func() int {
+				ok = true
+				return 0
+			},
+		},
+		Parent: &testParent{},
+	}
+	err := api.Initialize()
+	require.NoError(t, err)
+	defer api.Close()
+
+	tr := &http.Transport{}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	u, err := url.Parse("http://localhost:9997/v3/auth/httpcache/flush")
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
+	require.NoError(t, err)
+
+	res, err := hc.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.True(t, ok)
+}
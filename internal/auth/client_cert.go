@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/x509"
+)
+
+// clientCertIdentities returns the identities of a client certificate.
+// Identities are the common name or, if mode is "san", DNS names, e-mail addresses and URIs.
+func clientCertIdentities(cert *x509.Certificate, mode string) []string {
+	if cert == nil {
+		return nil
+	}
+
+	if mode != "san" {
+		if cert.Subject.CommonName == "" {
+			return nil
+		}
+		return []string{cert.Subject.CommonName}
+	}
+
+	ret := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.URIs))
+	ret = append(ret, cert.DNSNames...)
+	ret = append(ret, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ret = append(ret, u.String())
+	}
+	return ret
+}
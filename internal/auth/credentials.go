@@ -1,8 +1,11 @@
 package auth
 
-// Credentials is a set of credentials (either user+pass or a token).
+import "crypto/x509"
+
+// Credentials is a set of credentials (either user+pass, a token or a client certificate).
 type Credentials struct {
-	User  string
-	Pass  string
-	Token string
+	User       string
+	Pass       string
+	Token      string
+	ClientCert *x509.Certificate // verified client certificate
 }
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hmacSign computes the signature of a token.
+// The signed message is made of action, path, expiration and,
+// optionally, IP, separated by newlines.
+func hmacSign(secret string, req *Request, expiry int64, bindIP bool) []byte {
+	msg := string(req.Action) + "\n" + req.Path + "\n" + strconv.FormatInt(expiry, 10)
+	if bindIP {
+		msg += "\n" + req.IP.String()
+	}
+
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(msg))
+	return h.Sum(nil)
+}
+
+// hmacVerify verifies a token in the format "expiration.signature",
+// where expiration is a Unix timestamp and signature is the
+// base64url-encoded (without padding) HMAC-SHA256 of the message.
+func hmacVerify(secret string, req *Request, token string, bindIP bool, now time.Time) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid token format")
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token expiration")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid token signature")
+	}
+
+	if !hmac.Equal(sig, hmacSign(secret, req, expiry, bindIP)) {
+		return fmt.Errorf("invalid token signature")
+	}
+
+	if now.Unix() >= expiry {
+		return fmt.Errorf("token is expired")
+	}
+
+	return nil
+}
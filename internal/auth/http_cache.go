@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpCachePrunePeriod = 10 * time.Second
+	httpCacheMaxEntries  = 10000
+)
+
+type httpCacheEntry struct {
+	err     error
+	expires time.Time
+}
+
+// httpCache caches results of the HTTP-based authentication.
+type httpCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+
+	mutex     sync.Mutex
+	entries   map[[sha256.Size]byte]*httpCacheEntry
+	lastPrune time.Time
+}
+
+func (c *httpCache) initialize() {
+	if c.maxEntries == 0 {
+		c.maxEntries = httpCacheMaxEntries
+	}
+	c.entries = make(map[[sha256.Size]byte]*httpCacheEntry)
+}
+
+// key returns a hash of the request fields that are sent to the authentication server,
+// in order to avoid storing credentials in plain text.
+func (c *httpCache) key(req *Request) [sha256.Size]byte {
+	var b strings.Builder
+	for _, f := range []string{
+		req.Credentials.User,
+		req.Credentials.Pass,
+		req.Credentials.Token,
+		req.IP.String(),
+		string(req.Action),
+		req.Path,
+		string(req.Protocol),
+		req.Query,
+	} {
+		b.WriteString(strconv.Itoa(len(f)))
+		b.WriteByte(':')
+		b.WriteString(f)
+	}
+	return sha256.Sum256([]byte(b.String()))
+}
+
+func (c *httpCache) get(key [sha256.Size]byte) *httpCacheEntry {
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if !now.Before(e.expires) {
+		delete(c.entries, key)
+		return nil
+	}
+
+	return e
+}
+
+// set stores the result of a response.
+// Only successful responses and explicit denials (401, 403) are cached.
+// The TTL can be overridden by the Cache-Control header of the response.
+func (c *httpCache) set(key [sha256.Size]byte, err error, statusCode int, header http.Header) {
+	var ttl time.Duration
+
+	switch {
+	case statusCode >= 200 && statusCode <= 299:
+		ttl = c.ttl
+
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		ttl = c.negativeTTL
+
+	default:
+		return
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	if v, ok := parseCacheControl(header.Values("Cache-Control")); ok {
+		ttl = v
+		if ttl <= 0 {
+			return
+		}
+	}
+
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if now.Sub(c.lastPrune) >= httpCachePrunePeriod {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+
+	c.entries[key] = &httpCacheEntry{
+		err:     err,
+		expires: now.Add(ttl),
+	}
+}
+
+// evict removes expired entries or, when there are none,
+// the entry that expires first.
+func (c *httpCache) evict(now time.Time) {
+	var oldestKey [sha256.Size]byte
+	var oldest *httpCacheEntry
+	removed := false
+
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+			removed = true
+		} else if oldest == nil || e.expires.Before(oldest.expires) {
+			oldestKey = k
+			oldest = e
+		}
+	}
+
+	if !removed && oldest != nil {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// flush removes all entries and returns their number.
+func (c *httpCache) flush() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[[sha256.Size]byte]*httpCacheEntry)
+	return n
+}
+
+// parseCacheControl returns the TTL set by a Cache-Control header.
+// no-store and no-cache disable caching; max-age sets the TTL.
+func parseCacheControl(values []string) (time.Duration, bool) {
+	found := false
+	var ttl time.Duration
+
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+
+			switch {
+			case directive == "no-store", directive == "no-cache":
+				return 0, true
+
+			case strings.HasPrefix(directive, "max-age="):
+				secs, err := strconv.ParseUint(strings.Trim(directive[len("max-age="):], `"`), 10, 31)
+				if err == nil {
+					ttl = time.Duration(secs) * time.Second
+					found = true
+				}
+			}
+		}
+	}
+
+	return ttl, found
+}
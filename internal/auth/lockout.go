@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum number of tracked identities.
+	defaultLockoutMaxEntries = 10000
+)
+
+// LockoutType is the type of a tracked identity.
+type LockoutType string
+
+// lockout types.
+const (
+	LockoutTypeIP   LockoutType = "ip"
+	LockoutTypeUser LockoutType = "user"
+)
+
+// Lockout is the state of a tracked identity.
+type Lockout struct {
+	Type         LockoutType
+	Value        string
+	Failures     int
+	LastFailure  time.Time
+	LockedUntil  *time.Time
+	LockoutCount int
+}
+
+// LockoutState is the state of the brute-force protection.
+type LockoutState struct {
+	// number of lockouts applied since startup.
+	Events uint64
+
+	Items []*Lockout
+}
+
+type lockoutKey struct {
+	typ   LockoutType
+	value string
+}
+
+type lockoutEntry struct {
+	failures     int
+	firstFailure time.Time
+	lastFailure  time.Time
+	lockedUntil  time.Time
+	lockoutCount int
+}
+
+// lockoutTracker tracks authentication failures of IPs and users
+// and locks them out with an exponential duration.
+type lockoutTracker struct {
+	maxFailures int
+	window      time.Duration
+	duration    time.Duration
+	maxDuration time.Duration
+	maxEntries  int
+	onLockout   func(typ LockoutType, value string, d time.Duration)
+
+	mutex   sync.Mutex
+	entries map[lockoutKey]*lockoutEntry
+	events  uint64
+}
+
+func (t *lockoutTracker) initialize() {
+	if t.maxEntries == 0 {
+		t.maxEntries = defaultLockoutMaxEntries
+	}
+	t.entries = make(map[lockoutKey]*lockoutEntry)
+}
+
+func (t *lockoutTracker) keys(req *Request) []lockoutKey {
+	var ret []lockoutKey
+
+	if req.IP != nil {
+		ret = append(ret, lockoutKey{LockoutTypeIP, req.IP.String()})
+	}
+
+	if req.Credentials != nil && req.Credentials.User != "" {
+		ret = append(ret, lockoutKey{LockoutTypeUser, req.Credentials.User})
+	}
+
+	return ret
+}
+
+// prune removes entries that are not locked and whose failures are outside the window.
+// It must be called with the mutex locked.
+func (t *lockoutTracker) prune(now time.Time) {
+	for key, e := range t.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) >= t.window {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// evict removes the entry that is not locked out and has the oldest failure,
+// in order to make room for a new one. Locked out entries are never evicted.
+// It returns false when all entries are locked out.
+// It must be called with the mutex locked.
+func (t *lockoutTracker) evict(now time.Time) bool {
+	var victim lockoutKey
+	var victimEntry *lockoutEntry
+
+	for key, e := range t.entries {
+		if now.Before(e.lockedUntil) {
+			continue
+		}
+
+		if victimEntry == nil || e.lastFailure.Before(victimEntry.lastFailure) {
+			victim = key
+			victimEntry = e
+		}
+	}
+
+	if victimEntry == nil {
+		return false
+	}
+
+	delete(t.entries, victim)
+	return true
+}
+
+// isLocked checks whether the IP or the user of a request is locked out.
+func (t *lockoutTracker) isLocked(req *Request) (LockoutType, bool) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, key := range t.keys(req) {
+		if e, ok := t.entries[key]; ok && now.Before(e.lockedUntil) {
+			return key.typ, true
+		}
+	}
+
+	return "", false
+}
+
+func (t *lockoutTracker) onFailure(req *Request) {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune(now)
+
+	for _, key := range t.keys(req) {
+		e, ok := t.entries[key]
+		if !ok {
+			if len(t.entries) >= t.maxEntries && !t.evict(now) {
+				continue
+			}
+
+			e = &lockoutEntry{}
+			t.entries[key] = e
+		}
+
+		if e.failures == 0 || now.Sub(e.firstFailure) >= t.window {
+			e.failures = 0
+			e.firstFailure = now
+		}
+
+		e.failures++
+		e.lastFailure = now
+
+		if e.failures >= t.maxFailures {
+			d := t.duration << e.lockoutCount
+			if d > t.maxDuration || d <= 0 {
+				d = t.maxDuration
+			}
+
+			e.lockoutCount++
+			e.lockedUntil = now.Add(d)
+			e.failures = 0
+			t.events++
+
+			t.onLockout(key.typ, key.value, d)
+		}
+	}
+}
+
+// onSuccess resets failures of the user.
+// Failures of the IP are kept, otherwise an attacker owning a valid account
+// could reset them by interleaving successful authentications.
+func (t *lockoutTracker) onSuccess(req *Request) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, key := range t.keys(req) {
+		if key.typ == LockoutTypeUser {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (t *lockoutTracker) state() *LockoutState {
+	now := time.Now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.prune(now)
+
+	ret := &LockoutState{
+		Events: t.events,
+		Items:  []*Lockout{},
+	}
+
+	for key, e := range t.entries {
+		item := &Lockout{
+			Type:         key.typ,
+			Value:        key.value,
+			Failures:     e.failures,
+			LastFailure:  e.lastFailure,
+			LockoutCount: e.lockoutCount,
+		}
+
+		if now.Before(e.lockedUntil) {
+			v := e.lockedUntil
+			item.LockedUntil = &v
+		}
+
+		ret.Items = append(ret.Items, item)
+	}
+
+	sort.Slice(ret.Items, func(i, j int) bool {
+		if ret.Items[i].Type != ret.Items[j].Type {
+			return ret.Items[i].Type < ret.Items[j].Type
+		}
+		return ret.Items[i].Value < ret.Items[j].Value
+	})
+
+	return ret
+}
+
+// clear removes tracked identities.
+// An empty type clears all identities; an empty value clears all identities of the given type.
+func (t *lockoutTracker) clear(typ LockoutType, value string) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	n := 0
+
+	for key := range t.entries {
+		if (typ == "" || key.typ == typ) && (value == "" || key.value == value) {
+			delete(t.entries, key)
+			n++
+		}
+	}
+
+	return n
+}
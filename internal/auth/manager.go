@@ -4,6 +4,7 @@ package auth
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/MicahParks/keyfunc/v3"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -35,7 +37,7 @@ func isHTTPRequest(r *Request) bool {
 	}
 
 	switch r.Protocol {
-	case ProtocolHLS, ProtocolWebRTC:
+	case ProtocolHLS, ProtocolWebRTC, ProtocolHTTPFLV, ProtocolDASH, ProtocolMJPEG, ProtocolWSFMP4:
 		return true
 	}
 
@@ -54,6 +56,20 @@ func (e Error) Error() string {
 	return "authentication failed: " + e.Wrapped.Error()
 }
 
+// notRejectedError is an error that is not caused by rejected credentials,
+// i.e. credentials have not been provided or the authentication server is unavailable.
+type notRejectedError struct {
+	err error
+}
+
+func (e notRejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e notRejectedError) Unwrap() error {
+	return e.err
+}
+
 func matchesPermission(perms []conf.AuthInternalUserPermission, req *Request) bool {
 	for _, perm := range perms {
 		if perm.Action == req.Action {
@@ -84,20 +100,64 @@ func matchesPermission(perms []conf.AuthInternalUserPermission, req *Request) bo
 
 // Manager is the authentication manager.
 type Manager struct {
-	Method             conf.AuthMethod
-	InternalUsers      []conf.AuthInternalUser
-	HTTPAddress        string
-	HTTPExclude        []conf.AuthInternalUserPermission
-	JWTJWKS            string
-	JWTJWKSFingerprint string
-	JWTClaimKey        string
-	JWTExclude         []conf.AuthInternalUserPermission
-	JWTInHTTPQuery     bool
-	ReadTimeout        time.Duration
+	Method               conf.AuthMethod
+	InternalUsers        []conf.AuthInternalUser
+	HTTPAddress          string
+	HTTPExclude          []conf.AuthInternalUserPermission
+	HTTPCacheTTL         time.Duration
+	HTTPCacheNegativeTTL time.Duration
+	JWTJWKS              string
+	JWTJWKSFingerprint   string
+	JWTClaimKey          string
+	JWTExclude           []conf.AuthInternalUserPermission
+	JWTInHTTPQuery       bool
+	HMACSecret           string
+	HMACBindIP           bool
+	HMACExclude          []conf.AuthInternalUserPermission
+	ClientCertIdentity   string
+	ReadTimeout          time.Duration
+	Lockout              bool
+	LockoutMaxFailures   int
+	LockoutWindow        time.Duration
+	LockoutDuration      time.Duration
+	LockoutMaxDuration   time.Duration
+	Parent               logger.Writer // only if Lockout is true
 
 	mutex           sync.RWMutex
 	jwksLastRefresh time.Time
 	jwtKeyFunc      keyfunc.Keyfunc
+	lockoutOnce     sync.Once
+	lockout         *lockoutTracker
+	httpCacheOnce   sync.Once
+	httpCache       *httpCache
+}
+
+func (m *Manager) lockoutTracker() *lockoutTracker {
+	m.lockoutOnce.Do(func() {
+		m.lockout = &lockoutTracker{
+			maxFailures: m.LockoutMaxFailures,
+			window:      m.LockoutWindow,
+			duration:    m.LockoutDuration,
+			maxDuration: m.LockoutMaxDuration,
+			onLockout: func(typ LockoutType, value string, d time.Duration) {
+				m.Parent.Log(logger.Warn, "[auth] %s '%s' locked out for %v after too many failed authentications",
+					typ, value, d)
+			},
+		}
+		m.lockout.initialize()
+	})
+	return m.lockout
+}
+
+func (m *Manager) httpCacheInstance() *httpCache {
+	m.httpCacheOnce.Do(func() {
+		m.httpCache = &httpCache{
+			ttl:         m.HTTPCacheTTL,
+			negativeTTL: m.HTTPCacheNegativeTTL,
+		}
+		m.httpCache.initialize()
+	})
+	return m.httpCache
 }
 
 // ReloadInternalUsers reloads InternalUsers.
@@ -109,6 +169,14 @@ func (m *Manager) ReloadInternalUsers(u []conf.AuthInternalUser) {
 
 // Authenticate authenticates a request.
 func (m *Manager) Authenticate(req *Request) error {
+	if m.Lockout {
+		if typ, locked := m.lockoutTracker().isLocked(req); locked {
+			return Error{
+				Wrapped: fmt.Errorf("%s is locked out due to too many failed authentications", typ),
+			}
+		}
+	}
+
 	var err error
 
 	switch m.Method {
@@ -118,17 +186,33 @@ func (m *Manager) Authenticate(req *Request) error {
 	case conf.AuthMethodHTTP:
 		err = m.authenticateHTTP(req)
 
+	case conf.AuthMethodHMAC:
+		err = m.authenticateHMAC(req)
+
 	default:
 		err = m.authenticateJWT(req)
 	}
 
 	if err != nil {
+		askCredentials := m.Method != conf.AuthMethodJWT && m.Method != conf.AuthMethodHMAC &&
+			req.Credentials.User == "" && req.Credentials.Pass == ""
+
+		// only credentials that have been presented and rejected are counted.
+		var notRejected notRejectedError
+		if m.Lockout && !askCredentials && !errors.As(err, &notRejected) {
+			m.lockoutTracker().onFailure(req)
+		}
+
 		return Error{
 			Wrapped:        err,
-			AskCredentials: m.Method != conf.AuthMethodJWT && req.Credentials.User == "" && req.Credentials.Pass == "",
+			AskCredentials: askCredentials,
 		}
 	}
 
+	if m.Lockout {
+		m.lockoutTracker().onSuccess(req)
+	}
+
 	return nil
 }
 
@@ -136,8 +220,10 @@ func (m *Manager) authenticateInternal(req *Request) error {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	certIdentities := clientCertIdentities(req.Credentials.ClientCert, m.ClientCertIdentity)
+
 	for _, u := range m.InternalUsers {
-		if ok := m.authenticateWithUser(req, &u); ok {
+		if ok := m.authenticateWithUser(req, &u, certIdentities); ok {
 			return nil
 		}
 	}
@@ -148,6 +234,7 @@ func (m *Manager) authenticateInternal(req *Request) error {
 func (m *Manager) authenticateWithUser(
 	req *Request,
 	u *conf.AuthInternalUser,
+	certIdentities []string,
 ) bool {
 	if len(u.IPs) != 0 && !u.IPs.Contains(req.IP) {
 		return false
@@ -157,6 +244,13 @@ func (m *Manager) authenticateWithUser(
 		return false
 	}
 
+	// a verified client certificate replaces the password.
+	for _, id := range certIdentities {
+		if u.User != "any" && u.User.Check(id) {
+			return true
+		}
+	}
+
 	if u.User != "any" {
 		if req.CustomVerifyFunc != nil {
 			if ok := req.CustomVerifyFunc(string(u.User), string(u.Pass)); !ok {
@@ -177,6 +271,31 @@ func (m *Manager) authenticateHTTP(req *Request) error {
 		return nil
 	}
 
+	if m.HTTPCacheTTL <= 0 && m.HTTPCacheNegativeTTL <= 0 {
+		_, _, err := m.performHTTPRequest(req)
+		return err
+	}
+
+	c := m.httpCacheInstance()
+	key := c.key(req)
+
+	if e := c.get(key); e != nil {
+		return e.err
+	}
+
+	statusCode, header, err := m.performHTTPRequest(req)
+
+	// errors that are not caused by a server reply are not cached.
+	if header != nil {
+		c.set(key, err, statusCode, header)
+	}
+
+	return err
+}
+
+// performHTTPRequest calls the authentication server.
+// It returns the status code and header of the response if the server replied.
+func (m *Manager) performHTTPRequest(req *Request) (int, http.Header, error) {
 	enc, _ := json.Marshal(struct {
 		IP       string     `json:"ip"`
 		User     string     `json:"user"`
@@ -201,19 +320,26 @@ func (m *Manager) authenticateHTTP(req *Request) error {
 
 	res, err := http.Post(m.HTTPAddress, "application/json", bytes.NewReader(enc))
 	if err != nil {
-		return fmt.Errorf("HTTP request failed: %w", err)
+		return 0, nil, notRejectedError{fmt.Errorf("HTTP request failed: %w", err)}
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		if resBody, err := io.ReadAll(res.Body); err == nil && len(resBody) != 0 {
-			return fmt.Errorf("server replied with code %d: %s", res.StatusCode, string(resBody))
+		if resBody, err2 := io.ReadAll(res.Body); err2 == nil && len(resBody) != 0 {
+			err = fmt.Errorf("server replied with code %d: %s", res.StatusCode, string(resBody))
+		} else {
+			err = fmt.Errorf("server replied with code %d", res.StatusCode)
+		}
+
+		// only explicit rejections are caused by credentials.
+		if res.StatusCode != http.StatusUnauthorized && res.StatusCode != http.StatusForbidden {
+			err = notRejectedError{err}
 		}
 
-		return fmt.Errorf("server replied with code %d", res.StatusCode)
+		return res.StatusCode, res.Header, err
 	}
 
-	return nil
+	return res.StatusCode, res.Header, nil
 }
 
 func (m *Manager) authenticateJWT(req *Request) error {
@@ -223,7 +349,7 @@ func (m *Manager) authenticateJWT(req *Request) error {
 
 	keyfunc, err := m.pullJWTJWKS()
 	if err != nil {
-		return err
+		return notRejectedError{err}
 	}
 
 	var encodedJWT string
@@ -243,13 +369,13 @@ func (m *Manager) authenticateJWT(req *Request) error {
 		}
 
 		if len(v["jwt"]) != 1 || len(v["jwt"][0]) == 0 {
-			return fmt.Errorf("JWT not provided")
+			return notRejectedError{fmt.Errorf("JWT not provided")}
 		}
 
 		encodedJWT = v["jwt"][0]
 
 	default:
-		return fmt.Errorf("JWT not provided")
+		return notRejectedError{fmt.Errorf("JWT not provided")}
 	}
 
 	var cc jwtClaims
@@ -266,6 +392,36 @@ func (m *Manager) authenticateJWT(req *Request) error {
 	return nil
 }
 
+func (m *Manager) authenticateHMAC(req *Request) error {
+	if matchesPermission(m.HMACExclude, req) {
+		return nil
+	}
+
+	var token string
+
+	switch {
+	case req.Credentials.Token != "":
+		token = req.Credentials.Token
+
+	case req.Credentials.Pass != "":
+		token = req.Credentials.Pass
+
+	default:
+		v, err := url.ParseQuery(req.Query)
+		if err != nil {
+			return err
+		}
+
+		if len(v["token"]) != 1 || len(v["token"][0]) == 0 {
+			return notRejectedError{fmt.Errorf("token not provided")}
+		}
+
+		token = v["token"][0]
+	}
+
+	return hmacVerify(m.HMACSecret, req, token, m.HMACBindIP, time.Now())
+}
+
 func (m *Manager) pullJWTJWKS() (jwt.Keyfunc, error) {
 	now := time.Now()
 
@@ -307,6 +463,33 @@ func (m *Manager) pullJWTJWKS() (jwt.Keyfunc, error) {
 	return m.jwtKeyFunc.Keyfunc, nil
 }
 
+// LockoutState returns the state of the brute-force protection.
+// It returns nil when the brute-force protection is disabled.
+func (m *Manager) LockoutState() *LockoutState {
+	if !m.Lockout {
+		return nil
+	}
+	return m.lockoutTracker().state()
+}
+
+// ClearLockouts removes tracked identities and returns the number of removed identities.
+// An empty type clears all identities; an empty value clears all identities of the given type.
+func (m *Manager) ClearLockouts(typ LockoutType, value string) int {
+	if !m.Lockout {
+		return 0
+	}
+	return m.lockoutTracker().clear(typ, value)
+}
+
+// FlushHTTPCache removes all cached results of the HTTP-based authentication
+// and returns the number of removed results.
+func (m *Manager) FlushHTTPCache() int {
+	if m.HTTPCacheTTL <= 0 && m.HTTPCacheNegativeTTL <= 0 {
+		return 0
+	}
+	return m.httpCacheInstance().flush()
+}
+
 // RefreshJWTJWKS refreshes the JWT JWKS.
 func (m *Manager) RefreshJWTJWKS() {
 	m.mutex.Lock()
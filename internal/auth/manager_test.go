@@ -4,14 +4,21 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/MicahParks/jwkset"
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/require"
 )
@@ -27,6 +34,11 @@ func mustParseCIDR(v string) net.IPNet {
 	return *ne
 }
 
+type nilLogger struct{}
+
+func (nilLogger) Log(_ logger.Level, _ string, _ ...interface{}) {
+}
+
 func TestAuthInternal(t *testing.T) {
 	for _, outcome := range []string{
 		"ok",
@@ -189,6 +201,70 @@ func TestAuthInternalCustomVerifyFunc(t *testing.T) {
 	}
 }
 
+func TestAuthInternalClientCert(t *testing.T) {
+	for _, ca := range []string{
+		"cn",
+		"san",
+		"wrong identity",
+		"no certificate",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			identity := "cn"
+			if ca == "san" {
+				identity = "san"
+			}
+
+			m := Manager{
+				Method: conf.AuthMethodInternal,
+				InternalUsers: []conf.AuthInternalUser{
+					{
+						User: "device1",
+						Pass: "testpass",
+						Permissions: []conf.AuthInternalUserPermission{
+							{
+								Action: conf.AuthActionPublish,
+								Path:   "mypath",
+							},
+						},
+					},
+				},
+				ClientCertIdentity: identity,
+			}
+
+			cert := &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "device1"},
+				DNSNames: []string{"device1"},
+			}
+			switch ca {
+			case "san":
+				cert.Subject.CommonName = "other"
+
+			case "wrong identity":
+				cert.Subject.CommonName = "device2"
+
+			case "no certificate":
+				cert = nil
+			}
+
+			err := m.Authenticate(&Request{
+				Action:   conf.AuthActionPublish,
+				Path:     "mypath",
+				Protocol: ProtocolRTSP,
+				Credentials: &Credentials{
+					ClientCert: cert,
+				},
+				IP: net.ParseIP("127.0.0.1"),
+			})
+
+			if ca == "cn" || ca == "san" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
 func TestAuthHTTP(t *testing.T) {
 	for _, outcome := range []string{"ok", "fail"} {
 		t.Run(outcome, func(t *testing.T) {
@@ -272,6 +348,111 @@ func TestAuthHTTP(t *testing.T) {
 	}
 }
 
+func TestAuthHTTPCache(t *testing.T) {
+	for _, ca := range []string{
+		"positive",
+		"negative",
+		"server error",
+		"no-store",
+		"max-age",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			count := 0
+
+			httpServ := &http.Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					count++
+
+					switch ca {
+					case "negative":
+						w.WriteHeader(http.StatusUnauthorized)
+
+					case "server error":
+						w.WriteHeader(http.StatusInternalServerError)
+
+					case "no-store":
+						w.Header().Set("Cache-Control", "no-store")
+
+					case "max-age":
+						w.Header().Set("Cache-Control", "public, max-age=0")
+					}
+				}),
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:9120")
+			require.NoError(t, err)
+
+			go httpServ.Serve(ln)
+			defer httpServ.Shutdown(context.Background())
+			defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+			m := Manager{
+				Method:               conf.AuthMethodHTTP,
+				HTTPAddress:          "http://127.0.0.1:9120/auth",
+				HTTPCacheTTL:         1 * time.Minute,
+				HTTPCacheNegativeTTL: 1 * time.Minute,
+			}
+
+			for i := 0; i < 2; i++ {
+				err = m.Authenticate(&Request{
+					Action:   conf.AuthActionRead,
+					Path:     "teststream",
+					Protocol: ProtocolHLS,
+					Credentials: &Credentials{
+						User: "testreader",
+						Pass: "testpass",
+					},
+					IP: net.ParseIP("127.0.0.1"),
+				})
+
+				if ca == "negative" || ca == "server error" {
+					require.Error(t, err)
+				} else {
+					require.NoError(t, err)
+				}
+			}
+
+			switch ca {
+			case "positive", "negative":
+				require.Equal(t, 1, count)
+				require.Equal(t, 1, m.FlushHTTPCache())
+
+			default:
+				require.Equal(t, 2, count)
+				require.Equal(t, 0, m.FlushHTTPCache())
+			}
+		})
+	}
+}
+
+func TestAuthHTTPCacheMaxEntries(t *testing.T) {
+	c := &httpCache{
+		ttl:         1 * time.Minute,
+		negativeTTL: 1 * time.Minute,
+		maxEntries:  2,
+	}
+	c.initialize()
+
+	var keys [][sha256.Size]byte
+
+	for i := 0; i < 3; i++ {
+		key := c.key(&Request{
+			Action:      conf.AuthActionRead,
+			Path:        "teststream" + strconv.Itoa(i),
+			Credentials: &Credentials{},
+			IP:          net.ParseIP("127.0.0.1"),
+		})
+		keys = append(keys, key)
+		c.set(key, nil, http.StatusOK, http.Header{})
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the entry that expires first is evicted
+	require.Nil(t, c.get(keys[0]))
+	require.NotNil(t, c.get(keys[1]))
+	require.NotNil(t, c.get(keys[2]))
+}
+
 func TestAuthHTTPExclude(t *testing.T) {
 	m := Manager{
 		Method:      conf.AuthMethodHTTP,
@@ -566,3 +747,230 @@ func TestAuthJWTRefresh(t *testing.T) {
 		m.RefreshJWTJWKS()
 	}
 }
+
+func TestAuthHMAC(t *testing.T) {
+	for _, ca := range []string{
+		"ok",
+		"ok query",
+		"ok bind ip",
+		"wrong path",
+		"wrong ip",
+		"expired",
+		"invalid",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			m := Manager{
+				Method:     conf.AuthMethodHMAC,
+				HMACSecret: "mysecret",
+				HMACBindIP: ca == "ok bind ip" || ca == "wrong ip",
+			}
+
+			expiry := time.Now().Add(1 * time.Minute).Unix()
+			if ca == "expired" {
+				expiry = time.Now().Add(-1 * time.Minute).Unix()
+			}
+
+			signReq := &Request{
+				Action: conf.AuthActionRead,
+				Path:   "mypath",
+				IP:     net.ParseIP("127.0.0.1"),
+			}
+			if ca == "wrong ip" {
+				signReq.IP = net.ParseIP("127.0.0.2")
+			}
+
+			token := strconv.FormatInt(expiry, 10) + "." +
+				base64.RawURLEncoding.EncodeToString(hmacSign("mysecret", signReq, expiry, m.HMACBindIP))
+			if ca == "invalid" {
+				token = "invalid"
+			}
+
+			req := &Request{
+				Action:      conf.AuthActionRead,
+				Path:        "mypath",
+				Protocol:    ProtocolRTSP,
+				Credentials: &Credentials{},
+				IP:          net.ParseIP("127.0.0.1"),
+			}
+
+			if ca == "wrong path" {
+				req.Path = "otherpath"
+			}
+
+			if ca == "ok query" {
+				req.Query = "param=value&token=" + token
+			} else {
+				req.Credentials.Token = token
+			}
+
+			err := m.Authenticate(req)
+
+			if strings.HasPrefix(ca, "ok") {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.False(t, err.(Error).AskCredentials) //nolint:errorlint
+			}
+		})
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	for _, ca := range []string{"ip", "user"} {
+		t.Run(ca, func(t *testing.T) {
+			m := Manager{
+				Method: conf.AuthMethodInternal,
+				InternalUsers: []conf.AuthInternalUser{
+					{
+						User: "testuser",
+						Pass: "testpass",
+						Permissions: []conf.AuthInternalUserPermission{{
+							Action: conf.AuthActionPublish,
+						}},
+					},
+				},
+				Lockout:            true,
+				LockoutMaxFailures: 3,
+				LockoutWindow:      10 * time.Minute,
+				LockoutDuration:    1 * time.Minute,
+				LockoutMaxDuration: 1 * time.Hour,
+				Parent:             &nilLogger{},
+			}
+
+			for i := 0; i < 3; i++ {
+				err := m.Authenticate(&Request{
+					Action: conf.AuthActionPublish,
+					Credentials: &Credentials{
+						User: "testuser",
+						Pass: "wrong",
+					},
+					IP: net.ParseIP("127.1.1.1"),
+				})
+				require.Error(t, err)
+			}
+
+			// requests without credentials are not counted and do not unlock
+			err := m.Authenticate(&Request{
+				Action:      conf.AuthActionPublish,
+				Credentials: &Credentials{},
+				IP:          net.ParseIP("127.1.1.2"),
+			})
+			require.Error(t, err)
+			require.True(t, err.(Error).AskCredentials) //nolint:errorlint
+
+			req := &Request{
+				Action: conf.AuthActionPublish,
+				Credentials: &Credentials{
+					User: "testuser",
+					Pass: "testpass",
+				},
+			}
+
+			if ca == "ip" {
+				req.Credentials.User = "otheruser"
+				m.InternalUsers[0].User = "otheruser"
+				req.IP = net.ParseIP("127.1.1.1")
+			} else {
+				req.IP = net.ParseIP("127.1.1.3")
+			}
+
+			err = m.Authenticate(req)
+			require.EqualError(t, err, "authentication failed: "+ca+" is locked out due to too many failed authentications")
+
+			state := m.LockoutState()
+			require.Equal(t, uint64(2), state.Events)
+			require.Len(t, state.Items, 2)
+			require.Equal(t, LockoutTypeIP, state.Items[0].Type)
+			require.Equal(t, "127.1.1.1", state.Items[0].Value)
+			require.NotNil(t, state.Items[0].LockedUntil)
+			require.Equal(t, LockoutTypeUser, state.Items[1].Type)
+			require.Equal(t, "testuser", state.Items[1].Value)
+			require.NotNil(t, state.Items[1].LockedUntil)
+
+			n := m.ClearLockouts(LockoutType(ca), "")
+			require.Equal(t, 1, n)
+
+			err = m.Authenticate(req)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthLockoutMaxEntries(t *testing.T) {
+	tr := &lockoutTracker{
+		maxFailures: 2,
+		window:      10 * time.Minute,
+		duration:    1 * time.Minute,
+		maxDuration: 1 * time.Hour,
+		maxEntries:  3,
+		onLockout:   func(LockoutType, string, time.Duration) {},
+	}
+	tr.initialize()
+
+	fail := func(user string) {
+		tr.onFailure(&Request{Credentials: &Credentials{User: user, Pass: "wrong"}})
+	}
+
+	fail("locked")
+	fail("locked")
+
+	for i := 0; i < 10; i++ {
+		fail("user" + strconv.Itoa(i))
+	}
+
+	state := tr.state()
+	require.Len(t, state.Items, 3)
+
+	// locked out identities are kept, unlocked ones with the oldest failure are evicted
+	require.Equal(t, "locked", state.Items[0].Value)
+	require.NotNil(t, state.Items[0].LockedUntil)
+	require.Equal(t, "user8", state.Items[1].Value)
+	require.Equal(t, "user9", state.Items[2].Value)
+
+	fail("user8")
+	fail("user9")
+
+	// when all identities are locked out, new ones are not tracked
+	fail("other")
+
+	state = tr.state()
+	require.Len(t, state.Items, 3)
+	require.Equal(t, "locked", state.Items[0].Value)
+	require.Equal(t, "user8", state.Items[1].Value)
+	require.Equal(t, "user9", state.Items[2].Value)
+}
+
+func TestAuthLockoutNoToken(t *testing.T) {
+	m := Manager{
+		Method:             conf.AuthMethodHMAC,
+		HMACSecret:         "testsecret",
+		Lockout:            true,
+		LockoutMaxFailures: 1,
+		LockoutWindow:      10 * time.Minute,
+		LockoutDuration:    1 * time.Minute,
+		LockoutMaxDuration: 1 * time.Hour,
+		Parent:             &nilLogger{},
+	}
+
+	req := &Request{
+		Action:      conf.AuthActionRead,
+		Path:        "teststream",
+		Credentials: &Credentials{},
+		IP:          net.ParseIP("127.1.1.1"),
+	}
+
+	// requests without a token are not counted
+	for i := 0; i < 3; i++ {
+		err := m.Authenticate(req)
+		require.EqualError(t, err, "authentication failed: token not provided")
+	}
+
+	require.Empty(t, m.LockoutState().Items)
+
+	// requests with a rejected token are counted
+	req.Query = "token=invalid"
+	err := m.Authenticate(req)
+	require.Error(t, err)
+
+	require.Len(t, m.LockoutState().Items, 1)
+}
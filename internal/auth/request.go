@@ -12,11 +12,18 @@ type Protocol string
 
 // protocols.
 const (
-	ProtocolRTSP   Protocol = "rtsp"
-	ProtocolRTMP   Protocol = "rtmp"
-	ProtocolHLS    Protocol = "hls"
-	ProtocolWebRTC Protocol = "webrtc"
-	ProtocolSRT    Protocol = "srt"
+	ProtocolRTSP    Protocol = "rtsp"
+	ProtocolRTMP    Protocol = "rtmp"
+	ProtocolHLS     Protocol = "hls"
+	ProtocolWebRTC  Protocol = "webrtc"
+	ProtocolSRT     Protocol = "srt"
+	ProtocolHTTPFLV Protocol = "httpflv"
+	ProtocolDASH    Protocol = "dash"
+	ProtocolMJPEG   Protocol = "mjpeg"
+	ProtocolWSFMP4  Protocol = "wsfmp4"
+	ProtocolGB28181 Protocol = "gb28181"
+	ProtocolRIST    Protocol = "rist"
+	ProtocolMoQ     Protocol = "moq"
 )
 
 // Request is an authentication request.
@@ -15,6 +15,7 @@ const (
 	AuthMethodInternal AuthMethod = iota
 	AuthMethodHTTP
 	AuthMethodJWT
+	AuthMethodHMAC
 )
 
 // MarshalJSON implements json.Marshaler.
@@ -28,6 +29,9 @@ func (d AuthMethod) MarshalJSON() ([]byte, error) {
 	case AuthMethodHTTP:
 		out = "http"
 
+	case AuthMethodHMAC:
+		out = "hmac"
+
 	default:
 		out = "jwt"
 	}
@@ -52,6 +56,9 @@ func (d *AuthMethod) UnmarshalJSON(b []byte) error {
 	case "jwt":
 		*d = AuthMethodJWT
 
+	case "hmac":
+		*d = AuthMethodHMAC
+
 	default:
 		return fmt.Errorf("invalid authMethod: '%s'", in)
 	}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -83,6 +84,18 @@ func copyStructFields(dest interface{}, source interface{}) {
 	}
 }
 
+func isDigits(v string, length int) bool {
+	if len(v) != length {
+		return false
+	}
+	for _, c := range v {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 func mustParseCIDR(v string) net.IPNet {
 	_, ne, err := net.ParseCIDR(v)
 	if err != nil {
@@ -158,18 +171,20 @@ var defaultAuthInternalUsers = AuthInternalUsers{
 // WARNING: Avoid using slices directly due to https://github.com/golang/go/issues/21092
 type Conf struct {
 	// General
-	LogLevel            LogLevel        `json:"logLevel"`
-	LogDestinations     LogDestinations `json:"logDestinations"`
-	LogFile             string          `json:"logFile"`
-	SysLogPrefix        string          `json:"sysLogPrefix"`
-	ReadTimeout         Duration        `json:"readTimeout"`
-	WriteTimeout        Duration        `json:"writeTimeout"`
-	ReadBufferCount     *int            `json:"readBufferCount,omitempty"` // deprecated
-	WriteQueueSize      int             `json:"writeQueueSize"`
-	UDPMaxPayloadSize   int             `json:"udpMaxPayloadSize"`
-	RunOnConnect        string          `json:"runOnConnect"`
-	RunOnConnectRestart bool            `json:"runOnConnectRestart"`
-	RunOnDisconnect     string          `json:"runOnDisconnect"`
+	LogLevel                    LogLevel        `json:"logLevel"`
+	LogDestinations             LogDestinations `json:"logDestinations"`
+	LogFile                     string          `json:"logFile"`
+	SysLogPrefix                string          `json:"sysLogPrefix"`
+	ReadTimeout                 Duration        `json:"readTimeout"`
+	WriteTimeout                Duration        `json:"writeTimeout"`
+	ReadBufferCount             *int            `json:"readBufferCount,omitempty"` // deprecated
+	WriteQueueSize              int             `json:"writeQueueSize"`
+	UDPMaxPayloadSize           int             `json:"udpMaxPayloadSize"`
+	ProxyProtocol               bool            `json:"proxyProtocol"`
+	ProxyProtocolTrustedSources IPNetworks      `json:"proxyProtocolTrustedSources"`
+	RunOnConnect                string          `json:"runOnConnect"`
+	RunOnConnectRestart         bool            `json:"runOnConnectRestart"`
+	RunOnDisconnect             string          `json:"runOnDisconnect"`
 
 	// Authentication
 	AuthMethod                AuthMethod                  `json:"authMethod"`
@@ -177,95 +192,129 @@ type Conf struct {
 	AuthHTTPAddress           string                      `json:"authHTTPAddress"`
 	ExternalAuthenticationURL *string                     `json:"externalAuthenticationURL,omitempty"` // deprecated
 	AuthHTTPExclude           AuthInternalUserPermissions `json:"authHTTPExclude"`
+	AuthHTTPCacheTTL          Duration                    `json:"authHTTPCacheTTL"`
+	AuthHTTPCacheNegativeTTL  Duration                    `json:"authHTTPCacheNegativeTTL"`
 	AuthJWTJWKS               string                      `json:"authJWTJWKS"`
 	AuthJWTJWKSFingerprint    string                      `json:"authJWTJWKSFingerprint"`
 	AuthJWTClaimKey           string                      `json:"authJWTClaimKey"`
 	AuthJWTExclude            AuthInternalUserPermissions `json:"authJWTExclude"`
 	AuthJWTInHTTPQuery        bool                        `json:"authJWTInHTTPQuery"`
+	AuthHMACSecret            Credential                  `json:"authHMACSecret"`
+	AuthHMACBindIP            bool                        `json:"authHMACBindIP"`
+	AuthHMACExclude           AuthInternalUserPermissions `json:"authHMACExclude"`
+	AuthClientCertIdentity    string                      `json:"authClientCertIdentity"`
+	AuthLockout               bool                        `json:"authLockout"`
+	AuthLockoutMaxFailures    int                         `json:"authLockoutMaxFailures"`
+	AuthLockoutWindow         Duration                    `json:"authLockoutWindow"`
+	AuthLockoutDuration       Duration                    `json:"authLockoutDuration"`
+	AuthLockoutMaxDuration    Duration                    `json:"authLockoutMaxDuration"`
 
 	// Control API
-	API               bool       `json:"api"`
-	APIAddress        string     `json:"apiAddress"`
-	APIEncryption     bool       `json:"apiEncryption"`
-	APIServerKey      string     `json:"apiServerKey"`
-	APIServerCert     string     `json:"apiServerCert"`
-	APIAllowOrigin    string     `json:"apiAllowOrigin"`
-	APITrustedProxies IPNetworks `json:"apiTrustedProxies"`
+	API                   bool       `json:"api"`
+	APIAddress            string     `json:"apiAddress"`
+	APIEncryption         bool       `json:"apiEncryption"`
+	APIServerKey          string     `json:"apiServerKey"`
+	APIServerCert         string     `json:"apiServerCert"`
+	APIClientCertCA       string     `json:"apiClientCertCA"`
+	APIClientCertRequired bool       `json:"apiClientCertRequired"`
+	APIAllowOrigin        string     `json:"apiAllowOrigin"`
+	APITrustedProxies     IPNetworks `json:"apiTrustedProxies"`
 
 	// Metrics
-	Metrics               bool       `json:"metrics"`
-	MetricsAddress        string     `json:"metricsAddress"`
-	MetricsEncryption     bool       `json:"metricsEncryption"`
-	MetricsServerKey      string     `json:"metricsServerKey"`
-	MetricsServerCert     string     `json:"metricsServerCert"`
-	MetricsAllowOrigin    string     `json:"metricsAllowOrigin"`
-	MetricsTrustedProxies IPNetworks `json:"metricsTrustedProxies"`
+	Metrics                   bool       `json:"metrics"`
+	MetricsAddress            string     `json:"metricsAddress"`
+	MetricsEncryption         bool       `json:"metricsEncryption"`
+	MetricsServerKey          string     `json:"metricsServerKey"`
+	MetricsServerCert         string     `json:"metricsServerCert"`
+	MetricsClientCertCA       string     `json:"metricsClientCertCA"`
+	MetricsClientCertRequired bool       `json:"metricsClientCertRequired"`
+	MetricsAllowOrigin        string     `json:"metricsAllowOrigin"`
+	MetricsTrustedProxies     IPNetworks `json:"metricsTrustedProxies"`
 
 	// PPROF
-	PPROF               bool       `json:"pprof"`
-	PPROFAddress        string     `json:"pprofAddress"`
-	PPROFEncryption     bool       `json:"pprofEncryption"`
-	PPROFServerKey      string     `json:"pprofServerKey"`
-	PPROFServerCert     string     `json:"pprofServerCert"`
-	PPROFAllowOrigin    string     `json:"pprofAllowOrigin"`
-	PPROFTrustedProxies IPNetworks `json:"pprofTrustedProxies"`
+	PPROF                   bool       `json:"pprof"`
+	PPROFAddress            string     `json:"pprofAddress"`
+	PPROFEncryption         bool       `json:"pprofEncryption"`
+	PPROFServerKey          string     `json:"pprofServerKey"`
+	PPROFServerCert         string     `json:"pprofServerCert"`
+	PPROFClientCertCA       string     `json:"pprofClientCertCA"`
+	PPROFClientCertRequired bool       `json:"pprofClientCertRequired"`
+	PPROFAllowOrigin        string     `json:"pprofAllowOrigin"`
+	PPROFTrustedProxies     IPNetworks `json:"pprofTrustedProxies"`
 
 	// Playback
-	Playback               bool       `json:"playback"`
-	PlaybackAddress        string     `json:"playbackAddress"`
-	PlaybackEncryption     bool       `json:"playbackEncryption"`
-	PlaybackServerKey      string     `json:"playbackServerKey"`
-	PlaybackServerCert     string     `json:"playbackServerCert"`
-	PlaybackAllowOrigin    string     `json:"playbackAllowOrigin"`
-	PlaybackTrustedProxies IPNetworks `json:"playbackTrustedProxies"`
+	Playback                   bool       `json:"playback"`
+	PlaybackAddress            string     `json:"playbackAddress"`
+	PlaybackEncryption         bool       `json:"playbackEncryption"`
+	PlaybackServerKey          string     `json:"playbackServerKey"`
+	PlaybackServerCert         string     `json:"playbackServerCert"`
+	PlaybackClientCertCA       string     `json:"playbackClientCertCA"`
+	PlaybackClientCertRequired bool       `json:"playbackClientCertRequired"`
+	PlaybackAllowOrigin        string     `json:"playbackAllowOrigin"`
+	PlaybackTrustedProxies     IPNetworks `json:"playbackTrustedProxies"`
+	PlaybackH2C                bool       `json:"playbackH2C"`
+	PlaybackHTTP3              bool       `json:"playbackHTTP3"`
 
 	// RTSP server
-	RTSP              bool             `json:"rtsp"`
-	RTSPDisable       *bool            `json:"rtspDisable,omitempty"` // deprecated
-	Protocols         *RTSPTransports  `json:"protocols,omitempty"`   // deprecated
-	RTSPTransports    RTSPTransports   `json:"rtspTransports"`
-	Encryption        *Encryption      `json:"encryption,omitempty"` // deprecated
-	RTSPEncryption    Encryption       `json:"rtspEncryption"`
-	RTSPAddress       string           `json:"rtspAddress"`
-	RTSPSAddress      string           `json:"rtspsAddress"`
-	RTPAddress        string           `json:"rtpAddress"`
-	RTCPAddress       string           `json:"rtcpAddress"`
-	MulticastIPRange  string           `json:"multicastIPRange"`
-	MulticastRTPPort  int              `json:"multicastRTPPort"`
-	MulticastRTCPPort int              `json:"multicastRTCPPort"`
-	ServerKey         *string          `json:"serverKey,omitempty"`
-	ServerCert        *string          `json:"serverCert,omitempty"`
-	RTSPServerKey     string           `json:"rtspServerKey"`
-	RTSPServerCert    string           `json:"rtspServerCert"`
-	AuthMethods       *RTSPAuthMethods `json:"authMethods,omitempty"` // deprecated
-	RTSPAuthMethods   RTSPAuthMethods  `json:"rtspAuthMethods"`
+	RTSP                        bool             `json:"rtsp"`
+	RTSPDisable                 *bool            `json:"rtspDisable,omitempty"` // deprecated
+	Protocols                   *RTSPTransports  `json:"protocols,omitempty"`   // deprecated
+	RTSPTransports              RTSPTransports   `json:"rtspTransports"`
+	Encryption                  *Encryption      `json:"encryption,omitempty"` // deprecated
+	RTSPEncryption              Encryption       `json:"rtspEncryption"`
+	RTSPAddress                 string           `json:"rtspAddress"`
+	RTSPSAddress                string           `json:"rtspsAddress"`
+	RTPAddress                  string           `json:"rtpAddress"`
+	RTCPAddress                 string           `json:"rtcpAddress"`
+	MulticastIPRange            string           `json:"multicastIPRange"`
+	MulticastRTPPort            int              `json:"multicastRTPPort"`
+	MulticastRTCPPort           int              `json:"multicastRTCPPort"`
+	ServerKey                   *string          `json:"serverKey,omitempty"`
+	ServerCert                  *string          `json:"serverCert,omitempty"`
+	RTSPServerKey               string           `json:"rtspServerKey"`
+	RTSPServerCert              string           `json:"rtspServerCert"`
+	RTSPClientCertCA            string           `json:"rtspClientCertCA"`
+	RTSPClientCertRequired      bool             `json:"rtspClientCertRequired"`
+	AuthMethods                 *RTSPAuthMethods `json:"authMethods,omitempty"` // deprecated
+	RTSPAuthMethods             RTSPAuthMethods  `json:"rtspAuthMethods"`
+	RTSPWebSocket               bool             `json:"rtspWebSocket"`
+	RTSPWebSocketAddress        string           `json:"rtspWebSocketAddress"`
+	RTSPWebSocketEncryption     bool             `json:"rtspWebSocketEncryption"`
+	RTSPWebSocketAllowOrigin    string           `json:"rtspWebSocketAllowOrigin"`
+	RTSPWebSocketTrustedProxies IPNetworks       `json:"rtspWebSocketTrustedProxies"`
 
 	// RTMP server
-	RTMP           bool       `json:"rtmp"`
-	RTMPDisable    *bool      `json:"rtmpDisable,omitempty"` // deprecated
-	RTMPAddress    string     `json:"rtmpAddress"`
-	RTMPEncryption Encryption `json:"rtmpEncryption"`
-	RTMPSAddress   string     `json:"rtmpsAddress"`
-	RTMPServerKey  string     `json:"rtmpServerKey"`
-	RTMPServerCert string     `json:"rtmpServerCert"`
+	RTMP                   bool       `json:"rtmp"`
+	RTMPDisable            *bool      `json:"rtmpDisable,omitempty"` // deprecated
+	RTMPAddress            string     `json:"rtmpAddress"`
+	RTMPEncryption         Encryption `json:"rtmpEncryption"`
+	RTMPSAddress           string     `json:"rtmpsAddress"`
+	RTMPServerKey          string     `json:"rtmpServerKey"`
+	RTMPServerCert         string     `json:"rtmpServerCert"`
+	RTMPClientCertCA       string     `json:"rtmpClientCertCA"`
+	RTMPClientCertRequired bool       `json:"rtmpClientCertRequired"`
 
 	// HLS server
-	HLS                bool       `json:"hls"`
-	HLSDisable         *bool      `json:"hlsDisable,omitempty"` // deprecated
-	HLSAddress         string     `json:"hlsAddress"`
-	HLSEncryption      bool       `json:"hlsEncryption"`
-	HLSServerKey       string     `json:"hlsServerKey"`
-	HLSServerCert      string     `json:"hlsServerCert"`
-	HLSAllowOrigin     string     `json:"hlsAllowOrigin"`
-	HLSTrustedProxies  IPNetworks `json:"hlsTrustedProxies"`
-	HLSAlwaysRemux     bool       `json:"hlsAlwaysRemux"`
-	HLSVariant         HLSVariant `json:"hlsVariant"`
-	HLSSegmentCount    int        `json:"hlsSegmentCount"`
-	HLSSegmentDuration Duration   `json:"hlsSegmentDuration"`
-	HLSPartDuration    Duration   `json:"hlsPartDuration"`
-	HLSSegmentMaxSize  StringSize `json:"hlsSegmentMaxSize"`
-	HLSDirectory       string     `json:"hlsDirectory"`
-	HLSMuxerCloseAfter Duration   `json:"hlsMuxerCloseAfter"`
+	HLS                   bool       `json:"hls"`
+	HLSDisable            *bool      `json:"hlsDisable,omitempty"` // deprecated
+	HLSAddress            string     `json:"hlsAddress"`
+	HLSEncryption         bool       `json:"hlsEncryption"`
+	HLSServerKey          string     `json:"hlsServerKey"`
+	HLSServerCert         string     `json:"hlsServerCert"`
+	HLSClientCertCA       string     `json:"hlsClientCertCA"`
+	HLSClientCertRequired bool       `json:"hlsClientCertRequired"`
+	HLSAllowOrigin        string     `json:"hlsAllowOrigin"`
+	HLSTrustedProxies     IPNetworks `json:"hlsTrustedProxies"`
+	HLSH2C                bool       `json:"hlsH2C"`
+	HLSHTTP3              bool       `json:"hlsHTTP3"`
+	HLSAlwaysRemux        bool       `json:"hlsAlwaysRemux"`
+	HLSVariant            HLSVariant `json:"hlsVariant"`
+	HLSSegmentCount       int        `json:"hlsSegmentCount"`
+	HLSSegmentDuration    Duration   `json:"hlsSegmentDuration"`
+	HLSPartDuration       Duration   `json:"hlsPartDuration"`
+	HLSSegmentMaxSize     StringSize `json:"hlsSegmentMaxSize"`
+	HLSDirectory          string     `json:"hlsDirectory"`
+	HLSMuxerCloseAfter    Duration   `json:"hlsMuxerCloseAfter"`
 
 	// WebRTC server
 	WebRTC                      bool             `json:"webrtc"`
@@ -274,8 +323,12 @@ type Conf struct {
 	WebRTCEncryption            bool             `json:"webrtcEncryption"`
 	WebRTCServerKey             string           `json:"webrtcServerKey"`
 	WebRTCServerCert            string           `json:"webrtcServerCert"`
+	WebRTCClientCertCA          string           `json:"webrtcClientCertCA"`
+	WebRTCClientCertRequired    bool             `json:"webrtcClientCertRequired"`
 	WebRTCAllowOrigin           string           `json:"webrtcAllowOrigin"`
 	WebRTCTrustedProxies        IPNetworks       `json:"webrtcTrustedProxies"`
+	WebRTCH2C                   bool             `json:"webrtcH2C"`
+	WebRTCHTTP3                 bool             `json:"webrtcHTTP3"`
 	WebRTCLocalUDPAddress       string           `json:"webrtcLocalUDPAddress"`
 	WebRTCLocalTCPAddress       string           `json:"webrtcLocalTCPAddress"`
 	WebRTCIPsFromInterfaces     bool             `json:"webrtcIPsFromInterfaces"`
@@ -291,8 +344,102 @@ type Conf struct {
 	WebRTCICEServers            *[]string        `json:"webrtcICEServers,omitempty"`        // deprecated
 
 	// SRT server
-	SRT        bool   `json:"srt"`
-	SRTAddress string `json:"srtAddress"`
+	SRT              bool   `json:"srt"`
+	SRTAddress       string `json:"srtAddress"`
+	SRTProxyProtocol bool   `json:"srtProxyProtocol"`
+
+	// HTTP-FLV server
+	HTTPFLV                   bool       `json:"httpflv"`
+	HTTPFLVAddress            string     `json:"httpflvAddress"`
+	HTTPFLVEncryption         bool       `json:"httpflvEncryption"`
+	HTTPFLVServerKey          string     `json:"httpflvServerKey"`
+	HTTPFLVServerCert         string     `json:"httpflvServerCert"`
+	HTTPFLVClientCertCA       string     `json:"httpflvClientCertCA"`
+	HTTPFLVClientCertRequired bool       `json:"httpflvClientCertRequired"`
+	HTTPFLVAllowOrigin        string     `json:"httpflvAllowOrigin"`
+	HTTPFLVTrustedProxies     IPNetworks `json:"httpflvTrustedProxies"`
+
+	// MPEG-DASH server
+	DASH                   bool       `json:"dash"`
+	DASHAddress            string     `json:"dashAddress"`
+	DASHEncryption         bool       `json:"dashEncryption"`
+	DASHServerKey          string     `json:"dashServerKey"`
+	DASHServerCert         string     `json:"dashServerCert"`
+	DASHClientCertCA       string     `json:"dashClientCertCA"`
+	DASHClientCertRequired bool       `json:"dashClientCertRequired"`
+	DASHAllowOrigin        string     `json:"dashAllowOrigin"`
+	DASHTrustedProxies     IPNetworks `json:"dashTrustedProxies"`
+	DASHSegmentTimeline    bool       `json:"dashSegmentTimeline"`
+	DASHLowLatency         bool       `json:"dashLowLatency"`
+	DASHSegmentCount       int        `json:"dashSegmentCount"`
+	DASHSegmentDuration    Duration   `json:"dashSegmentDuration"`
+	DASHPartDuration       Duration   `json:"dashPartDuration"`
+	DASHMuxerCloseAfter    Duration   `json:"dashMuxerCloseAfter"`
+
+	// M-JPEG server
+	MJPEG                   bool       `json:"mjpeg"`
+	MJPEGAddress            string     `json:"mjpegAddress"`
+	MJPEGEncryption         bool       `json:"mjpegEncryption"`
+	MJPEGServerKey          string     `json:"mjpegServerKey"`
+	MJPEGServerCert         string     `json:"mjpegServerCert"`
+	MJPEGClientCertCA       string     `json:"mjpegClientCertCA"`
+	MJPEGClientCertRequired bool       `json:"mjpegClientCertRequired"`
+	MJPEGAllowOrigin        string     `json:"mjpegAllowOrigin"`
+	MJPEGTrustedProxies     IPNetworks `json:"mjpegTrustedProxies"`
+
+	// WebSocket-fMP4 server
+	WSFMP4                   bool       `json:"wsfmp4"`
+	WSFMP4Address            string     `json:"wsfmp4Address"`
+	WSFMP4Encryption         bool       `json:"wsfmp4Encryption"`
+	WSFMP4ServerKey          string     `json:"wsfmp4ServerKey"`
+	WSFMP4ServerCert         string     `json:"wsfmp4ServerCert"`
+	WSFMP4ClientCertCA       string     `json:"wsfmp4ClientCertCA"`
+	WSFMP4ClientCertRequired bool       `json:"wsfmp4ClientCertRequired"`
+	WSFMP4AllowOrigin        string     `json:"wsfmp4AllowOrigin"`
+	WSFMP4TrustedProxies     IPNetworks `json:"wsfmp4TrustedProxies"`
+
+	// GB28181 server
+	GB28181                 bool     `json:"gb28181"`
+	GB28181SIPAddress       string   `json:"gb28181SIPAddress"`
+	GB28181MediaAddress     string   `json:"gb28181MediaAddress"`
+	GB28181ServerID         string   `json:"gb28181ServerID"`
+	GB28181Domain           string   `json:"gb28181Domain"`
+	GB28181Password         string   `json:"gb28181Password"`
+	GB28181AllowNoPassword  bool     `json:"gb28181AllowNoPassword"`
+	GB28181ExternalIP       string   `json:"gb28181ExternalIP"`
+	GB28181Transport        string   `json:"gb28181Transport"`
+	GB28181KeepaliveTimeout Duration `json:"gb28181KeepaliveTimeout"`
+
+	// RIST server
+	RIST           bool     `json:"rist"`
+	RISTAddress    string   `json:"ristAddress"`
+	RISTBufferSize Duration `json:"ristBufferSize"`
+
+	// MoQ server
+	MoQ                   bool   `json:"moq"`
+	MoQAddress            string `json:"moqAddress"`
+	MoQServerKey          string `json:"moqServerKey"`
+	MoQServerCert         string `json:"moqServerCert"`
+	MoQClientCertCA       string `json:"moqClientCertCA"`
+	MoQClientCertRequired bool   `json:"moqClientCertRequired"`
+	MoQAllowOrigin        string `json:"moqAllowOrigin"`
+
+	// MPTS output
+	MPTS                   bool         `json:"mpts"`
+	MPTSAddress            string       `json:"mptsAddress"`
+	MPTSMulticastTTL       int          `json:"mptsMulticastTTL"`
+	MPTSMulticastInterface string       `json:"mptsMulticastInterface"`
+	MPTSBitrate            int          `json:"mptsBitrate"`
+	MPTSTransportStreamID  int          `json:"mptsTransportStreamID"`
+	MPTSOriginalNetworkID  int          `json:"mptsOriginalNetworkID"`
+	MPTSPrograms           MPTSPrograms `json:"mptsPrograms"`
+
+	// Record
+	RecordIndex        bool       `json:"recordIndex"`
+	RecordIndexPath    string     `json:"recordIndexPath"`
+	RecordMaxTotalSize StringSize `json:"recordMaxTotalSize"`
+	RecordMinFreeSpace StringSize `json:"recordMinFreeSpace"`
+	RecordLocksPath    string     `json:"recordLocksPath"`
 
 	// Record (deprecated)
 	Record                *bool         `json:"record,omitempty"`                // deprecated
@@ -337,6 +484,12 @@ func (conf *Conf) setDefaults() {
 	conf.AuthJWTClaimKey = "mediamtx_permissions"
 	conf.AuthJWTExclude = []AuthInternalUserPermission{}
 	conf.AuthJWTInHTTPQuery = true
+	conf.AuthHMACExclude = []AuthInternalUserPermission{}
+	conf.AuthClientCertIdentity = "cn"
+	conf.AuthLockoutMaxFailures = 5
+	conf.AuthLockoutWindow = 10 * Duration(time.Minute)
+	conf.AuthLockoutDuration = 1 * Duration(time.Minute)
+	conf.AuthLockoutMaxDuration = 1 * Duration(time.Hour)
 
 	// Control API
 	conf.APIAddress = ":9997"
@@ -379,6 +532,8 @@ func (conf *Conf) setDefaults() {
 	conf.RTSPServerKey = "server.key"
 	conf.RTSPServerCert = "server.crt"
 	conf.RTSPAuthMethods = RTSPAuthMethods{auth.VerifyMethodBasic}
+	conf.RTSPWebSocketAddress = ":8898"
+	conf.RTSPWebSocketAllowOrigin = "*"
 
 	// RTMP server
 	conf.RTMP = true
@@ -419,6 +574,65 @@ func (conf *Conf) setDefaults() {
 	conf.SRT = true
 	conf.SRTAddress = ":8890"
 
+	// HTTP-FLV server
+	conf.HTTPFLVAddress = ":8891"
+	conf.HTTPFLVServerKey = "server.key"
+	conf.HTTPFLVServerCert = "server.crt"
+	conf.HTTPFLVAllowOrigin = "*"
+
+	// MPEG-DASH server
+	conf.DASHAddress = ":8892"
+	conf.DASHServerKey = "server.key"
+	conf.DASHServerCert = "server.crt"
+	conf.DASHAllowOrigin = "*"
+	conf.DASHSegmentTimeline = true
+	conf.DASHSegmentCount = 7
+	conf.DASHSegmentDuration = 1 * Duration(time.Second)
+	conf.DASHPartDuration = 200 * Duration(time.Millisecond)
+	conf.DASHMuxerCloseAfter = 60 * Duration(time.Second)
+
+	// M-JPEG server
+	conf.MJPEGAddress = ":8893"
+	conf.MJPEGServerKey = "server.key"
+	conf.MJPEGServerCert = "server.crt"
+	conf.MJPEGAllowOrigin = "*"
+
+	// WebSocket-fMP4 server
+	conf.WSFMP4Address = ":8894"
+	conf.WSFMP4ServerKey = "server.key"
+	conf.WSFMP4ServerCert = "server.crt"
+	conf.WSFMP4AllowOrigin = "*"
+
+	// GB28181 server
+	conf.GB28181SIPAddress = ":5060"
+	conf.GB28181MediaAddress = ":9000"
+	conf.GB28181ServerID = "34020000002000000001"
+	conf.GB28181Domain = "3402000000"
+	conf.GB28181Transport = "udp"
+	conf.GB28181KeepaliveTimeout = 180 * Duration(time.Second)
+
+	// RIST server
+	conf.RISTAddress = ":8896"
+	conf.RISTBufferSize = 1 * Duration(time.Second)
+
+	// MoQ server
+	conf.MoQAddress = ":8895"
+	conf.MoQServerKey = "server.key"
+	conf.MoQServerCert = "server.crt"
+	conf.MoQAllowOrigin = "*"
+
+	// MPTS output
+	conf.MPTSAddress = "239.0.0.1:1234"
+	conf.MPTSMulticastTTL = 1
+	conf.MPTSBitrate = 10000000
+	conf.MPTSTransportStreamID = 1
+	conf.MPTSOriginalNetworkID = 1
+	conf.MPTSPrograms = MPTSPrograms{}
+
+	// Record
+	conf.RecordIndexPath = "./recordings/index.jsonl"
+	conf.RecordLocksPath = "./recordings/locks.json"
+
 	conf.PathDefaults.setDefaults()
 }
 
@@ -533,6 +747,10 @@ func (conf *Conf) Validate(l logger.Writer) error {
 	if conf.UDPMaxPayloadSize > 1472 {
 		return fmt.Errorf("'udpMaxPayloadSize' must be less than 1472")
 	}
+	if (conf.ProxyProtocol || conf.SRTProxyProtocol) && len(conf.ProxyProtocolTrustedSources) == 0 {
+		return fmt.Errorf("'proxyProtocolTrustedSources' must not be empty when 'proxyProtocol' " +
+			"or 'srtProxyProtocol' is enabled")
+	}
 
 	// Authentication
 
@@ -595,6 +813,12 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		if conf.AuthHTTPAddress == "" {
 			return fmt.Errorf("'authHTTPAddress' is empty")
 		}
+		if conf.AuthHTTPCacheTTL < 0 {
+			return fmt.Errorf("'authHTTPCacheTTL' must be greater than or equal to zero")
+		}
+		if conf.AuthHTTPCacheNegativeTTL < 0 {
+			return fmt.Errorf("'authHTTPCacheNegativeTTL' must be greater than or equal to zero")
+		}
 
 	case AuthMethodJWT:
 		if conf.AuthJWTJWKS == "" {
@@ -603,6 +827,62 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		if conf.AuthJWTClaimKey == "" {
 			return fmt.Errorf("'authJWTClaimKey' is empty")
 		}
+
+	case AuthMethodHMAC:
+		if conf.AuthHMACSecret == "" {
+			return fmt.Errorf("'authHMACSecret' is empty")
+		}
+		if conf.AuthHMACSecret.IsHashed() {
+			return fmt.Errorf("'authHMACSecret' cannot be hashed")
+		}
+	}
+	for _, l := range []struct {
+		name     string
+		ca       string
+		required bool
+	}{
+		{"metrics", conf.MetricsClientCertCA, conf.MetricsClientCertRequired},
+		{"pprof", conf.PPROFClientCertCA, conf.PPROFClientCertRequired},
+		{"playback", conf.PlaybackClientCertCA, conf.PlaybackClientCertRequired},
+		{"rtsp", conf.RTSPClientCertCA, conf.RTSPClientCertRequired},
+		{"rtmp", conf.RTMPClientCertCA, conf.RTMPClientCertRequired},
+		{"hls", conf.HLSClientCertCA, conf.HLSClientCertRequired},
+		{"webrtc", conf.WebRTCClientCertCA, conf.WebRTCClientCertRequired},
+		{"httpflv", conf.HTTPFLVClientCertCA, conf.HTTPFLVClientCertRequired},
+		{"dash", conf.DASHClientCertCA, conf.DASHClientCertRequired},
+		{"mjpeg", conf.MJPEGClientCertCA, conf.MJPEGClientCertRequired},
+		{"wsfmp4", conf.WSFMP4ClientCertCA, conf.WSFMP4ClientCertRequired},
+		{"moq", conf.MoQClientCertCA, conf.MoQClientCertRequired},
+		{"api", conf.APIClientCertCA, conf.APIClientCertRequired},
+	} {
+		if l.required && l.ca == "" {
+			return fmt.Errorf("'%sClientCertRequired' requires '%sClientCertCA'", l.name, l.name)
+		}
+	}
+	switch conf.AuthClientCertIdentity {
+	case "cn", "san":
+	default:
+		return fmt.Errorf("invalid 'authClientCertIdentity': %v", conf.AuthClientCertIdentity)
+	}
+	if conf.AuthLockout {
+		if conf.AuthLockoutMaxFailures <= 0 {
+			return fmt.Errorf("'authLockoutMaxFailures' must be greater than zero")
+		}
+		if conf.AuthLockoutWindow <= 0 {
+			return fmt.Errorf("'authLockoutWindow' must be greater than zero")
+		}
+		if conf.AuthLockoutDuration <= 0 {
+			return fmt.Errorf("'authLockoutDuration' must be greater than zero")
+		}
+		if conf.AuthLockoutMaxDuration < conf.AuthLockoutDuration {
+			return fmt.Errorf("'authLockoutMaxDuration' must be greater than or equal to 'authLockoutDuration'")
+		}
+	}
+
+	// Playback
+
+	if conf.PlaybackHTTP3 && !conf.PlaybackEncryption {
+		return fmt.Errorf("'playbackHTTP3' requires 'playbackEncryption'")
 	}
 
 	// RTSP
@@ -626,6 +906,9 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		if _, ok := conf.RTSPTransports[gortsplib.TransportUDPMulticast]; ok {
 			return fmt.Errorf("strict encryption cannot be used with the UDP-multicast transport protocol")
 		}
+		if conf.RTSPWebSocket {
+			return fmt.Errorf("strict encryption cannot be used with RTSP over WebSocket, use 'rtspWebSocketEncryption' instead")
+		}
 	}
 	if conf.AuthMethods != nil {
 		l.Log(logger.Warn, "parameter 'authMethods' is deprecated and has been replaced with 'rtspAuthMethods'")
@@ -666,6 +949,9 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		l.Log(logger.Warn, "parameter 'hlsDisable' is deprecated and has been replaced with 'hls'")
 		conf.HLS = !*conf.HLSDisable
 	}
+	if conf.HLSHTTP3 && !conf.HLSEncryption {
+		return fmt.Errorf("'hlsHTTP3' requires 'hlsEncryption'")
+	}
 
 	// WebRTC
 
@@ -673,6 +959,9 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		l.Log(logger.Warn, "parameter 'webrtcDisable' is deprecated and has been replaced with 'webrtc'")
 		conf.WebRTC = !*conf.WebRTCDisable
 	}
+	if conf.WebRTCHTTP3 && !conf.WebRTCEncryption {
+		return fmt.Errorf("'webrtcHTTP3' requires 'webrtcEncryption'")
+	}
 	if conf.WebRTCICEUDPMuxAddress != nil {
 		l.Log(logger.Warn, "parameter 'webrtcICEUDPMuxAdderss' is deprecated "+
 			"and has been replaced with 'webrtcLocalUDPAddress'")
@@ -726,6 +1015,63 @@ func (conf *Conf) Validate(l logger.Writer) error {
 		}
 	}
 
+	// MPEG-DASH
+
+	if conf.DASHSegmentCount < 1 {
+		return fmt.Errorf("'dashSegmentCount' must be greater than zero")
+	}
+	if conf.DASHLowLatency && conf.DASHPartDuration >= conf.DASHSegmentDuration {
+		return fmt.Errorf("'dashPartDuration' must be lower than 'dashSegmentDuration'")
+	}
+
+	// GB28181
+
+	if !isDigits(conf.GB28181ServerID, 20) {
+		return fmt.Errorf("'gb28181ServerID' must be made of 20 digits")
+	}
+	if !isDigits(conf.GB28181Domain, 10) {
+		return fmt.Errorf("'gb28181Domain' must be made of 10 digits")
+	}
+	if conf.GB28181 && conf.GB28181Password == "" && !conf.GB28181AllowNoPassword {
+		return fmt.Errorf("'gb28181Password' is required; set 'gb28181AllowNoPassword' to accept " +
+			"registrations without authentication")
+	}
+	if conf.GB28181Transport != "udp" && conf.GB28181Transport != "tcp" {
+		return fmt.Errorf("'gb28181Transport' must be 'udp' or 'tcp'")
+	}
+	if conf.GB28181KeepaliveTimeout <= 0 {
+		return fmt.Errorf("'gb28181KeepaliveTimeout' must be greater than zero")
+	}
+
+	// RIST
+
+	_, ristPort, err := net.SplitHostPort(conf.RISTAddress)
+	if err != nil {
+		return fmt.Errorf("'ristAddress' is not a valid address")
+	}
+	if v, err2 := strconv.ParseUint(ristPort, 10, 16); err2 != nil || (v%2) != 0 {
+		return fmt.Errorf("'ristAddress' must have an even port")
+	}
+	if conf.RISTBufferSize <= 0 {
+		return fmt.Errorf("'ristBufferSize' must be greater than zero")
+	}
+
+	// MPTS
+
+	err = conf.validateMPTS()
+	if err != nil {
+		return err
+	}
+
+	// Record
+
+	if conf.RecordIndex && conf.RecordIndexPath == "" {
+		return fmt.Errorf("'recordIndexPath' is empty")
+	}
+	if conf.RecordLocksPath == "" {
+		return fmt.Errorf("'recordLocksPath' is empty")
+	}
+
 	// Record (deprecated)
 
 	if conf.Record != nil {
@@ -794,6 +1140,77 @@ func (conf *Conf) Validate(l logger.Writer) error {
 	return nil
 }
 
+func (conf *Conf) validateMPTS() error {
+	if _, _, err := net.SplitHostPort(conf.MPTSAddress); err != nil {
+		return fmt.Errorf("'mptsAddress' is not a valid address")
+	}
+	if conf.MPTSMulticastTTL < 1 || conf.MPTSMulticastTTL > 255 {
+		return fmt.Errorf("'mptsMulticastTTL' must be between 1 and 255")
+	}
+	// at least a packet of PAT, SDT and PMTs every 100ms
+	if conf.MPTSBitrate < 188*8*10*(2+len(conf.MPTSPrograms)) {
+		return fmt.Errorf("'mptsBitrate' is too low")
+	}
+	if conf.MPTSTransportStreamID < 0 || conf.MPTSTransportStreamID > 0xFFFF {
+		return fmt.Errorf("'mptsTransportStreamID' must be between 0 and 65535")
+	}
+	if conf.MPTSOriginalNetworkID < 0 || conf.MPTSOriginalNetworkID > 0xFFFF {
+		return fmt.Errorf("'mptsOriginalNetworkID' must be between 0 and 65535")
+	}
+	if conf.MPTS && len(conf.MPTSPrograms) == 0 {
+		return fmt.Errorf("at least one program must be provided in 'mptsPrograms'")
+	}
+
+	programNumbers := make(map[int]struct{})
+	pids := make(map[int]struct{})
+
+	addPID := func(pid int) error {
+		// 0x0000-0x001F are reserved for tables, 0x1FFF for null packets
+		if pid < 0x20 || pid > 0x1FFE {
+			return fmt.Errorf("MPTS PID %d is out of range (32-8190)", pid)
+		}
+		if _, ok := pids[pid]; ok {
+			return fmt.Errorf("MPTS PID %d is used twice", pid)
+		}
+		pids[pid] = struct{}{}
+		return nil
+	}
+
+	for _, prog := range conf.MPTSPrograms {
+		if prog.Path == "" {
+			return fmt.Errorf("MPTS program %d has an empty path", prog.ProgramNumber)
+		}
+		if prog.ProgramNumber < 1 || prog.ProgramNumber > 0xFFFF {
+			return fmt.Errorf("MPTS program number must be between 1 and 65535")
+		}
+		if _, ok := programNumbers[prog.ProgramNumber]; ok {
+			return fmt.Errorf("MPTS program number %d is used twice", prog.ProgramNumber)
+		}
+		programNumbers[prog.ProgramNumber] = struct{}{}
+
+		err := addPID(prog.PMTPID)
+		if err != nil {
+			return err
+		}
+
+		if len(prog.PIDs) == 0 {
+			return fmt.Errorf("MPTS program %d has no PIDs", prog.ProgramNumber)
+		}
+		for _, pid := range prog.PIDs {
+			err = addPID(pid)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(prog.ServiceName) > 255 || len(prog.ServiceProvider) > 255 {
+			return fmt.Errorf("MPTS service names must be shorter than 256 characters")
+		}
+	}
+
+	return nil
+}
+
 // UnmarshalJSON implements json.Unmarshaler.
 func (conf *Conf) UnmarshalJSON(b []byte) error {
 	conf.setDefaults()
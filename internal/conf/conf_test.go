@@ -57,6 +57,10 @@ func TestConfFromFile(t *testing.T) {
 			RecordPartDuration:         Duration(1 * time.Second),
 			RecordSegmentDuration:      3600000000000,
 			RecordDeleteAfter:          86400000000000,
+			RecordManifestPath:         "./recordings/%path/manifest_%Y-%m-%d.jsonl",
+			RecordTracks:               []string{},
+			RecordAudio:                true,
+			RecordTrackPolicies:        RecordTrackPolicies{},
 			OverridePublisher:          true,
 			RPICameraWidth:             1920,
 			RPICameraHeight:            1080,
@@ -291,6 +295,25 @@ func TestConfErrors(t *testing.T) {
 			"udpMaxPayloadSize: 5000\n",
 			"'udpMaxPayloadSize' must be less than 1472",
 		},
+		{
+			"invalid authLockoutMaxFailures",
+			"authLockout: yes\n" +
+				"authLockoutMaxFailures: 0\n",
+			"'authLockoutMaxFailures' must be greater than zero",
+		},
+		{
+			"invalid authLockoutMaxDuration",
+			"authLockout: yes\n" +
+				"authLockoutDuration: 10m\n" +
+				"authLockoutMaxDuration: 1m\n",
+			"'authLockoutMaxDuration' must be greater than or equal to 'authLockoutDuration'",
+		},
+		{
+			"gb28181 without password",
+			"gb28181: yes\n",
+			"'gb28181Password' is required; set 'gb28181AllowNoPassword' to accept " +
+				"registrations without authentication",
+		},
 		{
 			"invalid strict encryption 1",
 			"rtspEncryption: strict\n" +
@@ -447,6 +470,102 @@ func TestConfErrors(t *testing.T) {
 				"    recordDeleteAfter: 20m\n",
 			`'recordDeleteAfter' cannot be lower than 'recordSegmentDuration'`,
 		},
+		{
+			"invalid record segment alignment",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordSegmentDuration: 7m\n" +
+				"    recordAlignSegments: yes\n",
+			`when 'recordAlignSegments' is enabled, 'recordSegmentDuration' must divide a day evenly`,
+		},
+		{
+			"invalid record manifest key",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordManifest: yes\n",
+			`'recordManifestKey' is empty`,
+		},
+		{
+			"client certificate required without CA",
+			"apiClientCertRequired: yes\n",
+			`'apiClientCertRequired' requires 'apiClientCertCA'`,
+		},
+		{
+			"unsupported RIST profile",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    source: rist://127.0.0.1:1968?profile=1\n",
+			`RIST profile '1' is not supported, only the Simple Profile (0) is`,
+		},
+		{
+			"invalid record tracks",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordTracks: [subtitles]\n",
+			`invalid 'recordTracks': invalid track type 'subtitles', available values are video, audio, application`,
+		},
+		{
+			"invalid record track policy",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordTrackPolicies:\n" +
+				"      - tracks: [audio]\n" +
+				"        path: ./recordings/%path/%Y-%m-%d_%H-%M-%S-%f\n",
+			`invalid 'recordTrackPolicies' entry 1: 'path' must be different from 'recordPath'`,
+		},
+		{
+			"duplicate record track policy path",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordTrackPolicies:\n" +
+				"      - tracks: [audio]\n" +
+				"        path: ./recordings/%path/audio/%Y-%m-%d_%H-%M-%S-%f\n" +
+				"      - tracks: [application]\n" +
+				"        path: ./recordings/%path/audio/%Y-%m-%d_%H-%M-%S-%f\n",
+			`invalid 'recordTrackPolicies' entry 2: 'path' is already used by entry 1`,
+		},
+		{
+			"record track policy without manifest path",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordManifest: yes\n" +
+				"    recordManifestKey: manifest.key\n" +
+				"    recordTrackPolicies:\n" +
+				"      - tracks: [audio]\n" +
+				"        path: ./recordings/%path/audio/%Y-%m-%d_%H-%M-%S-%f\n",
+			`invalid 'recordTrackPolicies' entry 1: 'manifestPath' must contain %path`,
+		},
+		{
+			"record audio only without audio",
+			"paths:\n" +
+				"  my_path:\n" +
+				"    recordTracks: [audio]\n" +
+				"    recordAudio: no\n",
+			`'recordTracks' only contains audio tracks, but 'recordAudio' is disabled`,
+		},
+		{
+			"mpts without programs",
+			"mpts: yes\n",
+			"at least one program must be provided in 'mptsPrograms'",
+		},
+		{
+			"mpts duplicate pid",
+			"mptsPrograms:\n" +
+				"  - path: cam1\n" +
+				"    programNumber: 1\n" +
+				"    pmtPID: 4096\n" +
+				"    pids: [256]\n" +
+				"  - path: cam2\n" +
+				"    programNumber: 2\n" +
+				"    pmtPID: 4097\n" +
+				"    pids: [256]\n",
+			"MPTS PID 256 is used twice",
+		},
+		{
+			"hls http3 without encryption",
+			"hlsHTTP3: yes\n",
+			"'hlsHTTP3' requires 'hlsEncryption'",
+		},
 	} {
 		t.Run(ca.name, func(t *testing.T) {
 			tmpf, err := createTempFile([]byte(ca.conf))
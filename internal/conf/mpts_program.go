@@ -0,0 +1,26 @@
+package conf
+
+import (
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+// MPTSProgram is a program of the MPTS output.
+type MPTSProgram struct {
+	Path            string `json:"path"`
+	ProgramNumber   int    `json:"programNumber"`
+	PMTPID          int    `json:"pmtPID"`
+	PIDs            []int  `json:"pids"`
+	ServiceName     string `json:"serviceName"`
+	ServiceProvider string `json:"serviceProvider"`
+}
+
+// MPTSPrograms is a list of MPTSProgram.
+type MPTSPrograms []MPTSProgram
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *MPTSPrograms) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return jsonwrapper.Unmarshal(b, (*[]MPTSProgram)(s))
+}
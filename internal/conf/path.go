@@ -64,6 +64,28 @@ func checkRedirect(v string) error {
 	return nil
 }
 
+func checkRecordPath(key string, recordPath string, playback bool) error {
+	if !strings.Contains(recordPath, "%path") {
+		return fmt.Errorf("'%s' must contain %%path", key)
+	}
+
+	if !strings.Contains(recordPath, "%s") &&
+		(!strings.Contains(recordPath, "%Y") ||
+			!strings.Contains(recordPath, "%m") ||
+			!strings.Contains(recordPath, "%d") ||
+			!strings.Contains(recordPath, "%H") ||
+			!strings.Contains(recordPath, "%M") ||
+			!strings.Contains(recordPath, "%S")) {
+		return fmt.Errorf("'%s' must contain either %%s or %%Y %%m %%d %%H %%M %%S", key)
+	}
+
+	if playback && !strings.Contains(recordPath, "%f") {
+		return fmt.Errorf("'%s' must contain %%f", key)
+	}
+
+	return nil
+}
+
 // FindPathConf returns the configuration corresponding to the given path name.
 func FindPathConf(pathConfs map[string]*Path, name string) (*Path, []string, error) {
 	// normal path
@@ -123,13 +145,24 @@ type Path struct {
 	UseAbsoluteTimestamp       bool     `json:"useAbsoluteTimestamp"`
 
 	// Record
-	Record                bool         `json:"record"`
-	Playback              *bool        `json:"playback,omitempty"` // deprecated
-	RecordPath            string       `json:"recordPath"`
-	RecordFormat          RecordFormat `json:"recordFormat"`
-	RecordPartDuration    Duration     `json:"recordPartDuration"`
-	RecordSegmentDuration Duration     `json:"recordSegmentDuration"`
-	RecordDeleteAfter     Duration     `json:"recordDeleteAfter"`
+	Record                bool                `json:"record"`
+	Playback              *bool               `json:"playback,omitempty"` // deprecated
+	RecordPath            string              `json:"recordPath"`
+	RecordFormat          RecordFormat        `json:"recordFormat"`
+	RecordPartDuration    Duration            `json:"recordPartDuration"`
+	RecordSegmentDuration Duration            `json:"recordSegmentDuration"`
+	RecordAlignSegments   bool                `json:"recordAlignSegments"`
+	RecordReconnectGrace  Duration            `json:"recordReconnectGrace"`
+	RecordDeleteAfter     Duration            `json:"recordDeleteAfter"`
+	RecordMaxSize         StringSize          `json:"recordMaxSize"`
+	RecordPriority        int                 `json:"recordPriority"`
+	RecordLockedRanges    TimeRanges          `json:"recordLockedRanges"`
+	RecordManifest        bool                `json:"recordManifest"`
+	RecordManifestPath    string              `json:"recordManifestPath"`
+	RecordManifestKey     string              `json:"recordManifestKey"`
+	RecordTracks          []string            `json:"recordTracks"`
+	RecordAudio           bool                `json:"recordAudio"`
+	RecordTrackPolicies   RecordTrackPolicies `json:"recordTrackPolicies"`
 
 	// Authentication (deprecated)
 	PublishUser *Credential `json:"publishUser,omitempty"` // deprecated
@@ -215,6 +248,7 @@ type Path struct {
 	RunOnUnread                string   `json:"runOnUnread"`
 	RunOnRecordSegmentCreate   string   `json:"runOnRecordSegmentCreate"`
 	RunOnRecordSegmentComplete string   `json:"runOnRecordSegmentComplete"`
+	RunOnRecordSegmentDelete   string   `json:"runOnRecordSegmentDelete"`
 }
 
 func (pconf *Path) setDefaults() {
@@ -229,6 +263,10 @@ func (pconf *Path) setDefaults() {
 	pconf.RecordPartDuration = Duration(1 * time.Second)
 	pconf.RecordSegmentDuration = 3600 * Duration(time.Second)
 	pconf.RecordDeleteAfter = 24 * 3600 * Duration(time.Second)
+	pconf.RecordManifestPath = "./recordings/%path/manifest_%Y-%m-%d.jsonl"
+	pconf.RecordTracks = []string{}
+	pconf.RecordAudio = true
+	pconf.RecordTrackPolicies = RecordTrackPolicies{}
 
 	// Publisher source
 	pconf.OverridePublisher = true
@@ -407,6 +445,22 @@ func (pconf *Path) validate(
 			}
 		}
 
+	case strings.HasPrefix(pconf.Source, "http+mjpeg://") ||
+		strings.HasPrefix(pconf.Source, "https+mjpeg://"):
+		u, err := gourl.Parse(pconf.Source)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a valid URL", pconf.Source)
+		}
+
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			user := u.User.Username()
+			if user != "" && pass == "" ||
+				user == "" && pass != "" {
+				return fmt.Errorf("username and password must be both provided")
+			}
+		}
+
 	case strings.HasPrefix(pconf.Source, "udp://"):
 		_, _, err := net.SplitHostPort(pconf.Source[len("udp://"):])
 		if err != nil {
@@ -419,6 +473,17 @@ func (pconf *Path) validate(
 			return fmt.Errorf("'%s' is not a valid URL", pconf.Source)
 		}
 
+	case strings.HasPrefix(pconf.Source, "rist://"):
+		u, err := gourl.Parse(pconf.Source)
+		if err != nil || u.Port() == "" {
+			return fmt.Errorf("'%s' is not a valid RIST URL", pconf.Source)
+		}
+
+		// only the Simple Profile is supported. Profiles are numbered as in librist.
+		if profile := u.Query().Get("profile"); profile != "" && profile != "0" {
+			return fmt.Errorf("RIST profile '%s' is not supported, only the Simple Profile (0) is", profile)
+		}
+
 	case strings.HasPrefix(pconf.Source, "whep://") ||
 		strings.HasPrefix(pconf.Source, "wheps://"):
 		_, err := gourl.Parse(pconf.Source)
@@ -570,32 +635,48 @@ func (pconf *Path) validate(
 		l.Log(logger.Warn, "parameter 'playback' is deprecated and has no effect")
 	}
 
-	if !strings.Contains(pconf.RecordPath, "%path") {
-		return fmt.Errorf("'recordPath' must contain %%path")
-	}
-
-	if !strings.Contains(pconf.RecordPath, "%s") &&
-		(!strings.Contains(pconf.RecordPath, "%Y") ||
-			!strings.Contains(pconf.RecordPath, "%m") ||
-			!strings.Contains(pconf.RecordPath, "%d") ||
-			!strings.Contains(pconf.RecordPath, "%H") ||
-			!strings.Contains(pconf.RecordPath, "%M") ||
-			!strings.Contains(pconf.RecordPath, "%S")) {
-		return fmt.Errorf("'recordPath' must contain either %%s or %%Y %%m %%d %%H %%M %%S")
-	}
-
-	if conf.Playback && !strings.Contains(pconf.RecordPath, "%f") {
-		return fmt.Errorf("'recordPath' must contain %%f")
+	err := checkRecordPath("recordPath", pconf.RecordPath, conf.Playback)
+	if err != nil {
+		return err
 	}
 
 	if pconf.RecordSegmentDuration > Duration(24*time.Hour) { // avoid overflowing DurationV0 of mvhd
 		return fmt.Errorf("maximum segment duration is 1 day")
 	}
 
+	if pconf.RecordAlignSegments &&
+		(pconf.RecordSegmentDuration <= 0 || Duration(24*time.Hour)%pconf.RecordSegmentDuration != 0) {
+		return fmt.Errorf("when 'recordAlignSegments' is enabled, 'recordSegmentDuration' must divide a day evenly")
+	}
+
 	if pconf.RecordDeleteAfter != 0 && pconf.RecordDeleteAfter < pconf.RecordSegmentDuration {
 		return fmt.Errorf("'recordDeleteAfter' cannot be lower than 'recordSegmentDuration'")
 	}
 
+	err = checkRecordTracks(pconf.RecordTracks)
+	if err != nil {
+		return fmt.Errorf("invalid 'recordTracks': %w", err)
+	}
+
+	if !pconf.RecordAudio && len(pconf.RecordTracks) != 0 && len(pconf.RecordTrackTypes()) == 0 {
+		return fmt.Errorf("'recordTracks' only contains audio tracks, but 'recordAudio' is disabled")
+	}
+
+	if pconf.RecordManifest {
+		if !strings.Contains(pconf.RecordManifestPath, "%path") {
+			return fmt.Errorf("'recordManifestPath' must contain %%path")
+		}
+
+		if pconf.RecordManifestKey == "" {
+			return fmt.Errorf("'recordManifestKey' is empty")
+		}
+	}
+
+	err = checkRecordTrackPolicies(pconf, conf.Playback)
+	if err != nil {
+		return err
+	}
+
 	// Authentication (deprecated)
 
 	if deprecatedCredentialsMode {
@@ -0,0 +1,165 @@
+package conf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+var recordTrackTypes = []string{"video", "audio", "application"}
+
+func checkRecordTracks(tracks []string) error {
+	for _, t := range tracks {
+		if !slices.Contains(recordTrackTypes, t) {
+			return fmt.Errorf("invalid track type '%s', available values are %s",
+				t, strings.Join(recordTrackTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// RecordTrackTypes returns the types of tracks to record.
+// An empty list means that all tracks must be recorded.
+func (pconf Path) RecordTrackTypes() []string {
+	if pconf.RecordAudio {
+		return pconf.RecordTracks
+	}
+
+	tracks := pconf.RecordTracks
+	if len(tracks) == 0 {
+		tracks = recordTrackTypes
+	}
+
+	out := []string{}
+	for _, t := range tracks {
+		if t != "audio" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// RecordConfs returns the configurations of all recordings of the path,
+// that are the main one and the ones of track policies.
+func (pconf *Path) RecordConfs() []*Path {
+	out := []*Path{pconf}
+	for _, p := range pconf.RecordTrackPolicies {
+		out = append(out, p.PathConf(pconf))
+	}
+	return out
+}
+
+// RecordTrackPolicy is an additional recording of a subset of tracks,
+// with its own path, segment duration and retention.
+type RecordTrackPolicy struct {
+	Tracks          []string  `json:"tracks"`
+	Path            string    `json:"path"`
+	SegmentDuration Duration  `json:"segmentDuration"`
+	DeleteAfter     *Duration `json:"deleteAfter,omitempty"` // if nil, 'recordDeleteAfter' is used
+	ManifestPath    string    `json:"manifestPath"`
+}
+
+// PathConf returns the configuration of the given path with the policy applied.
+func (p RecordTrackPolicy) PathConf(pconf *Path) *Path {
+	c := *pconf
+	c.RecordTracks = p.Tracks
+	c.RecordAudio = true
+	c.RecordPath = p.Path
+	if p.SegmentDuration != 0 {
+		c.RecordSegmentDuration = p.SegmentDuration
+	}
+	if p.DeleteAfter != nil {
+		c.RecordDeleteAfter = *p.DeleteAfter
+	}
+	c.RecordManifestPath = p.ManifestPath
+	c.RecordTrackPolicies = nil
+	return &c
+}
+
+func (p RecordTrackPolicy) validate(pconf *Path) error {
+	if len(p.Tracks) == 0 {
+		return fmt.Errorf("'tracks' is empty")
+	}
+
+	err := checkRecordTracks(p.Tracks)
+	if err != nil {
+		return err
+	}
+
+	if p.Path == pconf.RecordPath {
+		return fmt.Errorf("'path' must be different from 'recordPath'")
+	}
+
+	if p.SegmentDuration > Duration(24*time.Hour) {
+		return fmt.Errorf("maximum segment duration is 1 day")
+	}
+
+	if pconf.RecordAlignSegments && p.SegmentDuration != 0 && Duration(24*time.Hour)%p.SegmentDuration != 0 {
+		return fmt.Errorf("when 'recordAlignSegments' is enabled, the segment duration must divide a day evenly")
+	}
+
+	segmentDuration := p.SegmentDuration
+	if segmentDuration == 0 {
+		segmentDuration = pconf.RecordSegmentDuration
+	}
+
+	deleteAfter := pconf.RecordDeleteAfter
+	if p.DeleteAfter != nil {
+		deleteAfter = *p.DeleteAfter
+	}
+
+	if deleteAfter != 0 && deleteAfter < segmentDuration {
+		return fmt.Errorf("'deleteAfter' cannot be lower than the segment duration")
+	}
+
+	if pconf.RecordManifest {
+		if !strings.Contains(p.ManifestPath, "%path") {
+			return fmt.Errorf("'manifestPath' must contain %%path")
+		}
+
+		if p.ManifestPath == pconf.RecordManifestPath {
+			return fmt.Errorf("'manifestPath' must be different from 'recordManifestPath'")
+		}
+	}
+
+	return nil
+}
+
+func checkRecordTrackPolicies(pconf *Path, playback bool) error {
+	for i, p := range pconf.RecordTrackPolicies {
+		err := p.validate(pconf)
+		if err == nil {
+			err = checkRecordPath("path", p.Path, playback)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid 'recordTrackPolicies' entry %d: %w", i+1, err)
+		}
+
+		for j, prev := range pconf.RecordTrackPolicies[:i] {
+			if p.Path == prev.Path {
+				return fmt.Errorf("invalid 'recordTrackPolicies' entry %d: 'path' is already used by entry %d", i+1, j+1)
+			}
+
+			if pconf.RecordManifest && p.ManifestPath == prev.ManifestPath {
+				return fmt.Errorf("invalid 'recordTrackPolicies' entry %d: 'manifestPath' is already used by entry %d",
+					i+1, j+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RecordTrackPolicies is a list of RecordTrackPolicy.
+type RecordTrackPolicies []RecordTrackPolicy
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *RecordTrackPolicies) UnmarshalJSON(b []byte) error {
+	// remove default value before loading new value
+	// https://github.com/golang/go/issues/21092
+	*s = nil
+	return jsonwrapper.Unmarshal(b, (*[]RecordTrackPolicy)(s))
+}
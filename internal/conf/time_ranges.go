@@ -0,0 +1,87 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf/jsonwrapper"
+)
+
+// TimeRange is a time interval.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Overlaps checks whether the range overlaps with the given interval.
+func (r TimeRange) Overlaps(start time.Time, end time.Time) bool {
+	return start.Before(r.End) && end.After(r.Start)
+}
+
+// TimeRanges is a parameter that contains a list of time intervals,
+// each in the format "start/end", with dates in RFC3339 format.
+type TimeRanges []TimeRange
+
+// MarshalJSON implements json.Marshaler.
+func (d TimeRanges) MarshalJSON() ([]byte, error) {
+	out := make([]string, len(d))
+
+	for i, v := range d {
+		out[i] = v.Start.Format(time.RFC3339) + "/" + v.End.Format(time.RFC3339)
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *TimeRanges) UnmarshalJSON(b []byte) error {
+	var in []string
+	if err := jsonwrapper.Unmarshal(b, &in); err != nil {
+		return err
+	}
+
+	*d = nil
+
+	for _, t := range in {
+		parts := strings.Split(t, "/")
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid time range '%s'", t)
+		}
+
+		start, err := time.Parse(time.RFC3339, parts[0])
+		if err != nil {
+			return fmt.Errorf("invalid time range '%s': %w", t, err)
+		}
+
+		end, err := time.Parse(time.RFC3339, parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid time range '%s': %w", t, err)
+		}
+
+		if !end.After(start) {
+			return fmt.Errorf("invalid time range '%s': end is not after start", t)
+		}
+
+		*d = append(*d, TimeRange{Start: start, End: end})
+	}
+
+	return nil
+}
+
+// UnmarshalEnv implements env.Unmarshaler.
+func (d *TimeRanges) UnmarshalEnv(_ string, v string) error {
+	byts, _ := json.Marshal(strings.Split(v, ","))
+	return d.UnmarshalJSON(byts)
+}
+
+// Overlaps checks whether any range overlaps with the given interval.
+func (d TimeRanges) Overlaps(start time.Time, end time.Time) bool {
+	for _, r := range d {
+		if r.Overlaps(start, end) {
+			return true
+		}
+	}
+	return false
+}
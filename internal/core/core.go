@@ -23,15 +23,24 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/metrics"
+	"github.com/bluenviron/mediamtx/internal/mpts"
 	"github.com/bluenviron/mediamtx/internal/playback"
 	"github.com/bluenviron/mediamtx/internal/pprof"
 	"github.com/bluenviron/mediamtx/internal/recordcleaner"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/rlimit"
+	"github.com/bluenviron/mediamtx/internal/servers/dash"
+	"github.com/bluenviron/mediamtx/internal/servers/gb28181"
 	"github.com/bluenviron/mediamtx/internal/servers/hls"
+	"github.com/bluenviron/mediamtx/internal/servers/httpflv"
+	"github.com/bluenviron/mediamtx/internal/servers/mjpeg"
+	"github.com/bluenviron/mediamtx/internal/servers/moq"
+	"github.com/bluenviron/mediamtx/internal/servers/rist"
 	"github.com/bluenviron/mediamtx/internal/servers/rtmp"
 	"github.com/bluenviron/mediamtx/internal/servers/rtsp"
 	"github.com/bluenviron/mediamtx/internal/servers/srt"
 	"github.com/bluenviron/mediamtx/internal/servers/webrtc"
+	"github.com/bluenviron/mediamtx/internal/servers/wsfmp4"
 )
 
 //go:generate go run ./versiongetter
@@ -52,9 +61,13 @@ var cli struct {
 	Confpath string `arg:"" default:""`
 }
 
-func atLeastOneRecordDeleteAfter(pathConfs map[string]*conf.Path) bool {
-	for _, e := range pathConfs {
-		if e.RecordDeleteAfter != 0 {
+func recordCleanerNeeded(cnf *conf.Conf) bool {
+	if cnf.RecordMaxTotalSize != 0 || cnf.RecordMinFreeSpace != 0 {
+		return true
+	}
+
+	for _, e := range cnf.Paths {
+		if e.RecordDeleteAfter != 0 || e.RecordMaxSize != 0 {
 			return true
 		}
 	}
@@ -72,6 +85,9 @@ type Core struct {
 	authManager     *auth.Manager
 	metrics         *metrics.Metrics
 	pprof           *pprof.PPROF
+	recordIndex     *recordstore.Index
+	recordLocks     *recordstore.Locks
+	recordManifests *recordstore.ManifestWriter
 	recordCleaner   *recordcleaner.Cleaner
 	playbackServer  *playback.Server
 	pathManager     *pathManager
@@ -82,6 +98,14 @@ type Core struct {
 	hlsServer       *hls.Server
 	webRTCServer    *webrtc.Server
 	srtServer       *srt.Server
+	httpFLVServer   *httpflv.Server
+	dashServer      *dash.Server
+	mjpegServer     *mjpeg.Server
+	wsfmp4Server    *wsfmp4.Server
+	gb28181Server   *gb28181.Server
+	ristServer      *rist.Server
+	moqServer       *moq.Server
+	mptsOutput      *mpts.Output
 	api             *api.API
 	confWatcher     *confwatcher.ConfWatcher
 
@@ -269,31 +293,45 @@ func (p *Core) createResources(initial bool) error {
 
 	if p.authManager == nil {
 		p.authManager = &auth.Manager{
-			Method:             p.conf.AuthMethod,
-			InternalUsers:      p.conf.AuthInternalUsers,
-			HTTPAddress:        p.conf.AuthHTTPAddress,
-			HTTPExclude:        p.conf.AuthHTTPExclude,
-			JWTJWKS:            p.conf.AuthJWTJWKS,
-			JWTJWKSFingerprint: p.conf.AuthJWTJWKSFingerprint,
-			JWTClaimKey:        p.conf.AuthJWTClaimKey,
-			JWTExclude:         p.conf.AuthJWTExclude,
-			JWTInHTTPQuery:     p.conf.AuthJWTInHTTPQuery,
-			ReadTimeout:        time.Duration(p.conf.ReadTimeout),
+			Method:               p.conf.AuthMethod,
+			InternalUsers:        p.conf.AuthInternalUsers,
+			HTTPAddress:          p.conf.AuthHTTPAddress,
+			HTTPExclude:          p.conf.AuthHTTPExclude,
+			HTTPCacheTTL:         time.Duration(p.conf.AuthHTTPCacheTTL),
+			HTTPCacheNegativeTTL: time.Duration(p.conf.AuthHTTPCacheNegativeTTL),
+			JWTJWKS:              p.conf.AuthJWTJWKS,
+			JWTJWKSFingerprint:   p.conf.AuthJWTJWKSFingerprint,
+			JWTClaimKey:          p.conf.AuthJWTClaimKey,
+			JWTExclude:           p.conf.AuthJWTExclude,
+			JWTInHTTPQuery:       p.conf.AuthJWTInHTTPQuery,
+			HMACSecret:           string(p.conf.AuthHMACSecret),
+			HMACBindIP:           p.conf.AuthHMACBindIP,
+			HMACExclude:          p.conf.AuthHMACExclude,
+			ClientCertIdentity:   p.conf.AuthClientCertIdentity,
+			ReadTimeout:          time.Duration(p.conf.ReadTimeout),
+			Lockout:              p.conf.AuthLockout,
+			LockoutMaxFailures:   p.conf.AuthLockoutMaxFailures,
+			LockoutWindow:        time.Duration(p.conf.AuthLockoutWindow),
+			LockoutDuration:      time.Duration(p.conf.AuthLockoutDuration),
+			LockoutMaxDuration:   time.Duration(p.conf.AuthLockoutMaxDuration),
+			Parent:               p,
 		}
 	}
 
 	if p.conf.Metrics &&
 		p.metrics == nil {
 		i := &metrics.Metrics{
-			Address:        p.conf.MetricsAddress,
-			Encryption:     p.conf.MetricsEncryption,
-			ServerKey:      p.conf.MetricsServerKey,
-			ServerCert:     p.conf.MetricsServerCert,
-			AllowOrigin:    p.conf.MetricsAllowOrigin,
-			TrustedProxies: p.conf.MetricsTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			AuthManager:    p.authManager,
-			Parent:         p,
+			Address:            p.conf.MetricsAddress,
+			Encryption:         p.conf.MetricsEncryption,
+			ServerKey:          p.conf.MetricsServerKey,
+			ServerCert:         p.conf.MetricsServerCert,
+			ClientCA:           p.conf.MetricsClientCertCA,
+			ClientCertRequired: p.conf.MetricsClientCertRequired,
+			AllowOrigin:        p.conf.MetricsAllowOrigin,
+			TrustedProxies:     p.conf.MetricsTrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			AuthManager:        p.authManager,
+			Parent:             p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -305,15 +343,17 @@ func (p *Core) createResources(initial bool) error {
 	if p.conf.PPROF &&
 		p.pprof == nil {
 		i := &pprof.PPROF{
-			Address:        p.conf.PPROFAddress,
-			Encryption:     p.conf.PPROFEncryption,
-			ServerKey:      p.conf.PPROFServerKey,
-			ServerCert:     p.conf.PPROFServerCert,
-			AllowOrigin:    p.conf.PPROFAllowOrigin,
-			TrustedProxies: p.conf.PPROFTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			AuthManager:    p.authManager,
-			Parent:         p,
+			Address:            p.conf.PPROFAddress,
+			Encryption:         p.conf.PPROFEncryption,
+			ServerKey:          p.conf.PPROFServerKey,
+			ServerCert:         p.conf.PPROFServerCert,
+			ClientCA:           p.conf.PPROFClientCertCA,
+			ClientCertRequired: p.conf.PPROFClientCertRequired,
+			AllowOrigin:        p.conf.PPROFAllowOrigin,
+			TrustedProxies:     p.conf.PPROFTrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			AuthManager:        p.authManager,
+			Parent:             p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -322,28 +362,77 @@ func (p *Core) createResources(initial bool) error {
 		p.pprof = i
 	}
 
-	if p.recordCleaner == nil &&
-		atLeastOneRecordDeleteAfter(p.conf.Paths) {
-		p.recordCleaner = &recordcleaner.Cleaner{
+	if (p.conf.RecordIndex || recordCleanerNeeded(p.conf)) &&
+		p.recordIndex == nil {
+		i := &recordstore.Index{
 			PathConfs: p.conf.Paths,
 			Parent:    p,
 		}
+		// when the index is not enabled, it's kept in memory and used by the record cleaner only,
+		// in order to avoid walking recording directories periodically.
+		if p.conf.RecordIndex {
+			i.FilePath = p.conf.RecordIndexPath
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.recordIndex = i
+	}
+
+	if p.recordLocks == nil {
+		i := &recordstore.Locks{
+			FilePath: p.conf.RecordLocksPath,
+			Parent:   p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.recordLocks = i
+	}
+
+	if p.recordManifests == nil {
+		p.recordManifests = &recordstore.ManifestWriter{
+			Parent: p,
+		}
+		p.recordManifests.Initialize()
+	}
+
+	if p.recordCleaner == nil &&
+		recordCleanerNeeded(p.conf) {
+		p.recordCleaner = &recordcleaner.Cleaner{
+			PathConfs:       p.conf.Paths,
+			MaxTotalSize:    p.conf.RecordMaxTotalSize,
+			MinFreeSpace:    p.conf.RecordMinFreeSpace,
+			Index:           p.recordIndex,
+			Locks:           p.recordLocks,
+			Manifests:       p.recordManifests,
+			ExternalCmdPool: p.externalCmdPool,
+			Metrics:         p.metrics,
+			Parent:          p,
+		}
 		p.recordCleaner.Initialize()
 	}
 
 	if p.conf.Playback &&
 		p.playbackServer == nil {
 		i := &playback.Server{
-			Address:        p.conf.PlaybackAddress,
-			Encryption:     p.conf.PlaybackEncryption,
-			ServerKey:      p.conf.PlaybackServerKey,
-			ServerCert:     p.conf.PlaybackServerCert,
-			AllowOrigin:    p.conf.PlaybackAllowOrigin,
-			TrustedProxies: p.conf.PlaybackTrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			PathConfs:      p.conf.Paths,
-			AuthManager:    p.authManager,
-			Parent:         p,
+			Address:            p.conf.PlaybackAddress,
+			Encryption:         p.conf.PlaybackEncryption,
+			ServerKey:          p.conf.PlaybackServerKey,
+			ServerCert:         p.conf.PlaybackServerCert,
+			ClientCA:           p.conf.PlaybackClientCertCA,
+			ClientCertRequired: p.conf.PlaybackClientCertRequired,
+			AllowOrigin:        p.conf.PlaybackAllowOrigin,
+			TrustedProxies:     p.conf.PlaybackTrustedProxies,
+			H2C:                p.conf.PlaybackH2C,
+			HTTP3:              p.conf.PlaybackHTTP3,
+			ReadTimeout:        p.conf.ReadTimeout,
+			PathConfs:          p.conf.Paths,
+			RecordIndex:        p.persistentRecordIndex(),
+			AuthManager:        p.authManager,
+			Parent:             p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -362,6 +451,8 @@ func (p *Core) createResources(initial bool) error {
 			writeQueueSize:    p.conf.WriteQueueSize,
 			udpMaxPayloadSize: p.conf.UDPMaxPayloadSize,
 			pathConfs:         p.conf.Paths,
+			recordIndex:       p.recordIndex,
+			recordManifests:   p.recordManifests,
 			externalCmdPool:   p.externalCmdPool,
 			metrics:           p.metrics,
 			parent:            p,
@@ -377,30 +468,39 @@ func (p *Core) createResources(initial bool) error {
 		_, useMulticast := p.conf.RTSPTransports[gortsplib.TransportUDPMulticast]
 
 		i := &rtsp.Server{
-			Address:             p.conf.RTSPAddress,
-			AuthMethods:         p.conf.RTSPAuthMethods,
-			ReadTimeout:         p.conf.ReadTimeout,
-			WriteTimeout:        p.conf.WriteTimeout,
-			WriteQueueSize:      p.conf.WriteQueueSize,
-			UseUDP:              useUDP,
-			UseMulticast:        useMulticast,
-			RTPAddress:          p.conf.RTPAddress,
-			RTCPAddress:         p.conf.RTCPAddress,
-			MulticastIPRange:    p.conf.MulticastIPRange,
-			MulticastRTPPort:    p.conf.MulticastRTPPort,
-			MulticastRTCPPort:   p.conf.MulticastRTCPPort,
-			IsTLS:               false,
-			ServerCert:          "",
-			ServerKey:           "",
-			RTSPAddress:         p.conf.RTSPAddress,
-			Transports:          p.conf.RTSPTransports,
-			RunOnConnect:        p.conf.RunOnConnect,
-			RunOnConnectRestart: p.conf.RunOnConnectRestart,
-			RunOnDisconnect:     p.conf.RunOnDisconnect,
-			ExternalCmdPool:     p.externalCmdPool,
-			Metrics:             p.metrics,
-			PathManager:         p.pathManager,
-			Parent:              p,
+			Address:                     p.conf.RTSPAddress,
+			AuthMethods:                 p.conf.RTSPAuthMethods,
+			ReadTimeout:                 p.conf.ReadTimeout,
+			WriteTimeout:                p.conf.WriteTimeout,
+			WriteQueueSize:              p.conf.WriteQueueSize,
+			UseUDP:                      useUDP,
+			UseMulticast:                useMulticast,
+			RTPAddress:                  p.conf.RTPAddress,
+			RTCPAddress:                 p.conf.RTCPAddress,
+			MulticastIPRange:            p.conf.MulticastIPRange,
+			MulticastRTPPort:            p.conf.MulticastRTPPort,
+			MulticastRTCPPort:           p.conf.MulticastRTCPPort,
+			IsTLS:                       false,
+			ProxyProtocol:               p.conf.ProxyProtocol,
+			ProxyProtocolTrustedSources: p.conf.ProxyProtocolTrustedSources,
+			ServerCert:                  "",
+			ServerKey:                   "",
+			RTSPAddress:                 p.conf.RTSPAddress,
+			Transports:                  p.conf.RTSPTransports,
+			WebSocket:                   p.conf.RTSPWebSocket,
+			WebSocketAddress:            p.conf.RTSPWebSocketAddress,
+			WebSocketEncryption:         p.conf.RTSPWebSocketEncryption,
+			WebSocketServerKey:          p.conf.RTSPServerKey,
+			WebSocketServerCert:         p.conf.RTSPServerCert,
+			WebSocketAllowOrigin:        p.conf.RTSPWebSocketAllowOrigin,
+			WebSocketTrustedProxies:     p.conf.RTSPWebSocketTrustedProxies,
+			RunOnConnect:                p.conf.RunOnConnect,
+			RunOnConnectRestart:         p.conf.RunOnConnectRestart,
+			RunOnDisconnect:             p.conf.RunOnDisconnect,
+			ExternalCmdPool:             p.externalCmdPool,
+			Metrics:                     p.metrics,
+			PathManager:                 p.pathManager,
+			Parent:                      p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -414,30 +514,34 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.RTSPEncryption == conf.EncryptionOptional) &&
 		p.rtspsServer == nil {
 		i := &rtsp.Server{
-			Address:             p.conf.RTSPSAddress,
-			AuthMethods:         p.conf.RTSPAuthMethods,
-			ReadTimeout:         p.conf.ReadTimeout,
-			WriteTimeout:        p.conf.WriteTimeout,
-			WriteQueueSize:      p.conf.WriteQueueSize,
-			UseUDP:              false,
-			UseMulticast:        false,
-			RTPAddress:          "",
-			RTCPAddress:         "",
-			MulticastIPRange:    "",
-			MulticastRTPPort:    0,
-			MulticastRTCPPort:   0,
-			IsTLS:               true,
-			ServerCert:          p.conf.RTSPServerCert,
-			ServerKey:           p.conf.RTSPServerKey,
-			RTSPAddress:         p.conf.RTSPAddress,
-			Transports:          p.conf.RTSPTransports,
-			RunOnConnect:        p.conf.RunOnConnect,
-			RunOnConnectRestart: p.conf.RunOnConnectRestart,
-			RunOnDisconnect:     p.conf.RunOnDisconnect,
-			ExternalCmdPool:     p.externalCmdPool,
-			Metrics:             p.metrics,
-			PathManager:         p.pathManager,
-			Parent:              p,
+			Address:                     p.conf.RTSPSAddress,
+			AuthMethods:                 p.conf.RTSPAuthMethods,
+			ReadTimeout:                 p.conf.ReadTimeout,
+			WriteTimeout:                p.conf.WriteTimeout,
+			WriteQueueSize:              p.conf.WriteQueueSize,
+			UseUDP:                      false,
+			UseMulticast:                false,
+			RTPAddress:                  "",
+			RTCPAddress:                 "",
+			MulticastIPRange:            "",
+			MulticastRTPPort:            0,
+			MulticastRTCPPort:           0,
+			IsTLS:                       true,
+			ProxyProtocol:               p.conf.ProxyProtocol,
+			ProxyProtocolTrustedSources: p.conf.ProxyProtocolTrustedSources,
+			ServerCert:                  p.conf.RTSPServerCert,
+			ClientCA:                    p.conf.RTSPClientCertCA,
+			ClientCertRequired:          p.conf.RTSPClientCertRequired,
+			ServerKey:                   p.conf.RTSPServerKey,
+			RTSPAddress:                 p.conf.RTSPAddress,
+			Transports:                  p.conf.RTSPTransports,
+			RunOnConnect:                p.conf.RunOnConnect,
+			RunOnConnectRestart:         p.conf.RunOnConnectRestart,
+			RunOnDisconnect:             p.conf.RunOnDisconnect,
+			ExternalCmdPool:             p.externalCmdPool,
+			Metrics:                     p.metrics,
+			PathManager:                 p.pathManager,
+			Parent:                      p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -451,20 +555,22 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.RTMPEncryption == conf.EncryptionOptional) &&
 		p.rtmpServer == nil {
 		i := &rtmp.Server{
-			Address:             p.conf.RTMPAddress,
-			ReadTimeout:         p.conf.ReadTimeout,
-			WriteTimeout:        p.conf.WriteTimeout,
-			IsTLS:               false,
-			ServerCert:          "",
-			ServerKey:           "",
-			RTSPAddress:         p.conf.RTSPAddress,
-			RunOnConnect:        p.conf.RunOnConnect,
-			RunOnConnectRestart: p.conf.RunOnConnectRestart,
-			RunOnDisconnect:     p.conf.RunOnDisconnect,
-			ExternalCmdPool:     p.externalCmdPool,
-			Metrics:             p.metrics,
-			PathManager:         p.pathManager,
-			Parent:              p,
+			Address:                     p.conf.RTMPAddress,
+			ReadTimeout:                 p.conf.ReadTimeout,
+			WriteTimeout:                p.conf.WriteTimeout,
+			IsTLS:                       false,
+			ProxyProtocol:               p.conf.ProxyProtocol,
+			ProxyProtocolTrustedSources: p.conf.ProxyProtocolTrustedSources,
+			ServerCert:                  "",
+			ServerKey:                   "",
+			RTSPAddress:                 p.conf.RTSPAddress,
+			RunOnConnect:                p.conf.RunOnConnect,
+			RunOnConnectRestart:         p.conf.RunOnConnectRestart,
+			RunOnDisconnect:             p.conf.RunOnDisconnect,
+			ExternalCmdPool:             p.externalCmdPool,
+			Metrics:                     p.metrics,
+			PathManager:                 p.pathManager,
+			Parent:                      p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -478,20 +584,24 @@ func (p *Core) createResources(initial bool) error {
 			p.conf.RTMPEncryption == conf.EncryptionOptional) &&
 		p.rtmpsServer == nil {
 		i := &rtmp.Server{
-			Address:             p.conf.RTMPSAddress,
-			ReadTimeout:         p.conf.ReadTimeout,
-			WriteTimeout:        p.conf.WriteTimeout,
-			IsTLS:               true,
-			ServerCert:          p.conf.RTMPServerCert,
-			ServerKey:           p.conf.RTMPServerKey,
-			RTSPAddress:         p.conf.RTSPAddress,
-			RunOnConnect:        p.conf.RunOnConnect,
-			RunOnConnectRestart: p.conf.RunOnConnectRestart,
-			RunOnDisconnect:     p.conf.RunOnDisconnect,
-			ExternalCmdPool:     p.externalCmdPool,
-			Metrics:             p.metrics,
-			PathManager:         p.pathManager,
-			Parent:              p,
+			Address:                     p.conf.RTMPSAddress,
+			ReadTimeout:                 p.conf.ReadTimeout,
+			WriteTimeout:                p.conf.WriteTimeout,
+			IsTLS:                       true,
+			ProxyProtocol:               p.conf.ProxyProtocol,
+			ProxyProtocolTrustedSources: p.conf.ProxyProtocolTrustedSources,
+			ServerCert:                  p.conf.RTMPServerCert,
+			ClientCA:                    p.conf.RTMPClientCertCA,
+			ClientCertRequired:          p.conf.RTMPClientCertRequired,
+			ServerKey:                   p.conf.RTMPServerKey,
+			RTSPAddress:                 p.conf.RTSPAddress,
+			RunOnConnect:                p.conf.RunOnConnect,
+			RunOnConnectRestart:         p.conf.RunOnConnectRestart,
+			RunOnDisconnect:             p.conf.RunOnDisconnect,
+			ExternalCmdPool:             p.externalCmdPool,
+			Metrics:                     p.metrics,
+			PathManager:                 p.pathManager,
+			Parent:                      p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -503,24 +613,28 @@ func (p *Core) createResources(initial bool) error {
 	if p.conf.HLS &&
 		p.hlsServer == nil {
 		i := &hls.Server{
-			Address:         p.conf.HLSAddress,
-			Encryption:      p.conf.HLSEncryption,
-			ServerKey:       p.conf.HLSServerKey,
-			ServerCert:      p.conf.HLSServerCert,
-			AllowOrigin:     p.conf.HLSAllowOrigin,
-			TrustedProxies:  p.conf.HLSTrustedProxies,
-			AlwaysRemux:     p.conf.HLSAlwaysRemux,
-			Variant:         p.conf.HLSVariant,
-			SegmentCount:    p.conf.HLSSegmentCount,
-			SegmentDuration: p.conf.HLSSegmentDuration,
-			PartDuration:    p.conf.HLSPartDuration,
-			SegmentMaxSize:  p.conf.HLSSegmentMaxSize,
-			Directory:       p.conf.HLSDirectory,
-			ReadTimeout:     p.conf.ReadTimeout,
-			MuxerCloseAfter: p.conf.HLSMuxerCloseAfter,
-			Metrics:         p.metrics,
-			PathManager:     p.pathManager,
-			Parent:          p,
+			Address:            p.conf.HLSAddress,
+			Encryption:         p.conf.HLSEncryption,
+			ServerKey:          p.conf.HLSServerKey,
+			ServerCert:         p.conf.HLSServerCert,
+			ClientCA:           p.conf.HLSClientCertCA,
+			ClientCertRequired: p.conf.HLSClientCertRequired,
+			AllowOrigin:        p.conf.HLSAllowOrigin,
+			TrustedProxies:     p.conf.HLSTrustedProxies,
+			H2C:                p.conf.HLSH2C,
+			HTTP3:              p.conf.HLSHTTP3,
+			AlwaysRemux:        p.conf.HLSAlwaysRemux,
+			Variant:            p.conf.HLSVariant,
+			SegmentCount:       p.conf.HLSSegmentCount,
+			SegmentDuration:    p.conf.HLSSegmentDuration,
+			PartDuration:       p.conf.HLSPartDuration,
+			SegmentMaxSize:     p.conf.HLSSegmentMaxSize,
+			Directory:          p.conf.HLSDirectory,
+			ReadTimeout:        p.conf.ReadTimeout,
+			MuxerCloseAfter:    p.conf.HLSMuxerCloseAfter,
+			Metrics:            p.metrics,
+			PathManager:        p.pathManager,
+			Parent:             p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -536,8 +650,12 @@ func (p *Core) createResources(initial bool) error {
 			Encryption:            p.conf.WebRTCEncryption,
 			ServerKey:             p.conf.WebRTCServerKey,
 			ServerCert:            p.conf.WebRTCServerCert,
+			ClientCA:              p.conf.WebRTCClientCertCA,
+			ClientCertRequired:    p.conf.WebRTCClientCertRequired,
 			AllowOrigin:           p.conf.WebRTCAllowOrigin,
 			TrustedProxies:        p.conf.WebRTCTrustedProxies,
+			H2C:                   p.conf.WebRTCH2C,
+			HTTP3:                 p.conf.WebRTCHTTP3,
 			ReadTimeout:           p.conf.ReadTimeout,
 			LocalUDPAddress:       p.conf.WebRTCLocalUDPAddress,
 			LocalTCPAddress:       p.conf.WebRTCLocalTCPAddress,
@@ -563,11 +681,160 @@ func (p *Core) createResources(initial bool) error {
 	if p.conf.SRT &&
 		p.srtServer == nil {
 		i := &srt.Server{
-			Address:             p.conf.SRTAddress,
+			Address:                     p.conf.SRTAddress,
+			RTSPAddress:                 p.conf.RTSPAddress,
+			ReadTimeout:                 p.conf.ReadTimeout,
+			WriteTimeout:                p.conf.WriteTimeout,
+			UDPMaxPayloadSize:           p.conf.UDPMaxPayloadSize,
+			ProxyProtocol:               p.conf.SRTProxyProtocol,
+			ProxyProtocolTrustedSources: p.conf.ProxyProtocolTrustedSources,
+			RunOnConnect:                p.conf.RunOnConnect,
+			RunOnConnectRestart:         p.conf.RunOnConnectRestart,
+			RunOnDisconnect:             p.conf.RunOnDisconnect,
+			ExternalCmdPool:             p.externalCmdPool,
+			Metrics:                     p.metrics,
+			PathManager:                 p.pathManager,
+			Parent:                      p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.srtServer = i
+	}
+
+	if p.conf.HTTPFLV &&
+		p.httpFLVServer == nil {
+		i := &httpflv.Server{
+			Address:            p.conf.HTTPFLVAddress,
+			Encryption:         p.conf.HTTPFLVEncryption,
+			ServerKey:          p.conf.HTTPFLVServerKey,
+			ServerCert:         p.conf.HTTPFLVServerCert,
+			ClientCA:           p.conf.HTTPFLVClientCertCA,
+			ClientCertRequired: p.conf.HTTPFLVClientCertRequired,
+			AllowOrigin:        p.conf.HTTPFLVAllowOrigin,
+			TrustedProxies:     p.conf.HTTPFLVTrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			WriteTimeout:       p.conf.WriteTimeout,
+			ExternalCmdPool:    p.externalCmdPool,
+			Metrics:            p.metrics,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.httpFLVServer = i
+	}
+
+	if p.conf.DASH &&
+		p.dashServer == nil {
+		i := &dash.Server{
+			Address:            p.conf.DASHAddress,
+			Encryption:         p.conf.DASHEncryption,
+			ServerKey:          p.conf.DASHServerKey,
+			ServerCert:         p.conf.DASHServerCert,
+			ClientCA:           p.conf.DASHClientCertCA,
+			ClientCertRequired: p.conf.DASHClientCertRequired,
+			AllowOrigin:        p.conf.DASHAllowOrigin,
+			TrustedProxies:     p.conf.DASHTrustedProxies,
+			SegmentTimeline:    p.conf.DASHSegmentTimeline,
+			LowLatency:         p.conf.DASHLowLatency,
+			SegmentCount:       p.conf.DASHSegmentCount,
+			SegmentDuration:    p.conf.DASHSegmentDuration,
+			PartDuration:       p.conf.DASHPartDuration,
+			ReadTimeout:        p.conf.ReadTimeout,
+			MuxerCloseAfter:    p.conf.DASHMuxerCloseAfter,
+			Metrics:            p.metrics,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.dashServer = i
+	}
+
+	if p.conf.MJPEG &&
+		p.mjpegServer == nil {
+		i := &mjpeg.Server{
+			Address:            p.conf.MJPEGAddress,
+			Encryption:         p.conf.MJPEGEncryption,
+			ServerKey:          p.conf.MJPEGServerKey,
+			ServerCert:         p.conf.MJPEGServerCert,
+			ClientCA:           p.conf.MJPEGClientCertCA,
+			ClientCertRequired: p.conf.MJPEGClientCertRequired,
+			AllowOrigin:        p.conf.MJPEGAllowOrigin,
+			TrustedProxies:     p.conf.MJPEGTrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			WriteTimeout:       p.conf.WriteTimeout,
+			ExternalCmdPool:    p.externalCmdPool,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.mjpegServer = i
+	}
+
+	if p.conf.WSFMP4 &&
+		p.wsfmp4Server == nil {
+		i := &wsfmp4.Server{
+			Address:            p.conf.WSFMP4Address,
+			Encryption:         p.conf.WSFMP4Encryption,
+			ServerKey:          p.conf.WSFMP4ServerKey,
+			ServerCert:         p.conf.WSFMP4ServerCert,
+			ClientCA:           p.conf.WSFMP4ClientCertCA,
+			ClientCertRequired: p.conf.WSFMP4ClientCertRequired,
+			AllowOrigin:        p.conf.WSFMP4AllowOrigin,
+			TrustedProxies:     p.conf.WSFMP4TrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			ExternalCmdPool:    p.externalCmdPool,
+			Metrics:            p.metrics,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.wsfmp4Server = i
+	}
+
+	if p.conf.GB28181 &&
+		p.gb28181Server == nil {
+		i := &gb28181.Server{
+			SIPAddress:       p.conf.GB28181SIPAddress,
+			MediaAddress:     p.conf.GB28181MediaAddress,
+			ServerID:         p.conf.GB28181ServerID,
+			Domain:           p.conf.GB28181Domain,
+			Password:         p.conf.GB28181Password,
+			ExternalIP:       p.conf.GB28181ExternalIP,
+			Transport:        p.conf.GB28181Transport,
+			KeepaliveTimeout: p.conf.GB28181KeepaliveTimeout,
+			ReadTimeout:      p.conf.ReadTimeout,
+			Metrics:          p.metrics,
+			PathManager:      p.pathManager,
+			Parent:           p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.gb28181Server = i
+	}
+
+	if p.conf.RIST &&
+		p.ristServer == nil {
+		i := &rist.Server{
+			Address:             p.conf.RISTAddress,
 			RTSPAddress:         p.conf.RTSPAddress,
 			ReadTimeout:         p.conf.ReadTimeout,
-			WriteTimeout:        p.conf.WriteTimeout,
-			UDPMaxPayloadSize:   p.conf.UDPMaxPayloadSize,
+			BufferSize:          p.conf.RISTBufferSize,
 			RunOnConnect:        p.conf.RunOnConnect,
 			RunOnConnectRestart: p.conf.RunOnConnectRestart,
 			RunOnDisconnect:     p.conf.RunOnDisconnect,
@@ -580,30 +847,83 @@ func (p *Core) createResources(initial bool) error {
 		if err != nil {
 			return err
 		}
-		p.srtServer = i
+		p.ristServer = i
+	}
+
+	if p.conf.MoQ &&
+		p.moqServer == nil {
+		i := &moq.Server{
+			Address:            p.conf.MoQAddress,
+			ServerKey:          p.conf.MoQServerKey,
+			ServerCert:         p.conf.MoQServerCert,
+			ClientCA:           p.conf.MoQClientCertCA,
+			ClientCertRequired: p.conf.MoQClientCertRequired,
+			AllowOrigin:        p.conf.MoQAllowOrigin,
+			ReadTimeout:        p.conf.ReadTimeout,
+			WriteTimeout:       p.conf.WriteTimeout,
+			ExternalCmdPool:    p.externalCmdPool,
+			Metrics:            p.metrics,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.moqServer = i
+	}
+
+	if p.conf.MPTS &&
+		p.mptsOutput == nil {
+		i := &mpts.Output{
+			Address:            p.conf.MPTSAddress,
+			MulticastTTL:       p.conf.MPTSMulticastTTL,
+			MulticastInterface: p.conf.MPTSMulticastInterface,
+			Bitrate:            p.conf.MPTSBitrate,
+			TransportStreamID:  p.conf.MPTSTransportStreamID,
+			OriginalNetworkID:  p.conf.MPTSOriginalNetworkID,
+			Programs:           p.conf.MPTSPrograms,
+			PathManager:        p.pathManager,
+			Parent:             p,
+		}
+		err = i.Initialize()
+		if err != nil {
+			return err
+		}
+		p.mptsOutput = i
 	}
 
 	if p.conf.API &&
 		p.api == nil {
 		i := &api.API{
-			Address:        p.conf.APIAddress,
-			Encryption:     p.conf.APIEncryption,
-			ServerKey:      p.conf.APIServerKey,
-			ServerCert:     p.conf.APIServerCert,
-			AllowOrigin:    p.conf.APIAllowOrigin,
-			TrustedProxies: p.conf.APITrustedProxies,
-			ReadTimeout:    p.conf.ReadTimeout,
-			Conf:           p.conf,
-			AuthManager:    p.authManager,
-			PathManager:    p.pathManager,
-			RTSPServer:     p.rtspServer,
-			RTSPSServer:    p.rtspsServer,
-			RTMPServer:     p.rtmpServer,
-			RTMPSServer:    p.rtmpsServer,
-			HLSServer:      p.hlsServer,
-			WebRTCServer:   p.webRTCServer,
-			SRTServer:      p.srtServer,
-			Parent:         p,
+			Address:            p.conf.APIAddress,
+			Encryption:         p.conf.APIEncryption,
+			ServerKey:          p.conf.APIServerKey,
+			ServerCert:         p.conf.APIServerCert,
+			ClientCA:           p.conf.APIClientCertCA,
+			ClientCertRequired: p.conf.APIClientCertRequired,
+			AllowOrigin:        p.conf.APIAllowOrigin,
+			TrustedProxies:     p.conf.APITrustedProxies,
+			ReadTimeout:        p.conf.ReadTimeout,
+			Conf:               p.conf,
+			RecordIndex:        p.persistentRecordIndex(),
+			RecordLocks:        p.recordLocks,
+			AuthManager:        p.authManager,
+			PathManager:        p.pathManager,
+			RTSPServer:         p.rtspServer,
+			RTSPSServer:        p.rtspsServer,
+			RTMPServer:         p.rtmpServer,
+			RTMPSServer:        p.rtmpsServer,
+			HLSServer:          p.hlsServer,
+			WebRTCServer:       p.webRTCServer,
+			SRTServer:          p.srtServer,
+			HTTPFLVServer:      p.httpFLVServer,
+			DASHServer:         p.dashServer,
+			WSFMP4Server:       p.wsfmp4Server,
+			GB28181Server:      p.gb28181Server,
+			RISTServer:         p.ristServer,
+			MoQServer:          p.moqServer,
+			Parent:             p,
 		}
 		err = i.Initialize()
 		if err != nil {
@@ -623,6 +943,16 @@ func (p *Core) createResources(initial bool) error {
 	return nil
 }
 
+// persistentRecordIndex returns the record index when it's enabled.
+// The in-memory index of the record cleaner is not shared with
+// the playback server and the API, that walk recording directories instead.
+func (p *Core) persistentRecordIndex() *recordstore.Index {
+	if !p.conf.RecordIndex {
+		return nil
+	}
+	return p.recordIndex
+}
+
 func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 	closeLogger := newConf == nil ||
 		newConf.LogLevel != p.conf.LogLevel ||
@@ -634,11 +964,22 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.AuthMethod != p.conf.AuthMethod ||
 		newConf.AuthHTTPAddress != p.conf.AuthHTTPAddress ||
 		!reflect.DeepEqual(newConf.AuthHTTPExclude, p.conf.AuthHTTPExclude) ||
+		newConf.AuthHTTPCacheTTL != p.conf.AuthHTTPCacheTTL ||
+		newConf.AuthHTTPCacheNegativeTTL != p.conf.AuthHTTPCacheNegativeTTL ||
 		newConf.AuthJWTJWKS != p.conf.AuthJWTJWKS ||
 		newConf.AuthJWTJWKSFingerprint != p.conf.AuthJWTJWKSFingerprint ||
 		newConf.AuthJWTClaimKey != p.conf.AuthJWTClaimKey ||
 		!reflect.DeepEqual(newConf.AuthJWTExclude, p.conf.AuthJWTExclude) ||
 		newConf.AuthJWTInHTTPQuery != p.conf.AuthJWTInHTTPQuery ||
+		newConf.AuthHMACSecret != p.conf.AuthHMACSecret ||
+		newConf.AuthHMACBindIP != p.conf.AuthHMACBindIP ||
+		!reflect.DeepEqual(newConf.AuthHMACExclude, p.conf.AuthHMACExclude) ||
+		newConf.AuthClientCertIdentity != p.conf.AuthClientCertIdentity ||
+		newConf.AuthLockout != p.conf.AuthLockout ||
+		newConf.AuthLockoutMaxFailures != p.conf.AuthLockoutMaxFailures ||
+		newConf.AuthLockoutWindow != p.conf.AuthLockoutWindow ||
+		newConf.AuthLockoutDuration != p.conf.AuthLockoutDuration ||
+		newConf.AuthLockoutMaxDuration != p.conf.AuthLockoutMaxDuration ||
 		newConf.ReadTimeout != p.conf.ReadTimeout
 	if !closeAuthManager && !reflect.DeepEqual(newConf.AuthInternalUsers, p.conf.AuthInternalUsers) {
 		p.authManager.ReloadInternalUsers(newConf.AuthInternalUsers)
@@ -650,6 +991,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.MetricsEncryption != p.conf.MetricsEncryption ||
 		newConf.MetricsServerKey != p.conf.MetricsServerKey ||
 		newConf.MetricsServerCert != p.conf.MetricsServerCert ||
+		newConf.MetricsClientCertCA != p.conf.MetricsClientCertCA ||
+		newConf.MetricsClientCertRequired != p.conf.MetricsClientCertRequired ||
 		newConf.MetricsAllowOrigin != p.conf.MetricsAllowOrigin ||
 		!reflect.DeepEqual(newConf.MetricsTrustedProxies, p.conf.MetricsTrustedProxies) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
@@ -662,14 +1005,35 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.PPROFEncryption != p.conf.PPROFEncryption ||
 		newConf.PPROFServerKey != p.conf.PPROFServerKey ||
 		newConf.PPROFServerCert != p.conf.PPROFServerCert ||
+		newConf.PPROFClientCertCA != p.conf.PPROFClientCertCA ||
+		newConf.PPROFClientCertRequired != p.conf.PPROFClientCertRequired ||
 		newConf.PPROFAllowOrigin != p.conf.PPROFAllowOrigin ||
 		!reflect.DeepEqual(newConf.PPROFTrustedProxies, p.conf.PPROFTrustedProxies) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		closeAuthManager ||
 		closeLogger
 
+	closeRecordIndex := newConf == nil ||
+		newConf.RecordIndex != p.conf.RecordIndex ||
+		(!newConf.RecordIndex && recordCleanerNeeded(newConf) != recordCleanerNeeded(p.conf)) ||
+		newConf.RecordIndexPath != p.conf.RecordIndexPath ||
+		closeLogger
+
+	closeRecordLocks := newConf == nil ||
+		newConf.RecordLocksPath != p.conf.RecordLocksPath ||
+		closeLogger
+
+	closeRecordManifests := newConf == nil ||
+		closeLogger
+
 	closeRecorderCleaner := newConf == nil ||
-		atLeastOneRecordDeleteAfter(newConf.Paths) != atLeastOneRecordDeleteAfter(p.conf.Paths) ||
+		recordCleanerNeeded(newConf) != recordCleanerNeeded(p.conf) ||
+		newConf.RecordMaxTotalSize != p.conf.RecordMaxTotalSize ||
+		newConf.RecordMinFreeSpace != p.conf.RecordMinFreeSpace ||
+		closeRecordIndex ||
+		closeRecordLocks ||
+		closeRecordManifests ||
+		closeMetrics ||
 		closeLogger
 	if !closeRecorderCleaner && p.recordCleaner != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
 		p.recordCleaner.ReloadPathConfs(newConf.Paths)
@@ -681,9 +1045,14 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.PlaybackEncryption != p.conf.PlaybackEncryption ||
 		newConf.PlaybackServerKey != p.conf.PlaybackServerKey ||
 		newConf.PlaybackServerCert != p.conf.PlaybackServerCert ||
+		newConf.PlaybackClientCertCA != p.conf.PlaybackClientCertCA ||
+		newConf.PlaybackClientCertRequired != p.conf.PlaybackClientCertRequired ||
 		newConf.PlaybackAllowOrigin != p.conf.PlaybackAllowOrigin ||
 		!reflect.DeepEqual(newConf.PlaybackTrustedProxies, p.conf.PlaybackTrustedProxies) ||
+		newConf.PlaybackH2C != p.conf.PlaybackH2C ||
+		newConf.PlaybackHTTP3 != p.conf.PlaybackHTTP3 ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeRecordIndex ||
 		closeAuthManager ||
 		closeLogger
 	if !closePlaybackServer && p.playbackServer != nil && !reflect.DeepEqual(newConf.Paths, p.conf.Paths) {
@@ -697,6 +1066,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
+		closeRecordIndex ||
+		closeRecordManifests ||
 		closeMetrics ||
 		closeAuthManager ||
 		closeLogger
@@ -709,6 +1080,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.RTSPEncryption != p.conf.RTSPEncryption ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.RTSPAuthMethods, p.conf.RTSPAuthMethods) ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedSources, p.conf.ProxyProtocolTrustedSources) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
@@ -719,6 +1092,13 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.MulticastRTCPPort != p.conf.MulticastRTCPPort ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.RTSPTransports, p.conf.RTSPTransports) ||
+		newConf.RTSPWebSocket != p.conf.RTSPWebSocket ||
+		newConf.RTSPWebSocketAddress != p.conf.RTSPWebSocketAddress ||
+		newConf.RTSPWebSocketEncryption != p.conf.RTSPWebSocketEncryption ||
+		newConf.RTSPWebSocketAllowOrigin != p.conf.RTSPWebSocketAllowOrigin ||
+		!reflect.DeepEqual(newConf.RTSPWebSocketTrustedProxies, p.conf.RTSPWebSocketTrustedProxies) ||
+		newConf.RTSPServerKey != p.conf.RTSPServerKey ||
+		newConf.RTSPServerCert != p.conf.RTSPServerCert ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
 		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
 		newConf.RunOnDisconnect != p.conf.RunOnDisconnect ||
@@ -731,10 +1111,14 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.RTSPEncryption != p.conf.RTSPEncryption ||
 		newConf.RTSPSAddress != p.conf.RTSPSAddress ||
 		!reflect.DeepEqual(newConf.RTSPAuthMethods, p.conf.RTSPAuthMethods) ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedSources, p.conf.ProxyProtocolTrustedSources) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.WriteQueueSize != p.conf.WriteQueueSize ||
 		newConf.RTSPServerCert != p.conf.RTSPServerCert ||
+		newConf.RTSPClientCertCA != p.conf.RTSPClientCertCA ||
+		newConf.RTSPClientCertRequired != p.conf.RTSPClientCertRequired ||
 		newConf.RTSPServerKey != p.conf.RTSPServerKey ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		!reflect.DeepEqual(newConf.RTSPTransports, p.conf.RTSPTransports) ||
@@ -749,6 +1133,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.RTMP != p.conf.RTMP ||
 		newConf.RTMPEncryption != p.conf.RTMPEncryption ||
 		newConf.RTMPAddress != p.conf.RTMPAddress ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedSources, p.conf.ProxyProtocolTrustedSources) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
@@ -763,9 +1149,13 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.RTMP != p.conf.RTMP ||
 		newConf.RTMPEncryption != p.conf.RTMPEncryption ||
 		newConf.RTMPSAddress != p.conf.RTMPSAddress ||
+		newConf.ProxyProtocol != p.conf.ProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedSources, p.conf.ProxyProtocolTrustedSources) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.RTMPServerCert != p.conf.RTMPServerCert ||
+		newConf.RTMPClientCertCA != p.conf.RTMPClientCertCA ||
+		newConf.RTMPClientCertRequired != p.conf.RTMPClientCertRequired ||
 		newConf.RTMPServerKey != p.conf.RTMPServerKey ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
 		newConf.RunOnConnect != p.conf.RunOnConnect ||
@@ -781,8 +1171,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.HLSEncryption != p.conf.HLSEncryption ||
 		newConf.HLSServerKey != p.conf.HLSServerKey ||
 		newConf.HLSServerCert != p.conf.HLSServerCert ||
+		newConf.HLSClientCertCA != p.conf.HLSClientCertCA ||
+		newConf.HLSClientCertRequired != p.conf.HLSClientCertRequired ||
 		newConf.HLSAllowOrigin != p.conf.HLSAllowOrigin ||
 		!reflect.DeepEqual(newConf.HLSTrustedProxies, p.conf.HLSTrustedProxies) ||
+		newConf.HLSH2C != p.conf.HLSH2C ||
+		newConf.HLSHTTP3 != p.conf.HLSHTTP3 ||
 		newConf.HLSAlwaysRemux != p.conf.HLSAlwaysRemux ||
 		newConf.HLSVariant != p.conf.HLSVariant ||
 		newConf.HLSSegmentCount != p.conf.HLSSegmentCount ||
@@ -802,8 +1196,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.WebRTCEncryption != p.conf.WebRTCEncryption ||
 		newConf.WebRTCServerKey != p.conf.WebRTCServerKey ||
 		newConf.WebRTCServerCert != p.conf.WebRTCServerCert ||
+		newConf.WebRTCClientCertCA != p.conf.WebRTCClientCertCA ||
+		newConf.WebRTCClientCertRequired != p.conf.WebRTCClientCertRequired ||
 		newConf.WebRTCAllowOrigin != p.conf.WebRTCAllowOrigin ||
 		!reflect.DeepEqual(newConf.WebRTCTrustedProxies, p.conf.WebRTCTrustedProxies) ||
+		newConf.WebRTCH2C != p.conf.WebRTCH2C ||
+		newConf.WebRTCHTTP3 != p.conf.WebRTCHTTP3 ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WebRTCLocalUDPAddress != p.conf.WebRTCLocalUDPAddress ||
 		newConf.WebRTCLocalTCPAddress != p.conf.WebRTCLocalTCPAddress ||
@@ -822,6 +1220,8 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		newConf.SRT != p.conf.SRT ||
 		newConf.SRTAddress != p.conf.SRTAddress ||
 		newConf.RTSPAddress != p.conf.RTSPAddress ||
+		newConf.SRTProxyProtocol != p.conf.SRTProxyProtocol ||
+		!reflect.DeepEqual(newConf.ProxyProtocolTrustedSources, p.conf.ProxyProtocolTrustedSources) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
 		newConf.WriteTimeout != p.conf.WriteTimeout ||
 		newConf.UDPMaxPayloadSize != p.conf.UDPMaxPayloadSize ||
@@ -831,15 +1231,141 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closePathManager ||
 		closeLogger
 
+	closeHTTPFLVServer := newConf == nil ||
+		newConf.HTTPFLV != p.conf.HTTPFLV ||
+		newConf.HTTPFLVAddress != p.conf.HTTPFLVAddress ||
+		newConf.HTTPFLVEncryption != p.conf.HTTPFLVEncryption ||
+		newConf.HTTPFLVServerKey != p.conf.HTTPFLVServerKey ||
+		newConf.HTTPFLVServerCert != p.conf.HTTPFLVServerCert ||
+		newConf.HTTPFLVClientCertCA != p.conf.HTTPFLVClientCertCA ||
+		newConf.HTTPFLVClientCertRequired != p.conf.HTTPFLVClientCertRequired ||
+		newConf.HTTPFLVAllowOrigin != p.conf.HTTPFLVAllowOrigin ||
+		!reflect.DeepEqual(newConf.HTTPFLVTrustedProxies, p.conf.HTTPFLVTrustedProxies) ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.WriteTimeout != p.conf.WriteTimeout ||
+		closeMetrics ||
+		closePathManager ||
+		closeLogger
+
+	closeDASHServer := newConf == nil ||
+		newConf.DASH != p.conf.DASH ||
+		newConf.DASHAddress != p.conf.DASHAddress ||
+		newConf.DASHEncryption != p.conf.DASHEncryption ||
+		newConf.DASHServerKey != p.conf.DASHServerKey ||
+		newConf.DASHServerCert != p.conf.DASHServerCert ||
+		newConf.DASHClientCertCA != p.conf.DASHClientCertCA ||
+		newConf.DASHClientCertRequired != p.conf.DASHClientCertRequired ||
+		newConf.DASHAllowOrigin != p.conf.DASHAllowOrigin ||
+		!reflect.DeepEqual(newConf.DASHTrustedProxies, p.conf.DASHTrustedProxies) ||
+		newConf.DASHSegmentTimeline != p.conf.DASHSegmentTimeline ||
+		newConf.DASHLowLatency != p.conf.DASHLowLatency ||
+		newConf.DASHSegmentCount != p.conf.DASHSegmentCount ||
+		newConf.DASHSegmentDuration != p.conf.DASHSegmentDuration ||
+		newConf.DASHPartDuration != p.conf.DASHPartDuration ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.DASHMuxerCloseAfter != p.conf.DASHMuxerCloseAfter ||
+		closePathManager ||
+		closeMetrics ||
+		closeLogger
+
+	closeMJPEGServer := newConf == nil ||
+		newConf.MJPEG != p.conf.MJPEG ||
+		newConf.MJPEGAddress != p.conf.MJPEGAddress ||
+		newConf.MJPEGEncryption != p.conf.MJPEGEncryption ||
+		newConf.MJPEGServerKey != p.conf.MJPEGServerKey ||
+		newConf.MJPEGServerCert != p.conf.MJPEGServerCert ||
+		newConf.MJPEGClientCertCA != p.conf.MJPEGClientCertCA ||
+		newConf.MJPEGClientCertRequired != p.conf.MJPEGClientCertRequired ||
+		newConf.MJPEGAllowOrigin != p.conf.MJPEGAllowOrigin ||
+		!reflect.DeepEqual(newConf.MJPEGTrustedProxies, p.conf.MJPEGTrustedProxies) ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.WriteTimeout != p.conf.WriteTimeout ||
+		closePathManager ||
+		closeLogger
+
+	closeWSFMP4Server := newConf == nil ||
+		newConf.WSFMP4 != p.conf.WSFMP4 ||
+		newConf.WSFMP4Address != p.conf.WSFMP4Address ||
+		newConf.WSFMP4Encryption != p.conf.WSFMP4Encryption ||
+		newConf.WSFMP4ServerKey != p.conf.WSFMP4ServerKey ||
+		newConf.WSFMP4ServerCert != p.conf.WSFMP4ServerCert ||
+		newConf.WSFMP4ClientCertCA != p.conf.WSFMP4ClientCertCA ||
+		newConf.WSFMP4ClientCertRequired != p.conf.WSFMP4ClientCertRequired ||
+		newConf.WSFMP4AllowOrigin != p.conf.WSFMP4AllowOrigin ||
+		!reflect.DeepEqual(newConf.WSFMP4TrustedProxies, p.conf.WSFMP4TrustedProxies) ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeMetrics ||
+		closePathManager ||
+		closeLogger
+
+	closeGB28181Server := newConf == nil ||
+		newConf.GB28181 != p.conf.GB28181 ||
+		newConf.GB28181SIPAddress != p.conf.GB28181SIPAddress ||
+		newConf.GB28181MediaAddress != p.conf.GB28181MediaAddress ||
+		newConf.GB28181ServerID != p.conf.GB28181ServerID ||
+		newConf.GB28181Domain != p.conf.GB28181Domain ||
+		newConf.GB28181Password != p.conf.GB28181Password ||
+		newConf.GB28181AllowNoPassword != p.conf.GB28181AllowNoPassword ||
+		newConf.GB28181ExternalIP != p.conf.GB28181ExternalIP ||
+		newConf.GB28181Transport != p.conf.GB28181Transport ||
+		newConf.GB28181KeepaliveTimeout != p.conf.GB28181KeepaliveTimeout ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeMetrics ||
+		closePathManager ||
+		closeLogger
+
+	closeRISTServer := newConf == nil ||
+		newConf.RIST != p.conf.RIST ||
+		newConf.RISTAddress != p.conf.RISTAddress ||
+		newConf.RISTBufferSize != p.conf.RISTBufferSize ||
+		newConf.RTSPAddress != p.conf.RTSPAddress ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.RunOnConnect != p.conf.RunOnConnect ||
+		newConf.RunOnConnectRestart != p.conf.RunOnConnectRestart ||
+		newConf.RunOnDisconnect != p.conf.RunOnDisconnect ||
+		closeMetrics ||
+		closePathManager ||
+		closeLogger
+
+	closeMoQServer := newConf == nil ||
+		newConf.MoQ != p.conf.MoQ ||
+		newConf.MoQAddress != p.conf.MoQAddress ||
+		newConf.MoQServerKey != p.conf.MoQServerKey ||
+		newConf.MoQServerCert != p.conf.MoQServerCert ||
+		newConf.MoQClientCertCA != p.conf.MoQClientCertCA ||
+		newConf.MoQClientCertRequired != p.conf.MoQClientCertRequired ||
+		newConf.MoQAllowOrigin != p.conf.MoQAllowOrigin ||
+		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		newConf.WriteTimeout != p.conf.WriteTimeout ||
+		closeMetrics ||
+		closePathManager ||
+		closeLogger
+
+	closeMPTSOutput := newConf == nil ||
+		newConf.MPTS != p.conf.MPTS ||
+		newConf.MPTSAddress != p.conf.MPTSAddress ||
+		newConf.MPTSMulticastTTL != p.conf.MPTSMulticastTTL ||
+		newConf.MPTSMulticastInterface != p.conf.MPTSMulticastInterface ||
+		newConf.MPTSBitrate != p.conf.MPTSBitrate ||
+		newConf.MPTSTransportStreamID != p.conf.MPTSTransportStreamID ||
+		newConf.MPTSOriginalNetworkID != p.conf.MPTSOriginalNetworkID ||
+		!reflect.DeepEqual(newConf.MPTSPrograms, p.conf.MPTSPrograms) ||
+		closePathManager ||
+		closeLogger
+
 	closeAPI := newConf == nil ||
 		newConf.API != p.conf.API ||
 		newConf.APIAddress != p.conf.APIAddress ||
 		newConf.APIEncryption != p.conf.APIEncryption ||
 		newConf.APIServerKey != p.conf.APIServerKey ||
 		newConf.APIServerCert != p.conf.APIServerCert ||
+		newConf.APIClientCertCA != p.conf.APIClientCertCA ||
+		newConf.APIClientCertRequired != p.conf.APIClientCertRequired ||
 		newConf.APIAllowOrigin != p.conf.APIAllowOrigin ||
 		!reflect.DeepEqual(newConf.APITrustedProxies, p.conf.APITrustedProxies) ||
 		newConf.ReadTimeout != p.conf.ReadTimeout ||
+		closeRecordIndex ||
+		closeRecordLocks ||
 		closeAuthManager ||
 		closePathManager ||
 		closeRTSPServer ||
@@ -848,6 +1374,12 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		closeHLSServer ||
 		closeWebRTCServer ||
 		closeSRTServer ||
+		closeHTTPFLVServer ||
+		closeDASHServer ||
+		closeWSFMP4Server ||
+		closeGB28181Server ||
+		closeRISTServer ||
+		closeMoQServer ||
 		closeLogger
 
 	if newConf == nil && p.confWatcher != nil {
@@ -864,6 +1396,46 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		}
 	}
 
+	if closeMPTSOutput && p.mptsOutput != nil {
+		p.mptsOutput.Close()
+		p.mptsOutput = nil
+	}
+
+	if closeMoQServer && p.moqServer != nil {
+		p.moqServer.Close()
+		p.moqServer = nil
+	}
+
+	if closeRISTServer && p.ristServer != nil {
+		p.ristServer.Close()
+		p.ristServer = nil
+	}
+
+	if closeGB28181Server && p.gb28181Server != nil {
+		p.gb28181Server.Close()
+		p.gb28181Server = nil
+	}
+
+	if closeWSFMP4Server && p.wsfmp4Server != nil {
+		p.wsfmp4Server.Close()
+		p.wsfmp4Server = nil
+	}
+
+	if closeMJPEGServer && p.mjpegServer != nil {
+		p.mjpegServer.Close()
+		p.mjpegServer = nil
+	}
+
+	if closeDASHServer && p.dashServer != nil {
+		p.dashServer.Close()
+		p.dashServer = nil
+	}
+
+	if closeHTTPFLVServer && p.httpFLVServer != nil {
+		p.httpFLVServer.Close()
+		p.httpFLVServer = nil
+	}
+
 	if closeSRTServer && p.srtServer != nil {
 		p.srtServer.Close()
 		p.srtServer = nil
@@ -914,6 +1486,21 @@ func (p *Core) closeResources(newConf *conf.Conf, calledByAPI bool) {
 		p.recordCleaner = nil
 	}
 
+	if closeRecordManifests && p.recordManifests != nil {
+		p.recordManifests.Close()
+		p.recordManifests = nil
+	}
+
+	if closeRecordLocks && p.recordLocks != nil {
+		p.recordLocks.Close()
+		p.recordLocks = nil
+	}
+
+	if closeRecordIndex && p.recordIndex != nil {
+		p.recordIndex.Close()
+		p.recordIndex = nil
+	}
+
 	if closePPROF && p.pprof != nil {
 		p.pprof.Close()
 		p.pprof = nil
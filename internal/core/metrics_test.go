@@ -165,6 +165,8 @@ srt_conns_packets_received_loss_rate 0
 webrtc_sessions 0
 webrtc_sessions_bytes_received 0
 webrtc_sessions_bytes_sent 0
+record_deleted_segments 0
+record_deleted_bytes 0
 `, string(bo))
 	})
 
@@ -452,6 +454,8 @@ webrtc_sessions_bytes_sent 0
 				`webrtc_sessions\{id=".*?",state="publish"\} 1`+"\n"+
 				`webrtc_sessions_bytes_received\{id=".*?",state="publish"\} [0-9]+`+"\n"+
 				`webrtc_sessions_bytes_sent\{id=".*?",state="publish"\} [0-9]+`+"\n"+
+				`record_deleted_segments 0`+"\n"+
+				`record_deleted_bytes 0`+"\n"+
 				"$",
 			string(bo))
 
@@ -472,6 +476,8 @@ webrtc_sessions_bytes_sent 0
 
 		bo := httpPullFile(t, hc, "http://localhost:9998/metrics")
 
-		require.Equal(t, "paths 0\n", string(bo))
+		require.Equal(t, "paths 0\n"+
+			"record_deleted_segments 0\n"+
+			"record_deleted_bytes 0\n", string(bo))
 	})
 }
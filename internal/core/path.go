@@ -16,6 +16,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/recorder"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/staticsources"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
@@ -75,6 +76,8 @@ type path struct {
 	name              string
 	matches           []string
 	wg                *sync.WaitGroup
+	recordIndex       *recordstore.Index
+	recordManifests   *recordstore.ManifestWriter
 	externalCmdPool   *externalcmd.Pool
 	parent            pathParent
 
@@ -84,7 +87,7 @@ type path struct {
 	source                         defs.Source
 	publisherQuery                 string
 	stream                         *stream.Stream
-	recorder                       *recorder.Recorder
+	recorders                      []*recorder.Recorder
 	readyTime                      time.Time
 	onUnDemandHook                 func(string)
 	onNotReadyHook                 func()
@@ -97,6 +100,7 @@ type path struct {
 	onDemandPublisherState         pathOnDemandState
 	onDemandPublisherReadyTimer    *time.Timer
 	onDemandPublisherCloseTimer    *time.Timer
+	recordGraceTimer               *time.Timer
 
 	// in
 	chReloadConf              chan *conf.Path
@@ -125,6 +129,7 @@ func (pa *path) initialize() {
 	pa.onDemandStaticSourceCloseTimer = emptyTimer()
 	pa.onDemandPublisherReadyTimer = emptyTimer()
 	pa.onDemandPublisherCloseTimer = emptyTimer()
+	pa.recordGraceTimer = emptyTimer()
 	pa.chReloadConf = make(chan *conf.Path)
 	pa.chStaticSourceSetReady = make(chan defs.PathSourceStaticSetReadyReq)
 	pa.chStaticSourceSetNotReady = make(chan defs.PathSourceStaticSetNotReadyReq)
@@ -207,6 +212,7 @@ func (pa *path) run() {
 	pa.onDemandStaticSourceCloseTimer.Stop()
 	pa.onDemandPublisherReadyTimer.Stop()
 	pa.onDemandPublisherCloseTimer.Stop()
+	pa.recordGraceTimer.Stop()
 
 	onUnInitHook()
 
@@ -222,6 +228,8 @@ func (pa *path) run() {
 		pa.setNotReady()
 	}
 
+	pa.stopRecording()
+
 	if pa.source != nil {
 		if source, ok := pa.source.(*staticsources.Handler); ok {
 			if !pa.conf.SourceOnDemand || pa.onDemandStaticSourceState != pathOnDemandStateInitial {
@@ -266,6 +274,13 @@ func (pa *path) runInner() error {
 		case <-pa.onDemandPublisherCloseTimer.C:
 			pa.doOnDemandPublisherCloseTimer()
 
+		case <-pa.recordGraceTimer.C:
+			pa.doRecordGraceTimer()
+
+			if pa.shouldClose() {
+				return fmt.Errorf("not in use")
+			}
+
 		case newConf := <-pa.chReloadConf:
 			pa.doReloadConf(newConf)
 
@@ -325,6 +340,11 @@ func (pa *path) runInner() error {
 	}
 }
 
+func (pa *path) doRecordGraceTimer() {
+	pa.Log(logger.Info, "stream did not come back, closing recordings")
+	pa.stopRecording()
+}
+
 func (pa *path) doOnDemandStaticSourceReadyTimer() {
 	for _, req := range pa.describeRequestsOnHold {
 		req.Res <- defs.PathDescribeRes{Err: fmt.Errorf("source of path '%s' has timed out", pa.name)}
@@ -372,12 +392,11 @@ func (pa *path) doReloadConf(newConf *conf.Path) {
 	}
 
 	if pa.conf.Record {
-		if pa.stream != nil && pa.recorder == nil {
+		if pa.stream != nil && pa.recorders == nil {
 			pa.startRecording()
 		}
-	} else if pa.recorder != nil {
-		pa.recorder.Close()
-		pa.recorder = nil
+	} else {
+		pa.stopRecording()
 	}
 }
 
@@ -635,6 +654,7 @@ func (pa *path) ExternalCmdEnv() externalcmd.Environment {
 func (pa *path) shouldClose() bool {
 	return pa.conf.Regexp != nil &&
 		pa.source == nil &&
+		pa.recorders == nil &&
 		len(pa.readers) == 0 &&
 		len(pa.describeRequestsOnHold) == 0 &&
 		len(pa.readerAddRequestsOnHold) == 0
@@ -715,7 +735,11 @@ func (pa *path) setReady(desc *description.Session, allocateEncoder bool) error
 	}
 
 	if pa.conf.Record {
-		pa.startRecording()
+		if pa.recorders != nil {
+			pa.resumeRecording()
+		} else {
+			pa.startRecording()
+		}
 	}
 
 	pa.readyTime = time.Now()
@@ -758,9 +782,10 @@ func (pa *path) setNotReady() {
 
 	pa.onNotReadyHook()
 
-	if pa.recorder != nil {
-		pa.recorder.Close()
-		pa.recorder = nil
+	if pa.recorders != nil && pa.conf.RecordReconnectGrace != 0 {
+		pa.suspendRecording()
+	} else {
+		pa.stopRecording()
 	}
 
 	if pa.stream != nil {
@@ -770,13 +795,60 @@ func (pa *path) setNotReady() {
 }
 
 func (pa *path) startRecording() {
-	pa.recorder = &recorder.Recorder{
-		PathFormat:      pa.conf.RecordPath,
-		Format:          pa.conf.RecordFormat,
-		PartDuration:    time.Duration(pa.conf.RecordPartDuration),
-		SegmentDuration: time.Duration(pa.conf.RecordSegmentDuration),
+	for _, recordConf := range pa.conf.RecordConfs() {
+		pa.recorders = append(pa.recorders, pa.newRecorder(recordConf))
+	}
+}
+
+func (pa *path) stopRecording() {
+	pa.recordGraceTimer.Stop()
+	pa.recordGraceTimer = emptyTimer()
+
+	for _, r := range pa.recorders {
+		r.Close()
+	}
+	pa.recorders = nil
+}
+
+// suspendRecording keeps recorders and their segments open
+// for 'recordReconnectGrace', waiting for the stream to come back.
+func (pa *path) suspendRecording() {
+	for _, r := range pa.recorders {
+		r.Suspend()
+	}
+
+	pa.recordGraceTimer.Stop()
+	pa.recordGraceTimer = time.NewTimer(time.Duration(pa.conf.RecordReconnectGrace))
+}
+
+func (pa *path) resumeRecording() {
+	pa.recordGraceTimer.Stop()
+	pa.recordGraceTimer = emptyTimer()
+
+	for _, r := range pa.recorders {
+		r.Resume(pa.stream)
+	}
+}
+
+func (pa *path) newRecorder(recordConf *conf.Path) *recorder.Recorder {
+	var manifestPath string
+	if recordConf.RecordManifest {
+		manifestPath = recordConf.RecordManifestPath
+	}
+
+	r := &recorder.Recorder{
+		PathFormat:      recordConf.RecordPath,
+		Format:          recordConf.RecordFormat,
+		PartDuration:    time.Duration(recordConf.RecordPartDuration),
+		SegmentDuration: time.Duration(recordConf.RecordSegmentDuration),
+		AlignSegments:   recordConf.RecordAlignSegments,
+		Tracks:          recordConf.RecordTrackTypes(),
 		PathName:        pa.name,
 		Stream:          pa.stream,
+		Index:           pa.recordIndex,
+		Manifests:       pa.recordManifests,
+		ManifestPath:    manifestPath,
+		ManifestKey:     recordConf.RecordManifestKey,
 		OnSegmentCreate: func(segmentPath string) {
 			if pa.conf.RunOnRecordSegmentCreate != "" {
 				env := pa.ExternalCmdEnv()
@@ -808,7 +880,9 @@ func (pa *path) startRecording() {
 		},
 		Parent: pa,
 	}
-	pa.recorder.Initialize()
+	r.Initialize()
+
+	return r
 }
 
 func (pa *path) executeRemoveReader(r defs.Reader) {
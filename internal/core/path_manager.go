@@ -12,6 +12,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/metrics"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/servers/hls"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
@@ -72,6 +73,8 @@ type pathManager struct {
 	writeQueueSize    int
 	udpMaxPayloadSize int
 	pathConfs         map[string]*conf.Path
+	recordIndex       *recordstore.Index
+	recordManifests   *recordstore.ManifestWriter
 	externalCmdPool   *externalcmd.Pool
 	metrics           *metrics.Metrics
 	parent            pathManagerParent
@@ -433,6 +436,8 @@ func (pm *pathManager) createPath(
 		name:              name,
 		matches:           matches,
 		wg:                &pm.wg,
+		recordIndex:       pm.recordIndex,
+		recordManifests:   pm.recordManifests,
 		externalCmdPool:   pm.externalCmdPool,
 		parent:            pm,
 	}
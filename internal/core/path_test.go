@@ -753,6 +753,57 @@ func TestPathRecord(t *testing.T) {
 	require.Equal(t, 2, len(files))
 }
 
+func TestPathRecordReconnectGrace(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rtsp-path-record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, ok := newInstance("pathDefaults:\n" +
+		"  record: yes\n" +
+		"  recordPath: " + filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f") + "\n" +
+		"  recordReconnectGrace: 5s\n" +
+		"paths:\n" +
+		"  all_others:\n")
+	require.Equal(t, true, ok)
+	defer p.Close()
+
+	media0 := test.UniqueMediaH264()
+
+	publish := func(start int) {
+		source := gortsplib.Client{}
+
+		err2 := source.StartRecording(
+			"rtsp://localhost:8554/mystream",
+			&description.Session{Medias: []*description.Media{media0}})
+		require.NoError(t, err2)
+		defer source.Close()
+
+		for i := start; i < start+4; i++ {
+			err2 = source.WritePacketRTP(media0, &rtp.Packet{
+				Header: rtp.Header{
+					Version:        2,
+					Marker:         true,
+					PayloadType:    96,
+					SequenceNumber: 1123 + uint16(i),
+					Timestamp:      45343 + 90000*uint32(i),
+					SSRC:           563423,
+				},
+				Payload: []byte{5},
+			})
+			require.NoError(t, err2)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	publish(0)
+	publish(4)
+
+	files, err := os.ReadDir(filepath.Join(dir, "mystream"))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(files))
+}
+
 func TestPathFallback(t *testing.T) {
 	for _, ca := range []string{
 		"absolute",
@@ -20,6 +20,12 @@ type APIHLSServer interface {
 	APIMuxersGet(string) (*APIHLSMuxer, error)
 }
 
+// APIDASHServer contains methods used by the API and Metrics server.
+type APIDASHServer interface {
+	APIMuxersList() (*APIDASHMuxerList, error)
+	APIMuxersGet(string) (*APIDASHMuxer, error)
+}
+
 // APIRTSPServer contains methods used by the API and Metrics server.
 type APIRTSPServer interface {
 	APIConnsList() (*APIRTSPConnsList, error)
@@ -43,6 +49,40 @@ type APISRTServer interface {
 	APIConnsKick(uuid.UUID) error
 }
 
+// APIRISTServer contains methods used by the API and Metrics server.
+type APIRISTServer interface {
+	APIConnsList() (*APIRISTConnList, error)
+	APIConnsGet(uuid.UUID) (*APIRISTConn, error)
+	APIConnsKick(uuid.UUID) error
+}
+
+// APIHTTPFLVServer contains methods used by the API and Metrics server.
+type APIHTTPFLVServer interface {
+	APIConnsList() (*APIHTTPFLVConnList, error)
+	APIConnsGet(uuid.UUID) (*APIHTTPFLVConn, error)
+	APIConnsKick(uuid.UUID) error
+}
+
+// APIWSFMP4Server contains methods used by the API and Metrics server.
+type APIWSFMP4Server interface {
+	APISessionsList() (*APIWSFMP4SessionList, error)
+	APISessionsGet(uuid.UUID) (*APIWSFMP4Session, error)
+	APISessionsKick(uuid.UUID) error
+}
+
+// APIGB28181Server contains methods used by the API and Metrics server.
+type APIGB28181Server interface {
+	APIDevicesList() (*APIGB28181DeviceList, error)
+	APIDevicesGet(string) (*APIGB28181Device, error)
+}
+
+// APIMoQServer contains methods used by the API and Metrics server.
+type APIMoQServer interface {
+	APISessionsList() (*APIMoQSessionList, error)
+	APISessionsGet(uuid.UUID) (*APIMoQSession, error)
+	APISessionsKick(uuid.UUID) error
+}
+
 // APIWebRTCServer contains methods used by the API and Metrics server.
 type APIWebRTCServer interface {
 	APISessionsList() (*APIWebRTCSessionList, error)
@@ -50,11 +90,33 @@ type APIWebRTCServer interface {
 	APISessionsKick(uuid.UUID) error
 }
 
+// APIRecordCleaner contains methods used by the Metrics server.
+type APIRecordCleaner interface {
+	APIDeletionsList() *APIRecordDeletionList
+}
+
 // APIError is a generic error.
 type APIError struct {
 	Error string `json:"error"`
 }
 
+// APIAuthLockout is an identity tracked by the brute-force protection.
+type APIAuthLockout struct {
+	Type         string     `json:"type"`
+	Value        string     `json:"value"`
+	Failures     int        `json:"failures"`
+	LastFailure  time.Time  `json:"lastFailure"`
+	LockedUntil  *time.Time `json:"lockedUntil"`
+	LockoutCount int        `json:"lockoutCount"`
+}
+
+// APIAuthLockoutList is a list of identities tracked by the brute-force protection.
+type APIAuthLockoutList struct {
+	ItemCount int               `json:"itemCount"`
+	PageCount int               `json:"pageCount"`
+	Items     []*APIAuthLockout `json:"items"`
+}
+
 // APIPathConfList is a list of path configurations.
 type APIPathConfList struct {
 	ItemCount int          `json:"itemCount"`
@@ -103,6 +165,39 @@ type APIHLSMuxerList struct {
 	Items     []*APIHLSMuxer `json:"items"`
 }
 
+// APIDASHMuxer is a MPEG-DASH muxer.
+type APIDASHMuxer struct {
+	Path        string    `json:"path"`
+	Created     time.Time `json:"created"`
+	LastRequest time.Time `json:"lastRequest"`
+	BytesSent   uint64    `json:"bytesSent"`
+}
+
+// APIDASHMuxerList is a list of MPEG-DASH muxers.
+type APIDASHMuxerList struct {
+	ItemCount int             `json:"itemCount"`
+	PageCount int             `json:"pageCount"`
+	Items     []*APIDASHMuxer `json:"items"`
+}
+
+// APIHTTPFLVConn is a HTTP-FLV connection.
+type APIHTTPFLVConn struct {
+	ID         uuid.UUID `json:"id"`
+	Created    time.Time `json:"created"`
+	RemoteAddr string    `json:"remoteAddr"`
+	WebSocket  bool      `json:"webSocket"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	BytesSent  uint64    `json:"bytesSent"`
+}
+
+// APIHTTPFLVConnList is a list of HTTP-FLV connections.
+type APIHTTPFLVConnList struct {
+	ItemCount int               `json:"itemCount"`
+	PageCount int               `json:"pageCount"`
+	Items     []*APIHTTPFLVConn `json:"items"`
+}
+
 // APIRTMPConnState is the state of a RTMP connection.
 type APIRTMPConnState string
 
@@ -335,6 +430,50 @@ type APISRTConnList struct {
 	Items     []*APISRTConn `json:"items"`
 }
 
+// APIRISTConnState is the state of a RIST connection.
+type APIRISTConnState string
+
+// states.
+const (
+	APIRISTConnStateIdle    APIRISTConnState = "idle"
+	APIRISTConnStatePublish APIRISTConnState = "publish"
+)
+
+// APIRISTConn is a RIST connection.
+type APIRISTConn struct {
+	ID         uuid.UUID        `json:"id"`
+	Created    time.Time        `json:"created"`
+	RemoteAddr string           `json:"remoteAddr"`
+	State      APIRISTConnState `json:"state"`
+	CNAME      string           `json:"cname"`
+	Path       string           `json:"path"`
+	Query      string           `json:"query"`
+
+	// The total number of received RTP packets, including retransmitted and duplicate packets
+	PacketsReceived uint64 `json:"packetsReceived"`
+	// The total number of received retransmitted RTP packets
+	PacketsRetransmitted uint64 `json:"packetsRetransmitted"`
+	// The total number of missing RTP packets recovered through retransmissions
+	PacketsRecovered uint64 `json:"packetsRecovered"`
+	// The total number of missing RTP packets that were not recovered in time
+	PacketsLost uint64 `json:"packetsLost"`
+	// The total number of RTP packets received more than once or too late
+	PacketsDuplicate uint64 `json:"packetsDuplicate"`
+	// The total number of retransmission requests sent through RTCP NACKs
+	PacketsNACKed uint64 `json:"packetsNACKed"`
+	// The total number of received bytes
+	BytesReceived uint64 `json:"bytesReceived"`
+	// Round-trip time, in milliseconds
+	MsRTT float64 `json:"msRTT"`
+}
+
+// APIRISTConnList is a list of RIST connections.
+type APIRISTConnList struct {
+	ItemCount int            `json:"itemCount"`
+	PageCount int            `json:"pageCount"`
+	Items     []*APIRISTConn `json:"items"`
+}
+
 // APIWebRTCSessionState is the state of a WebRTC connection.
 type APIWebRTCSessionState string
 
@@ -366,9 +505,81 @@ type APIWebRTCSessionList struct {
 	Items     []*APIWebRTCSession `json:"items"`
 }
 
+// APIWSFMP4Session is a WebSocket-fMP4 session.
+type APIWSFMP4Session struct {
+	ID         uuid.UUID `json:"id"`
+	Created    time.Time `json:"created"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	BytesSent  uint64    `json:"bytesSent"`
+}
+
+// APIWSFMP4SessionList is a list of WebSocket-fMP4 sessions.
+type APIWSFMP4SessionList struct {
+	ItemCount int                 `json:"itemCount"`
+	PageCount int                 `json:"pageCount"`
+	Items     []*APIWSFMP4Session `json:"items"`
+}
+
+// APIGB28181ChannelState is the state of a GB28181 channel.
+type APIGB28181ChannelState string
+
+// states.
+const (
+	APIGB28181ChannelStateIdle      APIGB28181ChannelState = "idle"
+	APIGB28181ChannelStateInviting  APIGB28181ChannelState = "inviting"
+	APIGB28181ChannelStateStreaming APIGB28181ChannelState = "streaming"
+)
+
+// APIGB28181Channel is a channel of a GB28181 device.
+type APIGB28181Channel struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Status        string                 `json:"status"`
+	State         APIGB28181ChannelState `json:"state"`
+	Path          string                 `json:"path"`
+	BytesReceived uint64                 `json:"bytesReceived"`
+}
+
+// APIGB28181Device is a GB28181 device.
+type APIGB28181Device struct {
+	ID            string               `json:"id"`
+	Created       time.Time            `json:"created"`
+	RemoteAddr    string               `json:"remoteAddr"`
+	Expires       time.Time            `json:"expires"`
+	LastKeepalive *time.Time           `json:"lastKeepalive"`
+	Channels      []*APIGB28181Channel `json:"channels"`
+}
+
+// APIGB28181DeviceList is a list of GB28181 devices.
+type APIGB28181DeviceList struct {
+	ItemCount int                 `json:"itemCount"`
+	PageCount int                 `json:"pageCount"`
+	Items     []*APIGB28181Device `json:"items"`
+}
+
+// APIMoQSession is a MoQ session.
+type APIMoQSession struct {
+	ID         uuid.UUID `json:"id"`
+	Created    time.Time `json:"created"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query"`
+	BytesSent  uint64    `json:"bytesSent"`
+}
+
+// APIMoQSessionList is a list of MoQ sessions.
+type APIMoQSessionList struct {
+	ItemCount int              `json:"itemCount"`
+	PageCount int              `json:"pageCount"`
+	Items     []*APIMoQSession `json:"items"`
+}
+
 // APIRecordingSegment is a recording segment.
 type APIRecordingSegment struct {
-	Start time.Time `json:"start"`
+	Start  time.Time `json:"start"`
+	Locked bool      `json:"locked"`
 }
 
 // APIRecording is a recording.
@@ -383,3 +594,59 @@ type APIRecordingList struct {
 	PageCount int             `json:"pageCount"`
 	Items     []*APIRecording `json:"items"`
 }
+
+// APIRecordingVerificationSegment is the verification result of a recording segment.
+type APIRecordingVerificationSegment struct {
+	Start  time.Time `json:"start"`
+	Status string    `json:"status"`
+}
+
+// APIRecordingVerification is the verification result of a time range of a recording.
+type APIRecordingVerification struct {
+	Path     string                             `json:"path"`
+	Start    time.Time                          `json:"start"`
+	End      time.Time                          `json:"end"`
+	Valid    bool                               `json:"valid"`
+	Segments []*APIRecordingVerificationSegment `json:"segments"`
+	Errors   []string                           `json:"errors"`
+}
+
+// APIRecordLock is a time range of a path protected from deletion.
+type APIRecordLock struct {
+	ID      uuid.UUID `json:"id"`
+	Path    string    `json:"path"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Reason  string    `json:"reason"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+}
+
+// APIRecordLockList is a list of record locks.
+type APIRecordLockList struct {
+	ItemCount int              `json:"itemCount"`
+	PageCount int              `json:"pageCount"`
+	Items     []*APIRecordLock `json:"items"`
+}
+
+// APIRecordLockAdd is a request to add a record lock.
+type APIRecordLockAdd struct {
+	Path   string    `json:"path"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+	Author string    `json:"author"`
+}
+
+// APIRecordDeletion contains statistics about segments deleted by the record cleaner.
+type APIRecordDeletion struct {
+	Path     string `json:"path"`
+	Reason   string `json:"reason"`
+	Segments uint64 `json:"segments"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// APIRecordDeletionList is a list of APIRecordDeletion.
+type APIRecordDeletionList struct {
+	Items []*APIRecordDeletion `json:"items"`
+}
@@ -34,6 +34,7 @@ func metricFloat(key string, tags string, value float64) string {
 
 type metricsAuthManager interface {
 	Authenticate(req *auth.Request) error
+	LockoutState() *auth.LockoutState
 }
 
 type metricsParent interface {
@@ -42,26 +43,35 @@ type metricsParent interface {
 
 // Metrics is a metrics provider.
 type Metrics struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.Duration
-	AuthManager    metricsAuthManager
-	Parent         metricsParent
-
-	httpServer   *httpp.Server
-	mutex        sync.Mutex
-	pathManager  defs.APIPathManager
-	rtspServer   defs.APIRTSPServer
-	rtspsServer  defs.APIRTSPServer
-	rtmpServer   defs.APIRTMPServer
-	rtmpsServer  defs.APIRTMPServer
-	srtServer    defs.APISRTServer
-	hlsServer    defs.APIHLSServer
-	webRTCServer defs.APIWebRTCServer
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	AuthManager        metricsAuthManager
+	Parent             metricsParent
+
+	httpServer    *httpp.Server
+	mutex         sync.Mutex
+	pathManager   defs.APIPathManager
+	rtspServer    defs.APIRTSPServer
+	rtspsServer   defs.APIRTSPServer
+	rtmpServer    defs.APIRTMPServer
+	rtmpsServer   defs.APIRTMPServer
+	srtServer     defs.APISRTServer
+	hlsServer     defs.APIHLSServer
+	webRTCServer  defs.APIWebRTCServer
+	httpFLVServer defs.APIHTTPFLVServer
+	dashServer    defs.APIDASHServer
+	wsfmp4Server  defs.APIWSFMP4Server
+	gb28181Server defs.APIGB28181Server
+	ristServer    defs.APIRISTServer
+	moqServer     defs.APIMoQServer
+	recordCleaner defs.APIRecordCleaner
 }
 
 // Initialize initializes metrics.
@@ -77,14 +87,16 @@ func (m *Metrics) Initialize() error {
 	network, address := restrictnetwork.Restrict("tcp", m.Address)
 
 	m.httpServer = &httpp.Server{
-		Network:     network,
-		Address:     address,
-		ReadTimeout: time.Duration(m.ReadTimeout),
-		Encryption:  m.Encryption,
-		ServerCert:  m.ServerCert,
-		ServerKey:   m.ServerKey,
-		Handler:     router,
-		Parent:      m,
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(m.ReadTimeout),
+		Encryption:         m.Encryption,
+		ServerCert:         m.ServerCert,
+		ServerKey:          m.ServerKey,
+		ClientCA:           m.ClientCA,
+		ClientCertRequired: m.ClientCertRequired,
+		Handler:            router,
+		Parent:             m,
 	}
 	err := m.httpServer.Initialize()
 	if err != nil {
@@ -167,6 +179,21 @@ func (m *Metrics) onMetrics(ctx *gin.Context) {
 		out += metric("paths", "", 0)
 	}
 
+	if state := m.AuthManager.LockoutState(); state != nil {
+		// identities are not exported since they are chosen by clients
+		// and would produce an unbounded number of series.
+		locked := make(map[auth.LockoutType]int64)
+		for _, i := range state.Items {
+			if i.LockedUntil != nil {
+				locked[i.Type]++
+			}
+		}
+		for _, typ := range []auth.LockoutType{auth.LockoutTypeIP, auth.LockoutTypeUser} {
+			out += metric("auth_lockouts", "{type=\""+string(typ)+"\"}", locked[typ])
+		}
+		out += metric("auth_lockout_events", "", int64(state.Events))
+	}
+
 	if !interfaceIsEmpty(m.hlsServer) {
 		data, err := m.hlsServer.APIMuxersList()
 		if err == nil && len(data.Items) != 0 {
@@ -443,6 +470,132 @@ func (m *Metrics) onMetrics(ctx *gin.Context) {
 		}
 	}
 
+	if !interfaceIsEmpty(m.httpFLVServer) {
+		data, err := m.httpFLVServer.APIConnsList()
+		if err == nil && len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{id=\"" + i.ID.String() + "\"}"
+				out += metric("httpflv_conns", tags, 1)
+				out += metric("httpflv_conns_bytes_sent", tags, int64(i.BytesSent))
+			}
+		} else {
+			out += metric("httpflv_conns", "", 0)
+			out += metric("httpflv_conns_bytes_sent", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.dashServer) {
+		data, err := m.dashServer.APIMuxersList()
+		if err == nil && len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{name=\"" + i.Path + "\"}"
+				out += metric("dash_muxers", tags, 1)
+				out += metric("dash_muxers_bytes_sent", tags, int64(i.BytesSent))
+			}
+		} else {
+			out += metric("dash_muxers", "", 0)
+			out += metric("dash_muxers_bytes_sent", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.wsfmp4Server) {
+		data, err := m.wsfmp4Server.APISessionsList()
+		if err == nil && len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{id=\"" + i.ID.String() + "\"}"
+				out += metric("wsfmp4_sessions", tags, 1)
+				out += metric("wsfmp4_sessions_bytes_sent", tags, int64(i.BytesSent))
+			}
+		} else {
+			out += metric("wsfmp4_sessions", "", 0)
+			out += metric("wsfmp4_sessions_bytes_sent", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.gb28181Server) {
+		data, err := m.gb28181Server.APIDevicesList()
+		if err == nil && len(data.Items) != 0 {
+			channelCount := 0
+
+			for _, i := range data.Items {
+				tags := "{id=\"" + i.ID + "\"}"
+				out += metric("gb28181_devices", tags, 1)
+
+				for _, ch := range i.Channels {
+					tags = "{device=\"" + i.ID + "\",id=\"" + ch.ID + "\",state=\"" + string(ch.State) + "\"}"
+					out += metric("gb28181_channels", tags, 1)
+					out += metric("gb28181_channels_bytes_received", tags, int64(ch.BytesReceived))
+					channelCount++
+				}
+			}
+
+			if channelCount == 0 {
+				out += metric("gb28181_channels", "", 0)
+				out += metric("gb28181_channels_bytes_received", "", 0)
+			}
+		} else {
+			out += metric("gb28181_devices", "", 0)
+			out += metric("gb28181_channels", "", 0)
+			out += metric("gb28181_channels_bytes_received", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.ristServer) {
+		data, err := m.ristServer.APIConnsList()
+		if err == nil && len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{id=\"" + i.ID.String() + "\",state=\"" + string(i.State) + "\"}"
+				out += metric("rist_conns", tags, 1)
+				out += metric("rist_conns_packets_received", tags, int64(i.PacketsReceived))
+				out += metric("rist_conns_packets_retransmitted", tags, int64(i.PacketsRetransmitted))
+				out += metric("rist_conns_packets_recovered", tags, int64(i.PacketsRecovered))
+				out += metric("rist_conns_packets_lost", tags, int64(i.PacketsLost))
+				out += metric("rist_conns_packets_duplicate", tags, int64(i.PacketsDuplicate))
+				out += metric("rist_conns_packets_nacked", tags, int64(i.PacketsNACKed))
+				out += metric("rist_conns_bytes_received", tags, int64(i.BytesReceived))
+				out += metricFloat("rist_conns_ms_rtt", tags, i.MsRTT)
+			}
+		} else {
+			out += metric("rist_conns", "", 0)
+			out += metric("rist_conns_packets_received", "", 0)
+			out += metric("rist_conns_packets_retransmitted", "", 0)
+			out += metric("rist_conns_packets_recovered", "", 0)
+			out += metric("rist_conns_packets_lost", "", 0)
+			out += metric("rist_conns_packets_duplicate", "", 0)
+			out += metric("rist_conns_packets_nacked", "", 0)
+			out += metric("rist_conns_bytes_received", "", 0)
+			out += metricFloat("rist_conns_ms_rtt", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.moqServer) {
+		data, err := m.moqServer.APISessionsList()
+		if err == nil && len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{id=\"" + i.ID.String() + "\"}"
+				out += metric("moq_sessions", tags, 1)
+				out += metric("moq_sessions_bytes_sent", tags, int64(i.BytesSent))
+			}
+		} else {
+			out += metric("moq_sessions", "", 0)
+			out += metric("moq_sessions_bytes_sent", "", 0)
+		}
+	}
+
+	if !interfaceIsEmpty(m.recordCleaner) {
+		data := m.recordCleaner.APIDeletionsList()
+		if len(data.Items) != 0 {
+			for _, i := range data.Items {
+				tags := "{path=\"" + i.Path + "\",reason=\"" + i.Reason + "\"}"
+				out += metric("record_deleted_segments", tags, int64(i.Segments))
+				out += metric("record_deleted_bytes", tags, int64(i.Bytes))
+			}
+		} else {
+			out += metric("record_deleted_segments", "", 0)
+			out += metric("record_deleted_bytes", "", 0)
+		}
+	}
+
 	ctx.Writer.WriteHeader(http.StatusOK)
 	io.WriteString(ctx.Writer, out) //nolint:errcheck
 }
@@ -502,3 +655,52 @@ func (m *Metrics) SetWebRTCServer(s defs.APIWebRTCServer) {
 	defer m.mutex.Unlock()
 	m.webRTCServer = s
 }
+
+// SetHTTPFLVServer is called by core.
+func (m *Metrics) SetHTTPFLVServer(s defs.APIHTTPFLVServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.httpFLVServer = s
+}
+
+// SetDASHServer is called by core.
+func (m *Metrics) SetDASHServer(s defs.APIDASHServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.dashServer = s
+}
+
+// SetWSFMP4Server is called by core.
+func (m *Metrics) SetWSFMP4Server(s defs.APIWSFMP4Server) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.wsfmp4Server = s
+}
+
+// SetGB28181Server is called by core.
+func (m *Metrics) SetGB28181Server(s defs.APIGB28181Server) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.gb28181Server = s
+}
+
+// SetRISTServer is called by core.
+func (m *Metrics) SetRISTServer(s defs.APIRISTServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ristServer = s
+}
+
+// SetMoQServer is called by core.
+func (m *Metrics) SetMoQServer(s defs.APIMoQServer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.moqServer = s
+}
+
+// SetRecordCleaner is called by core.
+func (m *Metrics) SetRecordCleaner(s defs.APIRecordCleaner) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recordCleaner = s
+}
@@ -0,0 +1,377 @@
+// Package mpts contains the MPTS output.
+package mpts
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/counterdumper"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	packetsPerDatagram = 7
+	writePeriod        = 2 * time.Millisecond
+	tablesPeriod       = 100 * time.Millisecond
+	maxQueueDuration   = 2 * time.Second
+	maxBurstDuration   = 100 * time.Millisecond
+)
+
+// queuedPacket is a packet of an elementary stream that is waiting to be sent.
+type queuedPacket struct {
+	buf      []byte
+	received time.Time
+}
+
+type outputPathManager interface {
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+// Output muxes multiple paths as separate programs of a single, constant-rate,
+// multi-program MPEG-TS and sends it over UDP.
+type Output struct {
+	Address            string
+	MulticastTTL       int
+	MulticastInterface string
+	Bitrate            int
+	TransportStreamID  int
+	OriginalNetworkID  int
+	Programs           []conf.MPTSProgram
+	PathManager        outputPathManager
+	Parent             logger.Writer
+
+	pc             net.PacketConn
+	addr           *net.UDPAddr
+	programs       []*program
+	pat            []byte
+	sdt            []byte
+	maxQueueSize   int
+	packetDuration time.Duration
+	droppedUnits   *counterdumper.CounterDumper
+	writeErrors    *counterdumper.CounterDumper
+
+	mutex sync.Mutex
+	queue []queuedPacket
+
+	// writer goroutine
+	tablePackets [][]byte
+	tableCCs     map[uint16]uint8
+
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes Output.
+func (o *Output) Initialize() error {
+	var err error
+	o.addr, err = net.ResolveUDPAddr("udp", o.Address)
+	if err != nil {
+		return err
+	}
+
+	o.pc, err = o.listenPacket()
+	if err != nil {
+		return err
+	}
+
+	patPrograms := make([]patProgram, len(o.Programs))
+	services := make([]sdtService, len(o.Programs))
+
+	for i, p := range o.Programs {
+		patPrograms[i] = patProgram{
+			programNumber: uint16(p.ProgramNumber),
+			pmtPID:        uint16(p.PMTPID),
+		}
+		services[i] = sdtService{
+			serviceID: uint16(p.ProgramNumber),
+			provider:  p.ServiceProvider,
+			name:      p.ServiceName,
+		}
+	}
+
+	o.pat = marshalPAT(uint16(o.TransportStreamID), patPrograms)
+	o.sdt = marshalSDT(uint16(o.TransportStreamID), uint16(o.OriginalNetworkID), services)
+
+	o.maxQueueSize = int(int64(o.Bitrate) * int64(maxQueueDuration) / int64(time.Second) / (tsPacketSize * 8))
+	o.packetDuration = time.Duration(int64(tsPacketSize*8) * int64(time.Second) / int64(o.Bitrate))
+	o.tableCCs = make(map[uint16]uint8)
+	o.terminate = make(chan struct{})
+	o.done = make(chan struct{})
+
+	o.droppedUnits = &counterdumper.CounterDumper{
+		OnReport: func(val uint64) {
+			o.Log(logger.Warn, "%d %s dropped since bitrate is too low",
+				val,
+				func() string {
+					if val == 1 {
+						return "PES packet"
+					}
+					return "PES packets"
+				}())
+		},
+	}
+	o.droppedUnits.Start()
+
+	o.writeErrors = &counterdumper.CounterDumper{
+		OnReport: func(val uint64) {
+			o.Log(logger.Warn, "%d %s couldn't be sent",
+				val,
+				func() string {
+					if val == 1 {
+						return "datagram"
+					}
+					return "datagrams"
+				}())
+		},
+	}
+	o.writeErrors.Start()
+
+	for _, c := range o.Programs {
+		pr := &program{
+			conf:        c,
+			pathManager: o.PathManager,
+			parent:      o,
+		}
+		pr.initialize()
+		o.programs = append(o.programs, pr)
+	}
+
+	o.Log(logger.Info, "sending to %s, %d %s, %d bit/s",
+		o.addr,
+		len(o.programs),
+		func() string {
+			if len(o.programs) == 1 {
+				return "program"
+			}
+			return "programs"
+		}(),
+		o.Bitrate)
+
+	go o.run()
+
+	return nil
+}
+
+// Close closes Output.
+func (o *Output) Close() {
+	o.Log(logger.Info, "closing")
+
+	for _, pr := range o.programs {
+		pr.close()
+	}
+
+	close(o.terminate)
+	<-o.done
+
+	o.writeErrors.Stop()
+	o.droppedUnits.Stop()
+	o.pc.Close()
+}
+
+// Log implements logger.Writer.
+func (o *Output) Log(level logger.Level, format string, args ...interface{}) {
+	o.Parent.Log(level, "[MPTS] "+format, args...)
+}
+
+func (o *Output) listenPacket() (net.PacketConn, error) {
+	if !o.addr.IP.IsMulticast() {
+		return net.ListenPacket("udp", ":0")
+	}
+
+	var intf *net.Interface
+	if o.MulticastInterface != "" {
+		var err error
+		intf, err = net.InterfaceByName(o.MulticastInterface)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if o.addr.IP.To4() != nil {
+		pc, err := net.ListenPacket("udp4", ":0")
+		if err != nil {
+			return nil, err
+		}
+
+		p := ipv4.NewPacketConn(pc)
+
+		err = p.SetMulticastTTL(o.MulticastTTL)
+		if err == nil && intf != nil {
+			err = p.SetMulticastInterface(intf)
+		}
+		if err != nil {
+			pc.Close()
+			return nil, err
+		}
+
+		return pc, nil
+	}
+
+	pc, err := net.ListenPacket("udp6", ":0")
+	if err != nil {
+		return nil, err
+	}
+
+	p := ipv6.NewPacketConn(pc)
+
+	err = p.SetMulticastHopLimit(o.MulticastTTL)
+	if err == nil && intf != nil {
+		err = p.SetMulticastInterface(intf)
+	}
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	return pc, nil
+}
+
+// push enqueues a unit (PES packet) of an elementary stream.
+// Units are dropped as a whole when the queue is full,
+// in order not to send corrupted access units.
+func (o *Output) push(unit []queuedPacket) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if (len(o.queue) + len(unit)) > o.maxQueueSize {
+		o.droppedUnits.Increase()
+		return
+	}
+
+	o.queue = append(o.queue, unit...)
+}
+
+// setPMT sets the PMT of a program.
+func (o *Output) setPMT(pr *program, p pmt) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if bytes.Equal(p.marshal(uint16(pr.conf.ProgramNumber), pr.pmtVersion), pr.pmtSection) {
+		return
+	}
+
+	pr.pmtVersion = (pr.pmtVersion + 1) & 0x1F
+	pr.pmtSection = p.marshal(uint16(pr.conf.ProgramNumber), pr.pmtVersion)
+}
+
+func (o *Output) run() {
+	defer close(o.done)
+
+	ticker := time.NewTicker(writePeriod)
+	defer ticker.Stop()
+
+	datagramsPerSecond := float64(o.Bitrate) / (tsPacketSize * packetsPerDatagram * 8)
+	maxBurst := uint64(datagramsPerSecond * maxBurstDuration.Seconds())
+	if maxBurst < 1 {
+		maxBurst = 1
+	}
+
+	buf := make([]byte, tsPacketSize*packetsPerDatagram)
+	start := time.Now()
+	sent := uint64(0)
+	nextTables := start
+
+	for {
+		select {
+		case now := <-ticker.C:
+			due := uint64(now.Sub(start).Seconds() * datagramsPerSecond)
+
+			// do not send bursts after a stall
+			if (due - sent) > maxBurst {
+				sent = due - maxBurst
+			}
+
+			for ; sent < due; sent++ {
+				sendTime := start.Add(time.Duration(float64(sent) * float64(time.Second) / datagramsPerSecond))
+
+				if !now.Before(nextTables) {
+					o.enqueueTables()
+					nextTables = nextTables.Add(tablesPeriod)
+					if nextTables.Before(now) {
+						nextTables = now.Add(tablesPeriod)
+					}
+				}
+
+				o.fillDatagram(buf, sendTime)
+
+				_, err := o.pc.WriteTo(buf, o.addr)
+				if err != nil {
+					o.writeErrors.Increase()
+				}
+			}
+
+		case <-o.terminate:
+			return
+		}
+	}
+}
+
+func (o *Output) enqueueTables() {
+	o.tablePackets = append(o.tablePackets, o.packetizeSection(pidPAT, o.pat)...)
+
+	o.mutex.Lock()
+	for _, pr := range o.programs {
+		o.tablePackets = append(o.tablePackets, o.packetizeSection(uint16(pr.conf.PMTPID), pr.pmtSection)...)
+	}
+	o.mutex.Unlock()
+
+	o.tablePackets = append(o.tablePackets, o.packetizeSection(pidSDT, o.sdt)...)
+}
+
+func (o *Output) packetizeSection(pid uint16, section []byte) [][]byte {
+	cc := o.tableCCs[pid]
+	ret := packetizeSection(pid, &cc, section)
+	o.tableCCs[pid] = cc
+	return ret
+}
+
+// fillDatagram fills a datagram with tables, then with packets of elementary streams,
+// then with null packets.
+func (o *Output) fillDatagram(buf []byte, sendTime time.Time) {
+	i := 0
+
+	for ; i < packetsPerDatagram && len(o.tablePackets) != 0; i++ {
+		copy(buf[i*tsPacketSize:], o.tablePackets[0])
+		o.tablePackets = o.tablePackets[1:]
+	}
+
+	if i < packetsPerDatagram {
+		o.mutex.Lock()
+		for ; i < packetsPerDatagram && len(o.queue) != 0; i++ {
+			pkt := buf[i*tsPacketSize : (i+1)*tsPacketSize]
+			copy(pkt, o.queue[0].buf)
+			restampPCR(pkt, o.queue[0].received, sendTime.Add(time.Duration(i)*o.packetDuration))
+			o.queue[0] = queuedPacket{}
+			o.queue = o.queue[1:]
+		}
+		o.mutex.Unlock()
+	}
+
+	for ; i < packetsPerDatagram; i++ {
+		copy(buf[i*tsPacketSize:], nullPacket)
+	}
+}
+
+// restampPCR adds to the PCR of a packet the time the packet spent in the output,
+// in order to remove the jitter caused by queueing.
+func restampPCR(pkt []byte, received time.Time, sent time.Time) {
+	pcr, ok := packetPCR(pkt)
+	if !ok {
+		return
+	}
+
+	delay := sent.Sub(received)
+	if delay <= 0 {
+		return
+	}
+
+	setPacketPCR(pkt, pcr+uint64(delay)*(pcrClockRate/1000000)/1000)
+}
@@ -0,0 +1,318 @@
+package mpts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astits"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/counterdumper"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type dummyPath struct{}
+
+func (pa *dummyPath) Name() string {
+	return "mypath"
+}
+
+func (pa *dummyPath) SafeConf() *conf.Path {
+	return &conf.Path{}
+}
+
+func (pa *dummyPath) ExternalCmdEnv() externalcmd.Environment {
+	return nil
+}
+
+func (pa *dummyPath) StartPublisher(_ defs.PathStartPublisherReq) (*stream.Stream, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
+
+func (pa *dummyPath) StopPublisher(_ defs.PathStopPublisherReq) {
+}
+
+func (pa *dummyPath) RemovePublisher(_ defs.PathRemovePublisherReq) {
+}
+
+func (pa *dummyPath) RemoveReader(_ defs.PathRemoveReaderReq) {
+}
+
+func TestPSI(t *testing.T) {
+	pat := marshalPAT(1, []patProgram{{programNumber: 3, pmtPID: 4096}})
+	require.Equal(t, uint32(0), crc32MPEG2(pat))
+
+	pmtPID, err := unmarshalPATPMTPID(pat)
+	require.NoError(t, err)
+	require.Equal(t, uint16(4096), pmtPID)
+
+	p := pmt{
+		pcrPID:      256,
+		programInfo: []byte{},
+		streams: []pmtStream{
+			{streamType: 0x1B, pid: 256, descriptors: []byte{}},
+			{streamType: 0x0F, pid: 257, descriptors: []byte{0x0a, 0x04, 0x65, 0x6e, 0x67, 0x00}},
+		},
+	}
+
+	var p2 pmt
+	err = p2.unmarshal(p.marshal(3, 5))
+	require.NoError(t, err)
+	require.Equal(t, p, p2)
+
+	var cc uint8 = 15
+	pkts := packetizeSection(4096, &cc, p.marshal(3, 5))
+	require.Len(t, pkts, 1)
+	require.Equal(t, uint8(0), cc)
+	require.Equal(t, []byte{0x47, 0x50, 0x00, 0x1f, 0x00, 0x02}, pkts[0][:6])
+
+	section, ok := packetSection(pkts[0])
+	require.True(t, ok)
+	err = p2.unmarshal(section)
+	require.NoError(t, err)
+	require.Equal(t, p, p2)
+}
+
+func TestOutput(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:9005")
+	require.NoError(t, err)
+	defer pc.Close()
+
+	desc := &description.Session{Medias: []*description.Media{test.MediaH264}}
+
+	strm := &stream.Stream{
+		WriteQueueSize:     512,
+		UDPMaxPayloadSize:  1472,
+		Desc:               desc,
+		GenerateRTPPackets: true,
+		Parent:             test.NilLogger,
+	}
+	err = strm.Initialize()
+	require.NoError(t, err)
+	defer strm.Close()
+
+	o := &Output{
+		Address:           "127.0.0.1:9005",
+		MulticastTTL:      1,
+		Bitrate:           1000000,
+		TransportStreamID: 7,
+		OriginalNetworkID: 8,
+		Programs: []conf.MPTSProgram{
+			{
+				Path:            "mypath",
+				ProgramNumber:   3,
+				PMTPID:          4096,
+				PIDs:            []int{300},
+				ServiceName:     "myservice",
+				ServiceProvider: "myprovider",
+			},
+			{
+				Path:          "missing",
+				ProgramNumber: 4,
+				PMTPID:        4097,
+				PIDs:          []int{400},
+			},
+		},
+		PathManager: &test.PathManager{
+			AddReaderImpl: func(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error) {
+				if req.AccessRequest.Name == "mypath" {
+					require.True(t, req.AccessRequest.SkipAuth)
+					return &dummyPath{}, strm, nil
+				}
+				return nil, nil, fmt.Errorf("no stream is available on path '%s'", req.AccessRequest.Name)
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	err = o.Initialize()
+	require.NoError(t, err)
+	defer o.Close()
+
+	go func() {
+		strm.WaitRunningReader()
+
+		for i := 0; i < 3; i++ {
+			strm.WriteUnit(test.MediaH264, test.FormatH264, &unit.H264{
+				Base: unit.Base{
+					PTS: int64(i) * 90000 / 30,
+				},
+				AU: [][]byte{
+					{5, 1}, // IDR
+				},
+			})
+		}
+	}()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+			n, _, err2 := pc.ReadFrom(buf)
+			if err2 != nil {
+				pw.CloseWithError(err2)
+				return
+			}
+
+			if n != tsPacketSize*packetsPerDatagram {
+				pw.CloseWithError(fmt.Errorf("unexpected datagram size: %d", n))
+				return
+			}
+
+			_, err2 = pw.Write(buf[:n])
+			if err2 != nil {
+				return
+			}
+		}
+	}()
+
+	dem := astits.NewDemuxer(context.Background(), pr, astits.DemuxerOptPacketSize(tsPacketSize))
+
+	var patFound, pmtFound, emptyPMTFound, sdtFound, pesFound bool
+
+	for !patFound || !pmtFound || !emptyPMTFound || !sdtFound || !pesFound {
+		data, err := dem.NextData()
+		require.NoError(t, err)
+
+		switch {
+		case data.PAT != nil:
+			require.Equal(t, &astits.PATData{
+				Programs: []*astits.PATProgram{
+					{ProgramMapID: 4096, ProgramNumber: 3},
+					{ProgramMapID: 4097, ProgramNumber: 4},
+				},
+				TransportStreamID: 7,
+			}, data.PAT)
+			patFound = true
+
+		case data.PMT != nil && data.PMT.ProgramNumber == 3:
+			if len(data.PMT.ElementaryStreams) != 0 {
+				require.Equal(t, uint16(300), data.PMT.PCRPID)
+				require.Len(t, data.PMT.ElementaryStreams, 1)
+				require.Equal(t, uint16(300), data.PMT.ElementaryStreams[0].ElementaryPID)
+				require.Equal(t, astits.StreamTypeH264Video, data.PMT.ElementaryStreams[0].StreamType)
+				pmtFound = true
+			}
+
+		case data.PMT != nil && data.PMT.ProgramNumber == 4:
+			require.Empty(t, data.PMT.ElementaryStreams)
+			require.Equal(t, uint16(pidNull), data.PMT.PCRPID)
+			emptyPMTFound = true
+
+		case data.SDT != nil:
+			require.Equal(t, uint16(7), data.SDT.TransportStreamID)
+			require.Equal(t, uint16(8), data.SDT.OriginalNetworkID)
+			require.Len(t, data.SDT.Services, 2)
+			require.Equal(t, uint16(3), data.SDT.Services[0].ServiceID)
+			require.Equal(t, &astits.DescriptorService{
+				Name:     []byte("myservice"),
+				Provider: []byte("myprovider"),
+				Type:     serviceTypeDigitalTV,
+			}, data.SDT.Services[0].Descriptors[0].Service)
+			sdtFound = true
+
+		case data.PES != nil:
+			require.Equal(t, uint16(300), data.FirstPacket.Header.PID)
+			pesFound = true
+		}
+	}
+}
+
+func TestRestampPCR(t *testing.T) {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0] = syncByte
+	pkt[3] = 0x30 // adaptation field and payload
+	pkt[4] = 7
+	pkt[5] = 0x10 // PCR_flag
+	setPacketPCR(pkt, 123456789)
+
+	pcr, ok := packetPCR(pkt)
+	require.True(t, ok)
+	require.Equal(t, uint64(123456789), pcr)
+
+	received := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	restampPCR(pkt, received, received.Add(20*time.Millisecond))
+
+	pcr, ok = packetPCR(pkt)
+	require.True(t, ok)
+	require.Equal(t, uint64(123456789+540000), pcr)
+
+	// wrap around
+	setPacketPCR(pkt, pcrWrap-100)
+	restampPCR(pkt, received, received.Add(time.Millisecond))
+
+	pcr, ok = packetPCR(pkt)
+	require.True(t, ok)
+	require.Equal(t, uint64(27000-100), pcr)
+}
+
+func TestOutputDropWholeUnits(t *testing.T) {
+	o := &Output{
+		maxQueueSize: 4,
+		droppedUnits: &counterdumper.CounterDumper{OnReport: func(uint64) {}},
+	}
+	o.droppedUnits.Start()
+	defer o.droppedUnits.Stop()
+
+	var units [][]queuedPacket
+
+	r := &remuxer{
+		pids:   []int{300},
+		onPMT:  func(pmt) {},
+		onUnit: func(u []queuedPacket) { units = append(units, u) },
+		log:    test.NilLogger,
+	}
+	r.initialize()
+	r.pidMap[256] = 300
+
+	pes := func(start bool, n byte) []byte {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = syncByte
+		pkt[1] = 0x01
+		if start {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = 0x00
+		pkt[3] = 0x10
+		pkt[4] = n
+		return pkt
+	}
+
+	for _, pkt := range [][]byte{
+		pes(false, 0), // remainder of a unit that started before the reader
+		pes(true, 1),
+		pes(false, 2),
+		pes(true, 3),
+		pes(false, 4),
+		pes(false, 5),
+		pes(true, 6),
+	} {
+		r.processPacket(pkt)
+	}
+
+	require.Len(t, units, 2)
+	require.Len(t, units[0], 2)
+	require.Len(t, units[1], 3)
+	require.Equal(t, uint16(300), packetPID(units[0][0].buf))
+
+	for _, u := range units {
+		o.push(u)
+	}
+
+	// the second unit does not fit and is dropped as a whole
+	require.Len(t, o.queue, 2)
+	require.Equal(t, byte(1), o.queue[0].buf[4])
+	require.Equal(t, byte(2), o.queue[1].buf[4])
+}
@@ -0,0 +1,311 @@
+package mpts
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mpegts"
+)
+
+const (
+	retryPause = 2 * time.Second
+)
+
+// remuxer converts a single-program MPEG-TS into packets of a program of the MPTS,
+// by remapping PIDs and rewriting the PMT.
+type remuxer struct {
+	pids   []int
+	onPMT  func(pmt)
+	onUnit func([]queuedPacket)
+	log    logger.Writer
+
+	buf          []byte
+	srcPMTPID    int
+	pidMap       map[uint16]uint16
+	units        map[uint16][]queuedPacket
+	lastSrcPMT   []byte
+	warnedExcess bool
+}
+
+func (r *remuxer) initialize() {
+	r.srcPMTPID = -1
+	r.pidMap = make(map[uint16]uint16)
+	r.units = make(map[uint16][]queuedPacket)
+}
+
+// Write implements io.Writer.
+func (r *remuxer) Write(p []byte) (int, error) {
+	r.buf = append(r.buf, p...)
+
+	for len(r.buf) >= tsPacketSize {
+		pkt := r.buf[:tsPacketSize]
+
+		if pkt[0] != syncByte {
+			r.buf = nil
+			return 0, fmt.Errorf("invalid sync byte")
+		}
+
+		r.processPacket(pkt)
+		r.buf = r.buf[tsPacketSize:]
+	}
+
+	// avoid keeping a reference to the underlying array
+	if len(r.buf) == 0 {
+		r.buf = nil
+	}
+
+	return len(p), nil
+}
+
+func (r *remuxer) processPacket(pkt []byte) {
+	pid := packetPID(pkt)
+
+	switch {
+	case pid == pidPAT:
+		section, ok := packetSection(pkt)
+		if !ok {
+			return
+		}
+
+		pmtPID, err := unmarshalPATPMTPID(section)
+		if err != nil {
+			r.log.Log(logger.Warn, "unable to decode PAT: %v", err)
+			return
+		}
+
+		r.srcPMTPID = int(pmtPID)
+
+	case int(pid) == r.srcPMTPID:
+		section, ok := packetSection(pkt)
+		if !ok {
+			return
+		}
+
+		// tables are retransmitted periodically
+		if string(section) == string(r.lastSrcPMT) {
+			return
+		}
+		r.lastSrcPMT = append([]byte(nil), section...)
+
+		var src pmt
+		err := src.unmarshal(section)
+		if err != nil {
+			r.log.Log(logger.Warn, "unable to decode PMT: %v", err)
+			return
+		}
+
+		r.onPMT(r.remapPMT(src))
+
+	default:
+		dstPID, ok := r.pidMap[pid]
+		if !ok {
+			return
+		}
+
+		out := make([]byte, tsPacketSize)
+		copy(out, pkt)
+		out[1] = (out[1] & 0xE0) | byte(dstPID>>8)
+		out[2] = byte(dstPID)
+
+		// packets are grouped into units (PES packets), that are passed to the output
+		// when the next unit starts, in order to be queued or dropped as a whole.
+		if packetStartsUnit(out) {
+			if unit := r.units[dstPID]; len(unit) != 0 {
+				r.onUnit(unit)
+			}
+			r.units[dstPID] = nil
+		} else if len(r.units[dstPID]) == 0 {
+			// discard the remainder of units that started before the reader
+			return
+		}
+
+		r.units[dstPID] = append(r.units[dstPID], queuedPacket{
+			buf:      out,
+			received: time.Now(),
+		})
+	}
+}
+
+func (r *remuxer) remapPMT(src pmt) pmt {
+	clear(r.pidMap)
+	clear(r.units)
+
+	dst := pmt{
+		pcrPID:      pidNull,
+		programInfo: src.programInfo,
+	}
+
+	for i, s := range src.streams {
+		if i >= len(r.pids) {
+			if !r.warnedExcess {
+				r.warnedExcess = true
+				r.log.Log(logger.Warn, "%d tracks are discarded since there are not enough PIDs",
+					len(src.streams)-len(r.pids))
+			}
+			break
+		}
+
+		r.pidMap[s.pid] = uint16(r.pids[i])
+
+		dst.streams = append(dst.streams, pmtStream{
+			streamType:  s.streamType,
+			pid:         uint16(r.pids[i]),
+			descriptors: s.descriptors,
+		})
+	}
+
+	if pcrPID, ok := r.pidMap[src.pcrPID]; ok {
+		dst.pcrPID = pcrPID
+	}
+
+	return dst
+}
+
+type programParent interface {
+	logger.Writer
+	push(unit []queuedPacket)
+	setPMT(pr *program, p pmt)
+}
+
+// program reads a path and muxes it as a program of the MPTS.
+type program struct {
+	conf        conf.MPTSProgram
+	pathManager outputPathManager
+	parent      programParent
+
+	ctx       context.Context
+	ctxCancel func()
+	chClose   chan struct{}
+	done      chan struct{}
+
+	// protected by Output.mutex
+	pmtSection []byte
+	pmtVersion uint8
+}
+
+func (pr *program) initialize() {
+	pr.ctx, pr.ctxCancel = context.WithCancel(context.Background())
+	pr.chClose = make(chan struct{}, 1)
+	pr.done = make(chan struct{})
+
+	pr.pmtSection = pmt{pcrPID: pidNull}.marshal(uint16(pr.conf.ProgramNumber), 0)
+
+	go pr.run()
+}
+
+func (pr *program) close() {
+	pr.ctxCancel()
+	<-pr.done
+}
+
+// Close implements defs.Reader.
+// It is called by the path when the stream is not available anymore.
+func (pr *program) Close() {
+	select {
+	case pr.chClose <- struct{}{}:
+	default:
+	}
+}
+
+// APIReaderDescribe implements defs.Reader.
+func (pr *program) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "mptsProgram",
+		ID:   strconv.Itoa(pr.conf.ProgramNumber),
+	}
+}
+
+// Log implements logger.Writer.
+func (pr *program) Log(level logger.Level, format string, args ...interface{}) {
+	pr.parent.Log(level, "[program %d] "+format, append([]interface{}{pr.conf.ProgramNumber}, args...)...)
+}
+
+func (pr *program) run() {
+	defer close(pr.done)
+
+	var lastErr string
+
+	for {
+		err := pr.runInner()
+
+		// advertise the program without elementary streams
+		pr.parent.setPMT(pr, pmt{pcrPID: pidNull})
+
+		if pr.ctx.Err() != nil {
+			return
+		}
+
+		// do not flood logs when the path is not available for a long time
+		if err.Error() != lastErr {
+			lastErr = err.Error()
+			pr.Log(logger.Info, "not reading: %v", err)
+		}
+
+		select {
+		case <-time.After(retryPause):
+		case <-pr.ctx.Done():
+			return
+		}
+	}
+}
+
+func (pr *program) runInner() error {
+	// discard close requests belonging to previous readings
+	select {
+	case <-pr.chClose:
+	default:
+	}
+
+	path, strm, err := pr.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: pr,
+		AccessRequest: defs.PathAccessRequest{
+			Name:     pr.conf.Path,
+			SkipAuth: true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: pr})
+
+	r := &remuxer{
+		pids: pr.conf.PIDs,
+		onPMT: func(p pmt) {
+			pr.parent.setPMT(pr, p)
+		},
+		onUnit: pr.parent.push,
+		log:    pr,
+	}
+	r.initialize()
+
+	bw := bufio.NewWriterSize(r, tsPacketSize*packetsPerDatagram)
+
+	err = mpegts.FromStream(strm, pr, bw, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	pr.Log(logger.Info, "is reading from path '%s', %s",
+		path.Name(), defs.FormatsInfo(strm.ReaderFormats(pr)))
+
+	strm.StartReader(pr)
+	defer strm.RemoveReader(pr)
+
+	select {
+	case <-pr.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case <-pr.chClose:
+		return fmt.Errorf("stream is not available anymore")
+
+	case err = <-strm.ReaderError(pr):
+		return err
+	}
+}
@@ -0,0 +1,349 @@
+package mpts
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	tsPacketSize = 188
+	syncByte     = 0x47
+
+	pidPAT  = 0x0000
+	pidSDT  = 0x0011
+	pidNull = 0x1FFF
+
+	tableIDPAT = 0x00
+	tableIDPMT = 0x02
+	tableIDSDT = 0x42
+
+	descriptorTagService = 0x48
+	serviceTypeDigitalTV = 0x01
+	runningStatusRunning = 0x04
+
+	pcrClockRate = 27000000
+	pcrWrap      = (1 << 33) * 300
+)
+
+var crc32Table = func() [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		crc := uint32(i) << 24
+		for range 8 {
+			if (crc & 0x80000000) != 0 {
+				crc = (crc << 1) ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+		t[i] = crc
+	}
+	return t
+}()
+
+// crc32MPEG2 computes the CRC used by PSI sections.
+func crc32MPEG2(b []byte) uint32 {
+	crc := uint32(0xFFFFFFFF)
+	for _, v := range b {
+		crc = (crc << 8) ^ crc32Table[byte(crc>>24)^v]
+	}
+	return crc
+}
+
+func marshalSection(tableID uint8, tableIDExtension uint16, version uint8, body []byte) []byte {
+	sectionLength := 5 + len(body) + 4
+
+	// section_syntax_indicator is always set,
+	// the following bit is set in DVB tables only.
+	flags := byte(0xB0)
+	if tableID == tableIDSDT {
+		flags = 0xF0
+	}
+
+	buf := make([]byte, 0, 3+sectionLength)
+	buf = append(buf,
+		tableID,
+		flags|byte(sectionLength>>8),
+		byte(sectionLength),
+		byte(tableIDExtension>>8),
+		byte(tableIDExtension),
+		0xC1|((version&0x1F)<<1), // current_next_indicator = 1
+		0,                        // section_number
+		0,                        // last_section_number
+	)
+	buf = append(buf, body...)
+	return binary.BigEndian.AppendUint32(buf, crc32MPEG2(buf))
+}
+
+// unmarshalSection validates a section and returns its table ID and its body.
+func unmarshalSection(buf []byte) (uint8, []byte, error) {
+	if len(buf) < 3 {
+		return 0, nil, fmt.Errorf("section is too short")
+	}
+
+	sectionLength := int(binary.BigEndian.Uint16(buf[1:]) & 0x0FFF)
+	if sectionLength < 9 || len(buf) < 3+sectionLength {
+		return 0, nil, fmt.Errorf("invalid section length")
+	}
+	buf = buf[:3+sectionLength]
+
+	if crc32MPEG2(buf) != 0 {
+		return 0, nil, fmt.Errorf("CRC mismatch")
+	}
+
+	return buf[0], buf[8 : len(buf)-4], nil
+}
+
+type patProgram struct {
+	programNumber uint16
+	pmtPID        uint16
+}
+
+func marshalPAT(transportStreamID uint16, programs []patProgram) []byte {
+	body := make([]byte, 0, 4*len(programs))
+	for _, p := range programs {
+		body = binary.BigEndian.AppendUint16(body, p.programNumber)
+		body = binary.BigEndian.AppendUint16(body, 0xE000|p.pmtPID)
+	}
+	return marshalSection(tableIDPAT, transportStreamID, 0, body)
+}
+
+// unmarshalPATPMTPID returns the PMT PID of the first program in a PAT.
+func unmarshalPATPMTPID(buf []byte) (uint16, error) {
+	tableID, body, err := unmarshalSection(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	if tableID != tableIDPAT {
+		return 0, fmt.Errorf("unexpected table ID: %d", tableID)
+	}
+
+	for len(body) >= 4 {
+		programNumber := binary.BigEndian.Uint16(body)
+		pid := binary.BigEndian.Uint16(body[2:]) & 0x1FFF
+		body = body[4:]
+
+		// program 0 points to the network information table
+		if programNumber != 0 {
+			return pid, nil
+		}
+	}
+
+	return 0, fmt.Errorf("PAT doesn't contain any program")
+}
+
+type pmtStream struct {
+	streamType  uint8
+	pid         uint16
+	descriptors []byte
+}
+
+// pmt is the content of a Program Map Table.
+type pmt struct {
+	pcrPID      uint16
+	programInfo []byte
+	streams     []pmtStream
+}
+
+func (p *pmt) unmarshal(buf []byte) error {
+	tableID, body, err := unmarshalSection(buf)
+	if err != nil {
+		return err
+	}
+
+	if tableID != tableIDPMT {
+		return fmt.Errorf("unexpected table ID: %d", tableID)
+	}
+
+	if len(body) < 4 {
+		return fmt.Errorf("PMT is too short")
+	}
+
+	p.pcrPID = binary.BigEndian.Uint16(body) & 0x1FFF
+	programInfoLength := int(binary.BigEndian.Uint16(body[2:]) & 0x0FFF)
+	body = body[4:]
+
+	if len(body) < programInfoLength {
+		return fmt.Errorf("invalid program info length")
+	}
+	p.programInfo = body[:programInfoLength]
+	body = body[programInfoLength:]
+
+	p.streams = nil
+
+	for len(body) > 0 {
+		if len(body) < 5 {
+			return fmt.Errorf("invalid elementary stream entry")
+		}
+
+		var s pmtStream
+		s.streamType = body[0]
+		s.pid = binary.BigEndian.Uint16(body[1:]) & 0x1FFF
+		esInfoLength := int(binary.BigEndian.Uint16(body[3:]) & 0x0FFF)
+		body = body[5:]
+
+		if len(body) < esInfoLength {
+			return fmt.Errorf("invalid ES info length")
+		}
+		s.descriptors = body[:esInfoLength]
+		body = body[esInfoLength:]
+
+		p.streams = append(p.streams, s)
+	}
+
+	return nil
+}
+
+func (p pmt) marshal(programNumber uint16, version uint8) []byte {
+	body := binary.BigEndian.AppendUint16(nil, 0xE000|p.pcrPID)
+	body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(p.programInfo)))
+	body = append(body, p.programInfo...)
+
+	for _, s := range p.streams {
+		body = append(body, s.streamType)
+		body = binary.BigEndian.AppendUint16(body, 0xE000|s.pid)
+		body = binary.BigEndian.AppendUint16(body, 0xF000|uint16(len(s.descriptors)))
+		body = append(body, s.descriptors...)
+	}
+
+	return marshalSection(tableIDPMT, programNumber, version, body)
+}
+
+type sdtService struct {
+	serviceID uint16
+	provider  string
+	name      string
+}
+
+func marshalSDT(transportStreamID uint16, originalNetworkID uint16, services []sdtService) []byte {
+	body := binary.BigEndian.AppendUint16(nil, originalNetworkID)
+	body = append(body, 0xFF) // reserved_future_use
+
+	for _, s := range services {
+		desc := []byte{
+			descriptorTagService,
+			byte(3 + len(s.provider) + len(s.name)),
+			serviceTypeDigitalTV,
+			byte(len(s.provider)),
+		}
+		desc = append(desc, s.provider...)
+		desc = append(desc, byte(len(s.name)))
+		desc = append(desc, s.name...)
+
+		body = binary.BigEndian.AppendUint16(body, s.serviceID)
+		body = append(body, 0xFC) // EIT_schedule_flag = 0, EIT_present_following_flag = 0
+		body = binary.BigEndian.AppendUint16(body,
+			uint16(runningStatusRunning)<<13|uint16(len(desc)))
+		body = append(body, desc...)
+	}
+
+	return marshalSection(tableIDSDT, transportStreamID, 0, body)
+}
+
+// packetizeSection splits a section into TS packets.
+func packetizeSection(pid uint16, cc *uint8, section []byte) [][]byte {
+	var ret [][]byte
+
+	payload := append([]byte{0}, section...) // pointer_field
+	first := true
+
+	for len(payload) > 0 {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = syncByte
+		pkt[1] = byte(pid>>8) & 0x1F
+		if first {
+			pkt[1] |= 0x40 // payload_unit_start_indicator
+		}
+		pkt[2] = byte(pid)
+		pkt[3] = 0x10 | (*cc & 0x0F) // payload only
+		*cc = (*cc + 1) & 0x0F
+
+		n := copy(pkt[4:], payload)
+		payload = payload[n:]
+
+		for i := 4 + n; i < tsPacketSize; i++ {
+			pkt[i] = 0xFF
+		}
+
+		ret = append(ret, pkt)
+		first = false
+	}
+
+	return ret
+}
+
+var nullPacket = func() []byte {
+	pkt := make([]byte, tsPacketSize)
+	pkt[0] = syncByte
+	pkt[1] = byte(pidNull >> 8)
+	pkt[2] = byte(pidNull & 0xFF)
+	pkt[3] = 0x10
+	for i := 4; i < tsPacketSize; i++ {
+		pkt[i] = 0xFF
+	}
+	return pkt
+}()
+
+func packetPID(pkt []byte) uint16 {
+	return binary.BigEndian.Uint16(pkt[1:]) & 0x1FFF
+}
+
+// packetSection returns the section that starts in a packet.
+func packetSection(pkt []byte) ([]byte, bool) {
+	if (pkt[1] & 0x40) == 0 { // payload_unit_start_indicator
+		return nil, false
+	}
+
+	payload := pkt[4:]
+
+	switch (pkt[3] >> 4) & 0x03 { // adaptation_field_control
+	case 0x01:
+	case 0x03:
+		if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+			return nil, false
+		}
+		payload = payload[1+int(payload[0]):]
+	default:
+		return nil, false
+	}
+
+	if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+		return nil, false
+	}
+
+	return payload[1+int(payload[0]):], true
+}
+
+func packetStartsUnit(pkt []byte) bool {
+	return (pkt[1] & 0x40) != 0 // payload_unit_start_indicator
+}
+
+// packetPCR returns the PCR of a packet, in 27MHz units.
+func packetPCR(pkt []byte) (uint64, bool) {
+	if (pkt[3]&0x20) == 0 || // adaptation_field_control
+		pkt[4] < 7 || // adaptation_field_length
+		(pkt[5]&0x10) == 0 { // PCR_flag
+		return 0, false
+	}
+
+	base := uint64(pkt[6])<<25 | uint64(pkt[7])<<17 | uint64(pkt[8])<<9 |
+		uint64(pkt[9])<<1 | uint64(pkt[10])>>7
+	ext := uint64(pkt[10]&0x01)<<8 | uint64(pkt[11])
+
+	return base*300 + ext, true
+}
+
+// setPacketPCR sets the PCR of a packet that already contains one.
+func setPacketPCR(pkt []byte, pcr uint64) {
+	pcr %= pcrWrap
+	base := pcr / 300
+	ext := pcr % 300
+
+	pkt[6] = byte(base >> 25)
+	pkt[7] = byte(base >> 17)
+	pkt[8] = byte(base >> 9)
+	pkt[9] = byte(base >> 1)
+	pkt[10] = byte(base<<7) | 0x7E | byte(ext>>8)
+	pkt[11] = byte(ext)
+}
@@ -0,0 +1,69 @@
+package playback
+
+import (
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+)
+
+// muxerExportPath writes video tracks of a path into a muxer
+// that is shared between several paths, remapping track IDs.
+type muxerExportPath struct {
+	m      muxer
+	nextID *int
+
+	trackIDs map[int]int
+	curTrack int
+}
+
+func (w *muxerExportPath) writeInit(init *fmp4.Init) {
+	w.trackIDs = make(map[int]int)
+
+	init2 := &fmp4.Init{}
+
+	for _, track := range init.Tracks {
+		if !track.Codec.IsVideo() {
+			continue
+		}
+
+		*w.nextID++
+		w.trackIDs[track.ID] = *w.nextID
+
+		init2.Tracks = append(init2.Tracks, &fmp4.InitTrack{
+			ID:        *w.nextID,
+			TimeScale: track.TimeScale,
+			Codec:     track.Codec,
+		})
+	}
+
+	w.m.writeInit(init2)
+}
+
+func (w *muxerExportPath) setTrack(trackID int) {
+	w.curTrack = w.trackIDs[trackID]
+	if w.curTrack != 0 {
+		w.m.setTrack(w.curTrack)
+	}
+}
+
+func (w *muxerExportPath) writeSample(
+	dts int64,
+	ptsOffset int32,
+	isNonSyncSample bool,
+	payloadSize uint32,
+	getPayload func() ([]byte, error),
+) error {
+	if w.curTrack == 0 {
+		return nil
+	}
+
+	return w.m.writeSample(dts, ptsOffset, isNonSyncSample, payloadSize, getPayload)
+}
+
+func (w *muxerExportPath) writeFinalDTS(dts int64) {
+	if w.curTrack != 0 {
+		w.m.writeFinalDTS(dts)
+	}
+}
+
+func (w *muxerExportPath) flush() error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package playback
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
@@ -29,17 +31,17 @@ type muxerMP4 struct {
 	curTrack *muxerMP4Track
 }
 
+// writeInit adds tracks to the muxer.
+// It can be called multiple times in order to mux several streams together.
 func (w *muxerMP4) writeInit(init *fmp4.Init) {
-	w.tracks = make([]*muxerMP4Track, len(init.Tracks))
-
-	for i, track := range init.Tracks {
-		w.tracks[i] = &muxerMP4Track{
+	for _, track := range init.Tracks {
+		w.tracks = append(w.tracks, &muxerMP4Track{
 			Track: pmp4.Track{
 				ID:        track.ID,
 				TimeScale: track.TimeScale,
 				Codec:     track.Codec,
 			},
-		}
+		})
 	}
 }
 
@@ -96,17 +98,131 @@ func (w *muxerMP4) writeFinalDTS(dts int64) {
 }
 
 func (w *muxerMP4) flush() error {
-	if len(w.curTrack.Samples) == 0 || w.curTrack.lastDTS < 0 {
-		return recordstore.ErrNoSegmentsFound
+	l, err := w.layout()
+	if err != nil {
+		return err
+	}
+
+	return l.writeRange(w.w, 0, l.size)
+}
+
+// layout computes the final layout of the file, without reading sample payloads.
+func (w *muxerMP4) layout() (*muxerMP4Layout, error) {
+	empty := true
+	for _, track := range w.tracks {
+		if len(track.Samples) != 0 && track.lastDTS >= 0 {
+			empty = false
+			break
+		}
+	}
+
+	if empty {
+		return nil, recordstore.ErrNoSegmentsFound
 	}
 
 	h := pmp4.Presentation{
 		Tracks: make([]*pmp4.Track, len(w.tracks)),
 	}
 
+	l := &muxerMP4Layout{}
+	var getPayloads []func() ([]byte, error)
+
+	// replace payloads with empty ones, in order to obtain the header
+	// and the order in which samples are placed inside mdat.
 	for i, track := range w.tracks {
 		h.Tracks[i] = &track.Track
+
+		for _, sa := range track.Samples {
+			getPayload := sa.GetPayload
+			payloadSize := sa.PayloadSize
+			getPayloads = append(getPayloads, getPayload)
+
+			sa.GetPayload = func() ([]byte, error) {
+				l.samples = append(l.samples, muxerMP4LayoutSample{
+					payloadSize: payloadSize,
+					getPayload:  getPayload,
+				})
+				return nil, nil
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := h.Marshal(&buf)
+
+	// restore payloads
+	i := 0
+	for _, track := range w.tracks {
+		for _, sa := range track.Samples {
+			sa.GetPayload = getPayloads[i]
+			i++
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.header = buf.Bytes()
+	l.size = int64(len(l.header))
+	for _, sa := range l.samples {
+		l.size += int64(sa.payloadSize)
 	}
 
-	return h.Marshal(w.w)
+	return l, nil
+}
+
+type muxerMP4LayoutSample struct {
+	payloadSize uint32
+	getPayload  func() ([]byte, error)
+}
+
+// muxerMP4Layout is the final layout of a MP4 file.
+// It allows to write arbitrary byte ranges of the file.
+type muxerMP4Layout struct {
+	header  []byte // ftyp, moov and mdat header
+	samples []muxerMP4LayoutSample
+	size    int64
+}
+
+// writeRange writes bytes in the interval [start, end).
+// Only payloads of samples inside the interval are read.
+func (l *muxerMP4Layout) writeRange(w io.Writer, start int64, end int64) error {
+	pos := int64(0)
+
+	if start < int64(len(l.header)) {
+		_, err := w.Write(l.header[start:min(end, int64(len(l.header)))])
+		if err != nil {
+			return err
+		}
+	}
+	pos += int64(len(l.header))
+
+	for _, sa := range l.samples {
+		if pos >= end {
+			break
+		}
+
+		saEnd := pos + int64(sa.payloadSize)
+
+		if saEnd > start {
+			pl, err := sa.getPayload()
+			if err != nil {
+				return err
+			}
+
+			if int64(len(pl)) != int64(sa.payloadSize) {
+				return fmt.Errorf("payload size changed")
+			}
+
+			_, err = w.Write(pl[max(start-pos, 0):min(end-pos, int64(len(pl)))])
+			if err != nil {
+				return err
+			}
+		}
+
+		pos = saEnd
+	}
+
+	return nil
 }
@@ -0,0 +1,203 @@
+package playback
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+const (
+	exportMaxPaths = 16
+)
+
+type exportPath struct {
+	name     string
+	conf     *conf.Path
+	segments []*recordstore.Segment
+}
+
+// zipEntryWriter creates a ZIP entry when the first byte is written,
+// in order to skip entries of paths without recordings.
+type zipEntryWriter struct {
+	zw     *zip.Writer
+	header *zip.FileHeader
+	w      io.Writer
+}
+
+func (w *zipEntryWriter) Write(p []byte) (int, error) {
+	if w.w == nil {
+		var err error
+		w.w, err = w.zw.CreateHeader(w.header)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.w.Write(p)
+}
+
+func (s *Server) onExport(ctx *gin.Context) {
+	pathNames := ctx.QueryArray("path")
+
+	if len(pathNames) == 0 {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("no paths provided"))
+		return
+	}
+
+	if len(pathNames) > exportMaxPaths {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("maximum number of paths is %d", exportMaxPaths))
+		return
+	}
+
+	for _, pathName := range pathNames {
+		if !s.doAuth(ctx, pathName) {
+			return
+		}
+	}
+
+	start, err := time.Parse(time.RFC3339, ctx.Query("start"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid start: %w", err))
+		return
+	}
+
+	duration, err := parseDuration(ctx.Query("duration"))
+	if err != nil {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid duration: %w", err))
+		return
+	}
+
+	format := ctx.Query("format")
+	if format != "" && format != "mp4" && format != "zip" {
+		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
+		return
+	}
+
+	end := start.Add(duration)
+	var paths []*exportPath
+
+	for _, pathName := range pathNames {
+		pathConf, err := s.safeFindPathConf(pathName)
+		if err != nil {
+			s.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		segments, err := s.RecordIndex.FindSegments(pathConf, pathName, &start, &end)
+		if err != nil {
+			// skip paths without recordings
+			if errors.Is(err, recordstore.ErrNoSegmentsFound) || errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			s.writeError(ctx, http.StatusBadRequest, err)
+			return
+		}
+
+		paths = append(paths, &exportPath{
+			name:     pathName,
+			conf:     pathConf,
+			segments: segments,
+		})
+	}
+
+	if len(paths) == 0 {
+		s.writeError(ctx, http.StatusNotFound, recordstore.ErrNoSegmentsFound)
+		return
+	}
+
+	if format == "zip" {
+		s.exportZIP(ctx, paths, start, duration)
+	} else {
+		s.exportMP4(ctx, paths, start, duration)
+	}
+}
+
+// exportMP4 writes a single MP4 file with the video tracks of all paths.
+// Tracks are aligned on absolute timestamps.
+func (s *Server) exportMP4(
+	ctx *gin.Context,
+	paths []*exportPath,
+	start time.Time,
+	duration time.Duration,
+) {
+	ww := &writerWrapper{ctx: ctx}
+	m := &muxerMP4{w: ww}
+
+	var files segmentFiles
+	defer files.close()
+
+	nextID := 0
+
+	err := func() error {
+		for _, pa := range paths {
+			err := muxSegments(pa.conf.RecordFormat, pa.segments, start, duration,
+				&muxerExportPath{m: m, nextID: &nextID}, &files)
+			if err != nil {
+				return fmt.Errorf("%s: %w", pa.name, err)
+			}
+		}
+
+		return m.flush()
+	}()
+	if err != nil {
+		s.writeMuxError(ctx, ww.written, err)
+	}
+}
+
+// exportZIP writes a ZIP archive with a MP4 file for each path.
+func (s *Server) exportZIP(
+	ctx *gin.Context,
+	paths []*exportPath,
+	start time.Time,
+	duration time.Duration,
+) {
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", `attachment; filename="export.zip"`)
+
+	zw := zip.NewWriter(ctx.Writer)
+	written := false
+
+	for _, pa := range paths {
+		ew := &zipEntryWriter{
+			zw: zw,
+			header: &zip.FileHeader{
+				Name:     pa.name + ".mp4",
+				Method:   zip.Store,
+				Modified: start,
+			},
+		}
+
+		err := seekAndMux(pa.conf.RecordFormat, pa.segments, start, duration, &muxerMP4{w: ew})
+		if ew.w != nil {
+			written = true
+		}
+
+		if err != nil {
+			// skip paths without samples in the time range
+			if errors.Is(err, recordstore.ErrNoSegmentsFound) && ew.w == nil {
+				continue
+			}
+
+			s.writeMuxError(ctx, written, fmt.Errorf("%s: %w", pa.name, err))
+			return
+		}
+	}
+
+	if !written {
+		s.writeError(ctx, http.StatusNotFound, recordstore.ErrNoSegmentsFound)
+		return
+	}
+
+	err := zw.Close()
+	if err != nil {
+		s.writeMuxError(ctx, true, err)
+	}
+}
@@ -1,12 +1,15 @@
 package playback
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
@@ -40,6 +43,27 @@ func parseDuration(raw string) (time.Duration, error) {
 	return time.ParseDuration(raw)
 }
 
+// segmentFiles is a list of open segment files.
+// Files are kept open until the muxer is flushed,
+// since muxers may read payloads lazily.
+type segmentFiles []*os.File
+
+func (sf *segmentFiles) open(fpath string) (*os.File, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	*sf = append(*sf, f)
+	return f, nil
+}
+
+func (sf segmentFiles) close() {
+	for _, f := range sf {
+		f.Close()
+	}
+}
+
 func seekAndMux(
 	recordFormat conf.RecordFormat,
 	segments []*recordstore.Segment,
@@ -47,69 +71,144 @@ func seekAndMux(
 	duration time.Duration,
 	m muxer,
 ) error {
-	if recordFormat == conf.RecordFormatFMP4 {
-		var firstInit *fmp4.Init
-		var segmentEnd time.Time
+	var files segmentFiles
+	defer files.close()
+
+	err := muxSegments(recordFormat, segments, start, duration, m, &files)
+	if err != nil {
+		return err
+	}
+
+	return m.flush()
+}
+
+// muxSegments writes segments into a muxer, without flushing it.
+func muxSegments(
+	recordFormat conf.RecordFormat,
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+	m muxer,
+	files *segmentFiles,
+) error {
+	var readHeader func(r io.ReadSeeker) (*fmp4.Init, time.Duration, error)
+	var muxSegment func(
+		r readSeekerAt,
+		dtsOffset time.Duration,
+		duration time.Duration,
+		tracks []*fmp4.InitTrack,
+		m muxer,
+	) (time.Duration, error)
+
+	switch recordFormat {
+	case conf.RecordFormatFMP4:
+		readHeader = segmentFMP4ReadHeader
+		muxSegment = segmentFMP4MuxParts
+
+	case conf.RecordFormatMKV:
+		readHeader = segmentMKVReadHeader
+		muxSegment = segmentMKVMuxBlocks
+
+	default:
+		return fmt.Errorf("MPEG-TS format is not supported yet")
+	}
+
+	var firstInit *fmp4.Init
+	var segmentEnd time.Time
 
-		f, err := os.Open(segments[0].Fpath)
+	f, err := files.open(segments[0].Fpath)
+	if err != nil {
+		return err
+	}
+
+	firstInit, _, err = readHeader(f)
+	if err != nil {
+		return err
+	}
+
+	m.writeInit(firstInit)
+
+	segmentStartOffset := segments[0].Start.Sub(start) // this is negative
+
+	segmentDuration, err := muxSegment(f, segmentStartOffset, duration, firstInit.Tracks, m)
+	if err != nil {
+		return err
+	}
+
+	segmentEnd = start.Add(segmentDuration)
+
+	for _, seg := range segments[1:] {
+		f, err = files.open(seg.Fpath)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
 
-		firstInit, _, err = segmentFMP4ReadHeader(f)
+		var init *fmp4.Init
+		init, _, err = readHeader(f)
 		if err != nil {
 			return err
 		}
 
-		m.writeInit(firstInit)
+		if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
+			break
+		}
 
-		segmentStartOffset := segments[0].Start.Sub(start) // this is negative
+		segmentStartOffset := seg.Start.Sub(start) // this is positive
 
-		segmentDuration, err := segmentFMP4MuxParts(f, segmentStartOffset, duration, firstInit.Tracks, m)
+		var segmentDuration time.Duration
+		segmentDuration, err = muxSegment(f, segmentStartOffset, duration, firstInit.Tracks, m)
 		if err != nil {
 			return err
 		}
 
 		segmentEnd = start.Add(segmentDuration)
+	}
 
-		for _, seg := range segments[1:] {
-			f, err = os.Open(seg.Fpath)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
-
-			var init *fmp4.Init
-			init, _, err = segmentFMP4ReadHeader(f)
-			if err != nil {
-				return err
-			}
+	return nil
+}
 
-			if !segmentFMP4CanBeConcatenated(firstInit, segmentEnd, init, seg.Start) {
-				break
-			}
+// parseRange parses a HTTP Range header.
+// It returns the interval [start, end) and whether a range was requested.
+// Multiple ranges are not supported and cause the whole file to be returned.
+func parseRange(raw string, size int64) (int64, int64, bool, error) {
+	if raw == "" {
+		return 0, size, false, nil
+	}
 
-			segmentStartOffset := seg.Start.Sub(start) // this is positive
+	spec, ok := strings.CutPrefix(raw, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, false, nil
+	}
 
-			var segmentDuration time.Duration
-			segmentDuration, err = segmentFMP4MuxParts(f, segmentStartOffset, duration, firstInit.Tracks, m)
-			if err != nil {
-				return err
-			}
+	startStr, endStr, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false, fmt.Errorf("invalid range")
+	}
 
-			segmentEnd = start.Add(segmentDuration)
+	// suffix range
+	if startStr == "" {
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, fmt.Errorf("invalid range")
 		}
+		return max(size-n, 0), size, true, nil
+	}
 
-		err = m.flush()
-		if err != nil {
-			return err
-		}
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, fmt.Errorf("invalid range")
+	}
+
+	if endStr == "" {
+		return start, size, true, nil
+	}
 
-		return nil
+	end, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false, fmt.Errorf("invalid range")
 	}
 
-	return fmt.Errorf("MPEG-TS format is not supported yet")
+	return start, min(end+1, size), true, nil
 }
 
 func (s *Server) onGet(ctx *gin.Context) {
@@ -131,18 +230,8 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	ww := &writerWrapper{ctx: ctx}
-	var m muxer
-
 	format := ctx.Query("format")
-	switch format {
-	case "", "fmp4":
-		m = &muxerFMP4{w: ww}
-
-	case "mp4":
-		m = &muxerMP4{w: ww}
-
-	default:
+	if format != "" && format != "fmp4" && format != "mp4" {
 		s.writeError(ctx, http.StatusBadRequest, fmt.Errorf("invalid format: %s", format))
 		return
 	}
@@ -154,7 +243,7 @@ func (s *Server) onGet(ctx *gin.Context) {
 	}
 
 	end := start.Add(duration)
-	segments, err := recordstore.FindSegments(pathConf, pathName, &start, &end)
+	segments, err := s.RecordIndex.FindSegments(pathConf, pathName, &start, &end)
 	if err != nil {
 		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
 			s.writeError(ctx, http.StatusNotFound, err)
@@ -164,26 +253,101 @@ func (s *Server) onGet(ctx *gin.Context) {
 		return
 	}
 
-	err = seekAndMux(pathConf.RecordFormat, segments, start, duration, m)
+	if format == "mp4" {
+		s.getMP4(ctx, pathConf.RecordFormat, segments, start, duration)
+		return
+	}
+
+	ww := &writerWrapper{ctx: ctx}
+
+	err = seekAndMux(pathConf.RecordFormat, segments, start, duration, &muxerFMP4{w: ww})
 	if err != nil {
-		// user aborted the download
-		var neterr *net.OpError
-		if errors.As(err, &neterr) {
-			return
-		}
+		s.writeMuxError(ctx, ww.written, err)
+	}
+}
+
+// getMP4 writes a MP4 file.
+// Since the layout of the file is computed before writing it,
+// byte ranges can be served without buffering the file.
+func (s *Server) getMP4(
+	ctx *gin.Context,
+	recordFormat conf.RecordFormat,
+	segments []*recordstore.Segment,
+	start time.Time,
+	duration time.Duration,
+) {
+	var files segmentFiles
+	defer files.close()
+
+	m := &muxerMP4{}
+
+	err := muxSegments(recordFormat, segments, start, duration, m, &files)
+	if err != nil {
+		s.writeMuxError(ctx, false, err)
+		return
+	}
+
+	l, err := m.layout()
+	if err != nil {
+		s.writeMuxError(ctx, false, err)
+		return
+	}
+
+	// the header depends on every sample, therefore it can be used
+	// to detect whether the file has changed between requests.
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(l.header))
 
-		// nothing has been written yet; send back JSON
-		if !ww.written {
-			if errors.Is(err, recordstore.ErrNoSegmentsFound) {
-				s.writeError(ctx, http.StatusNotFound, err)
-			} else {
-				s.writeError(ctx, http.StatusBadRequest, err)
-			}
+	ctx.Header("Accept-Ranges", "bytes")
+	ctx.Header("ETag", etag)
+
+	rangeStart, rangeEnd := int64(0), l.size
+	partial := false
+
+	if ifRange := ctx.GetHeader("If-Range"); ifRange == "" || ifRange == etag {
+		rangeStart, rangeEnd, partial, err = parseRange(ctx.GetHeader("Range"), l.size)
+		if err != nil {
+			ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", l.size))
+			s.writeError(ctx, http.StatusRequestedRangeNotSatisfiable, err)
 			return
 		}
+	}
+
+	ctx.Header("Content-Type", "video/mp4")
+	ctx.Header("Content-Length", strconv.FormatInt(rangeEnd-rangeStart, 10))
+
+	if partial {
+		ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rangeStart, rangeEnd-1, l.size))
+		ctx.Status(http.StatusPartialContent)
+	} else {
+		ctx.Status(http.StatusOK)
+	}
 
-		// something has already been written: abort and write logs only
-		s.Log(logger.Error, err.Error())
+	err = l.writeRange(ctx.Writer, rangeStart, rangeEnd)
+	if err != nil {
+		s.writeMuxError(ctx, true, err)
+	}
+}
+
+func (s *Server) writeMuxError(ctx *gin.Context, written bool, err error) {
+	// user aborted the download
+	var neterr *net.OpError
+	if errors.As(err, &neterr) {
+		return
+	}
+
+	// nothing has been written yet; send back JSON
+	if !written {
+		ctx.Header("Content-Type", "")
+		ctx.Header("Content-Disposition", "")
+
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			s.writeError(ctx, http.StatusNotFound, err)
+		} else {
+			s.writeError(ctx, http.StatusBadRequest, err)
+		}
 		return
 	}
+
+	// something has already been written: abort and write logs only
+	s.Log(logger.Error, err.Error())
 }
@@ -28,14 +28,21 @@ type parsedSegment struct {
 	duration time.Duration
 }
 
-func parseSegment(seg *recordstore.Segment) (*parsedSegment, error) {
+func parseSegment(recordFormat conf.RecordFormat, seg *recordstore.Segment) (*parsedSegment, error) {
 	f, err := os.Open(seg.Fpath)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	init, duration, err := segmentFMP4ReadHeader(f)
+	var init *fmp4.Init
+	var duration time.Duration
+
+	if recordFormat == conf.RecordFormatMKV {
+		init, duration, err = segmentMKVReadHeader(f)
+	} else {
+		init, duration, err = segmentFMP4ReadHeader(f)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -43,7 +50,11 @@ func parseSegment(seg *recordstore.Segment) (*parsedSegment, error) {
 	// if duration is not present in the header, compute it
 	// by parsing each part
 	if duration == 0 {
-		duration, err = segmentFMP4ReadDurationFromParts(f, init)
+		if recordFormat == conf.RecordFormatMKV {
+			duration, err = segmentMKVReadDurationFromBlocks(f, init)
+		} else {
+			duration, err = segmentFMP4ReadDurationFromParts(f, init)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +67,7 @@ func parseSegment(seg *recordstore.Segment) (*parsedSegment, error) {
 	}, nil
 }
 
-func parseSegments(segments []*recordstore.Segment) ([]*parsedSegment, error) {
+func parseSegments(recordFormat conf.RecordFormat, segments []*recordstore.Segment) ([]*parsedSegment, error) {
 	parsed := make([]*parsedSegment, len(segments))
 	ch := make(chan error)
 
@@ -66,7 +77,7 @@ func parseSegments(segments []*recordstore.Segment) ([]*parsedSegment, error) {
 	for i, seg := range segments {
 		go func(i int, seg *recordstore.Segment) {
 			var err error
-			parsed[i], err = parseSegment(seg)
+			parsed[i], err = parseSegment(recordFormat, seg)
 			ch <- err
 		}(i, seg)
 	}
@@ -119,8 +130,8 @@ func parseAndConcatenate(
 	recordFormat conf.RecordFormat,
 	segments []*recordstore.Segment,
 ) ([]listEntry, error) {
-	if recordFormat == conf.RecordFormatFMP4 {
-		parsed, err := parseSegments(segments)
+	if recordFormat == conf.RecordFormatFMP4 || recordFormat == conf.RecordFormatMKV {
+		parsed, err := parseSegments(recordFormat, segments)
 		if err != nil {
 			return nil, err
 		}
@@ -169,7 +180,7 @@ func (s *Server) onList(ctx *gin.Context) {
 		end = &tmp
 	}
 
-	segments, err := recordstore.FindSegments(pathConf, pathName, start, end)
+	segments, err := s.RecordIndex.FindSegments(pathConf, pathName, start, end)
 	if err != nil {
 		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
 			s.writeError(ctx, http.StatusNotFound, err)
@@ -0,0 +1,253 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/mkv"
+)
+
+func mkvTimeScale(codec mp4.Codec) uint32 {
+	switch codec := codec.(type) {
+	case *mp4.CodecOpus:
+		return 48000
+
+	case *mp4.CodecMPEG4Audio:
+		return uint32(codec.SampleRate)
+
+	case *mp4.CodecAC3:
+		return uint32(codec.SampleRate)
+
+	case *mp4.CodecLPCM:
+		return uint32(codec.SampleRate)
+
+	default:
+		return 90000
+	}
+}
+
+func segmentMKVReadHeader(r io.ReadSeeker) (*fmp4.Init, time.Duration, error) {
+	mr := &mkv.Reader{R: r}
+	err := mr.Initialize()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	init := &fmp4.Init{}
+
+	for _, track := range mr.Header.Tracks {
+		init.Tracks = append(init.Tracks, &fmp4.InitTrack{
+			ID:        int(track.Number),
+			TimeScale: mkvTimeScale(track.Codec),
+			Codec:     track.Codec,
+		})
+	}
+
+	return init, mr.Header.Duration, nil
+}
+
+type segmentMKVTrackBlock struct {
+	*mkv.BlockInfo
+	dts time.Duration
+}
+
+type segmentMKVBlocks struct {
+	all     []*segmentMKVTrackBlock
+	byTrack map[int][]*segmentMKVTrackBlock
+	end     time.Duration
+}
+
+// segmentMKVReadBlocks reads all blocks and computes their DTS.
+// Matroska stores PTS only: DTS is rebuilt by sorting PTS
+// and by shifting them in order not to exceed PTS.
+func segmentMKVReadBlocks(
+	r io.ReadSeeker,
+	init *fmp4.Init,
+) (*segmentMKVBlocks, error) {
+	mr := &mkv.Reader{R: r}
+	err := mr.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*segmentMKVTrackBlock
+	byTrack := make(map[int][]*segmentMKVTrackBlock)
+
+	err = mr.ReadBlocks(func(bi *mkv.BlockInfo) error {
+		if findInitTrack(init.Tracks, int(bi.TrackNumber)) == nil {
+			return fmt.Errorf("invalid track number: %v", bi.TrackNumber)
+		}
+
+		b := &segmentMKVTrackBlock{BlockInfo: bi}
+		blocks = append(blocks, b)
+		byTrack[int(bi.TrackNumber)] = append(byTrack[int(bi.TrackNumber)], b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, trackBlocks := range byTrack {
+		sorted := make([]time.Duration, len(trackBlocks))
+		for i, b := range trackBlocks {
+			sorted[i] = b.Timestamp
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		var delay time.Duration
+		for i, b := range trackBlocks {
+			if d := sorted[i] - b.Timestamp; d > delay {
+				delay = d
+			}
+		}
+
+		for i, b := range trackBlocks {
+			b.dts = sorted[i] - delay
+		}
+	}
+
+	// use the duration in the header when available,
+	// otherwise the end of the longest track.
+	end := mr.Header.Duration
+	if end == 0 {
+		for _, trackBlocks := range byTrack {
+			if l := len(trackBlocks); l >= 2 {
+				trackEnd := 2*trackBlocks[l-1].dts - trackBlocks[l-2].dts
+				if trackEnd > end {
+					end = trackEnd
+				}
+			}
+		}
+	}
+
+	return &segmentMKVBlocks{
+		all:     blocks,
+		byTrack: byTrack,
+		end:     end,
+	}, nil
+}
+
+// trackEnd returns the end of a track,
+// computed by adding the duration of the second-last sample to the last sample.
+func (sb *segmentMKVBlocks) trackEnd(trackBlocks []*segmentMKVTrackBlock) time.Duration {
+	l := len(trackBlocks)
+	end := trackBlocks[l-1].dts
+
+	if l >= 2 {
+		end += trackBlocks[l-1].dts - trackBlocks[l-2].dts
+	} else if sb.end > end {
+		end = sb.end
+	}
+
+	return end
+}
+
+func segmentMKVReadDurationFromBlocks(
+	r io.ReadSeeker,
+	init *fmp4.Init,
+) (time.Duration, error) {
+	sb, err := segmentMKVReadBlocks(r, init)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(sb.byTrack) == 0 {
+		return 0, fmt.Errorf("no blocks found")
+	}
+
+	var maxElapsed time.Duration
+
+	for _, trackBlocks := range sb.byTrack {
+		if end := sb.trackEnd(trackBlocks); end > maxElapsed {
+			maxElapsed = end
+		}
+	}
+
+	return maxElapsed, nil
+}
+
+func segmentMKVMuxBlocks(
+	r readSeekerAt,
+	dtsOffset time.Duration,
+	duration time.Duration,
+	tracks []*fmp4.InitTrack,
+	m muxer,
+) (time.Duration, error) {
+	sb, err := segmentMKVReadBlocks(r, &fmp4.Init{Tracks: tracks})
+	if err != nil {
+		return 0, err
+	}
+
+	// DTS of the first sample that is not written, for each track
+	finalDTS := make(map[int]time.Duration)
+
+	for _, b := range sb.all {
+		trackID := int(b.TrackNumber)
+
+		if _, ok := finalDTS[trackID]; ok {
+			continue
+		}
+
+		muxerDTS := b.dts + dtsOffset
+		if muxerDTS >= duration {
+			finalDTS[trackID] = muxerDTS
+			continue
+		}
+
+		track := findInitTrack(tracks, trackID)
+		m.setTrack(trackID)
+
+		offset := b.Offset
+		size := b.Size
+
+		err = m.writeSample(
+			durationGoToMp4(muxerDTS, track.TimeScale),
+			int32(durationGoToMp4(b.Timestamp-b.dts, track.TimeScale)),
+			!b.Keyframe,
+			uint32(size),
+			func() ([]byte, error) {
+				payload := make([]byte, size)
+				n, err2 := r.ReadAt(payload, offset)
+				if err2 != nil {
+					return nil, err2
+				}
+				if n != int(size) {
+					return nil, fmt.Errorf("partial read")
+				}
+
+				return payload, nil
+			},
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var maxMuxerDTS time.Duration
+
+	for _, track := range tracks {
+		trackBlocks, ok := sb.byTrack[track.ID]
+		if !ok {
+			continue
+		}
+
+		end, ok := finalDTS[track.ID]
+		if !ok {
+			end = sb.trackEnd(trackBlocks) + dtsOffset
+		}
+
+		m.setTrack(track.ID)
+		m.writeFinalDTS(durationGoToMp4(end, track.TimeScale))
+
+		if end > maxMuxerDTS {
+			maxMuxerDTS = end
+		}
+	}
+
+	return maxMuxerDTS, nil
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
 	"github.com/gin-gonic/gin"
 )
@@ -21,16 +22,21 @@ type serverAuthManager interface {
 
 // Server is the playback server.
 type Server struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.Duration
-	PathConfs      map[string]*conf.Path
-	AuthManager    serverAuthManager
-	Parent         logger.Writer
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	H2C                bool
+	HTTP3              bool
+	ReadTimeout        conf.Duration
+	PathConfs          map[string]*conf.Path
+	RecordIndex        *recordstore.Index
+	AuthManager        serverAuthManager
+	Parent             logger.Writer
 
 	httpServer *httpp.Server
 	mutex      sync.RWMutex
@@ -45,18 +51,23 @@ func (s *Server) Initialize() error {
 
 	router.GET("/list", s.onList)
 	router.GET("/get", s.onGet)
+	router.GET("/export", s.onExport)
 
 	network, address := restrictnetwork.Restrict("tcp", s.Address)
 
 	s.httpServer = &httpp.Server{
-		Network:     network,
-		Address:     address,
-		ReadTimeout: time.Duration(s.ReadTimeout),
-		Encryption:  s.Encryption,
-		ServerCert:  s.ServerCert,
-		ServerKey:   s.ServerKey,
-		Handler:     router,
-		Parent:      s,
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(s.ReadTimeout),
+		Encryption:         s.Encryption,
+		ServerCert:         s.ServerCert,
+		ServerKey:          s.ServerKey,
+		ClientCA:           s.ClientCA,
+		ClientCertRequired: s.ClientCertRequired,
+		H2C:                s.H2C,
+		HTTP3:              s.HTTP3,
+		Handler:            router,
+		Parent:             s,
 	}
 	err := s.httpServer.Initialize()
 	if err != nil {
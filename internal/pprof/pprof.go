@@ -26,15 +26,17 @@ type pprofParent interface {
 
 // PPROF is a pprof exporter.
 type PPROF struct {
-	Address        string
-	Encryption     bool
-	ServerKey      string
-	ServerCert     string
-	AllowOrigin    string
-	TrustedProxies conf.IPNetworks
-	ReadTimeout    conf.Duration
-	AuthManager    pprofAuthManager
-	Parent         pprofParent
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	AuthManager        pprofAuthManager
+	Parent             pprofParent
 
 	httpServer *httpp.Server
 }
@@ -52,14 +54,16 @@ func (pp *PPROF) Initialize() error {
 	network, address := restrictnetwork.Restrict("tcp", pp.Address)
 
 	pp.httpServer = &httpp.Server{
-		Network:     network,
-		Address:     address,
-		ReadTimeout: time.Duration(pp.ReadTimeout),
-		Encryption:  pp.Encryption,
-		ServerCert:  pp.ServerCert,
-		ServerKey:   pp.ServerKey,
-		Handler:     router,
-		Parent:      pp,
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(pp.ReadTimeout),
+		Encryption:         pp.Encryption,
+		ServerCert:         pp.ServerCert,
+		ServerKey:          pp.ServerKey,
+		ClientCA:           pp.ClientCA,
+		ClientCertRequired: pp.ClientCertRequired,
+		Handler:            router,
+		Parent:             pp,
 	}
 	err := pp.httpServer.Initialize()
 	if err != nil {
@@ -0,0 +1,21 @@
+package fmp4
+
+import (
+	"github.com/bluenviron/gohlslib/v2/pkg/codecparams"
+	"github.com/bluenviron/gohlslib/v2/pkg/codecs"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+)
+
+// CodecString returns the RFC 6381 codec string of a fMP4 codec,
+// that is used by DASH manifests and by the Media Source Extensions API.
+func CodecString(codec mp4.Codec) string {
+	switch codec.(type) {
+	case *mp4.CodecMPEG1Audio:
+		return "mp4a.6B"
+
+	case *mp4.CodecAC3:
+		return "ac-3"
+	}
+
+	return codecparams.Marshal(codecs.FromFMP4(codec))
+}
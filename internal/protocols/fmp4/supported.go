@@ -0,0 +1,25 @@
+package fmp4
+
+import (
+	"errors"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// ErrNoSupportedCodecs is returned when a stream doesn't contain any format
+// that is supported by IsFormatSupported.
+var ErrNoSupportedCodecs = errors.New(
+	"the stream doesn't contain any supported codec, which are currently " +
+		"AV1, VP9, H265, H264, Opus, MPEG-4 Audio, MPEG-1/2 Audio, AC-3")
+
+// IsFormatSupported returns whether a format can be delivered to browsers
+// inside fMP4 segments. It can be used as filter of FromStream.
+func IsFormatSupported(_ *description.Media, forma format.Format) bool {
+	switch forma.(type) {
+	case *format.AV1, *format.VP9, *format.H265, *format.H264,
+		*format.Opus, *format.MPEG4Audio, *format.MPEG1Audio, *format.AC3:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package fmp4
+
+import (
+	"time"
+)
+
+func multiplyAndDivide(v, m, d int64) int64 {
+	secs := v / d
+	dec := v % d
+	return (secs*m + dec*m/d)
+}
+
+// DurationToTimestamp converts a duration into a timestamp with the given clock rate.
+func DurationToTimestamp(d time.Duration, clockRate uint32) int64 {
+	return multiplyAndDivide(int64(d), int64(clockRate), int64(time.Second))
+}
+
+// TimestampToDuration converts a timestamp with the given clock rate into a duration.
+func TimestampToDuration(t int64, clockRate uint32) time.Duration {
+	return time.Duration(multiplyAndDivide(t, int64(time.Second), int64(clockRate)))
+}
+
+// Timeline is the time origin shared by the tracks of a fMP4 stream.
+// The origin is the DTS of the first sample of any track.
+type Timeline struct {
+	originSet bool
+	originDTS time.Duration
+}
+
+// OriginDTS returns the DTS of the origin.
+func (tl *Timeline) OriginDTS() time.Duration {
+	return tl.originDTS
+}
+
+// TimelineTrack places samples of a track on a Timeline.
+type TimelineTrack struct {
+	Timeline  *Timeline
+	TimeScale uint32
+
+	originSet  bool
+	originTS   int64
+	nextSample *Sample
+}
+
+// Push delays a sample by one, in order to fill the duration of the previous one,
+// that is returned. It returns nil when there's no previous sample.
+func (t *TimelineTrack) Push(sample *Sample) *Sample {
+	sample, t.nextSample = t.nextSample, sample
+	if sample == nil {
+		return nil
+	}
+	sample.Duration = uint32(t.nextSample.DTS - sample.DTS)
+	return sample
+}
+
+// Next returns the sample that has been pushed last.
+func (t *TimelineTrack) Next() *Sample {
+	return t.nextSample
+}
+
+// BaseTime returns the DTS of a sample relative to the origin of the timeline,
+// setting the origin if it's not set yet.
+// It returns false when the sample precedes the origin.
+func (t *TimelineTrack) BaseTime(sample *Sample) (uint64, bool) {
+	if !t.Timeline.originSet {
+		t.Timeline.originSet = true
+		t.Timeline.originDTS = TimestampToDuration(sample.DTS, t.TimeScale)
+	}
+
+	if !t.originSet {
+		t.originSet = true
+		t.originTS = DurationToTimestamp(t.Timeline.originDTS, t.TimeScale)
+	}
+
+	if sample.DTS < t.originTS {
+		return 0, false
+	}
+
+	return uint64(sample.DTS - t.originTS), true
+}
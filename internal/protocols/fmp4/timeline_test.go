@@ -0,0 +1,49 @@
+package fmp4
+
+import (
+	"testing"
+	"time"
+
+	mcfmp4 "github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeline(t *testing.T) {
+	var tl Timeline
+
+	video := &TimelineTrack{Timeline: &tl, TimeScale: 90000}
+	audio := &TimelineTrack{Timeline: &tl, TimeScale: 48000}
+
+	newSample := func(dts int64) *Sample {
+		return &Sample{Sample: &mcfmp4.Sample{}, DTS: dts}
+	}
+
+	require.Nil(t, video.Push(newSample(90000)))
+	require.Nil(t, audio.Push(newSample(47000)))
+
+	s := video.Push(newSample(93000))
+	require.NotNil(t, s)
+	require.Equal(t, uint32(3000), s.Duration)
+	require.Equal(t, int64(93000), video.Next().DTS)
+
+	baseTime, ok := video.BaseTime(s)
+	require.True(t, ok)
+	require.Equal(t, uint64(0), baseTime)
+	require.Equal(t, time.Second, tl.OriginDTS())
+
+	// audio sample that precedes the origin
+	s = audio.Push(newSample(48960))
+	require.Equal(t, uint32(1960), s.Duration)
+	_, ok = audio.BaseTime(s)
+	require.False(t, ok)
+
+	s = audio.Push(newSample(49920))
+	baseTime, ok = audio.BaseTime(s)
+	require.True(t, ok)
+	require.Equal(t, uint64(960), baseTime)
+}
+
+func TestTimestampToDuration(t *testing.T) {
+	require.Equal(t, int64(90000*3600*10), DurationToTimestamp(10*time.Hour, 90000))
+	require.Equal(t, 10*time.Hour, TimestampToDuration(90000*3600*10, 90000))
+}
@@ -5,11 +5,14 @@ import (
 	"strings"
 
 	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 )
 
 // Credentials extracts credentials from a HTTP request.
 func Credentials(h *http.Request) *auth.Credentials {
-	c := &auth.Credentials{}
+	c := &auth.Credentials{
+		ClientCert: tls.VerifiedClientCertificate(h.TLS),
+	}
 
 	for _, auth := range h.Header["Authorization"] {
 		if strings.HasPrefix(auth, "Bearer ") {
@@ -0,0 +1,18 @@
+package httpp
+
+import (
+	"net/http"
+)
+
+// advertise the availability of HTTP/3.
+type handlerAltSvc struct {
+	http.Handler
+	value string
+}
+
+func (h *handlerAltSvc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor < 3 {
+		w.Header().Set("Alt-Svc", h.value)
+	}
+	h.Handler.ServeHTTP(w, r)
+}
@@ -8,10 +8,16 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
 	"github.com/bluenviron/mediamtx/internal/certloader"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	mtls "github.com/bluenviron/mediamtx/internal/protocols/tls"
 )
 
 type nilWriter struct{}
@@ -27,23 +33,36 @@ func (nilWriter) Write(p []byte) (int, error) {
 // - logging
 // - server header
 // - filtering of invalid requests
+// - HTTP/2 without TLS (h2c)
+// - HTTP/3, on the UDP port with the same number of the TCP port
 type Server struct {
-	Network     string
-	Address     string
-	ReadTimeout time.Duration
-	Encryption  bool
-	ServerCert  string
-	ServerKey   string
-	Handler     http.Handler
-	Parent      logger.Writer
+	Network            string
+	Address            string
+	ReadTimeout        time.Duration
+	Encryption         bool
+	ServerCert         string
+	ServerKey          string
+	ClientCA           string
+	ClientCertRequired bool
+	H2C                bool
+	HTTP3              bool
+	Handler            http.Handler
+	Parent             logger.Writer
 
 	ln     net.Listener
 	inner  *http.Server
+	pc     net.PacketConn
+	inner3 *http3.Server
 	loader *certloader.CertLoader
+	done3  chan struct{}
 }
 
 // Initialize initializes a Server.
 func (s *Server) Initialize() error {
+	if s.HTTP3 && !s.Encryption {
+		return fmt.Errorf("HTTP/3 requires encryption")
+	}
+
 	var tlsConfig *tls.Config
 	if s.Encryption {
 		if s.ServerCert == "" {
@@ -60,14 +79,19 @@ func (s *Server) Initialize() error {
 			return err
 		}
 
-		tlsConfig = &tls.Config{
-			GetCertificate: s.loader.GetCertificate(),
+		tlsConfig, err = mtls.ConfigForServer(s.loader.GetCertificate(), s.ClientCA, s.ClientCertRequired)
+		if err != nil {
+			s.loader.Close()
+			return err
 		}
 	}
 
 	var err error
 	s.ln, err = net.Listen(s.Network, s.Address)
 	if err != nil {
+		if s.loader != nil {
+			s.loader.Close()
+		}
 		return err
 	}
 
@@ -78,11 +102,41 @@ func (s *Server) Initialize() error {
 	h = &handlerLogger{h, s.Parent}
 	h = &handlerExitOnPanic{h}
 
+	if s.HTTP3 {
+		// HTTP/3 runs on UDP, on the port with the same number of the TCP port.
+		s.pc, err = net.ListenPacket(strings.Replace(s.Network, "tcp", "udp", 1), s.Address)
+		if err != nil {
+			s.ln.Close()
+			s.loader.Close()
+			return err
+		}
+
+		s.inner3 = &http3.Server{
+			Handler:   h,
+			TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+			QUICConfig: &quic.Config{
+				MaxIdleTimeout:  s.ReadTimeout,
+				KeepAlivePeriod: s.ReadTimeout / 2,
+			},
+		}
+
+		// clients that reached the server through HTTP/1.1 or HTTP/2
+		// are told to switch to HTTP/3.
+		port := s.pc.LocalAddr().(*net.UDPAddr).Port
+		h = &handlerAltSvc{h, "h3=\":" + strconv.Itoa(port) + "\"; ma=86400"}
+	}
+
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(tlsConfig != nil)
+	protocols.SetUnencryptedHTTP2(s.H2C)
+
 	s.inner = &http.Server{
 		Handler:           h,
 		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: s.ReadTimeout,
 		ErrorLog:          log.New(&nilWriter{}, "", 0),
+		Protocols:         protocols,
 	}
 
 	if tlsConfig != nil {
@@ -91,15 +145,30 @@ func (s *Server) Initialize() error {
 		go s.inner.Serve(s.ln)
 	}
 
+	if s.inner3 != nil {
+		s.done3 = make(chan struct{})
+		go s.run3()
+	}
+
 	return nil
 }
 
+func (s *Server) run3() {
+	defer close(s.done3)
+	s.inner3.Serve(s.pc) //nolint:errcheck
+}
+
 // Close closes all resources and waits for all routines to return.
 func (s *Server) Close() {
 	ctx, ctxCancel := context.WithCancel(context.Background())
 	ctxCancel()
 	s.inner.Shutdown(ctx)
 	s.ln.Close() // in case Shutdown() is called before Serve()
+	if s.inner3 != nil {
+		s.inner3.Close()
+		s.pc.Close() // in case Close() is called before Serve()
+		<-s.done3
+	}
 	if s.loader != nil {
 		s.loader.Close()
 	}
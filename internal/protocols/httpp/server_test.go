@@ -1,11 +1,15 @@
 package httpp
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http"
+	"os"
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	"github.com/stretchr/testify/require"
 
 	"github.com/bluenviron/mediamtx/internal/test"
@@ -36,3 +40,140 @@ func TestFilterEmptyPath(t *testing.T) {
 	_, err = io.ReadFull(conn, buf)
 	require.NoError(t, err)
 }
+
+func TestClientCertificate(t *testing.T) {
+	serverCertFpath, err := test.CreateTempFile(test.TLSCertPub)
+	require.NoError(t, err)
+	defer os.Remove(serverCertFpath)
+
+	serverKeyFpath, err := test.CreateTempFile(test.TLSCertKey)
+	require.NoError(t, err)
+	defer os.Remove(serverKeyFpath)
+
+	for _, ca := range []string{"valid", "missing"} {
+		t.Run(ca, func(t *testing.T) {
+			s := &Server{
+				Network:            "tcp",
+				Address:            "localhost:4555",
+				ReadTimeout:        10 * time.Second,
+				Encryption:         true,
+				ServerCert:         serverCertFpath,
+				ServerKey:          serverKeyFpath,
+				ClientCA:           serverCertFpath,
+				ClientCertRequired: true,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if Credentials(r).ClientCert == nil {
+						w.WriteHeader(http.StatusUnauthorized)
+					}
+				}),
+				Parent: test.NilLogger,
+			}
+			err = s.Initialize()
+			require.NoError(t, err)
+			defer s.Close()
+
+			tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+			if ca == "valid" {
+				var cert tls.Certificate
+				cert, err = tls.X509KeyPair(test.TLSCertPub, test.TLSCertKey)
+				require.NoError(t, err)
+				tlsConfig.Certificates = []tls.Certificate{cert}
+			}
+
+			tr := &http.Transport{TLSClientConfig: tlsConfig}
+			defer tr.CloseIdleConnections()
+			hc := &http.Client{Transport: tr}
+
+			res, err := hc.Get("https://localhost:4555/")
+
+			if ca == "valid" {
+				require.NoError(t, err)
+				defer res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestH2C(t *testing.T) {
+	s := &Server{
+		Network:     "tcp",
+		Address:     "localhost:4555",
+		ReadTimeout: 10 * time.Second,
+		H2C:         true,
+		Handler:     http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+		Parent:      test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	tr := &http.Transport{Protocols: protocols}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	res, err := hc.Get("http://localhost:4555/")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, 2, res.ProtoMajor)
+}
+
+func TestHTTP3(t *testing.T) {
+	serverCertFpath, err := test.CreateTempFile(test.TLSCertPub)
+	require.NoError(t, err)
+	defer os.Remove(serverCertFpath)
+
+	serverKeyFpath, err := test.CreateTempFile(test.TLSCertKey)
+	require.NoError(t, err)
+	defer os.Remove(serverKeyFpath)
+
+	s := &Server{
+		Network:     "tcp",
+		Address:     "localhost:4555",
+		ReadTimeout: 10 * time.Second,
+		Encryption:  true,
+		ServerCert:  serverCertFpath,
+		ServerKey:   serverKeyFpath,
+		HTTP3:       true,
+		Handler:     http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+		Parent:      test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	tr := &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}
+	defer tr.CloseIdleConnections()
+	hc := &http.Client{Transport: tr}
+
+	res, err := hc.Get("https://localhost:4555/")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, 2, res.ProtoMajor)
+	require.Equal(t, `h3=":4555"; ma=86400`, res.Header.Get("Alt-Svc"))
+
+	tr3 := &http3.Transport{TLSClientConfig: tlsConfig}
+	defer tr3.Close()
+	hc3 := &http.Client{Transport: tr3}
+
+	res3, err := hc3.Get("https://localhost:4555/")
+	require.NoError(t, err)
+	defer res3.Body.Close()
+
+	require.Equal(t, http.StatusOK, res3.StatusCode)
+	require.Equal(t, 3, res3.ProtoMajor)
+	require.Empty(t, res3.Header.Get("Alt-Svc"))
+	require.Equal(t, "mediamtx", res3.Header.Get("Server"))
+}
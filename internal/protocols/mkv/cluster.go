@@ -0,0 +1,190 @@
+package mkv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	simpleBlockFlagKeyframe = 0x80
+	simpleBlockFlagLacing   = 0x06
+)
+
+// Block is a frame of a track.
+type Block struct {
+	TrackNumber uint64
+	// presentation timestamp, relative to the beginning of the segment
+	Timestamp time.Duration
+	Keyframe  bool
+	Payload   []byte
+}
+
+// Cluster is a group of blocks.
+type Cluster struct {
+	// timestamp of the cluster, relative to the beginning of the segment
+	Timestamp time.Duration
+	Blocks    []*Block
+}
+
+// Marshal encodes a Cluster.
+func (c *Cluster) Marshal(w io.Writer) error {
+	clusterTS := c.Timestamp / TimestampScale
+
+	size := 0
+	for _, b := range c.Blocks {
+		size += len(b.Payload) + 32
+	}
+
+	buf := make([]byte, 0, size)
+	buf = appendUint(buf, idTimestamp, uint64(clusterTS))
+
+	for _, b := range c.Blocks {
+		rel := b.Timestamp/TimestampScale - clusterTS
+		if rel < math.MinInt16 || rel > math.MaxInt16 {
+			return fmt.Errorf("block timestamp is too distant from cluster timestamp")
+		}
+
+		var flags byte
+		if b.Keyframe {
+			flags |= simpleBlockFlagKeyframe
+		}
+
+		var blockHeader []byte
+		blockHeader = appendVint(blockHeader, b.TrackNumber)
+		blockHeader = binary.BigEndian.AppendUint16(blockHeader, uint16(int16(rel)))
+		blockHeader = append(blockHeader, flags)
+
+		buf = appendID(buf, idSimpleBlock)
+		buf = appendVint(buf, uint64(len(blockHeader)+len(b.Payload)))
+		buf = append(buf, blockHeader...)
+		buf = append(buf, b.Payload...)
+	}
+
+	_, err := w.Write(appendElement(nil, idCluster, buf))
+	return err
+}
+
+// BlockInfo contains the position and metadata of a block.
+type BlockInfo struct {
+	TrackNumber uint64
+	// presentation timestamp, relative to the beginning of the segment
+	Timestamp time.Duration
+	Keyframe  bool
+	// position of the payload inside the file
+	Offset int64
+	Size   int64
+}
+
+// ReadBlocks reads the metadata of all blocks of the file, without reading payloads.
+// Reading stops silently when a truncated cluster is found,
+// in order to support files that have not been finalized.
+func (r *Reader) ReadBlocks(cb func(*BlockInfo) error) error {
+	fileSize, err := r.R.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	pos, err := r.R.Seek(r.clustersPos, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	for pos < fileSize {
+		h, err := readElementHeader(r.R)
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+
+		if h.size < 0 || (pos+h.len+h.size) > fileSize {
+			return nil
+		}
+
+		if h.id == idCluster {
+			err = r.readCluster(pos+h.len, h.size, cb)
+			if err != nil {
+				return err
+			}
+		}
+
+		pos, err = r.R.Seek(pos+h.len+h.size, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) readCluster(pos int64, size int64, cb func(*BlockInfo) error) error {
+	end := pos + size
+	var clusterTS int64
+
+	for pos < end {
+		h, err := readElementHeader(r.R)
+		if err != nil {
+			return err
+		}
+
+		if h.size < 0 || (pos+h.len+h.size) > end {
+			return fmt.Errorf("invalid size of element 0x%X", h.id)
+		}
+
+		switch h.id {
+		case idTimestamp:
+			buf, err := readPayload(r.R, h)
+			if err != nil {
+				return err
+			}
+
+			v, err := decodeUint(buf)
+			if err != nil {
+				return err
+			}
+			clusterTS = int64(v)
+
+		case idSimpleBlock:
+			trackNumber, n, err := readVint(r.R, false)
+			if err != nil {
+				return err
+			}
+
+			var buf [3]byte
+			_, err = io.ReadFull(r.R, buf[:])
+			if err != nil {
+				return err
+			}
+
+			if (buf[2] & simpleBlockFlagLacing) != 0 {
+				return fmt.Errorf("lacing is not supported")
+			}
+
+			headerSize := int64(n) + 3
+			if h.size < headerSize {
+				return fmt.Errorf("invalid block size")
+			}
+
+			rel := int64(int16(binary.BigEndian.Uint16(buf[:2])))
+
+			err = cb(&BlockInfo{
+				TrackNumber: trackNumber,
+				Timestamp:   time.Duration(clusterTS+rel) * r.timestampScale,
+				Keyframe:    (buf[2] & simpleBlockFlagKeyframe) != 0,
+				Offset:      pos + h.len + headerSize,
+				Size:        h.size - headerSize,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		pos, err = r.R.Seek(pos+h.len+h.size, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
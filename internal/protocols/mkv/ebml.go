@@ -0,0 +1,274 @@
+package mkv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// element IDs.
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idSegment            = 0x18538067
+	idInfo               = 0x1549A966
+	idTimestampScale     = 0x2AD7B1
+	idDuration           = 0x4489
+	idMuxingApp          = 0x4D80
+	idWritingApp         = 0x5741
+	idTracks             = 0x1654AE6B
+	idTrackEntry         = 0xAE
+	idTrackNumber        = 0xD7
+	idTrackUID           = 0x73C5
+	idTrackType          = 0x83
+	idFlagLacing         = 0x9C
+	idCodecID            = 0x86
+	idCodecPrivate       = 0x63A2
+	idVideo              = 0xE0
+	idPixelWidth         = 0xB0
+	idPixelHeight        = 0xBA
+	idColour             = 0x55B0
+	idRange              = 0x55B9
+	idAudio              = 0xE1
+	idSamplingFrequency  = 0xB5
+	idChannels           = 0x9F
+	idBitDepth           = 0x6264
+	idCluster            = 0x1F43B675
+	idTimestamp          = 0xE7
+	idSimpleBlock        = 0xA3
+)
+
+const (
+	unknownSize    = -1
+	maxElementSize = 16 * 1024 * 1024
+)
+
+func idLen(id uint32) int {
+	switch {
+	case id < 0x100:
+		return 1
+	case id < 0x10000:
+		return 2
+	case id < 0x1000000:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func appendID(buf []byte, id uint32) []byte {
+	for i := idLen(id) - 1; i >= 0; i-- {
+		buf = append(buf, byte(id>>(8*i)))
+	}
+	return buf
+}
+
+func appendVint(buf []byte, v uint64) []byte {
+	n := 1
+	for n < 8 && v >= (1<<(7*n))-1 {
+		n++
+	}
+
+	v |= 1 << (7 * n)
+
+	for i := n - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*i)))
+	}
+	return buf
+}
+
+func appendElement(buf []byte, id uint32, payload []byte) []byte {
+	buf = appendID(buf, id)
+	buf = appendVint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+func appendUint(buf []byte, id uint32, v uint64) []byte {
+	n := 1
+	for n < 8 && v>>(8*n) != 0 {
+		n++
+	}
+
+	payload := make([]byte, n)
+	for i := 0; i < n; i++ {
+		payload[n-1-i] = byte(v >> (8 * i))
+	}
+
+	return appendElement(buf, id, payload)
+}
+
+func appendFloat(buf []byte, id uint32, v float64) []byte {
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, math.Float64bits(v))
+	return appendElement(buf, id, payload)
+}
+
+func appendString(buf []byte, id uint32, v string) []byte {
+	return appendElement(buf, id, []byte(v))
+}
+
+type elementHeader struct {
+	id   uint32
+	size int64
+	len  int64
+}
+
+func readVint(r io.Reader, isID bool) (uint64, int, error) {
+	var first [1]byte
+	_, err := io.ReadFull(r, first[:])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	n := 1
+	for n <= 8 && first[0]&(0x80>>(n-1)) == 0 {
+		n++
+	}
+	if n > 8 || (isID && n > 4) {
+		return 0, 0, fmt.Errorf("invalid variable-size integer")
+	}
+
+	rest := make([]byte, n-1)
+	_, err = io.ReadFull(r, rest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	v := uint64(first[0])
+	if !isID {
+		v &= uint64(0xFF >> n)
+	}
+
+	allOnes := v == uint64(0xFF>>n)
+
+	for _, b := range rest {
+		v = v<<8 | uint64(b)
+		if b != 0xFF {
+			allOnes = false
+		}
+	}
+
+	if !isID && allOnes {
+		return math.MaxUint64, n, nil
+	}
+
+	return v, n, nil
+}
+
+func readElementHeader(r io.Reader) (*elementHeader, error) {
+	id, idN, err := readVint(r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	size, sizeN, err := readVint(r, false)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &elementHeader{
+		id:  uint32(id),
+		len: int64(idN + sizeN),
+	}
+
+	if size == math.MaxUint64 {
+		h.size = unknownSize
+	} else {
+		if size > math.MaxInt64 {
+			return nil, fmt.Errorf("invalid element size")
+		}
+		h.size = int64(size)
+	}
+
+	return h, nil
+}
+
+func readPayload(r io.Reader, h *elementHeader) ([]byte, error) {
+	if h.size < 0 || h.size > maxElementSize {
+		return nil, fmt.Errorf("invalid size of element 0x%X: %d", h.id, h.size)
+	}
+
+	buf := make([]byte, h.size)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+type element struct {
+	id      uint32
+	payload []byte
+}
+
+// parseChildren splits the payload of a master element into its children.
+func parseChildren(buf []byte) ([]element, error) {
+	var out []element
+
+	for len(buf) != 0 {
+		br := &byteReader{buf: buf}
+
+		h, err := readElementHeader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		if h.size < 0 || h.size > int64(len(buf))-h.len {
+			return nil, fmt.Errorf("invalid size of element 0x%X", h.id)
+		}
+
+		out = append(out, element{
+			id:      h.id,
+			payload: buf[h.len : h.len+h.size],
+		})
+		buf = buf[h.len+h.size:]
+	}
+
+	return out, nil
+}
+
+type byteReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *byteReader) Read(p []byte) (int, error) {
+	if r.pos >= len(r.buf) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+func decodeUint(buf []byte) (uint64, error) {
+	if len(buf) > 8 {
+		return 0, fmt.Errorf("invalid unsigned integer size: %d", len(buf))
+	}
+
+	var v uint64
+	for _, b := range buf {
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func decodeFloat(buf []byte) (float64, error) {
+	switch len(buf) {
+	case 0:
+		return 0, nil
+
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf))), nil
+
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+
+	default:
+		return 0, fmt.Errorf("invalid float size: %d", len(buf))
+	}
+}
@@ -0,0 +1,281 @@
+package mkv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// TimestampScale is the duration of a timestamp unit.
+// It is used when writing files.
+const TimestampScale = time.Millisecond
+
+const (
+	docType = "matroska"
+	appName = "mediamtx"
+)
+
+// Header is the header of a Matroska file.
+// It contains the EBML header, the beginning of the segment,
+// segment informations and tracks.
+type Header struct {
+	Tracks   []*Track
+	Duration time.Duration
+}
+
+// Marshal encodes a Header.
+// The segment is written with an unknown size,
+// in order to allow appending clusters.
+func (h *Header) Marshal(w io.Writer) error {
+	var ebml []byte
+	ebml = appendUint(ebml, idEBMLVersion, 1)
+	ebml = appendUint(ebml, idEBMLReadVersion, 1)
+	ebml = appendUint(ebml, idEBMLMaxIDLength, 4)
+	ebml = appendUint(ebml, idEBMLMaxSizeLength, 8)
+	ebml = appendString(ebml, idDocType, docType)
+	ebml = appendUint(ebml, idDocTypeVersion, 4)
+	ebml = appendUint(ebml, idDocTypeReadVersion, 2)
+
+	var buf []byte
+	buf = appendElement(buf, idEBML, ebml)
+
+	buf = appendID(buf, idSegment)
+	buf = append(buf, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+
+	var info []byte
+	info = appendUint(info, idTimestampScale, uint64(TimestampScale))
+	info = appendFloat(info, idDuration, float64(h.Duration)/float64(TimestampScale))
+	info = appendString(info, idMuxingApp, appName)
+	info = appendString(info, idWritingApp, appName)
+	buf = appendElement(buf, idInfo, info)
+
+	var tracks []byte
+	for _, track := range h.Tracks {
+		var err error
+		tracks, err = track.marshal(tracks)
+		if err != nil {
+			return err
+		}
+	}
+	buf = appendElement(buf, idTracks, tracks)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// Reader reads a Matroska file.
+type Reader struct {
+	R io.ReadSeeker
+
+	// Header is filled by Initialize.
+	Header *Header
+
+	timestampScale time.Duration
+	durationPos    int64
+	durationSize   int64
+	clustersPos    int64
+}
+
+// Initialize reads the header of the file.
+func (r *Reader) Initialize() error {
+	r.durationPos = -1
+	r.timestampScale = time.Millisecond
+
+	_, err := r.R.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	h, err := readElementHeader(r.R)
+	if err != nil {
+		return err
+	}
+
+	if h.id != idEBML {
+		return fmt.Errorf("EBML header not found")
+	}
+
+	buf, err := readPayload(r.R, h)
+	if err != nil {
+		return err
+	}
+
+	children, err := parseChildren(buf)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range children {
+		if el.id == idDocType && string(el.payload) != docType && string(el.payload) != "webm" {
+			return fmt.Errorf("unsupported document type: %s", el.payload)
+		}
+	}
+
+	h, err = readElementHeader(r.R)
+	if err != nil {
+		return err
+	}
+
+	if h.id != idSegment {
+		return fmt.Errorf("segment not found")
+	}
+
+	r.Header = &Header{}
+	tracksFound := false
+
+	for {
+		pos, err := r.R.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+
+		h, err := readElementHeader(r.R)
+		if err != nil {
+			return err
+		}
+
+		switch h.id {
+		case idInfo:
+			buf, err := readPayload(r.R, h)
+			if err != nil {
+				return err
+			}
+
+			err = r.readInfo(buf, pos+h.len)
+			if err != nil {
+				return err
+			}
+
+		case idTracks:
+			buf, err := readPayload(r.R, h)
+			if err != nil {
+				return err
+			}
+
+			err = r.readTracks(buf)
+			if err != nil {
+				return err
+			}
+
+			tracksFound = true
+
+		case idCluster:
+			if !tracksFound {
+				return fmt.Errorf("tracks not found")
+			}
+
+			r.clustersPos = pos
+			return nil
+
+		default:
+			if h.size < 0 {
+				return fmt.Errorf("element 0x%X has an unknown size", h.id)
+			}
+
+			_, err = r.R.Seek(h.size, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *Reader) readInfo(buf []byte, payloadPos int64) error {
+	var duration float64
+
+	br := &byteReader{buf: buf}
+
+	for br.pos < len(buf) {
+		h, err := readElementHeader(br)
+		if err != nil {
+			return err
+		}
+
+		if h.size < 0 || h.size > int64(len(buf)-br.pos) {
+			return fmt.Errorf("invalid size of element 0x%X", h.id)
+		}
+
+		payload := buf[br.pos : br.pos+int(h.size)]
+
+		switch h.id {
+		case idTimestampScale:
+			v, err := decodeUint(payload)
+			if err != nil {
+				return err
+			}
+			if v == 0 {
+				return fmt.Errorf("invalid timestamp scale")
+			}
+			r.timestampScale = time.Duration(v)
+
+		case idDuration:
+			duration, err = decodeFloat(payload)
+			if err != nil {
+				return err
+			}
+
+			r.durationPos = payloadPos + int64(br.pos)
+			r.durationSize = h.size
+		}
+
+		br.pos += int(h.size)
+	}
+
+	r.Header.Duration = time.Duration(duration * float64(r.timestampScale))
+
+	return nil
+}
+
+func (r *Reader) readTracks(buf []byte) error {
+	children, err := parseChildren(buf)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range children {
+		if el.id != idTrackEntry {
+			continue
+		}
+
+		var track Track
+		err = track.unmarshal(el.payload)
+		if err != nil {
+			return err
+		}
+
+		r.Header.Tracks = append(r.Header.Tracks, &track)
+	}
+
+	if len(r.Header.Tracks) == 0 {
+		return fmt.Errorf("no tracks found")
+	}
+
+	return nil
+}
+
+// WriteDuration overrides the duration of the file.
+// The file must have been written with Header.Marshal.
+func WriteDuration(rw io.ReadWriteSeeker, d time.Duration) error {
+	r := &Reader{R: rw}
+	err := r.Initialize()
+	if err != nil {
+		return err
+	}
+
+	if r.durationPos < 0 || r.durationSize != 8 {
+		return fmt.Errorf("duration not found")
+	}
+
+	_, err = rw.Seek(r.durationPos, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(float64(d)/float64(r.timestampScale)))
+
+	_, err = rw.Write(buf)
+	return err
+}
@@ -0,0 +1,193 @@
+package mkv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func TestReadWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-mkv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "test.mkv")
+
+	f, err := os.Create(fpath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	tracks := []*Track{
+		{
+			Number: 1,
+			Codec: &mp4.CodecH264{
+				SPS: test.FormatH264.SPS,
+				PPS: test.FormatH264.PPS,
+			},
+		},
+		{
+			Number: 2,
+			Codec: &mp4.CodecH265{
+				VPS: test.FormatH265.VPS,
+				SPS: test.FormatH265.SPS,
+				PPS: test.FormatH265.PPS,
+			},
+		},
+		{
+			Number: 3,
+			Codec: &mp4.CodecMPEG4Audio{
+				Config: mpeg4audio.Config{
+					Type:         2,
+					SampleRate:   44100,
+					ChannelCount: 2,
+				},
+			},
+		},
+		{
+			Number: 4,
+			Codec: &mp4.CodecOpus{
+				ChannelCount: 2,
+			},
+		},
+		{
+			Number: 5,
+			Codec: &mp4.CodecVP9{
+				Width:             1920,
+				Height:            1080,
+				Profile:           1,
+				BitDepth:          8,
+				ChromaSubsampling: 1,
+				ColorRange:        true,
+			},
+		},
+		{
+			Number: 6,
+			Codec: &mp4.CodecAC3{
+				SampleRate:   48000,
+				ChannelCount: 1,
+				Fscod:        0x0,
+				Bsid:         0x8,
+				Bsmod:        0x0,
+				Acmod:        0x1,
+				LfeOn:        false,
+				BitRateCode:  0x7,
+			},
+		},
+		{
+			Number: 7,
+			Codec: &mp4.CodecLPCM{
+				BitDepth:     16,
+				SampleRate:   44100,
+				ChannelCount: 2,
+			},
+		},
+	}
+
+	err = (&Header{Tracks: tracks}).Marshal(f)
+	require.NoError(t, err)
+
+	err = (&Cluster{
+		Timestamp: 0,
+		Blocks: []*Block{
+			{
+				TrackNumber: 1,
+				Timestamp:   100 * time.Millisecond,
+				Keyframe:    true,
+				Payload:     []byte{1, 2},
+			},
+			{
+				TrackNumber: 3,
+				Timestamp:   0,
+				Keyframe:    true,
+				Payload:     []byte{3, 4, 5},
+			},
+		},
+	}).Marshal(f)
+	require.NoError(t, err)
+
+	err = (&Cluster{
+		Timestamp: 40 * time.Second,
+		Blocks: []*Block{
+			{
+				TrackNumber: 1,
+				Timestamp:   40*time.Second + 20*time.Millisecond,
+				Payload:     []byte{6},
+			},
+		},
+	}).Marshal(f)
+	require.NoError(t, err)
+
+	err = (&Cluster{
+		Timestamp: 0,
+		Blocks: []*Block{{
+			TrackNumber: 1,
+			Timestamp:   40 * time.Second,
+		}},
+	}).Marshal(&bytes.Buffer{})
+	require.Error(t, err)
+
+	err = WriteDuration(f, 41*time.Second)
+	require.NoError(t, err)
+
+	// simulate a crash during the write of a cluster
+	_, err = f.Seek(0, 2)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0x1F, 0x43, 0xB6, 0x75, 0x88})
+	require.NoError(t, err)
+
+	r := &Reader{R: f}
+	err = r.Initialize()
+	require.NoError(t, err)
+
+	require.Equal(t, &Header{
+		Tracks:   tracks,
+		Duration: 41 * time.Second,
+	}, r.Header)
+
+	var blocks []*BlockInfo
+	var payloads [][]byte
+
+	err = r.ReadBlocks(func(bi *BlockInfo) error {
+		blocks = append(blocks, bi)
+		return nil
+	})
+	require.NoError(t, err)
+
+	for _, bi := range blocks {
+		buf := make([]byte, bi.Size)
+		_, err = f.ReadAt(buf, bi.Offset)
+		require.NoError(t, err)
+		payloads = append(payloads, buf)
+		bi.Offset = 0
+	}
+
+	require.Equal(t, []*BlockInfo{
+		{
+			TrackNumber: 1,
+			Timestamp:   100 * time.Millisecond,
+			Keyframe:    true,
+			Size:        2,
+		},
+		{
+			TrackNumber: 3,
+			Timestamp:   0,
+			Keyframe:    true,
+			Size:        3,
+		},
+		{
+			TrackNumber: 1,
+			Timestamp:   40*time.Second + 20*time.Millisecond,
+			Size:        1,
+		},
+	}, blocks)
+
+	require.Equal(t, [][]byte{{1, 2}, {3, 4, 5}, {6}}, payloads)
+}
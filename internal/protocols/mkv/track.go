@@ -0,0 +1,675 @@
+package mkv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	amp4 "github.com/abema/go-mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/av1"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+)
+
+const (
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+)
+
+// VP9 codec features, stored inside CodecPrivate.
+const (
+	vp9FeatureProfile           = 1
+	vp9FeatureBitDepth          = 3
+	vp9FeatureChromaSubsampling = 4
+)
+
+// Matroska values of Colour/Range.
+const (
+	colourRangeBroadcast = 1
+	colourRangeFull      = 2
+)
+
+func boolToUint8(v bool) uint8 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+func marshalBox(box amp4.IImmutableBox) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := amp4.Marshal(&buf, box, amp4.Context{})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalBox(buf []byte, box amp4.IBox) error {
+	_, err := amp4.Unmarshal(bytes.NewReader(buf), uint64(len(buf)), box, amp4.Context{})
+	return err
+}
+
+// Track is a Matroska track.
+type Track struct {
+	Number uint64
+	Codec  mp4.Codec
+}
+
+type trackParams struct {
+	trackType    uint64
+	codecID      string
+	codecPrivate []byte
+	width        int
+	height       int
+	colourRange  uint64
+	sampleRate   int
+	channelCount int
+	bitDepth     int
+}
+
+func (t *Track) params() (*trackParams, error) {
+	switch codec := t.Codec.(type) {
+	case *mp4.CodecAV1:
+		var sh av1.SequenceHeader
+		err := sh.Unmarshal(codec.SequenceHeader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse AV1 sequence header: %w", err)
+		}
+
+		enc, err := av1.Bitstream([][]byte{codec.SequenceHeader}).Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		priv, err := marshalBox(&amp4.Av1C{
+			Marker:               1,
+			Version:              1,
+			SeqProfile:           sh.SeqProfile,
+			SeqLevelIdx0:         sh.SeqLevelIdx[0],
+			SeqTier0:             boolToUint8(sh.SeqTier[0]),
+			HighBitdepth:         boolToUint8(sh.ColorConfig.HighBitDepth),
+			TwelveBit:            boolToUint8(sh.ColorConfig.TwelveBit),
+			Monochrome:           boolToUint8(sh.ColorConfig.MonoChrome),
+			ChromaSubsamplingX:   boolToUint8(sh.ColorConfig.SubsamplingX),
+			ChromaSubsamplingY:   boolToUint8(sh.ColorConfig.SubsamplingY),
+			ChromaSamplePosition: uint8(sh.ColorConfig.ChromaSamplePosition),
+			ConfigOBUs:           enc,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &trackParams{
+			trackType:    trackTypeVideo,
+			codecID:      "V_AV1",
+			codecPrivate: priv,
+			width:        sh.Width(),
+			height:       sh.Height(),
+		}, nil
+
+	case *mp4.CodecVP9:
+		colourRange := uint64(colourRangeBroadcast)
+		if codec.ColorRange {
+			colourRange = colourRangeFull
+		}
+
+		return &trackParams{
+			trackType: trackTypeVideo,
+			codecID:   "V_VP9",
+			codecPrivate: []byte{
+				vp9FeatureProfile, 1, codec.Profile,
+				vp9FeatureBitDepth, 1, codec.BitDepth,
+				vp9FeatureChromaSubsampling, 1, codec.ChromaSubsampling,
+			},
+			width:       codec.Width,
+			height:      codec.Height,
+			colourRange: colourRange,
+		}, nil
+
+	case *mp4.CodecH265:
+		if len(codec.VPS) == 0 || len(codec.SPS) < 13 || len(codec.PPS) == 0 {
+			return nil, fmt.Errorf("H265 parameters not provided")
+		}
+
+		var sps h265.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H265 SPS: %w", err)
+		}
+
+		priv, err := marshalBox(&amp4.HvcC{
+			ConfigurationVersion:        1,
+			GeneralProfileIdc:           sps.ProfileTierLevel.GeneralProfileIdc,
+			GeneralProfileCompatibility: sps.ProfileTierLevel.GeneralProfileCompatibilityFlag,
+			GeneralConstraintIndicator: [6]uint8{
+				codec.SPS[7], codec.SPS[8], codec.SPS[9],
+				codec.SPS[10], codec.SPS[11], codec.SPS[12],
+			},
+			GeneralLevelIdc:      sps.ProfileTierLevel.GeneralLevelIdc,
+			ChromaFormatIdc:      uint8(sps.ChromaFormatIdc),
+			BitDepthLumaMinus8:   uint8(sps.BitDepthLumaMinus8),
+			BitDepthChromaMinus8: uint8(sps.BitDepthChromaMinus8),
+			NumTemporalLayers:    1,
+			LengthSizeMinusOne:   3,
+			NumOfNaluArrays:      3,
+			NaluArrays: []amp4.HEVCNaluArray{
+				{
+					NaluType: byte(h265.NALUType_VPS_NUT),
+					NumNalus: 1,
+					Nalus:    []amp4.HEVCNalu{{Length: uint16(len(codec.VPS)), NALUnit: codec.VPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_SPS_NUT),
+					NumNalus: 1,
+					Nalus:    []amp4.HEVCNalu{{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS}},
+				},
+				{
+					NaluType: byte(h265.NALUType_PPS_NUT),
+					NumNalus: 1,
+					Nalus:    []amp4.HEVCNalu{{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS}},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &trackParams{
+			trackType:    trackTypeVideo,
+			codecID:      "V_MPEGH/ISO/HEVC",
+			codecPrivate: priv,
+			width:        sps.Width(),
+			height:       sps.Height(),
+		}, nil
+
+	case *mp4.CodecH264:
+		if len(codec.SPS) < 4 || len(codec.PPS) == 0 {
+			return nil, fmt.Errorf("H264 parameters not provided")
+		}
+
+		var sps h264.SPS
+		err := sps.Unmarshal(codec.SPS)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse H264 SPS: %w", err)
+		}
+
+		priv, err := marshalBox(&amp4.AVCDecoderConfiguration{
+			AnyTypeBox: amp4.AnyTypeBox{
+				Type: amp4.BoxTypeAvcC(),
+			},
+			ConfigurationVersion:       1,
+			Profile:                    sps.ProfileIdc,
+			ProfileCompatibility:       codec.SPS[2],
+			Level:                      sps.LevelIdc,
+			LengthSizeMinusOne:         3,
+			NumOfSequenceParameterSets: 1,
+			SequenceParameterSets:      []amp4.AVCParameterSet{{Length: uint16(len(codec.SPS)), NALUnit: codec.SPS}},
+			NumOfPictureParameterSets:  1,
+			PictureParameterSets:       []amp4.AVCParameterSet{{Length: uint16(len(codec.PPS)), NALUnit: codec.PPS}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &trackParams{
+			trackType:    trackTypeVideo,
+			codecID:      "V_MPEG4/ISO/AVC",
+			codecPrivate: priv,
+			width:        sps.Width(),
+			height:       sps.Height(),
+		}, nil
+
+	case *mp4.CodecMPEG4Video:
+		// TODO: parse config and use real values
+		return &trackParams{
+			trackType:    trackTypeVideo,
+			codecID:      "V_MPEG4/ISO/ASP",
+			codecPrivate: codec.Config,
+			width:        800,
+			height:       600,
+		}, nil
+
+	case *mp4.CodecMPEG1Video:
+		// TODO: parse config and use real values
+		return &trackParams{
+			trackType:    trackTypeVideo,
+			codecID:      "V_MPEG2",
+			codecPrivate: codec.Config,
+			width:        800,
+			height:       600,
+		}, nil
+
+	case *mp4.CodecMJPEG:
+		return &trackParams{
+			trackType: trackTypeVideo,
+			codecID:   "V_MJPEG",
+			width:     codec.Width,
+			height:    codec.Height,
+		}, nil
+
+	case *mp4.CodecOpus:
+		// OpusHead, as described in RFC7845
+		priv := make([]byte, 19)
+		copy(priv, []byte("OpusHead"))
+		priv[8] = 1
+		priv[9] = uint8(codec.ChannelCount)
+		binary.LittleEndian.PutUint16(priv[10:], 312)
+		binary.LittleEndian.PutUint32(priv[12:], 48000)
+
+		return &trackParams{
+			trackType:    trackTypeAudio,
+			codecID:      "A_OPUS",
+			codecPrivate: priv,
+			sampleRate:   48000,
+			channelCount: codec.ChannelCount,
+		}, nil
+
+	case *mp4.CodecMPEG4Audio:
+		priv, err := codec.Config.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		return &trackParams{
+			trackType:    trackTypeAudio,
+			codecID:      "A_AAC",
+			codecPrivate: priv,
+			sampleRate:   codec.SampleRate,
+			channelCount: codec.ChannelCount,
+		}, nil
+
+	case *mp4.CodecMPEG1Audio:
+		return &trackParams{
+			trackType:    trackTypeAudio,
+			codecID:      "A_MPEG/L3",
+			sampleRate:   codec.SampleRate,
+			channelCount: codec.ChannelCount,
+		}, nil
+
+	case *mp4.CodecAC3:
+		// Matroska does not define a CodecPrivate for AC-3.
+		// Store the content of the dac3 box in order to read parameters back.
+		priv, err := marshalBox(&amp4.Dac3{
+			Fscod:       codec.Fscod,
+			Bsid:        codec.Bsid,
+			Bsmod:       codec.Bsmod,
+			Acmod:       codec.Acmod,
+			LfeOn:       boolToUint8(codec.LfeOn),
+			BitRateCode: codec.BitRateCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &trackParams{
+			trackType:    trackTypeAudio,
+			codecID:      "A_AC3",
+			codecPrivate: priv,
+			sampleRate:   codec.SampleRate,
+			channelCount: codec.ChannelCount,
+		}, nil
+
+	case *mp4.CodecLPCM:
+		codecID := "A_PCM/INT/BIG"
+		if codec.LittleEndian {
+			codecID = "A_PCM/INT/LIT"
+		}
+
+		return &trackParams{
+			trackType:    trackTypeAudio,
+			codecID:      codecID,
+			sampleRate:   codec.SampleRate,
+			channelCount: codec.ChannelCount,
+			bitDepth:     codec.BitDepth,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported codec: %T", t.Codec)
+	}
+}
+
+func (t *Track) marshal(buf []byte) ([]byte, error) {
+	p, err := t.params()
+	if err != nil {
+		return nil, err
+	}
+
+	var entry []byte
+	entry = appendUint(entry, idTrackNumber, t.Number)
+	entry = appendUint(entry, idTrackUID, t.Number)
+	entry = appendUint(entry, idTrackType, p.trackType)
+	entry = appendUint(entry, idFlagLacing, 0)
+	entry = appendString(entry, idCodecID, p.codecID)
+
+	if p.codecPrivate != nil {
+		entry = appendElement(entry, idCodecPrivate, p.codecPrivate)
+	}
+
+	if p.trackType == trackTypeVideo {
+		var video []byte
+		video = appendUint(video, idPixelWidth, uint64(p.width))
+		video = appendUint(video, idPixelHeight, uint64(p.height))
+
+		if p.colourRange != 0 {
+			video = appendElement(video, idColour, appendUint(nil, idRange, p.colourRange))
+		}
+
+		entry = appendElement(entry, idVideo, video)
+	} else {
+		var audio []byte
+		audio = appendFloat(audio, idSamplingFrequency, float64(p.sampleRate))
+		audio = appendUint(audio, idChannels, uint64(p.channelCount))
+
+		if p.bitDepth != 0 {
+			audio = appendUint(audio, idBitDepth, uint64(p.bitDepth))
+		}
+
+		entry = appendElement(entry, idAudio, audio)
+	}
+
+	return appendElement(buf, idTrackEntry, entry), nil
+}
+
+func (t *Track) unmarshal(buf []byte) error {
+	children, err := parseChildren(buf)
+	if err != nil {
+		return err
+	}
+
+	p := &trackParams{}
+
+	for _, el := range children {
+		switch el.id {
+		case idTrackNumber:
+			t.Number, err = decodeUint(el.payload)
+			if err != nil {
+				return err
+			}
+
+		case idCodecID:
+			p.codecID = string(bytes.TrimRight(el.payload, "\x00"))
+
+		case idCodecPrivate:
+			p.codecPrivate = el.payload
+
+		case idVideo:
+			err = p.unmarshalVideo(el.payload)
+			if err != nil {
+				return err
+			}
+
+		case idAudio:
+			err = p.unmarshalAudio(el.payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if t.Number == 0 {
+		return fmt.Errorf("track number not provided")
+	}
+
+	t.Codec, err = p.codec()
+	return err
+}
+
+func (p *trackParams) unmarshalVideo(buf []byte) error {
+	children, err := parseChildren(buf)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range children {
+		switch el.id {
+		case idPixelWidth:
+			v, err := decodeUint(el.payload)
+			if err != nil {
+				return err
+			}
+			p.width = int(v)
+
+		case idPixelHeight:
+			v, err := decodeUint(el.payload)
+			if err != nil {
+				return err
+			}
+			p.height = int(v)
+
+		case idColour:
+			children2, err := parseChildren(el.payload)
+			if err != nil {
+				return err
+			}
+
+			for _, el2 := range children2 {
+				if el2.id == idRange {
+					p.colourRange, err = decodeUint(el2.payload)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *trackParams) unmarshalAudio(buf []byte) error {
+	children, err := parseChildren(buf)
+	if err != nil {
+		return err
+	}
+
+	p.channelCount = 1
+
+	for _, el := range children {
+		switch el.id {
+		case idSamplingFrequency:
+			v, err := decodeFloat(el.payload)
+			if err != nil {
+				return err
+			}
+			p.sampleRate = int(v)
+
+		case idChannels:
+			v, err := decodeUint(el.payload)
+			if err != nil {
+				return err
+			}
+			p.channelCount = int(v)
+
+		case idBitDepth:
+			v, err := decodeUint(el.payload)
+			if err != nil {
+				return err
+			}
+			p.bitDepth = int(v)
+		}
+	}
+
+	return nil
+}
+
+func (p *trackParams) codec() (mp4.Codec, error) {
+	switch p.codecID {
+	case "V_AV1":
+		var av1C amp4.Av1C
+		err := unmarshalBox(p.codecPrivate, &av1C)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AV1 configuration: %w", err)
+		}
+
+		var bs av1.Bitstream
+		err = bs.Unmarshal(av1C.ConfigOBUs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AV1 configuration: %w", err)
+		}
+
+		if len(bs) == 0 {
+			return nil, fmt.Errorf("AV1 sequence header not provided")
+		}
+
+		return &mp4.CodecAV1{
+			SequenceHeader: bs[0],
+		}, nil
+
+	case "V_VP9":
+		codec := &mp4.CodecVP9{
+			Width:      p.width,
+			Height:     p.height,
+			BitDepth:   8,
+			ColorRange: p.colourRange == colourRangeFull,
+		}
+
+		buf := p.codecPrivate
+		for len(buf) >= 3 {
+			id, l := buf[0], int(buf[1])
+			if len(buf) < 2+l {
+				break
+			}
+
+			if l == 1 {
+				switch id {
+				case vp9FeatureProfile:
+					codec.Profile = buf[2]
+
+				case vp9FeatureBitDepth:
+					codec.BitDepth = buf[2]
+
+				case vp9FeatureChromaSubsampling:
+					codec.ChromaSubsampling = buf[2]
+				}
+			}
+
+			buf = buf[2+l:]
+		}
+
+		return codec, nil
+
+	case "V_MPEGH/ISO/HEVC":
+		var hvcC amp4.HvcC
+		err := unmarshalBox(p.codecPrivate, &hvcC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid H265 configuration: %w", err)
+		}
+
+		codec := &mp4.CodecH265{}
+
+		for _, arr := range hvcC.NaluArrays {
+			if len(arr.Nalus) == 0 {
+				continue
+			}
+
+			switch h265.NALUType(arr.NaluType) {
+			case h265.NALUType_VPS_NUT:
+				codec.VPS = arr.Nalus[0].NALUnit
+
+			case h265.NALUType_SPS_NUT:
+				codec.SPS = arr.Nalus[0].NALUnit
+
+			case h265.NALUType_PPS_NUT:
+				codec.PPS = arr.Nalus[0].NALUnit
+			}
+		}
+
+		if codec.VPS == nil || codec.SPS == nil || codec.PPS == nil {
+			return nil, fmt.Errorf("H265 parameters not provided")
+		}
+
+		return codec, nil
+
+	case "V_MPEG4/ISO/AVC":
+		avcC := amp4.AVCDecoderConfiguration{
+			AnyTypeBox: amp4.AnyTypeBox{
+				Type: amp4.BoxTypeAvcC(),
+			},
+		}
+		err := unmarshalBox(p.codecPrivate, &avcC)
+		if err != nil {
+			return nil, fmt.Errorf("invalid H264 configuration: %w", err)
+		}
+
+		if len(avcC.SequenceParameterSets) == 0 || len(avcC.PictureParameterSets) == 0 {
+			return nil, fmt.Errorf("H264 parameters not provided")
+		}
+
+		return &mp4.CodecH264{
+			SPS: avcC.SequenceParameterSets[0].NALUnit,
+			PPS: avcC.PictureParameterSets[0].NALUnit,
+		}, nil
+
+	case "V_MPEG4/ISO/ASP", "V_MPEG4/ISO/SP":
+		return &mp4.CodecMPEG4Video{
+			Config: p.codecPrivate,
+		}, nil
+
+	case "V_MPEG1", "V_MPEG2":
+		return &mp4.CodecMPEG1Video{
+			Config: p.codecPrivate,
+		}, nil
+
+	case "V_MJPEG":
+		return &mp4.CodecMJPEG{
+			Width:  p.width,
+			Height: p.height,
+		}, nil
+
+	case "A_OPUS":
+		channelCount := p.channelCount
+		if len(p.codecPrivate) >= 10 {
+			channelCount = int(p.codecPrivate[9])
+		}
+
+		return &mp4.CodecOpus{
+			ChannelCount: channelCount,
+		}, nil
+
+	case "A_AAC":
+		codec := &mp4.CodecMPEG4Audio{}
+		err := codec.Config.Unmarshal(p.codecPrivate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MPEG-4 Audio configuration: %w", err)
+		}
+
+		return codec, nil
+
+	case "A_MPEG/L1", "A_MPEG/L2", "A_MPEG/L3":
+		return &mp4.CodecMPEG1Audio{
+			SampleRate:   p.sampleRate,
+			ChannelCount: p.channelCount,
+		}, nil
+
+	case "A_AC3":
+		var dac3 amp4.Dac3
+		err := unmarshalBox(p.codecPrivate, &dac3)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AC-3 configuration: %w", err)
+		}
+
+		return &mp4.CodecAC3{
+			SampleRate:   p.sampleRate,
+			ChannelCount: p.channelCount,
+			Fscod:        dac3.Fscod,
+			Bsid:         dac3.Bsid,
+			Bsmod:        dac3.Bsmod,
+			Acmod:        dac3.Acmod,
+			LfeOn:        dac3.LfeOn != 0,
+			BitRateCode:  dac3.BitRateCode,
+		}, nil
+
+	case "A_PCM/INT/BIG", "A_PCM/INT/LIT":
+		return &mp4.CodecLPCM{
+			LittleEndian: p.codecID == "A_PCM/INT/LIT",
+			BitDepth:     p.bitDepth,
+			SampleRate:   p.sampleRate,
+			ChannelCount: p.channelCount,
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported codec: %s", p.codecID)
+	}
+}
@@ -0,0 +1,35 @@
+package moq
+
+// CatalogTrackName is the name of the track that contains the catalog.
+const CatalogTrackName = "catalog"
+
+// CatalogSelectionParams are the selection parameters of a catalog track.
+type CatalogSelectionParams struct {
+	Codec    string `json:"codec"`
+	MimeType string `json:"mimeType"`
+}
+
+// CatalogTrack is a track in a catalog.
+type CatalogTrack struct {
+	Name            string                 `json:"name"`
+	InitData        string                 `json:"initData"`
+	SelectionParams CatalogSelectionParams `json:"selectionParams"`
+}
+
+// CatalogCommonTrackFields are fields shared by all tracks of a catalog.
+type CatalogCommonTrackFields struct {
+	Namespace   string `json:"namespace"`
+	Packaging   string `json:"packaging"`
+	RenderGroup int    `json:"renderGroup"`
+}
+
+// Catalog describes the tracks of a namespace.
+// It follows the WARP streaming format, where every track is packaged with CMAF
+// and its initialization segment is embedded in base64 into the catalog.
+type Catalog struct {
+	Version                int                      `json:"version"`
+	StreamingFormat        int                      `json:"streamingFormat"`
+	StreamingFormatVersion string                   `json:"streamingFormatVersion"`
+	CommonTrackFields      CatalogCommonTrackFields `json:"commonTrackFields"`
+	Tracks                 []CatalogTrack           `json:"tracks"`
+}
@@ -0,0 +1,539 @@
+package moq
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const maxMessageSize = 64 * 1024
+
+// message types.
+const (
+	messageTypeSubscribe      = 0x03
+	messageTypeSubscribeOK    = 0x04
+	messageTypeSubscribeError = 0x05
+	messageTypeUnsubscribe    = 0x0A
+	messageTypeSubscribeDone  = 0x0B
+	messageTypeGoAway         = 0x10
+	messageTypeClientSetup    = 0x40
+	messageTypeServerSetup    = 0x41
+)
+
+// Message is a control message.
+type Message interface {
+	typ() uint64
+	unmarshal(buf *buffer) error
+	marshal(buf []byte) []byte
+}
+
+// ReadMessage reads a control message.
+// Messages with unknown types are returned as *Unknown.
+func ReadMessage(r quicvarint.Reader) (Message, error) {
+	typ, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	le, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if le > maxMessageSize {
+		return nil, fmt.Errorf("message size (%d) is too big", le)
+	}
+
+	payload := make([]byte, le)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg Message
+
+	switch typ {
+	case messageTypeSubscribe:
+		msg = &Subscribe{}
+
+	case messageTypeSubscribeOK:
+		msg = &SubscribeOK{}
+
+	case messageTypeSubscribeError:
+		msg = &SubscribeError{}
+
+	case messageTypeUnsubscribe:
+		msg = &Unsubscribe{}
+
+	case messageTypeSubscribeDone:
+		msg = &SubscribeDone{}
+
+	case messageTypeGoAway:
+		msg = &GoAway{}
+
+	case messageTypeClientSetup:
+		msg = &ClientSetup{}
+
+	case messageTypeServerSetup:
+		msg = &ServerSetup{}
+
+	default:
+		return &Unknown{Type: typ, Payload: payload}, nil
+	}
+
+	buf := &buffer{buf: payload}
+
+	err = msg.unmarshal(buf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message (type %d): %w", typ, err)
+	}
+
+	if len(buf.buf) != 0 {
+		return nil, fmt.Errorf("invalid message (type %d): unexpected trailing bytes", typ)
+	}
+
+	return msg, nil
+}
+
+// MarshalMessage encodes a control message, including its type and length.
+func MarshalMessage(msg Message) []byte {
+	payload := msg.marshal(nil)
+
+	buf := quicvarint.Append(nil, msg.typ())
+	buf = quicvarint.Append(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+// WriteMessage writes a control message.
+func WriteMessage(w io.Writer, msg Message) error {
+	_, err := w.Write(MarshalMessage(msg))
+	return err
+}
+
+// Unknown is a message with an unknown type.
+type Unknown struct {
+	Type    uint64
+	Payload []byte
+}
+
+func (m *Unknown) typ() uint64 {
+	return m.Type
+}
+
+func (m *Unknown) unmarshal(buf *buffer) error {
+	m.Payload = buf.buf
+	buf.buf = nil
+	return nil
+}
+
+func (m *Unknown) marshal(buf []byte) []byte {
+	return append(buf, m.Payload...)
+}
+
+// ClientSetup is a CLIENT_SETUP message.
+type ClientSetup struct {
+	SupportedVersions []uint64
+	Parameters        Parameters
+}
+
+func (m *ClientSetup) typ() uint64 {
+	return messageTypeClientSetup
+}
+
+func (m *ClientSetup) unmarshal(buf *buffer) error {
+	n, err := buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 || n > 32 {
+		return fmt.Errorf("invalid version count: %d", n)
+	}
+
+	m.SupportedVersions = make([]uint64, n)
+
+	for i := range m.SupportedVersions {
+		m.SupportedVersions[i], err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+	}
+
+	m.Parameters, err = buf.readParameters()
+	return err
+}
+
+func (m *ClientSetup) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, uint64(len(m.SupportedVersions)))
+	for _, v := range m.SupportedVersions {
+		buf = quicvarint.Append(buf, v)
+	}
+	return appendParameters(buf, m.Parameters)
+}
+
+// ServerSetup is a SERVER_SETUP message.
+type ServerSetup struct {
+	SelectedVersion uint64
+	Parameters      Parameters
+}
+
+func (m *ServerSetup) typ() uint64 {
+	return messageTypeServerSetup
+}
+
+func (m *ServerSetup) unmarshal(buf *buffer) error {
+	var err error
+	m.SelectedVersion, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.Parameters, err = buf.readParameters()
+	return err
+}
+
+func (m *ServerSetup) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, m.SelectedVersion)
+	return appendParameters(buf, m.Parameters)
+}
+
+// Subscribe is a SUBSCRIBE message.
+type Subscribe struct {
+	SubscribeID        uint64
+	TrackAlias         uint64
+	TrackNamespace     []string
+	TrackName          string
+	SubscriberPriority uint8
+	GroupOrder         uint8
+	FilterType         uint64
+	StartGroup         uint64
+	StartObject        uint64
+	EndGroup           uint64
+	EndObject          uint64
+	Parameters         Parameters
+}
+
+func (m *Subscribe) typ() uint64 {
+	return messageTypeSubscribe
+}
+
+func (m *Subscribe) unmarshal(buf *buffer) error {
+	var err error
+	m.SubscribeID, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.TrackAlias, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.TrackNamespace, err = buf.readTuple()
+	if err != nil {
+		return err
+	}
+
+	m.TrackName, err = buf.readString()
+	if err != nil {
+		return err
+	}
+
+	m.SubscriberPriority, err = buf.readByte()
+	if err != nil {
+		return err
+	}
+
+	m.GroupOrder, err = buf.readByte()
+	if err != nil {
+		return err
+	}
+
+	m.FilterType, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	switch m.FilterType {
+	case FilterLatestGroup, FilterLatestObject:
+
+	case FilterAbsoluteStart, FilterAbsoluteRange:
+		m.StartGroup, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+		m.StartObject, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+		if m.FilterType == FilterAbsoluteRange {
+			m.EndGroup, err = buf.readVarint()
+			if err != nil {
+				return err
+			}
+
+			m.EndObject, err = buf.readVarint()
+			if err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("invalid filter type: %d", m.FilterType)
+	}
+
+	m.Parameters, err = buf.readParameters()
+	return err
+}
+
+func (m *Subscribe) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, m.SubscribeID)
+	buf = quicvarint.Append(buf, m.TrackAlias)
+	buf = appendTuple(buf, m.TrackNamespace)
+	buf = appendString(buf, m.TrackName)
+	buf = append(buf, m.SubscriberPriority, m.GroupOrder)
+	buf = quicvarint.Append(buf, m.FilterType)
+
+	if m.FilterType == FilterAbsoluteStart || m.FilterType == FilterAbsoluteRange {
+		buf = quicvarint.Append(buf, m.StartGroup)
+		buf = quicvarint.Append(buf, m.StartObject)
+
+		if m.FilterType == FilterAbsoluteRange {
+			buf = quicvarint.Append(buf, m.EndGroup)
+			buf = quicvarint.Append(buf, m.EndObject)
+		}
+	}
+
+	return appendParameters(buf, m.Parameters)
+}
+
+// SubscribeOK is a SUBSCRIBE_OK message.
+type SubscribeOK struct {
+	SubscribeID     uint64
+	Expires         uint64
+	GroupOrder      uint8
+	ContentExists   bool
+	LargestGroupID  uint64
+	LargestObjectID uint64
+}
+
+func (m *SubscribeOK) typ() uint64 {
+	return messageTypeSubscribeOK
+}
+
+func (m *SubscribeOK) unmarshal(buf *buffer) error {
+	var err error
+	m.SubscribeID, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.Expires, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.GroupOrder, err = buf.readByte()
+	if err != nil {
+		return err
+	}
+
+	contentExists, err := buf.readByte()
+	if err != nil {
+		return err
+	}
+
+	switch contentExists {
+	case 0:
+
+	case 1:
+		m.ContentExists = true
+
+		m.LargestGroupID, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+		m.LargestObjectID, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("invalid ContentExists value: %d", contentExists)
+	}
+
+	return nil
+}
+
+func (m *SubscribeOK) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, m.SubscribeID)
+	buf = quicvarint.Append(buf, m.Expires)
+	buf = append(buf, m.GroupOrder)
+
+	if m.ContentExists {
+		buf = append(buf, 1)
+		buf = quicvarint.Append(buf, m.LargestGroupID)
+		buf = quicvarint.Append(buf, m.LargestObjectID)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	return buf
+}
+
+// SubscribeError is a SUBSCRIBE_ERROR message.
+type SubscribeError struct {
+	SubscribeID  uint64
+	ErrorCode    uint64
+	ReasonPhrase string
+	TrackAlias   uint64
+}
+
+func (m *SubscribeError) typ() uint64 {
+	return messageTypeSubscribeError
+}
+
+func (m *SubscribeError) unmarshal(buf *buffer) error {
+	var err error
+	m.SubscribeID, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.ErrorCode, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.ReasonPhrase, err = buf.readString()
+	if err != nil {
+		return err
+	}
+
+	m.TrackAlias, err = buf.readVarint()
+	return err
+}
+
+func (m *SubscribeError) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, m.SubscribeID)
+	buf = quicvarint.Append(buf, m.ErrorCode)
+	buf = appendString(buf, m.ReasonPhrase)
+	return quicvarint.Append(buf, m.TrackAlias)
+}
+
+// Unsubscribe is a UNSUBSCRIBE message.
+type Unsubscribe struct {
+	SubscribeID uint64
+}
+
+func (m *Unsubscribe) typ() uint64 {
+	return messageTypeUnsubscribe
+}
+
+func (m *Unsubscribe) unmarshal(buf *buffer) error {
+	var err error
+	m.SubscribeID, err = buf.readVarint()
+	return err
+}
+
+func (m *Unsubscribe) marshal(buf []byte) []byte {
+	return quicvarint.Append(buf, m.SubscribeID)
+}
+
+// SubscribeDone is a SUBSCRIBE_DONE message.
+type SubscribeDone struct {
+	SubscribeID   uint64
+	StatusCode    uint64
+	ReasonPhrase  string
+	ContentExists bool
+	FinalGroup    uint64
+	FinalObject   uint64
+}
+
+func (m *SubscribeDone) typ() uint64 {
+	return messageTypeSubscribeDone
+}
+
+func (m *SubscribeDone) unmarshal(buf *buffer) error {
+	var err error
+	m.SubscribeID, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.StatusCode, err = buf.readVarint()
+	if err != nil {
+		return err
+	}
+
+	m.ReasonPhrase, err = buf.readString()
+	if err != nil {
+		return err
+	}
+
+	contentExists, err := buf.readByte()
+	if err != nil {
+		return err
+	}
+
+	switch contentExists {
+	case 0:
+
+	case 1:
+		m.ContentExists = true
+
+		m.FinalGroup, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+		m.FinalObject, err = buf.readVarint()
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("invalid ContentExists value: %d", contentExists)
+	}
+
+	return nil
+}
+
+func (m *SubscribeDone) marshal(buf []byte) []byte {
+	buf = quicvarint.Append(buf, m.SubscribeID)
+	buf = quicvarint.Append(buf, m.StatusCode)
+	buf = appendString(buf, m.ReasonPhrase)
+
+	if m.ContentExists {
+		buf = append(buf, 1)
+		buf = quicvarint.Append(buf, m.FinalGroup)
+		buf = quicvarint.Append(buf, m.FinalObject)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	return buf
+}
+
+// GoAway is a GOAWAY message.
+type GoAway struct {
+	NewSessionURI string
+}
+
+func (m *GoAway) typ() uint64 {
+	return messageTypeGoAway
+}
+
+func (m *GoAway) unmarshal(buf *buffer) error {
+	var err error
+	m.NewSessionURI, err = buf.readString()
+	return err
+}
+
+func (m *GoAway) marshal(buf []byte) []byte {
+	return appendString(buf, m.NewSessionURI)
+}
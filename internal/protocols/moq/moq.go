@@ -0,0 +1,224 @@
+// Package moq contains a Media over QUIC Transport (MoQT) implementation.
+// It follows draft-ietf-moq-transport-07, with control messages exchanged
+// on a bidirectional stream and objects delivered on unidirectional streams.
+package moq
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Version is the supported protocol version.
+const Version = 0xff000007
+
+// setup parameters.
+const (
+	SetupParameterRole           = 0x00
+	SetupParameterPath           = 0x01
+	SetupParameterMaxSubscribeID = 0x02
+)
+
+// roles.
+const (
+	RolePublisher  = 0x01
+	RoleSubscriber = 0x02
+	RolePubSub     = 0x03
+)
+
+// subscribe parameters.
+const (
+	SubscribeParameterAuthorizationInfo = 0x02
+)
+
+// filter types.
+const (
+	FilterLatestGroup   = 0x1
+	FilterLatestObject  = 0x2
+	FilterAbsoluteStart = 0x3
+	FilterAbsoluteRange = 0x4
+)
+
+// group orders.
+const (
+	GroupOrderPublisher  = 0x0
+	GroupOrderAscending  = 0x1
+	GroupOrderDescending = 0x2
+)
+
+// subscribe error codes.
+const (
+	SubscribeErrorInternal        = 0x0
+	SubscribeErrorInvalidRange    = 0x1
+	SubscribeErrorRetryTrackAlias = 0x2
+)
+
+// subscribe done status codes.
+const (
+	SubscribeDoneUnsubscribed  = 0x0
+	SubscribeDoneInternalError = 0x1
+	SubscribeDoneUnauthorized  = 0x2
+	SubscribeDoneTrackEnded    = 0x3
+	SubscribeDoneGoingAway     = 0x5
+)
+
+// session termination codes.
+const (
+	TerminationNoError           = 0x0
+	TerminationInternalError     = 0x1
+	TerminationUnauthorized      = 0x2
+	TerminationProtocolViolation = 0x3
+)
+
+// Parameters are setup or subscribe parameters.
+type Parameters map[uint64][]byte
+
+// Varint returns the value of a parameter encoded as variable-length integer.
+func (p Parameters) Varint(key uint64) (uint64, bool) {
+	buf, ok := p[key]
+	if !ok {
+		return 0, false
+	}
+
+	v, n, err := quicvarint.Parse(buf)
+	if err != nil || n != len(buf) {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// SetVarint sets the value of a parameter encoded as variable-length integer.
+func (p Parameters) SetVarint(key uint64, v uint64) {
+	p[key] = quicvarint.Append(nil, v)
+}
+
+type buffer struct {
+	buf []byte
+}
+
+func (b *buffer) readVarint() (uint64, error) {
+	v, n, err := quicvarint.Parse(b.buf)
+	if err != nil {
+		return 0, fmt.Errorf("not enough bytes")
+	}
+	b.buf = b.buf[n:]
+	return v, nil
+}
+
+func (b *buffer) readByte() (byte, error) {
+	if len(b.buf) < 1 {
+		return 0, fmt.Errorf("not enough bytes")
+	}
+	v := b.buf[0]
+	b.buf = b.buf[1:]
+	return v, nil
+}
+
+func (b *buffer) readBytes() ([]byte, error) {
+	l, err := b.readVarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if uint64(len(b.buf)) < l {
+		return nil, fmt.Errorf("not enough bytes")
+	}
+
+	v := b.buf[:l]
+	b.buf = b.buf[l:]
+	return v, nil
+}
+
+func (b *buffer) readString() (string, error) {
+	v, err := b.readBytes()
+	return string(v), err
+}
+
+func (b *buffer) readTuple() ([]string, error) {
+	n, err := b.readVarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 32 {
+		return nil, fmt.Errorf("too many tuple elements")
+	}
+
+	ret := make([]string, n)
+
+	for i := range ret {
+		ret[i], err = b.readString()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+func (b *buffer) readParameters() (Parameters, error) {
+	n, err := b.readVarint()
+	if err != nil {
+		return nil, err
+	}
+
+	if n > 64 {
+		return nil, fmt.Errorf("too many parameters")
+	}
+
+	ret := make(Parameters)
+
+	for range n {
+		var key uint64
+		key, err = b.readVarint()
+		if err != nil {
+			return nil, err
+		}
+
+		var val []byte
+		val, err = b.readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := ret[key]; ok {
+			return nil, fmt.Errorf("duplicate parameter: %d", key)
+		}
+
+		ret[key] = val
+	}
+
+	return ret, nil
+}
+
+func appendBytes(buf []byte, v []byte) []byte {
+	buf = quicvarint.Append(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func appendString(buf []byte, v string) []byte {
+	return appendBytes(buf, []byte(v))
+}
+
+func appendTuple(buf []byte, v []string) []byte {
+	buf = quicvarint.Append(buf, uint64(len(v)))
+	for _, e := range v {
+		buf = appendString(buf, e)
+	}
+	return buf
+}
+
+func appendParameters(buf []byte, p Parameters) []byte {
+	buf = quicvarint.Append(buf, uint64(len(p)))
+
+	// parameters are written in ascending order to obtain a deterministic output.
+	for _, key := range slices.Sorted(maps.Keys(p)) {
+		buf = quicvarint.Append(buf, key)
+		buf = appendBytes(buf, p[key])
+	}
+
+	return buf
+}
@@ -0,0 +1,203 @@
+package moq
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/require"
+)
+
+var casesMessage = []struct {
+	name string
+	enc  []byte
+	dec  Message
+}{
+	{
+		"client setup",
+		[]byte{
+			0x40, 0x40, 0x0d, 0x01, 0xc0, 0x00, 0x00, 0x00,
+			0xff, 0x00, 0x00, 0x07, 0x01, 0x00, 0x01, 0x02,
+		},
+		&ClientSetup{
+			SupportedVersions: []uint64{Version},
+			Parameters: Parameters{
+				SetupParameterRole: []byte{RoleSubscriber},
+			},
+		},
+	},
+	{
+		"server setup",
+		[]byte{
+			0x40, 0x41, 0x0c, 0xc0, 0x00, 0x00, 0x00, 0xff,
+			0x00, 0x00, 0x07, 0x01, 0x00, 0x01, 0x01,
+		},
+		&ServerSetup{
+			SelectedVersion: Version,
+			Parameters: Parameters{
+				SetupParameterRole: []byte{RolePublisher},
+			},
+		},
+	},
+	{
+		"subscribe",
+		[]byte{
+			0x03, 0x19, 0x01, 0x02, 0x01, 0x0a, 0x74, 0x65,
+			0x73, 0x74, 0x73, 0x74, 0x72, 0x65, 0x61, 0x6d,
+			0x06, 0x76, 0x69, 0x64, 0x65, 0x6f, 0x31, 0x80,
+			0x01, 0x01, 0x00,
+		},
+		&Subscribe{
+			SubscribeID:        1,
+			TrackAlias:         2,
+			TrackNamespace:     []string{"teststream"},
+			TrackName:          "video1",
+			SubscriberPriority: 128,
+			GroupOrder:         GroupOrderAscending,
+			FilterType:         FilterLatestGroup,
+			Parameters:         Parameters{},
+		},
+	},
+	{
+		"subscribe absolute range",
+		[]byte{
+			0x03, 0x0f, 0x01, 0x02, 0x01, 0x01, 0x61, 0x01,
+			0x62, 0x80, 0x00, 0x04, 0x05, 0x00, 0x07, 0x03,
+			0x00,
+		},
+		&Subscribe{
+			SubscribeID:        1,
+			TrackAlias:         2,
+			TrackNamespace:     []string{"a"},
+			TrackName:          "b",
+			SubscriberPriority: 128,
+			GroupOrder:         GroupOrderPublisher,
+			FilterType:         FilterAbsoluteRange,
+			StartGroup:         5,
+			StartObject:        0,
+			EndGroup:           7,
+			EndObject:          3,
+			Parameters:         Parameters{},
+		},
+	},
+	{
+		"subscribe ok",
+		[]byte{0x04, 0x06, 0x01, 0x00, 0x01, 0x01, 0x05, 0x03},
+		&SubscribeOK{
+			SubscribeID:     1,
+			GroupOrder:      GroupOrderAscending,
+			ContentExists:   true,
+			LargestGroupID:  5,
+			LargestObjectID: 3,
+		},
+	},
+	{
+		"subscribe error",
+		[]byte{
+			0x05, 0x0a, 0x01, 0x00, 0x06, 0x66, 0x61, 0x69,
+			0x6c, 0x65, 0x64, 0x02,
+		},
+		&SubscribeError{
+			SubscribeID:  1,
+			ErrorCode:    SubscribeErrorInternal,
+			ReasonPhrase: "failed",
+			TrackAlias:   2,
+		},
+	},
+	{
+		"unsubscribe",
+		[]byte{0x0a, 0x01, 0x01},
+		&Unsubscribe{
+			SubscribeID: 1,
+		},
+	},
+	{
+		"subscribe done",
+		[]byte{0x0b, 0x04, 0x01, 0x03, 0x00, 0x00},
+		&SubscribeDone{
+			SubscribeID: 1,
+			StatusCode:  SubscribeDoneTrackEnded,
+		},
+	},
+	{
+		"goaway",
+		[]byte{0x10, 0x02, 0x01, 0x61},
+		&GoAway{
+			NewSessionURI: "a",
+		},
+	},
+	{
+		"unknown",
+		[]byte{0x11, 0x02, 0x01, 0x02},
+		&Unknown{
+			Type:    0x11,
+			Payload: []byte{1, 2},
+		},
+	},
+}
+
+func TestMessageRead(t *testing.T) {
+	for _, ca := range casesMessage {
+		t.Run(ca.name, func(t *testing.T) {
+			msg, err := ReadMessage(quicvarint.NewReader(bytes.NewReader(ca.enc)))
+			require.NoError(t, err)
+			require.Equal(t, ca.dec, msg)
+		})
+	}
+}
+
+func TestMessageMarshal(t *testing.T) {
+	for _, ca := range casesMessage {
+		t.Run(ca.name, func(t *testing.T) {
+			require.Equal(t, ca.enc, MarshalMessage(ca.dec))
+		})
+	}
+}
+
+func TestObject(t *testing.T) {
+	h := SubgroupHeader{
+		SubscribeID:       1,
+		TrackAlias:        2,
+		GroupID:           3,
+		SubgroupID:        0,
+		PublisherPriority: 128,
+	}
+
+	var buf []byte
+	buf = append(buf, h.Marshal()...)
+	buf = append(buf, Object{ID: 0, Payload: []byte{1, 2, 3}}.Marshal()...)
+	buf = append(buf, Object{ID: 1, Status: ObjectStatusEndOfGroup}.Marshal()...)
+
+	require.Equal(t, []byte{
+		0x04, 0x01, 0x02, 0x03, 0x00, 0x80, 0x00, 0x03,
+		0x01, 0x02, 0x03, 0x01, 0x00, 0x03,
+	}, buf)
+
+	r := quicvarint.NewReader(bytes.NewReader(buf))
+
+	var h2 SubgroupHeader
+	err := h2.Read(r)
+	require.NoError(t, err)
+	require.Equal(t, h, h2)
+
+	var o Object
+	err = o.Read(r)
+	require.NoError(t, err)
+	require.Equal(t, Object{ID: 0, Payload: []byte{1, 2, 3}}, o)
+
+	err = o.Read(r)
+	require.NoError(t, err)
+	require.Equal(t, Object{ID: 1, Status: ObjectStatusEndOfGroup}, o)
+}
+
+func TestParameters(t *testing.T) {
+	p := Parameters{}
+	p.SetVarint(SetupParameterMaxSubscribeID, 1000)
+
+	v, ok := p.Varint(SetupParameterMaxSubscribeID)
+	require.True(t, ok)
+	require.Equal(t, uint64(1000), v)
+
+	_, ok = p.Varint(SetupParameterRole)
+	require.False(t, ok)
+}
@@ -0,0 +1,125 @@
+package moq
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+const (
+	streamTypeSubgroup = 0x04
+
+	maxObjectSize = 32 * 1024 * 1024
+)
+
+// object statuses.
+const (
+	ObjectStatusNormal             = 0x0
+	ObjectStatusDoesNotExist       = 0x1
+	ObjectStatusEndOfGroup         = 0x3
+	ObjectStatusEndOfTrackAndGroup = 0x4
+)
+
+// SubgroupHeader is the header of a unidirectional stream
+// that carries the objects of a subgroup.
+type SubgroupHeader struct {
+	SubscribeID       uint64
+	TrackAlias        uint64
+	GroupID           uint64
+	SubgroupID        uint64
+	PublisherPriority uint8
+}
+
+// Read reads a SubgroupHeader.
+func (h *SubgroupHeader) Read(r quicvarint.Reader) error {
+	typ, err := quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	if typ != streamTypeSubgroup {
+		return fmt.Errorf("unsupported stream type: %d", typ)
+	}
+
+	h.SubscribeID, err = quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	h.TrackAlias, err = quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	h.GroupID, err = quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	h.SubgroupID, err = quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	h.PublisherPriority, err = r.ReadByte()
+	return err
+}
+
+// Marshal encodes a SubgroupHeader.
+func (h SubgroupHeader) Marshal() []byte {
+	buf := quicvarint.Append(nil, streamTypeSubgroup)
+	buf = quicvarint.Append(buf, h.SubscribeID)
+	buf = quicvarint.Append(buf, h.TrackAlias)
+	buf = quicvarint.Append(buf, h.GroupID)
+	buf = quicvarint.Append(buf, h.SubgroupID)
+	return append(buf, h.PublisherPriority)
+}
+
+// Object is an object inside a subgroup stream.
+type Object struct {
+	ID      uint64
+	Status  uint64
+	Payload []byte
+}
+
+// Read reads an Object.
+func (o *Object) Read(r quicvarint.Reader) error {
+	var err error
+	o.ID, err = quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	le, err := quicvarint.Read(r)
+	if err != nil {
+		return err
+	}
+
+	if le == 0 {
+		o.Payload = nil
+		o.Status, err = quicvarint.Read(r)
+		return err
+	}
+
+	if le > maxObjectSize {
+		return fmt.Errorf("object size (%d) is too big", le)
+	}
+
+	o.Status = ObjectStatusNormal
+	o.Payload = make([]byte, le)
+	_, err = io.ReadFull(r, o.Payload)
+	return err
+}
+
+// Marshal encodes an Object.
+func (o Object) Marshal() []byte {
+	buf := quicvarint.Append(nil, o.ID)
+	buf = quicvarint.Append(buf, uint64(len(o.Payload)))
+
+	if len(o.Payload) == 0 {
+		return quicvarint.Append(buf, o.Status)
+	}
+
+	return append(buf, o.Payload...)
+}
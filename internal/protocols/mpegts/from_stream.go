@@ -3,6 +3,7 @@ package mpegts
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
@@ -11,7 +12,6 @@ import (
 	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
 	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
 	mcmpegts "github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
-	srt "github.com/datarhei/gosrt"
 
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/stream"
@@ -25,13 +25,20 @@ func multiplyAndDivide(v, m, d int64) int64 {
 }
 
 // FromStream maps a MediaMTX stream to a MPEG-TS writer.
+// When nconn is not nil, a write deadline is set on it before every write.
 func FromStream(
 	strea *stream.Stream,
 	reader stream.Reader,
 	bw *bufio.Writer,
-	sconn srt.Conn,
+	nconn net.Conn,
 	writeTimeout time.Duration,
 ) error {
+	setWriteDeadline := func() {
+		if nconn != nil {
+			nconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		}
+	}
+
 	var w *mcmpegts.Writer
 	var tracks []*mcmpegts.Track
 	setuppedFormats := make(map[format.Format]struct{})
@@ -82,7 +89,7 @@ func FromStream(
 							return err
 						}
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err = (*w).WriteH265(
 							track,
 							tunit.PTS, // no conversion is needed since clock rate is 90khz in both MPEG-TS and RTSP
@@ -124,7 +131,7 @@ func FromStream(
 							return err
 						}
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err = (*w).WriteH264(
 							track,
 							tunit.PTS, // no conversion is needed since clock rate is 90khz in both MPEG-TS and RTSP
@@ -159,7 +166,7 @@ func FromStream(
 						}
 						lastPTS = tunit.PTS
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err := (*w).WriteMPEG4Video(
 							track,
 							tunit.PTS, // no conversion is needed since clock rate is 90khz in both MPEG-TS and RTSP
@@ -193,7 +200,7 @@ func FromStream(
 						}
 						lastPTS = tunit.PTS
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err := (*w).WriteMPEG1Video(
 							track,
 							tunit.PTS, // no conversion is needed since clock rate is 90khz in both MPEG-TS and RTSP
@@ -219,7 +226,7 @@ func FromStream(
 							return nil
 						}
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err := (*w).WriteOpus(
 							track,
 							multiplyAndDivide(tunit.PTS, 90000, int64(clockRate)),
@@ -247,7 +254,7 @@ func FromStream(
 								return nil
 							}
 
-							sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+							setWriteDeadline()
 							err := (*w).WriteMPEG4Audio(
 								track,
 								multiplyAndDivide(tunit.PTS, 90000, int64(clockRate)),
@@ -272,7 +279,7 @@ func FromStream(
 							return nil
 						}
 
-						sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+						setWriteDeadline()
 						err := (*w).WriteMPEG1Audio(
 							track,
 							tunit.PTS, // no conversion is needed since clock rate is 90khz in both MPEG-TS and RTSP
@@ -299,7 +306,7 @@ func FromStream(
 						for i, frame := range tunit.Frames {
 							framePTS := tunit.PTS + int64(i)*ac3.SamplesPerFrame
 
-							sconn.SetWriteDeadline(time.Now().Add(writeTimeout))
+							setWriteDeadline()
 							err := (*w).WriteAC3(
 								track,
 								multiplyAndDivide(framePTS, 90000, int64(clockRate)),
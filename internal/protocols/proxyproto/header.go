@@ -0,0 +1,172 @@
+// Package proxyproto contains a HAProxy PROXY protocol v1/v2 implementation.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	v1MaxLength    = 107
+	v2HeaderLength = 16
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Header is a PROXY protocol header.
+type Header struct {
+	// source address. It is nil when the header does not contain any address
+	// (v1 UNKNOWN or v2 LOCAL), in which case the connection address must be used.
+	SourceIP   net.IP
+	SourcePort int
+}
+
+// ReadHeader reads a PROXY protocol header, v1 or v2, from a stream.
+func ReadHeader(r io.Reader) (*Header, error) {
+	// 12 bytes are enough to distinguish between v1 and v2,
+	// and are less than the minimum length of both.
+	buf := make([]byte, len(v2Signature))
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(buf, v2Signature) {
+		buf = append(buf, make([]byte, v2HeaderLength-len(v2Signature))...)
+		_, err = io.ReadFull(r, buf[len(v2Signature):])
+		if err != nil {
+			return nil, err
+		}
+
+		l := int(binary.BigEndian.Uint16(buf[14:16]))
+		buf = append(buf, make([]byte, l)...)
+		_, err = io.ReadFull(r, buf[v2HeaderLength:])
+		if err != nil {
+			return nil, err
+		}
+
+		h, _, err := ParseV2(buf)
+		return h, err
+	}
+
+	if !bytes.HasPrefix(buf, []byte("PROXY ")) {
+		return nil, fmt.Errorf("PROXY protocol header not found")
+	}
+
+	// read until \r\n, one byte at a time, in order not to consume payload.
+	b := make([]byte, 1)
+	for {
+		if len(buf) >= v1MaxLength {
+			return nil, fmt.Errorf("PROXY protocol v1 header is too long")
+		}
+
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, b[0])
+
+		if b[0] == '\n' {
+			break
+		}
+	}
+
+	return parseV1(buf)
+}
+
+func parseV1(buf []byte) (*Header, error) {
+	if !bytes.HasSuffix(buf, []byte("\r\n")) {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header")
+	}
+
+	parts := strings.Split(string(buf[:len(buf)-2]), " ")
+
+	if len(parts) >= 2 && parts[1] == "UNKNOWN" {
+		return &Header{}, nil
+	}
+
+	if len(parts) != 6 || (parts[1] != "TCP4" && parts[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol v1 header")
+	}
+
+	ip := net.ParseIP(parts[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid source IP: %s", parts[2])
+	}
+
+	if parts[1] == "TCP4" {
+		ip = ip.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source IP: %s", parts[2])
+		}
+	}
+
+	port, err := strconv.ParseUint(parts[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source port: %s", parts[4])
+	}
+
+	return &Header{
+		SourceIP:   ip,
+		SourcePort: int(port),
+	}, nil
+}
+
+// ParseV2 parses a PROXY protocol v2 header at the beginning of a buffer.
+// It returns the header and its length.
+func ParseV2(buf []byte) (*Header, int, error) {
+	if len(buf) < v2HeaderLength || !bytes.Equal(buf[:len(v2Signature)], v2Signature) {
+		return nil, 0, fmt.Errorf("PROXY protocol v2 header not found")
+	}
+
+	if (buf[12] >> 4) != 2 {
+		return nil, 0, fmt.Errorf("unsupported PROXY protocol version: %d", buf[12]>>4)
+	}
+
+	l := int(binary.BigEndian.Uint16(buf[14:16]))
+	if len(buf) < v2HeaderLength+l {
+		return nil, 0, fmt.Errorf("PROXY protocol v2 header is truncated")
+	}
+
+	body := buf[v2HeaderLength : v2HeaderLength+l]
+	n := v2HeaderLength + l
+
+	switch buf[12] & 0x0F {
+	case 0: // LOCAL
+		return &Header{}, n, nil
+
+	case 1: // PROXY
+
+	default:
+		return nil, 0, fmt.Errorf("unsupported PROXY protocol command: %d", buf[12]&0x0F)
+	}
+
+	switch buf[13] >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, 0, fmt.Errorf("PROXY protocol v2 addresses are truncated")
+		}
+		return &Header{
+			SourceIP:   net.IP(append([]byte(nil), body[0:4]...)),
+			SourcePort: int(binary.BigEndian.Uint16(body[8:10])),
+		}, n, nil
+
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, 0, fmt.Errorf("PROXY protocol v2 addresses are truncated")
+		}
+		return &Header{
+			SourceIP:   net.IP(append([]byte(nil), body[0:16]...)),
+			SourcePort: int(binary.BigEndian.Uint16(body[32:34])),
+		}, n, nil
+
+	default: // AF_UNSPEC, AF_UNIX
+		return &Header{}, n, nil
+	}
+}
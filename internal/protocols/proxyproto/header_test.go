@@ -0,0 +1,101 @@
+package proxyproto
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var casesHeader = []struct {
+	name string
+	byts []byte
+	h    *Header
+}{
+	{
+		"v1 tcp4",
+		[]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"),
+		&Header{
+			SourceIP:   net.ParseIP("192.168.0.1").To4(),
+			SourcePort: 56324,
+		},
+	},
+	{
+		"v1 tcp6",
+		[]byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"),
+		&Header{
+			SourceIP:   net.ParseIP("2001:db8::1"),
+			SourcePort: 56324,
+		},
+	},
+	{
+		"v1 unknown",
+		[]byte("PROXY UNKNOWN\r\n"),
+		&Header{},
+	},
+	{
+		"v2 ipv4",
+		append([]byte("\r\n\r\n\x00\r\nQUIT\n"),
+			0x21, 0x11, 0x00, 0x0c,
+			192, 168, 0, 1,
+			192, 168, 0, 11,
+			0xdc, 0x04,
+			0x01, 0xbb),
+		&Header{
+			SourceIP:   net.IP{192, 168, 0, 1},
+			SourcePort: 56324,
+		},
+	},
+	{
+		"v2 local",
+		append([]byte("\r\n\r\n\x00\r\nQUIT\n"),
+			0x20, 0x00, 0x00, 0x00),
+		&Header{},
+	},
+}
+
+func TestReadHeader(t *testing.T) {
+	for _, ca := range casesHeader {
+		t.Run(ca.name, func(t *testing.T) {
+			r := bytes.NewReader(append(append([]byte(nil), ca.byts...), []byte("payload")...))
+
+			h, err := ReadHeader(r)
+			require.NoError(t, err)
+			require.Equal(t, ca.h, h)
+
+			// payload must not be consumed
+			require.Equal(t, len("payload"), r.Len())
+		})
+	}
+}
+
+func TestReadHeaderErrors(t *testing.T) {
+	for _, ca := range []struct {
+		name string
+		byts []byte
+		err  string
+	}{
+		{
+			"missing",
+			[]byte("OPTIONS rtsp://localhost RTSP/1.0\r\n"),
+			"PROXY protocol header not found",
+		},
+		{
+			"v1 invalid ip",
+			[]byte("PROXY TCP4 invalid 192.168.0.11 56324 443\r\n"),
+			"invalid source IP: invalid",
+		},
+		{
+			"v2 unsupported command",
+			append([]byte("\r\n\r\n\x00\r\nQUIT\n"),
+				0x22, 0x00, 0x00, 0x00),
+			"unsupported PROXY protocol command: 2",
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			_, err := ReadHeader(bytes.NewReader(ca.byts))
+			require.EqualError(t, err, ca.err)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package proxyproto
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+type conn struct {
+	net.Conn
+	remoteAddr net.Addr
+}
+
+// RemoteAddr implements net.Conn.
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// Listener is a net.Listener that reads PROXY protocol headers
+// of connections coming from trusted sources.
+// Headers are read in dedicated routines in order not to block Accept().
+type Listener struct {
+	Listener       net.Listener
+	TrustedSources conf.IPNetworks
+	ReadTimeout    time.Duration
+
+	chConn  chan net.Conn
+	chErr   chan error
+	done    chan struct{}
+	closeMu sync.Once
+}
+
+// Initialize initializes Listener.
+func (l *Listener) Initialize() {
+	l.chConn = make(chan net.Conn)
+	l.chErr = make(chan error, 1)
+	l.done = make(chan struct{})
+
+	go l.run()
+}
+
+func (l *Listener) run() {
+	for {
+		nconn, err := l.Listener.Accept()
+		if err != nil {
+			l.chErr <- err
+			return
+		}
+
+		go l.handleConn(nconn)
+	}
+}
+
+func (l *Listener) handleConn(nconn net.Conn) {
+	c, err := l.readHeader(nconn)
+	if err != nil {
+		nconn.Close()
+		return
+	}
+
+	select {
+	case l.chConn <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *Listener) readHeader(nconn net.Conn) (net.Conn, error) {
+	tcpAddr, ok := nconn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !l.TrustedSources.Contains(tcpAddr.IP) {
+		return nconn, nil
+	}
+
+	nconn.SetReadDeadline(time.Now().Add(l.ReadTimeout))
+	h, err := ReadHeader(nconn)
+	if err != nil {
+		return nil, err
+	}
+	nconn.SetReadDeadline(time.Time{})
+
+	if h.SourceIP == nil {
+		return nconn, nil
+	}
+
+	return &conn{
+		Conn: nconn,
+		remoteAddr: &net.TCPAddr{
+			IP:   h.SourceIP,
+			Port: h.SourcePort,
+		},
+	}, nil
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.chConn:
+		return c, nil
+
+	case err := <-l.chErr:
+		// make the error available to further calls.
+		l.chErr <- err
+		return nil, err
+	}
+}
+
+// Close implements net.Listener.
+func (l *Listener) Close() error {
+	err := l.Listener.Close()
+	l.closeMu.Do(func() {
+		close(l.done)
+	})
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return l.Listener.Addr()
+}
+
+// Listen creates a TCP listener that reads PROXY protocol headers
+// of connections coming from trusted sources.
+func Listen(
+	network string,
+	address string,
+	trustedSources conf.IPNetworks,
+	readTimeout time.Duration,
+) (net.Listener, error) {
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		Listener:       ln,
+		TrustedSources: trustedSources,
+		ReadTimeout:    readTimeout,
+	}
+	l.Initialize()
+
+	return l, nil
+}
@@ -0,0 +1,62 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestListener(t *testing.T) {
+	for _, ca := range []string{"trusted", "untrusted"} {
+		t.Run(ca, func(t *testing.T) {
+			var trustedSources conf.IPNetworks
+			if ca == "trusted" {
+				_, ne, _ := net.ParseCIDR("127.0.0.1/32")
+				trustedSources = conf.IPNetworks{*ne}
+			}
+
+			ln, err := Listen("tcp", "127.0.0.1:9123", trustedSources, 10*time.Second)
+			require.NoError(t, err)
+			defer ln.Close()
+
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+
+				nconn, err2 := net.Dial("tcp", "127.0.0.1:9123")
+				require.NoError(t, err2)
+				defer nconn.Close()
+
+				if ca == "trusted" {
+					_, err2 = nconn.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+					require.NoError(t, err2)
+				}
+
+				_, err2 = nconn.Write([]byte("payload"))
+				require.NoError(t, err2)
+			}()
+
+			nconn, err := ln.Accept()
+			require.NoError(t, err)
+			defer nconn.Close()
+
+			if ca == "trusted" {
+				require.Equal(t, "192.168.0.1:56324", nconn.RemoteAddr().String())
+			} else {
+				require.Equal(t, "127.0.0.1", nconn.RemoteAddr().(*net.TCPAddr).IP.String())
+			}
+
+			buf := make([]byte, len("payload"))
+			_, err = nconn.Read(buf)
+			require.NoError(t, err)
+			require.Equal(t, []byte("payload"), buf)
+
+			<-done
+		})
+	}
+}
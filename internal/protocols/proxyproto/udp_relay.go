@@ -0,0 +1,199 @@
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+const (
+	udpRelayBufferSize = 2048
+)
+
+type udpRelaySession struct {
+	src          net.Addr
+	realAddr     *net.UDPAddr
+	conn         *net.UDPConn
+	lastActivity atomic.Int64
+}
+
+// UDPRelay receives datagrams on a public address, strips PROXY protocol v2 headers
+// from datagrams coming from trusted sources and forwards datagrams to a target address,
+// through a dedicated socket for each client. This allows to recover the client address
+// when the target is a listener that cannot be wrapped, by using RealAddr().
+// Datagrams from untrusted sources, and datagrams from trusted sources that don't start
+// with a PROXY protocol v2 signature, are forwarded unchanged.
+type UDPRelay struct {
+	Address        string
+	Target         string
+	TrustedSources conf.IPNetworks
+	IdleTimeout    time.Duration
+
+	// called when a datagram from a trusted source has a malformed header.
+	OnInvalidHeader func(src net.Addr, err error)
+
+	pc         net.PacketConn
+	targetAddr *net.UDPAddr
+	mutex      sync.RWMutex
+	sessions   map[string]*udpRelaySession
+	byLocal    map[string]*udpRelaySession
+	wg         sync.WaitGroup
+}
+
+// Initialize initializes UDPRelay.
+func (r *UDPRelay) Initialize() error {
+	var err error
+	r.targetAddr, err = net.ResolveUDPAddr("udp", r.Target)
+	if err != nil {
+		return err
+	}
+
+	r.pc, err = net.ListenPacket("udp", r.Address)
+	if err != nil {
+		return err
+	}
+
+	r.sessions = make(map[string]*udpRelaySession)
+	r.byLocal = make(map[string]*udpRelaySession)
+
+	r.wg.Add(1)
+	go r.run()
+
+	return nil
+}
+
+// Close closes UDPRelay.
+func (r *UDPRelay) Close() {
+	r.pc.Close()
+
+	r.mutex.Lock()
+	for _, sess := range r.sessions {
+		sess.conn.Close()
+	}
+	r.mutex.Unlock()
+
+	r.wg.Wait()
+}
+
+// RealAddr returns the client address of a datagram
+// that has been forwarded to the target from the given address.
+// If the address does not belong to the relay, it is returned unchanged.
+func (r *UDPRelay) RealAddr(addr net.Addr) net.Addr {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if sess, ok := r.byLocal[addr.String()]; ok {
+		return sess.realAddr
+	}
+	return addr
+}
+
+func (r *UDPRelay) run() {
+	defer r.wg.Done()
+
+	buf := make([]byte, udpRelayBufferSize)
+
+	for {
+		n, src, err := r.pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		payload := buf[:n]
+		realAddr := src.(*net.UDPAddr)
+
+		if r.TrustedSources.Contains(realAddr.IP) && bytes.HasPrefix(payload, v2Signature) {
+			h, hl, err := ParseV2(payload)
+			if err != nil {
+				if r.OnInvalidHeader != nil {
+					r.OnInvalidHeader(src, err)
+				}
+				continue
+			}
+
+			payload = payload[hl:]
+
+			if h.SourceIP != nil {
+				realAddr = &net.UDPAddr{IP: h.SourceIP, Port: h.SourcePort}
+			}
+		}
+
+		sess, err := r.session(src, realAddr)
+		if err != nil {
+			continue
+		}
+
+		sess.lastActivity.Store(time.Now().Unix())
+		sess.conn.Write(payload) //nolint:errcheck
+	}
+}
+
+func (r *UDPRelay) session(src net.Addr, realAddr *net.UDPAddr) (*udpRelaySession, error) {
+	key := src.String() + "/" + realAddr.String()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if sess, ok := r.sessions[key]; ok {
+		return sess, nil
+	}
+
+	c, err := net.DialUDP("udp", nil, r.targetAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &udpRelaySession{
+		src:      src,
+		realAddr: realAddr,
+		conn:     c,
+	}
+	sess.lastActivity.Store(time.Now().Unix())
+
+	r.sessions[key] = sess
+	r.byLocal[c.LocalAddr().String()] = sess
+
+	r.wg.Add(1)
+	go r.runSession(key, sess)
+
+	return sess, nil
+}
+
+// runSession forwards datagrams from the target to the client
+// and removes the session when it becomes idle.
+func (r *UDPRelay) runSession(key string, sess *udpRelaySession) {
+	defer r.wg.Done()
+
+	defer func() {
+		r.mutex.Lock()
+		delete(r.sessions, key)
+		delete(r.byLocal, sess.conn.LocalAddr().String())
+		r.mutex.Unlock()
+		sess.conn.Close()
+	}()
+
+	buf := make([]byte, udpRelayBufferSize)
+
+	for {
+		sess.conn.SetReadDeadline(time.Now().Add(r.IdleTimeout))
+		n, err := sess.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) &&
+				time.Since(time.Unix(sess.lastActivity.Load(), 0)) < r.IdleTimeout {
+				continue
+			}
+			return
+		}
+
+		_, err = r.pc.WriteTo(buf[:n], sess.src)
+		if err != nil {
+			return
+		}
+	}
+}
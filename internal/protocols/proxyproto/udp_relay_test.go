@@ -0,0 +1,100 @@
+package proxyproto
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+)
+
+func TestUDPRelay(t *testing.T) {
+	target, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer target.Close()
+
+	_, ne, _ := net.ParseCIDR("127.0.0.1/32")
+
+	r := &UDPRelay{
+		Address:        "127.0.0.1:9124",
+		Target:         target.LocalAddr().String(),
+		TrustedSources: conf.IPNetworks{*ne},
+		IdleTimeout:    10 * time.Second,
+	}
+	err = r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	client, err := net.Dial("udp", "127.0.0.1:9124")
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.Write(append([]byte("\r\n\r\n\x00\r\nQUIT\n"),
+		0x21, 0x12, 0x00, 0x0c,
+		192, 168, 0, 1,
+		192, 168, 0, 11,
+		0xdc, 0x04,
+		0x01, 0xbb,
+		'p', 'i', 'n', 'g'))
+	require.NoError(t, err)
+
+	buf := make([]byte, 1500)
+	n, addr, err := target.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("ping"), buf[:n])
+	require.Equal(t, "192.168.0.1:56324", r.RealAddr(addr).String())
+
+	_, err = target.WriteTo([]byte("pong"), addr)
+	require.NoError(t, err)
+
+	n, err = client.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, []byte("pong"), buf[:n])
+}
+
+func TestUDPRelayWithoutHeader(t *testing.T) {
+	for _, ca := range []string{
+		"trusted",
+		"untrusted",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			target, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer target.Close()
+
+			var trusted conf.IPNetworks
+			if ca == "trusted" {
+				_, ne, _ := net.ParseCIDR("127.0.0.1/32")
+				trusted = conf.IPNetworks{*ne}
+			} else {
+				_, ne, _ := net.ParseCIDR("10.0.0.0/8")
+				trusted = conf.IPNetworks{*ne}
+			}
+
+			r := &UDPRelay{
+				Address:        "127.0.0.1:9124",
+				Target:         target.LocalAddr().String(),
+				TrustedSources: trusted,
+				IdleTimeout:    10 * time.Second,
+			}
+			err = r.Initialize()
+			require.NoError(t, err)
+			defer r.Close()
+
+			client, err := net.Dial("udp", "127.0.0.1:9124")
+			require.NoError(t, err)
+			defer client.Close()
+
+			_, err = client.Write([]byte("ping"))
+			require.NoError(t, err)
+
+			buf := make([]byte, 1500)
+			n, addr, err := target.ReadFrom(buf)
+			require.NoError(t, err)
+			require.Equal(t, []byte("ping"), buf[:n])
+			require.Equal(t, client.LocalAddr().String(), r.RealAddr(addr).String())
+		})
+	}
+}
@@ -0,0 +1,305 @@
+// Package ps contains a MPEG Program Stream (ISO/IEC 13818-1) demuxer and muxer.
+package ps
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// start codes.
+const (
+	startCodePack         = 0xBA
+	startCodeSystemHeader = 0xBB
+	startCodePSM          = 0xBC
+)
+
+// StreamType is the type of an elementary stream, as found in the program stream map.
+type StreamType uint8
+
+// stream types.
+const (
+	StreamTypeMPEG4Audio StreamType = 0x0F
+	StreamTypeH264       StreamType = 0x1B
+	StreamTypeH265       StreamType = 0x24
+	StreamTypeG711A      StreamType = 0x90
+	StreamTypeG711U      StreamType = 0x91
+)
+
+// Packet is the payload of an elementary stream,
+// obtained by merging consecutive PES packets with the same timestamp.
+type Packet struct {
+	StreamID   uint8
+	StreamType StreamType
+	HasPTS     bool
+	PTS        int64
+	Data       []byte
+}
+
+func isPESStreamID(id uint8) bool {
+	return (id >= 0xC0 && id <= 0xEF) || id == 0xBD
+}
+
+func decodePTS(buf []byte) int64 {
+	return int64(buf[0]>>1&0x07)<<30 |
+		int64(buf[1])<<22 |
+		int64(buf[2]>>1)<<15 |
+		int64(buf[3])<<7 |
+		int64(buf[4]>>1)
+}
+
+func encodePTS(buf []byte, pts int64) {
+	buf[0] = 0x21 | byte(pts>>29)&0x0E
+	buf[1] = byte(pts >> 22)
+	buf[2] = 0x01 | byte(pts>>14)&0xFE
+	buf[3] = byte(pts >> 7)
+	buf[4] = 0x01 | byte(pts<<1)
+}
+
+// findStartCode returns the position of the next start code with a value
+// greater or equal than startCodePack, or -1.
+func findStartCode(buf []byte, pos int) int {
+	for i := pos; i+3 < len(buf); i++ {
+		if buf[i] == 0 && buf[i+1] == 0 && buf[i+2] == 1 && buf[i+3] >= startCodePack {
+			return i
+		}
+	}
+	return -1
+}
+
+// Demuxer extracts elementary streams from a program stream.
+type Demuxer struct {
+	streamTypes map[uint8]StreamType
+}
+
+// Initialize initializes Demuxer.
+func (d *Demuxer) Initialize() {
+	d.streamTypes = make(map[uint8]StreamType)
+}
+
+// StreamTypes returns the stream types declared in the last program stream map, indexed by stream ID.
+func (d *Demuxer) StreamTypes() map[uint8]StreamType {
+	return d.streamTypes
+}
+
+// Decode decodes a chunk of program stream.
+// Data that precedes the first start code is discarded.
+func (d *Demuxer) Decode(buf []byte) ([]*Packet, error) {
+	var out []*Packet
+	last := make(map[uint8]*Packet)
+
+	pos := findStartCode(buf, 0)
+	if pos < 0 {
+		return nil, fmt.Errorf("start code not found")
+	}
+
+	for pos < len(buf) {
+		if len(buf)-pos < 4 || buf[pos] != 0 || buf[pos+1] != 0 || buf[pos+2] != 1 {
+			return out, fmt.Errorf("invalid start code")
+		}
+
+		id := buf[pos+3]
+
+		switch {
+		case id == startCodePack:
+			if len(buf)-pos < 5 {
+				return out, fmt.Errorf("pack header is too short")
+			}
+
+			// MPEG-2
+			if (buf[pos+4] & 0xC0) == 0x40 {
+				if len(buf)-pos < 14 {
+					return out, fmt.Errorf("pack header is too short")
+				}
+				pos += 14 + int(buf[pos+13]&0x07)
+			} else { // MPEG-1
+				pos += 12
+			}
+
+		case id == 0xB9: // program end
+			pos += 4
+
+		default:
+			if len(buf)-pos < 6 {
+				return out, fmt.Errorf("packet is too short")
+			}
+
+			le := int(binary.BigEndian.Uint16(buf[pos+4:]))
+			payload := buf[pos+6:]
+
+			if le == 0 {
+				// PES packets with unbounded length last until the next start code
+				next := findStartCode(buf, pos+6)
+				if next < 0 {
+					next = len(buf)
+				}
+				le = next - pos - 6
+			} else if le > len(payload) {
+				return out, fmt.Errorf("packet is truncated")
+			}
+
+			payload = payload[:le]
+			pos += 6 + le
+
+			switch {
+			case id == startCodePSM:
+				err := d.decodePSM(payload)
+				if err != nil {
+					return out, err
+				}
+
+			case isPESStreamID(id):
+				pkt, err := d.decodePES(id, payload)
+				if err != nil {
+					return out, err
+				}
+
+				// merge PES packets that belong to the same frame
+				if prev, ok := last[id]; ok && (!pkt.HasPTS || (prev.HasPTS && pkt.PTS == prev.PTS)) {
+					prev.Data = append(prev.Data, pkt.Data...)
+					continue
+				}
+
+				last[id] = pkt
+				out = append(out, pkt)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (d *Demuxer) decodePSM(buf []byte) error {
+	if len(buf) < 4 {
+		return fmt.Errorf("program stream map is too short")
+	}
+
+	infoLen := int(binary.BigEndian.Uint16(buf[2:]))
+	buf = buf[4:]
+	if len(buf) < infoLen+2 {
+		return fmt.Errorf("program stream map is too short")
+	}
+	buf = buf[infoLen:]
+
+	mapLen := int(binary.BigEndian.Uint16(buf))
+	buf = buf[2:]
+	if len(buf) < mapLen {
+		return fmt.Errorf("program stream map is too short")
+	}
+	buf = buf[:mapLen]
+
+	streamTypes := make(map[uint8]StreamType)
+
+	for len(buf) >= 4 {
+		typ := StreamType(buf[0])
+		id := buf[1]
+		esInfoLen := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf) < 4+esInfoLen {
+			return fmt.Errorf("program stream map is too short")
+		}
+		buf = buf[4+esInfoLen:]
+
+		streamTypes[id] = typ
+	}
+
+	d.streamTypes = streamTypes
+	return nil
+}
+
+func (d *Demuxer) decodePES(id uint8, buf []byte) (*Packet, error) {
+	pkt := &Packet{
+		StreamID:   id,
+		StreamType: d.streamTypes[id],
+	}
+
+	if len(buf) < 3 || (buf[0]&0xC0) != 0x80 {
+		return nil, fmt.Errorf("unsupported PES header")
+	}
+
+	headerLen := int(buf[2])
+	if len(buf) < 3+headerLen {
+		return nil, fmt.Errorf("PES header is too short")
+	}
+
+	if (buf[1]&0x80) != 0 && headerLen >= 5 {
+		pkt.HasPTS = true
+		pkt.PTS = decodePTS(buf[3:])
+	}
+
+	pkt.Data = buf[3+headerLen:]
+	return pkt, nil
+}
+
+// Muxer generates a program stream.
+type Muxer struct {
+	// stream types, indexed by stream ID.
+	StreamTypes map[uint8]StreamType
+}
+
+// Marshal encodes a frame into a pack.
+// A program stream map is prepended when withPSM is true.
+func (m *Muxer) Marshal(streamID uint8, pts int64, data []byte, withPSM bool) []byte {
+	buf := make([]byte, 14)
+	buf[2] = 1
+	buf[3] = startCodePack
+	scr := pts - 3600
+	buf[4] = 0x44 | byte(scr>>27)&0x38 | byte(scr>>28)&0x03
+	buf[5] = byte(scr >> 20)
+	buf[6] = 0x04 | byte(scr>>12)&0xF8 | byte(scr>>13)&0x03
+	buf[7] = byte(scr >> 5)
+	buf[8] = 0x04 | byte(scr<<3)&0xF8
+	buf[9] = 0x01
+	buf[10] = 0x01 // mux rate
+	buf[11] = 0x89
+	buf[12] = 0xC3
+	buf[13] = 0xF8 // no stuffing
+
+	if withPSM {
+		var entries []byte
+		for id, typ := range m.StreamTypes {
+			entries = append(entries, byte(typ), id, 0, 0)
+		}
+
+		psm := []byte{0, 0, 1, startCodePSM, 0, 0, 0xE0, 0xFF, 0, 0}
+		psm = binary.BigEndian.AppendUint16(psm, uint16(len(entries)))
+		psm = append(psm, entries...)
+		psm = append(psm, 0, 0, 0, 0) // CRC, ignored by demuxers
+		binary.BigEndian.PutUint16(psm[4:], uint16(len(psm)-6))
+		buf = append(buf, psm...)
+	}
+
+	const maxPayloadSize = 0xFFFF - 8
+	first := true
+
+	for {
+		n := len(data)
+		if n > maxPayloadSize-5 {
+			n = maxPayloadSize - 5
+		}
+
+		var header []byte
+		if first {
+			header = make([]byte, 14)
+			header[6] = 0x80
+			header[7] = 0x80
+			header[8] = 5
+			encodePTS(header[9:], pts)
+		} else {
+			header = make([]byte, 9)
+			header[6] = 0x80
+		}
+		header[2] = 1
+		header[3] = streamID
+		binary.BigEndian.PutUint16(header[4:], uint16(len(header)-6+n))
+
+		buf = append(buf, header...)
+		buf = append(buf, data[:n]...)
+		data = data[n:]
+		first = false
+
+		if len(data) == 0 {
+			break
+		}
+	}
+
+	return buf
+}
@@ -0,0 +1,69 @@
+package ps
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDemuxer(t *testing.T) {
+	m := &Muxer{
+		StreamTypes: map[uint8]StreamType{
+			0xE0: StreamTypeH264,
+			0xC0: StreamTypeG711A,
+		},
+	}
+
+	video := bytes.Repeat([]byte{1, 2, 3, 4}, 40000)
+	audio := []byte{5, 6, 7, 8}
+
+	var buf []byte
+	buf = append(buf, m.Marshal(0xE0, 90000, video, true)...)
+	buf = append(buf, m.Marshal(0xC0, 90450, audio, false)...)
+
+	d := &Demuxer{}
+	d.Initialize()
+
+	pkts, err := d.Decode(buf)
+	require.NoError(t, err)
+	require.Equal(t, []*Packet{
+		{
+			StreamID:   0xE0,
+			StreamType: StreamTypeH264,
+			HasPTS:     true,
+			PTS:        90000,
+			Data:       video,
+		},
+		{
+			StreamID:   0xC0,
+			StreamType: StreamTypeG711A,
+			HasPTS:     true,
+			PTS:        90450,
+			Data:       audio,
+		},
+	}, pkts)
+
+	// stream types are kept across packs
+	pkts, err = d.Decode(m.Marshal(0xE0, 93600, []byte{9}, false))
+	require.NoError(t, err)
+	require.Equal(t, []*Packet{{
+		StreamID:   0xE0,
+		StreamType: StreamTypeH264,
+		HasPTS:     true,
+		PTS:        93600,
+		Data:       []byte{9},
+	}}, pkts)
+}
+
+func TestDemuxerErrors(t *testing.T) {
+	d := &Demuxer{}
+	d.Initialize()
+
+	_, err := d.Decode([]byte{1, 2, 3})
+	require.EqualError(t, err, "start code not found")
+
+	buf := (&Muxer{}).Marshal(0xE0, 0, []byte{1, 2, 3}, false)
+	_, err = d.Decode(buf[:len(buf)-1])
+	require.EqualError(t, err, "packet is truncated")
+}
@@ -0,0 +1,464 @@
+package rist
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+const (
+	tickPeriod          = 10 * time.Millisecond
+	rtcpPeriod          = 100 * time.Millisecond
+	minNACKInterval     = 20 * time.Millisecond
+	defaultNACKInterval = 50 * time.Millisecond
+	maxNACKRetries      = 10
+	maxSequenceGap      = 8192
+)
+
+func randUint32() (uint32, error) {
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return 0, err
+	}
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), nil
+}
+
+// Stats are the statistics of a Receiver.
+type Stats struct {
+	// RTP packets received, including retransmitted and duplicate packets.
+	PacketsReceived uint64
+	// retransmitted RTP packets received.
+	PacketsRetransmitted uint64
+	// missing RTP packets that were recovered through retransmissions.
+	PacketsRecovered uint64
+	// missing RTP packets that were not received in time.
+	PacketsLost uint64
+	// RTP packets that were received more than once or too late.
+	PacketsDuplicate uint64
+	// retransmission requests sent.
+	PacketsNACKed uint64
+	// bytes received, including retransmitted and duplicate packets.
+	BytesReceived uint64
+	// round-trip time, measured with RTT echo requests.
+	RTT time.Duration
+}
+
+type missingPacket struct {
+	detected time.Time
+	lastNACK time.Time
+	nacks    int
+}
+
+// Receiver is a RIST Simple Profile receiver.
+// It reorders incoming RTP packets, requests the retransmission
+// of missing packets with RTCP NACKs and returns MPEG-TS data in order.
+type Receiver struct {
+	// Maximum time to wait for the retransmission of a missing packet.
+	BufferSize time.Duration
+	// Maximum time to wait for data in Read(). Zero means no timeout.
+	ReadTimeout time.Duration
+	// CNAME sent in RTCP SDES packets.
+	CNAME string
+	// Called when RTCP packets must be sent to the sender.
+	WriteRTCP func([]byte) error
+	// Called when the CNAME of the sender is received for the first time.
+	OnSenderCNAME func(string)
+
+	ssrc      uint32
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+
+	mutex          sync.Mutex
+	initialized    bool
+	senderSSRC     uint32
+	senderCNAME    string
+	expected       uint16
+	highest        uint16
+	cycles         uint32
+	buffer         map[uint16][]byte
+	missing        map[uint16]*missingPacket
+	queue          [][]byte
+	lastSR         uint32
+	lastSRReceived time.Time
+	stats          Stats
+
+	chQueue chan struct{}
+}
+
+// Initialize initializes Receiver.
+func (r *Receiver) Initialize() error {
+	var err error
+	r.ssrc, err = randUint32()
+	if err != nil {
+		return err
+	}
+
+	// the least significant bit of the SSRC is reserved for retransmissions.
+	r.ssrc &^= 1
+
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.buffer = make(map[uint16][]byte)
+	r.missing = make(map[uint16]*missingPacket)
+	r.chQueue = make(chan struct{}, 1)
+
+	r.wg.Add(1)
+	go r.run()
+
+	return nil
+}
+
+// Close closes Receiver.
+func (r *Receiver) Close() {
+	r.ctxCancel()
+	r.wg.Wait()
+}
+
+func (r *Receiver) run() {
+	defer r.wg.Done()
+
+	t := time.NewTicker(tickPeriod)
+	defer t.Stop()
+
+	var lastRTCP time.Time
+
+	for {
+		select {
+		case <-t.C:
+			now := time.Now()
+
+			r.mutex.Lock()
+			r.flush(now)
+			pkts := r.nackPackets(now)
+			if pkts == nil && now.Sub(lastRTCP) >= rtcpPeriod {
+				pkts = r.reportPackets(now)
+				lastRTCP = now
+			}
+			r.mutex.Unlock()
+
+			if pkts != nil {
+				r.writeRTCP(pkts)
+			}
+
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Receiver) writeRTCP(pkts []rtcp.Packet) {
+	buf, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return
+	}
+	r.WriteRTCP(buf) //nolint:errcheck
+}
+
+func (r *Receiver) reset(seq uint16) {
+	// deliver what has been received so far, skipping missing packets.
+	if r.initialized {
+		for s := r.expected; s != r.highest+1; s++ {
+			if payload, ok := r.buffer[s]; ok {
+				r.enqueue(payload)
+			}
+		}
+	}
+
+	r.initialized = true
+	r.expected = seq
+	r.highest = seq - 1
+	r.buffer = make(map[uint16][]byte)
+	r.missing = make(map[uint16]*missingPacket)
+}
+
+func (r *Receiver) enqueue(payload []byte) {
+	// discard packets that do not contain MPEG-TS packets.
+	if len(payload) == 0 || (len(payload)%188) != 0 {
+		return
+	}
+
+	r.queue = append(r.queue, payload)
+
+	select {
+	case r.chQueue <- struct{}{}:
+	default:
+	}
+}
+
+// flush delivers packets in order, giving up on missing packets
+// that have not been received within the buffer size.
+func (r *Receiver) flush(now time.Time) {
+	if !r.initialized {
+		return
+	}
+
+	for {
+		if payload, ok := r.buffer[r.expected]; ok {
+			delete(r.buffer, r.expected)
+			r.enqueue(payload)
+			r.expected++
+			continue
+		}
+
+		m, ok := r.missing[r.expected]
+		if !ok || now.Sub(m.detected) < r.BufferSize {
+			return
+		}
+
+		delete(r.missing, r.expected)
+		r.stats.PacketsLost++
+		r.expected++
+	}
+}
+
+func (r *Receiver) nackInterval() time.Duration {
+	if r.stats.RTT == 0 {
+		return defaultNACKInterval
+	}
+	return max(r.stats.RTT, minNACKInterval)
+}
+
+func (r *Receiver) nackPackets(now time.Time) []rtcp.Packet {
+	interval := r.nackInterval()
+	var seqs []uint16
+
+	for seq, m := range r.missing {
+		if m.nacks < maxNACKRetries && now.Sub(m.lastNACK) >= interval {
+			m.nacks++
+			m.lastNACK = now
+			seqs = append(seqs, seq)
+		}
+	}
+
+	if seqs == nil {
+		return nil
+	}
+
+	sort.Slice(seqs, func(i, j int) bool {
+		return (seqs[i] - r.expected) < (seqs[j] - r.expected)
+	})
+
+	r.stats.PacketsNACKed += uint64(len(seqs))
+
+	return append(r.reportPackets(now), &rtcp.TransportLayerNack{
+		SenderSSRC: r.ssrc,
+		MediaSSRC:  r.senderSSRC,
+		Nacks:      rtcp.NackPairsFromSequenceNumbers(seqs),
+	})
+}
+
+func (r *Receiver) reportPackets(now time.Time) []rtcp.Packet {
+	rr := &rtcp.ReceiverReport{
+		SSRC: r.ssrc,
+	}
+
+	if r.initialized {
+		report := rtcp.ReceptionReport{
+			SSRC:               r.senderSSRC,
+			TotalLost:          uint32(min(r.stats.PacketsLost, 0x7FFFFF)),
+			LastSequenceNumber: r.cycles<<16 | uint32(r.highest),
+		}
+
+		if !r.lastSRReceived.IsZero() {
+			report.LastSenderReport = r.lastSR
+			report.Delay = uint32(now.Sub(r.lastSRReceived).Seconds() * 65536)
+		}
+
+		rr.Reports = []rtcp.ReceptionReport{report}
+	}
+
+	return []rtcp.Packet{
+		rr,
+		&rtcp.SourceDescription{
+			Chunks: []rtcp.SourceDescriptionChunk{{
+				Source: r.ssrc,
+				Items: []rtcp.SourceDescriptionItem{{
+					Type: rtcp.SDESCNAME,
+					Text: r.CNAME,
+				}},
+			}},
+		},
+		marshalEcho(appSubtypeEchoRequest, r.ssrc, ntpTime(now), 0),
+	}
+}
+
+// ProcessRTP processes a RTP packet received from the sender.
+func (r *Receiver) ProcessRTP(buf []byte) error {
+	var pkt rtp.Packet
+	err := pkt.Unmarshal(buf)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stats.PacketsReceived++
+	r.stats.BytesReceived += uint64(len(buf))
+
+	// retransmitted packets have the least significant bit of the SSRC set.
+	retransmitted := (pkt.SSRC & 1) != 0
+	if retransmitted {
+		r.stats.PacketsRetransmitted++
+	}
+
+	seq := pkt.SequenceNumber
+
+	if !r.initialized || (pkt.SSRC&^1) != r.senderSSRC {
+		r.reset(seq)
+		r.senderSSRC = pkt.SSRC &^ 1
+	}
+
+	diff := int16(seq - r.expected)
+
+	switch {
+	case diff < -maxSequenceGap || diff > maxSequenceGap:
+		// the sender restarted.
+		r.reset(seq)
+
+	case diff < 0:
+		r.stats.PacketsDuplicate++
+		return nil
+	}
+
+	if _, ok := r.buffer[seq]; ok {
+		r.stats.PacketsDuplicate++
+		return nil
+	}
+
+	r.buffer[seq] = append([]byte(nil), pkt.Payload...)
+
+	if int16(seq-r.highest) > 0 {
+		for s := r.highest + 1; s != seq; s++ {
+			r.missing[s] = &missingPacket{detected: now}
+		}
+
+		if seq < r.highest {
+			r.cycles++
+		}
+		r.highest = seq
+	} else if _, ok := r.missing[seq]; ok {
+		delete(r.missing, seq)
+		if retransmitted {
+			r.stats.PacketsRecovered++
+		}
+	}
+
+	r.flush(now)
+
+	return nil
+}
+
+// ProcessRTCP processes a RTCP compound packet received from the sender.
+func (r *Receiver) ProcessRTCP(buf []byte) error {
+	pkts, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var res []rtcp.Packet
+	var newCNAME string
+
+	r.mutex.Lock()
+
+	for _, pkt := range pkts {
+		switch pkt := pkt.(type) {
+		case *rtcp.SenderReport:
+			r.lastSR = uint32(pkt.NTPTime >> 16)
+			r.lastSRReceived = now
+
+		case *rtcp.SourceDescription:
+			for _, chunk := range pkt.Chunks {
+				for _, item := range chunk.Items {
+					if item.Type == rtcp.SDESCNAME && r.senderCNAME == "" && item.Text != "" {
+						r.senderCNAME = item.Text
+						newCNAME = item.Text
+					}
+				}
+			}
+
+		case *rtcp.ApplicationDefined:
+			ntp, delay, ok := unmarshalEcho(pkt)
+			if !ok {
+				continue
+			}
+
+			switch pkt.SubType {
+			case appSubtypeEchoRequest:
+				if res == nil {
+					res = r.reportPackets(now)
+				}
+				res = append(res, marshalEcho(appSubtypeEchoResponse, r.ssrc, ntp, 0))
+
+			case appSubtypeEchoResponse:
+				rtt := now.Sub(ntpTimeToTime(ntp)) - delay
+				if rtt > 0 {
+					r.stats.RTT = rtt
+				}
+			}
+		}
+	}
+
+	r.mutex.Unlock()
+
+	if res != nil {
+		r.writeRTCP(res)
+	}
+
+	if newCNAME != "" && r.OnSenderCNAME != nil {
+		r.OnSenderCNAME(newCNAME)
+	}
+
+	return nil
+}
+
+// Read implements io.Reader. Each call returns the payload of a single RTP packet.
+func (r *Receiver) Read(p []byte) (int, error) {
+	var timeout <-chan time.Time
+	if r.ReadTimeout != 0 {
+		t := time.NewTimer(r.ReadTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	for {
+		r.mutex.Lock()
+		if len(r.queue) != 0 {
+			payload := r.queue[0]
+			r.queue[0] = nil
+			r.queue = r.queue[1:]
+			r.mutex.Unlock()
+			return copy(p, payload), nil
+		}
+		r.mutex.Unlock()
+
+		select {
+		case <-r.chQueue:
+
+		case <-timeout:
+			return 0, fmt.Errorf("no data received in %v", r.ReadTimeout)
+
+		case <-r.ctx.Done():
+			return 0, fmt.Errorf("terminated")
+		}
+	}
+}
+
+// Stats returns statistics.
+func (r *Receiver) Stats() *Stats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s := r.stats
+	return &s
+}
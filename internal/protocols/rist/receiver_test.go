@@ -0,0 +1,203 @@
+package rist
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+)
+
+func marshalRTP(t *testing.T, ssrc uint32, seq uint16, b byte) []byte {
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    PayloadTypeMPEGTS,
+			SequenceNumber: seq,
+			SSRC:           ssrc,
+		},
+		Payload: bytes.Repeat([]byte{b}, 188),
+	}
+	buf, err := pkt.Marshal()
+	require.NoError(t, err)
+	return buf
+}
+
+func readPayload(t *testing.T, r *Receiver) byte {
+	buf := make([]byte, 1500)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 188, n)
+	return buf[0]
+}
+
+func TestReceiverRetransmission(t *testing.T) {
+	chRTCP := make(chan []rtcp.Packet, 64)
+
+	r := &Receiver{
+		BufferSize:  time.Second,
+		ReadTimeout: time.Second,
+		CNAME:       "receiver",
+		WriteRTCP: func(buf []byte) error {
+			pkts, err := rtcp.Unmarshal(buf)
+			require.NoError(t, err)
+			chRTCP <- pkts
+			return nil
+		},
+	}
+	err := r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	err = r.ProcessRTP(marshalRTP(t, 0x1000, 65534, 1))
+	require.NoError(t, err)
+	err = r.ProcessRTP(marshalRTP(t, 0x1000, 65535, 2))
+	require.NoError(t, err)
+	err = r.ProcessRTP(marshalRTP(t, 0x1000, 1, 4))
+	require.NoError(t, err)
+
+	require.Equal(t, byte(1), readPayload(t, r))
+	require.Equal(t, byte(2), readPayload(t, r))
+
+	var nack *rtcp.TransportLayerNack
+	for nack == nil {
+		for _, pkt := range <-chRTCP {
+			if tpkt, ok := pkt.(*rtcp.TransportLayerNack); ok {
+				nack = tpkt
+			}
+		}
+	}
+
+	require.Equal(t, uint32(0x1000), nack.MediaSSRC)
+	require.Equal(t, []rtcp.NackPair{{PacketID: 0}}, nack.Nacks)
+
+	err = r.ProcessRTP(marshalRTP(t, 0x1001, 0, 3))
+	require.NoError(t, err)
+
+	require.Equal(t, byte(3), readPayload(t, r))
+	require.Equal(t, byte(4), readPayload(t, r))
+
+	err = r.ProcessRTP(marshalRTP(t, 0x1001, 0, 3))
+	require.NoError(t, err)
+
+	stats := r.Stats()
+	require.Equal(t, uint64(5), stats.PacketsReceived)
+	require.Equal(t, uint64(2), stats.PacketsRetransmitted)
+	require.Equal(t, uint64(1), stats.PacketsRecovered)
+	require.Equal(t, uint64(1), stats.PacketsDuplicate)
+	require.Equal(t, uint64(0), stats.PacketsLost)
+	require.NotZero(t, stats.PacketsNACKed)
+}
+
+func TestReceiverLoss(t *testing.T) {
+	r := &Receiver{
+		BufferSize:  100 * time.Millisecond,
+		ReadTimeout: time.Second,
+		WriteRTCP: func(_ []byte) error {
+			return nil
+		},
+	}
+	err := r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	err = r.ProcessRTP(marshalRTP(t, 0x1000, 10, 1))
+	require.NoError(t, err)
+	err = r.ProcessRTP(marshalRTP(t, 0x1000, 13, 2))
+	require.NoError(t, err)
+
+	require.Equal(t, byte(1), readPayload(t, r))
+	require.Equal(t, byte(2), readPayload(t, r))
+
+	stats := r.Stats()
+	require.Equal(t, uint64(2), stats.PacketsLost)
+}
+
+func TestReceiverRTCP(t *testing.T) {
+	chRTCP := make(chan []rtcp.Packet, 64)
+	chCNAME := make(chan string, 1)
+
+	r := &Receiver{
+		BufferSize: time.Second,
+		WriteRTCP: func(buf []byte) error {
+			pkts, err := rtcp.Unmarshal(buf)
+			require.NoError(t, err)
+			chRTCP <- pkts
+			return nil
+		},
+		OnSenderCNAME: func(cname string) {
+			chCNAME <- cname
+		},
+	}
+	err := r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	var request *rtcp.ApplicationDefined
+	for request == nil {
+		for _, pkt := range <-chRTCP {
+			if tpkt, ok := pkt.(*rtcp.ApplicationDefined); ok {
+				request = tpkt
+			}
+		}
+	}
+
+	require.Equal(t, uint8(appSubtypeEchoRequest), request.SubType)
+	ntp, _, ok := unmarshalEcho(request)
+	require.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+
+	buf, err := rtcp.Marshal([]rtcp.Packet{
+		&rtcp.SenderReport{SSRC: 0x1000},
+		&rtcp.SourceDescription{
+			Chunks: []rtcp.SourceDescriptionChunk{{
+				Source: 0x1000,
+				Items:  []rtcp.SourceDescriptionItem{{Type: rtcp.SDESCNAME, Text: "mypath"}},
+			}},
+		},
+		marshalEcho(appSubtypeEchoResponse, 0x1000, ntp, 5*time.Millisecond),
+		marshalEcho(appSubtypeEchoRequest, 0x1000, 123456, 0),
+	})
+	require.NoError(t, err)
+
+	err = r.ProcessRTCP(buf)
+	require.NoError(t, err)
+
+	require.Equal(t, "mypath", <-chCNAME)
+
+	rtt := r.Stats().RTT
+	require.Greater(t, rtt, 10*time.Millisecond)
+	require.Less(t, rtt, time.Second)
+
+	var response *rtcp.ApplicationDefined
+	for response == nil {
+		for _, pkt := range <-chRTCP {
+			if tpkt, ok := pkt.(*rtcp.ApplicationDefined); ok && tpkt.SubType == appSubtypeEchoResponse {
+				response = tpkt
+			}
+		}
+	}
+
+	ntp, _, ok = unmarshalEcho(response)
+	require.True(t, ok)
+	require.Equal(t, uint64(123456), ntp)
+}
+
+func TestReceiverReadTimeout(t *testing.T) {
+	r := &Receiver{
+		BufferSize:  time.Second,
+		ReadTimeout: 50 * time.Millisecond,
+		WriteRTCP: func(_ []byte) error {
+			return nil
+		},
+	}
+	err := r.Initialize()
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Read(make([]byte, 1500))
+	require.EqualError(t, err, "no data received in 50ms")
+}
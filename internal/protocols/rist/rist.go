@@ -0,0 +1,130 @@
+// Package rist contains a RIST (Reliable Internet Stream Transport) Simple Profile receiver.
+package rist
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pion/rtcp"
+
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+const (
+	// PayloadTypeMPEGTS is the RTP payload type of MPEG-TS.
+	PayloadTypeMPEGTS = 33
+
+	// name of RIST-specific APP packets.
+	appName = "RIST"
+
+	// subtypes of RIST-specific APP packets, as defined in VSF TR-06-2.
+	appSubtypeEchoRequest  = 2
+	appSubtypeEchoResponse = 3
+
+	// same size as GStreamer's rtspsrc
+	udpKernelReadBufferSize = 0x80000
+)
+
+// Listen opens the RTP and RTCP sockets of a RIST endpoint.
+// RTP is received on the port in address, that must be even,
+// while RTCP is exchanged on the following port.
+// If the port is zero, a random even port is picked.
+func Listen(address string) (net.PacketConn, net.PacketConn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid port: %s", portStr)
+	}
+
+	if port != 0 {
+		if (port % 2) != 0 {
+			return nil, nil, fmt.Errorf("RTP port must be even")
+		}
+		return listenPair(host, int(port))
+	}
+
+	for i := 0; i < 20; i++ {
+		var tmp net.PacketConn
+		tmp, err = net.ListenPacket(restrictnetwork.Restrict("udp", net.JoinHostPort(host, "0")))
+		if err != nil {
+			return nil, nil, err
+		}
+		port := tmp.LocalAddr().(*net.UDPAddr).Port
+		tmp.Close()
+
+		if (port % 2) != 0 {
+			port++
+		}
+
+		var rtpConn, rtcpConn net.PacketConn
+		rtpConn, rtcpConn, err = listenPair(host, port)
+		if err == nil {
+			return rtpConn, rtcpConn, nil
+		}
+	}
+
+	return nil, nil, err
+}
+
+func listenPair(host string, port int) (net.PacketConn, net.PacketConn, error) {
+	rtpConn, err := net.ListenPacket(restrictnetwork.Restrict("udp", net.JoinHostPort(host, strconv.Itoa(port))))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rtcpConn, err := net.ListenPacket(restrictnetwork.Restrict("udp", net.JoinHostPort(host, strconv.Itoa(port+1))))
+	if err != nil {
+		rtpConn.Close()
+		return nil, nil, err
+	}
+
+	rtpConn.(*net.UDPConn).SetReadBuffer(udpKernelReadBufferSize) //nolint:errcheck
+
+	return rtpConn, rtcpConn, nil
+}
+
+func ntpTime(t time.Time) uint64 {
+	s := uint64(t.UnixNano()) + 2208988800*1000000000
+	return (s/1000000000)<<32 | ((s%1000000000)<<32)/1000000000
+}
+
+func ntpTimeToTime(v uint64) time.Time {
+	s := (v>>32)*1000000000 + ((v&0xFFFFFFFF)*1000000000)>>32
+	return time.Unix(0, int64(s-2208988800*1000000000))
+}
+
+// echo packets carry a NTP timestamp and a processing delay in microseconds.
+func marshalEcho(subtype uint8, ssrc uint32, ntp uint64, delay time.Duration) *rtcp.ApplicationDefined {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint64(data, ntp)
+	binary.BigEndian.PutUint32(data[8:], uint32(delay/time.Microsecond))
+
+	return &rtcp.ApplicationDefined{
+		SubType: subtype,
+		SSRC:    ssrc,
+		Name:    appName,
+		Data:    data,
+	}
+}
+
+func unmarshalEcho(pkt *rtcp.ApplicationDefined) (uint64, time.Duration, bool) {
+	if pkt.Name != appName || len(pkt.Data) < 8 {
+		return 0, 0, false
+	}
+
+	ntp := binary.BigEndian.Uint64(pkt.Data)
+
+	var delay time.Duration
+	if len(pkt.Data) >= 12 {
+		delay = time.Duration(binary.BigEndian.Uint32(pkt.Data[8:])) * time.Microsecond
+	}
+
+	return ntp, delay, true
+}
@@ -0,0 +1,22 @@
+package rist
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	_, _, err := Listen("127.0.0.1:9001")
+	require.EqualError(t, err, "RTP port must be even")
+
+	rtpConn, rtcpConn, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	defer rtpConn.Close()
+	defer rtcpConn.Close()
+
+	port := rtpConn.LocalAddr().(*net.UDPAddr).Port
+	require.Zero(t, port%2)
+	require.Equal(t, port+1, rtcpConn.LocalAddr().(*net.UDPAddr).Port)
+}
@@ -0,0 +1,73 @@
+package rtmp
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/rtmp/amf0"
+	"github.com/bluenviron/mediamtx/internal/protocols/rtmp/bytecounter"
+	"github.com/bluenviron/mediamtx/internal/protocols/rtmp/message"
+)
+
+func metadataHasCodec(payload amf0.Data, key string) bool {
+	for _, item := range payload {
+		if obj, ok := item.(amf0.Object); ok {
+			v, ok := obj.GetFloat64(key)
+			return ok && v != 0
+		}
+	}
+	return false
+}
+
+// FLVConn is a write-only Conn that outputs a FLV stream.
+// It allows to use Writer and FromStream to serve HTTP-FLV and WebSocket-FLV.
+type FLVConn struct {
+	W io.Writer
+
+	bc *bytecounter.Writer
+	fw *message.FLVWriter
+}
+
+// Initialize initializes FLVConn.
+func (c *FLVConn) Initialize() {
+	c.bc = bytecounter.NewWriter(c.W)
+	c.fw = &message.FLVWriter{
+		W:        c.bc,
+		HasVideo: true,
+		HasAudio: true,
+	}
+}
+
+// BytesReceived returns the number of bytes received.
+func (c *FLVConn) BytesReceived() uint64 {
+	return 0
+}
+
+// BytesSent returns the number of bytes sent.
+func (c *FLVConn) BytesSent() uint64 {
+	return c.bc.Count()
+}
+
+// Read implements Conn.
+func (c *FLVConn) Read() (message.Message, error) {
+	return nil, fmt.Errorf("FLV connections are write-only")
+}
+
+// Write implements Conn.
+func (c *FLVConn) Write(msg message.Message) error {
+	// metadata is sent with @setDataFrame in RTMP and without it in FLV.
+	// it is also used to fill the FLV header.
+	if data, ok := msg.(*message.DataAMF0); ok &&
+		len(data.Payload) >= 2 && data.Payload[0] == "@setDataFrame" {
+		c.fw.HasVideo = metadataHasCodec(data.Payload, "videocodecid")
+		c.fw.HasAudio = metadataHasCodec(data.Payload, "audiocodecid")
+
+		msg = &message.DataAMF0{
+			ChunkStreamID:   data.ChunkStreamID,
+			MessageStreamID: data.MessageStreamID,
+			Payload:         data.Payload[1:],
+		}
+	}
+
+	return c.fw.Write(msg)
+}
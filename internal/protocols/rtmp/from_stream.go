@@ -3,7 +3,6 @@ package rtmp
 import (
 	"errors"
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
@@ -18,6 +17,12 @@ import (
 var errNoSupportedCodecsFrom = errors.New(
 	"the stream doesn't contain any supported codec, which are currently H264, MPEG-4 Audio, MPEG-1/2 Audio")
 
+// WriteDeadlineSetter allows to set a write deadline.
+// It is implemented by net.Conn and http.ResponseController.
+type WriteDeadlineSetter interface {
+	SetWriteDeadline(t time.Time) error
+}
+
 func multiplyAndDivide2(v, m, d time.Duration) time.Duration {
 	secs := v / d
 	dec := v % d
@@ -32,7 +37,7 @@ func setupVideo(
 	str *stream.Stream,
 	reader stream.Reader,
 	w **Writer,
-	nconn net.Conn,
+	nconn WriteDeadlineSetter,
 	writeTimeout time.Duration,
 ) format.Format {
 	var videoFormatH264 *format.H264
@@ -100,7 +105,7 @@ func setupAudio(
 	str *stream.Stream,
 	reader stream.Reader,
 	w **Writer,
-	nconn net.Conn,
+	nconn WriteDeadlineSetter,
 	writeTimeout time.Duration,
 ) format.Format {
 	var audioFormatMPEG4Audio *format.MPEG4Audio
@@ -188,7 +193,7 @@ func FromStream(
 	str *stream.Stream,
 	reader stream.Reader,
 	conn Conn,
-	nconn net.Conn,
+	nconn WriteDeadlineSetter,
 	writeTimeout time.Duration,
 ) error {
 	var w *Writer
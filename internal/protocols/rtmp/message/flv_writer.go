@@ -0,0 +1,90 @@
+package message
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	flvHeaderSize    = 9
+	flvTagHeaderSize = 11
+)
+
+// FLVWriter writes messages as tags of a FLV stream,
+// in place of a RTMP chunk stream.
+type FLVWriter struct {
+	W        io.Writer
+	HasVideo bool
+	HasAudio bool
+
+	headerWritten bool
+}
+
+// Write writes a message.
+// The FLV header is written together with the first message.
+func (w *FLVWriter) Write(msg Message) error {
+	raw, err := msg.marshal()
+	if err != nil {
+		return err
+	}
+
+	switch Type(raw.Type) {
+	case TypeAudio, TypeVideo, TypeDataAMF0:
+	default:
+		return fmt.Errorf("unsupported message type: %d", raw.Type)
+	}
+
+	if len(raw.Body) > 0xFFFFFF {
+		return fmt.Errorf("message is too big")
+	}
+
+	n := flvTagHeaderSize + len(raw.Body) + 4
+	if !w.headerWritten {
+		n += flvHeaderSize + 4
+	}
+
+	buf := make([]byte, n)
+	pos := 0
+
+	if !w.headerWritten {
+		buf[0] = 'F'
+		buf[1] = 'L'
+		buf[2] = 'V'
+		buf[3] = 1
+		if w.HasAudio {
+			buf[4] |= 0x04
+		}
+		if w.HasVideo {
+			buf[4] |= 0x01
+		}
+		binary.BigEndian.PutUint32(buf[5:], flvHeaderSize)
+		// size of previous tag is zero
+		pos = flvHeaderSize + 4
+	}
+
+	ts := uint32(raw.Timestamp / time.Millisecond)
+
+	buf[pos] = raw.Type
+	buf[pos+1] = byte(len(raw.Body) >> 16)
+	buf[pos+2] = byte(len(raw.Body) >> 8)
+	buf[pos+3] = byte(len(raw.Body))
+	buf[pos+4] = byte(ts >> 16)
+	buf[pos+5] = byte(ts >> 8)
+	buf[pos+6] = byte(ts)
+	buf[pos+7] = byte(ts >> 24)
+	// stream ID is always zero
+	pos += flvTagHeaderSize
+
+	pos += copy(buf[pos:], raw.Body)
+	binary.BigEndian.PutUint32(buf[pos:], uint32(flvTagHeaderSize+len(raw.Body)))
+
+	_, err = w.W.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	w.headerWritten = true
+	return nil
+}
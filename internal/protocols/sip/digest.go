@@ -0,0 +1,70 @@
+package sip
+
+import (
+	"crypto/md5" //nolint:gosec
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+func md5Hex(in string) string {
+	h := md5.Sum([]byte(in)) //nolint:gosec
+	return hex.EncodeToString(h[:])
+}
+
+// DigestParams are the parameters of a Digest authorization header.
+type DigestParams map[string]string
+
+// ParseDigest parses the value of an Authorization or WWW-Authenticate header.
+func ParseDigest(v string) (DigestParams, bool) {
+	v = strings.TrimSpace(v)
+	if len(v) < 7 || !strings.EqualFold(v[:7], "Digest ") {
+		return nil, false
+	}
+
+	params := make(DigestParams)
+
+	for _, p := range strings.Split(v[7:], ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(k)] = strings.Trim(val, `"`)
+	}
+
+	return params, true
+}
+
+// DigestResponse computes the response of a Digest authorization.
+func DigestResponse(params DigestParams, method string, pass string) string {
+	ha1 := md5Hex(params["username"] + ":" + params["realm"] + ":" + pass)
+	ha2 := md5Hex(method + ":" + params["uri"])
+
+	if params["qop"] != "" {
+		return md5Hex(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" +
+			params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+	}
+
+	return md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+}
+
+// DigestChallenge returns the value of a WWW-Authenticate header.
+func DigestChallenge(realm string, nonce string) string {
+	return `Digest realm="` + realm + `",nonce="` + nonce + `",algorithm=MD5`
+}
+
+// DigestValidate checks the value of an Authorization header.
+func DigestValidate(v string, method string, realm string, nonce string, pass string) bool {
+	params, ok := ParseDigest(v)
+	if !ok {
+		return false
+	}
+
+	if params["realm"] != realm || params["nonce"] != nonce {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(
+		[]byte(params["response"]),
+		[]byte(DigestResponse(params, method, pass))) == 1
+}
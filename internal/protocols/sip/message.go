@@ -0,0 +1,273 @@
+// Package sip contains a minimal SIP (RFC 3261) implementation.
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// compact header names.
+var compactHeaders = map[string]string{
+	"i": "Call-ID",
+	"m": "Contact",
+	"l": "Content-Length",
+	"c": "Content-Type",
+	"f": "From",
+	"s": "Subject",
+	"t": "To",
+	"v": "Via",
+}
+
+// headers that are written first, in this order.
+var headerOrder = []string{
+	"Via",
+	"From",
+	"To",
+	"Call-ID",
+	"CSeq",
+}
+
+func canonicalHeader(k string) string {
+	k = strings.TrimSpace(k)
+
+	if v, ok := compactHeaders[strings.ToLower(k)]; ok {
+		return v
+	}
+
+	switch strings.ToLower(k) {
+	case "call-id":
+		return "Call-ID"
+	case "cseq":
+		return "CSeq"
+	case "www-authenticate":
+		return "WWW-Authenticate"
+	}
+
+	parts := strings.Split(strings.ToLower(k), "-")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Header is a set of SIP headers.
+type Header map[string][]string
+
+// Get returns the first value of a header.
+func (h Header) Get(k string) string {
+	v := h[canonicalHeader(k)]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// Set sets the value of a header.
+func (h Header) Set(k string, v string) {
+	h[canonicalHeader(k)] = []string{v}
+}
+
+// Add appends a value to a header.
+func (h Header) Add(k string, v string) {
+	k = canonicalHeader(k)
+	h[k] = append(h[k], v)
+}
+
+// Message is a SIP request or response.
+type Message struct {
+	// request only
+	Method string
+	URI    string
+
+	// response only
+	StatusCode int
+	Reason     string
+
+	Header Header
+	Body   []byte
+}
+
+// IsRequest returns whether the message is a request.
+func (m *Message) IsRequest() bool {
+	return m.Method != ""
+}
+
+// CSeq returns the sequence number and method of the CSeq header.
+func (m *Message) CSeq() (uint32, string) {
+	parts := strings.Fields(m.Header.Get("CSeq"))
+	if len(parts) != 2 {
+		return 0, ""
+	}
+
+	v, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, ""
+	}
+
+	return uint32(v), strings.ToUpper(parts[1])
+}
+
+// Unmarshal decodes a message.
+func (m *Message) Unmarshal(buf []byte) error {
+	i := bytes.Index(buf, []byte("\r\n\r\n"))
+	if i < 0 {
+		return fmt.Errorf("header terminator not found")
+	}
+
+	lines := strings.Split(string(buf[:i]), "\r\n")
+	body := buf[i+4:]
+
+	first := strings.SplitN(lines[0], " ", 3)
+	if len(first) != 3 {
+		return fmt.Errorf("invalid first line: '%s'", lines[0])
+	}
+
+	if strings.HasPrefix(first[0], "SIP/") {
+		var err error
+		m.StatusCode, err = strconv.Atoi(first[1])
+		if err != nil {
+			return fmt.Errorf("invalid status code: '%s'", first[1])
+		}
+		m.Reason = first[2]
+	} else {
+		if first[2] != "SIP/2.0" {
+			return fmt.Errorf("unsupported version: '%s'", first[2])
+		}
+		m.Method = strings.ToUpper(first[0])
+		m.URI = first[1]
+	}
+
+	m.Header = make(Header)
+
+	lastKey := ""
+
+	for _, line := range lines[1:] {
+		// folded line
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && lastKey != "" {
+			vals := m.Header[lastKey]
+			vals[len(vals)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("invalid header: '%s'", line)
+		}
+
+		lastKey = canonicalHeader(k)
+		m.Header.Add(lastKey, strings.TrimSpace(v))
+	}
+
+	if cl := m.Header.Get("Content-Length"); cl != "" {
+		le, err := strconv.Atoi(cl)
+		if err != nil || le < 0 {
+			return fmt.Errorf("invalid Content-Length: '%s'", cl)
+		}
+
+		if le > len(body) {
+			return fmt.Errorf("body is truncated")
+		}
+		body = body[:le]
+	}
+
+	m.Body = body
+	return nil
+}
+
+// Marshal encodes a message.
+func (m *Message) Marshal() []byte {
+	var b strings.Builder
+
+	if m.IsRequest() {
+		b.WriteString(m.Method + " " + m.URI + " SIP/2.0\r\n")
+	} else {
+		b.WriteString("SIP/2.0 " + strconv.Itoa(m.StatusCode) + " " + m.Reason + "\r\n")
+	}
+
+	written := make(map[string]struct{})
+
+	for _, k := range headerOrder {
+		for _, v := range m.Header[k] {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+		written[k] = struct{}{}
+	}
+
+	keys := make([]string, 0, len(m.Header))
+	for k := range m.Header {
+		if _, ok := written[k]; !ok && k != "Content-Length" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		for _, v := range m.Header[k] {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+
+	b.WriteString("Content-Length: " + strconv.Itoa(len(m.Body)) + "\r\n\r\n")
+	b.Write(m.Body)
+
+	return []byte(b.String())
+}
+
+// NewResponse allocates a response to a request.
+func NewResponse(req *Message, statusCode int, reason string) *Message {
+	res := &Message{
+		StatusCode: statusCode,
+		Reason:     reason,
+		Header:     make(Header),
+	}
+
+	for _, k := range []string{"Via", "From", "To", "Call-ID", "CSeq"} {
+		if v, ok := req.Header[k]; ok {
+			res.Header[k] = append([]string(nil), v...)
+		}
+	}
+
+	return res
+}
+
+// URIUser returns the user part of a SIP URI, that can be enclosed in angle brackets
+// and followed by parameters, like in the From and To headers.
+func URIUser(v string) string {
+	if i := strings.Index(v, "<"); i >= 0 {
+		v = v[i+1:]
+		if j := strings.Index(v, ">"); j >= 0 {
+			v = v[:j]
+		}
+	}
+
+	v = strings.TrimPrefix(v, "sip:")
+	v = strings.TrimPrefix(v, "sips:")
+
+	user, _, ok := strings.Cut(v, "@")
+	if !ok {
+		return ""
+	}
+	return user
+}
+
+// HeaderParam returns a parameter of a header value, like the tag of From and To headers.
+func HeaderParam(v string, key string) string {
+	// skip URI parameters
+	if i := strings.LastIndex(v, ">"); i >= 0 {
+		v = v[i+1:]
+	}
+
+	for _, p := range strings.Split(v, ";") {
+		k, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+		if strings.EqualFold(k, key) {
+			return val
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,65 @@
+package sip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageUnmarshal(t *testing.T) {
+	var m Message
+	err := m.Unmarshal([]byte("REGISTER sip:34020000002000000001@3402000000 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.168.1.10:5060;rport;branch=z9hG4bK1\r\n" +
+		"f: <sip:34020000001320000001@3402000000>;tag=abc\r\n" +
+		"To: <sip:34020000001320000001@3402000000>\r\n" +
+		"Call-ID: 1234\r\n" +
+		"CSeq: 1 REGISTER\r\n" +
+		"Expires: 3600\r\n" +
+		"Content-Length: 0\r\n" +
+		"\r\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "REGISTER", m.Method)
+	require.Equal(t, "sip:34020000002000000001@3402000000", m.URI)
+	require.Equal(t, "34020000001320000001", URIUser(m.Header.Get("From")))
+	require.Equal(t, "abc", HeaderParam(m.Header.Get("From"), "tag"))
+	require.Equal(t, "z9hG4bK1", HeaderParam(m.Header.Get("Via"), "branch"))
+
+	seq, method := m.CSeq()
+	require.Equal(t, uint32(1), seq)
+	require.Equal(t, "REGISTER", method)
+
+	res := NewResponse(&m, 200, "OK")
+	res.Header.Set("Expires", "3600")
+	require.Equal(t, "SIP/2.0 200 OK\r\n"+
+		"Via: SIP/2.0/UDP 192.168.1.10:5060;rport;branch=z9hG4bK1\r\n"+
+		"From: <sip:34020000001320000001@3402000000>;tag=abc\r\n"+
+		"To: <sip:34020000001320000001@3402000000>\r\n"+
+		"Call-ID: 1234\r\n"+
+		"CSeq: 1 REGISTER\r\n"+
+		"Expires: 3600\r\n"+
+		"Content-Length: 0\r\n"+
+		"\r\n", string(res.Marshal()))
+
+	var res2 Message
+	err = res2.Unmarshal(res.Marshal())
+	require.NoError(t, err)
+	require.Equal(t, 200, res2.StatusCode)
+	require.False(t, res2.IsRequest())
+}
+
+func TestDigest(t *testing.T) {
+	params, ok := ParseDigest(DigestChallenge("3402000000", "nonce1"))
+	require.True(t, ok)
+
+	params["username"] = "34020000001320000001"
+	params["uri"] = "sip:34020000002000000001@3402000000"
+	params["response"] = DigestResponse(params, "REGISTER", "12345678")
+
+	v := `Digest username="` + params["username"] + `",realm="3402000000",nonce="nonce1",` +
+		`uri="` + params["uri"] + `",response="` + params["response"] + `",algorithm=MD5`
+
+	require.True(t, DigestValidate(v, "REGISTER", "3402000000", "nonce1", "12345678"))
+	require.False(t, DigestValidate(v, "REGISTER", "3402000000", "nonce1", "wrong"))
+	require.False(t, DigestValidate(v, "REGISTER", "3402000000", "nonce2", "12345678"))
+}
@@ -0,0 +1,62 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// ConfigForServer returns a tls.Config for a server.
+// If clientCA is not empty, client certificates are verified against it.
+func ConfigForServer(
+	getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error),
+	clientCA string,
+	clientCertRequired bool,
+) (*tls.Config, error) {
+	cfg := &tls.Config{
+		GetCertificate: getCertificate,
+	}
+
+	if clientCA != "" {
+		byts, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(byts) {
+			return nil, fmt.Errorf("no valid certificates found in '%s'", clientCA)
+		}
+
+		cfg.ClientCAs = pool
+
+		if clientCertRequired {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return cfg, nil
+}
+
+// VerifiedClientCertificate returns the verified client certificate of a connection state, if any.
+func VerifiedClientCertificate(cs *tls.ConnectionState) *x509.Certificate {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return cs.VerifiedChains[0][0]
+}
+
+// ClientCertificate returns the verified client certificate of a connection, if any.
+func ClientCertificate(nconn net.Conn) *x509.Certificate {
+	tconn, ok := nconn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	cs := tconn.ConnectionState()
+	return VerifiedClientCertificate(&cs)
+}
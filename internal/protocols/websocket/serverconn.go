@@ -17,10 +17,17 @@ var (
 	writeTimeout = 2 * time.Second
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(_ *http.Request) bool {
-		return true
-	},
+// OriginAllowed checks whether the Origin header of a request
+// matches the allowed origin. Requests without an Origin header are not sent by browsers
+// and are always allowed.
+func OriginAllowed(allowOrigin string, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || allowOrigin == "*" || origin == allowOrigin
+}
+
+type serverConnMessage struct {
+	typ  int
+	byts []byte
 }
 
 // ServerConn is a server-side WebSocket connection with
@@ -30,14 +37,21 @@ type ServerConn struct {
 
 	// in
 	terminate chan struct{}
-	write     chan []byte
+	write     chan serverConnMessage
 
 	// out
 	writeErr chan error
 }
 
 // NewServerConn allocates a ServerConn.
-func NewServerConn(w http.ResponseWriter, req *http.Request) (*ServerConn, error) {
+// The connection is rejected when its origin is not allowed.
+func NewServerConn(w http.ResponseWriter, req *http.Request, allowOrigin string) (*ServerConn, error) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return OriginAllowed(allowOrigin, r)
+		},
+	}
+
 	wc, err := upgrader.Upgrade(w, req, nil)
 	if err != nil {
 		return nil, err
@@ -46,7 +60,7 @@ func NewServerConn(w http.ResponseWriter, req *http.Request) (*ServerConn, error
 	c := &ServerConn{
 		wc:        wc,
 		terminate: make(chan struct{}),
-		write:     make(chan []byte),
+		write:     make(chan serverConnMessage),
 		writeErr:  make(chan error),
 	}
 
@@ -79,9 +93,9 @@ func (c *ServerConn) run() {
 
 	for {
 		select {
-		case byts := <-c.write:
+		case msg := <-c.write:
 			c.wc.SetWriteDeadline(time.Now().Add(writeTimeout)) //nolint:errcheck
-			err := c.wc.WriteMessage(websocket.TextMessage, byts)
+			err := c.wc.WriteMessage(msg.typ, msg.byts)
 			c.writeErr <- err
 
 		case <-pingTicker.C:
@@ -99,6 +113,11 @@ func (c *ServerConn) ReadJSON(in interface{}) error {
 	return c.wc.ReadJSON(in)
 }
 
+// ReadMessage reads a message.
+func (c *ServerConn) ReadMessage() (int, []byte, error) {
+	return c.wc.ReadMessage()
+}
+
 // WriteJSON writes a JSON object.
 func (c *ServerConn) WriteJSON(in interface{}) error {
 	byts, err := json.Marshal(in)
@@ -106,8 +125,17 @@ func (c *ServerConn) WriteJSON(in interface{}) error {
 		return err
 	}
 
+	return c.writeMessage(websocket.TextMessage, byts)
+}
+
+// WriteBinary writes a binary message.
+func (c *ServerConn) WriteBinary(byts []byte) error {
+	return c.writeMessage(websocket.BinaryMessage, byts)
+}
+
+func (c *ServerConn) writeMessage(typ int, byts []byte) error {
 	select {
-	case c.write <- byts:
+	case c.write <- serverConnMessage{typ: typ, byts: byts}:
 		return <-c.writeErr
 	case <-c.terminate:
 		return fmt.Errorf("terminated")
@@ -17,7 +17,7 @@ func TestServerConn(t *testing.T) {
 
 	s := &http.Server{
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, err := NewServerConn(w, r)
+			c, err := NewServerConn(w, r, "*")
 			require.NoError(t, err)
 			defer c.Close()
 
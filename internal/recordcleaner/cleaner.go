@@ -3,26 +3,113 @@ package recordcleaner
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/recordstore"
 )
 
+const (
+	sizeCheckInterval = 10 * time.Second
+)
+
 var timeNow = time.Now
 
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+type deleteReason string
+
+const (
+	deleteReasonDeleteAfter  deleteReason = "deleteAfter"
+	deleteReasonMaxSize      deleteReason = "maxSize"
+	deleteReasonMaxTotalSize deleteReason = "maxTotalSize"
+	deleteReasonMinFreeSpace deleteReason = "minFreeSpace"
+)
+
+type segment struct {
+	pathName string
+	pathConf *conf.Path
+	locks    *recordstore.Locks
+	matches  []string
+	fpath    string
+	start    time.Time
+	end      time.Time
+	size     uint64
+	last     bool
+	deleted  bool
+}
+
+func (s *segment) locked() bool {
+	end := s.end
+	if end.IsZero() {
+		end = timeNow()
+	}
+
+	return s.pathConf.RecordLockedRanges.Overlaps(s.start, end) ||
+		s.locks.Overlaps(s.pathName, s.start, end)
+}
+
+// sortCandidates returns segments that can be deleted to free space,
+// ordered by path priority and then by age.
+// The most recent segment of each path is skipped since it may still be in use.
+func sortCandidates(segments []*segment) []*segment {
+	var out []*segment
+
+	for _, seg := range segments {
+		if !seg.deleted && !seg.last && !seg.locked() {
+			out = append(out, seg)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].pathConf.RecordPriority != out[j].pathConf.RecordPriority {
+			return out[i].pathConf.RecordPriority < out[j].pathConf.RecordPriority
+		}
+		return out[i].start.Before(out[j].start)
+	})
+
+	return out
+}
+
+type deletionKey struct {
+	path   string
+	reason deleteReason
+}
+
+type cleanerMetrics interface {
+	SetRecordCleaner(defs.APIRecordCleaner)
+}
+
 // Cleaner removes expired recording segments from disk.
 type Cleaner struct {
-	PathConfs map[string]*conf.Path
-	Parent    logger.Writer
+	PathConfs       map[string]*conf.Path
+	MaxTotalSize    conf.StringSize
+	MinFreeSpace    conf.StringSize
+	Index           *recordstore.Index
+	Locks           *recordstore.Locks
+	Manifests       *recordstore.ManifestWriter
+	ExternalCmdPool *externalcmd.Pool
+	Metrics         cleanerMetrics
+	Parent          logger.Writer
 
 	ctx       context.Context
 	ctxCancel func()
+	mutex     sync.Mutex
+	deletions map[deletionKey]*defs.APIRecordDeletion
 
 	chReloadConf chan map[string]*conf.Path
 	done         chan struct{}
@@ -31,14 +118,23 @@ type Cleaner struct {
 // Initialize initializes a Cleaner.
 func (c *Cleaner) Initialize() {
 	c.ctx, c.ctxCancel = context.WithCancel(context.Background())
+	c.deletions = make(map[deletionKey]*defs.APIRecordDeletion)
 	c.chReloadConf = make(chan map[string]*conf.Path)
 	c.done = make(chan struct{})
 
+	if !interfaceIsEmpty(c.Metrics) {
+		c.Metrics.SetRecordCleaner(c)
+	}
+
 	go c.run()
 }
 
 // Close closes the Cleaner.
 func (c *Cleaner) Close() {
+	if !interfaceIsEmpty(c.Metrics) {
+		c.Metrics.SetRecordCleaner(nil)
+	}
+
 	c.ctxCancel()
 	<-c.done
 }
@@ -56,6 +152,30 @@ func (c *Cleaner) ReloadPathConfs(pathConfs map[string]*conf.Path) {
 	}
 }
 
+// APIDeletionsList is called by metrics.
+func (c *Cleaner) APIDeletionsList() *defs.APIRecordDeletionList {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data := &defs.APIRecordDeletionList{
+		Items: []*defs.APIRecordDeletion{},
+	}
+
+	for _, d := range c.deletions {
+		dup := *d
+		data.Items = append(data.Items, &dup)
+	}
+
+	sort.Slice(data.Items, func(i, j int) bool {
+		if data.Items[i].Path != data.Items[j].Path {
+			return data.Items[i].Path < data.Items[j].Path
+		}
+		return data.Items[i].Reason < data.Items[j].Reason
+	})
+
+	return data
+}
+
 func (c *Cleaner) run() {
 	defer close(c.done)
 
@@ -75,6 +195,20 @@ func (c *Cleaner) run() {
 	}
 }
 
+func (c *Cleaner) sizeLimited() bool {
+	if c.MaxTotalSize != 0 || c.MinFreeSpace != 0 {
+		return true
+	}
+
+	for _, e := range c.PathConfs {
+		if e.RecordMaxSize != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *Cleaner) cleanInterval() time.Duration {
 	interval := 30 * 60 * time.Second
 
@@ -83,6 +217,18 @@ func (c *Cleaner) cleanInterval() time.Duration {
 			interval > (time.Duration(e.RecordDeleteAfter)/2) {
 			interval = time.Duration(e.RecordDeleteAfter) / 2
 		}
+
+		for _, p := range e.RecordTrackPolicies {
+			deleteAfter := p.PathConf(e).RecordDeleteAfter
+			if deleteAfter != 0 &&
+				interval > (time.Duration(deleteAfter)/2) {
+				interval = time.Duration(deleteAfter) / 2
+			}
+		}
+	}
+
+	if c.sizeLimited() && interval > sizeCheckInterval {
+		interval = sizeCheckInterval
 	}
 
 	return interval
@@ -91,46 +237,306 @@ func (c *Cleaner) cleanInterval() time.Duration {
 func (c *Cleaner) doRun() {
 	now := timeNow()
 
-	pathNames := recordstore.FindAllPathsWithSegments(c.PathConfs)
+	pathNames := c.Index.FindAllPathsWithSegments(c.PathConfs)
+
+	var all []*segment
 
 	for _, pathName := range pathNames {
-		c.processPath(now, pathName) //nolint:errcheck
+		segments, err := c.processPath(now, pathName)
+		if err == nil {
+			all = append(all, segments...)
+		}
+	}
+
+	c.enforceMaxTotalSize(all)
+	c.enforceMinFreeSpace(all)
+
+	pathConfs := make(map[*conf.Path]struct{})
+
+	for _, seg := range all {
+		if seg.deleted {
+			pathConfs[seg.pathConf] = struct{}{}
+		}
+	}
+
+	for pathConf := range pathConfs {
+		c.deleteEmptyDirs(pathConf)
 	}
 }
 
-func (c *Cleaner) processPath(now time.Time, pathName string) error {
-	pathConf, _, err := conf.FindPathConf(c.PathConfs, pathName)
+func (c *Cleaner) processPath(now time.Time, pathName string) ([]*segment, error) {
+	pathConf, matches, err := conf.FindPathConf(c.PathConfs, pathName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if pathConf.RecordDeleteAfter == 0 {
-		return nil
+	var segments []*segment
+
+	// recordings of track policies have their own retention
+	for _, recordConf := range pathConf.RecordConfs() {
+		recordSegments, err := c.processRecording(now, recordConf, pathName, matches)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, recordSegments...)
 	}
 
-	err = c.deleteExpiredSegments(now, pathName, pathConf)
+	return segments, nil
+}
+
+func (c *Cleaner) processRecording(
+	now time.Time,
+	pathConf *conf.Path,
+	pathName string,
+	matches []string,
+) ([]*segment, error) {
+	if pathConf.RecordDeleteAfter == 0 && !c.sizeLimited() {
+		return nil, nil
+	}
+
+	segments, err := c.findSegments(pathConf, pathName, matches)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	c.deleteEmptyDirs(pathConf)
+	if pathConf.RecordDeleteAfter != 0 {
+		c.deleteExpiredSegments(now, segments)
+	}
 
-	return nil
+	if pathConf.RecordMaxSize != 0 {
+		c.deleteExceedingSegments(segments)
+	}
+
+	return segments, nil
 }
 
-func (c *Cleaner) deleteExpiredSegments(now time.Time, pathName string, pathConf *conf.Path) error {
-	end := now.Add(-time.Duration(pathConf.RecordDeleteAfter))
-	segments, err := recordstore.FindSegments(pathConf, pathName, nil, &end)
+func (c *Cleaner) findSegments(pathConf *conf.Path, pathName string, matches []string) ([]*segment, error) {
+	segments, err := c.Index.FindSegments(pathConf, pathName, nil, nil)
 	if err != nil {
-		return err
+		if errors.Is(err, recordstore.ErrNoSegmentsFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	out := make([]*segment, 0, len(segments))
+
+	for i, seg := range segments {
+		s := &segment{
+			pathName: pathName,
+			pathConf: pathConf,
+			locks:    c.Locks,
+			matches:  matches,
+			fpath:    seg.Fpath,
+			start:    seg.Start,
+			size:     seg.Size,
+		}
+
+		if i == (len(segments) - 1) {
+			s.last = true
+		} else {
+			s.end = segments[i+1].Start
+		}
+
+		// size of complete segments is provided by the index, if available.
+		if s.last || s.size == 0 {
+			fi, err := os.Stat(seg.Fpath)
+			if err != nil {
+				// segment has been removed by someone else
+				c.Index.RemoveSegment(pathName, seg.Fpath)
+				continue
+			}
+
+			s.size = uint64(fi.Size())
+
+			if s.last {
+				s.end = fi.ModTime()
+			}
+		}
+
+		out = append(out, s)
+	}
+
+	return out, nil
+}
+
+func (c *Cleaner) deleteExpiredSegments(now time.Time, segments []*segment) {
+	for _, seg := range segments {
+		end := now.Add(-time.Duration(seg.pathConf.RecordDeleteAfter))
+
+		if end.Before(seg.start) {
+			break
+		}
+
+		if !seg.locked() {
+			c.deleteSegment(seg, deleteReasonDeleteAfter)
+		}
 	}
+}
+
+func (c *Cleaner) deleteExceedingSegments(segments []*segment) {
+	var size uint64
 
 	for _, seg := range segments {
-		c.Log(logger.Debug, "removing %s", seg.Fpath)
-		os.Remove(seg.Fpath)
+		if !seg.deleted {
+			size += seg.size
+		}
+	}
+
+	for _, seg := range sortCandidates(segments) {
+		if size <= uint64(seg.pathConf.RecordMaxSize) {
+			break
+		}
+
+		if c.deleteSegment(seg, deleteReasonMaxSize) {
+			size -= seg.size
+		}
+	}
+}
+
+func (c *Cleaner) enforceMaxTotalSize(segments []*segment) {
+	if c.MaxTotalSize == 0 {
+		return
+	}
+
+	var size uint64
+
+	for _, seg := range segments {
+		if !seg.deleted {
+			size += seg.size
+		}
+	}
+
+	for _, seg := range sortCandidates(segments) {
+		if size <= uint64(c.MaxTotalSize) {
+			break
+		}
+
+		if c.deleteSegment(seg, deleteReasonMaxTotalSize) {
+			size -= seg.size
+		}
+	}
+}
+
+func (c *Cleaner) enforceMinFreeSpace(segments []*segment) {
+	if c.MinFreeSpace == 0 {
+		return
+	}
+
+	type volumeEntry struct {
+		free     uint64
+		segments []*segment
+	}
+
+	volumes := make(map[string]*volumeEntry)
+	dirVolumes := make(map[string]string)
+
+	for _, seg := range segments {
+		if seg.deleted {
+			continue
+		}
+
+		dir := filepath.Dir(seg.fpath)
+
+		volume, ok := dirVolumes[dir]
+		if !ok {
+			var free uint64
+			var err error
+			volume, free, err = diskUsage(dir)
+			if err != nil {
+				c.Log(logger.Warn, "unable to get disk usage of %s: %v", dir, err)
+				continue
+			}
+
+			dirVolumes[dir] = volume
+
+			if _, ok := volumes[volume]; !ok {
+				volumes[volume] = &volumeEntry{free: free}
+			}
+		}
+
+		volumes[volume].segments = append(volumes[volume].segments, seg)
+	}
+
+	for _, v := range volumes {
+		for _, seg := range sortCandidates(v.segments) {
+			if v.free >= uint64(c.MinFreeSpace) {
+				break
+			}
+
+			if c.deleteSegment(seg, deleteReasonMinFreeSpace) {
+				v.free += seg.size
+			}
+		}
+	}
+}
+
+func (c *Cleaner) deleteSegment(seg *segment, reason deleteReason) bool {
+	if reason == deleteReasonDeleteAfter {
+		c.Log(logger.Debug, "removing %s", seg.fpath)
+	} else {
+		c.Log(logger.Info, "removing %s (%s)", seg.fpath, reason)
+	}
+
+	err := os.Remove(seg.fpath)
+	if err != nil {
+		// segment has been removed by someone else
+		if errors.Is(err, fs.ErrNotExist) {
+			seg.deleted = true
+			c.Index.RemoveSegment(seg.pathName, seg.fpath)
+			return true
+		}
+
+		c.Log(logger.Warn, "unable to remove %s: %v", seg.fpath, err)
+		return false
+	}
+
+	seg.deleted = true
+	c.Index.RemoveSegment(seg.pathName, seg.fpath)
+
+	if seg.pathConf.RecordManifest {
+		c.Manifests.Remove(seg.pathConf.RecordManifestPath, seg.pathConf.RecordManifestKey,
+			seg.pathName, seg.fpath, seg.start)
+	}
+
+	c.mutex.Lock()
+	key := deletionKey{path: seg.pathName, reason: reason}
+	d, ok := c.deletions[key]
+	if !ok {
+		d = &defs.APIRecordDeletion{
+			Path:   seg.pathName,
+			Reason: string(reason),
+		}
+		c.deletions[key] = d
+	}
+	d.Segments++
+	d.Bytes += seg.size
+	c.mutex.Unlock()
+
+	if seg.pathConf.RunOnRecordSegmentDelete != "" {
+		env := externalcmd.Environment{
+			"MTX_PATH":                  seg.pathName,
+			"MTX_SEGMENT_PATH":          seg.fpath,
+			"MTX_SEGMENT_DELETE_REASON": string(reason),
+		}
+
+		if len(seg.matches) > 1 {
+			for i, ma := range seg.matches[1:] {
+				env["G"+strconv.FormatInt(int64(i+1), 10)] = ma
+			}
+		}
+
+		c.Log(logger.Info, "runOnRecordSegmentDelete command launched")
+		externalcmd.NewCmd(
+			c.ExternalCmdPool,
+			seg.pathConf.RunOnRecordSegmentDelete,
+			false,
+			env,
+			nil)
 	}
 
-	return nil
+	return true
 }
 
 func (c *Cleaner) deleteEmptyDirs(pathConf *conf.Path) {
@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/stretchr/testify/require"
 )
@@ -108,3 +110,266 @@ func TestCleanerMultipleEntriesSamePath(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, "path2", "2009-05-19_22-15-25-000427.mp4"))
 	require.NoError(t, err)
 }
+
+func TestCleanerMaxSize(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-20_20-15-25-000427.mp4",
+		"2009-05-20_21-15-25-000427.mp4",
+		"2009-05-20_22-15-25-000427.mp4",
+		"2009-05-20_22-15-26-000427.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), make([]byte, 10), 0o644)
+		require.NoError(t, err)
+	}
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:          "mypath",
+				RecordPath:    filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:  conf.RecordFormatFMP4,
+				RecordMaxSize: 15,
+				RecordLockedRanges: conf.TimeRanges{{
+					Start: time.Date(2009, 5, 20, 20, 0, 0, 0, time.Local),
+					End:   time.Date(2009, 5, 20, 20, 30, 0, 0, time.Local),
+				}},
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	// locked
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_20-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_21-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	// last segment, may still be in use
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-20_22-15-26-000427.mp4"))
+	require.NoError(t, err)
+
+	require.Equal(t, &defs.APIRecordDeletionList{
+		Items: []*defs.APIRecordDeletion{{
+			Path:     "mypath",
+			Reason:   "maxSize",
+			Segments: 2,
+			Bytes:    20,
+		}},
+	}, c.APIDeletionsList())
+}
+
+func TestCleanerLocks(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-19_20-15-25-000427.mp4",
+		"2009-05-19_21-15-25-000427.mp4",
+		"2009-05-19_22-15-25-000427.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), make([]byte, 10), 0o644)
+		require.NoError(t, err)
+	}
+
+	locks := &recordstore.Locks{
+		FilePath: filepath.Join(dir, "locks.json"),
+		Parent:   test.NilLogger,
+	}
+	err = locks.Initialize()
+	require.NoError(t, err)
+	defer locks.Close()
+
+	err = locks.Add(&recordstore.Lock{
+		Path:  "mypath",
+		Start: time.Date(2009, 5, 19, 21, 30, 0, 0, time.Local),
+		End:   time.Date(2009, 5, 19, 21, 45, 0, 0, time.Local),
+	})
+	require.NoError(t, err)
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:              "mypath",
+				RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:      conf.RecordFormatFMP4,
+				RecordDeleteAfter: conf.Duration(10 * time.Second),
+			},
+		},
+		Locks:  locks,
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-19_20-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	// locked
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-19_21-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-19_22-15-25-000427.mp4"))
+	require.Error(t, err)
+}
+
+func TestCleanerTrackPolicies(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "mypath", "audio"), 0o755)
+	require.NoError(t, err)
+
+	err = os.MkdirAll(filepath.Join(dir, "mypath", "video"), 0o755)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"2009-05-19_22-15-25-000427.mp4",
+		"audio/2009-05-19_22-15-25-000427.mp4",
+		"audio/2009-05-20_22-15-20-000427.mp4",
+		"video/2009-05-18_22-15-25-000427.mp4",
+		"video/2009-05-19_22-15-25-000427.mp4",
+	} {
+		err = os.WriteFile(filepath.Join(dir, "mypath", name), []byte{1}, 0o644)
+		require.NoError(t, err)
+	}
+
+	deleteAfter := conf.Duration(10 * time.Second)
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"mypath": {
+				Name:              "mypath",
+				RecordPath:        filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:      conf.RecordFormatFMP4,
+				RecordDeleteAfter: conf.Duration(48 * time.Hour),
+				RecordTrackPolicies: conf.RecordTrackPolicies{
+					{
+						Tracks:      []string{"audio"},
+						Path:        filepath.Join(dir, "%path/audio/%Y-%m-%d_%H-%M-%S-%f"),
+						DeleteAfter: &deleteAfter,
+					},
+					{
+						Tracks: []string{"video"},
+						Path:   filepath.Join(dir, "%path/video/%Y-%m-%d_%H-%M-%S-%f"),
+					},
+				},
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "2009-05-19_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "audio", "2009-05-19_22-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "audio", "2009-05-20_22-15-20-000427.mp4"))
+	require.NoError(t, err)
+
+	// policies without 'deleteAfter' inherit 'recordDeleteAfter'
+	_, err = os.Stat(filepath.Join(dir, "mypath", "video", "2009-05-18_22-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "video", "2009-05-19_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+}
+
+func TestCleanerMaxTotalSize(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2009, 5, 20, 22, 15, 25, 427000, time.Local)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-cleaner")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "path1"), 0o755)
+	require.NoError(t, err)
+
+	err = os.Mkdir(filepath.Join(dir, "path2"), 0o755)
+	require.NoError(t, err)
+
+	for _, fpath := range []string{
+		filepath.Join("path1", "2009-05-20_21-15-25-000427.mp4"),
+		filepath.Join("path1", "2009-05-20_22-15-25-000427.mp4"),
+		filepath.Join("path2", "2009-05-20_20-15-25-000427.mp4"),
+		filepath.Join("path2", "2009-05-20_22-15-25-000427.mp4"),
+	} {
+		err = os.WriteFile(filepath.Join(dir, fpath), make([]byte, 10), 0o644)
+		require.NoError(t, err)
+	}
+
+	c := &Cleaner{
+		PathConfs: map[string]*conf.Path{
+			"path1": {
+				Name:         "path1",
+				RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat: conf.RecordFormatFMP4,
+			},
+			"path2": {
+				Name:           "path2",
+				RecordPath:     filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				RecordFormat:   conf.RecordFormatFMP4,
+				RecordPriority: 1,
+			},
+		},
+		MaxTotalSize: 30,
+		Parent:       test.NilLogger,
+	}
+	c.Initialize()
+	defer c.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	_, err = os.Stat(filepath.Join(dir, "path1", "2009-05-20_21-15-25-000427.mp4"))
+	require.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "path1", "2009-05-20_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	// older, but with higher priority
+	_, err = os.Stat(filepath.Join(dir, "path2", "2009-05-20_20-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "path2", "2009-05-20_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package recordcleaner
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// diskUsage returns the identifier of the filesystem that contains fpath,
+// and the space available on it.
+func diskUsage(fpath string) (string, uint64, error) {
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var st unix.Statfs_t
+	err = unix.Statfs(fpath, &st)
+	if err != nil {
+		return "", 0, err
+	}
+
+	dev := uint64(fi.Sys().(*syscall.Stat_t).Dev) //nolint:unconvert
+	free := uint64(st.Bavail) * uint64(st.Bsize)  //nolint:unconvert
+
+	return strconv.FormatUint(dev, 10), free, nil
+}
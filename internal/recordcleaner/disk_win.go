@@ -0,0 +1,32 @@
+//go:build windows
+
+package recordcleaner
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskUsage returns the identifier of the filesystem that contains fpath,
+// and the space available on it.
+func diskUsage(fpath string) (string, uint64, error) {
+	fpath, err := filepath.Abs(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	ptr, err := windows.UTF16PtrFromString(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var free uint64
+	err = windows.GetDiskFreeSpaceEx(ptr, &free, nil, nil)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return strings.ToUpper(filepath.VolumeName(fpath)), free, nil
+}
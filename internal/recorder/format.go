@@ -2,5 +2,10 @@ package recorder
 
 type format interface {
 	initialize() bool
+	// suspend stops writing, keeping the current segment open.
+	// It returns false when the segment cannot be continued and has been closed.
+	suspend() bool
+	// resume continues the segment of a suspended format.
+	resume(prev format) bool
 	close()
 }
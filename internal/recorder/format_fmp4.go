@@ -2,869 +2,89 @@ package recorder
 
 import (
 	"bytes"
-	"fmt"
+	"reflect"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	rtspformat "github.com/bluenviron/gortsplib/v4/pkg/format"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/ac3"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/av1"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/g711"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/jpeg"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg1audio"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4video"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/opus"
-	"github.com/bluenviron/mediacommon/v2/pkg/codecs/vp9"
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
-	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
 
 	"github.com/bluenviron/mediamtx/internal/defs"
-	"github.com/bluenviron/mediamtx/internal/formatprocessor"
 	"github.com/bluenviron/mediamtx/internal/logger"
-	"github.com/bluenviron/mediamtx/internal/unit"
+	mfmp4 "github.com/bluenviron/mediamtx/internal/protocols/fmp4"
 )
 
-func mpeg1audioChannelCount(cm mpeg1audio.ChannelMode) int {
-	switch cm {
-	case mpeg1audio.ChannelModeStereo,
-		mpeg1audio.ChannelModeJointStereo,
-		mpeg1audio.ChannelModeDualChannel:
-		return 2
-
-	default:
-		return 1
+func marshalInitTracks(initTracks []*fmp4.InitTrack) []byte {
+	init := fmp4.Init{
+		Tracks: initTracks,
 	}
-}
 
-func jpegExtractSize(image []byte) (int, int, error) {
-	l := len(image)
-	if l < 2 || image[0] != 0xFF || image[1] != jpeg.MarkerStartOfImage {
-		return 0, 0, fmt.Errorf("invalid header")
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	if err != nil {
+		return nil
 	}
 
-	image = image[2:]
-
-	for {
-		if len(image) < 2 {
-			return 0, 0, fmt.Errorf("not enough bits")
-		}
-
-		h0, h1 := image[0], image[1]
-		image = image[2:]
-
-		if h0 != 0xFF {
-			return 0, 0, fmt.Errorf("invalid image")
-		}
-
-		switch h1 {
-		case 0xE0, 0xE1, 0xE2, // JFIF
-			jpeg.MarkerDefineHuffmanTable,
-			jpeg.MarkerComment,
-			jpeg.MarkerDefineQuantizationTable,
-			jpeg.MarkerDefineRestartInterval:
-			mlen := int(image[0])<<8 | int(image[1])
-			if len(image) < mlen {
-				return 0, 0, fmt.Errorf("not enough bits")
-			}
-			image = image[mlen:]
-
-		case jpeg.MarkerStartOfFrame1:
-			mlen := int(image[0])<<8 | int(image[1])
-			if len(image) < mlen {
-				return 0, 0, fmt.Errorf("not enough bits")
-			}
-
-			var sof jpeg.StartOfFrame1
-			err := sof.Unmarshal(image[2:mlen])
-			if err != nil {
-				return 0, 0, err
-			}
-
-			return sof.Width, sof.Height, nil
-
-		case jpeg.MarkerStartOfScan:
-			return 0, 0, fmt.Errorf("SOF not found")
-
-		default:
-			return 0, 0, fmt.Errorf("unknown marker: 0x%.2x", h1)
-		}
-	}
+	return buf.Bytes()
 }
 
 type formatFMP4 struct {
 	ri *recorderInstance
 
-	tracks             []*formatFMP4Track
-	hasVideo           bool
-	currentSegment     *formatFMP4Segment
-	nextSequenceNumber uint32
+	tracks                 []*formatFMP4Track
+	hasVideo               bool
+	currentSegment         *formatFMP4Segment
+	currentSegmentStartDTS time.Duration
+	currentSegmentStartNTP time.Time
+	nextSequenceNumber     uint32
+
+	// end of the last written sample, offset that is applied
+	// to timestamps of a resumed stream and end of the continued segment,
+	// before which samples of the resumed stream are discarded.
+	endDTS        time.Duration
+	endNTP        time.Time
+	dtsOffset     time.Duration
+	resumeDTS     time.Duration
+	resumeNTP     time.Time
+	resumePending bool
+
+	// tracks of the continued segment, that are compared with
+	// the ones of the resumed stream when the first sample is received.
+	resumedInitTracks []*fmp4.InitTrack
 }
 
 func (f *formatFMP4) initialize() bool {
-	nextID := 1
-	var setuppedFormats []rtspformat.Format
+	tracks := make(map[*mfmp4.Track]*formatFMP4Track)
+
+	setuppedTracks := mfmp4.FromStream(
+		f.ri.stream,
+		f.ri,
+		func(medi *description.Media, _ rtspformat.Format) bool {
+			return f.ri.recordMedia(medi)
+		},
+		f.updateCodecParams,
+		func(track *mfmp4.Track, s *mfmp4.Sample) error {
+			return tracks[track].write(&sample{
+				Sample: s.Sample,
+				dts:    s.DTS,
+				ntp:    s.NTP,
+			})
+		})
+
+	setuppedFormats := make([]rtspformat.Format, len(setuppedTracks))
 	setuppedFormatsMap := make(map[rtspformat.Format]struct{})
 
-	addTrack := func(format rtspformat.Format, codec mp4.Codec) *formatFMP4Track {
-		initTrack := &fmp4.InitTrack{
-			TimeScale: uint32(format.ClockRate()),
-			Codec:     codec,
-		}
-		initTrack.ID = nextID
-		nextID++
-
+	for i, setuppedTrack := range setuppedTracks {
 		track := &formatFMP4Track{
 			f:         f,
-			initTrack: initTrack,
+			initTrack: setuppedTrack.InitTrack,
 		}
-
 		f.tracks = append(f.tracks, track)
-		setuppedFormats = append(setuppedFormats, format)
-		setuppedFormatsMap[format] = struct{}{}
-		return track
-	}
+		tracks[setuppedTrack] = track
 
-	for _, media := range f.ri.stream.Desc.Medias {
-		for _, forma := range media.Formats {
-			clockRate := forma.ClockRate()
-
-			switch forma := forma.(type) {
-			case *rtspformat.AV1:
-				codec := &mp4.CodecAV1{
-					SequenceHeader: formatprocessor.AV1DefaultSequenceHeader,
-				}
-				track := addTrack(forma, codec)
-
-				firstReceived := false
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.AV1)
-						if tunit.TU == nil {
-							return nil
-						}
-
-						randomAccess := false
-						paramsChanged := false
-
-						for _, obu := range tunit.TU {
-							var h av1.OBUHeader
-							err := h.Unmarshal(obu)
-							if err != nil {
-								return err
-							}
-
-							if h.Type == av1.OBUTypeSequenceHeader {
-								if !bytes.Equal(codec.SequenceHeader, obu) {
-									codec.SequenceHeader = obu
-									paramsChanged = true
-								}
-								randomAccess = true
-							}
-						}
-
-						if paramsChanged {
-							f.updateCodecParams()
-						}
-
-						if !firstReceived {
-							if !randomAccess {
-								return nil
-							}
-							firstReceived = true
-						}
-
-						var sampl fmp4.Sample
-						err := sampl.FillAV1(tunit.TU)
-						if err != nil {
-							return err
-						}
-
-						return track.write(&sample{
-							Sample: &sampl,
-							dts:    tunit.PTS,
-							ntp:    tunit.NTP,
-						})
-					})
-
-			case *rtspformat.VP9:
-				codec := &mp4.CodecVP9{
-					Width:             1280,
-					Height:            720,
-					Profile:           1,
-					BitDepth:          8,
-					ChromaSubsampling: 1,
-					ColorRange:        false,
-				}
-				track := addTrack(forma, codec)
-
-				firstReceived := false
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.VP9)
-						if tunit.Frame == nil {
-							return nil
-						}
-
-						var h vp9.Header
-						err := h.Unmarshal(tunit.Frame)
-						if err != nil {
-							return err
-						}
-
-						randomAccess := false
-						paramsChanged := false
-
-						if !h.NonKeyFrame {
-							randomAccess = true
-
-							if w := h.Width(); codec.Width != w {
-								codec.Width = w
-								paramsChanged = true
-							}
-							if h := h.Width(); codec.Height != h {
-								codec.Height = h
-								paramsChanged = true
-							}
-							if codec.Profile != h.Profile {
-								codec.Profile = h.Profile
-								paramsChanged = true
-							}
-							if codec.BitDepth != h.ColorConfig.BitDepth {
-								codec.BitDepth = h.ColorConfig.BitDepth
-								paramsChanged = true
-							}
-							if c := h.ChromaSubsampling(); codec.ChromaSubsampling != c {
-								codec.ChromaSubsampling = c
-								paramsChanged = true
-							}
-							if codec.ColorRange != h.ColorConfig.ColorRange {
-								codec.ColorRange = h.ColorConfig.ColorRange
-								paramsChanged = true
-							}
-						}
-
-						if paramsChanged {
-							f.updateCodecParams()
-						}
-
-						if !firstReceived {
-							if !randomAccess {
-								return nil
-							}
-							firstReceived = true
-						}
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								IsNonSyncSample: !randomAccess,
-								Payload:         tunit.Frame,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-
-			case *rtspformat.VP8:
-				// TODO
-
-			case *rtspformat.H265:
-				vps, sps, pps := forma.SafeParams()
-
-				if vps == nil || sps == nil || pps == nil {
-					vps = formatprocessor.H265DefaultVPS
-					sps = formatprocessor.H265DefaultSPS
-					pps = formatprocessor.H265DefaultPPS
-				}
-
-				codec := &mp4.CodecH265{
-					VPS: vps,
-					SPS: sps,
-					PPS: pps,
-				}
-				track := addTrack(forma, codec)
-
-				var dtsExtractor *h265.DTSExtractor
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.H265)
-						if tunit.AU == nil {
-							return nil
-						}
-
-						randomAccess := false
-						paramsChanged := false
-
-						for _, nalu := range tunit.AU {
-							typ := h265.NALUType((nalu[0] >> 1) & 0b111111)
-
-							switch typ {
-							case h265.NALUType_VPS_NUT:
-								if !bytes.Equal(codec.VPS, nalu) {
-									codec.VPS = nalu
-									paramsChanged = true
-								}
-
-							case h265.NALUType_SPS_NUT:
-								if !bytes.Equal(codec.SPS, nalu) {
-									codec.SPS = nalu
-									paramsChanged = true
-								}
-
-							case h265.NALUType_PPS_NUT:
-								if !bytes.Equal(codec.PPS, nalu) {
-									codec.PPS = nalu
-									paramsChanged = true
-								}
-
-							case h265.NALUType_IDR_W_RADL, h265.NALUType_IDR_N_LP, h265.NALUType_CRA_NUT:
-								randomAccess = true
-							}
-						}
-
-						if paramsChanged {
-							f.updateCodecParams()
-						}
-
-						if dtsExtractor == nil {
-							if !randomAccess {
-								return nil
-							}
-							dtsExtractor = &h265.DTSExtractor{}
-							dtsExtractor.Initialize()
-						}
-
-						dts, err := dtsExtractor.Extract(tunit.AU, tunit.PTS)
-						if err != nil {
-							return err
-						}
-
-						var sampl fmp4.Sample
-						err = sampl.FillH265(
-							int32(tunit.PTS-dts),
-							tunit.AU)
-						if err != nil {
-							return err
-						}
-
-						return track.write(&sample{
-							Sample: &sampl,
-							dts:    dts,
-							ntp:    tunit.NTP,
-						})
-					})
-
-			case *rtspformat.H264:
-				sps, pps := forma.SafeParams()
-
-				if sps == nil || pps == nil {
-					sps = formatprocessor.H264DefaultSPS
-					pps = formatprocessor.H264DefaultPPS
-				}
-
-				codec := &mp4.CodecH264{
-					SPS: sps,
-					PPS: pps,
-				}
-				track := addTrack(forma, codec)
-
-				var dtsExtractor *h264.DTSExtractor
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.H264)
-						if tunit.AU == nil {
-							return nil
-						}
-
-						randomAccess := false
-						paramsChanged := false
-
-						for _, nalu := range tunit.AU {
-							typ := h264.NALUType(nalu[0] & 0x1F)
-							switch typ {
-							case h264.NALUTypeSPS:
-								if !bytes.Equal(codec.SPS, nalu) {
-									codec.SPS = nalu
-									paramsChanged = true
-								}
-
-							case h264.NALUTypePPS:
-								if !bytes.Equal(codec.PPS, nalu) {
-									codec.PPS = nalu
-									paramsChanged = true
-								}
-
-							case h264.NALUTypeIDR:
-								randomAccess = true
-							}
-						}
-
-						if paramsChanged {
-							f.updateCodecParams()
-						}
-
-						if dtsExtractor == nil {
-							if !randomAccess {
-								return nil
-							}
-							dtsExtractor = &h264.DTSExtractor{}
-							dtsExtractor.Initialize()
-						}
-
-						dts, err := dtsExtractor.Extract(tunit.AU, tunit.PTS)
-						if err != nil {
-							return err
-						}
-
-						var sampl fmp4.Sample
-						err = sampl.FillH264(
-							int32(tunit.PTS-dts),
-							tunit.AU)
-						if err != nil {
-							return err
-						}
-
-						return track.write(&sample{
-							Sample: &sampl,
-							dts:    dts,
-							ntp:    tunit.NTP,
-						})
-					})
-
-			case *rtspformat.MPEG4Video:
-				config := forma.SafeParams()
-
-				if config == nil {
-					config = formatprocessor.MPEG4VideoDefaultConfig
-				}
-
-				codec := &mp4.CodecMPEG4Video{
-					Config: config,
-				}
-				track := addTrack(forma, codec)
-
-				firstReceived := false
-				var lastPTS int64
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.MPEG4Video)
-						if tunit.Frame == nil {
-							return nil
-						}
-
-						randomAccess := bytes.Contains(tunit.Frame, []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)})
-
-						if bytes.HasPrefix(tunit.Frame, []byte{0, 0, 1, byte(mpeg4video.VisualObjectSequenceStartCode)}) {
-							end := bytes.Index(tunit.Frame[4:], []byte{0, 0, 1, byte(mpeg4video.GroupOfVOPStartCode)})
-							if end >= 0 {
-								config := tunit.Frame[:end+4]
-
-								if !bytes.Equal(codec.Config, config) {
-									codec.Config = config
-									f.updateCodecParams()
-								}
-							}
-						}
-
-						if !firstReceived {
-							if !randomAccess {
-								return nil
-							}
-							firstReceived = true
-						} else if tunit.PTS < lastPTS {
-							return fmt.Errorf("MPEG-4 Video streams with B-frames are not supported (yet)")
-						}
-						lastPTS = tunit.PTS
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								Payload:         tunit.Frame,
-								IsNonSyncSample: !randomAccess,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-
-			case *rtspformat.MPEG1Video:
-				codec := &mp4.CodecMPEG1Video{
-					Config: formatprocessor.MPEG1VideoDefaultConfig,
-				}
-				track := addTrack(forma, codec)
-
-				firstReceived := false
-				var lastPTS int64
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.MPEG1Video)
-						if tunit.Frame == nil {
-							return nil
-						}
-
-						randomAccess := bytes.Contains(tunit.Frame, []byte{0, 0, 1, 0xB8})
-
-						if bytes.HasPrefix(tunit.Frame, []byte{0, 0, 1, 0xB3}) {
-							end := bytes.Index(tunit.Frame[4:], []byte{0, 0, 1, 0xB8})
-							if end >= 0 {
-								config := tunit.Frame[:end+4]
-
-								if !bytes.Equal(codec.Config, config) {
-									codec.Config = config
-									f.updateCodecParams()
-								}
-							}
-						}
-
-						if !firstReceived {
-							if !randomAccess {
-								return nil
-							}
-							firstReceived = true
-						} else if tunit.PTS < lastPTS {
-							return fmt.Errorf("MPEG-1 Video streams with B-frames are not supported (yet)")
-						}
-						lastPTS = tunit.PTS
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								Payload:         tunit.Frame,
-								IsNonSyncSample: !randomAccess,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-
-			case *rtspformat.MJPEG:
-				codec := &mp4.CodecMJPEG{
-					Width:  800,
-					Height: 600,
-				}
-				track := addTrack(forma, codec)
-
-				parsed := false
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.MJPEG)
-						if tunit.Frame == nil {
-							return nil
-						}
-
-						if !parsed {
-							parsed = true
-							width, height, err := jpegExtractSize(tunit.Frame)
-							if err != nil {
-								return err
-							}
-							codec.Width = width
-							codec.Height = height
-							f.updateCodecParams()
-						}
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								Payload: tunit.Frame,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-
-			case *rtspformat.Opus:
-				codec := &mp4.CodecOpus{
-					ChannelCount: forma.ChannelCount,
-				}
-				track := addTrack(forma, codec)
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.Opus)
-						if tunit.Packets == nil {
-							return nil
-						}
-
-						pts := tunit.PTS
-
-						for _, packet := range tunit.Packets {
-							err := track.write(&sample{
-								Sample: &fmp4.Sample{
-									Payload: packet,
-								},
-								dts: pts,
-								ntp: tunit.NTP.Add(timestampToDuration(pts-tunit.PTS, clockRate)),
-							})
-							if err != nil {
-								return err
-							}
-
-							pts += opus.PacketDuration2(packet)
-						}
-
-						return nil
-					})
-
-			case *rtspformat.MPEG4Audio:
-				co := forma.GetConfig()
-				if co != nil {
-					codec := &mp4.CodecMPEG4Audio{
-						Config: *co,
-					}
-					track := addTrack(forma, codec)
-
-					f.ri.stream.AddReader(
-						f.ri,
-						media,
-						forma,
-						func(u unit.Unit) error {
-							tunit := u.(*unit.MPEG4Audio)
-							if tunit.AUs == nil {
-								return nil
-							}
-
-							for i, au := range tunit.AUs {
-								pts := tunit.PTS + int64(i)*mpeg4audio.SamplesPerAccessUnit
-
-								err := track.write(&sample{
-									Sample: &fmp4.Sample{
-										Payload: au,
-									},
-									dts: pts,
-									ntp: tunit.NTP.Add(timestampToDuration(pts-tunit.PTS, clockRate)),
-								})
-								if err != nil {
-									return err
-								}
-							}
-
-							return nil
-						})
-				}
-
-			case *rtspformat.MPEG1Audio:
-				codec := &mp4.CodecMPEG1Audio{
-					SampleRate:   32000,
-					ChannelCount: 2,
-				}
-				track := addTrack(forma, codec)
-
-				parsed := false
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.MPEG1Audio)
-						if tunit.Frames == nil {
-							return nil
-						}
-
-						var dt time.Duration
-
-						for _, frame := range tunit.Frames {
-							var h mpeg1audio.FrameHeader
-							err := h.Unmarshal(frame)
-							if err != nil {
-								return err
-							}
-
-							if !parsed {
-								parsed = true
-								codec.SampleRate = h.SampleRate
-								codec.ChannelCount = mpeg1audioChannelCount(h.ChannelMode)
-								f.updateCodecParams()
-							}
-
-							err = track.write(&sample{
-								Sample: &fmp4.Sample{
-									Payload: frame,
-								},
-								dts: tunit.PTS + tunit.PTS,
-								ntp: tunit.NTP,
-							})
-							if err != nil {
-								return err
-							}
-
-							dt += time.Duration(h.SampleCount()) *
-								time.Second / time.Duration(h.SampleRate)
-						}
-
-						return nil
-					})
-
-			case *rtspformat.AC3:
-				codec := &mp4.CodecAC3{
-					SampleRate:   forma.SampleRate,
-					ChannelCount: forma.ChannelCount,
-					Fscod:        0,
-					Bsid:         8,
-					Bsmod:        0,
-					Acmod:        7,
-					LfeOn:        true,
-					BitRateCode:  7,
-				}
-				track := addTrack(forma, codec)
-
-				parsed := false
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.AC3)
-						if tunit.Frames == nil {
-							return nil
-						}
-
-						for i, frame := range tunit.Frames {
-							var syncInfo ac3.SyncInfo
-							err := syncInfo.Unmarshal(frame)
-							if err != nil {
-								return fmt.Errorf("invalid AC-3 frame: %w", err)
-							}
-
-							var bsi ac3.BSI
-							err = bsi.Unmarshal(frame[5:])
-							if err != nil {
-								return fmt.Errorf("invalid AC-3 frame: %w", err)
-							}
-
-							if !parsed {
-								parsed = true
-								codec.SampleRate = syncInfo.SampleRate()
-								codec.ChannelCount = bsi.ChannelCount()
-								codec.Fscod = syncInfo.Fscod
-								codec.Bsid = bsi.Bsid
-								codec.Bsmod = bsi.Bsmod
-								codec.Acmod = bsi.Acmod
-								codec.LfeOn = bsi.LfeOn
-								codec.BitRateCode = syncInfo.Frmsizecod >> 1
-								f.updateCodecParams()
-							}
-
-							pts := tunit.PTS + int64(i)*ac3.SamplesPerFrame
-
-							err = track.write(&sample{
-								Sample: &fmp4.Sample{
-									Payload: frame,
-								},
-								dts: pts,
-								ntp: tunit.NTP.Add(timestampToDuration(pts-tunit.PTS, clockRate)),
-							})
-							if err != nil {
-								return err
-							}
-						}
-
-						return nil
-					})
-
-			case *rtspformat.G722:
-				// TODO
-
-			case *rtspformat.G711:
-				codec := &mp4.CodecLPCM{
-					LittleEndian: false,
-					BitDepth:     16,
-					SampleRate:   forma.SampleRate,
-					ChannelCount: forma.ChannelCount,
-				}
-				track := addTrack(forma, codec)
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.G711)
-
-						if tunit.Samples == nil {
-							return nil
-						}
-
-						var lpcm []byte
-						if forma.MULaw {
-							var mu g711.Mulaw
-							mu.Unmarshal(tunit.Samples)
-							lpcm = mu
-						} else {
-							var al g711.Alaw
-							al.Unmarshal(tunit.Samples)
-							lpcm = al
-						}
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								Payload: lpcm,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-
-			case *rtspformat.LPCM:
-				codec := &mp4.CodecLPCM{
-					LittleEndian: false,
-					BitDepth:     forma.BitDepth,
-					SampleRate:   forma.SampleRate,
-					ChannelCount: forma.ChannelCount,
-				}
-				track := addTrack(forma, codec)
-
-				f.ri.stream.AddReader(
-					f.ri,
-					media,
-					forma,
-					func(u unit.Unit) error {
-						tunit := u.(*unit.LPCM)
-						if tunit.Samples == nil {
-							return nil
-						}
-
-						return track.write(&sample{
-							Sample: &fmp4.Sample{
-								Payload: tunit.Samples,
-							},
-							dts: tunit.PTS,
-							ntp: tunit.NTP,
-						})
-					})
-			}
-		}
+		setuppedFormats[i] = setuppedTrack.Format
+		setuppedFormatsMap[setuppedTrack.Format] = struct{}{}
 	}
 
 	if len(setuppedFormats) == 0 {
@@ -875,7 +95,7 @@ func (f *formatFMP4) initialize() bool {
 	n := 1
 	for _, medi := range f.ri.stream.Desc.Medias {
 		for _, forma := range medi.Formats {
-			if _, ok := setuppedFormatsMap[forma]; !ok {
+			if _, ok := setuppedFormatsMap[forma]; !ok && f.ri.recordMedia(medi) {
 				f.ri.Log(logger.Warn, "skipping track %d (%s)", n, forma.Codec())
 			}
 			n++
@@ -888,10 +108,113 @@ func (f *formatFMP4) initialize() bool {
 	return true
 }
 
+func (f *formatFMP4) newSegment(startDTS time.Duration, startNTP time.Time) {
+	f.currentSegment = &formatFMP4Segment{
+		f:        f,
+		startDTS: startDTS,
+		startNTP: startNTP,
+	}
+	f.currentSegment.initialize()
+
+	f.currentSegmentStartDTS = startDTS
+	f.currentSegmentStartNTP = startNTP
+}
+
 func (f *formatFMP4) updateCodecParams() {
 	f.ri.Log(logger.Debug, "codec parameters have changed")
 }
 
+func (f *formatFMP4) nextSamplePositions() []samplePosition {
+	var ret []samplePosition
+	for _, track := range f.tracks {
+		if track.nextSample != nil {
+			ret = append(ret, samplePosition{
+				dts: timestampToDuration(track.nextSample.dts, int(track.initTrack.TimeScale)) + f.dtsOffset,
+				ntp: track.nextSample.ntp,
+			})
+		}
+	}
+	return ret
+}
+
+func (f *formatFMP4) suspend() bool {
+	if f.currentSegment == nil {
+		return false
+	}
+
+	// the last sample of each track is buffered until the next one is received,
+	// write it before the stream stops.
+	for _, track := range f.tracks {
+		err := track.flush()
+		if err != nil {
+			f.ri.Log(logger.Warn, "unable to flush segment: %v", err)
+			f.close()
+			return false
+		}
+	}
+
+	err := f.currentSegment.flush()
+	if err != nil {
+		f.ri.Log(logger.Warn, "unable to flush segment: %v", err)
+		f.close()
+		return false
+	}
+
+	return true
+}
+
+func (f *formatFMP4) resume(prev format) bool {
+	prevf, ok := prev.(*formatFMP4)
+	if !ok || prevf.currentSegment == nil || len(prevf.tracks) != len(f.tracks) {
+		return false
+	}
+
+	for i, track := range f.tracks {
+		prevTrack := prevf.tracks[i]
+		if track.initTrack.TimeScale != prevTrack.initTrack.TimeScale ||
+			reflect.TypeOf(track.initTrack.Codec) != reflect.TypeOf(prevTrack.initTrack.Codec) {
+			return false
+		}
+	}
+
+	f.currentSegment = prevf.currentSegment
+	f.currentSegment.f = f
+	f.currentSegmentStartDTS = prevf.currentSegmentStartDTS
+	f.currentSegmentStartNTP = prevf.currentSegmentStartNTP
+	f.nextSequenceNumber = prevf.nextSequenceNumber
+	f.hasVideo = prevf.hasVideo
+	f.endDTS = prevf.endDTS
+	f.endNTP = prevf.endNTP
+	f.resumeDTS = prevf.endDTS
+	f.resumeNTP = prevf.endNTP
+	f.resumePending = true
+
+	f.resumedInitTracks = make([]*fmp4.InitTrack, len(prevf.tracks))
+	for i, track := range prevf.tracks {
+		f.resumedInitTracks[i] = track.initTrack
+	}
+
+	f.ri.Log(logger.Info, "continuing previous segment")
+
+	return true
+}
+
+// resumedTracksMatch checks whether the tracks of the resumed stream
+// are identical to the ones of the continued segment.
+// Codec parameters are often transmitted in-band, therefore the check can
+// be performed only after the first sample of the resumed stream is received.
+func (f *formatFMP4) resumedTracksMatch() bool {
+	initTracks := make([]*fmp4.InitTrack, len(f.tracks))
+	for i, track := range f.tracks {
+		initTracks[i] = track.initTrack
+	}
+
+	cur := marshalInitTracks(initTracks)
+	prev := marshalInitTracks(f.resumedInitTracks)
+
+	return cur != nil && bytes.Equal(cur, prev)
+}
+
 func (f *formatFMP4) close() {
 	if f.currentSegment != nil {
 		f.currentSegment.close() //nolint:errcheck
@@ -68,7 +68,7 @@ func (p *formatFMP4Part) close() error {
 			return err
 		}
 
-		p.s.f.ri.onSegmentCreate(p.s.path)
+		p.s.f.ri.segmentCreated(p.s.path, p.s.startNTP)
 
 		err = writeInit(fi, p.s.f.tracks)
 		if err != nil {
@@ -136,13 +136,24 @@ func (s *formatFMP4Segment) close() error {
 		}
 
 		if err2 == nil {
-			s.f.ri.onSegmentComplete(s.path, duration)
+			s.f.ri.segmentCompleted(s.path, s.startNTP, duration)
 		}
 	}
 
 	return err
 }
 
+// flush writes pending samples, in order to allow timestamp discontinuities.
+func (s *formatFMP4Segment) flush() error {
+	if s.curPart == nil {
+		return nil
+	}
+
+	err := s.curPart.close()
+	s.curPart = nil
+	return err
+}
+
 func (s *formatFMP4Segment) write(track *formatFMP4Track, sample *sample, dts time.Duration) error {
 	endDTS := dts + timestampToDuration(int64(sample.Duration), int(track.initTrack.TimeScale))
 	if endDTS > s.endDTS {
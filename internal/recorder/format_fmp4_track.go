@@ -12,29 +12,29 @@ const (
 	maxBasetime = 1 * time.Second
 )
 
+// samplePosition is the position of the next sample of a track.
+type samplePosition struct {
+	dts time.Duration
+	ntp time.Time
+}
+
 // start next segment from the oldest next sample, in order to avoid negative basetimes (impossible) in fMP4.
 // keep starting position within a certain distance from the newest next sample to avoid big basetimes.
-func nextSegmentStartingPos(tracks []*formatFMP4Track) (time.Time, time.Duration) {
+func nextSegmentStartingPos(positions []samplePosition) (time.Time, time.Duration) {
 	var maxDTS time.Duration
-	for _, track := range tracks {
-		if track.nextSample != nil {
-			dts := timestampToDuration(track.nextSample.dts, int(track.initTrack.TimeScale))
-			if dts > maxDTS {
-				maxDTS = dts
-			}
+	for _, pos := range positions {
+		if pos.dts > maxDTS {
+			maxDTS = pos.dts
 		}
 	}
 
 	var oldestNTP time.Time
 	oldestDTS := maxDTS
 
-	for _, track := range tracks {
-		if track.nextSample != nil {
-			dts := timestampToDuration(track.nextSample.dts, int(track.initTrack.TimeScale))
-			if (maxDTS-dts) <= maxBasetime && (dts <= oldestDTS) {
-				oldestNTP = track.nextSample.ntp
-				oldestDTS = dts
-			}
+	for _, pos := range positions {
+		if (maxDTS-pos.dts) <= maxBasetime && (pos.dts <= oldestDTS) {
+			oldestNTP = pos.ntp
+			oldestDTS = pos.dts
 		}
 	}
 
@@ -45,7 +45,8 @@ type formatFMP4Track struct {
 	f         *formatFMP4
 	initTrack *fmp4.InitTrack
 
-	nextSample *sample
+	nextSample   *sample
+	lastDuration uint32
 }
 
 func (t *formatFMP4Track) write(sample *sample) error {
@@ -54,50 +55,98 @@ func (t *formatFMP4Track) write(sample *sample) error {
 		t.f.hasVideo = true
 	}
 
+	// the segment of a previous stream is being continued:
+	// shift timestamps in order to place the resumed stream after the end of the segment,
+	// preserving the wall-clock gap between streams.
+	// Tracks of the resumed stream share the same clock, therefore a single offset
+	// is computed, that does not depend on the track of the first sample.
+	if t.f.resumePending {
+		t.f.resumePending = false
+
+		if t.f.resumedTracksMatch() {
+			gap := max(sample.ntp.Sub(t.f.resumeNTP), 0)
+			t.f.dtsOffset = t.f.resumeDTS + gap - timestampToDuration(sample.dts, int(t.initTrack.TimeScale))
+		} else {
+			t.f.ri.Log(logger.Info, "codec parameters have changed, starting a new segment")
+
+			t.f.resumeDTS = 0
+
+			err := t.f.currentSegment.close()
+			t.f.currentSegment = nil
+			if err != nil {
+				return err
+			}
+		}
+
+		t.f.resumedInitTracks = nil
+	}
+
 	sample, t.nextSample = t.nextSample, sample
 	if sample == nil {
 		return nil
 	}
 	sample.Duration = uint32(t.nextSample.dts - sample.dts)
 
-	dts := timestampToDuration(sample.dts, int(t.initTrack.TimeScale))
-
-	if t.f.currentSegment == nil {
-		t.f.currentSegment = &formatFMP4Segment{
-			f:        t.f,
-			startDTS: dts,
-			startNTP: sample.ntp,
-		}
-		t.f.currentSegment.initialize()
-	} else if (dts - t.f.currentSegment.startDTS) < 0 { // BaseTime is negative, this is not supported by fMP4
-		t.f.ri.Log(logger.Warn, "sample of track %d received too late, discarding", t.initTrack.ID)
-		return nil
-	}
-
-	err := t.f.currentSegment.write(t, sample, dts)
-	if err != nil {
+	written, err := t.writeSample(sample)
+	if err != nil || !written {
 		return err
 	}
 
-	nextDTS := timestampToDuration(t.nextSample.dts, int(t.initTrack.TimeScale))
+	nextDTS := timestampToDuration(t.nextSample.dts, int(t.initTrack.TimeScale)) + t.f.dtsOffset
 
 	if (!t.f.hasVideo || t.initTrack.Codec.IsVideo()) &&
 		!t.nextSample.IsNonSyncSample &&
-		(nextDTS-t.f.currentSegment.startDTS) >= t.f.ri.segmentDuration {
+		t.f.ri.segmentMustEnd(t.f.currentSegmentStartDTS, t.f.currentSegmentStartNTP, nextDTS, t.nextSample.ntp) {
 		err := t.f.currentSegment.close()
 		if err != nil {
 			return err
 		}
 
-		oldestNTP, oldestDTS := nextSegmentStartingPos(t.f.tracks)
-
-		t.f.currentSegment = &formatFMP4Segment{
-			f:        t.f,
-			startDTS: oldestDTS,
-			startNTP: oldestNTP,
-		}
-		t.f.currentSegment.initialize()
+		oldestNTP, oldestDTS := nextSegmentStartingPos(t.f.nextSamplePositions())
+		t.f.newSegment(oldestDTS, oldestNTP)
 	}
 
 	return nil
 }
+
+func (t *formatFMP4Track) writeSample(sample *sample) (bool, error) {
+	dts := timestampToDuration(sample.dts, int(t.initTrack.TimeScale)) + t.f.dtsOffset
+
+	if t.f.currentSegment == nil {
+		t.f.newSegment(dts, sample.ntp)
+	} else if (dts-t.f.currentSegmentStartDTS) < 0 || // BaseTime is negative, this is not supported by fMP4
+		dts < t.f.resumeDTS { // sample overlaps with the continued segment
+		t.f.ri.Log(logger.Warn, "sample of track %d received too late, discarding", t.initTrack.ID)
+		return false, nil
+	}
+
+	err := t.f.currentSegment.write(t, sample, dts)
+	if err != nil {
+		return false, err
+	}
+
+	t.lastDuration = sample.Duration
+
+	duration := timestampToDuration(int64(sample.Duration), int(t.initTrack.TimeScale))
+	if endDTS := dts + duration; endDTS > t.f.endDTS {
+		t.f.endDTS = endDTS
+		t.f.endNTP = sample.ntp.Add(duration)
+	}
+
+	return true, nil
+}
+
+// flush writes the buffered sample, whose duration is unknown
+// and is assumed to be equal to the one of the previous sample.
+func (t *formatFMP4Track) flush() error {
+	if t.nextSample == nil {
+		return nil
+	}
+
+	sample := t.nextSample
+	t.nextSample = nil
+	sample.Duration = t.lastDuration
+
+	_, err := t.writeSample(sample)
+	return err
+}
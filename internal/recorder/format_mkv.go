@@ -0,0 +1,205 @@
+package recorder
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	rtspformat "github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mfmp4 "github.com/bluenviron/mediamtx/internal/protocols/fmp4"
+)
+
+// formatMKV writes segments with the Matroska format.
+// Tracks are set up in the same way as fMP4, since Matroska supports the same codecs.
+type formatMKV struct {
+	ri *recorderInstance
+
+	tracks                 []*formatMKVTrack
+	hasVideo               bool
+	currentSegment         *formatMKVSegment
+	currentSegmentStartDTS time.Duration
+	currentSegmentStartNTP time.Time
+
+	// end of the last written sample, offset that is applied
+	// to timestamps of a resumed stream and end of the continued segment,
+	// before which samples of the resumed stream are discarded.
+	endDTS        time.Duration
+	endNTP        time.Time
+	dtsOffset     time.Duration
+	resumeDTS     time.Duration
+	resumeNTP     time.Time
+	resumePending bool
+
+	// tracks of the continued segment, that are compared with
+	// the ones of the resumed stream when the first sample is received.
+	resumedInitTracks []*fmp4.InitTrack
+}
+
+func (f *formatMKV) initialize() bool {
+	tracks := make(map[*mfmp4.Track]*formatMKVTrack)
+
+	setuppedTracks := mfmp4.FromStream(
+		f.ri.stream,
+		f.ri,
+		func(medi *description.Media, _ rtspformat.Format) bool {
+			return f.ri.recordMedia(medi)
+		},
+		f.updateCodecParams,
+		func(track *mfmp4.Track, s *mfmp4.Sample) error {
+			return tracks[track].write(&sample{
+				Sample: s.Sample,
+				dts:    s.DTS,
+				ntp:    s.NTP,
+			})
+		})
+
+	setuppedFormats := make([]rtspformat.Format, len(setuppedTracks))
+	setuppedFormatsMap := make(map[rtspformat.Format]struct{})
+
+	for i, setuppedTrack := range setuppedTracks {
+		track := &formatMKVTrack{
+			f:         f,
+			initTrack: setuppedTrack.InitTrack,
+		}
+		f.tracks = append(f.tracks, track)
+		tracks[setuppedTrack] = track
+
+		setuppedFormats[i] = setuppedTrack.Format
+		setuppedFormatsMap[setuppedTrack.Format] = struct{}{}
+	}
+
+	if len(setuppedFormats) == 0 {
+		f.ri.Log(logger.Warn, "no supported tracks found, skipping recording")
+		return false
+	}
+
+	n := 1
+	for _, medi := range f.ri.stream.Desc.Medias {
+		for _, forma := range medi.Formats {
+			if _, ok := setuppedFormatsMap[forma]; !ok && f.ri.recordMedia(medi) {
+				f.ri.Log(logger.Warn, "skipping track %d (%s)", n, forma.Codec())
+			}
+			n++
+		}
+	}
+
+	f.ri.Log(logger.Info, "recording %s",
+		defs.FormatsInfo(setuppedFormats))
+
+	return true
+}
+
+func (f *formatMKV) newSegment(startDTS time.Duration, startNTP time.Time) {
+	f.currentSegment = &formatMKVSegment{
+		f:        f,
+		startDTS: startDTS,
+		startNTP: startNTP,
+	}
+	f.currentSegment.initialize()
+
+	f.currentSegmentStartDTS = startDTS
+	f.currentSegmentStartNTP = startNTP
+}
+
+func (f *formatMKV) updateCodecParams() {
+	f.ri.Log(logger.Debug, "codec parameters have changed")
+}
+
+func (f *formatMKV) nextSamplePositions() []samplePosition {
+	var ret []samplePosition
+	for _, track := range f.tracks {
+		if track.nextSample != nil {
+			ret = append(ret, samplePosition{
+				dts: timestampToDuration(track.nextSample.dts, int(track.initTrack.TimeScale)) + f.dtsOffset,
+				ntp: track.nextSample.ntp,
+			})
+		}
+	}
+	return ret
+}
+
+func (f *formatMKV) suspend() bool {
+	if f.currentSegment == nil {
+		return false
+	}
+
+	// the last sample of each track is buffered until the next one is received,
+	// write it before the stream stops.
+	for _, track := range f.tracks {
+		err := track.flush()
+		if err != nil {
+			f.ri.Log(logger.Warn, "unable to flush segment: %v", err)
+			f.close()
+			return false
+		}
+	}
+
+	err := f.currentSegment.flush()
+	if err != nil {
+		f.ri.Log(logger.Warn, "unable to flush segment: %v", err)
+		f.close()
+		return false
+	}
+
+	return true
+}
+
+func (f *formatMKV) resume(prev format) bool {
+	prevf, ok := prev.(*formatMKV)
+	if !ok || prevf.currentSegment == nil || len(prevf.tracks) != len(f.tracks) {
+		return false
+	}
+
+	for i, track := range f.tracks {
+		prevTrack := prevf.tracks[i]
+		if track.initTrack.TimeScale != prevTrack.initTrack.TimeScale ||
+			reflect.TypeOf(track.initTrack.Codec) != reflect.TypeOf(prevTrack.initTrack.Codec) {
+			return false
+		}
+	}
+
+	f.currentSegment = prevf.currentSegment
+	f.currentSegment.f = f
+	f.currentSegmentStartDTS = prevf.currentSegmentStartDTS
+	f.currentSegmentStartNTP = prevf.currentSegmentStartNTP
+	f.hasVideo = prevf.hasVideo
+	f.endDTS = prevf.endDTS
+	f.endNTP = prevf.endNTP
+	f.resumeDTS = prevf.endDTS
+	f.resumeNTP = prevf.endNTP
+	f.resumePending = true
+
+	f.resumedInitTracks = make([]*fmp4.InitTrack, len(prevf.tracks))
+	for i, track := range prevf.tracks {
+		f.resumedInitTracks[i] = track.initTrack
+	}
+
+	f.ri.Log(logger.Info, "continuing previous segment")
+
+	return true
+}
+
+// resumedTracksMatch checks whether the tracks of the resumed stream
+// are identical to the ones of the continued segment.
+func (f *formatMKV) resumedTracksMatch() bool {
+	initTracks := make([]*fmp4.InitTrack, len(f.tracks))
+	for i, track := range f.tracks {
+		initTracks[i] = track.initTrack
+	}
+
+	cur := marshalInitTracks(initTracks)
+	prev := marshalInitTracks(f.resumedInitTracks)
+
+	return cur != nil && bytes.Equal(cur, prev)
+}
+
+func (f *formatMKV) close() {
+	if f.currentSegment != nil {
+		f.currentSegment.close() //nolint:errcheck
+	}
+}
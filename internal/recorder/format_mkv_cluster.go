@@ -0,0 +1,92 @@
+package recorder
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mkv"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
+)
+
+func writeMKVHeader(f *os.File, tracks []*formatMKVTrack) error {
+	mkvTracks := make([]*mkv.Track, len(tracks))
+	for i, track := range tracks {
+		mkvTracks[i] = &mkv.Track{
+			Number: uint64(track.initTrack.ID),
+			Codec:  track.initTrack.Codec,
+		}
+	}
+
+	h := &mkv.Header{
+		Tracks: mkvTracks,
+	}
+
+	return h.Marshal(f)
+}
+
+type formatMKVCluster struct {
+	s        *formatMKVSegment
+	startDTS time.Duration
+
+	cluster *mkv.Cluster
+	endDTS  time.Duration
+}
+
+func (c *formatMKVCluster) initialize() {
+	c.cluster = &mkv.Cluster{
+		Timestamp: c.startDTS - c.s.startDTS,
+	}
+}
+
+func (c *formatMKVCluster) close() error {
+	if c.s.fi == nil {
+		c.s.path = recordstore.Path{Start: c.s.startNTP}.Encode(c.s.f.ri.pathFormat2)
+		c.s.f.ri.Log(logger.Debug, "creating segment %s", c.s.path)
+
+		err := os.MkdirAll(filepath.Dir(c.s.path), 0o755)
+		if err != nil {
+			return err
+		}
+
+		fi, err := os.Create(c.s.path)
+		if err != nil {
+			return err
+		}
+
+		c.s.f.ri.segmentCreated(c.s.path, c.s.startNTP)
+
+		err = writeMKVHeader(fi, c.s.f.tracks)
+		if err != nil {
+			fi.Close()
+			return err
+		}
+
+		c.s.fi = fi
+	}
+
+	return c.cluster.Marshal(c.s.fi)
+}
+
+func (c *formatMKVCluster) write(track *formatMKVTrack, sample *sample, dts time.Duration) error {
+	pts := dts + timestampToDuration(int64(sample.PTSOffset), int(track.initTrack.TimeScale))
+
+	c.cluster.Blocks = append(c.cluster.Blocks, &mkv.Block{
+		TrackNumber: uint64(track.initTrack.ID),
+		Timestamp:   pts - c.s.startDTS,
+		Keyframe:    !sample.IsNonSyncSample,
+		Payload:     sample.Payload,
+	})
+
+	endDTS := dts + timestampToDuration(int64(sample.Duration), int(track.initTrack.TimeScale))
+	if endDTS > c.endDTS {
+		c.endDTS = endDTS
+	}
+
+	return nil
+}
+
+func (c *formatMKVCluster) duration() time.Duration {
+	return c.endDTS - c.startDTS
+}
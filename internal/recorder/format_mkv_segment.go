@@ -0,0 +1,100 @@
+package recorder
+
+import (
+	"os"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mkv"
+)
+
+const (
+	// block timestamps are stored as 16-bit offsets from the cluster timestamp.
+	mkvMaxClusterDuration = 30 * time.Second
+)
+
+type formatMKVSegment struct {
+	f        *formatMKV
+	startDTS time.Duration
+	startNTP time.Time
+
+	path       string
+	fi         *os.File
+	curCluster *formatMKVCluster
+	endDTS     time.Duration
+}
+
+func (s *formatMKVSegment) initialize() {
+	s.endDTS = s.startDTS
+}
+
+func (s *formatMKVSegment) close() error {
+	var err error
+
+	if s.curCluster != nil {
+		err = s.curCluster.close()
+	}
+
+	if s.fi != nil {
+		s.f.ri.Log(logger.Debug, "closing segment %s", s.path)
+
+		// write overall duration in the header to speed up the playback server
+		duration := s.endDTS - s.startDTS
+		err2 := mkv.WriteDuration(s.fi, duration)
+		if err == nil {
+			err = err2
+		}
+
+		err2 = s.fi.Close()
+		if err == nil {
+			err = err2
+		}
+
+		if err2 == nil {
+			s.f.ri.segmentCompleted(s.path, s.startNTP, duration)
+		}
+	}
+
+	return err
+}
+
+// flush writes pending samples, in order to allow timestamp discontinuities.
+func (s *formatMKVSegment) flush() error {
+	if s.curCluster == nil {
+		return nil
+	}
+
+	err := s.curCluster.close()
+	s.curCluster = nil
+	return err
+}
+
+func (s *formatMKVSegment) write(track *formatMKVTrack, sample *sample, dts time.Duration) error {
+	endDTS := dts + timestampToDuration(int64(sample.Duration), int(track.initTrack.TimeScale))
+	if endDTS > s.endDTS {
+		s.endDTS = endDTS
+	}
+
+	if s.curCluster == nil {
+		s.curCluster = &formatMKVCluster{
+			s:        s,
+			startDTS: dts,
+		}
+		s.curCluster.initialize()
+	} else if d := s.curCluster.duration(); d >= s.f.ri.partDuration || d >= mkvMaxClusterDuration {
+		err := s.curCluster.close()
+		s.curCluster = nil
+
+		if err != nil {
+			return err
+		}
+
+		s.curCluster = &formatMKVCluster{
+			s:        s,
+			startDTS: dts,
+		}
+		s.curCluster.initialize()
+	}
+
+	return s.curCluster.write(track, sample, dts)
+}
@@ -0,0 +1,115 @@
+package recorder
+
+import (
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+type formatMKVTrack struct {
+	f         *formatMKV
+	initTrack *fmp4.InitTrack
+
+	nextSample   *sample
+	lastDuration uint32
+}
+
+func (t *formatMKVTrack) write(sample *sample) error {
+	// wait the first video sample before setting hasVideo
+	if t.initTrack.Codec.IsVideo() {
+		t.f.hasVideo = true
+	}
+
+	// the segment of a previous stream is being continued:
+	// shift timestamps in order to place the resumed stream after the end of the segment,
+	// preserving the wall-clock gap between streams.
+	if t.f.resumePending {
+		t.f.resumePending = false
+
+		if t.f.resumedTracksMatch() {
+			gap := max(sample.ntp.Sub(t.f.resumeNTP), 0)
+			t.f.dtsOffset = t.f.resumeDTS + gap - timestampToDuration(sample.dts, int(t.initTrack.TimeScale))
+		} else {
+			t.f.ri.Log(logger.Info, "codec parameters have changed, starting a new segment")
+
+			t.f.resumeDTS = 0
+
+			err := t.f.currentSegment.close()
+			t.f.currentSegment = nil
+			if err != nil {
+				return err
+			}
+		}
+
+		t.f.resumedInitTracks = nil
+	}
+
+	sample, t.nextSample = t.nextSample, sample
+	if sample == nil {
+		return nil
+	}
+	sample.Duration = uint32(t.nextSample.dts - sample.dts)
+
+	written, err := t.writeSample(sample)
+	if err != nil || !written {
+		return err
+	}
+
+	nextDTS := timestampToDuration(t.nextSample.dts, int(t.initTrack.TimeScale)) + t.f.dtsOffset
+
+	if (!t.f.hasVideo || t.initTrack.Codec.IsVideo()) &&
+		!t.nextSample.IsNonSyncSample &&
+		t.f.ri.segmentMustEnd(t.f.currentSegmentStartDTS, t.f.currentSegmentStartNTP, nextDTS, t.nextSample.ntp) {
+		err := t.f.currentSegment.close()
+		if err != nil {
+			return err
+		}
+
+		oldestNTP, oldestDTS := nextSegmentStartingPos(t.f.nextSamplePositions())
+		t.f.newSegment(oldestDTS, oldestNTP)
+	}
+
+	return nil
+}
+
+func (t *formatMKVTrack) writeSample(sample *sample) (bool, error) {
+	dts := timestampToDuration(sample.dts, int(t.initTrack.TimeScale)) + t.f.dtsOffset
+
+	if t.f.currentSegment == nil {
+		t.f.newSegment(dts, sample.ntp)
+	} else if (dts-t.f.currentSegmentStartDTS) < 0 || // block timestamps can't precede the segment
+		dts < t.f.resumeDTS { // sample overlaps with the continued segment
+		t.f.ri.Log(logger.Warn, "sample of track %d received too late, discarding", t.initTrack.ID)
+		return false, nil
+	}
+
+	err := t.f.currentSegment.write(t, sample, dts)
+	if err != nil {
+		return false, err
+	}
+
+	t.lastDuration = sample.Duration
+
+	duration := timestampToDuration(int64(sample.Duration), int(t.initTrack.TimeScale))
+	if endDTS := dts + duration; endDTS > t.f.endDTS {
+		t.f.endDTS = endDTS
+		t.f.endNTP = sample.ntp.Add(duration)
+	}
+
+	return true, nil
+}
+
+// flush writes the buffered sample, whose duration is unknown
+// and is assumed to be equal to the one of the previous sample.
+func (t *formatMKVTrack) flush() error {
+	if t.nextSample == nil {
+		return nil
+	}
+
+	sample := t.nextSample
+	t.nextSample = nil
+	sample.Duration = t.lastDuration
+
+	_, err := t.writeSample(sample)
+	return err
+}
@@ -78,6 +78,10 @@ func (f *formatMPEGTS) initialize() bool {
 	}
 
 	for _, media := range f.ri.stream.Desc.Medias {
+		if !f.ri.recordMedia(media) {
+			continue
+		}
+
 		for _, forma := range media.Formats {
 			clockRate := forma.ClockRate()
 
@@ -387,7 +391,7 @@ func (f *formatMPEGTS) initialize() bool {
 	n := 1
 	for _, medi := range f.ri.stream.Desc.Medias {
 		for _, forma := range medi.Formats {
-			if _, ok := setuppedFormatsMap[forma]; !ok {
+			if _, ok := setuppedFormatsMap[forma]; !ok && f.ri.recordMedia(medi) {
 				f.ri.Log(logger.Warn, "skipping track %d (%s)", n, forma.Codec())
 			}
 			n++
@@ -409,6 +413,16 @@ func (f *formatMPEGTS) initialize() bool {
 	return true
 }
 
+func (f *formatMPEGTS) suspend() bool {
+	// continuing MPEG-TS segments is not supported
+	f.close()
+	return false
+}
+
+func (f *formatMPEGTS) resume(_ format) bool {
+	return false
+}
+
 func (f *formatMPEGTS) close() {
 	if f.currentSegment != nil {
 		f.currentSegment.close() //nolint:errcheck
@@ -436,7 +450,7 @@ func (f *formatMPEGTS) write(
 		f.currentSegment.initialize()
 	case (!f.hasVideo || isVideo) &&
 		randomAccess &&
-		(dts-f.currentSegment.startDTS) >= f.ri.segmentDuration:
+		f.ri.segmentMustEnd(f.currentSegment.startDTS, f.currentSegment.startNTP, dts, ntp):
 		f.currentSegment.lastDTS = dts
 		err := f.currentSegment.close()
 		if err != nil {
@@ -38,7 +38,7 @@ func (s *formatMPEGTSSegment) close() error {
 
 		if err2 == nil {
 			duration := s.lastDTS - s.startDTS
-			s.f.ri.onSegmentComplete(s.path, duration)
+			s.f.ri.segmentCompleted(s.path, s.startNTP, duration)
 		}
 	}
 
@@ -60,7 +60,7 @@ func (s *formatMPEGTSSegment) Write(p []byte) (int, error) {
 			return 0, err
 		}
 
-		s.f.ri.onSegmentCreate(s.path)
+		s.f.ri.segmentCreated(s.path, s.startNTP)
 
 		s.fi = fi
 	}
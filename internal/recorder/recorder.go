@@ -6,6 +6,7 @@ import (
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -15,14 +16,25 @@ type OnSegmentCreateFunc = func(path string)
 // OnSegmentCompleteFunc is the prototype of the function passed as OnSegmentComplete
 type OnSegmentCompleteFunc = func(path string, duration time.Duration)
 
+type recorderResumeReq struct {
+	stream *stream.Stream
+	done   chan struct{}
+}
+
 // Recorder writes recordings to disk.
 type Recorder struct {
 	PathFormat        string
 	Format            conf.RecordFormat
 	PartDuration      time.Duration
 	SegmentDuration   time.Duration
+	AlignSegments     bool
+	Tracks            []string
 	PathName          string
 	Stream            *stream.Stream
+	Index             *recordstore.Index
+	Manifests         *recordstore.ManifestWriter
+	ManifestPath      string
+	ManifestKey       string
 	OnSegmentCreate   OnSegmentCreateFunc
 	OnSegmentComplete OnSegmentCompleteFunc
 	Parent            logger.Writer
@@ -31,6 +43,9 @@ type Recorder struct {
 
 	currentInstance *recorderInstance
 
+	chSuspend chan chan struct{}
+	chResume  chan recorderResumeReq
+
 	terminate chan struct{}
 	done      chan struct{}
 }
@@ -49,21 +64,12 @@ func (r *Recorder) Initialize() {
 		r.restartPause = 2 * time.Second
 	}
 
+	r.chSuspend = make(chan chan struct{})
+	r.chResume = make(chan recorderResumeReq)
 	r.terminate = make(chan struct{})
 	r.done = make(chan struct{})
 
-	r.currentInstance = &recorderInstance{
-		pathFormat:        r.PathFormat,
-		format:            r.Format,
-		partDuration:      r.PartDuration,
-		segmentDuration:   r.SegmentDuration,
-		pathName:          r.PathName,
-		stream:            r.Stream,
-		onSegmentCreate:   r.OnSegmentCreate,
-		onSegmentComplete: r.OnSegmentComplete,
-		parent:            r,
-	}
-	r.currentInstance.initialize()
+	r.currentInstance = r.newInstance(nil)
 
 	go r.run()
 }
@@ -80,6 +86,54 @@ func (r *Recorder) Close() {
 	<-r.done
 }
 
+// Suspend stops reading from the stream, keeping the current segment open,
+// in order to continue it with the stream passed to Resume.
+func (r *Recorder) Suspend() {
+	done := make(chan struct{})
+	select {
+	case r.chSuspend <- done:
+		<-done
+	case <-r.done:
+	}
+}
+
+// Resume continues recording with a new stream.
+func (r *Recorder) Resume(strm *stream.Stream) {
+	req := recorderResumeReq{
+		stream: strm,
+		done:   make(chan struct{}),
+	}
+
+	select {
+	case r.chResume <- req:
+		<-req.done
+	case <-r.done:
+	}
+}
+
+func (r *Recorder) newInstance(prevFormat format) *recorderInstance {
+	ri := &recorderInstance{
+		pathFormat:        r.PathFormat,
+		format:            r.Format,
+		partDuration:      r.PartDuration,
+		segmentDuration:   r.SegmentDuration,
+		alignSegments:     r.AlignSegments,
+		tracks:            r.Tracks,
+		pathName:          r.PathName,
+		stream:            r.Stream,
+		index:             r.Index,
+		manifests:         r.Manifests,
+		manifestPath:      r.ManifestPath,
+		manifestKey:       r.ManifestKey,
+		onSegmentCreate:   r.OnSegmentCreate,
+		onSegmentComplete: r.OnSegmentComplete,
+		parent:            r,
+		prevFormat:        prevFormat,
+	}
+	ri.initialize()
+	return ri
+}
+
 func (r *Recorder) run() {
 	defer close(r.done)
 
@@ -87,6 +141,16 @@ func (r *Recorder) run() {
 		select {
 		case <-r.currentInstance.done:
 			r.currentInstance.close()
+
+		case done := <-r.chSuspend:
+			suspended := r.currentInstance.suspend()
+			close(done)
+
+			if !r.waitResume(suspended) {
+				return
+			}
+			continue
+
 		case <-r.terminate:
 			r.currentInstance.close()
 			return
@@ -94,21 +158,38 @@ func (r *Recorder) run() {
 
 		select {
 		case <-time.After(r.restartPause):
+		case done := <-r.chSuspend:
+			close(done)
+
+			if !r.waitResume(nil) {
+				return
+			}
+			continue
+
 		case <-r.terminate:
 			return
 		}
 
-		r.currentInstance = &recorderInstance{
-			pathFormat:        r.PathFormat,
-			format:            r.Format,
-			partDuration:      r.PartDuration,
-			segmentDuration:   r.SegmentDuration,
-			pathName:          r.PathName,
-			stream:            r.Stream,
-			onSegmentCreate:   r.OnSegmentCreate,
-			onSegmentComplete: r.OnSegmentComplete,
-			parent:            r,
+		r.currentInstance = r.newInstance(nil)
+	}
+}
+
+// waitResume waits for a new stream, while keeping open the segment of a suspended instance.
+// It returns false when the recorder is closed.
+func (r *Recorder) waitResume(suspended format) bool {
+	r.Log(logger.Info, "stream is not available, waiting for it to come back")
+
+	select {
+	case req := <-r.chResume:
+		r.Stream = req.stream
+		r.currentInstance = r.newInstance(suspended)
+		close(req.done)
+		return true
+
+	case <-r.terminate:
+		if suspended != nil {
+			suspended.close()
 		}
-		r.currentInstance.initialize()
+		return false
 	}
 }
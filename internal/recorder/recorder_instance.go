@@ -1,9 +1,11 @@
 package recorder
 
 import (
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
 
 	"github.com/bluenviron/mediamtx/internal/conf"
@@ -23,15 +25,24 @@ type recorderInstance struct {
 	format            conf.RecordFormat
 	partDuration      time.Duration
 	segmentDuration   time.Duration
+	alignSegments     bool
+	tracks            []string
 	pathName          string
 	stream            *stream.Stream
+	index             *recordstore.Index
+	manifests         *recordstore.ManifestWriter
+	manifestPath      string
+	manifestKey       string
 	onSegmentCreate   OnSegmentCreateFunc
 	onSegmentComplete OnSegmentCompleteFunc
 	parent            logger.Writer
+	prevFormat        format
 
 	pathFormat2 string
 	format2     format
 	skip        bool
+	keepSegment bool
+	suspended   format
 
 	terminate chan struct{}
 	done      chan struct{}
@@ -61,6 +72,13 @@ func (ri *recorderInstance) initialize() {
 		ok := ri.format2.initialize()
 		ri.skip = !ok
 
+	case conf.RecordFormatMKV:
+		ri.format2 = &formatMKV{
+			ri: ri,
+		}
+		ok := ri.format2.initialize()
+		ri.skip = !ok
+
 	default:
 		ri.format2 = &formatFMP4{
 			ri: ri,
@@ -69,6 +87,14 @@ func (ri *recorderInstance) initialize() {
 		ri.skip = !ok
 	}
 
+	// continue the segment of a suspended instance
+	if ri.prevFormat != nil {
+		if ri.skip || !ri.format2.resume(ri.prevFormat) {
+			ri.prevFormat.close()
+		}
+		ri.prevFormat = nil
+	}
+
 	if !ri.skip {
 		ri.stream.StartReader(ri)
 	}
@@ -76,18 +102,103 @@ func (ri *recorderInstance) initialize() {
 	go ri.run()
 }
 
+// alignedSegmentEnd returns the first wall-clock boundary after the start of a segment.
+// Boundaries are multiples of the segment duration, starting from midnight.
+// They are computed on the wall clock, in order not to drift on days
+// in which daylight saving time starts or ends.
+func alignedSegmentEnd(start time.Time, segmentDuration time.Duration) time.Time {
+	y, mo, d := start.Date()
+	h, mi, s := start.Clock()
+
+	elapsed := time.Duration(h)*time.Hour +
+		time.Duration(mi)*time.Minute +
+		time.Duration(s)*time.Second +
+		time.Duration(start.Nanosecond())
+	next := (elapsed/segmentDuration + 1) * segmentDuration
+
+	end := time.Date(y, mo, d,
+		int(next/time.Hour),
+		int((next%time.Hour)/time.Minute),
+		int((next%time.Minute)/time.Second),
+		int(next%time.Second),
+		start.Location())
+
+	// when daylight saving time ends, wall-clock times are repeated
+	// and time.Date returns the first occurrence, that may precede the start.
+	if !end.After(start) {
+		_, startOffset := start.Zone()
+		_, endOffset := end.Zone()
+		end = end.Add(time.Duration(endOffset-startOffset) * time.Second)
+	}
+
+	return end
+}
+
+// segmentMustEnd checks whether the current segment must be closed before a random access sample.
+func (ri *recorderInstance) segmentMustEnd(
+	startDTS time.Duration,
+	startNTP time.Time,
+	dts time.Duration,
+	ntp time.Time,
+) bool {
+	if ri.alignSegments {
+		return !ntp.Before(alignedSegmentEnd(startNTP, ri.segmentDuration))
+	}
+	return (dts - startDTS) >= ri.segmentDuration
+}
+
+// recordMedia checks whether a media must be recorded.
+func (ri *recorderInstance) recordMedia(media *description.Media) bool {
+	return len(ri.tracks) == 0 || slices.Contains(ri.tracks, string(media.Type))
+}
+
+func (ri *recorderInstance) segmentCreated(path string, start time.Time) {
+	var codecs []string
+	for _, media := range ri.stream.Desc.Medias {
+		if !ri.recordMedia(media) {
+			continue
+		}
+		for _, forma := range media.Formats {
+			codecs = append(codecs, forma.Codec())
+		}
+	}
+
+	ri.index.AddSegment(ri.pathName, path, start, codecs)
+	ri.onSegmentCreate(path)
+}
+
+func (ri *recorderInstance) segmentCompleted(path string, start time.Time, duration time.Duration) {
+	ri.index.CompleteSegment(ri.pathName, path, duration)
+	if ri.manifestPath != "" {
+		ri.manifests.Add(ri.manifestPath, ri.manifestKey, ri.pathName, path, start, duration)
+	}
+	ri.onSegmentComplete(path, duration)
+}
+
 func (ri *recorderInstance) close() {
 	close(ri.terminate)
 	<-ri.done
 }
 
+// suspend stops the instance, keeping the current segment open.
+// It returns the format that contains the segment, or nil.
+func (ri *recorderInstance) suspend() format {
+	ri.keepSegment = true
+	close(ri.terminate)
+	<-ri.done
+	return ri.suspended
+}
+
 func (ri *recorderInstance) run() {
 	defer close(ri.done)
 
+	terminated := true
+
 	if !ri.skip {
 		select {
 		case err := <-ri.stream.ReaderError(ri):
 			ri.Log(logger.Error, err.Error())
+			terminated = false
 
 		case <-ri.terminate:
 		}
@@ -97,5 +208,10 @@ func (ri *recorderInstance) run() {
 		<-ri.terminate
 	}
 
-	ri.format2.close()
+	// keepSegment is read only after terminate has been closed
+	if terminated && ri.keepSegment && ri.format2.suspend() {
+		ri.suspended = ri.format2
+	} else {
+		ri.format2.close()
+	}
 }
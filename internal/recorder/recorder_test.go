@@ -1,6 +1,11 @@
 package recorder
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,6 +22,8 @@ import (
 
 	"github.com/bluenviron/mediamtx/internal/conf"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mkv"
+	"github.com/bluenviron/mediamtx/internal/recordstore"
 	"github.com/bluenviron/mediamtx/internal/stream"
 	"github.com/bluenviron/mediamtx/internal/test"
 	"github.com/bluenviron/mediamtx/internal/unit"
@@ -123,7 +130,7 @@ func TestRecorder(t *testing.T) {
 		}
 	}
 
-	for _, ca := range []string{"fmp4", "mpegts"} {
+	for _, ca := range []string{"fmp4", "mpegts", "mkv"} {
 		t.Run(ca, func(t *testing.T) {
 			strm := &stream.Stream{
 				WriteQueueSize:     512,
@@ -136,7 +143,7 @@ func TestRecorder(t *testing.T) {
 			require.NoError(t, err)
 			defer strm.Close()
 
-			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
 			require.NoError(t, err)
 			defer os.RemoveAll(dir)
 
@@ -146,17 +153,20 @@ func TestRecorder(t *testing.T) {
 			segDone := make(chan struct{}, 4)
 
 			var f conf.RecordFormat
-			if ca == "fmp4" {
-				f = conf.RecordFormatFMP4
-			} else {
-				f = conf.RecordFormatMPEGTS
-			}
-
 			var ext string
-			if ca == "fmp4" {
+
+			switch ca {
+			case "fmp4":
+				f = conf.RecordFormatFMP4
 				ext = "mp4"
-			} else {
+
+			case "mpegts":
+				f = conf.RecordFormatMPEGTS
 				ext = "ts"
+
+			default:
+				f = conf.RecordFormatMKV
+				ext = "mkv"
 			}
 
 			n := 0
@@ -222,7 +232,8 @@ func TestRecorder(t *testing.T) {
 				<-segDone
 			}
 
-			if ca == "fmp4" {
+			switch ca {
+			case "fmp4":
 				var init fmp4.Init
 
 				func() {
@@ -287,7 +298,37 @@ func TestRecorder(t *testing.T) {
 
 				_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-16-25-000000."+ext))
 				require.NoError(t, err)
-			} else {
+
+			case "mkv":
+				func() {
+					f, err2 := os.Open(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext))
+					require.NoError(t, err2)
+					defer f.Close()
+
+					r := &mkv.Reader{R: f}
+					err2 = r.Initialize()
+					require.NoError(t, err2)
+
+					require.Equal(t, 2*time.Second, r.Header.Duration)
+					require.Len(t, r.Header.Tracks, 5)
+					require.Equal(t, &mp4.CodecH264{
+						SPS: test.FormatH264.SPS,
+						PPS: test.FormatH264.PPS,
+					}, r.Header.Tracks[0].Codec)
+
+					blockCount := 0
+					err2 = r.ReadBlocks(func(_ *mkv.BlockInfo) error {
+						blockCount++
+						return nil
+					})
+					require.NoError(t, err2)
+					require.NotZero(t, blockCount)
+				}()
+
+				_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-16-25-000000."+ext))
+				require.NoError(t, err)
+
+			default:
 				_, err = os.Stat(filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext))
 				require.NoError(t, err)
 
@@ -350,7 +391,7 @@ func TestRecorderFMP4NegativeDTS(t *testing.T) {
 	require.NoError(t, err)
 	defer strm.Close()
 
-	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	dir, err := os.MkdirTemp("", "mediamtx-recorder")
 	require.NoError(t, err)
 	defer os.RemoveAll(dir)
 
@@ -438,7 +479,7 @@ func TestRecorderSkipTracksPartial(t *testing.T) {
 			require.NoError(t, err)
 			defer strm.Close()
 
-			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
 			require.NoError(t, err)
 			defer os.RemoveAll(dir)
 
@@ -499,7 +540,7 @@ func TestRecorderSkipTracksFull(t *testing.T) {
 			require.NoError(t, err)
 			defer strm.Close()
 
-			dir, err := os.MkdirTemp("", "mediamtx-agent")
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
 			require.NoError(t, err)
 			defer os.RemoveAll(dir)
 
@@ -539,6 +580,68 @@ func TestRecorderSkipTracksFull(t *testing.T) {
 	}
 }
 
+func TestRecorderTracks(t *testing.T) {
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			desc := &description.Session{Medias: []*description.Media{
+				{
+					Type:    description.MediaTypeVideo,
+					Formats: []rtspformat.Format{test.FormatH264},
+				},
+				{
+					Type:    description.MediaTypeAudio,
+					Formats: []rtspformat.Format{test.FormatMPEG4Audio},
+				},
+			}}
+
+			strm := &stream.Stream{
+				WriteQueueSize:     512,
+				UDPMaxPayloadSize:  1472,
+				Desc:               desc,
+				GenerateRTPPackets: true,
+				Parent:             test.NilLogger,
+			}
+			err := strm.Initialize()
+			require.NoError(t, err)
+			defer strm.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			recordPath := filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f")
+
+			var msgs []string
+
+			l := test.Logger(func(_ logger.Level, format string, args ...interface{}) {
+				msgs = append(msgs, fmt.Sprintf(format, args...))
+			})
+
+			var fo conf.RecordFormat
+			if ca == "fmp4" {
+				fo = conf.RecordFormatFMP4
+			} else {
+				fo = conf.RecordFormatMPEGTS
+			}
+
+			w := &Recorder{
+				PathFormat:      recordPath,
+				Format:          fo,
+				PartDuration:    100 * time.Millisecond,
+				SegmentDuration: 1 * time.Second,
+				Tracks:          []string{"audio"},
+				PathName:        "mypath",
+				Stream:          strm,
+				Parent:          l,
+			}
+			w.Initialize()
+			defer w.Close()
+
+			require.Equal(t, []string{"[recorder] recording 1 track (MPEG-4 Audio)"}, msgs)
+		})
+	}
+}
+
 func TestRecorderFMP4SegmentSwitch(t *testing.T) {
 	desc := &description.Session{Medias: []*description.Media{
 		{
@@ -562,7 +665,7 @@ func TestRecorderFMP4SegmentSwitch(t *testing.T) {
 	require.NoError(t, err)
 	defer strm.Close()
 
-	dir, err := os.MkdirTemp("", "mediamtx-agent")
+	dir, err := os.MkdirTemp("", "mediamtx-recorder")
 	require.NoError(t, err)
 	defer os.RemoveAll(dir)
 
@@ -655,3 +758,437 @@ func TestRecorderFMP4SegmentSwitch(t *testing.T) {
 
 	require.Equal(t, 2, n)
 }
+
+func TestAlignedSegmentEnd(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Rome")
+	require.NoError(t, err)
+
+	// second occurrence of 02:10, when daylight saving time ends
+	repeated := time.Date(2024, 10, 27, 2, 10, 0, 0, loc).Add(time.Hour)
+
+	for _, ca := range []struct {
+		name     string
+		start    time.Time
+		duration time.Duration
+		end      time.Time
+	}{
+		{
+			"standard",
+			time.Date(2024, 5, 19, 23, 50, 0, 0, loc),
+			time.Hour,
+			time.Date(2024, 5, 20, 0, 0, 0, 0, loc),
+		},
+		{
+			"daylight saving time start",
+			time.Date(2024, 3, 31, 0, 30, 0, 0, loc),
+			6 * time.Hour,
+			time.Date(2024, 3, 31, 6, 0, 0, 0, loc),
+		},
+		{
+			"daylight saving time end",
+			time.Date(2024, 10, 27, 0, 30, 0, 0, loc),
+			6 * time.Hour,
+			time.Date(2024, 10, 27, 6, 0, 0, 0, loc),
+		},
+		{
+			"repeated hour",
+			repeated,
+			30 * time.Minute,
+			repeated.Add(20 * time.Minute),
+		},
+	} {
+		t.Run(ca.name, func(t *testing.T) {
+			end := alignedSegmentEnd(ca.start, ca.duration)
+			require.True(t, ca.end.Equal(end), "expected %v, got %v", ca.end, end)
+		})
+	}
+}
+
+func TestRecorderAlignSegments(t *testing.T) {
+	for _, ca := range []string{"fmp4", "mpegts"} {
+		t.Run(ca, func(t *testing.T) {
+			desc := &description.Session{Medias: []*description.Media{{
+				Type: description.MediaTypeVideo,
+				Formats: []rtspformat.Format{&rtspformat.H264{
+					PayloadTyp:        96,
+					PacketizationMode: 1,
+				}},
+			}}}
+
+			strm := &stream.Stream{
+				WriteQueueSize:     512,
+				UDPMaxPayloadSize:  1472,
+				Desc:               desc,
+				GenerateRTPPackets: true,
+				Parent:             test.NilLogger,
+			}
+			err := strm.Initialize()
+			require.NoError(t, err)
+			defer strm.Close()
+
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			var fo conf.RecordFormat
+			var ext string
+			if ca == "fmp4" {
+				fo = conf.RecordFormatFMP4
+				ext = ".mp4"
+			} else {
+				fo = conf.RecordFormatMPEGTS
+				ext = ".ts"
+			}
+
+			w := &Recorder{
+				PathFormat:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:          fo,
+				PartDuration:    100 * time.Millisecond,
+				SegmentDuration: 1 * time.Second,
+				AlignSegments:   true,
+				PathName:        "mypath",
+				Stream:          strm,
+				Parent:          test.NilLogger,
+			}
+			w.Initialize()
+
+			for i := 0; i < 8; i++ {
+				strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+					Base: unit.Base{
+						PTS: int64(i) * 300 * 90000 / 1000,
+						NTP: time.Date(2008, 5, 20, 22, 15, 25, 500000000, time.Local).
+							Add(time.Duration(i) * 300 * time.Millisecond),
+					},
+					AU: [][]byte{
+						test.FormatH264.SPS,
+						test.FormatH264.PPS,
+						{5}, // IDR
+					},
+				})
+			}
+
+			time.Sleep(50 * time.Millisecond)
+
+			w.Close()
+
+			entries, err := os.ReadDir(filepath.Join(dir, "mypath"))
+			require.NoError(t, err)
+
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+
+			require.Equal(t, []string{
+				"2008-05-20_22-15-25-500000" + ext,
+				"2008-05-20_22-15-26-100000" + ext,
+				"2008-05-20_22-15-27-000000" + ext,
+			}, names)
+		})
+	}
+}
+
+func TestRecorderReconnect(t *testing.T) {
+	for _, ca := range []string{"fmp4", "mkv"} {
+		t.Run(ca, func(t *testing.T) {
+			desc := &description.Session{Medias: []*description.Media{{
+				Type: description.MediaTypeVideo,
+				Formats: []rtspformat.Format{&rtspformat.H264{
+					PayloadTyp:        96,
+					PacketizationMode: 1,
+				}},
+			}}}
+
+			newStream := func() *stream.Stream {
+				strm := &stream.Stream{
+					WriteQueueSize:     512,
+					UDPMaxPayloadSize:  1472,
+					Desc:               desc,
+					GenerateRTPPackets: true,
+					Parent:             test.NilLogger,
+				}
+				err := strm.Initialize()
+				require.NoError(t, err)
+				return strm
+			}
+
+			writeFrames := func(strm *stream.Stream, pts time.Duration, ntp time.Time) {
+				for i := 0; i < 3; i++ {
+					strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+						Base: unit.Base{
+							PTS: int64(pts+time.Duration(i)*200*time.Millisecond) * 90000 / int64(time.Second),
+							NTP: ntp.Add(time.Duration(i) * 200 * time.Millisecond),
+						},
+						AU: [][]byte{
+							test.FormatH264.SPS,
+							test.FormatH264.PPS,
+							{5}, // IDR
+						},
+					})
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			dir, err := os.MkdirTemp("", "mediamtx-recorder")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			var f conf.RecordFormat
+			var ext string
+			if ca == "fmp4" {
+				f = conf.RecordFormatFMP4
+				ext = "mp4"
+			} else {
+				f = conf.RecordFormatMKV
+				ext = "mkv"
+			}
+
+			type completedSegment struct {
+				path     string
+				duration time.Duration
+			}
+			var completed []completedSegment
+
+			strm1 := newStream()
+
+			w := &Recorder{
+				PathFormat:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+				Format:          f,
+				PartDuration:    100 * time.Millisecond,
+				SegmentDuration: 10 * time.Second,
+				PathName:        "mypath",
+				Stream:          strm1,
+				OnSegmentComplete: func(segPath string, du time.Duration) {
+					completed = append(completed, completedSegment{segPath, du})
+				},
+				Parent: test.NilLogger,
+			}
+			w.Initialize()
+
+			writeFrames(strm1, 0, time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC))
+
+			w.Suspend()
+			strm1.Close()
+
+			strm2 := newStream()
+			defer strm2.Close()
+
+			w.Resume(strm2)
+
+			// timestamps restart from an arbitrary value, while 1.8s have passed
+			writeFrames(strm2, 10*time.Second, time.Date(2008, 5, 20, 22, 15, 27, 0, time.UTC))
+
+			w.Close()
+
+			require.Equal(t, []completedSegment{{
+				path:     filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000."+ext),
+				duration: 2400 * time.Millisecond,
+			}}, completed)
+
+			if ca == "fmp4" {
+				byts, err := os.ReadFile(completed[0].path)
+				require.NoError(t, err)
+
+				var parts fmp4.Parts
+				err = parts.Unmarshal(byts)
+				require.NoError(t, err)
+
+				var baseTimes []uint64
+				for _, part := range parts {
+					baseTimes = append(baseTimes, part.Tracks[0].BaseTime)
+				}
+
+				// the last sample of the first stream is written on suspend
+				// and the gap between streams is preserved
+				require.Equal(t, []uint64{0, 18000, 36000, 180000, 198000}, baseTimes)
+			}
+		})
+	}
+}
+
+func TestRecorderReconnectCodecChanged(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []rtspformat.Format{&rtspformat.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	newStream := func() *stream.Stream {
+		strm := &stream.Stream{
+			WriteQueueSize:     512,
+			UDPMaxPayloadSize:  1472,
+			Desc:               desc,
+			GenerateRTPPackets: true,
+			Parent:             test.NilLogger,
+		}
+		err := strm.Initialize()
+		require.NoError(t, err)
+		return strm
+	}
+
+	writeFrames := func(strm *stream.Stream, sps []byte, pts time.Duration, ntp time.Time) {
+		for i := 0; i < 3; i++ {
+			strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+				Base: unit.Base{
+					PTS: int64(pts+time.Duration(i)*200*time.Millisecond) * 90000 / int64(time.Second),
+					NTP: ntp.Add(time.Duration(i) * 200 * time.Millisecond),
+				},
+				AU: [][]byte{
+					sps,
+					test.FormatH264.PPS,
+					{5}, // IDR
+				},
+			})
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	dir, err := os.MkdirTemp("", "mediamtx-recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var completed []string
+
+	strm1 := newStream()
+
+	w := &Recorder{
+		PathFormat:      filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		Format:          conf.RecordFormatFMP4,
+		PartDuration:    100 * time.Millisecond,
+		SegmentDuration: 10 * time.Second,
+		PathName:        "mypath",
+		Stream:          strm1,
+		OnSegmentComplete: func(segPath string, _ time.Duration) {
+			completed = append(completed, segPath)
+		},
+		Parent: test.NilLogger,
+	}
+	w.Initialize()
+
+	writeFrames(strm1, test.FormatH264.SPS, 0, time.Date(2008, 5, 20, 22, 15, 25, 0, time.UTC))
+
+	w.Suspend()
+	strm1.Close()
+
+	strm2 := newStream()
+	defer strm2.Close()
+
+	w.Resume(strm2)
+
+	// the publisher comes back with a different resolution
+	sps2 := []byte{
+		0x67, 0x64, 0x00, 0x0c, 0xac, 0x3b, 0x50, 0xb0,
+		0x4b, 0x42, 0x00, 0x00, 0x03, 0x00, 0x02, 0x00,
+		0x00, 0x03, 0x00, 0x3d, 0x08,
+	}
+
+	writeFrames(strm2, sps2, 10*time.Second, time.Date(2008, 5, 20, 22, 15, 27, 0, time.UTC))
+
+	w.Close()
+
+	require.Equal(t, []string{
+		filepath.Join(dir, "mypath", "2008-05-20_22-15-25-000000.mp4"),
+		filepath.Join(dir, "mypath", "2008-05-20_22-15-27-000000.mp4"),
+	}, completed)
+
+	for i, sps := range [][]byte{test.FormatH264.SPS, sps2} {
+		byts, err := os.ReadFile(completed[i])
+		require.NoError(t, err)
+
+		var init fmp4.Init
+		err = init.Unmarshal(bytes.NewReader(byts))
+		require.NoError(t, err)
+		require.Equal(t, sps, init.Tracks[0].Codec.(*mp4.CodecH264).SPS)
+	}
+}
+
+func TestRecorderManifest(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{{
+		Type: description.MediaTypeVideo,
+		Formats: []rtspformat.Format{&rtspformat.H264{
+			PayloadTyp:        96,
+			PacketizationMode: 1,
+		}},
+	}}}
+
+	strm := &stream.Stream{
+		WriteQueueSize:     512,
+		UDPMaxPayloadSize:  1472,
+		Desc:               desc,
+		GenerateRTPPackets: true,
+		Parent:             test.NilLogger,
+	}
+	err := strm.Initialize()
+	require.NoError(t, err)
+	defer strm.Close()
+
+	dir, err := os.MkdirTemp("", "mediamtx-recorder")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "manifest.key"),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{
+		RecordPath:            filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat:          conf.RecordFormatFMP4,
+		RecordSegmentDuration: conf.Duration(1 * time.Second),
+		RecordManifest:        true,
+		RecordManifestPath:    filepath.Join(dir, "%path/manifest_%Y-%m-%d.jsonl"),
+		RecordManifestKey:     filepath.Join(dir, "manifest.key"),
+	}
+
+	manifests := &recordstore.ManifestWriter{
+		Parent: test.NilLogger,
+	}
+	manifests.Initialize()
+
+	w := &Recorder{
+		PathFormat:      pathConf.RecordPath,
+		Format:          pathConf.RecordFormat,
+		PartDuration:    100 * time.Millisecond,
+		SegmentDuration: time.Duration(pathConf.RecordSegmentDuration),
+		PathName:        "mypath",
+		Stream:          strm,
+		Manifests:       manifests,
+		ManifestPath:    pathConf.RecordManifestPath,
+		ManifestKey:     pathConf.RecordManifestKey,
+		Parent:          test.NilLogger,
+	}
+	w.Initialize()
+
+	for i := 0; i < 4; i++ {
+		strm.WriteUnit(desc.Medias[0], desc.Medias[0].Formats[0], &unit.H264{
+			Base: unit.Base{
+				PTS: int64(i) * 600 * 90000 / 1000,
+				NTP: time.Date(2008, 5, 20, 22, 15, 25, 0, time.Local).Add(time.Duration(i) * 600 * time.Millisecond),
+			},
+			AU: [][]byte{
+				test.FormatH264.SPS,
+				test.FormatH264.PPS,
+				{5}, // IDR
+			},
+		})
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	w.Close()
+	manifests.Close()
+
+	report := recordstore.VerifyManifests(nil, pathConf, "mypath",
+		time.Date(2008, 5, 20, 22, 15, 0, 0, time.Local),
+		time.Date(2008, 5, 20, 22, 16, 0, 0, time.Local),
+		key.Public().(ed25519.PublicKey))
+	require.Equal(t, true, report.Valid)
+	require.Len(t, report.Segments, 2)
+}
@@ -0,0 +1,636 @@
+package recordstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	// the index file is rewritten when it contains at least this number of records
+	// and more than twice the number of indexed segments.
+	indexCompactMinRecords = 1000
+	indexMaxLineSize       = 1024 * 1024
+)
+
+type indexOp string
+
+const (
+	indexOpSet    indexOp = "set"
+	indexOpRemove indexOp = "remove"
+	indexOpDir    indexOp = "dir"
+)
+
+// indexDir is a directory that has been scanned,
+// with its modification time at the time of the scan.
+type indexDir struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+}
+
+type indexRecord struct {
+	Op    indexOp     `json:"op"`
+	Entry *IndexEntry `json:"entry,omitempty"`
+	Dir   *indexDir   `json:"dir,omitempty"`
+}
+
+// IndexEntry is a segment stored in the index.
+type IndexEntry struct {
+	Path     string        `json:"path"`
+	Fpath    string        `json:"fpath"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Size     uint64        `json:"size,omitempty"`
+	Codecs   []string      `json:"codecs,omitempty"`
+}
+
+// Index is a persistent index of recording segments,
+// that allows to find segments without walking recording directories.
+// The index is stored in a file as a journal of JSON records, that is rewritten
+// when it grows too much. This avoids depending on an external database,
+// while providing the same guarantees that are needed here: writes are appended
+// and partially written records are discarded when the file is loaded.
+//
+// The index is reconciled with disk when it's loaded, in order to take into account
+// segments that have been added or removed while the server was not running.
+// The index file stores the modification time of scanned directories,
+// therefore only directories that have been changed are read again.
+//
+// If FilePath is empty, the index is kept in memory only and is built
+// from disk at startup.
+//
+// All methods can be called on a nil Index: in this case,
+// segments are searched on disk.
+type Index struct {
+	FilePath  string
+	PathConfs map[string]*conf.Path
+	Parent    logger.Writer
+
+	mutex   sync.RWMutex
+	f       *os.File
+	entries map[string]map[string]*IndexEntry
+	dirs    map[string]time.Time
+	count   int
+	records int
+}
+
+// Initialize initializes Index.
+func (i *Index) Initialize() error {
+	i.entries = make(map[string]map[string]*IndexEntry)
+	i.dirs = make(map[string]time.Time)
+
+	if i.FilePath == "" {
+		i.reconcile()
+		i.Log(logger.Debug, "%d segments indexed in memory", i.count)
+		return nil
+	}
+
+	err := i.load()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		i.Log(logger.Info, "index not found, rebuilding it")
+	}
+
+	i.reconcile()
+
+	err = i.compact()
+	if err != nil {
+		return err
+	}
+
+	i.Log(logger.Info, "%d segments indexed", i.count)
+
+	return nil
+}
+
+// Close closes Index.
+func (i *Index) Close() {
+	if i == nil {
+		return
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.f != nil {
+		i.f.Close()
+	}
+}
+
+// Log implements logger.Writer.
+func (i *Index) Log(level logger.Level, format string, args ...interface{}) {
+	i.Parent.Log(level, "[record index] "+format, args...)
+}
+
+func (i *Index) load() error {
+	f, err := os.Open(i.FilePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), indexMaxLineSize)
+
+	for scanner.Scan() {
+		var rec indexRecord
+		err = json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			// skip records that have been partially written before a crash
+			continue
+		}
+
+		switch {
+		case rec.Op == indexOpDir && rec.Dir != nil:
+			i.dirs[rec.Dir.Path] = rec.Dir.ModTime
+
+		case rec.Entry != nil:
+			i.apply(&rec)
+			i.records++
+		}
+	}
+
+	return scanner.Err()
+}
+
+// reconcile adds segments that are present on disk but not in the index
+// and removes segments that are not present on disk anymore.
+// Directories whose modification time has not changed since the last scan are not read.
+func (i *Index) reconcile() {
+	byDir := make(map[string][]*IndexEntry)
+	for _, entries := range i.entries {
+		for _, e := range entries {
+			dir := filepath.Dir(e.Fpath)
+			byDir[dir] = append(byDir[dir], e)
+		}
+	}
+
+	subdirs := make(map[string][]string)
+	for dir := range i.dirs {
+		parent := filepath.Dir(dir)
+		subdirs[parent] = append(subdirs[parent], dir)
+	}
+
+	r := &indexReconciler{
+		i:       i,
+		byDir:   byDir,
+		subdirs: subdirs,
+		visited: make(map[string]struct{}),
+		dirs:    make(map[string]time.Time),
+	}
+
+	for _, pathConf := range i.PathConfs {
+		for _, recordConf := range pathConf.RecordConfs() {
+			recordPath := PathAddExtension(recordConf.RecordPath, recordConf.RecordFormat)
+			recordPath, _ = filepath.Abs(recordPath)
+			r.scan(CommonPath(recordPath))
+		}
+	}
+
+	// directories that are not reachable anymore
+	for dir, entries := range byDir {
+		if _, ok := r.visited[dir]; !ok {
+			for _, e := range entries {
+				i.apply(&indexRecord{Op: indexOpRemove, Entry: e})
+			}
+		}
+	}
+
+	i.dirs = r.dirs
+}
+
+type indexReconciler struct {
+	i       *Index
+	byDir   map[string][]*IndexEntry
+	subdirs map[string][]string
+	visited map[string]struct{}
+	dirs    map[string]time.Time
+}
+
+func (r *indexReconciler) scan(dir string) {
+	if _, ok := r.visited[dir]; ok {
+		return
+	}
+
+	// entries of directories that are not visited are removed
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		return
+	}
+
+	r.visited[dir] = struct{}{}
+
+	modTime, ok := r.i.dirs[dir]
+	if ok && modTime.Equal(fi.ModTime()) {
+		r.dirs[dir] = modTime
+
+		// update the size of segments that were being written
+		for _, e := range r.byDir[dir] {
+			if e.Size == 0 {
+				if fi, err := os.Stat(e.Fpath); err == nil {
+					e.Size = uint64(fi.Size())
+				}
+			}
+		}
+
+		for _, sub := range r.subdirs[dir] {
+			r.scan(sub)
+		}
+		return
+	}
+
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	r.dirs[dir] = fi.ModTime()
+
+	present := make(map[string]struct{})
+
+	for _, item := range items {
+		fpath := filepath.Join(dir, item.Name())
+
+		if item.IsDir() {
+			r.scan(fpath)
+			continue
+		}
+
+		present[fpath] = struct{}{}
+		r.addFile(fpath)
+	}
+
+	for _, e := range r.byDir[dir] {
+		if _, ok := present[e.Fpath]; !ok {
+			r.i.apply(&indexRecord{Op: indexOpRemove, Entry: e})
+		}
+	}
+}
+
+// addFile adds a file to the index if it's a segment of a path,
+// or updates its size if it's already indexed.
+func (r *indexReconciler) addFile(fpath string) {
+	pathName, start, ok := r.i.decode(fpath)
+	if !ok {
+		return
+	}
+
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		return
+	}
+
+	if e, ok := r.i.entries[pathName][fpath]; ok {
+		e.Size = uint64(fi.Size())
+		return
+	}
+
+	r.i.apply(&indexRecord{
+		Op: indexOpSet,
+		Entry: &IndexEntry{
+			Path:  pathName,
+			Fpath: fpath,
+			Start: start,
+			Size:  uint64(fi.Size()),
+		},
+	})
+}
+
+// decode returns the path name and start of a segment file.
+func (i *Index) decode(fpath string) (string, time.Time, bool) {
+	for _, pathConf := range i.PathConfs {
+		for _, recordConf := range pathConf.RecordConfs() {
+			pathName, start, ok := i.decodeRecording(pathConf, recordConf, fpath)
+			if ok {
+				return pathName, start, true
+			}
+		}
+	}
+
+	return "", time.Time{}, false
+}
+
+func (i *Index) decodeRecording(pathConf *conf.Path, recordConf *conf.Path, fpath string) (string, time.Time, bool) {
+	var pathName string
+	var recordPath string
+
+	if pathConf.Regexp == nil {
+		pathName = pathConf.Name
+		recordPath = absRecordPath(recordConf, pathName)
+	} else {
+		recordPath = PathAddExtension(recordConf.RecordPath, recordConf.RecordFormat)
+		recordPath, _ = filepath.Abs(recordPath)
+	}
+
+	var pa Path
+	if ok := pa.Decode(recordPath, fpath); !ok {
+		return "", time.Time{}, false
+	}
+
+	if pathConf.Regexp != nil {
+		pathName = pa.Path
+		if err := conf.IsValidPathName(pathName); err != nil {
+			return "", time.Time{}, false
+		}
+	}
+
+	// the segment must belong to the configuration that is used by the path
+	pathConf2, _, err := conf.FindPathConf(i.PathConfs, pathName)
+	if err != nil || pathConf2 != pathConf {
+		return "", time.Time{}, false
+	}
+
+	return pathName, pa.Start, true
+}
+
+func (i *Index) apply(rec *indexRecord) {
+	switch rec.Op {
+	case indexOpSet:
+		entries, ok := i.entries[rec.Entry.Path]
+		if !ok {
+			entries = make(map[string]*IndexEntry)
+			i.entries[rec.Entry.Path] = entries
+		}
+
+		if _, ok := entries[rec.Entry.Fpath]; !ok {
+			i.count++
+		}
+		entries[rec.Entry.Fpath] = rec.Entry
+
+	case indexOpRemove:
+		entries, ok := i.entries[rec.Entry.Path]
+		if !ok {
+			return
+		}
+
+		if _, ok := entries[rec.Entry.Fpath]; !ok {
+			return
+		}
+
+		delete(entries, rec.Entry.Fpath)
+		i.count--
+
+		if len(entries) == 0 {
+			delete(i.entries, rec.Entry.Path)
+		}
+	}
+}
+
+// compact rewrites the index file with the current content of the index.
+func (i *Index) compact() error {
+	err := os.MkdirAll(filepath.Dir(i.FilePath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := i.FilePath + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+
+	for _, entries := range i.entries {
+		for _, e := range entries {
+			err = enc.Encode(&indexRecord{Op: indexOpSet, Entry: e})
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+
+	for dir, modTime := range i.dirs {
+		err = enc.Encode(&indexRecord{Op: indexOpDir, Dir: &indexDir{Path: dir, ModTime: modTime}})
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	if i.f != nil {
+		i.f.Close()
+		i.f = nil
+	}
+
+	err = os.Rename(tmpPath, i.FilePath)
+	if err != nil {
+		return err
+	}
+
+	i.f, err = os.OpenFile(i.FilePath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	i.records = i.count
+
+	return nil
+}
+
+func (i *Index) write(rec *indexRecord) {
+	i.apply(rec)
+
+	if i.f == nil {
+		return
+	}
+
+	byts, _ := json.Marshal(rec)
+	byts = append(byts, '\n')
+
+	_, err := i.f.Write(byts)
+	if err != nil {
+		i.Log(logger.Warn, "unable to write index: %v", err)
+		return
+	}
+
+	i.records++
+
+	if i.records >= indexCompactMinRecords && i.records > 2*i.count {
+		err = i.compact()
+		if err != nil {
+			i.Log(logger.Warn, "unable to compact index: %v", err)
+		}
+	}
+}
+
+// AddSegment adds a segment to the index.
+func (i *Index) AddSegment(pathName string, fpath string, start time.Time, codecs []string) {
+	if i == nil {
+		return
+	}
+
+	fpath, _ = filepath.Abs(fpath)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.write(&indexRecord{
+		Op: indexOpSet,
+		Entry: &IndexEntry{
+			Path:   pathName,
+			Fpath:  fpath,
+			Start:  start,
+			Codecs: codecs,
+		},
+	})
+}
+
+// CompleteSegment sets duration and size of a segment.
+func (i *Index) CompleteSegment(pathName string, fpath string, duration time.Duration) {
+	if i == nil {
+		return
+	}
+
+	fpath, _ = filepath.Abs(fpath)
+
+	var size uint64
+	if fi, err := os.Stat(fpath); err == nil {
+		size = uint64(fi.Size())
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	e, ok := i.entries[pathName][fpath]
+	if !ok {
+		return
+	}
+
+	e2 := *e
+	e2.Duration = duration
+	e2.Size = size
+
+	i.write(&indexRecord{
+		Op:    indexOpSet,
+		Entry: &e2,
+	})
+}
+
+// RemoveSegment removes a segment from the index.
+func (i *Index) RemoveSegment(pathName string, fpath string) {
+	if i == nil {
+		return
+	}
+
+	fpath, _ = filepath.Abs(fpath)
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, ok := i.entries[pathName][fpath]; !ok {
+		return
+	}
+
+	i.write(&indexRecord{
+		Op: indexOpRemove,
+		Entry: &IndexEntry{
+			Path:  pathName,
+			Fpath: fpath,
+		},
+	})
+}
+
+// FindAllPathsWithSegments returns all paths that have at least one segment.
+func (i *Index) FindAllPathsWithSegments(pathConfs map[string]*conf.Path) []string {
+	if i == nil {
+		return FindAllPathsWithSegments(pathConfs)
+	}
+
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	out := []string{}
+
+	for pathName, entries := range i.entries {
+		pathConf, _, err := conf.FindPathConf(pathConfs, pathName)
+		if err != nil {
+			continue
+		}
+
+		recordPath := absRecordPath(pathConf, pathName)
+
+		for _, e := range entries {
+			var pa Path
+			if ok := pa.Decode(recordPath, e.Fpath); ok {
+				out = append(out, pathName)
+				break
+			}
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+// FindSegments returns all segments of a path.
+// Segments can be filtered by start date and end date.
+func (i *Index) FindSegments(
+	pathConf *conf.Path,
+	pathName string,
+	start *time.Time,
+	end *time.Time,
+) ([]*Segment, error) {
+	if i == nil {
+		return FindSegments(pathConf, pathName, start, end)
+	}
+
+	recordPath := absRecordPath(pathConf, pathName)
+
+	i.mutex.RLock()
+	var segments []*Segment
+
+	for _, e := range i.entries[pathName] {
+		var pa Path
+		ok := pa.Decode(recordPath, e.Fpath)
+
+		// gather all segments that starts before the end of the playback
+		if ok && (end == nil || !end.Before(pa.Start)) {
+			segments = append(segments, &Segment{
+				Fpath:    e.Fpath,
+				Start:    pa.Start,
+				Duration: e.Duration,
+				Size:     e.Size,
+			})
+		}
+	}
+	i.mutex.RUnlock()
+
+	return selectSegments(segments, start)
+}
+
+func absRecordPath(pathConf *conf.Path, pathName string) string {
+	recordPath := PathAddExtension(
+		strings.ReplaceAll(pathConf.RecordPath, "%path", pathName),
+		pathConf.RecordFormat,
+	)
+	recordPath, _ = filepath.Abs(recordPath)
+	return recordPath
+}
@@ -0,0 +1,217 @@
+package recordstore
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.Mkdir(filepath.Join(dir, "path1"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "path1", "2015-05-19_22-15-25-000427.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "path1", "2016-05-19_22-15-25-000427.mp4"), []byte{1, 2}, 0o644)
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{
+		Name:         "~^.*$",
+		Regexp:       regexp.MustCompile("^.*$"),
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+	}
+
+	pathConfs := map[string]*conf.Path{
+		"~^.*$": pathConf,
+	}
+
+	idx := &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: pathConfs,
+		Parent:    test.NilLogger,
+	}
+	err = idx.Initialize()
+	require.NoError(t, err)
+
+	// index is rebuilt from disk
+
+	require.Equal(t, []string{"path1"}, idx.FindAllPathsWithSegments(pathConfs))
+
+	segments, err := idx.FindSegments(pathConf, "path1", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath: filepath.Join(dir, "path1", "2015-05-19_22-15-25-000427.mp4"),
+			Start: time.Date(2015, 5, 19, 22, 15, 25, 427000, time.Local),
+			Size:  1,
+		},
+		{
+			Fpath: filepath.Join(dir, "path1", "2016-05-19_22-15-25-000427.mp4"),
+			Start: time.Date(2016, 5, 19, 22, 15, 25, 427000, time.Local),
+			Size:  2,
+		},
+	}, segments)
+
+	// index is updated
+
+	err = os.Mkdir(filepath.Join(dir, "path2"), 0o755)
+	require.NoError(t, err)
+
+	fpath := filepath.Join(dir, "path2", "2017-05-19_22-15-25-000427.mp4")
+	start := time.Date(2017, 5, 19, 22, 15, 25, 427000, time.Local)
+
+	err = os.WriteFile(fpath, []byte{1, 2, 3}, 0o644)
+	require.NoError(t, err)
+
+	idx.AddSegment("path2", fpath, start, []string{"H264"})
+	idx.CompleteSegment("path2", fpath, 3*time.Second)
+
+	err = os.Remove(filepath.Join(dir, "path1", "2015-05-19_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	idx.RemoveSegment("path1", filepath.Join(dir, "path1", "2015-05-19_22-15-25-000427.mp4"))
+	idx.Close()
+
+	// segments are added and removed while the index is closed
+
+	err = os.WriteFile(filepath.Join(dir, "path1", "2018-05-19_22-15-25-000427.mp4"), []byte{1, 2, 3, 4}, 0o644)
+	require.NoError(t, err)
+
+	err = os.Mkdir(filepath.Join(dir, "path3"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "path3", "2019-05-19_22-15-25-000427.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	err = os.Remove(filepath.Join(dir, "path1", "2016-05-19_22-15-25-000427.mp4"))
+	require.NoError(t, err)
+
+	// index is loaded from file and reconciled with disk
+
+	idx = &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: pathConfs,
+		Parent:    test.NilLogger,
+	}
+	err = idx.Initialize()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"path1", "path2", "path3"}, idx.FindAllPathsWithSegments(pathConfs))
+
+	segments, err = idx.FindSegments(pathConf, "path1", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath: filepath.Join(dir, "path1", "2018-05-19_22-15-25-000427.mp4"),
+			Start: time.Date(2018, 5, 19, 22, 15, 25, 427000, time.Local),
+			Size:  4,
+		},
+	}, segments)
+
+	segments, err = idx.FindSegments(pathConf, "path2", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath:    fpath,
+			Start:    start,
+			Duration: 3 * time.Second,
+			Size:     3,
+		},
+	}, segments)
+
+	segments, err = idx.FindSegments(pathConf, "path3", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*Segment{
+		{
+			Fpath: filepath.Join(dir, "path3", "2019-05-19_22-15-25-000427.mp4"),
+			Start: time.Date(2019, 5, 19, 22, 15, 25, 427000, time.Local),
+			Size:  1,
+		},
+	}, segments)
+
+	idx.Close()
+
+	// directories whose modification time has not changed are not read
+
+	fi, err := os.Stat(filepath.Join(dir, "path3"))
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "path3", "2020-05-19_22-15-25-000427.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	err = os.Chtimes(filepath.Join(dir, "path3"), fi.ModTime(), fi.ModTime())
+	require.NoError(t, err)
+
+	err = os.RemoveAll(filepath.Join(dir, "path2"))
+	require.NoError(t, err)
+
+	idx = &Index{
+		FilePath:  filepath.Join(dir, "index.jsonl"),
+		PathConfs: pathConfs,
+		Parent:    test.NilLogger,
+	}
+	err = idx.Initialize()
+	require.NoError(t, err)
+	defer idx.Close()
+
+	require.Equal(t, []string{"path1", "path3"}, idx.FindAllPathsWithSegments(pathConfs))
+
+	segments, err = idx.FindSegments(pathConf, "path3", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+}
+
+func TestIndexInMemory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = os.MkdirAll(filepath.Join(dir, "mypath", "audio"), 0o755)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "2015-05-19_22-15-25-000427.mp4"), []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(dir, "mypath", "audio", "2015-05-19_22-15-25-000427.mp4"), []byte{1, 2}, 0o644)
+	require.NoError(t, err)
+
+	pathConf := &conf.Path{
+		Name:         "mypath",
+		RecordPath:   filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat: conf.RecordFormatFMP4,
+		RecordTrackPolicies: conf.RecordTrackPolicies{{
+			Tracks: []string{"audio"},
+			Path:   filepath.Join(dir, "%path/audio/%Y-%m-%d_%H-%M-%S-%f"),
+		}},
+	}
+
+	idx := &Index{
+		PathConfs: map[string]*conf.Path{"mypath": pathConf},
+		Parent:    test.NilLogger,
+	}
+	err = idx.Initialize()
+	require.NoError(t, err)
+	defer idx.Close()
+
+	// segments of track policies are indexed too
+
+	for i, recordConf := range pathConf.RecordConfs() {
+		var segments []*Segment
+		segments, err = idx.FindSegments(recordConf, "mypath", nil, nil)
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+		require.Equal(t, uint64(i+1), segments[0].Size)
+	}
+}
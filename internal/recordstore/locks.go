@@ -0,0 +1,218 @@
+package recordstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+// ErrLockNotFound is returned when a lock is not found.
+var ErrLockNotFound = errors.New("lock not found")
+
+// Lock is a time range of a path whose segments must not be deleted.
+type Lock struct {
+	ID      uuid.UUID `json:"id"`
+	Path    string    `json:"path"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Reason  string    `json:"reason"`
+	Author  string    `json:"author"`
+	Created time.Time `json:"created"`
+}
+
+// Locks is a persistent list of locks.
+// Locks are stored in a file as a JSON array,
+// that is rewritten every time a lock is added or removed.
+//
+// All methods can be called on a nil Locks: in this case,
+// no lock is present.
+type Locks struct {
+	FilePath string
+	Parent   logger.Writer
+
+	mutex sync.RWMutex
+	locks []*Lock
+}
+
+// Initialize initializes Locks.
+func (l *Locks) Initialize() error {
+	err := l.load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if len(l.locks) != 0 {
+		l.Log(logger.Info, "%d locks loaded", len(l.locks))
+	}
+
+	return nil
+}
+
+// Close closes Locks.
+func (l *Locks) Close() {
+}
+
+// Log implements logger.Writer.
+func (l *Locks) Log(level logger.Level, format string, args ...interface{}) {
+	l.Parent.Log(level, "[record locks] "+format, args...)
+}
+
+func (l *Locks) load() error {
+	byts, err := os.ReadFile(l.FilePath)
+	if err != nil {
+		return err
+	}
+
+	var locks []*Lock
+	err = json.Unmarshal(byts, &locks)
+	if err != nil {
+		return fmt.Errorf("unable to load locks: %w", err)
+	}
+
+	l.locks = locks
+
+	return nil
+}
+
+func (l *Locks) save() error {
+	err := os.MkdirAll(filepath.Dir(l.FilePath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	locks := l.locks
+	if locks == nil {
+		locks = []*Lock{}
+	}
+
+	byts, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := l.FilePath + ".tmp"
+
+	err = os.WriteFile(tmpPath, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, l.FilePath)
+}
+
+// Add adds a lock. ID and creation time are filled automatically.
+func (l *Locks) Add(lock *Lock) error {
+	if l == nil {
+		return fmt.Errorf("locks are not available")
+	}
+
+	if lock.Path == "" {
+		return fmt.Errorf("path is empty")
+	}
+
+	if !lock.End.After(lock.Start) {
+		return fmt.Errorf("end must be after start")
+	}
+
+	lock.ID = uuid.New()
+	lock.Created = time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.locks = append(l.locks, lock)
+
+	err := l.save()
+	if err != nil {
+		l.locks = l.locks[:len(l.locks)-1]
+		return err
+	}
+
+	l.Log(logger.Info, "lock %v added to path '%s' (%v - %v)",
+		lock.ID, lock.Path, lock.Start.Format(time.RFC3339), lock.End.Format(time.RFC3339))
+
+	return nil
+}
+
+// Remove removes a lock.
+func (l *Locks) Remove(id uuid.UUID) error {
+	if l == nil {
+		return ErrLockNotFound
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i, lock := range l.locks {
+		if lock.ID == id {
+			prev := l.locks
+			l.locks = append(append([]*Lock(nil), prev[:i]...), prev[i+1:]...)
+
+			err := l.save()
+			if err != nil {
+				l.locks = prev
+				return err
+			}
+
+			l.Log(logger.Info, "lock %v removed from path '%s'", lock.ID, lock.Path)
+			return nil
+		}
+	}
+
+	return ErrLockNotFound
+}
+
+// List returns all locks, sorted by path and start.
+func (l *Locks) List() []*Lock {
+	if l == nil {
+		return []*Lock{}
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	out := make([]*Lock, len(l.locks))
+	for i, lock := range l.locks {
+		lock2 := *lock
+		out[i] = &lock2
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Start.Before(out[j].Start)
+	})
+
+	return out
+}
+
+// Overlaps checks whether a time range of a path overlaps with a lock.
+// A zero end means that the range is not closed.
+func (l *Locks) Overlaps(pathName string, start time.Time, end time.Time) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	for _, lock := range l.locks {
+		if lock.Path == pathName &&
+			(end.IsZero() || end.After(lock.Start)) &&
+			start.Before(lock.End) {
+			return true
+		}
+	}
+
+	return false
+}
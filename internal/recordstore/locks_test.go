@@ -0,0 +1,87 @@
+package recordstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocks(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fpath := filepath.Join(dir, "sub", "locks.json")
+
+	l := &Locks{
+		FilePath: fpath,
+		Parent:   test.NilLogger,
+	}
+	err = l.Initialize()
+	require.NoError(t, err)
+
+	err = l.Add(&Lock{
+		Path:  "mypath",
+		Start: time.Date(2010, 1, 1, 10, 0, 0, 0, time.UTC),
+		End:   time.Date(2010, 1, 1, 9, 0, 0, 0, time.UTC),
+	})
+	require.EqualError(t, err, "end must be after start")
+
+	lock := &Lock{
+		Path:   "mypath",
+		Start:  time.Date(2010, 1, 1, 10, 0, 0, 0, time.UTC),
+		End:    time.Date(2010, 1, 1, 11, 0, 0, 0, time.UTC),
+		Reason: "incident",
+		Author: "myuser",
+	}
+	err = l.Add(lock)
+	require.NoError(t, err)
+	require.NotEqual(t, uuid.UUID{}, lock.ID)
+
+	require.True(t, l.Overlaps("mypath",
+		time.Date(2010, 1, 1, 10, 59, 0, 0, time.UTC),
+		time.Date(2010, 1, 1, 12, 0, 0, 0, time.UTC)))
+	require.True(t, l.Overlaps("mypath",
+		time.Date(2010, 1, 1, 9, 0, 0, 0, time.UTC),
+		time.Time{}))
+	require.False(t, l.Overlaps("mypath",
+		time.Date(2010, 1, 1, 11, 0, 0, 0, time.UTC),
+		time.Date(2010, 1, 1, 12, 0, 0, 0, time.UTC)))
+	require.False(t, l.Overlaps("otherpath",
+		time.Date(2010, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2010, 1, 1, 11, 0, 0, 0, time.UTC)))
+
+	l.Close()
+
+	// reload from disk
+	l = &Locks{
+		FilePath: fpath,
+		Parent:   test.NilLogger,
+	}
+	err = l.Initialize()
+	require.NoError(t, err)
+
+	locks := l.List()
+	require.Len(t, locks, 1)
+	require.Equal(t, lock.ID, locks[0].ID)
+	require.Equal(t, "incident", locks[0].Reason)
+	require.Equal(t, "myuser", locks[0].Author)
+
+	err = l.Remove(uuid.New())
+	require.ErrorIs(t, err, ErrLockNotFound)
+
+	err = l.Remove(lock.ID)
+	require.NoError(t, err)
+	require.Empty(t, l.List())
+
+	l.Close()
+
+	var nilLocks *Locks
+	require.False(t, nilLocks.Overlaps("mypath", time.Time{}, time.Time{}))
+	require.Empty(t, nilLocks.List())
+}
@@ -0,0 +1,727 @@
+package recordstore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+)
+
+const (
+	manifestMaxLineSize = 64 * 1024
+
+	// interval between signatures of the head of manifests.
+	// Entries that are removed from the end of a manifest
+	// are detected, unless they have been written within this interval.
+	manifestCheckpointInterval = 10 * time.Second
+)
+
+// LoadManifestKey loads an Ed25519 private key from a PEM file in PKCS #8 format.
+func LoadManifestKey(fpath string) (ed25519.PrivateKey, error) {
+	byts, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(byts)
+	if block == nil {
+		return nil, fmt.Errorf("PEM block not found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("key is not an Ed25519 key")
+	}
+
+	return edKey, nil
+}
+
+// ManifestEntry is an entry of a segment manifest.
+// Every entry contains the hash of the previous one,
+// and it's signed with the manifest key.
+// Entries of deleted segments have Deleted set and no hash.
+type ManifestEntry struct {
+	Seq       uint64        `json:"seq"`
+	Path      string        `json:"path"`
+	File      string        `json:"file"`
+	Start     time.Time     `json:"start"`
+	Duration  time.Duration `json:"duration"`
+	Size      uint64        `json:"size"`
+	SHA256    string        `json:"sha256"`
+	Deleted   bool          `json:"deleted,omitempty"`
+	Prev      string        `json:"prev"`
+	Hash      string        `json:"hash"`
+	Signature string        `json:"signature"`
+}
+
+// computeHash computes the hash of the entry, excluding the hash itself and the signature.
+func (e *ManifestEntry) computeHash() []byte {
+	e2 := *e
+	e2.Hash = ""
+	e2.Signature = ""
+
+	byts, _ := json.Marshal(e2)
+	h := sha256.Sum256(byts)
+	return h[:]
+}
+
+func (e *ManifestEntry) sign(key ed25519.PrivateKey) {
+	h := e.computeHash()
+	e.Hash = hex.EncodeToString(h)
+	e.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, h))
+}
+
+func (e *ManifestEntry) verify(key ed25519.PublicKey) error {
+	h := e.computeHash()
+	if hex.EncodeToString(h) != e.Hash {
+		return fmt.Errorf("invalid hash")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil || !ed25519.Verify(key, h, sig) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+// fpath returns the absolute path of the segment of the entry.
+func (e *ManifestEntry) fpath(manifestPath string) string {
+	if filepath.IsAbs(e.File) {
+		return e.File
+	}
+	return filepath.Join(filepath.Dir(manifestPath), e.File)
+}
+
+func hashFile(fpath string) (string, uint64, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), uint64(n), nil
+}
+
+func readManifest(fpath string) ([]*ManifestEntry, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 4096), manifestMaxLineSize)
+
+	var entries []*ManifestEntry
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var e ManifestEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return entries, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+
+		entries = append(entries, &e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// ManifestHead is a signed checkpoint of the last entry of a manifest.
+// It's stored in a separate file, next to the manifest.
+type ManifestHead struct {
+	Manifest  string    `json:"manifest"`
+	Seq       uint64    `json:"seq"`
+	Hash      string    `json:"hash"`
+	Time      time.Time `json:"time"`
+	Signature string    `json:"signature"`
+}
+
+func (h *ManifestHead) computeHash() []byte {
+	h2 := *h
+	h2.Signature = ""
+
+	byts, _ := json.Marshal(h2)
+	sum := sha256.Sum256(byts)
+	return sum[:]
+}
+
+func (h *ManifestHead) verify(key ed25519.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(h.Signature)
+	if err != nil || !ed25519.Verify(key, h.computeHash(), sig) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func manifestHeadPath(manifestPath string) string {
+	return manifestPath + ".head"
+}
+
+func writeManifestHead(manifestPath string, last *ManifestEntry, key ed25519.PrivateKey) error {
+	if last == nil {
+		return nil
+	}
+
+	h := &ManifestHead{
+		Manifest: filepath.Base(manifestPath),
+		Seq:      last.Seq,
+		Hash:     last.Hash,
+		Time:     time.Now(),
+	}
+	h.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, h.computeHash()))
+
+	byts, _ := json.Marshal(h)
+
+	// replace the head atomically, in order not to lose it after a crash.
+	tmpPath := manifestHeadPath(manifestPath) + ".tmp"
+
+	err := os.WriteFile(tmpPath, byts, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, manifestHeadPath(manifestPath))
+}
+
+func readManifestHead(manifestPath string) (*ManifestHead, error) {
+	byts, err := os.ReadFile(manifestHeadPath(manifestPath))
+	if err != nil {
+		return nil, err
+	}
+
+	var h ManifestHead
+	err = json.Unmarshal(byts, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
+
+// verifyManifestHead checks that the manifest ends with the entry
+// signed by the head checkpoint, or with entries that follow it.
+func verifyManifestHead(manifestPath string, entries []*ManifestEntry, key ed25519.PublicKey) error {
+	h, err := readManifestHead(manifestPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("head checkpoint not found")
+		}
+		return fmt.Errorf("invalid head checkpoint: %w", err)
+	}
+
+	err = h.verify(key)
+	if err != nil {
+		return fmt.Errorf("head checkpoint: %w", err)
+	}
+
+	if h.Manifest != filepath.Base(manifestPath) {
+		return fmt.Errorf("head checkpoint belongs to another manifest")
+	}
+
+	for _, e := range entries {
+		if e.Seq == h.Seq {
+			if e.Hash != h.Hash {
+				return fmt.Errorf("entry %d does not match the head checkpoint", e.Seq)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("entries up to %d, that were present at %s, are missing",
+		h.Seq, h.Time.Format(time.RFC3339))
+}
+
+type manifestReq struct {
+	pathFormat string
+	keyPath    string
+	pathName   string
+	fpath      string
+	start      time.Time
+	duration   time.Duration
+	deleted    bool
+}
+
+// manifestFile is the state of a manifest that has been written recently.
+type manifestFile struct {
+	key          ed25519.PrivateKey
+	last         *ManifestEntry
+	checkpointed bool
+}
+
+// ManifestWriter appends completed and deleted segments to hash-chained, signed manifests.
+// A manifest is created for every distinct value of the manifest path,
+// that usually contains the path name and the day.
+// The writer is shared by recorders and by the record cleaner, in order to keep
+// a single chain for every manifest.
+//
+// Segments are queued without blocking and written by a dedicated routine,
+// that periodically signs a checkpoint of the last entry of every manifest
+// into a separate file, allowing to detect entries removed from the end of manifests.
+//
+// All methods can be called on a nil ManifestWriter: in this case,
+// nothing is written.
+type ManifestWriter struct {
+	Parent logger.Writer
+
+	mutex sync.Mutex
+	queue []manifestReq
+	files map[string]*manifestFile
+
+	chQueue   chan struct{}
+	terminate chan struct{}
+	done      chan struct{}
+}
+
+// Initialize initializes ManifestWriter.
+func (w *ManifestWriter) Initialize() {
+	w.files = make(map[string]*manifestFile)
+	w.chQueue = make(chan struct{}, 1)
+	w.terminate = make(chan struct{})
+	w.done = make(chan struct{})
+
+	go w.run()
+}
+
+// Close closes ManifestWriter, after writing pending segments.
+func (w *ManifestWriter) Close() {
+	if w == nil {
+		return
+	}
+
+	close(w.terminate)
+	<-w.done
+}
+
+// Log implements logger.Writer.
+func (w *ManifestWriter) Log(level logger.Level, format string, args ...interface{}) {
+	w.Parent.Log(level, "[manifest] "+format, args...)
+}
+
+// Add adds a completed segment to its manifest.
+func (w *ManifestWriter) Add(
+	pathFormat string,
+	keyPath string,
+	pathName string,
+	fpath string,
+	start time.Time,
+	duration time.Duration,
+) {
+	w.enqueue(manifestReq{
+		pathFormat: pathFormat,
+		keyPath:    keyPath,
+		pathName:   pathName,
+		fpath:      fpath,
+		start:      start,
+		duration:   duration,
+	})
+}
+
+// Remove records the deletion of a segment into its manifest,
+// in order to distinguish segments deleted by the server from missing ones.
+func (w *ManifestWriter) Remove(
+	pathFormat string,
+	keyPath string,
+	pathName string,
+	fpath string,
+	start time.Time,
+) {
+	w.enqueue(manifestReq{
+		pathFormat: pathFormat,
+		keyPath:    keyPath,
+		pathName:   pathName,
+		fpath:      fpath,
+		start:      start,
+		deleted:    true,
+	})
+}
+
+func (w *ManifestWriter) enqueue(req manifestReq) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	w.queue = append(w.queue, req)
+	w.mutex.Unlock()
+
+	select {
+	case w.chQueue <- struct{}{}:
+	default:
+	}
+}
+
+func (w *ManifestWriter) run() {
+	defer close(w.done)
+
+	checkpointTicker := time.NewTicker(manifestCheckpointInterval)
+	defer checkpointTicker.Stop()
+
+	for {
+		select {
+		case <-w.chQueue:
+			w.writeQueue()
+
+		case <-checkpointTicker.C:
+			w.checkpoint()
+
+		case <-w.terminate:
+			w.writeQueue()
+			w.checkpoint()
+			return
+		}
+	}
+}
+
+func (w *ManifestWriter) writeQueue() {
+	w.mutex.Lock()
+	queue := w.queue
+	w.queue = nil
+	w.mutex.Unlock()
+
+	for _, req := range queue {
+		err := w.write(req)
+		if err != nil {
+			w.Log(logger.Error, "unable to add %s to manifest: %v", req.fpath, err)
+		}
+	}
+}
+
+// checkpoint signs the head of manifests that have been changed since the last checkpoint.
+// Manifests that have not been changed are forgotten, and are read again
+// from disk when they are changed.
+func (w *ManifestWriter) checkpoint() {
+	for manifestPath, mf := range w.files {
+		if mf.checkpointed {
+			delete(w.files, manifestPath)
+			continue
+		}
+
+		err := writeManifestHead(manifestPath, mf.last, mf.key)
+		if err != nil {
+			w.Log(logger.Error, "unable to write head of %s: %v", manifestPath, err)
+			continue
+		}
+
+		mf.checkpointed = true
+	}
+}
+
+func (w *ManifestWriter) loadFile(manifestPath string, keyPath string) (*manifestFile, error) {
+	if mf, ok := w.files[manifestPath]; ok {
+		return mf, nil
+	}
+
+	key, err := LoadManifestKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load manifest key: %w", err)
+	}
+
+	entries, err := readManifest(manifestPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	mf := &manifestFile{
+		key:          key,
+		checkpointed: true,
+	}
+
+	if len(entries) != 0 {
+		mf.last = entries[len(entries)-1]
+	}
+
+	w.files[manifestPath] = mf
+
+	return mf, nil
+}
+
+func (w *ManifestWriter) write(req manifestReq) error {
+	manifestPath, err := filepath.Abs(Path{Start: req.start, Path: req.pathName}.Encode(req.pathFormat))
+	if err != nil {
+		return err
+	}
+
+	mf, err := w.loadFile(manifestPath, req.keyPath)
+	if err != nil {
+		return err
+	}
+
+	segmentPath, err := filepath.Abs(req.fpath)
+	if err != nil {
+		return err
+	}
+
+	file, err := filepath.Rel(filepath.Dir(manifestPath), segmentPath)
+	if err != nil {
+		file = segmentPath
+	}
+
+	e := &ManifestEntry{
+		Seq:      1,
+		Path:     req.pathName,
+		File:     file,
+		Start:    req.start,
+		Duration: req.duration,
+		Deleted:  req.deleted,
+	}
+
+	if !req.deleted {
+		e.SHA256, e.Size, err = hashFile(segmentPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mf.last != nil {
+		e.Seq = mf.last.Seq + 1
+		e.Prev = mf.last.Hash
+	}
+
+	e.sign(mf.key)
+
+	byts, _ := json.Marshal(e)
+	byts = append(byts, '\n')
+
+	err = os.MkdirAll(filepath.Dir(manifestPath), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(manifestPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(byts)
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	mf.last = e
+	mf.checkpointed = false
+
+	return nil
+}
+
+// ManifestSegmentStatus is the verification status of a segment.
+type ManifestSegmentStatus string
+
+// statuses.
+const (
+	ManifestSegmentOK       ManifestSegmentStatus = "ok"
+	ManifestSegmentMissing  ManifestSegmentStatus = "missing"
+	ManifestSegmentDeleted  ManifestSegmentStatus = "deleted"
+	ManifestSegmentAltered  ManifestSegmentStatus = "altered"
+	ManifestSegmentUnsigned ManifestSegmentStatus = "unsigned"
+)
+
+// ManifestSegmentReport is the verification result of a segment.
+type ManifestSegmentReport struct {
+	Fpath  string
+	Start  time.Time
+	Status ManifestSegmentStatus
+}
+
+// ManifestReport is the verification result of a time range.
+type ManifestReport struct {
+	Valid    bool
+	Segments []*ManifestSegmentReport
+	Errors   []string
+}
+
+// Merge adds the results of another report.
+func (r *ManifestReport) Merge(other *ManifestReport) {
+	r.Valid = r.Valid && other.Valid
+	r.Segments = append(r.Segments, other.Segments...)
+	r.Errors = append(r.Errors, other.Errors...)
+
+	sort.SliceStable(r.Segments, func(i, j int) bool {
+		return r.Segments[i].Start.Before(r.Segments[j].Start)
+	})
+}
+
+// VerifyManifests verifies segments of a path in the given time range
+// against their manifests. It reports segments that are missing,
+// altered or not present in manifests, and manifest entries
+// that are not correctly chained or signed.
+func VerifyManifests(
+	index *Index,
+	pathConf *conf.Path,
+	pathName string,
+	start time.Time,
+	end time.Time,
+	key ed25519.PublicKey,
+) *ManifestReport {
+	report := &ManifestReport{}
+
+	// segments start before their manifest day ends,
+	// therefore manifests of segments that began before start must be read too.
+	first := start.Add(-time.Duration(pathConf.RecordSegmentDuration)).Local()
+	first = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.Local)
+
+	var manifestPaths []string
+	found := make(map[string]struct{})
+
+	for day := first; day.Before(end); day = day.AddDate(0, 0, 1) {
+		manifestPath, err := filepath.Abs(Path{Start: day, Path: pathName}.Encode(pathConf.RecordManifestPath))
+		if err != nil {
+			continue
+		}
+
+		if _, ok := found[manifestPath]; !ok {
+			found[manifestPath] = struct{}{}
+			manifestPaths = append(manifestPaths, manifestPath)
+		}
+	}
+
+	signed := make(map[string]struct{})
+
+	for _, manifestPath := range manifestPaths {
+		entries, err := readManifest(manifestPath)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", manifestPath, err))
+		}
+
+		if len(entries) != 0 {
+			err = verifyManifestHead(manifestPath, entries, key)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", manifestPath, err))
+			}
+		}
+
+		// segments that have been deleted by the server
+		deleted := make(map[string]struct{})
+		for _, e := range entries {
+			if e.Deleted {
+				deleted[e.fpath(manifestPath)] = struct{}{}
+			}
+		}
+
+		var prev *ManifestEntry
+
+		for _, e := range entries {
+			switch {
+			case prev == nil && (e.Seq != 1 || e.Prev != ""):
+				report.Errors = append(report.Errors,
+					fmt.Sprintf("%s: entry %d: first entries are missing", manifestPath, e.Seq))
+
+			case prev != nil && (e.Seq != prev.Seq+1 || e.Prev != prev.Hash):
+				report.Errors = append(report.Errors,
+					fmt.Sprintf("%s: entry %d: chain is broken", manifestPath, e.Seq))
+			}
+
+			err = e.verify(key)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: entry %d: %v", manifestPath, e.Seq, err))
+			}
+
+			prev = e
+
+			fpath := e.fpath(manifestPath)
+			signed[fpath] = struct{}{}
+
+			if e.Deleted || !e.Start.Before(end) || !e.Start.Add(e.Duration).After(start) {
+				continue
+			}
+
+			seg := &ManifestSegmentReport{
+				Fpath:  fpath,
+				Start:  e.Start.Local(),
+				Status: ManifestSegmentOK,
+			}
+
+			hash, size, err := hashFile(fpath)
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				if _, ok := deleted[fpath]; ok {
+					seg.Status = ManifestSegmentDeleted
+				} else {
+					seg.Status = ManifestSegmentMissing
+				}
+
+			case err != nil || hash != e.SHA256 || size != e.Size:
+				seg.Status = ManifestSegmentAltered
+			}
+
+			report.Segments = append(report.Segments, seg)
+		}
+	}
+
+	segments, _ := index.FindSegments(pathConf, pathName, &start, &end)
+
+	for i, seg := range segments {
+		fpath, _ := filepath.Abs(seg.Fpath)
+		if _, ok := signed[fpath]; ok {
+			continue
+		}
+
+		// the last segment may still be in progress
+		if i == (len(segments)-1) &&
+			time.Since(seg.Start) < time.Duration(pathConf.RecordSegmentDuration) {
+			continue
+		}
+
+		report.Segments = append(report.Segments, &ManifestSegmentReport{
+			Fpath:  fpath,
+			Start:  seg.Start,
+			Status: ManifestSegmentUnsigned,
+		})
+	}
+
+	sort.SliceStable(report.Segments, func(i, j int) bool {
+		return report.Segments[i].Start.Before(report.Segments[j].Start)
+	})
+
+	report.Valid = len(report.Errors) == 0
+
+	for _, seg := range report.Segments {
+		if seg.Status != ManifestSegmentOK && seg.Status != ManifestSegmentDeleted {
+			report.Valid = false
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,197 @@
+package recordstore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifestKey(t *testing.T, fpath string) ed25519.PrivateKey {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(fpath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	require.NoError(t, err)
+
+	return key
+}
+
+func mustMarshalManifestEntries(t *testing.T, entries []*ManifestEntry) []byte {
+	var buf []byte
+	for _, e := range entries {
+		byts, err := json.Marshal(e)
+		require.NoError(t, err)
+		buf = append(buf, byts...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := os.MkdirTemp("", "mediamtx-recordstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := writeManifestKey(t, filepath.Join(dir, "manifest.key"))
+
+	loadedKey, err := LoadManifestKey(filepath.Join(dir, "manifest.key"))
+	require.NoError(t, err)
+	require.Equal(t, key, loadedKey)
+
+	pathConf := &conf.Path{
+		Name:                  "mypath",
+		RecordPath:            filepath.Join(dir, "%path/%Y-%m-%d_%H-%M-%S-%f"),
+		RecordFormat:          conf.RecordFormatFMP4,
+		RecordSegmentDuration: conf.Duration(1 * time.Hour),
+		RecordManifest:        true,
+		RecordManifestPath:    filepath.Join(dir, "%path/manifest_%Y-%m-%d.jsonl"),
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "mypath"), 0o755)
+	require.NoError(t, err)
+
+	starts := []time.Time{
+		time.Date(2010, 5, 1, 22, 0, 0, 0, time.Local),
+		time.Date(2010, 5, 1, 23, 0, 0, 0, time.Local),
+		time.Date(2010, 5, 2, 0, 0, 0, 0, time.Local),
+		time.Date(2010, 5, 2, 1, 0, 0, 0, time.Local),
+	}
+
+	var fpaths []string
+
+	keyPath := filepath.Join(dir, "manifest.key")
+
+	w := &ManifestWriter{
+		Parent: test.NilLogger,
+	}
+	w.Initialize()
+
+	for i, start := range starts {
+		fpath := Path{Start: start}.Encode(filepath.Join(dir, "mypath/%Y-%m-%d_%H-%M-%S-%f.mp4"))
+		err = os.WriteFile(fpath, []byte{byte(i), 1, 2, 3}, 0o644)
+		require.NoError(t, err)
+
+		fpaths = append(fpaths, fpath)
+		w.Add(pathConf.RecordManifestPath, keyPath, "mypath", fpath, start, time.Hour)
+	}
+
+	w.Close()
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "manifest_2010-05-01.jsonl"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "manifest_2010-05-02.jsonl"))
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(dir, "mypath", "manifest_2010-05-02.jsonl.head"))
+	require.NoError(t, err)
+
+	report := VerifyManifests(nil, pathConf, "mypath",
+		time.Date(2010, 5, 1, 22, 30, 0, 0, time.Local),
+		time.Date(2010, 5, 2, 1, 30, 0, 0, time.Local),
+		key.Public().(ed25519.PublicKey))
+	require.Equal(t, &ManifestReport{
+		Valid: true,
+		Segments: []*ManifestSegmentReport{
+			{Fpath: fpaths[0], Start: starts[0], Status: ManifestSegmentOK},
+			{Fpath: fpaths[1], Start: starts[1], Status: ManifestSegmentOK},
+			{Fpath: fpaths[2], Start: starts[2], Status: ManifestSegmentOK},
+			{Fpath: fpaths[3], Start: starts[3], Status: ManifestSegmentOK},
+		},
+	}, report)
+
+	// delete a segment through the writer, alter a segment,
+	// delete another one and add an unsigned one
+	err = os.Remove(fpaths[0])
+	require.NoError(t, err)
+
+	w = &ManifestWriter{
+		Parent: test.NilLogger,
+	}
+	w.Initialize()
+	w.Remove(pathConf.RecordManifestPath, keyPath, "mypath", fpaths[0], starts[0])
+	w.Close()
+
+	err = os.WriteFile(fpaths[1], []byte{5, 5, 5, 5}, 0o644)
+	require.NoError(t, err)
+
+	err = os.Remove(fpaths[2])
+	require.NoError(t, err)
+
+	unsignedStart := time.Date(2010, 5, 2, 0, 30, 0, 0, time.Local)
+	unsignedPath := Path{Start: unsignedStart}.Encode(filepath.Join(dir, "mypath/%Y-%m-%d_%H-%M-%S-%f.mp4"))
+	err = os.WriteFile(unsignedPath, []byte{1}, 0o644)
+	require.NoError(t, err)
+
+	report = VerifyManifests(nil, pathConf, "mypath",
+		time.Date(2010, 5, 1, 22, 30, 0, 0, time.Local),
+		time.Date(2010, 5, 2, 1, 30, 0, 0, time.Local),
+		key.Public().(ed25519.PublicKey))
+	require.Equal(t, &ManifestReport{
+		Valid: false,
+		Segments: []*ManifestSegmentReport{
+			{Fpath: fpaths[0], Start: starts[0], Status: ManifestSegmentDeleted},
+			{Fpath: fpaths[1], Start: starts[1], Status: ManifestSegmentAltered},
+			{Fpath: fpaths[2], Start: starts[2], Status: ManifestSegmentMissing},
+			{Fpath: unsignedPath, Start: unsignedStart, Status: ManifestSegmentUnsigned},
+			{Fpath: fpaths[3], Start: starts[3], Status: ManifestSegmentOK},
+		},
+	}, report)
+
+	// remove the last entry of a manifest
+	manifestPath := filepath.Join(dir, "mypath", "manifest_2010-05-02.jsonl")
+	entries, err := readManifest(manifestPath)
+	require.NoError(t, err)
+
+	err = os.WriteFile(manifestPath, mustMarshalManifestEntries(t, entries[:1]), 0o644)
+	require.NoError(t, err)
+
+	head, err := readManifestHead(manifestPath)
+	require.NoError(t, err)
+
+	report = VerifyManifests(nil, pathConf, "mypath",
+		time.Date(2010, 5, 2, 0, 30, 0, 0, time.Local),
+		time.Date(2010, 5, 2, 1, 30, 0, 0, time.Local),
+		key.Public().(ed25519.PublicKey))
+	require.Equal(t, false, report.Valid)
+	require.Equal(t, []string{
+		manifestPath + ": entries up to 2, that were present at " + head.Time.Format(time.RFC3339) + ", are missing",
+	}, report.Errors)
+
+	// remove the first entry of a manifest
+	manifestPath = filepath.Join(dir, "mypath", "manifest_2010-05-01.jsonl")
+	entries, err = readManifest(manifestPath)
+	require.NoError(t, err)
+
+	err = os.WriteFile(manifestPath, mustMarshalManifestEntries(t, entries[1:]), 0o644)
+	require.NoError(t, err)
+
+	// use another key
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	report = VerifyManifests(nil, pathConf, "mypath",
+		time.Date(2010, 5, 1, 22, 30, 0, 0, time.Local),
+		time.Date(2010, 5, 1, 23, 30, 0, 0, time.Local),
+		otherKey.Public().(ed25519.PublicKey))
+	require.Equal(t, false, report.Valid)
+	require.Equal(t, []string{
+		manifestPath + ": head checkpoint: invalid signature",
+		manifestPath + ": entry 2: first entries are missing",
+		manifestPath + ": entry 2: invalid signature",
+		manifestPath + ": entry 3: invalid signature",
+	}, report.Errors)
+}
@@ -20,6 +20,10 @@ var errFound = errors.New("found")
 type Segment struct {
 	Fpath string
 	Start time.Time
+
+	// filled only when segments are retrieved from an Index.
+	Duration time.Duration
+	Size     uint64
 }
 
 func fixedPathHasSegments(pathConf *conf.Path) bool {
@@ -163,6 +167,11 @@ func FindSegments(
 		return nil, err
 	}
 
+	return selectSegments(segments, start)
+}
+
+// selectSegments sorts segments and removes the ones that end before start.
+func selectSegments(segments []*Segment, start *time.Time) ([]*Segment, error) {
 	if segments == nil {
 		return nil, ErrNoSegmentsFound
 	}
@@ -0,0 +1,160 @@
+package dash
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	gopath "path"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+type httpServer struct {
+	address            string
+	encryption         bool
+	serverKey          string
+	serverCert         string
+	clientCA           string
+	clientCertRequired bool
+	allowOrigin        string
+	trustedProxies     conf.IPNetworks
+	readTimeout        conf.Duration
+	pathManager        serverPathManager
+	parent             *Server
+
+	inner *httpp.Server
+}
+
+func (s *httpServer) initialize() error {
+	router := gin.New()
+	router.SetTrustedProxies(s.trustedProxies.ToTrustedProxies()) //nolint:errcheck
+
+	router.Use(s.middlewareOrigin)
+
+	router.Use(s.onRequest)
+
+	network, address := restrictnetwork.Restrict("tcp", s.address)
+
+	s.inner = &httpp.Server{
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(s.readTimeout),
+		Encryption:         s.encryption,
+		ServerCert:         s.serverCert,
+		ServerKey:          s.serverKey,
+		ClientCA:           s.clientCA,
+		ClientCertRequired: s.clientCertRequired,
+		Handler:            router,
+		Parent:             s,
+	}
+	err := s.inner.Initialize()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *httpServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, format, args...)
+}
+
+func (s *httpServer) close() {
+	s.inner.Close()
+}
+
+func (s *httpServer) middlewareOrigin(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", s.allowOrigin)
+	ctx.Header("Access-Control-Allow-Credentials", "true")
+
+	// preflight requests
+	if ctx.Request.Method == http.MethodOptions &&
+		ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
+		ctx.Header("Access-Control-Allow-Methods", "OPTIONS, GET")
+		ctx.Header("Access-Control-Allow-Headers", "Authorization")
+		ctx.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+}
+
+func (s *httpServer) onRequest(ctx *gin.Context) {
+	if ctx.Request.Method != http.MethodGet {
+		return
+	}
+
+	// remove leading prefix
+	pa := ctx.Request.URL.Path[1:]
+
+	if !strings.HasSuffix(pa, ".mpd") && !strings.HasSuffix(pa, ".mp4") {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	dir, fname := gopath.Dir(pa), gopath.Base(pa)
+	if dir == "." || dir == "" {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req := defs.PathAccessRequest{
+		Name:        dir,
+		Query:       ctx.Request.URL.RawQuery,
+		Publish:     false,
+		Proto:       auth.ProtocolDASH,
+		Credentials: httpp.Credentials(ctx.Request),
+		IP:          net.ParseIP(ctx.ClientIP()),
+	}
+
+	_, err := s.pathManager.FindPathConf(defs.PathFindPathConfReq{
+		AccessRequest: req,
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			if terr.AskCredentials {
+				ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				ctx.Writer.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			s.Log(logger.Info, "connection %v failed to authenticate: %v", httpp.RemoteAddr(ctx), terr.Message)
+
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			ctx.Writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mux, err := s.parent.getMuxer(serverGetMuxerReq{
+		path:       dir,
+		remoteAddr: httpp.RemoteAddr(ctx),
+		query:      ctx.Request.URL.RawQuery,
+	})
+	if err != nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mi := mux.getInstance()
+	if mi == nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mi.handleRequest(ctx, fname)
+}
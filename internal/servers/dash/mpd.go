@@ -0,0 +1,98 @@
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
+
+type mpdSegmentTimelineEntry struct {
+	T *uint64 `xml:"t,attr,omitempty"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+type mpdSegmentTimeline struct {
+	S []*mpdSegmentTimelineEntry `xml:"S"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale                uint32              `xml:"timescale,attr"`
+	Duration                 uint64              `xml:"duration,attr,omitempty"`
+	StartNumber              uint64              `xml:"startNumber,attr"`
+	Initialization           string              `xml:"initialization,attr"`
+	Media                    string              `xml:"media,attr"`
+	AvailabilityTimeOffset   float64             `xml:"availabilityTimeOffset,attr,omitempty"`
+	AvailabilityTimeComplete *bool               `xml:"availabilityTimeComplete,attr"`
+	SegmentTimeline          *mpdSegmentTimeline `xml:"SegmentTimeline"`
+}
+
+type mpdRepresentation struct {
+	ID              string              `xml:"id,attr"`
+	MimeType        string              `xml:"mimeType,attr"`
+	Codecs          string              `xml:"codecs,attr"`
+	Bandwidth       uint64              `xml:"bandwidth,attr"`
+	SegmentTemplate *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdAdaptationSet struct {
+	ID               int                  `xml:"id,attr"`
+	ContentType      string               `xml:"contentType,attr"`
+	SegmentAlignment bool                 `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                  `xml:"startWithSAP,attr"`
+	Representations  []*mpdRepresentation `xml:"Representation"`
+}
+
+type mpdPeriod struct {
+	ID             string              `xml:"id,attr"`
+	Start          string              `xml:"start,attr"`
+	AdaptationSets []*mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdLatency struct {
+	Target int64 `xml:"target,attr"`
+}
+
+type mpdServiceDescription struct {
+	ID      int         `xml:"id,attr"`
+	Latency *mpdLatency `xml:"Latency"`
+}
+
+type mpdUTCTiming struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpd struct {
+	XMLName                    xml.Name               `xml:"MPD"`
+	XMLNS                      string                 `xml:"xmlns,attr"`
+	Profiles                   string                 `xml:"profiles,attr"`
+	Type                       string                 `xml:"type,attr"`
+	AvailabilityStartTime      string                 `xml:"availabilityStartTime,attr"`
+	PublishTime                string                 `xml:"publishTime,attr"`
+	MinimumUpdatePeriod        string                 `xml:"minimumUpdatePeriod,attr"`
+	MinBufferTime              string                 `xml:"minBufferTime,attr"`
+	TimeShiftBufferDepth       string                 `xml:"timeShiftBufferDepth,attr"`
+	SuggestedPresentationDelay string                 `xml:"suggestedPresentationDelay,attr,omitempty"`
+	MaxSegmentDuration         string                 `xml:"maxSegmentDuration,attr"`
+	ServiceDescription         *mpdServiceDescription `xml:"ServiceDescription"`
+	Periods                    []*mpdPeriod           `xml:"Period"`
+	UTCTiming                  *mpdUTCTiming          `xml:"UTCTiming"`
+}
+
+func (m *mpd) marshal() ([]byte, error) {
+	byts, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(byts, '\n')...), nil
+}
@@ -0,0 +1,696 @@
+package dash
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	mcfmp4 "github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mfmp4 "github.com/bluenviron/mediamtx/internal/protocols/fmp4"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	segmentMaxWait = 10 * time.Second
+)
+
+func marshalInit(initTrack *mcfmp4.InitTrack) ([]byte, error) {
+	init := &mcfmp4.Init{
+		Tracks: []*mcfmp4.InitTrack{initTrack},
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func parseSegmentName(fname string) (int, uint64, bool) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(fname, "seg_"), ".mp4"), "_")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(parts[0], 10, 31)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	number, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return int(id), number, true
+}
+
+type muxerInstanceTrack struct {
+	index    int
+	track    *mfmp4.Track
+	timeline *mfmp4.TimelineTrack
+	init     []byte
+	codecs   string
+}
+
+func (t *muxerInstanceTrack) isVideo() bool {
+	return t.track.InitTrack.Codec.IsVideo()
+}
+
+func (t *muxerInstanceTrack) mimeType() string {
+	if t.isVideo() {
+		return "video/mp4"
+	}
+	return "audio/mp4"
+}
+
+type muxerSegmentTrack struct {
+	startTime uint64
+	duration  uint64
+	content   []byte
+}
+
+type muxerSegment struct {
+	number   uint64
+	startDTS time.Duration
+	duration time.Duration
+	complete bool
+	tracks   []*muxerSegmentTrack
+}
+
+type muxerInstance struct {
+	segmentTimeline bool
+	lowLatency      bool
+	segmentCount    int
+	segmentDuration conf.Duration
+	partDuration    conf.Duration
+	stream          *stream.Stream
+	bytesSent       *uint64
+	parent          logger.Writer
+
+	ctx       context.Context
+	ctxCancel func()
+	tracks    []*muxerInstanceTrack
+	trackMap  map[*mfmp4.Track]*muxerInstanceTrack
+
+	mutex              sync.Mutex
+	changed            chan struct{}
+	hasVideo           bool
+	availabilityStart  time.Time
+	timeline           mfmp4.Timeline
+	segments           []*muxerSegment
+	curSegment         *muxerSegment
+	partTracks         []*mcfmp4.PartTrack
+	partStartDTS       time.Duration
+	nextSequenceNumber uint32
+}
+
+func (mi *muxerInstance) initialize() error {
+	mi.ctx, mi.ctxCancel = context.WithCancel(context.Background())
+	mi.trackMap = make(map[*mfmp4.Track]*muxerInstanceTrack)
+	mi.changed = make(chan struct{})
+
+	tracks := mfmp4.FromStream(
+		mi.stream,
+		mi,
+		mfmp4.IsFormatSupported,
+		mi.onCodecParams,
+		mi.onSample)
+
+	if len(tracks) == 0 {
+		mi.ctxCancel()
+		return mfmp4.ErrNoSupportedCodecs
+	}
+
+	formats := make([]format.Format, len(tracks))
+
+	for i, track := range tracks {
+		t := &muxerInstanceTrack{
+			index: i,
+			track: track,
+			timeline: &mfmp4.TimelineTrack{
+				Timeline:  &mi.timeline,
+				TimeScale: track.InitTrack.TimeScale,
+			},
+		}
+		mi.tracks = append(mi.tracks, t)
+		mi.trackMap[track] = t
+		formats[i] = track.Format
+	}
+
+	mi.partTracks = make([]*mcfmp4.PartTrack, len(mi.tracks))
+
+	err := mi.updateInits()
+	if err != nil {
+		mi.stream.RemoveReader(mi)
+		mi.ctxCancel()
+		return err
+	}
+
+	mi.Log(logger.Info, "is converting into DASH, %s",
+		defs.FormatsInfo(formats))
+
+	mi.stream.StartReader(mi)
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (mi *muxerInstance) Log(level logger.Level, format string, args ...interface{}) {
+	mi.parent.Log(level, format, args...)
+}
+
+func (mi *muxerInstance) close() {
+	mi.stream.RemoveReader(mi)
+	mi.ctxCancel()
+}
+
+func (mi *muxerInstance) errorChan() chan error {
+	return mi.stream.ReaderError(mi)
+}
+
+func (mi *muxerInstance) updateInits() error {
+	mi.mutex.Lock()
+	defer mi.mutex.Unlock()
+
+	for _, t := range mi.tracks {
+		init, err := marshalInit(t.track.InitTrack)
+		if err != nil {
+			return err
+		}
+
+		t.init = init
+		t.codecs = mfmp4.CodecString(t.track.InitTrack.Codec)
+	}
+
+	return nil
+}
+
+func (mi *muxerInstance) onCodecParams() {
+	mi.Log(logger.Debug, "codec parameters have changed")
+
+	err := mi.updateInits()
+	if err != nil {
+		mi.Log(logger.Warn, "unable to update initialization segments: %v", err)
+	}
+}
+
+func (mi *muxerInstance) onSample(track *mfmp4.Track, sample *mfmp4.Sample) error {
+	t := mi.trackMap[track]
+
+	mi.mutex.Lock()
+	defer mi.mutex.Unlock()
+
+	// wait the first video sample before setting hasVideo
+	if t.isVideo() {
+		mi.hasVideo = true
+	}
+
+	sample = t.timeline.Push(sample)
+	if sample == nil {
+		return nil
+	}
+
+	if mi.curSegment == nil {
+		mi.availabilityStart = time.Now()
+		mi.curSegment = &muxerSegment{
+			number: 1,
+			tracks: make([]*muxerSegmentTrack, len(mi.tracks)),
+		}
+	}
+
+	baseTime, ok := t.timeline.BaseTime(sample)
+	if !ok {
+		mi.Log(logger.Warn, "sample of track %d received too late, discarding", track.InitTrack.ID)
+		return nil
+	}
+
+	partTrack := mi.partTracks[t.index]
+	if partTrack == nil {
+		partTrack = &mcfmp4.PartTrack{
+			ID:       track.InitTrack.ID,
+			BaseTime: baseTime,
+		}
+		mi.partTracks[t.index] = partTrack
+	}
+
+	partTrack.Samples = append(partTrack.Samples, sample.Sample)
+
+	if !mi.hasVideo || t.isVideo() {
+		nextDTS := mfmp4.TimestampToDuration(t.timeline.Next().DTS, track.InitTrack.TimeScale) -
+			mi.timeline.OriginDTS()
+
+		switch {
+		case mi.segmentMustEnd(nextDTS, t.timeline.Next().IsNonSyncSample):
+			err := mi.flushPart(nextDTS)
+			if err != nil {
+				return err
+			}
+
+			mi.closeSegment(nextDTS)
+
+		case mi.lowLatency && (nextDTS-mi.partStartDTS) >= time.Duration(mi.partDuration):
+			err := mi.flushPart(nextDTS)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// segmentMustEnd checks whether the current segment must end before the next sample.
+// When segments are described by a SegmentTimeline, they are cut on key frames.
+// Otherwise, the manifest advertises a fixed duration, therefore segments are cut
+// at multiples of the segment duration, even if they don't start with a key frame.
+func (mi *muxerInstance) segmentMustEnd(nextDTS time.Duration, nextIsNonSync bool) bool {
+	if mi.segmentTimeline {
+		return !nextIsNonSync &&
+			(nextDTS-mi.curSegment.startDTS) >= time.Duration(mi.segmentDuration)
+	}
+
+	return nextDTS >= time.Duration(mi.curSegment.number)*time.Duration(mi.segmentDuration)
+}
+
+func (mi *muxerInstance) flushPart(nextDTS time.Duration) error {
+	for i, partTrack := range mi.partTracks {
+		if partTrack == nil {
+			continue
+		}
+
+		part := &mcfmp4.Part{
+			SequenceNumber: mi.nextSequenceNumber,
+			Tracks:         []*mcfmp4.PartTrack{partTrack},
+		}
+		mi.nextSequenceNumber++
+
+		var buf seekablebuffer.Buffer
+		err := part.Marshal(&buf)
+		if err != nil {
+			return err
+		}
+
+		segmentTrack := mi.curSegment.tracks[i]
+		if segmentTrack == nil {
+			segmentTrack = &muxerSegmentTrack{
+				startTime: partTrack.BaseTime,
+			}
+			mi.curSegment.tracks[i] = segmentTrack
+		}
+
+		segmentTrack.content = append(segmentTrack.content, buf.Bytes()...)
+
+		for _, sample := range partTrack.Samples {
+			segmentTrack.duration += uint64(sample.Duration)
+		}
+
+		mi.partTracks[i] = nil
+	}
+
+	mi.partStartDTS = nextDTS
+	mi.notify()
+
+	return nil
+}
+
+func (mi *muxerInstance) closeSegment(nextDTS time.Duration) {
+	mi.curSegment.complete = true
+	mi.curSegment.duration = nextDTS - mi.curSegment.startDTS
+
+	mi.segments = append(mi.segments, mi.curSegment)
+	if len(mi.segments) > mi.segmentCount {
+		mi.segments = mi.segments[1:]
+	}
+
+	mi.curSegment = &muxerSegment{
+		number:   mi.curSegment.number + 1,
+		startDTS: nextDTS,
+		tracks:   make([]*muxerSegmentTrack, len(mi.tracks)),
+	}
+
+	mi.notify()
+}
+
+func (mi *muxerInstance) notify() {
+	close(mi.changed)
+	mi.changed = make(chan struct{})
+}
+
+// wait waits until cond returns true, the request is closed or the timeout expires.
+// cond is called with the mutex locked.
+func (mi *muxerInstance) wait(ctx context.Context, timeout time.Duration, cond func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		mi.mutex.Lock()
+		ok := cond()
+		changed := mi.changed
+		mi.mutex.Unlock()
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-mi.ctx.Done():
+			return false
+		}
+	}
+}
+
+func (mi *muxerInstance) findTrack(id int) *muxerInstanceTrack {
+	for _, t := range mi.tracks {
+		if t.track.InitTrack.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func (mi *muxerInstance) findSegment(number uint64) *muxerSegment {
+	for _, seg := range mi.segments {
+		if seg.number == number {
+			return seg
+		}
+	}
+
+	if mi.lowLatency && mi.curSegment != nil && mi.curSegment.number == number {
+		return mi.curSegment
+	}
+
+	return nil
+}
+
+func (mi *muxerInstance) generateMPD(rawQuery string) ([]byte, error) {
+	query := ""
+	if rawQuery != "" {
+		query = "?" + rawQuery
+	}
+
+	segmentDuration := time.Duration(mi.segmentDuration)
+	now := time.Now()
+
+	maxSegmentDuration := segmentDuration
+	for _, seg := range mi.segments {
+		if seg.duration > maxSegmentDuration {
+			maxSegmentDuration = seg.duration
+		}
+	}
+
+	m := &mpd{
+		XMLNS:                 "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:              "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                  "dynamic",
+		AvailabilityStartTime: formatTime(mi.availabilityStart),
+		PublishTime:           formatTime(now),
+		MinimumUpdatePeriod:   formatDuration(segmentDuration),
+		MinBufferTime:         formatDuration(2 * segmentDuration),
+		TimeShiftBufferDepth:  formatDuration(time.Duration(mi.segmentCount) * segmentDuration),
+		MaxSegmentDuration:    formatDuration(maxSegmentDuration),
+		UTCTiming: &mpdUTCTiming{
+			SchemeIDURI: "urn:mpeg:dash:utc:direct:2014",
+			Value:       formatTime(now),
+		},
+	}
+
+	if mi.lowLatency {
+		m.ServiceDescription = &mpdServiceDescription{
+			ID: 0,
+			Latency: &mpdLatency{
+				Target: (2 * segmentDuration).Milliseconds(),
+			},
+		}
+	} else {
+		m.SuggestedPresentationDelay = formatDuration(3 * segmentDuration)
+	}
+
+	period := &mpdPeriod{
+		ID:    "0",
+		Start: "PT0S",
+	}
+	m.Periods = []*mpdPeriod{period}
+
+	// segments start with a key frame only when they are described by a SegmentTimeline.
+	startWithSAP := 0
+	if mi.segmentTimeline {
+		startWithSAP = 1
+	}
+
+	for _, t := range mi.tracks {
+		timeScale := t.track.InitTrack.TimeScale
+
+		tmpl := &mpdSegmentTemplate{
+			Timescale:      timeScale,
+			Initialization: "init_" + strconv.FormatInt(int64(t.track.InitTrack.ID), 10) + ".mp4" + query,
+			Media:          "seg_" + strconv.FormatInt(int64(t.track.InitTrack.ID), 10) + "_$Number$.mp4" + query,
+		}
+
+		if mi.segmentTimeline {
+			tmpl.StartNumber = mi.segments[0].number
+			tmpl.SegmentTimeline = mi.generateTimeline(t)
+		} else {
+			tmpl.StartNumber = 1
+			tmpl.Duration = uint64(mfmp4.DurationToTimestamp(segmentDuration, timeScale))
+		}
+
+		if mi.lowLatency {
+			tmpl.AvailabilityTimeOffset = (segmentDuration - time.Duration(mi.partDuration)).Seconds()
+			v := false
+			tmpl.AvailabilityTimeComplete = &v
+		}
+
+		contentType := "audio"
+		if t.isVideo() {
+			contentType = "video"
+		}
+
+		period.AdaptationSets = append(period.AdaptationSets, &mpdAdaptationSet{
+			ID:               t.track.InitTrack.ID,
+			ContentType:      contentType,
+			SegmentAlignment: true,
+			StartWithSAP:     startWithSAP,
+			Representations: []*mpdRepresentation{{
+				ID:              strconv.FormatInt(int64(t.track.InitTrack.ID), 10),
+				MimeType:        t.mimeType(),
+				Codecs:          t.codecs,
+				Bandwidth:       mi.bandwidth(t),
+				SegmentTemplate: tmpl,
+			}},
+		})
+	}
+
+	return m.marshal()
+}
+
+func (mi *muxerInstance) generateTimeline(t *muxerInstanceTrack) *mpdSegmentTimeline {
+	timeScale := t.track.InitTrack.TimeScale
+	timeline := &mpdSegmentTimeline{}
+	var prevEnd uint64
+
+	for i, seg := range mi.segments {
+		var start, duration uint64
+
+		if st := seg.tracks[t.index]; st != nil {
+			start, duration = st.startTime, st.duration
+		} else {
+			start = uint64(mfmp4.DurationToTimestamp(seg.startDTS, timeScale))
+			duration = uint64(mfmp4.DurationToTimestamp(seg.duration, timeScale))
+		}
+
+		if i != 0 && start == prevEnd {
+			last := timeline.S[len(timeline.S)-1]
+			if last.D == duration {
+				last.R++
+			} else {
+				timeline.S = append(timeline.S, &mpdSegmentTimelineEntry{D: duration})
+			}
+		} else {
+			timeline.S = append(timeline.S, &mpdSegmentTimelineEntry{T: &start, D: duration})
+		}
+
+		prevEnd = start + duration
+	}
+
+	return timeline
+}
+
+func (mi *muxerInstance) bandwidth(t *muxerInstanceTrack) uint64 {
+	var size uint64
+	var duration uint64
+
+	for _, seg := range mi.segments {
+		if st := seg.tracks[t.index]; st != nil {
+			size += uint64(len(st.content))
+			duration += st.duration
+		}
+	}
+
+	if duration == 0 {
+		return 1
+	}
+
+	return max(size*8*uint64(t.track.InitTrack.TimeScale)/duration, 1)
+}
+
+func (mi *muxerInstance) handleRequest(ctx *gin.Context, fname string) {
+	w := &responseWriterWithCounter{
+		ResponseWriter: ctx.Writer,
+		bytesSent:      mi.bytesSent,
+	}
+
+	switch {
+	case fname == "index.mpd":
+		mi.onMPD(ctx, w)
+
+	case strings.HasPrefix(fname, "init_") && strings.HasSuffix(fname, ".mp4"):
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(fname, "init_"), ".mp4"), 10, 31)
+		if err != nil {
+			ctx.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mi.onInit(ctx, w, int(id))
+
+	case strings.HasPrefix(fname, "seg_") && strings.HasSuffix(fname, ".mp4"):
+		id, number, ok := parseSegmentName(fname)
+		if !ok {
+			ctx.Writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		mi.onSegment(ctx, w, id, number)
+
+	default:
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (mi *muxerInstance) onMPD(ctx *gin.Context, w http.ResponseWriter) {
+	// wait until the first segment is available
+	ok := mi.wait(ctx.Request.Context(), segmentMaxWait, func() bool {
+		return len(mi.segments) != 0
+	})
+	if !ok {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mi.mutex.Lock()
+	byts, err := mi.generateMPD(ctx.Request.URL.RawQuery)
+	mi.mutex.Unlock()
+
+	if err != nil {
+		mi.Log(logger.Error, err.Error())
+		ctx.Writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Content-Type", "application/dash+xml")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	w.Write(byts) //nolint:errcheck
+}
+
+func (mi *muxerInstance) onInit(ctx *gin.Context, w http.ResponseWriter, id int) {
+	t := mi.findTrack(id)
+	if t == nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	mi.mutex.Lock()
+	init := t.init
+	mi.mutex.Unlock()
+
+	ctx.Header("Content-Type", t.mimeType())
+	ctx.Writer.WriteHeader(http.StatusOK)
+	w.Write(init) //nolint:errcheck
+}
+
+func (mi *muxerInstance) onSegment(ctx *gin.Context, w http.ResponseWriter, id int, number uint64) {
+	t := mi.findTrack(id)
+	if t == nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var seg *muxerSegment
+
+	// the segment that is being generated is waited for,
+	// since clients can compute its availability in advance.
+	// Segments after it are not available yet.
+	mi.wait(ctx.Request.Context(), segmentMaxWait, func() bool {
+		seg = mi.findSegment(number)
+		return seg != nil || mi.curSegment == nil || number != mi.curSegment.number
+	})
+
+	if seg == nil {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	headerWritten := false
+	written := 0
+
+	for {
+		var content []byte
+
+		mi.mutex.Lock()
+		if st := seg.tracks[t.index]; st != nil {
+			content = st.content[written:]
+		}
+		complete := seg.complete
+		changed := mi.changed
+		mi.mutex.Unlock()
+
+		if !headerWritten {
+			if complete && len(content) == 0 {
+				ctx.Writer.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			ctx.Header("Content-Type", t.mimeType())
+			ctx.Writer.WriteHeader(http.StatusOK)
+			headerWritten = true
+		}
+
+		if len(content) != 0 {
+			_, err := w.Write(content)
+			if err != nil {
+				return
+			}
+			ctx.Writer.Flush()
+			written += len(content)
+		}
+
+		if complete {
+			return
+		}
+
+		// segment is still being generated: send chunks as soon as they are available
+		select {
+		case <-changed:
+		case <-ctx.Request.Context().Done():
+			return
+		case <-mi.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// Package dash contains a MPEG-DASH server.
+package dash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+// ErrMuxerNotFound is returned when a muxer is not found.
+var ErrMuxerNotFound = errors.New("muxer not found")
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+type serverGetMuxerRes struct {
+	muxer *muxer
+	err   error
+}
+
+type serverGetMuxerReq struct {
+	path       string
+	remoteAddr string
+	query      string
+	res        chan serverGetMuxerRes
+}
+
+type serverAPIMuxersListRes struct {
+	data *defs.APIDASHMuxerList
+	err  error
+}
+
+type serverAPIMuxersListReq struct {
+	res chan serverAPIMuxersListRes
+}
+
+type serverAPIMuxersGetRes struct {
+	data *defs.APIDASHMuxer
+	err  error
+}
+
+type serverAPIMuxersGetReq struct {
+	name string
+	res  chan serverAPIMuxersGetRes
+}
+
+type serverMetrics interface {
+	SetDASHServer(defs.APIDASHServer)
+}
+
+type serverPathManager interface {
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a MPEG-DASH server.
+type Server struct {
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	SegmentTimeline    bool
+	LowLatency         bool
+	SegmentCount       int
+	SegmentDuration    conf.Duration
+	PartDuration       conf.Duration
+	ReadTimeout        conf.Duration
+	MuxerCloseAfter    conf.Duration
+	Metrics            serverMetrics
+	PathManager        serverPathManager
+	Parent             serverParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	wg         sync.WaitGroup
+	httpServer *httpServer
+	muxers     map[string]*muxer
+
+	// in
+	chGetMuxer     chan serverGetMuxerReq
+	chCloseMuxer   chan *muxer
+	chAPIMuxerList chan serverAPIMuxersListReq
+	chAPIMuxerGet  chan serverAPIMuxersGetReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	ctx, ctxCancel := context.WithCancel(context.Background())
+
+	s.ctx = ctx
+	s.ctxCancel = ctxCancel
+	s.muxers = make(map[string]*muxer)
+	s.chGetMuxer = make(chan serverGetMuxerReq)
+	s.chCloseMuxer = make(chan *muxer)
+	s.chAPIMuxerList = make(chan serverAPIMuxersListReq)
+	s.chAPIMuxerGet = make(chan serverAPIMuxersGetReq)
+
+	s.httpServer = &httpServer{
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		readTimeout:        s.ReadTimeout,
+		pathManager:        s.PathManager,
+		parent:             s,
+	}
+	err := s.httpServer.initialize()
+	if err != nil {
+		ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on "+s.Address)
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetDASHServer(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[DASH] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetDASHServer(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		select {
+		case req := <-s.chGetMuxer:
+			mux, ok := s.muxers[req.path]
+			if !ok {
+				mux = s.createMuxer(req.path, req.remoteAddr, req.query)
+			}
+			req.res <- serverGetMuxerRes{muxer: mux}
+
+		case c := <-s.chCloseMuxer:
+			if c2, ok := s.muxers[c.PathName()]; ok && c2 == c {
+				delete(s.muxers, c.PathName())
+			}
+
+		case req := <-s.chAPIMuxerList:
+			data := &defs.APIDASHMuxerList{
+				Items: []*defs.APIDASHMuxer{},
+			}
+
+			for _, muxer := range s.muxers {
+				data.Items = append(data.Items, muxer.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPIMuxersListRes{
+				data: data,
+			}
+
+		case req := <-s.chAPIMuxerGet:
+			muxer, ok := s.muxers[req.name]
+			if !ok {
+				req.res <- serverAPIMuxersGetRes{err: ErrMuxerNotFound}
+				continue
+			}
+
+			req.res <- serverAPIMuxersGetRes{data: muxer.apiItem()}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	s.httpServer.close()
+}
+
+func (s *Server) createMuxer(pathName string, remoteAddr string, query string) *muxer {
+	r := &muxer{
+		parentCtx:       s.ctx,
+		remoteAddr:      remoteAddr,
+		segmentTimeline: s.SegmentTimeline,
+		lowLatency:      s.LowLatency,
+		segmentCount:    s.SegmentCount,
+		segmentDuration: s.SegmentDuration,
+		partDuration:    s.PartDuration,
+		wg:              &s.wg,
+		pathName:        pathName,
+		pathManager:     s.PathManager,
+		parent:          s,
+		query:           query,
+		closeAfter:      s.MuxerCloseAfter,
+	}
+	r.initialize()
+	s.muxers[pathName] = r
+	return r
+}
+
+// closeMuxer is called by muxer.
+func (s *Server) closeMuxer(c *muxer) {
+	select {
+	case s.chCloseMuxer <- c:
+	case <-s.ctx.Done():
+	}
+}
+
+func (s *Server) getMuxer(req serverGetMuxerReq) (*muxer, error) {
+	req.res = make(chan serverGetMuxerRes)
+
+	select {
+	case s.chGetMuxer <- req:
+		res := <-req.res
+		return res.muxer, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIMuxersList is called by api.
+func (s *Server) APIMuxersList() (*defs.APIDASHMuxerList, error) {
+	req := serverAPIMuxersListReq{
+		res: make(chan serverAPIMuxersListRes),
+	}
+
+	select {
+	case s.chAPIMuxerList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIMuxersGet is called by api.
+func (s *Server) APIMuxersGet(name string) (*defs.APIDASHMuxer, error) {
+	req := serverAPIMuxersGetReq{
+		name: name,
+		res:  make(chan serverAPIMuxersGetRes),
+	}
+
+	select {
+	case s.chAPIMuxerGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
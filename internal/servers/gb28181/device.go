@@ -0,0 +1,86 @@
+package gb28181
+
+import (
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/mediamtx/internal/defs"
+)
+
+// isVideoChannel checks whether a catalog item is a video channel,
+// by looking at the type code (digits 11-13) of its ID, as defined in GB/T 28181 Appendix D.
+func isVideoChannel(id string) bool {
+	if len(id) != 20 {
+		return true
+	}
+
+	switch id[10:13] {
+	case "131", "132":
+		return true
+	}
+	return false
+}
+
+type deviceChannel struct {
+	id      string
+	name    string
+	status  string
+	session *session
+	retryAt time.Time
+}
+
+// device is a registered device. It is owned by Server.run().
+type device struct {
+	id               string
+	created          time.Time
+	addr             *net.UDPAddr
+	localIP          string
+	expires          time.Time
+	lastKeepalive    time.Time
+	catalogRequested time.Time
+	channels         map[string]*deviceChannel
+}
+
+func (d *device) pathName(channelID string) string {
+	return d.id + "/" + channelID
+}
+
+func (d *device) apiItem() *defs.APIGB28181Device {
+	item := &defs.APIGB28181Device{
+		ID:         d.id,
+		Created:    d.created,
+		RemoteAddr: d.addr.String(),
+		Expires:    d.expires,
+		Channels:   []*defs.APIGB28181Channel{},
+	}
+
+	if !d.lastKeepalive.IsZero() {
+		v := d.lastKeepalive
+		item.LastKeepalive = &v
+	}
+
+	for _, ch := range d.channels {
+		c := &defs.APIGB28181Channel{
+			ID:     ch.id,
+			Name:   ch.name,
+			Status: ch.status,
+			State:  defs.APIGB28181ChannelStateIdle,
+			Path:   d.pathName(ch.id),
+		}
+
+		if ch.session != nil {
+			c.State = ch.session.apiState()
+			c.BytesReceived = atomic.LoadUint64(ch.session.bytesReceived)
+		}
+
+		item.Channels = append(item.Channels, c)
+	}
+
+	sort.Slice(item.Channels, func(i, j int) bool {
+		return item.Channels[i].ID < item.Channels[j].ID
+	})
+
+	return item
+}
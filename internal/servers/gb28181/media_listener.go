@@ -0,0 +1,159 @@
+package gb28181
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+const (
+	// some devices send RTP packets bigger than the MTU, that are fragmented at the IP level.
+	udpReadBufferSize = 65535
+)
+
+// mediaListener receives RTP packets from all devices on a single port,
+// over UDP and TCP (RFC 4571 framing), and routes them to sessions by SSRC.
+type mediaListener struct {
+	address     string
+	readTimeout conf.Duration
+	wg          *sync.WaitGroup
+	parent      *Server
+
+	pc net.PacketConn
+	ln net.Listener
+
+	mutex sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (l *mediaListener) initialize() error {
+	var err error
+	l.pc, err = net.ListenPacket(restrictnetwork.Restrict("udp", l.address))
+	if err != nil {
+		return err
+	}
+
+	l.ln, err = net.Listen(restrictnetwork.Restrict("tcp", l.address))
+	if err != nil {
+		l.pc.Close()
+		return err
+	}
+
+	l.conns = make(map[net.Conn]struct{})
+
+	l.wg.Add(2)
+	go l.runUDP()
+	go l.runTCP()
+
+	return nil
+}
+
+func (l *mediaListener) close() {
+	l.pc.Close()
+	l.ln.Close()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for nconn := range l.conns {
+		nconn.Close()
+	}
+}
+
+func (l *mediaListener) runUDP() {
+	defer l.wg.Done()
+
+	err := l.runUDPInner()
+
+	l.parent.acceptError(err)
+}
+
+func (l *mediaListener) runUDPInner() error {
+	buf := make([]byte, udpReadBufferSize)
+
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		var pkt rtp.Packet
+		err = pkt.Unmarshal(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			continue
+		}
+
+		l.parent.routePacket(&pkt, addr.(*net.UDPAddr).IP)
+	}
+}
+
+func (l *mediaListener) runTCP() {
+	defer l.wg.Done()
+
+	err := l.runTCPInner()
+
+	l.parent.acceptError(err)
+}
+
+func (l *mediaListener) runTCPInner() error {
+	for {
+		nconn, err := l.ln.Accept()
+		if err != nil {
+			return err
+		}
+
+		l.mutex.Lock()
+		l.conns[nconn] = struct{}{}
+		l.mutex.Unlock()
+
+		l.wg.Add(1)
+		go l.runTCPConn(nconn)
+	}
+}
+
+func (l *mediaListener) runTCPConn(nconn net.Conn) {
+	defer l.wg.Done()
+
+	defer func() {
+		l.mutex.Lock()
+		delete(l.conns, nconn)
+		l.mutex.Unlock()
+
+		nconn.Close()
+	}()
+
+	br := bufio.NewReader(nconn)
+	ip := nconn.RemoteAddr().(*net.TCPAddr).IP
+	header := make([]byte, 2)
+
+	for {
+		nconn.SetReadDeadline(time.Now().Add(time.Duration(l.readTimeout)))
+
+		_, err := io.ReadFull(br, header)
+		if err != nil {
+			return
+		}
+
+		buf := make([]byte, binary.BigEndian.Uint16(header))
+		_, err = io.ReadFull(br, buf)
+		if err != nil {
+			return
+		}
+
+		var pkt rtp.Packet
+		err = pkt.Unmarshal(buf)
+		if err != nil {
+			return
+		}
+
+		l.parent.routePacket(&pkt, ip)
+	}
+}
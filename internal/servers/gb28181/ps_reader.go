@@ -0,0 +1,369 @@
+package gb28181
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	mcmpegts "github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/protocols/ps"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	// maximum size of a frame, before being demuxed.
+	psMaxFrameSize = 10 * 1024 * 1024
+
+	// maximum number of frames that are buffered while waiting for
+	// the program stream map and codec parameters.
+	psMaxProbeFrames = 128
+)
+
+var errNoSupportedCodecs = errors.New(
+	"the stream doesn't contain any supported codec, which are currently " +
+		"H265, H264, G711, MPEG-4 Audio")
+
+func multiplyAndDivide(v, m, d int64) int64 {
+	secs := v / d
+	dec := v % d
+	return (secs*m + dec*m/d)
+}
+
+type psTrack struct {
+	media *description.Media
+	write func(pts int64, data []byte) error
+}
+
+// psReader reassembles a Program Stream from RTP packets
+// and writes the contained elementary streams to a stream.Stream.
+type psReader struct {
+	onStart       func(medias []*description.Media) (*stream.Stream, error)
+	onDecodeError func(err error)
+
+	demuxer     ps.Demuxer
+	timeDecoder mcmpegts.TimeDecoder
+	seqSet      bool
+	nextSeq     uint16
+	frameSet    bool
+	frameTS     uint32
+	frame       []byte
+	corrupt     bool
+	probeFrames [][]*ps.Packet
+	strm        *stream.Stream
+	tracks      map[uint8]*psTrack
+}
+
+func (r *psReader) initialize() {
+	r.demuxer.Initialize()
+	r.timeDecoder.Initialize()
+}
+
+func (r *psReader) push(pkt *rtp.Packet) error {
+	lost := r.seqSet && pkt.SequenceNumber != r.nextSeq
+	r.seqSet = true
+	r.nextSeq = pkt.SequenceNumber + 1
+
+	// each frame is sent with a distinct RTP timestamp.
+	if r.frameSet && pkt.Timestamp != r.frameTS {
+		// lost packets may belong to both frames
+		r.corrupt = r.corrupt || lost
+
+		err := r.flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	r.corrupt = r.corrupt || lost
+	r.frameSet = true
+	r.frameTS = pkt.Timestamp
+
+	if len(r.frame)+len(pkt.Payload) > psMaxFrameSize {
+		r.frame = nil
+		r.corrupt = true
+	} else {
+		r.frame = append(r.frame, pkt.Payload...)
+	}
+
+	if pkt.Marker {
+		return r.flush()
+	}
+
+	return nil
+}
+
+func (r *psReader) flush() error {
+	frame := r.frame
+	corrupt := r.corrupt
+	r.frame = nil
+	r.frameSet = false
+	r.corrupt = false
+
+	if corrupt {
+		r.onDecodeError(fmt.Errorf("RTP packets are missing"))
+		return nil
+	}
+
+	pkts, err := r.demuxer.Decode(frame)
+	if err != nil {
+		r.onDecodeError(err)
+	}
+
+	if r.strm == nil {
+		return r.probe(pkts)
+	}
+
+	r.writePackets(pkts)
+	return nil
+}
+
+func (r *psReader) probe(pkts []*ps.Packet) error {
+	r.probeFrames = append(r.probeFrames, pkts)
+
+	streamTypes := r.demuxer.StreamTypes()
+
+	if len(streamTypes) == 0 {
+		if len(r.probeFrames) >= psMaxProbeFrames {
+			return fmt.Errorf("program stream map not received")
+		}
+		return nil
+	}
+
+	// MPEG-4 Audio configuration is contained in the ADTS header of the first packet.
+	aacConfigs := make(map[uint8]*mpeg4audio.AudioSpecificConfig)
+
+	for _, frame := range r.probeFrames {
+		for _, pkt := range frame {
+			if pkt.StreamType == ps.StreamTypeMPEG4Audio && aacConfigs[pkt.StreamID] == nil {
+				var adts mpeg4audio.ADTSPackets
+				err := adts.Unmarshal(pkt.Data)
+				if err == nil {
+					aacConfigs[pkt.StreamID] = &mpeg4audio.AudioSpecificConfig{
+						Type:         adts[0].Type,
+						SampleRate:   adts[0].SampleRate,
+						ChannelCount: adts[0].ChannelCount,
+					}
+				}
+			}
+		}
+	}
+
+	if len(r.probeFrames) < psMaxProbeFrames {
+		for id, typ := range streamTypes {
+			if typ == ps.StreamTypeMPEG4Audio && aacConfigs[id] == nil {
+				return nil
+			}
+		}
+	}
+
+	r.tracks = make(map[uint8]*psTrack)
+	var medias []*description.Media //nolint:prealloc
+
+	ids := make([]uint8, 0, len(streamTypes))
+	for id := range streamTypes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		track := r.newTrack(streamTypes[id], aacConfigs[id])
+		if track == nil {
+			continue
+		}
+
+		r.tracks[id] = track
+		medias = append(medias, track.media)
+	}
+
+	if len(medias) == 0 {
+		return errNoSupportedCodecs
+	}
+
+	sortMedias(medias)
+
+	var err error
+	r.strm, err = r.onStart(medias)
+	if err != nil {
+		return err
+	}
+
+	frames := r.probeFrames
+	r.probeFrames = nil
+
+	for _, frame := range frames {
+		r.writePackets(frame)
+	}
+
+	return nil
+}
+
+// sortMedias puts video medias first.
+func sortMedias(medias []*description.Media) {
+	sort.SliceStable(medias, func(i, j int) bool {
+		return medias[i].Type == description.MediaTypeVideo && medias[j].Type != description.MediaTypeVideo
+	})
+}
+
+func (r *psReader) newTrack(typ ps.StreamType, aacConfig *mpeg4audio.AudioSpecificConfig) *psTrack {
+	switch typ {
+	case ps.StreamTypeH264:
+		medi := &description.Media{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H264{
+				PayloadTyp:        96,
+				PacketizationMode: 1,
+			}},
+		}
+
+		return &psTrack{
+			media: medi,
+			write: func(pts int64, data []byte) error {
+				var au h264.AnnexB
+				err := au.Unmarshal(data)
+				if err != nil {
+					return err
+				}
+
+				r.strm.WriteUnit(medi, medi.Formats[0], &unit.H264{
+					Base: unit.Base{
+						NTP: time.Now(),
+						PTS: pts, // no conversion is needed since clock rate is 90khz in both PS and RTSP
+					},
+					AU: au,
+				})
+				return nil
+			},
+		}
+
+	case ps.StreamTypeH265:
+		medi := &description.Media{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{&format.H265{
+				PayloadTyp: 96,
+			}},
+		}
+
+		return &psTrack{
+			media: medi,
+			write: func(pts int64, data []byte) error {
+				// H265 uses the same Annex-B format of H264
+				var au h264.AnnexB
+				err := au.Unmarshal(data)
+				if err != nil {
+					return err
+				}
+
+				r.strm.WriteUnit(medi, medi.Formats[0], &unit.H265{
+					Base: unit.Base{
+						NTP: time.Now(),
+						PTS: pts,
+					},
+					AU: au,
+				})
+				return nil
+			},
+		}
+
+	case ps.StreamTypeG711A, ps.StreamTypeG711U:
+		muLaw := (typ == ps.StreamTypeG711U)
+
+		medi := &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.G711{
+				PayloadTyp: func() uint8 {
+					if muLaw {
+						return 0
+					}
+					return 8
+				}(),
+				MULaw:        muLaw,
+				SampleRate:   8000,
+				ChannelCount: 1,
+			}},
+		}
+
+		return &psTrack{
+			media: medi,
+			write: func(pts int64, data []byte) error {
+				r.strm.WriteUnit(medi, medi.Formats[0], &unit.G711{
+					Base: unit.Base{
+						NTP: time.Now(),
+						PTS: multiplyAndDivide(pts, int64(medi.Formats[0].ClockRate()), 90000),
+					},
+					Samples: data,
+				})
+				return nil
+			},
+		}
+
+	case ps.StreamTypeMPEG4Audio:
+		if aacConfig == nil {
+			return nil
+		}
+
+		medi := &description.Media{
+			Type: description.MediaTypeAudio,
+			Formats: []format.Format{&format.MPEG4Audio{
+				PayloadTyp:       96,
+				SizeLength:       13,
+				IndexLength:      3,
+				IndexDeltaLength: 3,
+				Config:           aacConfig,
+			}},
+		}
+
+		return &psTrack{
+			media: medi,
+			write: func(pts int64, data []byte) error {
+				var adts mpeg4audio.ADTSPackets
+				err := adts.Unmarshal(data)
+				if err != nil {
+					return err
+				}
+
+				aus := make([][]byte, len(adts))
+				for i, pkt := range adts {
+					aus[i] = pkt.AU
+				}
+
+				r.strm.WriteUnit(medi, medi.Formats[0], &unit.MPEG4Audio{
+					Base: unit.Base{
+						NTP: time.Now(),
+						PTS: multiplyAndDivide(pts, int64(medi.Formats[0].ClockRate()), 90000),
+					},
+					AUs: aus,
+				})
+				return nil
+			},
+		}
+	}
+
+	return nil
+}
+
+func (r *psReader) writePackets(pkts []*ps.Packet) {
+	for _, pkt := range pkts {
+		track, ok := r.tracks[pkt.StreamID]
+		if !ok {
+			continue
+		}
+
+		if !pkt.HasPTS {
+			r.onDecodeError(fmt.Errorf("PES packet without PTS"))
+			continue
+		}
+
+		err := track.write(r.timeDecoder.Decode(pkt.PTS), pkt.Data)
+		if err != nil {
+			r.onDecodeError(err)
+		}
+	}
+}
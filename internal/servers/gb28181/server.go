@@ -0,0 +1,777 @@
+// Package gb28181 contains a GB/T 28181 server.
+package gb28181
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/sip"
+)
+
+const (
+	defaultRegisterExpires = 3600 * time.Second
+	catalogRetryPeriod     = 30 * time.Second
+	sessionRetryPause      = 2 * time.Second
+	checkPeriod            = 1 * time.Second
+	maxDevices             = 1024
+	nonceValidity          = 60 * time.Second
+)
+
+// ErrDeviceNotFound is returned when a device is not found.
+var ErrDeviceNotFound = errors.New("device not found")
+
+func udpAddrEqual(a *net.UDPAddr, b *net.UDPAddr) bool {
+	return a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+func randomHex() string {
+	var buf [8]byte
+	rand.Read(buf[:]) //nolint:errcheck
+	return hex.EncodeToString(buf[:])
+}
+
+// MANSCDP message, as defined in GB/T 28181 Appendix A.
+// Devices usually declare the GB2312 charset, that is passed through
+// since fields used by the server are ASCII.
+type manscdpMessage struct {
+	XMLName    xml.Name
+	CmdType    string `xml:"CmdType"`
+	SN         int    `xml:"SN"`
+	DeviceID   string `xml:"DeviceID"`
+	SumNum     int    `xml:"SumNum"`
+	DeviceList struct {
+		Items []struct {
+			DeviceID string `xml:"DeviceID"`
+			Name     string `xml:"Name"`
+			Status   string `xml:"Status"`
+		} `xml:"Item"`
+	} `xml:"DeviceList"`
+}
+
+func (m *manscdpMessage) unmarshal(buf []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(buf))
+	d.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return d.Decode(m)
+}
+
+type serverSIPMessage struct {
+	msg  *sip.Message
+	addr *net.UDPAddr
+}
+
+type serverAPIDevicesListRes struct {
+	data *defs.APIGB28181DeviceList
+	err  error
+}
+
+type serverAPIDevicesListReq struct {
+	res chan serverAPIDevicesListRes
+}
+
+type serverAPIDevicesGetRes struct {
+	data *defs.APIGB28181Device
+	err  error
+}
+
+type serverAPIDevicesGetReq struct {
+	id  string
+	res chan serverAPIDevicesGetRes
+}
+
+type serverMetrics interface {
+	SetGB28181Server(defs.APIGB28181Server)
+}
+
+type serverPathManager interface {
+	AddPublisher(req defs.PathAddPublisherReq) (defs.Path, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a GB/T 28181 server.
+// Devices register through SIP, then they are invited to send
+// a MPEG Program Stream over RTP for each of their video channels.
+type Server struct {
+	SIPAddress       string
+	MediaAddress     string
+	ServerID         string
+	Domain           string
+	Password         string
+	ExternalIP       string
+	Transport        string
+	KeepaliveTimeout conf.Duration
+	ReadTimeout      conf.Duration
+	Metrics          serverMetrics
+	PathManager      serverPathManager
+	Parent           serverParent
+
+	ctx              context.Context
+	ctxCancel        func()
+	wg               sync.WaitGroup
+	sessionsWg       sync.WaitGroup
+	sipListener      *sipListener
+	mediaListener    *mediaListener
+	devices          map[string]*device
+	nonceKey         []byte
+	sessionsByCallID map[string]*session
+	ssrcCount        uint32
+
+	// media sessions by SSRC, used by mediaListener
+	mediaMutex    sync.RWMutex
+	mediaSessions map[uint32]*session
+
+	// in
+	chSIPMessage     chan serverSIPMessage
+	chAcceptErr      chan error
+	chCloseSession   chan *session
+	chAPIDevicesList chan serverAPIDevicesListReq
+	chAPIDevicesGet  chan serverAPIDevicesGetReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.devices = make(map[string]*device)
+	s.nonceKey = make([]byte, 32)
+	rand.Read(s.nonceKey) //nolint:errcheck
+	s.sessionsByCallID = make(map[string]*session)
+	s.mediaSessions = make(map[uint32]*session)
+	s.chSIPMessage = make(chan serverSIPMessage)
+	s.chAcceptErr = make(chan error)
+	s.chCloseSession = make(chan *session)
+	s.chAPIDevicesList = make(chan serverAPIDevicesListReq)
+	s.chAPIDevicesGet = make(chan serverAPIDevicesGetReq)
+
+	s.sipListener = &sipListener{
+		address: s.SIPAddress,
+		wg:      &s.wg,
+		parent:  s,
+	}
+	err := s.sipListener.initialize()
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+
+	s.mediaListener = &mediaListener{
+		address:     s.MediaAddress,
+		readTimeout: s.ReadTimeout,
+		wg:          &s.wg,
+		parent:      s,
+	}
+	err = s.mediaListener.initialize()
+	if err != nil {
+		s.sipListener.close()
+		s.ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on %s (SIP/UDP), %s (RTP/UDP, RTP/TCP)",
+		s.SIPAddress, s.MediaAddress)
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetGB28181Server(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[GB28181] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetGB28181Server(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(checkPeriod)
+	defer ticker.Stop()
+
+outer:
+	for {
+		select {
+		case err := <-s.chAcceptErr:
+			s.Log(logger.Error, "%s", err)
+			break outer
+
+		case req := <-s.chSIPMessage:
+			if req.msg.IsRequest() {
+				s.handleRequest(req.msg, req.addr)
+			} else if se, ok := s.sessionsByCallID[req.msg.Header.Get("Call-ID")]; ok {
+				se.onResponse(req.msg)
+			}
+
+		case se := <-s.chCloseSession:
+			s.removeSession(se)
+
+			if dev, ok := s.devices[se.device.id]; ok {
+				if ch, ok2 := dev.channels[se.channelID]; ok2 && ch.session == se {
+					ch.session = nil
+					ch.retryAt = time.Now().Add(sessionRetryPause)
+				}
+			}
+
+		case <-ticker.C:
+			s.checkDevices()
+
+		case req := <-s.chAPIDevicesList:
+			data := &defs.APIGB28181DeviceList{
+				Items: []*defs.APIGB28181Device{},
+			}
+
+			for _, dev := range s.devices {
+				data.Items = append(data.Items, dev.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPIDevicesListRes{data: data}
+
+		case req := <-s.chAPIDevicesGet:
+			dev, ok := s.devices[req.id]
+			if !ok {
+				req.res <- serverAPIDevicesGetRes{err: ErrDeviceNotFound}
+				continue
+			}
+
+			req.res <- serverAPIDevicesGetRes{data: dev.apiItem()}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	// wait for sessions to send BYE before closing listeners
+	s.sessionsWg.Wait()
+
+	s.sipListener.close()
+	s.mediaListener.close()
+}
+
+func (s *Server) handleRequest(req *sip.Message, addr *net.UDPAddr) {
+	switch req.Method {
+	case "REGISTER":
+		s.handleRegister(req, addr)
+
+	case "MESSAGE":
+		s.handleMessage(req, addr)
+
+	case "BYE":
+		// the device closed a media session
+		if se, ok := s.sessionsByCallID[req.Header.Get("Call-ID")]; ok {
+			se.Log(logger.Info, "device sent BYE")
+			se.Close()
+		}
+		s.writeResponse(req, addr, 200, "OK")
+
+	case "ACK":
+
+	case "OPTIONS":
+		s.writeResponse(req, addr, 200, "OK")
+
+	default:
+		s.writeResponse(req, addr, 501, "Not Implemented")
+	}
+}
+
+func (s *Server) handleRegister(req *sip.Message, addr *net.UDPAddr) {
+	deviceID := sip.URIUser(req.Header.Get("From"))
+	if deviceID == "" {
+		s.writeResponse(req, addr, 400, "Bad Request")
+		return
+	}
+
+	if s.Password != "" {
+		authHeader := req.Header.Get("Authorization")
+
+		if authHeader == "" || !s.authenticate(authHeader, deviceID, addr) {
+			if authHeader != "" {
+				s.Log(logger.Warn, "device %s (%v): authentication failed", deviceID, addr)
+			}
+
+			res := sip.NewResponse(req, 401, "Unauthorized")
+			res.Header.Set("WWW-Authenticate", sip.DigestChallenge(s.Domain, s.newNonce(deviceID, addr)))
+			s.writeSIPResponse(res, addr)
+			return
+		}
+	}
+
+	expires := defaultRegisterExpires
+	if v := req.Header.Get("Expires"); v != "" {
+		if tmp, err := strconv.ParseUint(v, 10, 31); err == nil {
+			expires = time.Duration(tmp) * time.Second
+		}
+	}
+
+	if _, ok := s.devices[deviceID]; !ok && expires != 0 && len(s.devices) >= maxDevices {
+		s.Log(logger.Warn, "device %s (%v): too many registered devices", deviceID, addr)
+		s.writeResponse(req, addr, 503, "Service Unavailable")
+		return
+	}
+
+	res := sip.NewResponse(req, 200, "OK")
+	res.Header.Set("Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	// devices synchronize their clock with this header
+	res.Header.Set("Date", time.Now().Format("2006-01-02T15:04:05.000"))
+	s.writeSIPResponse(res, addr)
+
+	dev, ok := s.devices[deviceID]
+
+	if expires == 0 {
+		if ok {
+			s.Log(logger.Info, "device %s unregistered", deviceID)
+			s.removeDevice(dev)
+		}
+		return
+	}
+
+	if ok {
+		if !udpAddrEqual(dev.addr, addr) {
+			s.Log(logger.Info, "device %s moved to %v", deviceID, addr)
+			dev.addr = addr
+			dev.localIP = s.localIP(addr)
+		}
+		dev.expires = time.Now().Add(expires)
+		return
+	}
+
+	dev = &device{
+		id:       deviceID,
+		created:  time.Now(),
+		addr:     addr,
+		localIP:  s.localIP(addr),
+		expires:  time.Now().Add(expires),
+		channels: make(map[string]*deviceChannel),
+	}
+	s.devices[deviceID] = dev
+
+	s.Log(logger.Info, "device %s registered from %v", deviceID, addr)
+
+	s.queryCatalog(dev)
+}
+
+func (s *Server) handleMessage(req *sip.Message, addr *net.UDPAddr) {
+	dev, ok := s.devices[sip.URIUser(req.Header.Get("From"))]
+	if !ok {
+		// ask the device to register again
+		s.writeResponse(req, addr, 403, "Forbidden")
+		return
+	}
+
+	// the From header is not authenticated, therefore messages are accepted
+	// only from the address used by the device to register.
+	if !udpAddrEqual(dev.addr, addr) {
+		s.Log(logger.Debug, "device %s: discarding message from unexpected address %v", dev.id, addr)
+		return
+	}
+
+	var msg manscdpMessage
+	err := msg.unmarshal(req.Body)
+	if err != nil {
+		s.writeResponse(req, addr, 400, "Bad Request")
+		return
+	}
+
+	s.writeResponse(req, addr, 200, "OK")
+
+	switch msg.CmdType {
+	case "Keepalive":
+		dev.lastKeepalive = time.Now()
+
+	case "Catalog":
+		for _, item := range msg.DeviceList.Items {
+			if !isVideoChannel(item.DeviceID) {
+				continue
+			}
+
+			ch, ok2 := dev.channels[item.DeviceID]
+			if !ok2 {
+				ch = &deviceChannel{id: item.DeviceID}
+				dev.channels[item.DeviceID] = ch
+
+				s.Log(logger.Info, "device %s: found channel %s", dev.id, item.DeviceID)
+			}
+
+			ch.name = item.Name
+			ch.status = item.Status
+		}
+
+		s.startSessions(dev)
+	}
+}
+
+// newNonce generates a nonce that contains its creation time
+// and is signed together with the device ID and address,
+// in order to avoid storing nonces of devices that never complete authentication.
+func (s *Server) newNonce(deviceID string, addr *net.UDPAddr) string {
+	ts := fmt.Sprintf("%016x", time.Now().Unix())
+	return ts + s.nonceSignature(ts, deviceID, addr)
+}
+
+func (s *Server) nonceSignature(ts string, deviceID string, addr *net.UDPAddr) string {
+	h := hmac.New(sha256.New, s.nonceKey)
+	h.Write([]byte(ts + "|" + deviceID + "|" + addr.String()))
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func (s *Server) authenticate(authHeader string, deviceID string, addr *net.UDPAddr) bool {
+	params, ok := sip.ParseDigest(authHeader)
+	if !ok {
+		return false
+	}
+
+	nonce := params["nonce"]
+	if len(nonce) != 48 {
+		return false
+	}
+
+	ts, err := strconv.ParseInt(nonce[:16], 16, 64)
+	if err != nil {
+		return false
+	}
+
+	age := time.Since(time.Unix(ts, 0))
+	if age < -checkPeriod || age > nonceValidity {
+		return false
+	}
+
+	if !hmac.Equal([]byte(nonce[16:]), []byte(s.nonceSignature(nonce[:16], deviceID, addr))) {
+		return false
+	}
+
+	return sip.DigestValidate(authHeader, "REGISTER", s.Domain, nonce, s.Password)
+}
+
+func (s *Server) checkDevices() {
+	now := time.Now()
+
+	for _, dev := range s.devices {
+		lastSeen := dev.lastKeepalive
+		if lastSeen.IsZero() {
+			lastSeen = dev.created
+		}
+
+		switch {
+		case now.After(dev.expires):
+			s.Log(logger.Info, "device %s: registration expired", dev.id)
+			s.removeDevice(dev)
+			continue
+
+		case now.Sub(lastSeen) > time.Duration(s.KeepaliveTimeout):
+			s.Log(logger.Info, "device %s: keepalive timed out", dev.id)
+			s.removeDevice(dev)
+			continue
+		}
+
+		if len(dev.channels) == 0 && now.Sub(dev.catalogRequested) >= catalogRetryPeriod {
+			s.queryCatalog(dev)
+		}
+
+		s.startSessions(dev)
+	}
+}
+
+func (s *Server) startSessions(dev *device) {
+	now := time.Now()
+
+	for _, ch := range dev.channels {
+		if ch.session != nil || now.Before(ch.retryAt) || ch.status == "OFF" {
+			continue
+		}
+
+		s.ssrcCount = (s.ssrcCount + 1) % 10000
+
+		se := &session{
+			parentCtx:   s.ctx,
+			device:      dev,
+			channelID:   ch.id,
+			pathName:    dev.pathName(ch.id),
+			transport:   s.Transport,
+			ssrc:        s.newSSRC(),
+			readTimeout: s.ReadTimeout,
+			wg:          &s.sessionsWg,
+			pathManager: s.PathManager,
+			parent:      s,
+		}
+		se.initialize()
+		ch.session = se
+
+		s.sessionsByCallID[se.callID] = se
+
+		s.mediaMutex.Lock()
+		s.mediaSessions[se.ssrc] = se
+		s.mediaMutex.Unlock()
+	}
+}
+
+// newSSRC generates a SSRC, as defined in GB/T 28181 Appendix F:
+// realtime flag (0), 5 digits of the domain, 4 digits of sequence number.
+func (s *Server) newSSRC() uint32 {
+	v, _ := strconv.ParseUint(s.Domain[3:8]+fmt.Sprintf("%04d", s.ssrcCount), 10, 32)
+	return uint32(v)
+}
+
+func (s *Server) removeSession(se *session) {
+	delete(s.sessionsByCallID, se.callID)
+
+	s.mediaMutex.Lock()
+	defer s.mediaMutex.Unlock()
+
+	for ssrc, se2 := range s.mediaSessions {
+		if se2 == se {
+			delete(s.mediaSessions, ssrc)
+		}
+	}
+}
+
+func (s *Server) removeDevice(dev *device) {
+	delete(s.devices, dev.id)
+
+	for _, ch := range dev.channels {
+		if ch.session != nil {
+			ch.session.Close()
+		}
+	}
+}
+
+func (s *Server) queryCatalog(dev *device) {
+	dev.catalogRequested = time.Now()
+
+	req := s.newRequest("MESSAGE", dev.id, dev.addr, dev.localIP, randomHex(), randomHex(), 1)
+	req.Header.Set("Content-Type", "Application/MANSCDP+xml")
+	req.Body = []byte(`<?xml version="1.0" encoding="GB2312"?>` + "\r\n" +
+		"<Query>\r\n" +
+		"<CmdType>Catalog</CmdType>\r\n" +
+		"<SN>" + strconv.FormatInt(time.Now().Unix()%100000, 10) + "</SN>\r\n" +
+		"<DeviceID>" + dev.id + "</DeviceID>\r\n" +
+		"</Query>\r\n")
+
+	err := s.writeSIP(req, dev.addr)
+	if err != nil {
+		s.Log(logger.Warn, "device %s: unable to query catalog: %v", dev.id, err)
+	}
+}
+
+// localIP returns the IP that is advertised to a device.
+func (s *Server) localIP(addr *net.UDPAddr) string {
+	if s.ExternalIP != "" {
+		return s.ExternalIP
+	}
+
+	// find the local IP used to reach the device. No packet is sent.
+	c, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer c.Close()
+
+	return c.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+func (s *Server) sipPort() int {
+	return s.sipListener.pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (s *Server) mediaPort() int {
+	return s.mediaListener.pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (s *Server) newRequest(
+	method string,
+	user string,
+	addr *net.UDPAddr,
+	localIP string,
+	callID string,
+	fromTag string,
+	cseq uint32,
+) *sip.Message {
+	local := net.JoinHostPort(localIP, strconv.Itoa(s.sipPort()))
+
+	req := &sip.Message{
+		Method: method,
+		URI:    "sip:" + user + "@" + addr.String(),
+		Header: make(sip.Header),
+	}
+
+	req.Header.Set("Via", "SIP/2.0/UDP "+local+";rport;branch=z9hG4bK"+randomHex())
+	req.Header.Set("From", "<sip:"+s.ServerID+"@"+s.Domain+">;tag="+fromTag)
+	req.Header.Set("To", "<sip:"+user+"@"+s.Domain+">")
+	req.Header.Set("Call-ID", callID)
+	req.Header.Set("CSeq", strconv.FormatUint(uint64(cseq), 10)+" "+method)
+	req.Header.Set("Contact", "<sip:"+s.ServerID+"@"+local+">")
+	req.Header.Set("Max-Forwards", "70")
+	req.Header.Set("User-Agent", "mediamtx")
+
+	return req
+}
+
+func (s *Server) writeSIP(msg *sip.Message, addr *net.UDPAddr) error {
+	return s.sipListener.write(msg, addr)
+}
+
+func (s *Server) writeSIPResponse(res *sip.Message, addr *net.UDPAddr) {
+	if to := res.Header.Get("To"); to != "" && sip.HeaderParam(to, "tag") == "" {
+		res.Header.Set("To", to+";tag="+randomHex())
+	}
+
+	err := s.writeSIP(res, addr)
+	if err != nil {
+		s.Log(logger.Warn, "unable to write SIP response: %v", err)
+	}
+}
+
+func (s *Server) writeResponse(req *sip.Message, addr *net.UDPAddr, statusCode int, reason string) {
+	s.writeSIPResponse(sip.NewResponse(req, statusCode, reason), addr)
+}
+
+// acceptError is called by sipListener and mediaListener.
+func (s *Server) acceptError(err error) {
+	select {
+	case s.chAcceptErr <- err:
+	case <-s.ctx.Done():
+	}
+}
+
+// sipMessage is called by sipListener.
+func (s *Server) sipMessage(msg *sip.Message, addr *net.UDPAddr) {
+	select {
+	case s.chSIPMessage <- serverSIPMessage{msg: msg, addr: addr}:
+	case <-s.ctx.Done():
+	}
+}
+
+// routePacket is called by mediaListener.
+func (s *Server) routePacket(pkt *rtp.Packet, ip net.IP) {
+	s.mediaMutex.RLock()
+	se, ok := s.mediaSessions[pkt.SSRC]
+	s.mediaMutex.RUnlock()
+
+	if !ok {
+		se = s.bindSSRC(pkt.SSRC, ip)
+		if se == nil {
+			return
+		}
+	}
+
+	// SSRCs are predictable, therefore packets are accepted
+	// only from the address of the device.
+	if !se.deviceAddr.IP.Equal(ip) {
+		return
+	}
+
+	se.onPacket(pkt)
+}
+
+// bindSSRC associates an unknown SSRC with a session of the same device,
+// since some devices ignore the SSRC provided in the INVITE.
+func (s *Server) bindSSRC(ssrc uint32, ip net.IP) *session {
+	s.mediaMutex.Lock()
+	defer s.mediaMutex.Unlock()
+
+	var found *session
+
+	for _, se := range s.mediaSessions {
+		if se.deviceAddr.IP.Equal(ip) && atomic.LoadInt32(se.received) == 0 {
+			// the session is ambiguous
+			if found != nil && found != se {
+				return nil
+			}
+			found = se
+		}
+	}
+
+	if found != nil {
+		s.mediaSessions[ssrc] = found
+	}
+
+	return found
+}
+
+// closeSession is called by session.
+func (s *Server) closeSession(se *session) {
+	select {
+	case s.chCloseSession <- se:
+	case <-s.ctx.Done():
+	}
+}
+
+// APIDevicesList is called by api.
+func (s *Server) APIDevicesList() (*defs.APIGB28181DeviceList, error) {
+	req := serverAPIDevicesListReq{
+		res: make(chan serverAPIDevicesListRes),
+	}
+
+	select {
+	case s.chAPIDevicesList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIDevicesGet is called by api.
+func (s *Server) APIDevicesGet(id string) (*defs.APIGB28181Device, error) {
+	req := serverAPIDevicesGetReq{
+		id:  id,
+		res: make(chan serverAPIDevicesGetRes),
+	}
+
+	select {
+	case s.chAPIDevicesGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
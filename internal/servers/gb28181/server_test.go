@@ -0,0 +1,327 @@
+package gb28181
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/protocols/ps"
+	"github.com/bluenviron/mediamtx/internal/protocols/sip"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	testServerID  = "34020000002000000001"
+	testDomain    = "3402000000"
+	testDeviceID  = "34020000001110000001"
+	testChannelID = "34020000001320000001"
+)
+
+type dummyPath struct {
+	stream        *stream.Stream
+	streamCreated chan struct{}
+}
+
+func (p *dummyPath) Name() string {
+	return testDeviceID + "/" + testChannelID
+}
+
+func (p *dummyPath) SafeConf() *conf.Path {
+	return &conf.Path{}
+}
+
+func (p *dummyPath) ExternalCmdEnv() externalcmd.Environment {
+	return externalcmd.Environment{}
+}
+
+func (p *dummyPath) StartPublisher(req defs.PathStartPublisherReq) (*stream.Stream, error) {
+	p.stream = &stream.Stream{
+		WriteQueueSize:     512,
+		UDPMaxPayloadSize:  1472,
+		Desc:               req.Desc,
+		GenerateRTPPackets: true,
+		Parent:             test.NilLogger,
+	}
+	err := p.stream.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	close(p.streamCreated)
+	return p.stream, nil
+}
+
+func (p *dummyPath) StopPublisher(_ defs.PathStopPublisherReq) {
+}
+
+func (p *dummyPath) RemovePublisher(_ defs.PathRemovePublisherReq) {
+}
+
+func (p *dummyPath) RemoveReader(_ defs.PathRemoveReaderReq) {
+}
+
+type testDevice struct {
+	t    *testing.T
+	conn *net.UDPConn
+	addr *net.UDPAddr
+}
+
+func (d *testDevice) write(msg *sip.Message) {
+	_, err := d.conn.WriteToUDP(msg.Marshal(), d.addr)
+	require.NoError(d.t, err)
+}
+
+func (d *testDevice) read() *sip.Message {
+	buf := make([]byte, 2048)
+	d.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := d.conn.ReadFromUDP(buf)
+	require.NoError(d.t, err)
+
+	var msg sip.Message
+	err = msg.Unmarshal(buf[:n])
+	require.NoError(d.t, err)
+	return &msg
+}
+
+func (d *testDevice) request(method string, cseq int, body string) *sip.Message {
+	req := &sip.Message{
+		Method: method,
+		URI:    "sip:" + testServerID + "@" + testDomain,
+		Header: make(sip.Header),
+		Body:   []byte(body),
+	}
+	req.Header.Set("Via", "SIP/2.0/UDP "+d.conn.LocalAddr().String()+";rport;branch=z9hG4bK"+strconv.Itoa(cseq))
+	req.Header.Set("From", "<sip:"+testDeviceID+"@"+testDomain+">;tag=devtag")
+	req.Header.Set("To", "<sip:"+testDeviceID+"@"+testDomain+">")
+	req.Header.Set("Call-ID", "devcall"+method)
+	req.Header.Set("CSeq", strconv.Itoa(cseq)+" "+method)
+	return req
+}
+
+func TestServerPublish(t *testing.T) {
+	path := &dummyPath{
+		streamCreated: make(chan struct{}),
+	}
+
+	pathManager := &test.PathManager{
+		AddPublisherImpl: func(req defs.PathAddPublisherReq) (defs.Path, error) {
+			require.Equal(t, testDeviceID+"/"+testChannelID, req.AccessRequest.Name)
+			require.True(t, req.AccessRequest.Publish)
+			require.Equal(t, testDeviceID, req.AccessRequest.Credentials.User)
+			require.Equal(t, "12345678", req.AccessRequest.Credentials.Pass)
+			return path, nil
+		},
+	}
+
+	s := &Server{
+		SIPAddress:       "127.0.0.1:15060",
+		MediaAddress:     "127.0.0.1:19000",
+		ServerID:         testServerID,
+		Domain:           testDomain,
+		Password:         "12345678",
+		Transport:        "udp",
+		KeepaliveTimeout: conf.Duration(180 * time.Second),
+		ReadTimeout:      conf.Duration(10 * time.Second),
+		PathManager:      pathManager,
+		Parent:           test.NilLogger,
+	}
+	err := s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	dev := &testDevice{
+		t:    t,
+		conn: conn,
+		addr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 15060},
+	}
+
+	// register with authentication
+
+	dev.write(dev.request("REGISTER", 1, ""))
+
+	res := dev.read()
+	require.Equal(t, 401, res.StatusCode)
+
+	params, ok := sip.ParseDigest(res.Header.Get("WWW-Authenticate"))
+	require.True(t, ok)
+	params["username"] = testDeviceID
+	params["uri"] = "sip:" + testServerID + "@" + testDomain
+
+	req := dev.request("REGISTER", 2, "")
+	req.Header.Set("Authorization", `Digest username="`+testDeviceID+`",realm="`+params["realm"]+
+		`",nonce="`+params["nonce"]+`",uri="`+params["uri"]+
+		`",response="`+sip.DigestResponse(params, "REGISTER", "12345678")+`",algorithm=MD5`)
+	dev.write(req)
+
+	res = dev.read()
+	require.Equal(t, 200, res.StatusCode)
+
+	// catalog
+
+	query := dev.read()
+	require.Equal(t, "MESSAGE", query.Method)
+	require.Contains(t, string(query.Body), "<CmdType>Catalog</CmdType>")
+	dev.write(sip.NewResponse(query, 200, "OK"))
+
+	dev.write(dev.request("MESSAGE", 3, `<?xml version="1.0" encoding="GB2312"?>`+"\r\n"+
+		"<Response>\r\n"+
+		"<CmdType>Catalog</CmdType>\r\n"+
+		"<SN>1</SN>\r\n"+
+		"<DeviceID>"+testDeviceID+"</DeviceID>\r\n"+
+		"<SumNum>1</SumNum>\r\n"+
+		`<DeviceList Num="1">`+"\r\n"+
+		"<Item><DeviceID>"+testChannelID+"</DeviceID><Name>Camera</Name><Status>ON</Status></Item>\r\n"+
+		"</DeviceList>\r\n"+
+		"</Response>\r\n"))
+
+	res = dev.read()
+	require.Equal(t, 200, res.StatusCode)
+
+	// invite
+
+	invite := dev.read()
+	require.Equal(t, "INVITE", invite.Method)
+
+	m := regexp.MustCompile(`y=(\d+)`).FindStringSubmatch(string(invite.Body))
+	require.NotNil(t, m)
+	ssrc, err := strconv.ParseUint(m[1], 10, 32)
+	require.NoError(t, err)
+	require.Contains(t, string(invite.Body), "m=video 19000 RTP/AVP")
+
+	ok200 := sip.NewResponse(invite, 200, "OK")
+	ok200.Header.Set("To", invite.Header.Get("To")+";tag=devtag2")
+	dev.write(ok200)
+
+	ack := dev.read()
+	require.Equal(t, "ACK", ack.Method)
+	require.Equal(t, "devtag2", sip.HeaderParam(ack.Header.Get("To"), "tag"))
+
+	// messages sent from other addresses are discarded
+
+	spoofConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	require.NoError(t, err)
+	defer spoofConn.Close()
+
+	spoofer := &testDevice{
+		t:    t,
+		conn: spoofConn,
+		addr: dev.addr,
+	}
+
+	spoofer.write(spoofer.request("MESSAGE", 4, `<?xml version="1.0" encoding="GB2312"?>`+"\r\n"+
+		"<Response>\r\n"+
+		"<CmdType>Catalog</CmdType>\r\n"+
+		"<SN>2</SN>\r\n"+
+		"<DeviceID>"+testDeviceID+"</DeviceID>\r\n"+
+		"<SumNum>1</SumNum>\r\n"+
+		`<DeviceList Num="1">`+"\r\n"+
+		"<Item><DeviceID>34020000001320000002</DeviceID><Name>Spoofed</Name><Status>ON</Status></Item>\r\n"+
+		"</DeviceList>\r\n"+
+		"</Response>\r\n"))
+
+	// media
+
+	mediaConn, err := net.Dial("udp", "127.0.0.1:19000")
+	require.NoError(t, err)
+	defer mediaConn.Close()
+
+	muxer := &ps.Muxer{
+		StreamTypes: map[uint8]ps.StreamType{0xE0: ps.StreamTypeH264},
+	}
+
+	seq := uint16(0)
+
+	writeFrame := func(pts int64, au [][]byte, withPSM bool) {
+		buf, err2 := h264.AnnexB(au).Marshal()
+		require.NoError(t, err2)
+
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         true,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      uint32(pts),
+				SSRC:           uint32(ssrc),
+			},
+			Payload: muxer.Marshal(0xE0, pts, buf, withPSM),
+		}
+		seq++
+
+		byts, err2 := pkt.Marshal()
+		require.NoError(t, err2)
+		_, err2 = mediaConn.Write(byts)
+		require.NoError(t, err2)
+	}
+
+	writeFrame(90000, [][]byte{
+		test.FormatH264.SPS,
+		test.FormatH264.PPS,
+		{0x05, 1}, // IDR
+	}, true)
+
+	<-path.streamCreated
+
+	reader := test.NilLogger
+	recv := make(chan struct{})
+
+	path.stream.AddReader(
+		reader,
+		path.stream.Desc.Medias[0],
+		path.stream.Desc.Medias[0].Formats[0],
+		func(u unit.Unit) error {
+			require.Equal(t, [][]byte{
+				test.FormatH264.SPS,
+				test.FormatH264.PPS,
+				{0x05, 2}, // IDR
+			}, u.(*unit.H264).AU)
+			close(recv)
+			return nil
+		})
+
+	path.stream.StartReader(reader)
+	defer path.stream.RemoveReader(reader)
+
+	writeFrame(93600, [][]byte{{0x05, 2}}, false)
+
+	<-recv
+
+	list, err := s.APIDevicesList()
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Equal(t, testDeviceID, list.Items[0].ID)
+	require.Equal(t, conn.LocalAddr().String(), list.Items[0].RemoteAddr)
+	require.Equal(t, []*defs.APIGB28181Channel{{
+		ID:            testChannelID,
+		Name:          "Camera",
+		Status:        "ON",
+		State:         defs.APIGB28181ChannelStateStreaming,
+		Path:          testDeviceID + "/" + testChannelID,
+		BytesReceived: list.Items[0].Channels[0].BytesReceived,
+	}}, list.Items[0].Channels)
+	require.NotZero(t, list.Items[0].Channels[0].BytesReceived)
+
+	_, err = s.APIDevicesGet("unknown")
+	require.Equal(t, ErrDeviceNotFound, err)
+
+	s.Close()
+
+	bye := dev.read()
+	require.Equal(t, "BYE", bye.Method)
+	require.Equal(t, invite.Header.Get("Call-ID"), bye.Header.Get("Call-ID"))
+}
@@ -0,0 +1,338 @@
+package gb28181
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/counterdumper"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/sip"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	inviteTimeout       = 10 * time.Second
+	inviteRetransmitGap = 1 * time.Second
+	sessionPacketBuffer = 512
+)
+
+type sessionState int
+
+const (
+	sessionStateInviting sessionState = iota
+	sessionStateStreaming
+)
+
+// session is a media session with a channel of a device,
+// established with INVITE and published into a path.
+type session struct {
+	parentCtx   context.Context
+	device      *device
+	channelID   string
+	pathName    string
+	transport   string
+	ssrc        uint32
+	readTimeout conf.Duration
+	wg          *sync.WaitGroup
+	pathManager serverPathManager
+	parent      *Server
+
+	ctx           context.Context
+	ctxCancel     func()
+	uuid          uuid.UUID
+	callID        string
+	fromTag       string
+	toTag         string
+	deviceAddr    *net.UDPAddr
+	localIP       string
+	bytesReceived *uint64
+	received      *int32
+	mutex         sync.RWMutex
+	state         sessionState
+
+	// in
+	chResponse chan *sip.Message
+	chPacket   chan *rtp.Packet
+}
+
+func (se *session) initialize() {
+	se.ctx, se.ctxCancel = context.WithCancel(se.parentCtx)
+
+	se.uuid = uuid.New()
+	se.callID = randomHex()
+	se.fromTag = randomHex()
+	se.deviceAddr = se.device.addr
+	se.localIP = se.device.localIP
+	se.bytesReceived = new(uint64)
+	se.received = new(int32)
+	se.chResponse = make(chan *sip.Message, 8)
+	se.chPacket = make(chan *rtp.Packet, sessionPacketBuffer)
+
+	se.Log(logger.Info, "created")
+
+	se.wg.Add(1)
+	go se.run()
+}
+
+// Close closes the session.
+func (se *session) Close() {
+	se.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (se *session) Log(level logger.Level, format string, args ...interface{}) {
+	se.parent.Log(level, "[session %s/%s] "+format,
+		append([]interface{}{se.device.id, se.channelID}, args...)...)
+}
+
+func (se *session) run() {
+	defer se.wg.Done()
+
+	err := se.runInner()
+
+	se.ctxCancel()
+
+	se.parent.closeSession(se)
+
+	se.Log(logger.Info, "closed: %v", err)
+}
+
+func (se *session) runInner() error {
+	path, err := se.pathManager.AddPublisher(defs.PathAddPublisherReq{
+		Author: se,
+		AccessRequest: defs.PathAccessRequest{
+			Name:    se.pathName,
+			Publish: true,
+			Proto:   auth.ProtocolGB28181,
+			ID:      &se.uuid,
+			Credentials: &auth.Credentials{
+				User: se.device.id,
+				Pass: se.parent.Password,
+			},
+			IP: se.deviceAddr.IP,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	defer path.RemovePublisher(defs.PathRemovePublisherReq{Author: se})
+
+	err = se.invite()
+	if err != nil {
+		return err
+	}
+
+	defer se.bye()
+
+	se.mutex.Lock()
+	se.state = sessionStateStreaming
+	se.mutex.Unlock()
+
+	decodeErrors := &counterdumper.CounterDumper{
+		OnReport: func(val uint64) {
+			se.Log(logger.Warn, "%d decode %s",
+				val,
+				func() string {
+					if val == 1 {
+						return "error"
+					}
+					return "errors"
+				}())
+		},
+	}
+
+	decodeErrors.Start()
+	defer decodeErrors.Stop()
+
+	r := &psReader{
+		onStart: func(medias []*description.Media) (*stream.Stream, error) {
+			strm, err2 := path.StartPublisher(defs.PathStartPublisherReq{
+				Author:             se,
+				Desc:               &description.Session{Medias: medias},
+				GenerateRTPPackets: true,
+			})
+			if err2 != nil {
+				return nil, err2
+			}
+
+			se.Log(logger.Info, "is publishing to path '%s', %s",
+				path.Name(), defs.MediasInfo(medias))
+
+			return strm, nil
+		},
+		onDecodeError: func(_ error) {
+			decodeErrors.Increase()
+		},
+	}
+	r.initialize()
+
+	timer := time.NewTimer(time.Duration(se.readTimeout))
+	defer timer.Stop()
+
+	for {
+		select {
+		case pkt := <-se.chPacket:
+			timer.Reset(time.Duration(se.readTimeout))
+
+			err = r.push(pkt)
+			if err != nil {
+				return err
+			}
+
+		case <-timer.C:
+			return fmt.Errorf("no media received in %v", time.Duration(se.readTimeout))
+
+		case <-se.ctx.Done():
+			return errors.New("terminated")
+		}
+	}
+}
+
+func (se *session) newRequest(method string, cseq uint32) *sip.Message {
+	req := se.parent.newRequest(method, se.channelID, se.deviceAddr, se.localIP, se.callID, se.fromTag, cseq)
+
+	if se.toTag != "" {
+		req.Header.Set("To", req.Header.Get("To")+";tag="+se.toTag)
+	}
+
+	return req
+}
+
+func (se *session) sdp() []byte {
+	proto := "RTP/AVP"
+	if se.transport == "tcp" {
+		proto = "TCP/RTP/AVP"
+	}
+
+	sdp := "v=0\r\n" +
+		"o=" + se.parent.ServerID + " 0 0 IN IP4 " + se.localIP + "\r\n" +
+		"s=Play\r\n" +
+		"c=IN IP4 " + se.localIP + "\r\n" +
+		"t=0 0\r\n" +
+		"m=video " + strconv.Itoa(se.parent.mediaPort()) + " " + proto + " 96 97 98\r\n" +
+		"a=recvonly\r\n" +
+		"a=rtpmap:96 PS/90000\r\n" +
+		"a=rtpmap:97 MPEG4/90000\r\n" +
+		"a=rtpmap:98 H264/90000\r\n"
+
+	if se.transport == "tcp" {
+		sdp += "a=setup:passive\r\n" +
+			"a=connection:new\r\n"
+	}
+
+	// SSRC, as defined in GB/T 28181 Appendix F
+	sdp += fmt.Sprintf("y=%010d\r\n", se.ssrc)
+
+	return []byte(sdp)
+}
+
+func (se *session) invite() error {
+	req := se.newRequest("INVITE", 1)
+	req.Header.Set("Content-Type", "APPLICATION/SDP")
+	req.Header.Set("Subject", fmt.Sprintf("%s:%010d,%s:0", se.channelID, se.ssrc, se.parent.ServerID))
+	req.Body = se.sdp()
+
+	err := se.parent.writeSIP(req, se.deviceAddr)
+	if err != nil {
+		return err
+	}
+
+	retransmit := time.NewTicker(inviteRetransmitGap)
+	defer retransmit.Stop()
+
+	timeout := time.NewTimer(inviteTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case res := <-se.chResponse:
+			if _, method := res.CSeq(); method != "INVITE" {
+				continue
+			}
+
+			switch {
+			case res.StatusCode < 200:
+				// stop retransmissions once the device acknowledged the request
+				retransmit.Stop()
+
+			case res.StatusCode < 300:
+				se.toTag = sip.HeaderParam(res.Header.Get("To"), "tag")
+
+				ack := se.newRequest("ACK", 1)
+				return se.parent.writeSIP(ack, se.deviceAddr)
+
+			default:
+				return fmt.Errorf("device replied with code %d (%s)", res.StatusCode, res.Reason)
+			}
+
+		case <-retransmit.C:
+			err = se.parent.writeSIP(req, se.deviceAddr)
+			if err != nil {
+				return err
+			}
+
+		case <-timeout.C:
+			return fmt.Errorf("device did not reply to INVITE")
+
+		case <-se.ctx.Done():
+			return errors.New("terminated")
+		}
+	}
+}
+
+func (se *session) bye() {
+	req := se.newRequest("BYE", 2)
+	se.parent.writeSIP(req, se.deviceAddr) //nolint:errcheck
+}
+
+// onResponse is called by Server.
+func (se *session) onResponse(res *sip.Message) {
+	select {
+	case se.chResponse <- res:
+	default:
+	}
+}
+
+// onPacket is called by Server.
+func (se *session) onPacket(pkt *rtp.Packet) {
+	atomic.StoreInt32(se.received, 1)
+	atomic.AddUint64(se.bytesReceived, uint64(len(pkt.Payload)))
+
+	select {
+	case se.chPacket <- pkt:
+	default:
+		// the reader is too slow, discard the packet. psReader detects the gap.
+	}
+}
+
+// APISourceDescribe implements source.
+func (se *session) APISourceDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "gb28181Session",
+		ID:   se.uuid.String(),
+	}
+}
+
+func (se *session) apiState() defs.APIGB28181ChannelState {
+	se.mutex.RLock()
+	defer se.mutex.RUnlock()
+
+	if se.state == sessionStateStreaming {
+		return defs.APIGB28181ChannelStateStreaming
+	}
+	return defs.APIGB28181ChannelStateInviting
+}
@@ -0,0 +1,77 @@
+package gb28181
+
+import (
+	"net"
+	"sync"
+
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/sip"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+const (
+	sipMaxMessageSize = 65535
+)
+
+type sipListener struct {
+	address string
+	wg      *sync.WaitGroup
+	parent  *Server
+
+	pc net.PacketConn
+}
+
+func (l *sipListener) initialize() error {
+	var err error
+	l.pc, err = net.ListenPacket(restrictnetwork.Restrict("udp", l.address))
+	if err != nil {
+		return err
+	}
+
+	l.wg.Add(1)
+	go l.run()
+
+	return nil
+}
+
+func (l *sipListener) close() {
+	l.pc.Close()
+}
+
+func (l *sipListener) run() {
+	defer l.wg.Done()
+
+	err := l.runInner()
+
+	l.parent.acceptError(err)
+}
+
+func (l *sipListener) runInner() error {
+	buf := make([]byte, sipMaxMessageSize)
+
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		// keepalive sent by some devices in order to keep NAT mappings open
+		if n <= 4 {
+			continue
+		}
+
+		var msg sip.Message
+		err = msg.Unmarshal(append([]byte(nil), buf[:n]...))
+		if err != nil {
+			l.parent.Log(logger.Debug, "invalid SIP message from %v: %v", addr, err)
+			continue
+		}
+
+		l.parent.sipMessage(&msg, addr.(*net.UDPAddr))
+	}
+}
+
+func (l *sipListener) write(msg *sip.Message, addr *net.UDPAddr) error {
+	_, err := l.pc.WriteTo(msg.Marshal(), addr)
+	return err
+}
@@ -36,15 +36,19 @@ func mergePathAndQuery(path string, rawQuery string) string {
 }
 
 type httpServer struct {
-	address        string
-	encryption     bool
-	serverKey      string
-	serverCert     string
-	allowOrigin    string
-	trustedProxies conf.IPNetworks
-	readTimeout    conf.Duration
-	pathManager    serverPathManager
-	parent         *Server
+	address            string
+	encryption         bool
+	serverKey          string
+	serverCert         string
+	clientCA           string
+	clientCertRequired bool
+	allowOrigin        string
+	trustedProxies     conf.IPNetworks
+	h2c                bool
+	http3              bool
+	readTimeout        conf.Duration
+	pathManager        serverPathManager
+	parent             *Server
 
 	inner *httpp.Server
 }
@@ -60,14 +64,18 @@ func (s *httpServer) initialize() error {
 	network, address := restrictnetwork.Restrict("tcp", s.address)
 
 	s.inner = &httpp.Server{
-		Network:     network,
-		Address:     address,
-		ReadTimeout: time.Duration(s.readTimeout),
-		Encryption:  s.encryption,
-		ServerCert:  s.serverCert,
-		ServerKey:   s.serverKey,
-		Handler:     router,
-		Parent:      s,
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(s.readTimeout),
+		Encryption:         s.encryption,
+		ServerCert:         s.serverCert,
+		ServerKey:          s.serverKey,
+		ClientCA:           s.clientCA,
+		ClientCertRequired: s.clientCertRequired,
+		H2C:                s.h2c,
+		HTTP3:              s.http3,
+		Handler:            router,
+		Parent:             s,
 	}
 	err := s.inner.Initialize()
 	if err != nil {
@@ -70,24 +70,28 @@ type serverParent interface {
 
 // Server is a HLS server.
 type Server struct {
-	Address         string
-	Encryption      bool
-	ServerKey       string
-	ServerCert      string
-	AllowOrigin     string
-	TrustedProxies  conf.IPNetworks
-	AlwaysRemux     bool
-	Variant         conf.HLSVariant
-	SegmentCount    int
-	SegmentDuration conf.Duration
-	PartDuration    conf.Duration
-	SegmentMaxSize  conf.StringSize
-	Directory       string
-	ReadTimeout     conf.Duration
-	MuxerCloseAfter conf.Duration
-	Metrics         serverMetrics
-	PathManager     serverPathManager
-	Parent          serverParent
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	H2C                bool
+	HTTP3              bool
+	AlwaysRemux        bool
+	Variant            conf.HLSVariant
+	SegmentCount       int
+	SegmentDuration    conf.Duration
+	PartDuration       conf.Duration
+	SegmentMaxSize     conf.StringSize
+	Directory          string
+	ReadTimeout        conf.Duration
+	MuxerCloseAfter    conf.Duration
+	Metrics            serverMetrics
+	PathManager        serverPathManager
+	Parent             serverParent
 
 	ctx        context.Context
 	ctxCancel  func()
@@ -119,15 +123,19 @@ func (s *Server) Initialize() error {
 	s.chAPIMuxerGet = make(chan serverAPIMuxersGetReq)
 
 	s.httpServer = &httpServer{
-		address:        s.Address,
-		encryption:     s.Encryption,
-		serverKey:      s.ServerKey,
-		serverCert:     s.ServerCert,
-		allowOrigin:    s.AllowOrigin,
-		trustedProxies: s.TrustedProxies,
-		readTimeout:    s.ReadTimeout,
-		pathManager:    s.PathManager,
-		parent:         s,
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		h2c:                s.H2C,
+		http3:              s.HTTP3,
+		readTimeout:        s.ReadTimeout,
+		pathManager:        s.PathManager,
+		parent:             s,
 	}
 	err := s.httpServer.initialize()
 	if err != nil {
@@ -0,0 +1,270 @@
+package httpflv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/hooks"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/protocols/rtmp"
+	"github.com/bluenviron/mediamtx/internal/protocols/websocket"
+)
+
+func writeError(ctx *gin.Context, statusCode int, err error) {
+	ctx.JSON(statusCode, &defs.APIError{
+		Error: err.Error(),
+	})
+}
+
+// httpWriter writes and flushes every FLV tag.
+type httpWriter struct {
+	w http.ResponseWriter
+}
+
+func (w *httpWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	err = http.NewResponseController(w.w).Flush()
+	return n, err
+}
+
+// wsWriter writes every FLV tag into a binary message.
+type wsWriter struct {
+	wc *websocket.ServerConn
+}
+
+func (w *wsWriter) Write(p []byte) (int, error) {
+	err := w.wc.WriteBinary(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// wsDeadlineSetter does nothing, since ServerConn applies a write deadline to every message.
+type wsDeadlineSetter struct{}
+
+func (wsDeadlineSetter) SetWriteDeadline(_ time.Time) error {
+	return nil
+}
+
+type conn struct {
+	parentCtx       context.Context
+	writeTimeout    conf.Duration
+	pathName        string
+	webSocket       bool
+	ginCtx          *gin.Context
+	wg              *sync.WaitGroup
+	externalCmdPool *externalcmd.Pool
+	pathManager     serverPathManager
+	parent          *Server
+
+	ctx        context.Context
+	ctxCancel  func()
+	uuid       uuid.UUID
+	created    time.Time
+	remoteAddr string
+	query      string
+	mutex      sync.RWMutex
+	fconn      *rtmp.FLVConn
+}
+
+func (c *conn) initialize() {
+	c.ctx, c.ctxCancel = context.WithCancel(c.parentCtx)
+
+	c.uuid = uuid.New()
+	c.created = time.Now()
+	c.remoteAddr = httpp.RemoteAddr(c.ginCtx)
+	c.query = c.ginCtx.Request.URL.RawQuery
+
+	c.Log(logger.Info, "opened")
+
+	c.wg.Add(1)
+}
+
+// Close closes the connection.
+func (c *conn) Close() {
+	c.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (c *conn) Log(level logger.Level, format string, args ...interface{}) {
+	c.parent.Log(level, "[conn %v] "+format, append([]interface{}{c.remoteAddr}, args...)...)
+}
+
+// run is called by the HTTP handler and returns when the connection is closed.
+func (c *conn) run() {
+	defer c.wg.Done()
+
+	err := c.runInner()
+
+	c.ctxCancel()
+
+	c.parent.closeConn(c)
+
+	c.Log(logger.Info, "closed: %v", err)
+}
+
+func (c *conn) runInner() error {
+	path, stream, err := c.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: c,
+		AccessRequest: defs.PathAccessRequest{
+			Name:        c.pathName,
+			Query:       c.query,
+			Proto:       auth.ProtocolHTTPFLV,
+			ID:          &c.uuid,
+			Credentials: httpp.Credentials(c.ginCtx.Request),
+			IP:          net.ParseIP(c.ginCtx.ClientIP()),
+		},
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			if terr.AskCredentials {
+				c.ginCtx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				c.ginCtx.Writer.WriteHeader(http.StatusUnauthorized)
+				return terr
+			}
+
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			writeError(c.ginCtx, http.StatusUnauthorized, terr)
+			return terr
+		}
+
+		var terr2 defs.PathNoStreamAvailableError
+		if errors.As(err, &terr2) {
+			writeError(c.ginCtx, http.StatusNotFound, err)
+			return err
+		}
+
+		writeError(c.ginCtx, http.StatusBadRequest, err)
+		return err
+	}
+
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: c})
+
+	var fconn *rtmp.FLVConn
+	var deadlineSetter rtmp.WriteDeadlineSetter
+	var clientGone <-chan struct{}
+
+	if c.webSocket {
+		var wc *websocket.ServerConn
+		wc, err = websocket.NewServerConn(c.ginCtx.Writer, c.ginCtx.Request, c.parent.AllowOrigin)
+		if err != nil {
+			return err
+		}
+		defer wc.Close()
+
+		fconn = &rtmp.FLVConn{W: &wsWriter{wc: wc}}
+		deadlineSetter = wsDeadlineSetter{}
+
+		// read and discard incoming messages in order to process control frames
+		// and detect disconnections.
+		wsGone := make(chan struct{})
+		go func() {
+			defer close(wsGone)
+			for {
+				_, _, err := wc.ReadMessage()
+				if err != nil {
+					return
+				}
+			}
+		}()
+		clientGone = wsGone
+	} else {
+		c.ginCtx.Header("Content-Type", "video/x-flv")
+		c.ginCtx.Header("Cache-Control", "no-cache")
+		c.ginCtx.Writer.WriteHeader(http.StatusOK)
+
+		fconn = &rtmp.FLVConn{W: &httpWriter{w: c.ginCtx.Writer}}
+		deadlineSetter = http.NewResponseController(c.ginCtx.Writer)
+		clientGone = c.ginCtx.Request.Context().Done()
+	}
+
+	fconn.Initialize()
+
+	c.mutex.Lock()
+	c.fconn = fconn
+	c.mutex.Unlock()
+
+	deadlineSetter.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout))) //nolint:errcheck
+
+	err = rtmp.FromStream(stream, c, fconn, deadlineSetter, time.Duration(c.writeTimeout))
+	if err != nil {
+		return err
+	}
+
+	c.Log(logger.Info, "is reading from path '%s', %s",
+		path.Name(), defs.FormatsInfo(stream.ReaderFormats(c)))
+
+	onUnreadHook := hooks.OnRead(hooks.OnReadParams{
+		Logger:          c,
+		ExternalCmdPool: c.externalCmdPool,
+		Conf:            path.SafeConf(),
+		ExternalCmdEnv:  path.ExternalCmdEnv(),
+		Reader:          c.APIReaderDescribe(),
+		Query:           c.query,
+	})
+	defer onUnreadHook()
+
+	stream.StartReader(c)
+	defer stream.RemoveReader(c)
+
+	select {
+	case <-c.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case <-clientGone:
+		return fmt.Errorf("client disconnected")
+
+	case err := <-stream.ReaderError(c):
+		return err
+	}
+}
+
+// APIReaderDescribe implements reader.
+func (c *conn) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "httpflvConn",
+		ID:   c.uuid.String(),
+	}
+}
+
+func (c *conn) apiItem() *defs.APIHTTPFLVConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	bytesSent := uint64(0)
+
+	if c.fconn != nil {
+		bytesSent = c.fconn.BytesSent()
+	}
+
+	return &defs.APIHTTPFLVConn{
+		ID:         c.uuid,
+		Created:    c.created,
+		RemoteAddr: c.remoteAddr,
+		WebSocket:  c.webSocket,
+		Path:       c.pathName,
+		Query:      c.query,
+		BytesSent:  bytesSent,
+	}
+}
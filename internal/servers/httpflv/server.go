@@ -0,0 +1,313 @@
+// Package httpflv contains a HTTP-FLV server.
+package httpflv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+// ErrConnNotFound is returned when a connection is not found.
+var ErrConnNotFound = errors.New("connection not found")
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+type serverAPIConnsListRes struct {
+	data *defs.APIHTTPFLVConnList
+	err  error
+}
+
+type serverAPIConnsListReq struct {
+	res chan serverAPIConnsListRes
+}
+
+type serverAPIConnsGetRes struct {
+	data *defs.APIHTTPFLVConn
+	err  error
+}
+
+type serverAPIConnsGetReq struct {
+	uuid uuid.UUID
+	res  chan serverAPIConnsGetRes
+}
+
+type serverAPIConnsKickRes struct {
+	err error
+}
+
+type serverAPIConnsKickReq struct {
+	uuid uuid.UUID
+	res  chan serverAPIConnsKickRes
+}
+
+type serverNewConnReq struct {
+	pathName  string
+	webSocket bool
+	ginCtx    *gin.Context
+	res       chan *conn
+}
+
+type serverMetrics interface {
+	SetHTTPFLVServer(defs.APIHTTPFLVServer)
+}
+
+type serverPathManager interface {
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a HTTP-FLV server.
+type Server struct {
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	WriteTimeout       conf.Duration
+	ExternalCmdPool    *externalcmd.Pool
+	Metrics            serverMetrics
+	PathManager        serverPathManager
+	Parent             serverParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	wg         sync.WaitGroup
+	httpServer *httpServer
+	conns      map[*conn]struct{}
+
+	// in
+	chNewConn      chan serverNewConnReq
+	chCloseConn    chan *conn
+	chAPIConnsList chan serverAPIConnsListReq
+	chAPIConnsGet  chan serverAPIConnsGetReq
+	chAPIConnsKick chan serverAPIConnsKickReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.conns = make(map[*conn]struct{})
+	s.chNewConn = make(chan serverNewConnReq)
+	s.chCloseConn = make(chan *conn)
+	s.chAPIConnsList = make(chan serverAPIConnsListReq)
+	s.chAPIConnsGet = make(chan serverAPIConnsGetReq)
+	s.chAPIConnsKick = make(chan serverAPIConnsKickReq)
+
+	s.httpServer = &httpServer{
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		readTimeout:        s.ReadTimeout,
+		parent:             s,
+	}
+	err := s.httpServer.initialize()
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on "+s.Address)
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetHTTPFLVServer(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[HTTP-FLV] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetHTTPFLVServer(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		select {
+		case req := <-s.chNewConn:
+			c := &conn{
+				parentCtx:       s.ctx,
+				writeTimeout:    s.WriteTimeout,
+				pathName:        req.pathName,
+				webSocket:       req.webSocket,
+				ginCtx:          req.ginCtx,
+				wg:              &s.wg,
+				externalCmdPool: s.ExternalCmdPool,
+				pathManager:     s.PathManager,
+				parent:          s,
+			}
+			c.initialize()
+			s.conns[c] = struct{}{}
+			req.res <- c
+
+		case c := <-s.chCloseConn:
+			delete(s.conns, c)
+
+		case req := <-s.chAPIConnsList:
+			data := &defs.APIHTTPFLVConnList{
+				Items: []*defs.APIHTTPFLVConn{},
+			}
+
+			for c := range s.conns {
+				data.Items = append(data.Items, c.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPIConnsListRes{data: data}
+
+		case req := <-s.chAPIConnsGet:
+			c := s.findConnByUUID(req.uuid)
+			if c == nil {
+				req.res <- serverAPIConnsGetRes{err: ErrConnNotFound}
+				continue
+			}
+
+			req.res <- serverAPIConnsGetRes{data: c.apiItem()}
+
+		case req := <-s.chAPIConnsKick:
+			c := s.findConnByUUID(req.uuid)
+			if c == nil {
+				req.res <- serverAPIConnsKickRes{err: ErrConnNotFound}
+				continue
+			}
+
+			delete(s.conns, c)
+			c.Close()
+			req.res <- serverAPIConnsKickRes{}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	s.httpServer.close()
+}
+
+func (s *Server) findConnByUUID(uuid uuid.UUID) *conn {
+	for c := range s.conns {
+		if c.uuid == uuid {
+			return c
+		}
+	}
+	return nil
+}
+
+// newConn is called by httpServer.
+func (s *Server) newConn(req serverNewConnReq) *conn {
+	req.res = make(chan *conn)
+
+	select {
+	case s.chNewConn <- req:
+		return <-req.res
+
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+// closeConn is called by conn.
+func (s *Server) closeConn(c *conn) {
+	select {
+	case s.chCloseConn <- c:
+	case <-s.ctx.Done():
+	}
+}
+
+// APIConnsList is called by api.
+func (s *Server) APIConnsList() (*defs.APIHTTPFLVConnList, error) {
+	req := serverAPIConnsListReq{
+		res: make(chan serverAPIConnsListRes),
+	}
+
+	select {
+	case s.chAPIConnsList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIConnsGet is called by api.
+func (s *Server) APIConnsGet(uuid uuid.UUID) (*defs.APIHTTPFLVConn, error) {
+	req := serverAPIConnsGetReq{
+		uuid: uuid,
+		res:  make(chan serverAPIConnsGetRes),
+	}
+
+	select {
+	case s.chAPIConnsGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIConnsKick is called by api.
+func (s *Server) APIConnsKick(uuid uuid.UUID) error {
+	req := serverAPIConnsKickReq{
+		uuid: uuid,
+		res:  make(chan serverAPIConnsKickRes),
+	}
+
+	select {
+	case s.chAPIConnsKick <- req:
+		res := <-req.res
+		return res.err
+
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
@@ -0,0 +1,304 @@
+package mjpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/hooks"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	boundary = "mjpegframe"
+)
+
+func writeError(ctx *gin.Context, statusCode int, err error) {
+	ctx.JSON(statusCode, &defs.APIError{
+		Error: err.Error(),
+	})
+}
+
+type conn struct {
+	parentCtx       context.Context
+	readTimeout     conf.Duration
+	writeTimeout    conf.Duration
+	pathName        string
+	snapshot        bool
+	ginCtx          *gin.Context
+	wg              *sync.WaitGroup
+	externalCmdPool *externalcmd.Pool
+	pathManager     serverPathManager
+	parent          *Server
+
+	ctx        context.Context
+	ctxCancel  func()
+	uuid       uuid.UUID
+	remoteAddr string
+	query      string
+}
+
+func (c *conn) initialize() {
+	c.ctx, c.ctxCancel = context.WithCancel(c.parentCtx)
+
+	c.uuid = uuid.New()
+	c.remoteAddr = httpp.RemoteAddr(c.ginCtx)
+	c.query = c.ginCtx.Request.URL.RawQuery
+
+	c.Log(c.logLevel(), "opened")
+
+	c.wg.Add(1)
+}
+
+// Close closes the connection.
+func (c *conn) Close() {
+	c.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (c *conn) Log(level logger.Level, format string, args ...interface{}) {
+	c.parent.Log(level, "[conn %v] "+format, append([]interface{}{c.remoteAddr}, args...)...)
+}
+
+// snapshots are requested frequently by dashboards, therefore they are logged
+// with a lower level in order not to flood logs.
+func (c *conn) logLevel() logger.Level {
+	if c.snapshot {
+		return logger.Debug
+	}
+	return logger.Info
+}
+
+// run is called by the HTTP handler and returns when the connection is closed.
+func (c *conn) run() {
+	defer c.wg.Done()
+
+	err := c.runInner()
+
+	c.ctxCancel()
+
+	c.Log(c.logLevel(), "closed: %v", err)
+}
+
+func (c *conn) runInner() error {
+	path, strm, err := c.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: c,
+		AccessRequest: defs.PathAccessRequest{
+			Name:        c.pathName,
+			Query:       c.query,
+			Proto:       auth.ProtocolMJPEG,
+			ID:          &c.uuid,
+			Credentials: httpp.Credentials(c.ginCtx.Request),
+			IP:          net.ParseIP(c.ginCtx.ClientIP()),
+		},
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			if terr.AskCredentials {
+				c.ginCtx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				c.ginCtx.Writer.WriteHeader(http.StatusUnauthorized)
+				return terr
+			}
+
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			writeError(c.ginCtx, http.StatusUnauthorized, terr)
+			return terr
+		}
+
+		var terr2 defs.PathNoStreamAvailableError
+		if errors.As(err, &terr2) {
+			writeError(c.ginCtx, http.StatusNotFound, err)
+			return err
+		}
+
+		writeError(c.ginCtx, http.StatusBadRequest, err)
+		return err
+	}
+
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: c})
+
+	var forma *format.MJPEG
+	medi := strm.Desc.FindFormat(&forma)
+	if medi == nil {
+		err = fmt.Errorf("the stream doesn't contain a M-JPEG track")
+		writeError(c.ginCtx, http.StatusNotFound, err)
+		return err
+	}
+
+	if c.snapshot {
+		return c.runSnapshot(path, strm, medi, forma)
+	}
+
+	return c.runStream(path, strm, medi, forma)
+}
+
+func (c *conn) runSnapshot(
+	path defs.Path,
+	strm *stream.Stream,
+	medi *description.Media,
+	forma *format.MJPEG,
+) error {
+	frameRecv := make(chan []byte, 1)
+
+	strm.AddReader(c, medi, forma, func(u unit.Unit) error {
+		tunit := u.(*unit.MJPEG)
+		if tunit.Frame == nil {
+			return nil
+		}
+
+		select {
+		case frameRecv <- tunit.Frame:
+		default:
+		}
+
+		return nil
+	})
+
+	onUnreadHook := c.onRead(path)
+	defer onUnreadHook()
+
+	strm.StartReader(c)
+	defer strm.RemoveReader(c)
+
+	select {
+	case frame := <-frameRecv:
+		c.ginCtx.Header("Content-Type", "image/jpeg")
+		c.ginCtx.Header("Content-Length", strconv.FormatInt(int64(len(frame)), 10))
+		c.ginCtx.Header("Cache-Control", "no-cache")
+		c.ginCtx.Writer.WriteHeader(http.StatusOK)
+
+		http.NewResponseController(c.ginCtx.Writer).SetWriteDeadline( //nolint:errcheck
+			time.Now().Add(time.Duration(c.writeTimeout)))
+
+		_, err := c.ginCtx.Writer.Write(frame)
+		return err
+
+	case <-time.After(time.Duration(c.readTimeout)):
+		err := fmt.Errorf("no frames received")
+		writeError(c.ginCtx, http.StatusGatewayTimeout, err)
+		return err
+
+	case <-c.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case <-c.ginCtx.Request.Context().Done():
+		return fmt.Errorf("client disconnected")
+
+	case err := <-strm.ReaderError(c):
+		return err
+	}
+}
+
+func (c *conn) runStream(
+	path defs.Path,
+	strm *stream.Stream,
+	medi *description.Media,
+	forma *format.MJPEG,
+) error {
+	c.ginCtx.Header("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	c.ginCtx.Header("Cache-Control", "no-cache")
+	c.ginCtx.Writer.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(c.ginCtx.Writer)
+
+	rc.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout))) //nolint:errcheck
+
+	_, err := c.ginCtx.Writer.Write([]byte("--" + boundary + "\r\n"))
+	if err != nil {
+		return err
+	}
+
+	err = rc.Flush()
+	if err != nil {
+		return err
+	}
+
+	strm.AddReader(c, medi, forma, func(u unit.Unit) error {
+		tunit := u.(*unit.MJPEG)
+		if tunit.Frame == nil {
+			return nil
+		}
+
+		rc.SetWriteDeadline(time.Now().Add(time.Duration(c.writeTimeout))) //nolint:errcheck
+
+		_, err := c.ginCtx.Writer.Write([]byte("Content-Type: image/jpeg\r\n" +
+			"Content-Length: " + strconv.FormatInt(int64(len(tunit.Frame)), 10) + "\r\n" +
+			"\r\n"))
+		if err != nil {
+			return err
+		}
+
+		_, err = c.ginCtx.Writer.Write(tunit.Frame)
+		if err != nil {
+			return err
+		}
+
+		// write the boundary immediately after the frame, in order to allow
+		// clients to display the frame without waiting for the next one.
+		_, err = c.ginCtx.Writer.Write([]byte("\r\n--" + boundary + "\r\n"))
+		if err != nil {
+			return err
+		}
+
+		return rc.Flush()
+	})
+
+	c.Log(logger.Info, "is reading from path '%s', %s",
+		path.Name(), defs.FormatsInfo(strm.ReaderFormats(c)))
+
+	onUnreadHook := c.onRead(path)
+	defer onUnreadHook()
+
+	strm.StartReader(c)
+	defer strm.RemoveReader(c)
+
+	select {
+	case <-c.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case <-c.ginCtx.Request.Context().Done():
+		return fmt.Errorf("client disconnected")
+
+	case err := <-strm.ReaderError(c):
+		return err
+	}
+}
+
+func (c *conn) onRead(path defs.Path) func() {
+	return hooks.OnRead(hooks.OnReadParams{
+		Logger:          c,
+		ExternalCmdPool: c.externalCmdPool,
+		Conf:            path.SafeConf(),
+		ExternalCmdEnv:  path.ExternalCmdEnv(),
+		Reader:          c.APIReaderDescribe(),
+		Query:           c.query,
+	})
+}
+
+// APIReaderDescribe implements reader.
+func (c *conn) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "mjpegConn",
+		ID:   c.uuid.String(),
+	}
+}
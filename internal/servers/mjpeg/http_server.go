@@ -0,0 +1,118 @@
+package mjpeg
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+const (
+	streamSuffix   = "/stream.mjpg"
+	snapshotSuffix = "/snapshot.jpg"
+)
+
+type httpServer struct {
+	address            string
+	encryption         bool
+	serverKey          string
+	serverCert         string
+	clientCA           string
+	clientCertRequired bool
+	allowOrigin        string
+	trustedProxies     conf.IPNetworks
+	readTimeout        conf.Duration
+	parent             *Server
+
+	inner *httpp.Server
+}
+
+func (s *httpServer) initialize() error {
+	router := gin.New()
+	router.SetTrustedProxies(s.trustedProxies.ToTrustedProxies()) //nolint:errcheck
+
+	router.Use(s.middlewareOrigin)
+
+	router.Use(s.onRequest)
+
+	network, address := restrictnetwork.Restrict("tcp", s.address)
+
+	s.inner = &httpp.Server{
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(s.readTimeout),
+		Encryption:         s.encryption,
+		ServerCert:         s.serverCert,
+		ServerKey:          s.serverKey,
+		ClientCA:           s.clientCA,
+		ClientCertRequired: s.clientCertRequired,
+		Handler:            router,
+		Parent:             s,
+	}
+	err := s.inner.Initialize()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *httpServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, format, args...)
+}
+
+func (s *httpServer) close() {
+	s.inner.Close()
+}
+
+func (s *httpServer) middlewareOrigin(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", s.allowOrigin)
+	ctx.Header("Access-Control-Allow-Credentials", "true")
+
+	// preflight requests
+	if ctx.Request.Method == http.MethodOptions &&
+		ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
+		ctx.Header("Access-Control-Allow-Methods", "OPTIONS, GET")
+		ctx.Header("Access-Control-Allow-Headers", "Authorization")
+		ctx.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+}
+
+func (s *httpServer) onRequest(ctx *gin.Context) {
+	if ctx.Request.Method != http.MethodGet {
+		return
+	}
+
+	pth := ctx.Request.URL.Path
+
+	var suffix string
+	var snapshot bool
+
+	switch {
+	case strings.HasSuffix(pth, streamSuffix):
+		suffix = streamSuffix
+
+	case strings.HasSuffix(pth, snapshotSuffix):
+		suffix = snapshotSuffix
+		snapshot = true
+
+	default:
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(pth) <= len(suffix)+1 {
+		ctx.Writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.parent.handleRequest(ctx, pth[1:len(pth)-len(suffix)], snapshot)
+}
@@ -0,0 +1,104 @@
+// Package mjpeg contains a HTTP M-JPEG server.
+package mjpeg
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+type serverPathManager interface {
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a HTTP M-JPEG server.
+type Server struct {
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	WriteTimeout       conf.Duration
+	ExternalCmdPool    *externalcmd.Pool
+	PathManager        serverPathManager
+	Parent             serverParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	wg         sync.WaitGroup
+	httpServer *httpServer
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.httpServer = &httpServer{
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		readTimeout:        s.ReadTimeout,
+		parent:             s,
+	}
+	err := s.httpServer.initialize()
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on "+s.Address)
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[MJPEG] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	s.ctxCancel()
+	s.httpServer.close()
+	s.wg.Wait()
+}
+
+// handleRequest is called by httpServer.
+func (s *Server) handleRequest(ctx *gin.Context, pathName string, snapshot bool) {
+	c := &conn{
+		parentCtx:       s.ctx,
+		readTimeout:     s.ReadTimeout,
+		writeTimeout:    s.WriteTimeout,
+		pathName:        pathName,
+		snapshot:        snapshot,
+		ginCtx:          ctx,
+		wg:              &s.wg,
+		externalCmdPool: s.ExternalCmdPool,
+		pathManager:     s.PathManager,
+		parent:          s,
+	}
+	c.initialize()
+	c.run()
+}
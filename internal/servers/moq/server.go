@@ -0,0 +1,311 @@
+// Package moq contains a Media over QUIC (MoQ) server.
+package moq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+// ErrSessionNotFound is returned when a session is not found.
+var ErrSessionNotFound = errors.New("session not found")
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+type serverAPISessionsListRes struct {
+	data *defs.APIMoQSessionList
+	err  error
+}
+
+type serverAPISessionsListReq struct {
+	res chan serverAPISessionsListRes
+}
+
+type serverAPISessionsGetRes struct {
+	data *defs.APIMoQSession
+	err  error
+}
+
+type serverAPISessionsGetReq struct {
+	uuid uuid.UUID
+	res  chan serverAPISessionsGetRes
+}
+
+type serverAPISessionsKickRes struct {
+	err error
+}
+
+type serverAPISessionsKickReq struct {
+	uuid uuid.UUID
+	res  chan serverAPISessionsKickRes
+}
+
+type serverNewSessionReq struct {
+	pathName string
+	w        http.ResponseWriter
+	r        *http.Request
+	res      chan *session
+}
+
+type serverMetrics interface {
+	SetMoQServer(defs.APIMoQServer)
+}
+
+type serverPathManager interface {
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a MoQ server.
+type Server struct {
+	Address            string
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	ReadTimeout        conf.Duration
+	WriteTimeout       conf.Duration
+	ExternalCmdPool    *externalcmd.Pool
+	Metrics            serverMetrics
+	PathManager        serverPathManager
+	Parent             serverParent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+	wtServer  *wtServer
+	sessions  map[*session]struct{}
+
+	// in
+	chNewSession      chan serverNewSessionReq
+	chCloseSession    chan *session
+	chAPISessionsList chan serverAPISessionsListReq
+	chAPISessionsGet  chan serverAPISessionsGetReq
+	chAPISessionsKick chan serverAPISessionsKickReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.sessions = make(map[*session]struct{})
+	s.chNewSession = make(chan serverNewSessionReq)
+	s.chCloseSession = make(chan *session)
+	s.chAPISessionsList = make(chan serverAPISessionsListReq)
+	s.chAPISessionsGet = make(chan serverAPISessionsGetReq)
+	s.chAPISessionsKick = make(chan serverAPISessionsKickReq)
+
+	s.wtServer = &wtServer{
+		address:            s.Address,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		readTimeout:        s.ReadTimeout,
+		parent:             s,
+	}
+	err := s.wtServer.initialize()
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on "+s.Address+" (UDP/WebTransport)")
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetMoQServer(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[MoQ] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetMoQServer(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		select {
+		case req := <-s.chNewSession:
+			se := &session{
+				parentCtx:       s.ctx,
+				pathName:        req.pathName,
+				readTimeout:     s.ReadTimeout,
+				writeTimeout:    s.WriteTimeout,
+				w:               req.w,
+				r:               req.r,
+				upgrader:        s.wtServer.inner,
+				wg:              &s.wg,
+				externalCmdPool: s.ExternalCmdPool,
+				pathManager:     s.PathManager,
+				parent:          s,
+			}
+			se.initialize()
+			s.sessions[se] = struct{}{}
+			req.res <- se
+
+		case se := <-s.chCloseSession:
+			delete(s.sessions, se)
+
+		case req := <-s.chAPISessionsList:
+			data := &defs.APIMoQSessionList{
+				Items: []*defs.APIMoQSession{},
+			}
+
+			for se := range s.sessions {
+				data.Items = append(data.Items, se.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPISessionsListRes{data: data}
+
+		case req := <-s.chAPISessionsGet:
+			se := s.findSessionByUUID(req.uuid)
+			if se == nil {
+				req.res <- serverAPISessionsGetRes{err: ErrSessionNotFound}
+				continue
+			}
+
+			req.res <- serverAPISessionsGetRes{data: se.apiItem()}
+
+		case req := <-s.chAPISessionsKick:
+			se := s.findSessionByUUID(req.uuid)
+			if se == nil {
+				req.res <- serverAPISessionsKickRes{err: ErrSessionNotFound}
+				continue
+			}
+
+			delete(s.sessions, se)
+			se.Close()
+			req.res <- serverAPISessionsKickRes{}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	s.wtServer.close()
+}
+
+func (s *Server) findSessionByUUID(uuid uuid.UUID) *session {
+	for se := range s.sessions {
+		if se.uuid == uuid {
+			return se
+		}
+	}
+	return nil
+}
+
+// newSession is called by wtServer.
+func (s *Server) newSession(req serverNewSessionReq) *session {
+	req.res = make(chan *session)
+
+	select {
+	case s.chNewSession <- req:
+		return <-req.res
+
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+// closeSession is called by session.
+func (s *Server) closeSession(se *session) {
+	select {
+	case s.chCloseSession <- se:
+	case <-s.ctx.Done():
+	}
+}
+
+// APISessionsList is called by api.
+func (s *Server) APISessionsList() (*defs.APIMoQSessionList, error) {
+	req := serverAPISessionsListReq{
+		res: make(chan serverAPISessionsListRes),
+	}
+
+	select {
+	case s.chAPISessionsList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APISessionsGet is called by api.
+func (s *Server) APISessionsGet(uuid uuid.UUID) (*defs.APIMoQSession, error) {
+	req := serverAPISessionsGetReq{
+		uuid: uuid,
+		res:  make(chan serverAPISessionsGetRes),
+	}
+
+	select {
+	case s.chAPISessionsGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APISessionsKick is called by api.
+func (s *Server) APISessionsKick(uuid uuid.UUID) error {
+	req := serverAPISessionsKickReq{
+		uuid: uuid,
+		res:  make(chan serverAPISessionsKickRes),
+	}
+
+	select {
+	case s.chAPISessionsKick <- req:
+		res := <-req.res
+		return res.err
+
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
@@ -0,0 +1,294 @@
+package moq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mp4"
+	"github.com/quic-go/webtransport-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/protocols/moq"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type dummyPath struct{}
+
+func (pa *dummyPath) Name() string {
+	return "teststream"
+}
+
+func (pa *dummyPath) SafeConf() *conf.Path {
+	return &conf.Path{}
+}
+
+func (pa *dummyPath) ExternalCmdEnv() externalcmd.Environment {
+	return nil
+}
+
+func (pa *dummyPath) StartPublisher(_ defs.PathStartPublisherReq) (*stream.Stream, error) {
+	return nil, fmt.Errorf("unimplemented")
+}
+
+func (pa *dummyPath) StopPublisher(_ defs.PathStopPublisherReq) {
+}
+
+func (pa *dummyPath) RemovePublisher(_ defs.PathRemovePublisherReq) {
+}
+
+func (pa *dummyPath) RemoveReader(_ defs.PathRemoveReaderReq) {
+}
+
+type dummyPathManager struct {
+	addReaderImpl func(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+func (pm *dummyPathManager) AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error) {
+	return pm.addReaderImpl(req)
+}
+
+func readGroup(t *testing.T, sess *webtransport.Session) (moq.SubgroupHeader, *bufio.Reader) {
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+
+	str, err := sess.AcceptUniStream(ctx)
+	require.NoError(t, err)
+
+	r := bufio.NewReader(str)
+
+	var h moq.SubgroupHeader
+	err = h.Read(r)
+	require.NoError(t, err)
+
+	return h, r
+}
+
+func TestServerRead(t *testing.T) {
+	serverCertFpath, err := test.CreateTempFile(test.TLSCertPub)
+	require.NoError(t, err)
+	defer os.Remove(serverCertFpath)
+
+	serverKeyFpath, err := test.CreateTempFile(test.TLSCertKey)
+	require.NoError(t, err)
+	defer os.Remove(serverKeyFpath)
+
+	desc := &description.Session{Medias: []*description.Media{test.MediaH264}}
+
+	strm := &stream.Stream{
+		WriteQueueSize:     512,
+		UDPMaxPayloadSize:  1472,
+		Desc:               desc,
+		GenerateRTPPackets: true,
+		Parent:             test.NilLogger,
+	}
+	err = strm.Initialize()
+	require.NoError(t, err)
+	defer strm.Close()
+
+	s := &Server{
+		Address:      "127.0.0.1:8895",
+		ServerKey:    serverKeyFpath,
+		ServerCert:   serverCertFpath,
+		AllowOrigin:  "*",
+		ReadTimeout:  conf.Duration(10 * time.Second),
+		WriteTimeout: conf.Duration(10 * time.Second),
+		PathManager: &dummyPathManager{
+			addReaderImpl: func(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error) {
+				require.Equal(t, "teststream", req.AccessRequest.Name)
+				require.Equal(t, "user=myuser&pass=mypass&param=value", req.AccessRequest.Query)
+				require.Equal(t, "myuser", req.AccessRequest.Credentials.User)
+				require.Equal(t, "mypass", req.AccessRequest.Credentials.Pass)
+				return &dummyPath{}, strm, nil
+			},
+		},
+		Parent: test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	d := &webtransport.Dialer{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	defer d.Close()
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+
+	res, sess, err := d.Dial(ctx, "https://127.0.0.1:8895/teststream?user=myuser&pass=mypass&param=value", nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	defer sess.CloseWithError(0, "") //nolint:errcheck
+
+	control, err := sess.OpenStreamSync(ctx)
+	require.NoError(t, err)
+
+	cr := bufio.NewReader(control)
+
+	cs := &moq.ClientSetup{
+		SupportedVersions: []uint64{moq.Version},
+		Parameters:        moq.Parameters{},
+	}
+	cs.Parameters.SetVarint(moq.SetupParameterRole, moq.RoleSubscriber)
+	err = moq.WriteMessage(control, cs)
+	require.NoError(t, err)
+
+	msg, err := moq.ReadMessage(cr)
+	require.NoError(t, err)
+	require.Equal(t, uint64(moq.Version), msg.(*moq.ServerSetup).SelectedVersion)
+
+	for i, name := range []string{moq.CatalogTrackName, "video1", "missing"} {
+		err = moq.WriteMessage(control, &moq.Subscribe{
+			SubscribeID:    uint64(i),
+			TrackAlias:     uint64(i),
+			TrackNamespace: []string{"teststream"},
+			TrackName:      name,
+			FilterType:     moq.FilterLatestGroup,
+		})
+		require.NoError(t, err)
+
+		msg, err = moq.ReadMessage(cr)
+		require.NoError(t, err)
+
+		if name == "missing" {
+			require.Equal(t, &moq.SubscribeError{
+				SubscribeID:  2,
+				ErrorCode:    moq.SubscribeErrorInternal,
+				ReasonPhrase: "track not found",
+				TrackAlias:   2,
+			}, msg)
+		} else {
+			require.Equal(t, &moq.SubscribeOK{
+				SubscribeID: uint64(i),
+				GroupOrder:  moq.GroupOrderAscending,
+			}, msg)
+		}
+	}
+
+	go func() {
+		strm.WaitRunningReader()
+
+		for i := 0; i < 4; i++ {
+			nalu := []byte{5, 1} // IDR
+			if (i % 2) != 0 {
+				nalu = []byte{1, 2} // non-IDR
+			}
+
+			strm.WriteUnit(test.MediaH264, test.FormatH264, &unit.H264{
+				Base: unit.Base{
+					PTS: int64(i) * 90000,
+				},
+				AU: [][]byte{nalu},
+			})
+		}
+	}()
+
+	// streams are not guaranteed to be accepted in the order they are opened.
+	type groupKey struct {
+		trackAlias uint64
+		groupID    uint64
+	}
+	groups := make(map[groupKey]*bufio.Reader)
+
+	for range 3 {
+		h, r := readGroup(t, sess)
+		require.Equal(t, uint64(0), h.SubgroupID)
+		require.Equal(t, h.SubscribeID, h.TrackAlias)
+		if h.TrackAlias == 0 {
+			require.Equal(t, uint8(catalogPriority), h.PublisherPriority)
+		} else {
+			require.Equal(t, uint8(videoPriority), h.PublisherPriority)
+		}
+		groups[groupKey{h.TrackAlias, h.GroupID}] = r
+	}
+
+	// catalog
+
+	r, ok := groups[groupKey{0, 0}]
+	require.True(t, ok)
+
+	var obj moq.Object
+	err = obj.Read(r)
+	require.NoError(t, err)
+
+	var catalog moq.Catalog
+	err = json.Unmarshal(obj.Payload, &catalog)
+	require.NoError(t, err)
+	require.Equal(t, "teststream", catalog.CommonTrackFields.Namespace)
+	require.Len(t, catalog.Tracks, 1)
+	require.Equal(t, "video1", catalog.Tracks[0].Name)
+	require.Equal(t, moq.CatalogSelectionParams{
+		Codec:    "avc1.42c028",
+		MimeType: "video/mp4",
+	}, catalog.Tracks[0].SelectionParams)
+
+	initData, err := base64.StdEncoding.DecodeString(catalog.Tracks[0].InitData)
+	require.NoError(t, err)
+
+	var init fmp4.Init
+	err = init.Unmarshal(bytes.NewReader(initData))
+	require.NoError(t, err)
+	require.Equal(t, []*fmp4.InitTrack{{
+		ID:        1,
+		TimeScale: 90000,
+		Codec: &mp4.CodecH264{
+			SPS: test.FormatH264.SPS,
+			PPS: test.FormatH264.PPS,
+		},
+	}}, init.Tracks)
+
+	// first GOP
+
+	r, ok = groups[groupKey{1, 0}]
+	require.True(t, ok)
+
+	for i := uint64(0); i < 2; i++ {
+		err = obj.Read(r)
+		require.NoError(t, err)
+		require.Equal(t, i, obj.ID)
+
+		var parts fmp4.Parts
+		err = parts.Unmarshal(obj.Payload)
+		require.NoError(t, err)
+		require.Len(t, parts, 1)
+		require.Equal(t, uint64(i*90000), parts[0].Tracks[0].BaseTime)
+		require.Equal(t, i != 0, parts[0].Tracks[0].Samples[0].IsNonSyncSample)
+	}
+
+	// second GOP
+
+	r, ok = groups[groupKey{1, 1}]
+	require.True(t, ok)
+
+	err = obj.Read(r)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), obj.ID)
+
+	list, err := s.APISessionsList()
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+	require.Equal(t, "teststream", list.Items[0].Path)
+	require.Equal(t, "user=myuser&pass=mypass&param=value", list.Items[0].Query)
+	require.NotZero(t, list.Items[0].BytesSent)
+
+	err = s.APISessionsKick(list.Items[0].ID)
+	require.NoError(t, err)
+
+	_, err = moq.ReadMessage(cr)
+	require.Error(t, err)
+}
@@ -0,0 +1,698 @@
+package moq
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mcfmp4 "github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
+	"github.com/google/uuid"
+	"github.com/quic-go/webtransport-go"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/hooks"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mfmp4 "github.com/bluenviron/mediamtx/internal/protocols/fmp4"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/protocols/moq"
+)
+
+const (
+	catalogPriority = 0
+	audioPriority   = 1
+	videoPriority   = 2
+)
+
+type sessionSubscription struct {
+	subscribeID uint64
+	trackAlias  uint64
+
+	// subgroup stream of the current group
+	stream   *webtransport.SendStream
+	objectID uint64
+}
+
+type sessionTrack struct {
+	name           string
+	track          *mfmp4.Track
+	timeline       *mfmp4.TimelineTrack
+	sequenceNumber uint32
+	nextGroupID    uint64
+	sub            *sessionSubscription
+}
+
+func (t *sessionTrack) isVideo() bool {
+	return t.track.InitTrack.Codec.IsVideo()
+}
+
+type session struct {
+	parentCtx       context.Context
+	readTimeout     conf.Duration
+	writeTimeout    conf.Duration
+	pathName        string
+	w               http.ResponseWriter
+	r               *http.Request
+	upgrader        *webtransport.Server
+	wg              *sync.WaitGroup
+	externalCmdPool *externalcmd.Pool
+	pathManager     serverPathManager
+	parent          *Server
+
+	ctx        context.Context
+	ctxCancel  func()
+	uuid       uuid.UUID
+	created    time.Time
+	remoteAddr string
+	query      string
+	bytesSent  *uint64
+
+	wsess         *webtransport.Session
+	control       *webtransport.Stream
+	controlReader *bufio.Reader
+
+	// reader and control routines
+	mutex              sync.Mutex
+	tracks             []*sessionTrack
+	trackMap           map[*mfmp4.Track]*sessionTrack
+	timeline           mfmp4.Timeline
+	catalogSub         *sessionSubscription
+	catalogNeeded      bool
+	catalogNextGroupID uint64
+}
+
+func (se *session) initialize() {
+	se.ctx, se.ctxCancel = context.WithCancel(se.parentCtx)
+
+	se.uuid = uuid.New()
+	se.created = time.Now()
+	se.remoteAddr = se.r.RemoteAddr
+	se.query = se.r.URL.RawQuery
+	se.bytesSent = new(uint64)
+
+	se.Log(logger.Info, "created by %s", se.remoteAddr)
+
+	se.wg.Add(1)
+}
+
+// Close closes the session.
+func (se *session) Close() {
+	se.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (se *session) Log(level logger.Level, format string, args ...interface{}) {
+	id := hex.EncodeToString(se.uuid[:4])
+	se.parent.Log(level, "[session %v] "+format, append([]interface{}{id}, args...)...)
+}
+
+// run is called by the HTTP/3 handler and returns when the session is closed.
+func (se *session) run() {
+	defer se.wg.Done()
+
+	err := se.runInner()
+
+	se.ctxCancel()
+
+	se.parent.closeSession(se)
+
+	se.Log(logger.Info, "closed: %v", err)
+}
+
+// browsers are not able to set headers of WebTransport requests,
+// therefore credentials can be passed in the query too.
+func (se *session) credentials() *auth.Credentials {
+	c := httpp.Credentials(se.r)
+
+	if c.User == "" && c.Token == "" {
+		q := se.r.URL.Query()
+		c.User = q.Get("user")
+		c.Pass = q.Get("pass")
+	}
+
+	return c
+}
+
+func (se *session) runInner() error {
+	host, _, _ := net.SplitHostPort(se.remoteAddr)
+
+	path, strm, err := se.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: se,
+		AccessRequest: defs.PathAccessRequest{
+			Name:        se.pathName,
+			Query:       se.query,
+			Proto:       auth.ProtocolMoQ,
+			ID:          &se.uuid,
+			Credentials: se.credentials(),
+			IP:          net.ParseIP(host),
+		},
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			se.w.WriteHeader(http.StatusUnauthorized)
+			return terr
+		}
+
+		var terr2 defs.PathNoStreamAvailableError
+		if errors.As(err, &terr2) {
+			se.w.WriteHeader(http.StatusNotFound)
+			return err
+		}
+
+		se.w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: se})
+
+	se.trackMap = make(map[*mfmp4.Track]*sessionTrack)
+
+	tracks := mfmp4.FromStream(
+		strm,
+		se,
+		mfmp4.IsFormatSupported,
+		se.onCodecParams,
+		se.onSample,
+	)
+
+	if len(tracks) == 0 {
+		se.w.WriteHeader(http.StatusBadRequest)
+		return mfmp4.ErrNoSupportedCodecs
+	}
+
+	defer strm.RemoveReader(se)
+
+	for _, track := range tracks {
+		t := &sessionTrack{
+			track: track,
+			timeline: &mfmp4.TimelineTrack{
+				Timeline:  &se.timeline,
+				TimeScale: track.InitTrack.TimeScale,
+			},
+		}
+
+		if t.isVideo() {
+			t.name = "video" + strconv.FormatUint(uint64(track.InitTrack.ID), 10)
+		} else {
+			t.name = "audio" + strconv.FormatUint(uint64(track.InitTrack.ID), 10)
+		}
+
+		se.tracks = append(se.tracks, t)
+		se.trackMap[track] = t
+	}
+
+	se.catalogNeeded = true
+
+	se.wsess, err = se.upgrader.Upgrade(se.w, se.r)
+	if err != nil {
+		se.w.WriteHeader(http.StatusBadRequest)
+		return err
+	}
+
+	err = se.setup()
+	if err != nil {
+		se.wsess.CloseWithError(moq.TerminationProtocolViolation, err.Error()) //nolint:errcheck
+		return err
+	}
+
+	controlErr := make(chan error)
+	go func() {
+		controlErr <- se.runControl()
+	}()
+
+	se.Log(logger.Info, "is reading from path '%s', %s",
+		path.Name(), defs.FormatsInfo(strm.ReaderFormats(se)))
+
+	onUnreadHook := hooks.OnRead(hooks.OnReadParams{
+		Logger:          se,
+		ExternalCmdPool: se.externalCmdPool,
+		Conf:            path.SafeConf(),
+		ExternalCmdEnv:  path.ExternalCmdEnv(),
+		Reader:          se.APIReaderDescribe(),
+		Query:           se.query,
+	})
+	defer onUnreadHook()
+
+	strm.StartReader(se)
+
+	select {
+	case <-se.ctx.Done():
+		se.wsess.CloseWithError(moq.TerminationNoError, "terminated") //nolint:errcheck
+		<-controlErr
+		return fmt.Errorf("terminated")
+
+	case err = <-controlErr:
+		se.wsess.CloseWithError(moq.TerminationProtocolViolation, err.Error()) //nolint:errcheck
+		return err
+
+	case err = <-strm.ReaderError(se):
+		se.wsess.CloseWithError(moq.TerminationInternalError, err.Error()) //nolint:errcheck
+		<-controlErr
+		return err
+	}
+}
+
+// setup performs the setup handshake on the control stream.
+func (se *session) setup() error {
+	ctx, ctxCancel := context.WithTimeout(se.ctx, time.Duration(se.readTimeout))
+	defer ctxCancel()
+
+	var err error
+	se.control, err = se.wsess.AcceptStream(ctx)
+	if err != nil {
+		return fmt.Errorf("control stream not received: %w", err)
+	}
+
+	se.controlReader = bufio.NewReader(se.control)
+
+	se.control.SetReadDeadline(time.Now().Add(time.Duration(se.readTimeout)))
+	msg, err := moq.ReadMessage(se.controlReader)
+	if err != nil {
+		return err
+	}
+	se.control.SetReadDeadline(time.Time{})
+
+	cs, ok := msg.(*moq.ClientSetup)
+	if !ok {
+		return fmt.Errorf("expected CLIENT_SETUP, got %T", msg)
+	}
+
+	if !slices.Contains(cs.SupportedVersions, moq.Version) {
+		return fmt.Errorf("none of the proposed versions is supported")
+	}
+
+	if role, ok2 := cs.Parameters.Varint(moq.SetupParameterRole); ok2 && role == moq.RolePublisher {
+		return fmt.Errorf("publishing is not supported")
+	}
+
+	ss := &moq.ServerSetup{
+		SelectedVersion: moq.Version,
+		Parameters:      moq.Parameters{},
+	}
+	ss.Parameters.SetVarint(moq.SetupParameterRole, moq.RolePublisher)
+
+	return se.writeControl(ss)
+}
+
+func (se *session) writeControl(msg moq.Message) error {
+	se.control.SetWriteDeadline(time.Now().Add(time.Duration(se.writeTimeout)))
+	return moq.WriteMessage(se.control, msg)
+}
+
+func (se *session) runControl() error {
+	for {
+		msg, err := moq.ReadMessage(se.controlReader)
+		if err != nil {
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *moq.Subscribe:
+			err = se.onSubscribe(msg)
+
+		case *moq.Unsubscribe:
+			err = se.onUnsubscribe(msg)
+
+		case *moq.ClientSetup, *moq.ServerSetup:
+			err = fmt.Errorf("unexpected message: %T", msg)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// subscriptionTarget returns where the subscription to a track is stored.
+// It must be called with the mutex locked.
+func (se *session) subscriptionTarget(trackName string) (**sessionSubscription, bool) {
+	if trackName == moq.CatalogTrackName {
+		return &se.catalogSub, true
+	}
+
+	for _, t := range se.tracks {
+		if t.name == trackName {
+			return &t.sub, true
+		}
+	}
+
+	return nil, false
+}
+
+func (se *session) onSubscribe(msg *moq.Subscribe) error {
+	if strings.Join(msg.TrackNamespace, "/") != se.pathName {
+		return se.writeControl(&moq.SubscribeError{
+			SubscribeID:  msg.SubscribeID,
+			ErrorCode:    moq.SubscribeErrorInternal,
+			ReasonPhrase: "namespace not found",
+			TrackAlias:   msg.TrackAlias,
+		})
+	}
+
+	// objects are not cached, therefore delivery always starts from the next group.
+	if msg.FilterType != moq.FilterLatestGroup && msg.FilterType != moq.FilterLatestObject {
+		return se.writeControl(&moq.SubscribeError{
+			SubscribeID:  msg.SubscribeID,
+			ErrorCode:    moq.SubscribeErrorInvalidRange,
+			ReasonPhrase: "only LatestGroup and LatestObject filters are supported",
+			TrackAlias:   msg.TrackAlias,
+		})
+	}
+
+	se.mutex.Lock()
+	target, ok := se.subscriptionTarget(msg.TrackName)
+	alreadySubscribed := ok && *target != nil
+	se.mutex.Unlock()
+
+	if !ok {
+		return se.writeControl(&moq.SubscribeError{
+			SubscribeID:  msg.SubscribeID,
+			ErrorCode:    moq.SubscribeErrorInternal,
+			ReasonPhrase: "track not found",
+			TrackAlias:   msg.TrackAlias,
+		})
+	}
+
+	if alreadySubscribed {
+		return se.writeControl(&moq.SubscribeError{
+			SubscribeID:  msg.SubscribeID,
+			ErrorCode:    moq.SubscribeErrorInternal,
+			ReasonPhrase: "track is already subscribed",
+			TrackAlias:   msg.TrackAlias,
+		})
+	}
+
+	err := se.writeControl(&moq.SubscribeOK{
+		SubscribeID: msg.SubscribeID,
+		GroupOrder:  moq.GroupOrderAscending,
+	})
+	if err != nil {
+		return err
+	}
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	*target = &sessionSubscription{
+		subscribeID: msg.SubscribeID,
+		trackAlias:  msg.TrackAlias,
+	}
+
+	if msg.TrackName == moq.CatalogTrackName {
+		se.catalogNeeded = true
+	}
+
+	return nil
+}
+
+func (se *session) onUnsubscribe(msg *moq.Unsubscribe) error {
+	found := false
+
+	se.mutex.Lock()
+
+	if se.catalogSub != nil && se.catalogSub.subscribeID == msg.SubscribeID {
+		se.catalogSub = nil
+		found = true
+	} else {
+		for _, t := range se.tracks {
+			if t.sub != nil && t.sub.subscribeID == msg.SubscribeID {
+				if t.sub.stream != nil {
+					t.sub.stream.Close()
+				}
+				t.sub = nil
+				found = true
+				break
+			}
+		}
+	}
+
+	se.mutex.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	return se.writeControl(&moq.SubscribeDone{
+		SubscribeID: msg.SubscribeID,
+		StatusCode:  moq.SubscribeDoneUnsubscribed,
+	})
+}
+
+func (se *session) onCodecParams() {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+	se.catalogNeeded = true
+}
+
+// openSubgroup opens a unidirectional stream that carries a subgroup.
+// It must be called with the mutex locked.
+func (se *session) openSubgroup(
+	sub *sessionSubscription,
+	groupID uint64,
+	priority uint8,
+) (*webtransport.SendStream, error) {
+	ctx, ctxCancel := context.WithTimeout(se.ctx, time.Duration(se.writeTimeout))
+	defer ctxCancel()
+
+	stream, err := se.wsess.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = se.writeData(stream, moq.SubgroupHeader{
+		SubscribeID:       sub.subscribeID,
+		TrackAlias:        sub.trackAlias,
+		GroupID:           groupID,
+		SubgroupID:        0,
+		PublisherPriority: priority,
+	}.Marshal())
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func (se *session) writeData(stream *webtransport.SendStream, byts []byte) error {
+	stream.SetWriteDeadline(time.Now().Add(time.Duration(se.writeTimeout)))
+	_, err := stream.Write(byts)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddUint64(se.bytesSent, uint64(len(byts)))
+	return nil
+}
+
+// isStreamCanceled checks whether the client canceled a single stream,
+// that is allowed in order to skip a group.
+func isStreamCanceled(err error) bool {
+	var serr *webtransport.StreamError
+	return errors.As(err, &serr) && serr.Remote
+}
+
+func (se *session) generateCatalog() ([]byte, error) {
+	catalog := &moq.Catalog{
+		Version:                1,
+		StreamingFormat:        1,
+		StreamingFormatVersion: "0.2",
+		CommonTrackFields: moq.CatalogCommonTrackFields{
+			Namespace:   se.pathName,
+			Packaging:   "cmaf",
+			RenderGroup: 1,
+		},
+		Tracks: []moq.CatalogTrack{},
+	}
+
+	for _, t := range se.tracks {
+		init := &mcfmp4.Init{
+			Tracks: []*mcfmp4.InitTrack{t.track.InitTrack},
+		}
+
+		var buf seekablebuffer.Buffer
+		err := init.Marshal(&buf)
+		if err != nil {
+			return nil, err
+		}
+
+		mimeType := "audio/mp4"
+		if t.isVideo() {
+			mimeType = "video/mp4"
+		}
+
+		catalog.Tracks = append(catalog.Tracks, moq.CatalogTrack{
+			Name:     t.name,
+			InitData: base64.StdEncoding.EncodeToString(buf.Bytes()),
+			SelectionParams: moq.CatalogSelectionParams{
+				Codec:    mfmp4.CodecString(t.track.InitTrack.Codec),
+				MimeType: mimeType,
+			},
+		})
+	}
+
+	return json.Marshal(catalog)
+}
+
+// writeCatalog writes the catalog into a new group of the catalog track.
+// It must be called with the mutex locked.
+func (se *session) writeCatalog() error {
+	byts, err := se.generateCatalog()
+	if err != nil {
+		return err
+	}
+
+	groupID := se.catalogNextGroupID
+	se.catalogNextGroupID++
+
+	stream, err := se.openSubgroup(se.catalogSub, groupID, catalogPriority)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	err = se.writeData(stream, moq.Object{ID: 0, Payload: byts}.Marshal())
+	if err != nil && !isStreamCanceled(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (se *session) onSample(track *mfmp4.Track, sample *mfmp4.Sample) error {
+	t := se.trackMap[track]
+
+	sample = t.timeline.Push(sample)
+	if sample == nil {
+		return nil
+	}
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	baseTime, ok := t.timeline.BaseTime(sample)
+	if !ok {
+		return nil
+	}
+
+	if se.catalogNeeded && se.catalogSub != nil {
+		se.catalogNeeded = false
+
+		err := se.writeCatalog()
+		if err != nil {
+			return err
+		}
+	}
+
+	// every video group is a GOP and is delivered on a dedicated stream,
+	// while every audio frame is a group delivered on a dedicated stream.
+	newGroup := !t.isVideo() || !sample.IsNonSyncSample
+
+	var groupID uint64
+	if newGroup {
+		groupID = t.nextGroupID
+		t.nextGroupID++
+	}
+
+	t.sequenceNumber++
+
+	sub := t.sub
+	if sub == nil {
+		return nil
+	}
+
+	if newGroup {
+		if sub.stream != nil {
+			sub.stream.Close()
+			sub.stream = nil
+		}
+
+		priority := uint8(audioPriority)
+		if t.isVideo() {
+			priority = videoPriority
+		}
+
+		var err error
+		sub.stream, err = se.openSubgroup(sub, groupID, priority)
+		if err != nil {
+			if isStreamCanceled(err) {
+				return nil
+			}
+			return err
+		}
+		sub.objectID = 0
+	} else if sub.stream == nil {
+		// wait for the next group
+		return nil
+	}
+
+	part := &mcfmp4.Part{
+		SequenceNumber: t.sequenceNumber,
+		Tracks: []*mcfmp4.PartTrack{{
+			ID:       track.InitTrack.ID,
+			BaseTime: baseTime,
+			Samples:  []*mcfmp4.Sample{sample.Sample},
+		}},
+	}
+
+	var buf seekablebuffer.Buffer
+	err := part.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	err = se.writeData(sub.stream, moq.Object{ID: sub.objectID, Payload: buf.Bytes()}.Marshal())
+	if err != nil {
+		sub.stream = nil
+		if isStreamCanceled(err) {
+			return nil
+		}
+		return err
+	}
+
+	sub.objectID++
+
+	if !t.isVideo() {
+		sub.stream.Close()
+		sub.stream = nil
+	}
+
+	return nil
+}
+
+// APIReaderDescribe implements reader.
+func (se *session) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "moqSession",
+		ID:   se.uuid.String(),
+	}
+}
+
+func (se *session) apiItem() *defs.APIMoQSession {
+	return &defs.APIMoQSession{
+		ID:         se.uuid,
+		Created:    se.created,
+		RemoteAddr: se.remoteAddr,
+		Path:       se.pathName,
+		Query:      se.query,
+		BytesSent:  atomic.LoadUint64(se.bytesSent),
+	}
+}
@@ -0,0 +1,135 @@
+package moq
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+
+	"github.com/bluenviron/mediamtx/internal/certloader"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mtls "github.com/bluenviron/mediamtx/internal/protocols/tls"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+// wtServer is a WebTransport server.
+// WebTransport runs on top of HTTP/3, that always requires TLS.
+type wtServer struct {
+	address            string
+	serverKey          string
+	serverCert         string
+	clientCA           string
+	clientCertRequired bool
+	allowOrigin        string
+	readTimeout        conf.Duration
+	parent             *Server
+
+	loader *certloader.CertLoader
+	pc     net.PacketConn
+	inner  *webtransport.Server
+	done   chan struct{}
+}
+
+func (s *wtServer) initialize() error {
+	if s.serverCert == "" {
+		return fmt.Errorf("server cert is missing")
+	}
+
+	s.loader = &certloader.CertLoader{
+		CertPath: s.serverCert,
+		KeyPath:  s.serverKey,
+		Parent:   s,
+	}
+	err := s.loader.Initialize()
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := mtls.ConfigForServer(s.loader.GetCertificate(), s.clientCA, s.clientCertRequired)
+	if err != nil {
+		s.loader.Close()
+		return err
+	}
+
+	network, address := restrictnetwork.Restrict("udp", s.address)
+
+	s.pc, err = net.ListenPacket(network, address)
+	if err != nil {
+		s.loader.Close()
+		return err
+	}
+
+	h3 := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		QUICConfig: &quic.Config{
+			MaxIdleTimeout:  time.Duration(s.readTimeout),
+			KeepAlivePeriod: time.Duration(s.readTimeout) / 2,
+		},
+		Handler: s,
+	}
+	webtransport.ConfigureHTTP3Server(h3)
+
+	s.inner = &webtransport.Server{
+		H3:          h3,
+		CheckOrigin: s.checkOrigin,
+	}
+
+	s.done = make(chan struct{})
+	go s.run()
+
+	return nil
+}
+
+func (s *wtServer) close() {
+	s.inner.Close()
+	s.pc.Close() // in case Close() is called before Serve()
+	<-s.done
+	s.loader.Close()
+}
+
+// Log implements logger.Writer.
+func (s *wtServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, format, args...)
+}
+
+func (s *wtServer) run() {
+	defer close(s.done)
+	s.inner.Serve(s.pc) //nolint:errcheck
+}
+
+func (s *wtServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || s.allowOrigin == "*" || origin == s.allowOrigin
+}
+
+// ServeHTTP implements http.Handler.
+func (s *wtServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", "mediamtx")
+
+	if r.Method != http.MethodConnect {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if len(r.URL.Path) < 2 || r.URL.Path[0] != '/' {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	se := s.parent.newSession(serverNewSessionReq{
+		pathName: r.URL.Path[1:],
+		w:        w,
+		r:        r,
+	})
+	if se == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	se.run()
+}
@@ -0,0 +1,319 @@
+package rist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	mcmpegts "github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/counterdumper"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/hooks"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mpegts"
+	"github.com/bluenviron/mediamtx/internal/protocols/rist"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+type connState int
+
+const (
+	connStatePublish connState = iota + 1
+)
+
+// conn is a session with a RIST sender, identified by its address.
+type conn struct {
+	parentCtx           context.Context
+	rtspAddress         string
+	readTimeout         conf.Duration
+	bufferSize          conf.Duration
+	key                 string
+	remoteAddr          *net.UDPAddr
+	runOnConnect        string
+	runOnConnectRestart bool
+	runOnDisconnect     string
+	wg                  *sync.WaitGroup
+	externalCmdPool     *externalcmd.Pool
+	pathManager         serverPathManager
+	parent              *Server
+
+	ctx       context.Context
+	ctxCancel func()
+	created   time.Time
+	uuid      uuid.UUID
+	receiver  *rist.Receiver
+	mutex     sync.RWMutex
+	rtcpAddr  *net.UDPAddr
+	state     connState
+	cname     string
+	pathName  string
+	query     string
+
+	// in
+	chCNAME chan string
+}
+
+func (c *conn) initialize() error {
+	c.ctx, c.ctxCancel = context.WithCancel(c.parentCtx)
+
+	c.created = time.Now()
+	c.uuid = uuid.New()
+	c.chCNAME = make(chan string, 1)
+
+	c.receiver = &rist.Receiver{
+		BufferSize:  time.Duration(c.bufferSize),
+		ReadTimeout: time.Duration(c.readTimeout),
+		CNAME:       "mediamtx",
+		WriteRTCP: func(buf []byte) error {
+			c.mutex.RLock()
+			addr := c.rtcpAddr
+			c.mutex.RUnlock()
+
+			// the source address of RTP packets may be spoofed,
+			// therefore RTCP packets are sent only after the sender sent its own.
+			if addr == nil {
+				return nil
+			}
+
+			return c.parent.writeRTCP(buf, addr)
+		},
+		OnSenderCNAME: func(cname string) {
+			c.chCNAME <- cname
+		},
+	}
+	err := c.receiver.Initialize()
+	if err != nil {
+		c.ctxCancel()
+		return err
+	}
+
+	c.Log(logger.Info, "opened")
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+func (c *conn) Close() {
+	c.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (c *conn) Log(level logger.Level, format string, args ...interface{}) {
+	c.parent.Log(level, "[conn %v] "+format, append([]interface{}{c.remoteAddr}, args...)...)
+}
+
+func (c *conn) run() {
+	defer c.wg.Done()
+
+	onDisconnectHook := hooks.OnConnect(hooks.OnConnectParams{
+		Logger:              c,
+		ExternalCmdPool:     c.externalCmdPool,
+		RunOnConnect:        c.runOnConnect,
+		RunOnConnectRestart: c.runOnConnectRestart,
+		RunOnDisconnect:     c.runOnDisconnect,
+		RTSPAddress:         c.rtspAddress,
+		Desc:                c.APISourceDescribe(),
+	})
+	defer onDisconnectHook()
+
+	err := c.runInner()
+
+	c.ctxCancel()
+
+	c.receiver.Close()
+
+	c.parent.closeConn(c)
+
+	c.Log(logger.Info, "closed: %v", err)
+}
+
+func (c *conn) runInner() error {
+	// RIST Simple Profile has no stream identifier,
+	// therefore the path is taken from the CNAME of the sender.
+	var cname string
+
+	select {
+	case cname = <-c.chCNAME:
+	case <-time.After(time.Duration(c.readTimeout)):
+		return fmt.Errorf("sender did not send its CNAME")
+	case <-c.ctx.Done():
+		return errors.New("terminated")
+	}
+
+	pathName, rawQuery, _ := strings.Cut(cname, "?")
+	query, _ := url.ParseQuery(rawQuery)
+
+	path, err := c.pathManager.AddPublisher(defs.PathAddPublisherReq{
+		Author: c,
+		AccessRequest: defs.PathAccessRequest{
+			Name:    pathName,
+			Query:   rawQuery,
+			Publish: true,
+			Proto:   auth.ProtocolRIST,
+			ID:      &c.uuid,
+			Credentials: &auth.Credentials{
+				User: query.Get("user"),
+				Pass: query.Get("pass"),
+			},
+			IP: c.remoteAddr.IP,
+		},
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+			return terr
+		}
+		return err
+	}
+
+	defer path.RemovePublisher(defs.PathRemovePublisherReq{Author: c})
+
+	c.mutex.Lock()
+	c.state = connStatePublish
+	c.cname = cname
+	c.pathName = pathName
+	c.query = rawQuery
+	c.mutex.Unlock()
+
+	readerErr := make(chan error)
+	go func() {
+		readerErr <- c.runPublishReader(path)
+	}()
+
+	select {
+	case err := <-readerErr:
+		return err
+
+	case <-c.ctx.Done():
+		c.receiver.Close()
+		<-readerErr
+		return errors.New("terminated")
+	}
+}
+
+func (c *conn) runPublishReader(path defs.Path) error {
+	r := &mcmpegts.Reader{R: mcmpegts.NewBufferedReader(c.receiver)}
+	err := r.Initialize()
+	if err != nil {
+		return err
+	}
+
+	decodeErrors := &counterdumper.CounterDumper{
+		OnReport: func(val uint64) {
+			c.Log(logger.Warn, "%d decode %s",
+				val,
+				func() string {
+					if val == 1 {
+						return "error"
+					}
+					return "errors"
+				}())
+		},
+	}
+
+	decodeErrors.Start()
+	defer decodeErrors.Stop()
+
+	r.OnDecodeError(func(_ error) {
+		decodeErrors.Increase()
+	})
+
+	var stream *stream.Stream
+
+	medias, err := mpegts.ToStream(r, &stream, c)
+	if err != nil {
+		return err
+	}
+
+	stream, err = path.StartPublisher(defs.PathStartPublisherReq{
+		Author:             c,
+		Desc:               &description.Session{Medias: medias},
+		GenerateRTPPackets: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Log(logger.Info, "is publishing to path '%s', %s",
+		path.Name(), defs.MediasInfo(medias))
+
+	for {
+		err = r.Read()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// processRTP is called by Server.
+func (c *conn) processRTP(buf []byte) {
+	c.receiver.ProcessRTP(buf) //nolint:errcheck
+}
+
+// processRTCP is called by Server.
+func (c *conn) processRTCP(buf []byte, addr *net.UDPAddr) {
+	_, err := rtcp.Unmarshal(buf)
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	c.rtcpAddr = addr
+	c.mutex.Unlock()
+
+	c.receiver.ProcessRTCP(buf) //nolint:errcheck
+}
+
+// APISourceDescribe implements source.
+func (c *conn) APISourceDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "ristConn",
+		ID:   c.uuid.String(),
+	}
+}
+
+func (c *conn) apiItem() *defs.APIRISTConn {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	stats := c.receiver.Stats()
+
+	return &defs.APIRISTConn{
+		ID:         c.uuid,
+		Created:    c.created,
+		RemoteAddr: c.remoteAddr.String(),
+		State: func() defs.APIRISTConnState {
+			if c.state == connStatePublish {
+				return defs.APIRISTConnStatePublish
+			}
+			return defs.APIRISTConnStateIdle
+		}(),
+		CNAME:                c.cname,
+		Path:                 c.pathName,
+		Query:                c.query,
+		PacketsReceived:      stats.PacketsReceived,
+		PacketsRetransmitted: stats.PacketsRetransmitted,
+		PacketsRecovered:     stats.PacketsRecovered,
+		PacketsLost:          stats.PacketsLost,
+		PacketsDuplicate:     stats.PacketsDuplicate,
+		PacketsNACKed:        stats.PacketsNACKed,
+		BytesReceived:        stats.BytesReceived,
+		MsRTT:                float64(stats.RTT) / float64(time.Millisecond),
+	}
+}
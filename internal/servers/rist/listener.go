@@ -0,0 +1,56 @@
+package rist
+
+import (
+	"net"
+	"sync"
+)
+
+const (
+	// some senders send RTP packets bigger than the MTU, that are fragmented at the IP level.
+	udpReadBufferSize = 65535
+)
+
+// listener receives RTP and RTCP packets from all senders.
+type listener struct {
+	rtpConn  net.PacketConn
+	rtcpConn net.PacketConn
+	wg       *sync.WaitGroup
+	parent   *Server
+}
+
+func (l *listener) initialize() {
+	l.wg.Add(2)
+	go l.run(l.rtpConn, l.parent.processRTP)
+	go l.run(l.rtcpConn, l.parent.processRTCP)
+}
+
+func (l *listener) close() {
+	l.rtpConn.Close()
+	l.rtcpConn.Close()
+}
+
+func (l *listener) run(pc net.PacketConn, cb func([]byte, *net.UDPAddr)) {
+	defer l.wg.Done()
+
+	err := l.runInner(pc, cb)
+
+	l.parent.acceptError(err)
+}
+
+func (l *listener) runInner(pc net.PacketConn, cb func([]byte, *net.UDPAddr)) error {
+	buf := make([]byte, udpReadBufferSize)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		cb(append([]byte(nil), buf[:n]...), addr.(*net.UDPAddr))
+	}
+}
+
+func (l *listener) writeRTCP(buf []byte, addr *net.UDPAddr) error {
+	_, err := l.rtcpConn.WriteTo(buf, addr)
+	return err
+}
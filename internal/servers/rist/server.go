@@ -0,0 +1,452 @@
+// Package rist contains a RIST server.
+package rist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pion/rtp"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/rist"
+)
+
+const (
+	// maximum number of concurrent connections.
+	maxConns = 256
+)
+
+// ErrConnNotFound is returned when a connection is not found.
+var ErrConnNotFound = errors.New("connection not found")
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+// senders usually send RTP from an even port and RTCP from the following one.
+func senderKey(addr *net.UDPAddr) string {
+	return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port&^1))
+}
+
+type serverAPIConnsListRes struct {
+	data *defs.APIRISTConnList
+	err  error
+}
+
+type serverAPIConnsListReq struct {
+	res chan serverAPIConnsListRes
+}
+
+type serverAPIConnsGetRes struct {
+	data *defs.APIRISTConn
+	err  error
+}
+
+type serverAPIConnsGetReq struct {
+	uuid uuid.UUID
+	res  chan serverAPIConnsGetRes
+}
+
+type serverAPIConnsKickRes struct {
+	err error
+}
+
+type serverAPIConnsKickReq struct {
+	uuid uuid.UUID
+	res  chan serverAPIConnsKickRes
+}
+
+type serverNewConnReq struct {
+	addr *net.UDPAddr
+	res  chan *conn
+}
+
+type serverMetrics interface {
+	SetRISTServer(defs.APIRISTServer)
+}
+
+type serverPathManager interface {
+	AddPublisher(req defs.PathAddPublisherReq) (defs.Path, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a RIST server.
+type Server struct {
+	Address             string
+	RTSPAddress         string
+	ReadTimeout         conf.Duration
+	BufferSize          conf.Duration
+	RunOnConnect        string
+	RunOnConnectRestart bool
+	RunOnDisconnect     string
+	ExternalCmdPool     *externalcmd.Pool
+	Metrics             serverMetrics
+	PathManager         serverPathManager
+	Parent              serverParent
+
+	ctx       context.Context
+	ctxCancel func()
+	wg        sync.WaitGroup
+	ln        *listener
+	mutex     sync.RWMutex
+	conns     map[string]*conn
+	kicked    map[string]time.Time
+
+	// in
+	chNewConn      chan serverNewConnReq
+	chAcceptErr    chan error
+	chCloseConn    chan *conn
+	chAPIConnsList chan serverAPIConnsListReq
+	chAPIConnsGet  chan serverAPIConnsGetReq
+	chAPIConnsKick chan serverAPIConnsKickReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	rtpConn, rtcpConn, err := rist.Listen(s.Address)
+	if err != nil {
+		return err
+	}
+
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.conns = make(map[string]*conn)
+	s.kicked = make(map[string]time.Time)
+	s.chNewConn = make(chan serverNewConnReq)
+	s.chAcceptErr = make(chan error)
+	s.chCloseConn = make(chan *conn)
+	s.chAPIConnsList = make(chan serverAPIConnsListReq)
+	s.chAPIConnsGet = make(chan serverAPIConnsGetReq)
+	s.chAPIConnsKick = make(chan serverAPIConnsKickReq)
+
+	s.Log(logger.Info, "listener opened on "+s.Address+" (UDP/RTP), "+
+		rtcpConn.LocalAddr().String()+" (UDP/RTCP)")
+
+	s.ln = &listener{
+		rtpConn:  rtpConn,
+		rtcpConn: rtcpConn,
+		wg:       &s.wg,
+		parent:   s,
+	}
+	s.ln.initialize()
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetRISTServer(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[RIST] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetRISTServer(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+	kickedCleanup := time.NewTicker(time.Duration(s.ReadTimeout))
+	defer kickedCleanup.Stop()
+
+outer:
+	for {
+		select {
+		case <-kickedCleanup.C:
+			s.mutex.Lock()
+			s.removeExpiredKicked()
+			s.mutex.Unlock()
+
+		case err := <-s.chAcceptErr:
+			s.Log(logger.Error, "%s", err)
+			break outer
+
+		case req := <-s.chNewConn:
+			key := senderKey(req.addr)
+
+			s.mutex.Lock()
+			c, ok := s.conns[key]
+			switch {
+			case ok:
+
+			case s.isKicked(key):
+				c = nil
+
+			case len(s.conns) >= maxConns:
+				s.Log(logger.Debug, "discarding packets from %v since there are too many connections", req.addr)
+				c = nil
+
+			default:
+				c = &conn{
+					parentCtx:           s.ctx,
+					rtspAddress:         s.RTSPAddress,
+					readTimeout:         s.ReadTimeout,
+					bufferSize:          s.BufferSize,
+					key:                 key,
+					remoteAddr:          req.addr,
+					runOnConnect:        s.RunOnConnect,
+					runOnConnectRestart: s.RunOnConnectRestart,
+					runOnDisconnect:     s.RunOnDisconnect,
+					wg:                  &s.wg,
+					externalCmdPool:     s.ExternalCmdPool,
+					pathManager:         s.PathManager,
+					parent:              s,
+				}
+				err := c.initialize()
+				if err != nil {
+					s.Log(logger.Error, "%s", err)
+					c = nil
+				} else {
+					s.conns[key] = c
+				}
+			}
+			s.mutex.Unlock()
+
+			req.res <- c
+
+		case c := <-s.chCloseConn:
+			s.mutex.Lock()
+			if s.conns[c.key] == c {
+				delete(s.conns, c.key)
+			}
+			s.mutex.Unlock()
+
+		case req := <-s.chAPIConnsList:
+			data := &defs.APIRISTConnList{
+				Items: []*defs.APIRISTConn{},
+			}
+
+			for _, c := range s.conns {
+				data.Items = append(data.Items, c.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPIConnsListRes{data: data}
+
+		case req := <-s.chAPIConnsGet:
+			c := s.findConnByUUID(req.uuid)
+			if c == nil {
+				req.res <- serverAPIConnsGetRes{err: ErrConnNotFound}
+				continue
+			}
+
+			req.res <- serverAPIConnsGetRes{data: c.apiItem()}
+
+		case req := <-s.chAPIConnsKick:
+			c := s.findConnByUUID(req.uuid)
+			if c == nil {
+				req.res <- serverAPIConnsKickRes{err: ErrConnNotFound}
+				continue
+			}
+
+			s.mutex.Lock()
+			delete(s.conns, c.key)
+			s.kicked[c.key] = time.Now()
+			s.mutex.Unlock()
+
+			c.Close()
+			req.res <- serverAPIConnsKickRes{}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	s.ln.close()
+}
+
+func (s *Server) findConnByUUID(uuid uuid.UUID) *conn {
+	for _, c := range s.conns {
+		if c.uuid == uuid {
+			return c
+		}
+	}
+	return nil
+}
+
+// isKicked checks whether a sender has been kicked out and is still sending.
+// Senders are not notified when they are kicked out, therefore their packets
+// are discarded until they stop sending for a read timeout.
+// It must be called with mutex locked.
+func (s *Server) isKicked(key string) bool {
+	last, ok := s.kicked[key]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+
+	if now.Sub(last) >= time.Duration(s.ReadTimeout) {
+		delete(s.kicked, key)
+		return false
+	}
+
+	s.kicked[key] = now
+	return true
+}
+
+// removeExpiredKicked removes senders that have stopped sending since they were kicked out.
+// It must be called with mutex locked.
+func (s *Server) removeExpiredKicked() {
+	now := time.Now()
+
+	for key, last := range s.kicked {
+		if now.Sub(last) >= time.Duration(s.ReadTimeout) {
+			delete(s.kicked, key)
+		}
+	}
+}
+
+func (s *Server) findConn(addr *net.UDPAddr) *conn {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.conns[senderKey(addr)]
+}
+
+func (s *Server) findOrCreateConn(addr *net.UDPAddr) *conn {
+	req := serverNewConnReq{
+		addr: addr,
+		res:  make(chan *conn),
+	}
+
+	select {
+	case s.chNewConn <- req:
+		return <-req.res
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+// processRTP is called by listener.
+func (s *Server) processRTP(buf []byte, addr *net.UDPAddr) {
+	c := s.findConn(addr)
+
+	if c == nil {
+		// create connections only when a valid RTP packet is received,
+		// in order not to allocate resources for every incoming datagram.
+		var h rtp.Header
+		_, err := h.Unmarshal(buf)
+		if err != nil || h.PayloadType != rist.PayloadTypeMPEGTS {
+			return
+		}
+
+		c = s.findOrCreateConn(addr)
+		if c == nil {
+			return
+		}
+	}
+
+	c.processRTP(buf)
+}
+
+// processRTCP is called by listener.
+func (s *Server) processRTCP(buf []byte, addr *net.UDPAddr) {
+	c := s.findConn(addr)
+	if c != nil {
+		c.processRTCP(buf, addr)
+	}
+}
+
+// writeRTCP is called by conn.
+func (s *Server) writeRTCP(buf []byte, addr *net.UDPAddr) error {
+	return s.ln.writeRTCP(buf, addr)
+}
+
+// acceptError is called by listener.
+func (s *Server) acceptError(err error) {
+	select {
+	case s.chAcceptErr <- err:
+	case <-s.ctx.Done():
+	}
+}
+
+// closeConn is called by conn.
+func (s *Server) closeConn(c *conn) {
+	select {
+	case s.chCloseConn <- c:
+	case <-s.ctx.Done():
+	}
+}
+
+// APIConnsList is called by api.
+func (s *Server) APIConnsList() (*defs.APIRISTConnList, error) {
+	req := serverAPIConnsListReq{
+		res: make(chan serverAPIConnsListRes),
+	}
+
+	select {
+	case s.chAPIConnsList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIConnsGet is called by api.
+func (s *Server) APIConnsGet(uuid uuid.UUID) (*defs.APIRISTConn, error) {
+	req := serverAPIConnsGetReq{
+		uuid: uuid,
+		res:  make(chan serverAPIConnsGetRes),
+	}
+
+	select {
+	case s.chAPIConnsGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APIConnsKick is called by api.
+func (s *Server) APIConnsKick(uuid uuid.UUID) error {
+	req := serverAPIConnsKickReq{
+		uuid: uuid,
+		res:  make(chan serverAPIConnsKickRes),
+	}
+
+	select {
+	case s.chAPIConnsKick <- req:
+		res := <-req.res
+		return res.err
+
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
@@ -0,0 +1,369 @@
+package rist
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/google/uuid"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/stream"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+type dummyPath struct {
+	stream        *stream.Stream
+	streamCreated chan struct{}
+}
+
+func (p *dummyPath) Name() string {
+	return "teststream"
+}
+
+func (p *dummyPath) SafeConf() *conf.Path {
+	return &conf.Path{}
+}
+
+func (p *dummyPath) ExternalCmdEnv() externalcmd.Environment {
+	return externalcmd.Environment{}
+}
+
+func (p *dummyPath) StartPublisher(req defs.PathStartPublisherReq) (*stream.Stream, error) {
+	p.stream = &stream.Stream{
+		WriteQueueSize:     512,
+		UDPMaxPayloadSize:  1472,
+		Desc:               req.Desc,
+		GenerateRTPPackets: true,
+		Parent:             test.NilLogger,
+	}
+	err := p.stream.Initialize()
+	if err != nil {
+		return nil, err
+	}
+
+	close(p.streamCreated)
+	return p.stream, nil
+}
+
+func (p *dummyPath) StopPublisher(_ defs.PathStopPublisherReq) {
+}
+
+func (p *dummyPath) RemovePublisher(_ defs.PathRemovePublisherReq) {
+}
+
+func (p *dummyPath) RemoveReader(_ defs.PathRemoveReaderReq) {
+}
+
+type testSender struct {
+	t        *testing.T
+	rtpConn  *net.UDPConn
+	rtcpConn *net.UDPConn
+	seq      uint16
+	sent     map[uint16][]byte
+}
+
+// packetize puts every MPEG-TS packet into a dedicated RTP packet.
+func (s *testSender) packetize(byts []byte) [][]byte {
+	var ret [][]byte
+
+	for len(byts) != 0 {
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    33,
+				SequenceNumber: s.seq,
+				SSRC:           0x1000,
+			},
+			Payload: byts[:188],
+		}
+		byts = byts[188:]
+
+		enc, err := pkt.Marshal()
+		require.NoError(s.t, err)
+
+		s.sent[s.seq] = enc
+		s.seq++
+		ret = append(ret, enc)
+	}
+
+	return ret
+}
+
+func (s *testSender) writeRTP(buf []byte) {
+	_, err := s.rtpConn.WriteToUDP(buf, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8896})
+	require.NoError(s.t, err)
+}
+
+func (s *testSender) writeRTCP(pkts []rtcp.Packet) {
+	buf, err := rtcp.Marshal(pkts)
+	require.NoError(s.t, err)
+	_, err = s.rtcpConn.WriteToUDP(buf, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 8897})
+	require.NoError(s.t, err)
+}
+
+func TestServerPublish(t *testing.T) {
+	externalCmdPool := &externalcmd.Pool{}
+	err := externalCmdPool.Initialize()
+	require.NoError(t, err)
+	defer externalCmdPool.Close()
+
+	path := &dummyPath{
+		streamCreated: make(chan struct{}),
+	}
+
+	pathManager := &test.PathManager{
+		AddPublisherImpl: func(req defs.PathAddPublisherReq) (defs.Path, error) {
+			require.Equal(t, "teststream", req.AccessRequest.Name)
+			require.Equal(t, "user=myuser&pass=mypass&param=value", req.AccessRequest.Query)
+			require.Equal(t, "myuser", req.AccessRequest.Credentials.User)
+			require.Equal(t, "mypass", req.AccessRequest.Credentials.Pass)
+			return path, nil
+		},
+	}
+
+	s := &Server{
+		Address:         "127.0.0.1:8896",
+		ReadTimeout:     conf.Duration(10 * time.Second),
+		BufferSize:      conf.Duration(1 * time.Second),
+		ExternalCmdPool: externalCmdPool,
+		PathManager:     pathManager,
+		Parent:          test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9040})
+	require.NoError(t, err)
+	defer rtpConn.Close()
+
+	rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9041})
+	require.NoError(t, err)
+	defer rtcpConn.Close()
+
+	sender := &testSender{
+		t:        t,
+		rtpConn:  rtpConn,
+		rtcpConn: rtcpConn,
+		seq:      500,
+		sent:     make(map[uint16][]byte),
+	}
+
+	track := &mpegts.Track{
+		Codec: &mpegts.CodecH264{},
+	}
+
+	var buf bytes.Buffer
+	w := &mpegts.Writer{W: &buf, Tracks: []*mpegts.Track{track}}
+	err = w.Initialize()
+	require.NoError(t, err)
+
+	err = w.WriteH264(track, 0, 0, [][]byte{
+		test.FormatH264.SPS,
+		test.FormatH264.PPS,
+		{0x05, 1}, // IDR
+	})
+	require.NoError(t, err)
+
+	pkts := sender.packetize(buf.Bytes())
+	require.Greater(t, len(pkts), 2)
+
+	// simulate the loss of the second packet
+	for i, pkt := range pkts {
+		if i != 1 {
+			sender.writeRTP(pkt)
+		}
+	}
+
+	// wait for the connection to be created by RTP packets
+	for {
+		list, err2 := s.APIConnsList()
+		require.NoError(t, err2)
+		if len(list.Items) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// RTCP packets are sent to the sender only after it sent its own
+	sender.writeRTCP([]rtcp.Packet{
+		&rtcp.SenderReport{SSRC: 0x1000},
+		&rtcp.SourceDescription{
+			Chunks: []rtcp.SourceDescriptionChunk{{
+				Source: 0x1000,
+				Items: []rtcp.SourceDescriptionItem{{
+					Type: rtcp.SDESCNAME,
+					Text: "teststream?user=myuser&pass=mypass&param=value",
+				}},
+			}},
+		},
+	})
+
+	// wait for the retransmission request and reply to it
+	for recovered := false; !recovered; {
+		rbuf := make([]byte, 1500)
+		rtcpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err2 := rtcpConn.ReadFromUDP(rbuf)
+		require.NoError(t, err2)
+
+		rpkts, err2 := rtcp.Unmarshal(rbuf[:n])
+		require.NoError(t, err2)
+
+		for _, rpkt := range rpkts {
+			if nack, ok := rpkt.(*rtcp.TransportLayerNack); ok {
+				require.Equal(t, uint32(0x1000), nack.MediaSSRC)
+				require.Equal(t, []rtcp.NackPair{{PacketID: 501}}, nack.Nacks)
+
+				var retrans rtp.Packet
+				err2 = retrans.Unmarshal(sender.sent[501])
+				require.NoError(t, err2)
+				retrans.SSRC |= 1
+				enc, err2 := retrans.Marshal()
+				require.NoError(t, err2)
+
+				sender.writeRTP(enc)
+				recovered = true
+			}
+		}
+	}
+
+	<-path.streamCreated
+
+	reader := test.NilLogger
+
+	recv := make(chan struct{})
+
+	path.stream.AddReader(
+		reader,
+		path.stream.Desc.Medias[0],
+		path.stream.Desc.Medias[0].Formats[0],
+		func(u unit.Unit) error {
+			require.Equal(t, [][]byte{
+				test.FormatH264.SPS,
+				test.FormatH264.PPS,
+				{0x05, 1}, // IDR
+			}, u.(*unit.H264).AU)
+			close(recv)
+			return nil
+		})
+
+	path.stream.StartReader(reader)
+	defer path.stream.RemoveReader(reader)
+
+	buf.Reset()
+	err = w.WriteH264(track, 0, 0, [][]byte{
+		{5, 2},
+	})
+	require.NoError(t, err)
+
+	for _, pkt := range sender.packetize(buf.Bytes()) {
+		sender.writeRTP(pkt)
+	}
+
+	<-recv
+
+	list, err := s.APIConnsList()
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+
+	item := list.Items[0]
+	require.Equal(t, defs.APIRISTConnStatePublish, item.State)
+	require.Equal(t, "teststream", item.Path)
+	require.Equal(t, "user=myuser&pass=mypass&param=value", item.Query)
+	require.Equal(t, "127.0.0.1:9040", item.RemoteAddr)
+	require.Equal(t, uint64(1), item.PacketsRetransmitted)
+	require.Equal(t, uint64(1), item.PacketsRecovered)
+	require.Equal(t, uint64(0), item.PacketsLost)
+
+	_, err = s.APIConnsGet(uuid.New())
+	require.Equal(t, ErrConnNotFound, err)
+}
+
+func TestServerUnsolicitedPackets(t *testing.T) {
+	externalCmdPool := &externalcmd.Pool{}
+	err := externalCmdPool.Initialize()
+	require.NoError(t, err)
+	defer externalCmdPool.Close()
+
+	s := &Server{
+		Address:         "127.0.0.1:8896",
+		ReadTimeout:     conf.Duration(10 * time.Second),
+		BufferSize:      conf.Duration(1 * time.Second),
+		ExternalCmdPool: externalCmdPool,
+		PathManager:     &test.PathManager{},
+		Parent:          test.NilLogger,
+	}
+	err = s.Initialize()
+	require.NoError(t, err)
+	defer s.Close()
+
+	rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9040})
+	require.NoError(t, err)
+	defer rtpConn.Close()
+
+	rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9041})
+	require.NoError(t, err)
+	defer rtcpConn.Close()
+
+	sender := &testSender{
+		t:        t,
+		rtpConn:  rtpConn,
+		rtcpConn: rtcpConn,
+		sent:     make(map[uint16][]byte),
+	}
+
+	// datagrams that are not MPEG-TS over RTP do not create connections
+
+	sender.writeRTP([]byte{1, 2, 3, 4})
+
+	enc, err := (&rtp.Packet{
+		Header: rtp.Header{
+			Version:     2,
+			PayloadType: 96,
+			SSRC:        0x1000,
+		},
+		Payload: []byte{1, 2, 3, 4},
+	}).Marshal()
+	require.NoError(t, err)
+	sender.writeRTP(enc)
+
+	sender.writeRTCP([]rtcp.Packet{&rtcp.SenderReport{SSRC: 0x1000}})
+	time.Sleep(200 * time.Millisecond)
+
+	list, err := s.APIConnsList()
+	require.NoError(t, err)
+	require.Empty(t, list.Items)
+
+	// nothing is sent to addresses that did not send RTCP packets
+
+	sender.writeRTP(sender.packetize(bytes.Repeat([]byte{0x47}, 188))[0])
+
+	rtcpConn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, _, err = rtcpConn.ReadFromUDP(make([]byte, 1500))
+	require.Error(t, err)
+
+	list, err = s.APIConnsList()
+	require.NoError(t, err)
+	require.Len(t, list.Items, 1)
+
+	// kicked senders are ignored while they keep sending
+
+	err = s.APIConnsKick(list.Items[0].ID)
+	require.NoError(t, err)
+
+	sender.writeRTP(sender.packetize(bytes.Repeat([]byte{0x47}, 188))[0])
+	time.Sleep(200 * time.Millisecond)
+
+	list, err = s.APIConnsList()
+	require.NoError(t, err)
+	require.Empty(t, list.Items)
+}
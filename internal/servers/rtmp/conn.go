@@ -19,6 +19,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/rtmp"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -164,8 +165,9 @@ func (c *conn) runRead() error {
 			Proto: auth.ProtocolRTMP,
 			ID:    &c.uuid,
 			Credentials: &auth.Credentials{
-				User: query.Get("user"),
-				Pass: query.Get("pass"),
+				User:       query.Get("user"),
+				Pass:       query.Get("pass"),
+				ClientCert: tls.ClientCertificate(c.nconn),
 			},
 			IP: c.ip(),
 		},
@@ -234,8 +236,9 @@ func (c *conn) runPublish() error {
 			Proto:   auth.ProtocolRTMP,
 			ID:      &c.uuid,
 			Credentials: &auth.Credentials{
-				User: query.Get("user"),
-				Pass: query.Get("pass"),
+				User:       query.Get("user"),
+				Pass:       query.Get("pass"),
+				ClientCert: tls.ClientCertificate(c.nconn),
 			},
 			IP: c.ip(),
 		},
@@ -10,6 +10,7 @@ import (
 	"reflect"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -18,6 +19,8 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/proxyproto"
+	mtls "github.com/bluenviron/mediamtx/internal/protocols/tls"
 	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
@@ -73,20 +76,24 @@ type serverParent interface {
 
 // Server is a RTMP server.
 type Server struct {
-	Address             string
-	ReadTimeout         conf.Duration
-	WriteTimeout        conf.Duration
-	IsTLS               bool
-	ServerCert          string
-	ServerKey           string
-	RTSPAddress         string
-	RunOnConnect        string
-	RunOnConnectRestart bool
-	RunOnDisconnect     string
-	ExternalCmdPool     *externalcmd.Pool
-	Metrics             serverMetrics
-	PathManager         serverPathManager
-	Parent              serverParent
+	Address                     string
+	ReadTimeout                 conf.Duration
+	WriteTimeout                conf.Duration
+	IsTLS                       bool
+	ServerCert                  string
+	ServerKey                   string
+	ClientCA                    string
+	ClientCertRequired          bool
+	ProxyProtocol               bool
+	ProxyProtocolTrustedSources conf.IPNetworks
+	RTSPAddress                 string
+	RunOnConnect                string
+	RunOnConnectRestart         bool
+	RunOnDisconnect             string
+	ExternalCmdPool             *externalcmd.Pool
+	Metrics                     serverMetrics
+	PathManager                 serverPathManager
+	Parent                      serverParent
 
 	ctx       context.Context
 	ctxCancel func()
@@ -107,8 +114,21 @@ type Server struct {
 // Initialize initializes the server.
 func (s *Server) Initialize() error {
 	ln, err := func() (net.Listener, error) {
+		network, address := restrictnetwork.Restrict("tcp", s.Address)
+
+		var ln net.Listener
+		var err error
+		if s.ProxyProtocol {
+			ln, err = proxyproto.Listen(network, address, s.ProxyProtocolTrustedSources, time.Duration(s.ReadTimeout))
+		} else {
+			ln, err = net.Listen(network, address)
+		}
+		if err != nil {
+			return nil, err
+		}
+
 		if !s.IsTLS {
-			return net.Listen(restrictnetwork.Restrict("tcp", s.Address))
+			return ln, nil
 		}
 
 		s.loader = &certloader.CertLoader{
@@ -116,13 +136,20 @@ func (s *Server) Initialize() error {
 			KeyPath:  s.ServerKey,
 			Parent:   s.Parent,
 		}
-		err := s.loader.Initialize()
+		err = s.loader.Initialize()
 		if err != nil {
+			ln.Close()
 			return nil, err
 		}
 
-		network, address := restrictnetwork.Restrict("tcp", s.Address)
-		return tls.Listen(network, address, &tls.Config{GetCertificate: s.loader.GetCertificate()})
+		tlsConfig, err := mtls.ConfigForServer(s.loader.GetCertificate(), s.ClientCA, s.ClientCertRequired)
+		if err != nil {
+			s.loader.Close()
+			ln.Close()
+			return nil, err
+		}
+
+		return tls.NewListener(ln, tlsConfig), nil
 	}()
 	if err != nil {
 		return err
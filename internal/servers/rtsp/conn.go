@@ -21,6 +21,7 @@ import (
 	"github.com/bluenviron/mediamtx/internal/hooks"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	"github.com/bluenviron/mediamtx/internal/protocols/rtsp"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 )
 
 func absoluteURL(req *base.Request, v string) string {
@@ -120,6 +121,12 @@ func (c *conn) ip() net.IP {
 	return c.rconn.NetConn().RemoteAddr().(*net.TCPAddr).IP
 }
 
+func (c *conn) credentials(req *base.Request) *auth.Credentials {
+	cred := rtsp.Credentials(req)
+	cred.ClientCert = tls.ClientCertificate(c.rconn.NetConn())
+	return cred
+}
+
 // onClose is called by rtspServer.
 func (c *conn) onClose(err error) {
 	c.Log(logger.Info, "closed: %v", err)
@@ -161,7 +168,7 @@ func (c *conn) onDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx,
 		Query:            ctx.Query,
 		Proto:            auth.ProtocolRTSP,
 		ID:               &c.uuid,
-		Credentials:      rtsp.Credentials(ctx.Request),
+		Credentials:      c.credentials(ctx.Request),
 		IP:               c.ip(),
 		CustomVerifyFunc: customVerifyFunc,
 	}
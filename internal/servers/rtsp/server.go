@@ -3,9 +3,9 @@ package rtsp
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
@@ -23,6 +23,8 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/proxyproto"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
@@ -36,17 +38,21 @@ func interfaceIsEmpty(i interface{}) bool {
 	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
 }
 
-func printAddresses(srv *gortsplib.Server) string {
+func printAddresses(s *Server) string {
 	var ret []string
 
-	ret = append(ret, fmt.Sprintf("%s (TCP)", srv.RTSPAddress))
+	ret = append(ret, fmt.Sprintf("%s (TCP)", s.srv.RTSPAddress))
 
-	if srv.UDPRTPAddress != "" {
-		ret = append(ret, fmt.Sprintf("%s (UDP/RTP)", srv.UDPRTPAddress))
+	if s.srv.UDPRTPAddress != "" {
+		ret = append(ret, fmt.Sprintf("%s (UDP/RTP)", s.srv.UDPRTPAddress))
 	}
 
-	if srv.UDPRTCPAddress != "" {
-		ret = append(ret, fmt.Sprintf("%s (UDP/RTCP)", srv.UDPRTCPAddress))
+	if s.srv.UDPRTCPAddress != "" {
+		ret = append(ret, fmt.Sprintf("%s (UDP/RTCP)", s.srv.UDPRTCPAddress))
+	}
+
+	if s.WebSocket {
+		ret = append(ret, fmt.Sprintf("%s (WebSocket)", s.WebSocketAddress))
 	}
 
 	return strings.Join(ret, ", ")
@@ -69,30 +75,41 @@ type serverParent interface {
 
 // Server is a RTSP server.
 type Server struct {
-	Address             string
-	AuthMethods         []auth.VerifyMethod
-	ReadTimeout         conf.Duration
-	WriteTimeout        conf.Duration
-	WriteQueueSize      int
-	UseUDP              bool
-	UseMulticast        bool
-	RTPAddress          string
-	RTCPAddress         string
-	MulticastIPRange    string
-	MulticastRTPPort    int
-	MulticastRTCPPort   int
-	IsTLS               bool
-	ServerCert          string
-	ServerKey           string
-	RTSPAddress         string
-	Transports          conf.RTSPTransports
-	RunOnConnect        string
-	RunOnConnectRestart bool
-	RunOnDisconnect     string
-	ExternalCmdPool     *externalcmd.Pool
-	Metrics             serverMetrics
-	PathManager         serverPathManager
-	Parent              serverParent
+	Address                     string
+	AuthMethods                 []auth.VerifyMethod
+	ReadTimeout                 conf.Duration
+	WriteTimeout                conf.Duration
+	WriteQueueSize              int
+	UseUDP                      bool
+	UseMulticast                bool
+	RTPAddress                  string
+	RTCPAddress                 string
+	MulticastIPRange            string
+	MulticastRTPPort            int
+	MulticastRTCPPort           int
+	IsTLS                       bool
+	ServerCert                  string
+	ServerKey                   string
+	ClientCA                    string
+	ClientCertRequired          bool
+	ProxyProtocol               bool
+	ProxyProtocolTrustedSources conf.IPNetworks
+	RTSPAddress                 string
+	Transports                  conf.RTSPTransports
+	WebSocket                   bool
+	WebSocketAddress            string
+	WebSocketEncryption         bool
+	WebSocketServerKey          string
+	WebSocketServerCert         string
+	WebSocketAllowOrigin        string
+	WebSocketTrustedProxies     conf.IPNetworks
+	RunOnConnect                string
+	RunOnConnectRestart         bool
+	RunOnDisconnect             string
+	ExternalCmdPool             *externalcmd.Pool
+	Metrics                     serverMetrics
+	PathManager                 serverPathManager
+	Parent                      serverParent
 
 	ctx       context.Context
 	ctxCancel func()
@@ -102,6 +119,8 @@ type Server struct {
 	conns     map[*gortsplib.ServerConn]*conn
 	sessions  map[*gortsplib.ServerSession]*session
 	loader    *certloader.CertLoader
+	wsLn      *wsListener
+	wsServer  *wsServer
 }
 
 // Initialize initializes the server.
@@ -120,6 +139,30 @@ func (s *Server) Initialize() error {
 		AuthMethods:    s.AuthMethods,
 	}
 
+	if s.ProxyProtocol {
+		s.srv.Listen = func(network string, address string) (net.Listener, error) {
+			return proxyproto.Listen(network, address, s.ProxyProtocolTrustedSources, time.Duration(s.ReadTimeout))
+		}
+	}
+
+	if s.WebSocket {
+		listen := s.srv.Listen
+		if listen == nil {
+			listen = net.Listen
+		}
+
+		s.srv.Listen = func(network string, address string) (net.Listener, error) {
+			ln, err := listen(network, address)
+			if err != nil {
+				return nil, err
+			}
+
+			s.wsLn = &wsListener{Listener: ln}
+			s.wsLn.initialize()
+			return s.wsLn, nil
+		}
+	}
+
 	if s.UseUDP {
 		s.srv.UDPRTPAddress = s.RTPAddress
 		s.srv.UDPRTCPAddress = s.RTCPAddress
@@ -142,7 +185,11 @@ func (s *Server) Initialize() error {
 			return err
 		}
 
-		s.srv.TLSConfig = &tls.Config{GetCertificate: s.loader.GetCertificate()}
+		s.srv.TLSConfig, err = tls.ConfigForServer(s.loader.GetCertificate(), s.ClientCA, s.ClientCertRequired)
+		if err != nil {
+			s.loader.Close()
+			return err
+		}
 	}
 
 	err := s.srv.Start()
@@ -150,7 +197,29 @@ func (s *Server) Initialize() error {
 		return err
 	}
 
-	s.Log(logger.Info, "listener opened on %s", printAddresses(s.srv))
+	if s.WebSocket {
+		s.wsServer = &wsServer{
+			address:        s.WebSocketAddress,
+			encryption:     s.WebSocketEncryption,
+			serverKey:      s.WebSocketServerKey,
+			serverCert:     s.WebSocketServerCert,
+			allowOrigin:    s.WebSocketAllowOrigin,
+			trustedProxies: s.WebSocketTrustedProxies,
+			readTimeout:    s.ReadTimeout,
+			listener:       s.wsLn,
+			parent:         s,
+		}
+		err = s.wsServer.initialize()
+		if err != nil {
+			s.srv.Close()
+			if s.loader != nil {
+				s.loader.Close()
+			}
+			return err
+		}
+	}
+
+	s.Log(logger.Info, "listener opened on %s", printAddresses(s))
 
 	s.wg.Add(1)
 	go s.run()
@@ -189,6 +258,10 @@ func (s *Server) Close() {
 		}
 	}
 
+	if s.wsServer != nil {
+		s.wsServer.close()
+	}
+
 	s.ctxCancel()
 	s.wg.Wait()
 
@@ -160,7 +160,7 @@ func (s *session) onAnnounce(c *conn, ctx *gortsplib.ServerHandlerOnAnnounceCtx)
 		Publish:          true,
 		Proto:            auth.ProtocolRTSP,
 		ID:               &c.uuid,
-		Credentials:      rtsp.Credentials(ctx.Request),
+		Credentials:      c.credentials(ctx.Request),
 		IP:               c.ip(),
 		CustomVerifyFunc: customVerifyFunc,
 	}
@@ -222,7 +222,7 @@ func (s *session) onSetup(c *conn, ctx *gortsplib.ServerHandlerOnSetupCtx,
 			Query:       ctx.Query,
 			Proto:       auth.ProtocolRTSP,
 			ID:          &c.uuid,
-			Credentials: rtsp.Credentials(ctx.Request),
+			Credentials: c.credentials(ctx.Request),
 			IP:          c.ip(),
 			CustomVerifyFunc: func(expectedUser, expectedPass string) bool {
 				return c.rconn.VerifyCredentials(ctx.Request, expectedUser, expectedPass)
@@ -0,0 +1,258 @@
+package rtsp
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+// wsConn is a net.Conn that exchanges a RTSP byte stream
+// through the messages of a WebSocket connection.
+type wsConn struct {
+	wc         *websocket.Conn
+	remoteAddr net.Addr // if nil, the address of the WebSocket connection is used
+
+	r          io.Reader
+	writeMutex sync.Mutex
+}
+
+// Read implements net.Conn.
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.r == nil {
+			var err error
+			_, c.r, err = c.wc.NextReader()
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := c.r.Read(p)
+		if err == io.EOF {
+			c.r = nil
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// Write implements net.Conn.
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	err := c.wc.WriteMessage(websocket.BinaryMessage, p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close implements net.Conn.
+func (c *wsConn) Close() error {
+	return c.wc.Close()
+}
+
+// LocalAddr implements net.Conn.
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.wc.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *wsConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.wc.RemoteAddr()
+}
+
+// SetDeadline implements net.Conn.
+func (c *wsConn) SetDeadline(t time.Time) error {
+	err := c.wc.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+	return c.wc.SetWriteDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.wc.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.wc.SetWriteDeadline(t)
+}
+
+type acceptRes struct {
+	nconn net.Conn
+	err   error
+}
+
+// wsListener is a net.Listener that returns both connections
+// of the wrapped listener and connections tunneled through WebSocket.
+type wsListener struct {
+	net.Listener
+
+	closeOnce sync.Once
+	accepted  chan acceptRes
+	tunneled  chan net.Conn
+	done      chan struct{}
+}
+
+func (l *wsListener) initialize() {
+	l.accepted = make(chan acceptRes)
+	l.tunneled = make(chan net.Conn)
+	l.done = make(chan struct{})
+
+	go l.runAccept()
+}
+
+func (l *wsListener) runAccept() {
+	for {
+		nconn, err := l.Listener.Accept()
+
+		select {
+		case l.accepted <- acceptRes{nconn, err}:
+		case <-l.done:
+			if nconn != nil {
+				nconn.Close()
+			}
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Accept implements net.Listener.
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case res := <-l.accepted:
+		return res.nconn, res.err
+
+	case nconn := <-l.tunneled:
+		return nconn, nil
+
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *wsListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+func (l *wsListener) push(nconn net.Conn) bool {
+	select {
+	case l.tunneled <- nconn:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+// wsServer accepts WebSocket connections and routes them
+// to the RTSP server, as if they were TCP connections.
+type wsServer struct {
+	address        string
+	encryption     bool
+	serverKey      string
+	serverCert     string
+	allowOrigin    string
+	trustedProxies conf.IPNetworks
+	readTimeout    conf.Duration
+	listener       *wsListener
+	parent         logger.Writer
+
+	upgrader *websocket.Upgrader
+	inner    *httpp.Server
+}
+
+func (s *wsServer) initialize() error {
+	s.upgrader = &websocket.Upgrader{
+		Subprotocols: []string{"binary", "rtsp"},
+		CheckOrigin:  s.checkOrigin,
+	}
+
+	router := gin.New()
+	router.SetTrustedProxies(s.trustedProxies.ToTrustedProxies()) //nolint:errcheck
+
+	router.Use(s.onRequest)
+
+	network, address := restrictnetwork.Restrict("tcp", s.address)
+
+	s.inner = &httpp.Server{
+		Network:     network,
+		Address:     address,
+		ReadTimeout: time.Duration(s.readTimeout),
+		Encryption:  s.encryption,
+		ServerCert:  s.serverCert,
+		ServerKey:   s.serverKey,
+		Handler:     router,
+		Parent:      s,
+	}
+	return s.inner.Initialize()
+}
+
+func (s *wsServer) close() {
+	s.inner.Close()
+}
+
+// Log implements logger.Writer.
+func (s *wsServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, "[WebSocket] "+format, args...)
+}
+
+func (s *wsServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || s.allowOrigin == "*" || origin == s.allowOrigin
+}
+
+func (s *wsServer) onRequest(ctx *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(ctx.Request) {
+		ctx.Writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	wc, err := s.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		return
+	}
+
+	// remove the deadlines set by the HTTP server.
+	// from now on, deadlines are handled by the RTSP server.
+	wc.NetConn().SetDeadline(time.Time{}) //nolint:errcheck
+
+	nconn := &wsConn{wc: wc}
+
+	// use the real IP passed by trusted proxies
+	if addrPort, err2 := netip.ParseAddrPort(httpp.RemoteAddr(ctx)); err2 == nil {
+		nconn.remoteAddr = net.TCPAddrFromAddrPort(addrPort)
+	}
+
+	if !s.listener.push(nconn) {
+		wc.Close()
+	}
+}
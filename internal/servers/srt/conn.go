@@ -56,6 +56,7 @@ type conn struct {
 	writeTimeout        conf.Duration
 	udpMaxPayloadSize   int
 	connReq             srt.ConnRequest
+	remoteAddr          net.Addr
 	runOnConnect        string
 	runOnConnectRestart bool
 	runOnDisconnect     string
@@ -93,11 +94,11 @@ func (c *conn) Close() {
 
 // Log implements logger.Writer.
 func (c *conn) Log(level logger.Level, format string, args ...interface{}) {
-	c.parent.Log(level, "[conn %v] "+format, append([]interface{}{c.connReq.RemoteAddr()}, args...)...)
+	c.parent.Log(level, "[conn %v] "+format, append([]interface{}{c.remoteAddr}, args...)...)
 }
 
 func (c *conn) ip() net.IP {
-	return c.connReq.RemoteAddr().(*net.UDPAddr).IP
+	return c.remoteAddr.(*net.UDPAddr).IP
 }
 
 func (c *conn) run() { //nolint:dupl
@@ -357,7 +358,7 @@ func (c *conn) apiItem() *defs.APISRTConn {
 	item := &defs.APISRTConn{
 		ID:         c.uuid,
 		Created:    c.created,
-		RemoteAddr: c.connReq.RemoteAddr().String(),
+		RemoteAddr: c.remoteAddr.String(),
 		State: func() defs.APISRTConnState {
 			switch c.state {
 			case connStateRead:
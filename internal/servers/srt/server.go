@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"sort"
 	"sync"
@@ -17,9 +18,14 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/externalcmd"
 	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/proxyproto"
 	"github.com/bluenviron/mediamtx/internal/stream"
 )
 
+// relay sessions are closed when no datagram is exchanged within this time.
+// SRT peers send a keepalive every second, therefore this is independent from the read timeout.
+const relayIdleTimeout = 60 * time.Second
+
 // ErrConnNotFound is returned when a connection is not found.
 var ErrConnNotFound = errors.New("connection not found")
 
@@ -74,23 +80,26 @@ type serverParent interface {
 
 // Server is a SRT server.
 type Server struct {
-	Address             string
-	RTSPAddress         string
-	ReadTimeout         conf.Duration
-	WriteTimeout        conf.Duration
-	UDPMaxPayloadSize   int
-	RunOnConnect        string
-	RunOnConnectRestart bool
-	RunOnDisconnect     string
-	ExternalCmdPool     *externalcmd.Pool
-	Metrics             serverMetrics
-	PathManager         serverPathManager
-	Parent              serverParent
+	Address                     string
+	RTSPAddress                 string
+	ReadTimeout                 conf.Duration
+	WriteTimeout                conf.Duration
+	UDPMaxPayloadSize           int
+	ProxyProtocol               bool
+	ProxyProtocolTrustedSources conf.IPNetworks
+	RunOnConnect                string
+	RunOnConnectRestart         bool
+	RunOnDisconnect             string
+	ExternalCmdPool             *externalcmd.Pool
+	Metrics                     serverMetrics
+	PathManager                 serverPathManager
+	Parent                      serverParent
 
 	ctx       context.Context
 	ctxCancel func()
 	wg        sync.WaitGroup
 	ln        srt.Listener
+	relay     *proxyproto.UDPRelay
 	conns     map[*conn]struct{}
 
 	// in
@@ -109,9 +118,34 @@ func (s *Server) Initialize() error {
 	conf.PayloadSize = uint32(srtMaxPayloadSize(s.UDPMaxPayloadSize))
 
 	var err error
-	s.ln, err = srt.Listen("srt", s.Address, conf)
-	if err != nil {
-		return err
+
+	if !s.ProxyProtocol {
+		s.ln, err = srt.Listen("srt", s.Address, conf)
+		if err != nil {
+			return err
+		}
+	} else {
+		// the SRT listener cannot be wrapped, therefore it is placed behind
+		// a relay that strips PROXY protocol headers.
+		s.ln, err = srt.Listen("srt", "127.0.0.1:0", conf)
+		if err != nil {
+			return err
+		}
+
+		s.relay = &proxyproto.UDPRelay{
+			Address:        s.Address,
+			Target:         s.ln.Addr().String(),
+			TrustedSources: s.ProxyProtocolTrustedSources,
+			IdleTimeout:    relayIdleTimeout,
+			OnInvalidHeader: func(src net.Addr, err error) {
+				s.Log(logger.Warn, "discarding datagram from %v: %v", src, err)
+			},
+		}
+		err = s.relay.Initialize()
+		if err != nil {
+			s.ln.Close()
+			return err
+		}
 	}
 
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
@@ -178,6 +212,7 @@ outer:
 				writeTimeout:        s.WriteTimeout,
 				udpMaxPayloadSize:   s.UDPMaxPayloadSize,
 				connReq:             req,
+				remoteAddr:          s.remoteAddr(req.RemoteAddr()),
 				runOnConnect:        s.RunOnConnect,
 				runOnConnectRestart: s.RunOnConnectRestart,
 				runOnDisconnect:     s.RunOnDisconnect,
@@ -235,6 +270,19 @@ outer:
 	s.ctxCancel()
 
 	s.ln.Close()
+
+	if s.relay != nil {
+		s.relay.Close()
+	}
+}
+
+// remoteAddr returns the address of a client,
+// that is different from the connection address when the PROXY protocol is in use.
+func (s *Server) remoteAddr(addr net.Addr) net.Addr {
+	if s.relay != nil {
+		return s.relay.RealAddr(addr)
+	}
+	return addr
 }
 
 func (s *Server) findConnByUUID(uuid uuid.UUID) *conn {
@@ -188,8 +188,12 @@ type Server struct {
 	Encryption            bool
 	ServerKey             string
 	ServerCert            string
+	ClientCA              string
+	ClientCertRequired    bool
 	AllowOrigin           string
 	TrustedProxies        conf.IPNetworks
+	H2C                   bool
+	HTTP3                 bool
 	ReadTimeout           conf.Duration
 	LocalUDPAddress       string
 	LocalTCPAddress       string
@@ -246,15 +250,19 @@ func (s *Server) Initialize() error {
 	s.done = make(chan struct{})
 
 	s.httpServer = &httpServer{
-		address:        s.Address,
-		encryption:     s.Encryption,
-		serverKey:      s.ServerKey,
-		serverCert:     s.ServerCert,
-		allowOrigin:    s.AllowOrigin,
-		trustedProxies: s.TrustedProxies,
-		readTimeout:    s.ReadTimeout,
-		pathManager:    s.PathManager,
-		parent:         s,
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		h2c:                s.H2C,
+		http3:              s.HTTP3,
+		readTimeout:        s.ReadTimeout,
+		pathManager:        s.PathManager,
+		parent:             s,
 	}
 	err := s.httpServer.initialize()
 	if err != nil {
@@ -0,0 +1,186 @@
+package wsfmp4
+
+import (
+	_ "embed"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/restrictnetwork"
+)
+
+//go:embed read_index.html
+var readIndex []byte
+
+func mergePathAndQuery(path string, rawQuery string) string {
+	res := path
+	if rawQuery != "" {
+		res += "?" + rawQuery
+	}
+	return res
+}
+
+func writeError(ctx *gin.Context, statusCode int, err error) {
+	ctx.JSON(statusCode, &defs.APIError{
+		Error: err.Error(),
+	})
+}
+
+type httpServer struct {
+	address            string
+	encryption         bool
+	serverKey          string
+	serverCert         string
+	clientCA           string
+	clientCertRequired bool
+	allowOrigin        string
+	trustedProxies     conf.IPNetworks
+	readTimeout        conf.Duration
+	pathManager        serverPathManager
+	parent             *Server
+
+	inner *httpp.Server
+}
+
+func (s *httpServer) initialize() error {
+	router := gin.New()
+	router.SetTrustedProxies(s.trustedProxies.ToTrustedProxies()) //nolint:errcheck
+
+	router.Use(s.middlewareOrigin)
+
+	router.Use(s.onRequest)
+
+	network, address := restrictnetwork.Restrict("tcp", s.address)
+
+	s.inner = &httpp.Server{
+		Network:            network,
+		Address:            address,
+		ReadTimeout:        time.Duration(s.readTimeout),
+		Encryption:         s.encryption,
+		ServerCert:         s.serverCert,
+		ServerKey:          s.serverKey,
+		ClientCA:           s.clientCA,
+		ClientCertRequired: s.clientCertRequired,
+		Handler:            router,
+		Parent:             s,
+	}
+	err := s.inner.Initialize()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *httpServer) Log(level logger.Level, format string, args ...interface{}) {
+	s.parent.Log(level, format, args...)
+}
+
+func (s *httpServer) close() {
+	s.inner.Close()
+}
+
+func (s *httpServer) checkAuthOutsideSession(ctx *gin.Context, pathName string) bool {
+	req := defs.PathAccessRequest{
+		Name:        pathName,
+		Query:       ctx.Request.URL.RawQuery,
+		Proto:       auth.ProtocolWSFMP4,
+		Credentials: httpp.Credentials(ctx.Request),
+		IP:          net.ParseIP(ctx.ClientIP()),
+	}
+
+	_, err := s.pathManager.FindPathConf(defs.PathFindPathConfReq{
+		AccessRequest: req,
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			if terr.AskCredentials {
+				ctx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				ctx.Writer.WriteHeader(http.StatusUnauthorized)
+				return false
+			}
+
+			s.Log(logger.Info, "connection %v failed to authenticate: %v", httpp.RemoteAddr(ctx), terr.Message)
+
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			writeError(ctx, http.StatusUnauthorized, terr)
+			return false
+		}
+
+		writeError(ctx, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+func (s *httpServer) onPage(ctx *gin.Context, pathName string) {
+	if !s.checkAuthOutsideSession(ctx, pathName) {
+		return
+	}
+
+	ctx.Header("Cache-Control", "max-age=3600")
+	ctx.Header("Content-Type", "text/html")
+	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Writer.Write(readIndex)
+}
+
+func (s *httpServer) middlewareOrigin(ctx *gin.Context) {
+	ctx.Header("Access-Control-Allow-Origin", s.allowOrigin)
+	ctx.Header("Access-Control-Allow-Credentials", "true")
+
+	// preflight requests
+	if ctx.Request.Method == http.MethodOptions &&
+		ctx.Request.Header.Get("Access-Control-Request-Method") != "" {
+		ctx.Header("Access-Control-Allow-Methods", "OPTIONS, GET")
+		ctx.Header("Access-Control-Allow-Headers", "Authorization")
+		ctx.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+}
+
+func (s *httpServer) onRequest(ctx *gin.Context) {
+	if ctx.Request.Method != http.MethodGet {
+		return
+	}
+
+	pth := ctx.Request.URL.Path
+
+	switch {
+	case pth == "/favicon.ico":
+
+	case len(pth) > len("/ws") && strings.HasSuffix(pth, "/ws"):
+		se := s.parent.newSession(serverNewSessionReq{
+			pathName: pth[1 : len(pth)-len("/ws")],
+			ginCtx:   ctx,
+		})
+		if se == nil {
+			ctx.Writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		se.run()
+
+	case len(pth) >= 2:
+		if pth[len(pth)-1] != '/' {
+			ctx.Header("Location", mergePathAndQuery(pth+"/", ctx.Request.URL.RawQuery))
+			ctx.Writer.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+
+		s.onPage(ctx, pth[1:len(pth)-1])
+	}
+}
@@ -0,0 +1,311 @@
+// Package wsfmp4 contains a WebSocket-fMP4 server.
+package wsfmp4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+// ErrSessionNotFound is returned when a session is not found.
+var ErrSessionNotFound = errors.New("session not found")
+
+func interfaceIsEmpty(i interface{}) bool {
+	return reflect.ValueOf(i).Kind() != reflect.Ptr || reflect.ValueOf(i).IsNil()
+}
+
+type serverAPISessionsListRes struct {
+	data *defs.APIWSFMP4SessionList
+	err  error
+}
+
+type serverAPISessionsListReq struct {
+	res chan serverAPISessionsListRes
+}
+
+type serverAPISessionsGetRes struct {
+	data *defs.APIWSFMP4Session
+	err  error
+}
+
+type serverAPISessionsGetReq struct {
+	uuid uuid.UUID
+	res  chan serverAPISessionsGetRes
+}
+
+type serverAPISessionsKickRes struct {
+	err error
+}
+
+type serverAPISessionsKickReq struct {
+	uuid uuid.UUID
+	res  chan serverAPISessionsKickRes
+}
+
+type serverNewSessionReq struct {
+	pathName string
+	ginCtx   *gin.Context
+	res      chan *session
+}
+
+type serverMetrics interface {
+	SetWSFMP4Server(defs.APIWSFMP4Server)
+}
+
+type serverPathManager interface {
+	FindPathConf(req defs.PathFindPathConfReq) (*conf.Path, error)
+	AddReader(req defs.PathAddReaderReq) (defs.Path, *stream.Stream, error)
+}
+
+type serverParent interface {
+	logger.Writer
+}
+
+// Server is a WebSocket-fMP4 server.
+type Server struct {
+	Address            string
+	Encryption         bool
+	ServerKey          string
+	ServerCert         string
+	ClientCA           string
+	ClientCertRequired bool
+	AllowOrigin        string
+	TrustedProxies     conf.IPNetworks
+	ReadTimeout        conf.Duration
+	ExternalCmdPool    *externalcmd.Pool
+	Metrics            serverMetrics
+	PathManager        serverPathManager
+	Parent             serverParent
+
+	ctx        context.Context
+	ctxCancel  func()
+	wg         sync.WaitGroup
+	httpServer *httpServer
+	sessions   map[*session]struct{}
+
+	// in
+	chNewSession      chan serverNewSessionReq
+	chCloseSession    chan *session
+	chAPISessionsList chan serverAPISessionsListReq
+	chAPISessionsGet  chan serverAPISessionsGetReq
+	chAPISessionsKick chan serverAPISessionsKickReq
+}
+
+// Initialize initializes the server.
+func (s *Server) Initialize() error {
+	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+
+	s.sessions = make(map[*session]struct{})
+	s.chNewSession = make(chan serverNewSessionReq)
+	s.chCloseSession = make(chan *session)
+	s.chAPISessionsList = make(chan serverAPISessionsListReq)
+	s.chAPISessionsGet = make(chan serverAPISessionsGetReq)
+	s.chAPISessionsKick = make(chan serverAPISessionsKickReq)
+
+	s.httpServer = &httpServer{
+		address:            s.Address,
+		encryption:         s.Encryption,
+		serverKey:          s.ServerKey,
+		serverCert:         s.ServerCert,
+		clientCA:           s.ClientCA,
+		clientCertRequired: s.ClientCertRequired,
+		allowOrigin:        s.AllowOrigin,
+		trustedProxies:     s.TrustedProxies,
+		readTimeout:        s.ReadTimeout,
+		pathManager:        s.PathManager,
+		parent:             s,
+	}
+	err := s.httpServer.initialize()
+	if err != nil {
+		s.ctxCancel()
+		return err
+	}
+
+	s.Log(logger.Info, "listener opened on "+s.Address)
+
+	s.wg.Add(1)
+	go s.run()
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetWSFMP4Server(s)
+	}
+
+	return nil
+}
+
+// Log implements logger.Writer.
+func (s *Server) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[WebSocket-fMP4] "+format, args...)
+}
+
+// Close closes the server.
+func (s *Server) Close() {
+	s.Log(logger.Info, "listener is closing")
+
+	if !interfaceIsEmpty(s.Metrics) {
+		s.Metrics.SetWSFMP4Server(nil)
+	}
+
+	s.ctxCancel()
+	s.wg.Wait()
+}
+
+func (s *Server) run() {
+	defer s.wg.Done()
+
+outer:
+	for {
+		select {
+		case req := <-s.chNewSession:
+			se := &session{
+				parentCtx:       s.ctx,
+				pathName:        req.pathName,
+				ginCtx:          req.ginCtx,
+				wg:              &s.wg,
+				externalCmdPool: s.ExternalCmdPool,
+				pathManager:     s.PathManager,
+				parent:          s,
+			}
+			se.initialize()
+			s.sessions[se] = struct{}{}
+			req.res <- se
+
+		case se := <-s.chCloseSession:
+			delete(s.sessions, se)
+
+		case req := <-s.chAPISessionsList:
+			data := &defs.APIWSFMP4SessionList{
+				Items: []*defs.APIWSFMP4Session{},
+			}
+
+			for se := range s.sessions {
+				data.Items = append(data.Items, se.apiItem())
+			}
+
+			sort.Slice(data.Items, func(i, j int) bool {
+				return data.Items[i].Created.Before(data.Items[j].Created)
+			})
+
+			req.res <- serverAPISessionsListRes{data: data}
+
+		case req := <-s.chAPISessionsGet:
+			se := s.findSessionByUUID(req.uuid)
+			if se == nil {
+				req.res <- serverAPISessionsGetRes{err: ErrSessionNotFound}
+				continue
+			}
+
+			req.res <- serverAPISessionsGetRes{data: se.apiItem()}
+
+		case req := <-s.chAPISessionsKick:
+			se := s.findSessionByUUID(req.uuid)
+			if se == nil {
+				req.res <- serverAPISessionsKickRes{err: ErrSessionNotFound}
+				continue
+			}
+
+			delete(s.sessions, se)
+			se.Close()
+			req.res <- serverAPISessionsKickRes{}
+
+		case <-s.ctx.Done():
+			break outer
+		}
+	}
+
+	s.ctxCancel()
+
+	s.httpServer.close()
+}
+
+func (s *Server) findSessionByUUID(uuid uuid.UUID) *session {
+	for se := range s.sessions {
+		if se.uuid == uuid {
+			return se
+		}
+	}
+	return nil
+}
+
+// newSession is called by httpServer.
+func (s *Server) newSession(req serverNewSessionReq) *session {
+	req.res = make(chan *session)
+
+	select {
+	case s.chNewSession <- req:
+		return <-req.res
+
+	case <-s.ctx.Done():
+		return nil
+	}
+}
+
+// closeSession is called by session.
+func (s *Server) closeSession(se *session) {
+	select {
+	case s.chCloseSession <- se:
+	case <-s.ctx.Done():
+	}
+}
+
+// APISessionsList is called by api.
+func (s *Server) APISessionsList() (*defs.APIWSFMP4SessionList, error) {
+	req := serverAPISessionsListReq{
+		res: make(chan serverAPISessionsListRes),
+	}
+
+	select {
+	case s.chAPISessionsList <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APISessionsGet is called by api.
+func (s *Server) APISessionsGet(uuid uuid.UUID) (*defs.APIWSFMP4Session, error) {
+	req := serverAPISessionsGetReq{
+		uuid: uuid,
+		res:  make(chan serverAPISessionsGetRes),
+	}
+
+	select {
+	case s.chAPISessionsGet <- req:
+		res := <-req.res
+		return res.data, res.err
+
+	case <-s.ctx.Done():
+		return nil, fmt.Errorf("terminated")
+	}
+}
+
+// APISessionsKick is called by api.
+func (s *Server) APISessionsKick(uuid uuid.UUID) error {
+	req := serverAPISessionsKickReq{
+		uuid: uuid,
+		res:  make(chan serverAPISessionsKickRes),
+	}
+
+	select {
+	case s.chAPISessionsKick <- req:
+		res := <-req.res
+		return res.err
+
+	case <-s.ctx.Done():
+		return fmt.Errorf("terminated")
+	}
+}
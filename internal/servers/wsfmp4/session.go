@@ -0,0 +1,346 @@
+package wsfmp4
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mcfmp4 "github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/bluenviron/mediamtx/internal/auth"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/externalcmd"
+	"github.com/bluenviron/mediamtx/internal/hooks"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	mfmp4 "github.com/bluenviron/mediamtx/internal/protocols/fmp4"
+	"github.com/bluenviron/mediamtx/internal/protocols/httpp"
+	"github.com/bluenviron/mediamtx/internal/protocols/websocket"
+)
+
+// initMessage is sent before every initialization segment and allows
+// clients to create or update a SourceBuffer.
+type initMessage struct {
+	MimeType string `json:"mimeType"`
+}
+
+type sessionTrack struct {
+	track    *mfmp4.Track
+	timeline *mfmp4.TimelineTrack
+}
+
+func (t *sessionTrack) isVideo() bool {
+	return t.track.InitTrack.Codec.IsVideo()
+}
+
+type session struct {
+	parentCtx       context.Context
+	pathName        string
+	ginCtx          *gin.Context
+	wg              *sync.WaitGroup
+	externalCmdPool *externalcmd.Pool
+	pathManager     serverPathManager
+	parent          *Server
+
+	ctx        context.Context
+	ctxCancel  func()
+	uuid       uuid.UUID
+	created    time.Time
+	remoteAddr string
+	query      string
+	bytesSent  *uint64
+
+	// reader routine
+	wc             *websocket.ServerConn
+	tracks         []*sessionTrack
+	trackMap       map[*mfmp4.Track]*sessionTrack
+	hasVideo       bool
+	started        bool
+	timeline       mfmp4.Timeline
+	initNeeded     bool
+	sequenceNumber uint32
+}
+
+func (se *session) initialize() {
+	se.ctx, se.ctxCancel = context.WithCancel(se.parentCtx)
+
+	se.uuid = uuid.New()
+	se.created = time.Now()
+	se.remoteAddr = httpp.RemoteAddr(se.ginCtx)
+	se.query = se.ginCtx.Request.URL.RawQuery
+	se.bytesSent = new(uint64)
+
+	se.Log(logger.Info, "created by %s", se.remoteAddr)
+
+	se.wg.Add(1)
+}
+
+// Close closes the session.
+func (se *session) Close() {
+	se.ctxCancel()
+}
+
+// Log implements logger.Writer.
+func (se *session) Log(level logger.Level, format string, args ...interface{}) {
+	id := hex.EncodeToString(se.uuid[:4])
+	se.parent.Log(level, "[session %v] "+format, append([]interface{}{id}, args...)...)
+}
+
+// run is called by the HTTP handler and returns when the session is closed.
+func (se *session) run() {
+	defer se.wg.Done()
+
+	err := se.runInner()
+
+	se.ctxCancel()
+
+	se.parent.closeSession(se)
+
+	se.Log(logger.Info, "closed: %v", err)
+}
+
+func (se *session) runInner() error {
+	path, strm, err := se.pathManager.AddReader(defs.PathAddReaderReq{
+		Author: se,
+		AccessRequest: defs.PathAccessRequest{
+			Name:        se.pathName,
+			Query:       se.query,
+			Proto:       auth.ProtocolWSFMP4,
+			ID:          &se.uuid,
+			Credentials: httpp.Credentials(se.ginCtx.Request),
+			IP:          net.ParseIP(se.ginCtx.ClientIP()),
+		},
+	})
+	if err != nil {
+		var terr auth.Error
+		if errors.As(err, &terr) {
+			if terr.AskCredentials {
+				se.ginCtx.Header("WWW-Authenticate", `Basic realm="mediamtx"`)
+				se.ginCtx.Writer.WriteHeader(http.StatusUnauthorized)
+				return terr
+			}
+
+			// wait some seconds to mitigate brute force attacks
+			<-time.After(auth.PauseAfterError)
+
+			writeError(se.ginCtx, http.StatusUnauthorized, terr)
+			return terr
+		}
+
+		var terr2 defs.PathNoStreamAvailableError
+		if errors.As(err, &terr2) {
+			writeError(se.ginCtx, http.StatusNotFound, err)
+			return err
+		}
+
+		writeError(se.ginCtx, http.StatusBadRequest, err)
+		return err
+	}
+
+	defer path.RemoveReader(defs.PathRemoveReaderReq{Author: se})
+
+	se.trackMap = make(map[*mfmp4.Track]*sessionTrack)
+	se.initNeeded = true
+
+	tracks := mfmp4.FromStream(
+		strm,
+		se,
+		mfmp4.IsFormatSupported,
+		se.onCodecParams,
+		se.onSample,
+	)
+
+	if len(tracks) == 0 {
+		writeError(se.ginCtx, http.StatusBadRequest, mfmp4.ErrNoSupportedCodecs)
+		return mfmp4.ErrNoSupportedCodecs
+	}
+
+	defer strm.RemoveReader(se)
+
+	for _, track := range tracks {
+		t := &sessionTrack{
+			track: track,
+			timeline: &mfmp4.TimelineTrack{
+				Timeline:  &se.timeline,
+				TimeScale: track.InitTrack.TimeScale,
+			},
+		}
+		se.tracks = append(se.tracks, t)
+		se.trackMap[track] = t
+
+		if t.isVideo() {
+			se.hasVideo = true
+		}
+	}
+
+	wc, err := websocket.NewServerConn(se.ginCtx.Writer, se.ginCtx.Request, se.parent.AllowOrigin)
+	if err != nil {
+		return err
+	}
+	defer wc.Close()
+
+	se.wc = wc
+
+	// read and discard incoming messages in order to process control frames
+	// and detect disconnections.
+	clientGone := make(chan struct{})
+	go func() {
+		defer close(clientGone)
+		for {
+			var in interface{}
+			err := wc.ReadJSON(&in)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	se.Log(logger.Info, "is reading from path '%s', %s",
+		path.Name(), defs.FormatsInfo(strm.ReaderFormats(se)))
+
+	onUnreadHook := hooks.OnRead(hooks.OnReadParams{
+		Logger:          se,
+		ExternalCmdPool: se.externalCmdPool,
+		Conf:            path.SafeConf(),
+		ExternalCmdEnv:  path.ExternalCmdEnv(),
+		Reader:          se.APIReaderDescribe(),
+		Query:           se.query,
+	})
+	defer onUnreadHook()
+
+	strm.StartReader(se)
+
+	select {
+	case <-se.ctx.Done():
+		return fmt.Errorf("terminated")
+
+	case <-clientGone:
+		return fmt.Errorf("client disconnected")
+
+	case err := <-strm.ReaderError(se):
+		return err
+	}
+}
+
+func (se *session) onCodecParams() {
+	se.initNeeded = true
+}
+
+func (se *session) writeInit() error {
+	init := &mcfmp4.Init{}
+	codecs := make([]string, len(se.tracks))
+
+	for i, t := range se.tracks {
+		init.Tracks = append(init.Tracks, t.track.InitTrack)
+		codecs[i] = mfmp4.CodecString(t.track.InitTrack.Codec)
+	}
+
+	var buf seekablebuffer.Buffer
+	err := init.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	mimeType := "audio/mp4"
+	if se.hasVideo {
+		mimeType = "video/mp4"
+	}
+
+	err = se.wc.WriteJSON(&initMessage{
+		MimeType: mimeType + `; codecs="` + strings.Join(codecs, ",") + `"`,
+	})
+	if err != nil {
+		return err
+	}
+
+	return se.writeBinary(buf.Bytes())
+}
+
+func (se *session) writeBinary(byts []byte) error {
+	err := se.wc.WriteBinary(byts)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddUint64(se.bytesSent, uint64(len(byts)))
+	return nil
+}
+
+func (se *session) onSample(track *mfmp4.Track, sample *mfmp4.Sample) error {
+	t := se.trackMap[track]
+
+	// start from a video random access point, if there's a video track.
+	// FromStream() guarantees that the first sample of each video track is a random access point.
+	if !se.started {
+		if se.hasVideo && !t.isVideo() {
+			return nil
+		}
+		se.started = true
+	}
+
+	sample = t.timeline.Push(sample)
+	if sample == nil {
+		return nil
+	}
+
+	baseTime, ok := t.timeline.BaseTime(sample)
+	if !ok {
+		return nil
+	}
+
+	if se.initNeeded {
+		se.initNeeded = false
+
+		err := se.writeInit()
+		if err != nil {
+			return err
+		}
+	}
+
+	se.sequenceNumber++
+
+	part := &mcfmp4.Part{
+		SequenceNumber: se.sequenceNumber,
+		Tracks: []*mcfmp4.PartTrack{{
+			ID:       track.InitTrack.ID,
+			BaseTime: baseTime,
+			Samples:  []*mcfmp4.Sample{sample.Sample},
+		}},
+	}
+
+	var buf seekablebuffer.Buffer
+	err := part.Marshal(&buf)
+	if err != nil {
+		return err
+	}
+
+	return se.writeBinary(buf.Bytes())
+}
+
+// APIReaderDescribe implements reader.
+func (se *session) APIReaderDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "wsfmp4Session",
+		ID:   se.uuid.String(),
+	}
+}
+
+func (se *session) apiItem() *defs.APIWSFMP4Session {
+	return &defs.APIWSFMP4Session{
+		ID:         se.uuid,
+		Created:    se.created,
+		RemoteAddr: se.remoteAddr,
+		Path:       se.pathName,
+		Query:      se.query,
+		BytesSent:  atomic.LoadUint64(se.bytesSent),
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/bluenviron/mediamtx/internal/defs"
 	"github.com/bluenviron/mediamtx/internal/logger"
 	sshls "github.com/bluenviron/mediamtx/internal/staticsources/hls"
+	ssmjpeg "github.com/bluenviron/mediamtx/internal/staticsources/mjpeg"
+	ssrist "github.com/bluenviron/mediamtx/internal/staticsources/rist"
 	ssrpicamera "github.com/bluenviron/mediamtx/internal/staticsources/rpicamera"
 	ssrtmp "github.com/bluenviron/mediamtx/internal/staticsources/rtmp"
 	ssrtsp "github.com/bluenviron/mediamtx/internal/staticsources/rtsp"
@@ -110,6 +112,13 @@ func (s *Handler) Initialize() {
 			Parent:      s,
 		}
 
+	case strings.HasPrefix(s.Conf.Source, "http+mjpeg://") ||
+		strings.HasPrefix(s.Conf.Source, "https+mjpeg://"):
+		s.instance = &ssmjpeg.Source{
+			ReadTimeout: s.ReadTimeout,
+			Parent:      s,
+		}
+
 	case strings.HasPrefix(s.Conf.Source, "udp://"):
 		s.instance = &ssudp.Source{
 			ReadTimeout: s.ReadTimeout,
@@ -122,6 +131,12 @@ func (s *Handler) Initialize() {
 			Parent:      s,
 		}
 
+	case strings.HasPrefix(s.Conf.Source, "rist://"):
+		s.instance = &ssrist.Source{
+			ReadTimeout: s.ReadTimeout,
+			Parent:      s,
+		}
+
 	case strings.HasPrefix(s.Conf.Source, "whep://") ||
 		strings.HasPrefix(s.Conf.Source, "wheps://"):
 		s.instance = &sswebrtc.Source{
@@ -0,0 +1,181 @@
+// Package mjpeg contains the HTTP M-JPEG static source.
+package mjpeg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/tls"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+const (
+	// maximum size of a single JPEG frame.
+	maxFrameSize = 10 * 1024 * 1024
+)
+
+func multiplyAndDivide(v, m, d int64) int64 {
+	secs := v / d
+	dec := v % d
+	return (secs*m + dec*m/d)
+}
+
+// Source is a HTTP M-JPEG static source.
+type Source struct {
+	ReadTimeout conf.Duration
+	Parent      defs.StaticSourceParent
+}
+
+// Log implements logger.Writer.
+func (s *Source) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[MJPEG source] "+format, args...)
+}
+
+// Run implements StaticSource.
+func (s *Source) Run(params defs.StaticSourceRunParams) error {
+	s.Log(logger.Debug, "connecting")
+
+	u, err := url.Parse(params.ResolvedSource)
+	if err != nil {
+		return err
+	}
+
+	u.Scheme = strings.TrimSuffix(u.Scheme, "+mjpeg")
+
+	ctx, ctxCancel := context.WithCancel(params.Context)
+	defer ctxCancel()
+
+	// the response body is read until the end of the stream,
+	// therefore the read timeout is enforced manually, after every frame.
+	readTimer := time.AfterFunc(time.Duration(s.ReadTimeout), ctxCancel)
+	defer readTimer.Stop()
+
+	tr := &http.Transport{
+		TLSClientConfig: tls.ConfigForFingerprint(params.Conf.SourceFingerprint),
+	}
+	defer tr.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return wrapError(params.Context, ctx, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code: %d", res.StatusCode)
+	}
+
+	mediaType, mediaParams, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+
+	boundary := mediaParams["boundary"]
+	if boundary == "" {
+		return fmt.Errorf("boundary is missing")
+	}
+
+	// some cameras prepend dashes to the boundary parameter
+	// even if they are not part of the boundary.
+	boundary = strings.TrimPrefix(boundary, "--")
+
+	medi := &description.Media{
+		Type:    description.MediaTypeVideo,
+		Formats: []format.Format{&format.MJPEG{}},
+	}
+
+	rres := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
+		Desc:               &description.Session{Medias: []*description.Media{medi}},
+		GenerateRTPPackets: true,
+	})
+	if rres.Err != nil {
+		return rres.Err
+	}
+
+	defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+
+	mr := multipart.NewReader(res.Body, boundary)
+	var start time.Time
+
+	for {
+		var part *multipart.Part
+		part, err = mr.NextPart()
+		if err != nil {
+			return wrapError(params.Context, ctx, err)
+		}
+
+		var frame []byte
+		frame, err = io.ReadAll(io.LimitReader(part, maxFrameSize+1))
+		if err != nil {
+			return wrapError(params.Context, ctx, err)
+		}
+
+		if len(frame) > maxFrameSize {
+			return fmt.Errorf("frame size exceeds maximum allowed (%d)", maxFrameSize)
+		}
+
+		readTimer.Reset(time.Duration(s.ReadTimeout))
+
+		if ct := part.Header.Get("Content-Type"); ct != "" && ct != "image/jpeg" {
+			continue
+		}
+
+		if len(frame) == 0 {
+			continue
+		}
+
+		now := time.Now()
+
+		if start.IsZero() {
+			start = now
+		}
+
+		rres.Stream.WriteUnit(medi, medi.Formats[0], &unit.MJPEG{
+			Base: unit.Base{
+				NTP: now,
+				PTS: multiplyAndDivide(int64(now.Sub(start)), 90000, int64(time.Second)),
+			},
+			Frame: frame,
+		})
+	}
+}
+
+func wrapError(parentCtx context.Context, ctx context.Context, err error) error {
+	if parentCtx.Err() != nil {
+		return fmt.Errorf("terminated")
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("read timed out")
+	}
+	return err
+}
+
+// APISourceDescribe implements StaticSource.
+func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "mjpegSource",
+		ID:   "",
+	}
+}
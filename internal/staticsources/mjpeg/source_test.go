@@ -0,0 +1,69 @@
+package mjpeg
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/test"
+	"github.com/bluenviron/mediamtx/internal/unit"
+)
+
+func TestSource(t *testing.T) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 16)), nil)
+	require.NoError(t, err)
+	frame := buf.Bytes()
+
+	s := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodGet, r.Method)
+			require.Equal(t, "/video", r.URL.Path)
+
+			w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=myboundary")
+			w.WriteHeader(http.StatusOK)
+
+			w.Write([]byte("--myboundary\r\n" +
+				"Content-Type: image/jpeg\r\n" +
+				"Content-Length: " + strconv.FormatInt(int64(len(frame)), 10) + "\r\n" +
+				"\r\n"))
+			w.Write(frame)
+			w.Write([]byte("\r\n--myboundary\r\n"))
+			w.(http.Flusher).Flush()
+
+			<-r.Context().Done()
+		}),
+	}
+
+	ln, err := net.Listen("tcp", "localhost:5780")
+	require.NoError(t, err)
+
+	go s.Serve(ln)
+	defer s.Shutdown(context.Background())
+
+	te := test.NewSourceTester(
+		func(p defs.StaticSourceParent) defs.StaticSource {
+			return &Source{
+				ReadTimeout: conf.Duration(10 * time.Second),
+				Parent:      p,
+			}
+		},
+		"http+mjpeg://localhost:5780/video",
+		&conf.Path{},
+	)
+	defer te.Close()
+
+	u := <-te.Unit
+	require.Equal(t, frame, u.(*unit.MJPEG).Frame)
+	require.NotEmpty(t, u.GetRTPPackets())
+}
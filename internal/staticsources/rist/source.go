@@ -0,0 +1,265 @@
+// Package rist contains the RIST static source.
+package rist
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	mcmpegts "github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/counterdumper"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/logger"
+	"github.com/bluenviron/mediamtx/internal/protocols/mpegts"
+	"github.com/bluenviron/mediamtx/internal/protocols/rist"
+	"github.com/bluenviron/mediamtx/internal/stream"
+)
+
+const (
+	// same default as librist
+	defaultBufferSize = 1 * time.Second
+
+	udpReadBufferSize = 65535
+)
+
+// peer is the address of the sender.
+// In listener mode, it is filled when the first packet is received.
+type peer struct {
+	mutex    sync.RWMutex
+	rtcpAddr *net.UDPAddr
+}
+
+func (p *peer) get() *net.UDPAddr {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.rtcpAddr
+}
+
+// accept checks whether a packet comes from the sender, and learns its address when unknown.
+func (p *peer) accept(addr *net.UDPAddr, isRTCP bool) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.rtcpAddr == nil {
+		if isRTCP {
+			p.rtcpAddr = addr
+		} else {
+			p.rtcpAddr = &net.UDPAddr{IP: addr.IP, Port: addr.Port | 1}
+		}
+		return true
+	}
+
+	if !p.rtcpAddr.IP.Equal(addr.IP) {
+		return false
+	}
+
+	if isRTCP {
+		p.rtcpAddr = addr
+	}
+	return true
+}
+
+// Source is a RIST static source.
+type Source struct {
+	ReadTimeout conf.Duration
+	Parent      defs.StaticSourceParent
+}
+
+// Log implements logger.Writer.
+func (s *Source) Log(level logger.Level, format string, args ...interface{}) {
+	s.Parent.Log(level, "[RIST source] "+format, args...)
+}
+
+// Run implements StaticSource.
+func (s *Source) Run(params defs.StaticSourceRunParams) error {
+	s.Log(logger.Debug, "connecting")
+
+	u, err := url.Parse(params.ResolvedSource)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+
+	// as in librist, rist://@host:port means that the source listens for a sender,
+	// while rist://host:port means that the source connects to a sender.
+	listen := strings.HasPrefix(params.ResolvedSource[len("rist://"):], "@")
+
+	bufferSize := defaultBufferSize
+	if v := q.Get("buffer"); v != "" {
+		var tmp uint64
+		tmp, err = strconv.ParseUint(v, 10, 31)
+		if err != nil {
+			return fmt.Errorf("invalid buffer: %s", v)
+		}
+		bufferSize = time.Duration(tmp) * time.Millisecond
+	}
+
+	cname := q.Get("cname")
+	if cname == "" {
+		cname = "mediamtx"
+	}
+
+	var rtpConn, rtcpConn net.PacketConn
+	p := &peer{}
+
+	if listen {
+		rtpConn, rtcpConn, err = rist.Listen(u.Host)
+		if err != nil {
+			return err
+		}
+	} else {
+		var addr *net.UDPAddr
+		addr, err = net.ResolveUDPAddr("udp", u.Host)
+		if err != nil {
+			return err
+		}
+
+		p.rtcpAddr = &net.UDPAddr{IP: addr.IP, Port: addr.Port + 1}
+
+		rtpConn, rtcpConn, err = rist.Listen(":0")
+		if err != nil {
+			return err
+		}
+	}
+
+	// goroutines are waited after sockets are closed.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	defer rtpConn.Close()
+	defer rtcpConn.Close()
+
+	r := &rist.Receiver{
+		BufferSize:  bufferSize,
+		ReadTimeout: time.Duration(s.ReadTimeout),
+		CNAME:       cname,
+		WriteRTCP: func(buf []byte) error {
+			addr := p.get()
+			if addr == nil {
+				return nil
+			}
+			_, err2 := rtcpConn.WriteTo(buf, addr)
+			return err2
+		},
+	}
+	err = r.Initialize()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		runPacketReader(rtpConn, p, false, r.ProcessRTP)
+	}()
+	go func() {
+		defer wg.Done()
+		runPacketReader(rtcpConn, p, true, r.ProcessRTCP)
+	}()
+
+	readerErr := make(chan error)
+	go func() {
+		readerErr <- s.runReader(r)
+	}()
+
+	for {
+		select {
+		case err = <-readerErr:
+			return err
+
+		case <-params.ReloadConf:
+
+		case <-params.Context.Done():
+			r.Close()
+			<-readerErr
+			return nil
+		}
+	}
+}
+
+func runPacketReader(pc net.PacketConn, p *peer, isRTCP bool, cb func([]byte) error) {
+	buf := make([]byte, udpReadBufferSize)
+
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		if !p.accept(addr.(*net.UDPAddr), isRTCP) {
+			continue
+		}
+
+		cb(append([]byte(nil), buf[:n]...)) //nolint:errcheck
+	}
+}
+
+func (s *Source) runReader(r *rist.Receiver) error {
+	mr := &mcmpegts.Reader{R: mcmpegts.NewBufferedReader(r)}
+	err := mr.Initialize()
+	if err != nil {
+		return err
+	}
+
+	decodeErrors := &counterdumper.CounterDumper{
+		OnReport: func(val uint64) {
+			s.Log(logger.Warn, "%d decode %s",
+				val,
+				func() string {
+					if val == 1 {
+						return "error"
+					}
+					return "errors"
+				}())
+		},
+	}
+
+	decodeErrors.Start()
+	defer decodeErrors.Stop()
+
+	mr.OnDecodeError(func(_ error) {
+		decodeErrors.Increase()
+	})
+
+	var stream *stream.Stream
+
+	medias, err := mpegts.ToStream(mr, &stream, s)
+	if err != nil {
+		return err
+	}
+
+	res := s.Parent.SetReady(defs.PathSourceStaticSetReadyReq{
+		Desc:               &description.Session{Medias: medias},
+		GenerateRTPPackets: true,
+	})
+	if res.Err != nil {
+		return res.Err
+	}
+
+	defer s.Parent.SetNotReady(defs.PathSourceStaticSetNotReadyReq{})
+
+	stream = res.Stream
+
+	for {
+		err = mr.Read()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// APISourceDescribe implements StaticSource.
+func (*Source) APISourceDescribe() defs.APIPathSourceOrReader {
+	return defs.APIPathSourceOrReader{
+		Type: "ristSource",
+		ID:   "",
+	}
+}
@@ -0,0 +1,125 @@
+package rist
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+	"github.com/pion/rtp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bluenviron/mediamtx/internal/conf"
+	"github.com/bluenviron/mediamtx/internal/defs"
+	"github.com/bluenviron/mediamtx/internal/test"
+)
+
+func writeStream(t *testing.T, conn *net.UDPConn, dest *net.UDPAddr) {
+	track := &mpegts.Track{
+		Codec: &mpegts.CodecH264{},
+	}
+
+	var buf bytes.Buffer
+	w := &mpegts.Writer{W: &buf, Tracks: []*mpegts.Track{track}}
+	err := w.Initialize()
+	require.NoError(t, err)
+
+	err = w.WriteH264(track, 0, 0, [][]byte{{ // IDR
+		5, 1,
+	}})
+	require.NoError(t, err)
+
+	err = w.WriteH264(track, 0, 0, [][]byte{{ // non-IDR
+		5, 2,
+	}})
+	require.NoError(t, err)
+
+	byts := buf.Bytes()
+
+	for i := uint16(0); len(byts) != 0; i++ {
+		n := min(len(byts), 7*188)
+
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    33,
+				SequenceNumber: 100 + i,
+				SSRC:           0x1000,
+			},
+			Payload: byts[:n],
+		}
+		byts = byts[n:]
+
+		var enc []byte
+		enc, err = pkt.Marshal()
+		require.NoError(t, err)
+
+		_, err = conn.WriteToUDP(enc, dest)
+		require.NoError(t, err)
+	}
+}
+
+func TestSource(t *testing.T) {
+	for _, ca := range []string{
+		"listener",
+		"caller",
+	} {
+		t.Run(ca, func(t *testing.T) {
+			rtpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9034})
+			require.NoError(t, err)
+			defer rtpConn.Close()
+
+			rtcpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9035})
+			require.NoError(t, err)
+			defer rtcpConn.Close()
+
+			var src string
+
+			if ca == "listener" {
+				src = "rist://@127.0.0.1:9032"
+			} else {
+				src = "rist://127.0.0.1:9034?buffer=500"
+			}
+
+			te := test.NewSourceTester(
+				func(p defs.StaticSourceParent) defs.StaticSource {
+					return &Source{
+						ReadTimeout: conf.Duration(10 * time.Second),
+						Parent:      p,
+					}
+				},
+				src,
+				&conf.Path{},
+			)
+			defer te.Close()
+
+			var dest *net.UDPAddr
+
+			if ca == "listener" {
+				time.Sleep(50 * time.Millisecond)
+				dest = &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9032}
+			} else {
+				// the source sends RTCP packets to the sender, that replies with RTP packets.
+				buf := make([]byte, 1500)
+				rtcpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, addr, err2 := rtcpConn.ReadFromUDP(buf)
+				require.NoError(t, err2)
+				dest = &net.UDPAddr{IP: addr.IP, Port: addr.Port - 1}
+			}
+
+			writeStream(t, rtpConn, dest)
+
+			<-te.Unit
+
+			if ca == "listener" {
+				// the source sends RTCP packets to the port following the RTP one.
+				buf := make([]byte, 1500)
+				rtcpConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, addr, err2 := rtcpConn.ReadFromUDP(buf)
+				require.NoError(t, err2)
+				require.Equal(t, 9033, addr.Port)
+			}
+		})
+	}
+}
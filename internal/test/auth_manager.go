@@ -6,6 +6,9 @@ import "github.com/bluenviron/mediamtx/internal/auth"
 type AuthManager struct {
 	AuthenticateImpl   func(req *auth.Request) error
 	RefreshJWTJWKSImpl func()
+	LockoutStateImpl   func() *auth.LockoutState
+	ClearLockoutsImpl  func(typ auth.LockoutType, value string) int
+	FlushHTTPCacheImpl func() int
 }
 
 // Authenticate replicates auth.Manager.Replicate
@@ -18,6 +21,21 @@ func (m *AuthManager) RefreshJWTJWKS() {
 	m.RefreshJWTJWKSImpl()
 }
 
+// LockoutState replicates auth.Manager.LockoutState.
+func (m *AuthManager) LockoutState() *auth.LockoutState {
+	return m.LockoutStateImpl()
+}
+
+// ClearLockouts replicates auth.Manager.ClearLockouts.
+func (m *AuthManager) ClearLockouts(typ auth.LockoutType, value string) int {
+	return m.ClearLockoutsImpl(typ, value)
+}
+
+// FlushHTTPCache replicates auth.Manager.FlushHTTPCache.
+func (m *AuthManager) FlushHTTPCache() int {
+	return m.FlushHTTPCacheImpl()
+}
+
 // NilAuthManager is an auth manager that accepts everything.
 var NilAuthManager = &AuthManager{
 	AuthenticateImpl: func(_ *auth.Request) error {
@@ -25,4 +43,13 @@ var NilAuthManager = &AuthManager{
 	},
 	RefreshJWTJWKSImpl: func() {
 	},
+	LockoutStateImpl: func() *auth.LockoutState {
+		return nil
+	},
+	ClearLockoutsImpl: func(_ auth.LockoutType, _ string) int {
+		return 0
+	},
+	FlushHTTPCacheImpl: func() int {
+		return 0
+	},
 }
@@ -51,10 +51,22 @@ func TestAPIDocs(t *testing.T) {
 			"AuthInternalUserPermission",
 			conf.AuthInternalUserPermission{},
 		},
+		{
+			"AuthLockout",
+			defs.APIAuthLockout{},
+		},
+		{
+			"AuthLockoutList",
+			defs.APIAuthLockoutList{},
+		},
 		{
 			"GlobalConf",
 			conf.Conf{},
 		},
+		{
+			"MPTSProgram",
+			conf.MPTSProgram{},
+		},
 		{
 			"PathConf",
 			conf.Path{},
@@ -79,6 +91,14 @@ func TestAPIDocs(t *testing.T) {
 			"PathReader",
 			defs.APIPathSourceOrReader{},
 		},
+		{
+			"DASHMuxer",
+			defs.APIDASHMuxer{},
+		},
+		{
+			"DASHMuxerList",
+			defs.APIDASHMuxerList{},
+		},
 		{
 			"HLSMuxer",
 			defs.APIHLSMuxer{},
@@ -91,6 +111,42 @@ func TestAPIDocs(t *testing.T) {
 			"Recording",
 			defs.APIRecording{},
 		},
+		{
+			"HTTPFLVConn",
+			defs.APIHTTPFLVConn{},
+		},
+		{
+			"HTTPFLVConnList",
+			defs.APIHTTPFLVConnList{},
+		},
+		{
+			"WSFMP4Session",
+			defs.APIWSFMP4Session{},
+		},
+		{
+			"WSFMP4SessionList",
+			defs.APIWSFMP4SessionList{},
+		},
+		{
+			"MoQSession",
+			defs.APIMoQSession{},
+		},
+		{
+			"MoQSessionList",
+			defs.APIMoQSessionList{},
+		},
+		{
+			"GB28181Channel",
+			defs.APIGB28181Channel{},
+		},
+		{
+			"GB28181Device",
+			defs.APIGB28181Device{},
+		},
+		{
+			"GB28181DeviceList",
+			defs.APIGB28181DeviceList{},
+		},
 		{
 			"RecordingList",
 			defs.APIRecordingList{},
@@ -99,6 +155,26 @@ func TestAPIDocs(t *testing.T) {
 			"RecordingSegment",
 			defs.APIRecordingSegment{},
 		},
+		{
+			"RecordingVerification",
+			defs.APIRecordingVerification{},
+		},
+		{
+			"RecordingVerificationSegment",
+			defs.APIRecordingVerificationSegment{},
+		},
+		{
+			"RecordLock",
+			defs.APIRecordLock{},
+		},
+		{
+			"RecordLockList",
+			defs.APIRecordLockList{},
+		},
+		{
+			"RecordLockAdd",
+			defs.APIRecordLockAdd{},
+		},
 		{
 			"RTMPConn",
 			defs.APIRTMPConn{},
@@ -131,6 +207,14 @@ func TestAPIDocs(t *testing.T) {
 			"SRTConnList",
 			defs.APISRTConnList{},
 		},
+		{
+			"RISTConn",
+			defs.APIRISTConn{},
+		},
+		{
+			"RISTConnList",
+			defs.APIRISTConnList{},
+		},
 		{
 			"WebRTCSession",
 			defs.APIWebRTCSession{},